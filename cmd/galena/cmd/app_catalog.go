@@ -20,10 +20,10 @@ const (
 )
 
 type catalogItem struct {
-	Name      string
-	Kind      catalogKind
-	Sources   []string
-	Installed bool
+	Name      string      `json:"name"`
+	Kind      catalogKind `json:"kind"`
+	Sources   []string    `json:"sources"`
+	Installed bool        `json:"installed"`
 }
 
 func loadCatalogForKinds(kinds []catalogKind) ([]catalogItem, error) {
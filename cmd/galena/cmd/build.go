@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,24 +15,41 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
 	"github.com/iiroan/galena/internal/ui"
+	"github.com/iiroan/galena/internal/version"
 )
 
 var (
-	buildVariant     string
-	buildTag         string
-	buildNumber      int
-	buildNoCache     bool
-	buildPush        bool
-	buildSign        bool
-	buildSBOM        bool
-	buildRechunk     bool
-	buildDryRun      bool
-	buildUseJust     bool
-	buildInteractive bool
-	buildTimeout     string
-	buildArgs        []string
+	buildVariant      string
+	buildTag          string
+	buildNumber       int
+	buildNoCache      bool
+	buildPush         bool
+	buildSign         bool
+	buildSBOM         bool
+	buildSBOMTool     string
+	buildRechunk      bool
+	buildDryRun       bool
+	buildUseJust      bool
+	buildInteractive  bool
+	buildTimeout      string
+	buildArgs         []string
+	buildDirtyPolicy  string
+	buildHealthcheck  bool
+	buildTest         bool
+	buildArch         []string
+	buildAllVariants  bool
+	buildJobs         int
+	buildReproducible bool
+	buildCacheFrom    []string
+	buildCacheTo      string
+	buildSecrets      []string
+	buildResume       bool
+	buildProvenance   bool
+	buildWait         bool
 )
 
 var buildCmd = &cobra.Command{
@@ -55,6 +74,30 @@ Examples:
   # Build, sign, and generate SBOM
   galena-build build --push --sign --sbom
 
+  # Verify configured systemd units start before pushing
+  galena-build build --healthcheck --push
+
+  # Build every configured variant, two at a time
+  galena-build build --all-variants --jobs 2
+
+  # Build selected variants concurrently
+  galena-build build --variant main,nvidia,dx
+
+  # Build a multi-arch manifest list and push it
+  galena-build build --arch amd64,arm64 --push
+
+  # Reuse and refresh a layer cache stored in the registry
+  galena-build build --cache-from ghcr.io/acme/galena-cache --cache-to ghcr.io/acme/galena-cache
+
+  # Expose a token to RUN --mount=type=secret,id=gh_token
+  galena-build build --secret id=gh_token,src=.secrets/gh_token
+
+  # Continue after a failed push without rebuilding
+  galena-build build --push --sign --resume
+
+  # Pin timestamps so two builds of the same commit share a digest
+  galena-build build --reproducible
+
   # Use existing Justfile (Phase 1 compatibility)
   galena-build build --just`,
 	Args: cobra.MaximumNArgs(1),
@@ -62,29 +105,43 @@ Examples:
 }
 
 func init() {
-	buildCmd.Flags().StringVarP(&buildVariant, "variant", "V", "main", "Image variant (main, nvidia, dx)")
+	buildCmd.Flags().StringVarP(&buildVariant, "variant", "V", "main", "Image variant (main, nvidia, dx); comma-separate to build several")
 	buildCmd.Flags().StringVarP(&buildTag, "tag", "t", "latest", "Image tag (stable, latest, beta)")
 	buildCmd.Flags().IntVarP(&buildNumber, "build-number", "n", 0, "Build number for versioning")
 	buildCmd.Flags().BoolVar(&buildNoCache, "no-cache", false, "Build without cache")
 	buildCmd.Flags().BoolVar(&buildPush, "push", false, "Push image to registry after build")
 	buildCmd.Flags().BoolVar(&buildSign, "sign", false, "Sign image with cosign after push")
-	buildCmd.Flags().BoolVar(&buildSBOM, "sbom", false, "Generate SBOM with trivy")
+	buildCmd.Flags().BoolVar(&buildSBOM, "sbom", false, "Generate SBOM")
+	buildCmd.Flags().StringVar(&buildSBOMTool, "sbom-tool", build.SBOMToolAuto, "SBOM tool (auto, trivy, syft)")
+	buildCmd.Flags().BoolVar(&buildProvenance, "provenance", false, "Generate SLSA provenance; attested to the image with --push")
 	buildCmd.Flags().BoolVar(&buildRechunk, "rechunk", false, "Rechunk image for optimization")
-	buildCmd.Flags().BoolVar(&buildDryRun, "dry-run", false, "Show what would be done without executing")
 	buildCmd.Flags().BoolVar(&buildUseJust, "just", false, "Use existing Justfile recipes")
 	buildCmd.Flags().BoolVarP(&buildInteractive, "interactive", "i", false, "Interactive mode with prompts")
 	buildCmd.Flags().StringVar(&buildTimeout, "timeout", "", "Build timeout (e.g. 45m, 2h)")
 	buildCmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Additional build arg (KEY=VALUE)")
+	buildCmd.Flags().BoolVar(&buildHealthcheck, "healthcheck", false, "Boot the image with systemd and check configured units after build")
+	buildCmd.Flags().BoolVar(&buildTest, "test", false, "Run the smoke tests in build.tests inside the image after build")
+	buildCmd.Flags().StringVar(&buildDirtyPolicy, "dirty-policy", "", "Policy for uncommitted changes (warn, block-push, suffix)")
+	buildCmd.Flags().BoolVar(&buildAllVariants, "all-variants", false, "Build every configured variant concurrently")
+	buildCmd.Flags().IntVar(&buildJobs, "jobs", build.DefaultMatrixJobs, "Variants built concurrently with --all-variants or a variant list")
+	buildCmd.Flags().StringSliceVar(&buildArch, "arch", nil, "Target architectures for a multi-arch manifest (e.g. amd64,arm64)")
+	buildCmd.Flags().StringSliceVar(&buildCacheFrom, "cache-from", nil, "Registry repositories to reuse cached layers from (default: build.cache.from)")
+	buildCmd.Flags().StringVar(&buildCacheTo, "cache-to", "", "Registry repository to push cached layers to (default: build.cache.to)")
+	buildCmd.Flags().StringArrayVar(&buildSecrets, "secret", nil, "Build secret (id=NAME,src=FILE or id=NAME,env=VAR); adds to build.secrets")
+	buildCmd.Flags().BoolVar(&buildWait, "wait", false, "Wait for another build of the project to finish instead of failing")
+	buildCmd.Flags().BoolVar(&buildResume, "resume", false, "Resume from the last successful step of a failed build")
+	buildCmd.Flags().BoolVar(&buildReproducible, "reproducible", false, "Pin SOURCE_DATE_EPOCH and timestamps for bit-for-bit reproducible images")
 }
 
-func runBuild(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+func runBuild(cmd *cobra.Command, args []string) (err error) {
+	ctx, stop := interruptibleContext()
+	defer stop()
 
 	rootDir, err := getProjectRoot()
 	if err != nil {
 		return fmt.Errorf("finding project root: %w", err)
 	}
-	if err := platform.RequireLinux("build"); err != nil {
+	if err := platform.Require(platform.ImageBuilds, "build"); err != nil {
 		return err
 	}
 
@@ -92,8 +149,30 @@ func runBuild(cmd *cobra.Command, args []string) error {
 	if err := applyBuildTimeout(cmd); err != nil {
 		return err
 	}
+	if err := validateDirtyPolicy(buildDirtyPolicy); err != nil {
+		return err
+	}
+	applyBuildCache()
+
+	// One build per project at a time: concurrent builds overwrite each
+	// other's manifest and tags
+	if !buildDryRun {
+		lock, err := acquireBuildLock(ctx, rootDir, cmd.CommandPath(), buildWait)
+		if err != nil {
+			return err
+		}
+		defer releaseBuildLock(lock)
+	}
+	session := startSession(rootDir, "build")
+	defer func() { endSession(session, err) }()
 
-	isInteractive := buildInteractive || (len(args) == 0 && !cmd.Flags().Changed("variant") && !cmd.Flags().Changed("tag") && !cmd.Flags().Changed("just"))
+	if buildInteractive {
+		if err := ui.RequireInteractive("build --interactive", "--variant and --tag"); err != nil {
+			return err
+		}
+	}
+	// Without a terminal, a build without flags builds the defaults
+	isInteractive := ui.IsInteractiveTerminal() && (buildInteractive || (len(args) == 0 && !cmd.Flags().Changed("variant") && !cmd.Flags().Changed("tag") && !cmd.Flags().Changed("just") && !buildAllVariants))
 
 	if isInteractive {
 		if err := runInteractiveFlow(ctx, rootDir); err != nil {
@@ -107,12 +186,20 @@ func runBuild(cmd *cobra.Command, args []string) error {
 
 	builder := build.NewBuilder(cfg, rootDir, logger)
 
+	variants := build.ParseVariants(buildVariant)
+	if buildAllVariants {
+		variants = cfg.ListVariantNames()
+	}
+
 	if buildUseJust {
+		if len(variants) > 1 {
+			return fmt.Errorf("--just builds one variant at a time; drop --just to build a matrix")
+		}
 		opts := build.BuildOptions{
 			Variant: buildVariant,
 			Tag:     buildTag,
 		}
-		return builder.BuildViaJust(ctx, opts)
+		return output.EmitSummary("build", nil, builder.BuildViaJust(ctx, opts))
 	}
 
 	extraArgs, err := parseKeyValuePairs(buildArgs)
@@ -128,10 +215,22 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		Push:           buildPush,
 		Sign:           buildSign,
 		SBOM:           buildSBOM,
+		SBOMTool:       buildSBOMTool,
 		Rechunk:        buildRechunk,
 		DryRun:         buildDryRun,
+		Healthcheck:    buildHealthcheck,
+		Test:           buildTest,
+		DirtyPolicy:    buildDirtyPolicy,
 		Timeout:        build.DefaultBuildOptions().Timeout,
 		ExtraBuildArgs: extraArgs,
+		Arch:           buildArch,
+		Reproducible:   buildReproducible,
+		CacheFrom:      buildCacheFrom,
+		CacheTo:        buildCacheTo,
+		Secrets:        buildSecrets,
+		Resume:         buildResume,
+		Provenance:     buildProvenance,
+		Progress:       buildProgress(),
 	}
 	if buildTimeout != "" {
 		parsed, err := time.ParseDuration(buildTimeout)
@@ -141,10 +240,34 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		opts.Timeout = parsed
 	}
 
+	if builder.WorkingTreeDirty(ctx) && !output.IsJSON() {
+		fmt.Println(ui.WarningBox.Render(dirtyTreeNotice(buildDirtyPolicy)))
+	}
+
+	if len(variants) > 1 {
+		return runBuildMatrix(ctx, builder, rootDir, opts, variants)
+	}
+	if len(variants) == 1 {
+		opts.Variant = variants[0]
+	}
+
+	started := time.Now()
 	manifest, err := builder.Build(ctx, opts)
+	notifyBuild(ctx, manifest, opts, started, err)
 	if err != nil {
+		if manifest != nil {
+			saveFailureManifest(rootDir, manifest)
+		}
 		return err
 	}
+	if buildDryRun {
+		if output.IsJSON() {
+			return output.EmitSummary("build", buildResult{BuildManifest: manifest}, nil)
+		}
+		fmt.Println()
+		fmt.Println(dryRunBox("nothing was built, pushed, or written.", "Image: "+manifest.Version.ImageRef))
+		return nil
+	}
 
 	manifestPath := filepath.Join(rootDir, "build-manifest.json")
 	if err := manifest.Save(manifestPath); err != nil {
@@ -153,6 +276,10 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		logger.Info("manifest saved", "path", manifestPath)
 	}
 
+	if output.IsJSON() {
+		return output.EmitSummary("build", buildResult{ManifestPath: manifestPath, BuildManifest: manifest}, nil)
+	}
+
 	fmt.Println()
 	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf(
 		"Build completed successfully!\n\nImage: %s\nVersion: %s",
@@ -163,6 +290,96 @@ func runBuild(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// saveFailureManifest records an interrupted build in the build manifest
+func saveFailureManifest(rootDir string, manifest *version.BuildManifest) {
+	manifestPath := filepath.Join(rootDir, "build-manifest.json")
+	if err := manifest.Save(manifestPath); err != nil {
+		logger.Warn("could not save failure manifest", "error", err)
+	} else {
+		logger.Info("failure manifest saved", "path", manifestPath)
+	}
+}
+
+// buildProgress returns the progress view for image builds, or nil to stream
+// the raw engine output
+func buildProgress() build.ProgressFunc {
+	// Plain mode, which --output-format json implies, streams the engine output
+	if ui.IsPlain() {
+		return nil
+	}
+	return ui.RunBuildProgress
+}
+
+func runBuildMatrix(ctx context.Context, builder *build.Builder, rootDir string, opts build.BuildOptions, variants []string) error {
+	started := time.Now()
+	manifest, results, err := builder.BuildMatrix(ctx, build.MatrixOptions{
+		Variants: variants,
+		Jobs:     buildJobs,
+		Build:    opts,
+	})
+	notifyBuild(ctx, manifest, opts, started, err)
+	manifestPath := ""
+	if manifest != nil && !opts.DryRun {
+		manifestPath = filepath.Join(rootDir, "build-manifest.json")
+		if saveErr := manifest.Save(manifestPath); saveErr != nil {
+			logger.Warn("could not save manifest", "error", saveErr)
+		} else {
+			logger.Info("manifest saved", "path", manifestPath)
+		}
+	}
+	if len(results) == 0 {
+		return err
+	}
+
+	if output.IsJSON() {
+		result := buildResult{ManifestPath: manifestPath, BuildManifest: manifest}
+		for _, r := range results {
+			vr := variantResult{Variant: r.Variant, Status: r.Status(), Duration: r.Duration.Seconds()}
+			if r.Err != nil {
+				vr.Error = r.Err.Error()
+			}
+			result.Variants = append(result.Variants, vr)
+		}
+		return output.EmitSummary("build", result, err)
+	}
+
+	lines := make([]string, 0, len(results))
+	for _, r := range results {
+		line := fmt.Sprintf("%-12s %-10s %s", r.Variant, r.Status(), r.Duration.Round(time.Second))
+		if r.Err != nil {
+			line += "  " + r.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+
+	fmt.Println()
+	if err != nil {
+		fmt.Println(ui.ErrorBox.Render("Build matrix finished with failures\n\n" + strings.Join(lines, "\n")))
+		return err
+	}
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf(
+		"Build matrix completed successfully!\n\nVersion: %s\n\n%s",
+		manifest.Version.Version,
+		strings.Join(lines, "\n"),
+	)))
+	return nil
+}
+
+// buildResult is the JSON summary of a build
+type buildResult struct {
+	ManifestPath string          `json:"manifest_path,omitempty"`
+	Variants     []variantResult `json:"variants,omitempty"`
+	*version.BuildManifest
+}
+
+// variantResult is the JSON summary of one variant in a build matrix
+type variantResult struct {
+	Variant  string  `json:"variant"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
 func runInteractiveFlow(ctx context.Context, rootDir string) error {
 	var buildType string
 
@@ -272,6 +489,14 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 					Title("Rechunk").
 					Description("Optimize image layer chunks").
 					Value(&buildRechunk),
+				huh.NewConfirm().
+					Title("Healthcheck").
+					Description("Boot with systemd and verify configured units").
+					Value(&buildHealthcheck),
+				huh.NewConfirm().
+					Title("Smoke Tests").
+					Description("Run the configured checks inside the image").
+					Value(&buildTest),
 				huh.NewConfirm().
 					Title("Dry Run").
 					Description("Skip the actual build").
@@ -306,6 +531,37 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 		)
 	}
 
+	currentOptions := func() build.BuildOptions {
+		return build.BuildOptions{
+			Variant:     buildVariant,
+			Tag:         buildTag,
+			Push:        buildPush,
+			Sign:        buildSign,
+			SBOM:        buildSBOM,
+			NoCache:     buildNoCache,
+			Rechunk:     buildRechunk,
+			DryRun:      buildDryRun,
+			Healthcheck: buildHealthcheck,
+			Test:        buildTest,
+		}
+	}
+	startBuild := true
+	groups = append(groups,
+		huh.NewGroup(
+			huh.NewNote().
+				Title("Estimate").
+				DescriptionFunc(func() string {
+					return estimateSummary(rootDir, currentOptions())
+				}, []any{&buildVariant, &buildPush, &buildSign, &buildSBOM, &buildNoCache, &buildRechunk, &buildDryRun, &buildHealthcheck, &buildTest}),
+			huh.NewConfirm().
+				Title("Start Build").
+				Description("Go back to adjust options, or start the build now").
+				Affirmative("Build").
+				Negative("Cancel").
+				Value(&startBuild),
+		),
+	)
+
 	form := huh.NewForm(groups...).WithTheme(ui.HuhTheme())
 
 	if err := form.Run(); err != nil {
@@ -314,6 +570,9 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 		}
 		return err
 	}
+	if !startBuild {
+		return nil
+	}
 
 	if advancedMode {
 		buildNumber = 0
@@ -341,7 +600,7 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 	)
 	if advancedMode {
 		buildPlan = fmt.Sprintf(
-			"Build Plan\n\nVariant: %s\nTag: %s\nBuild Number: %d\nPush: %t\nSign: %t\nSBOM: %t\nNo Cache: %t\nRechunk: %t\nDry Run: %t\nUse Justfile: %t\nTimeout: %s\nExtra Args: %s",
+			"Build Plan\n\nVariant: %s\nTag: %s\nBuild Number: %d\nPush: %t\nSign: %t\nSBOM: %t\nNo Cache: %t\nRechunk: %t\nHealthcheck: %t\nSmoke Tests: %t\nDry Run: %t\nUse Justfile: %t\nArchitectures: %s\nTimeout: %s\nExtra Args: %s",
 			buildVariant,
 			buildTag,
 			buildNumber,
@@ -350,18 +609,27 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 			buildSBOM,
 			buildNoCache,
 			buildRechunk,
+			buildHealthcheck,
+			buildTest,
 			buildDryRun,
 			buildUseJust,
+			defaultIfEmpty(strings.Join(buildArch, ","), "host"),
 			defaultIfEmpty(buildTimeout, "default"),
 			defaultIfEmpty(formatKeyValuePairs(extraArgs), "none"),
 		)
 	}
 
+	buildPlan += "\n\n" + estimateSummary(rootDir, currentOptions())
+
 	fmt.Println(ui.InfoBox.Render(buildPlan))
 
+	builder := build.NewBuilder(cfg, rootDir, logger)
+	if builder.WorkingTreeDirty(ctx) {
+		fmt.Println(ui.WarningBox.Render(dirtyTreeNotice(buildDirtyPolicy)))
+	}
+
 	fmt.Println(ui.WizardStep.Render("▶ Building OCI Container..."))
 
-	builder := build.NewBuilder(cfg, rootDir, logger)
 	if buildUseJust {
 		opts := build.BuildOptions{Variant: buildVariant, Tag: buildTag}
 		if err := builder.BuildViaJust(ctx, opts); err != nil {
@@ -377,12 +645,24 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 		Push:           buildPush,
 		Sign:           buildSign,
 		SBOM:           buildSBOM,
+		SBOMTool:       buildSBOMTool,
 		BuildNumber:    buildNumber,
 		NoCache:        buildNoCache,
 		Rechunk:        buildRechunk,
 		DryRun:         buildDryRun,
+		Healthcheck:    buildHealthcheck,
+		Test:           buildTest,
+		DirtyPolicy:    buildDirtyPolicy,
 		Timeout:        build.DefaultBuildOptions().Timeout,
 		ExtraBuildArgs: extraArgs,
+		Arch:           buildArch,
+		Reproducible:   buildReproducible,
+		CacheFrom:      buildCacheFrom,
+		CacheTo:        buildCacheTo,
+		Secrets:        buildSecrets,
+		Resume:         buildResume,
+		Provenance:     buildProvenance,
+		Progress:       buildProgress(),
 	}
 	if buildTimeout != "" {
 		parsed, err := time.ParseDuration(buildTimeout)
@@ -392,8 +672,13 @@ func interactiveContainerBuild(ctx context.Context, rootDir string) error {
 		opts.Timeout = parsed
 	}
 
+	started := time.Now()
 	manifest, err := builder.Build(ctx, opts)
+	notifyBuild(ctx, manifest, opts, started, err)
 	if err != nil {
+		if manifest != nil {
+			saveFailureManifest(rootDir, manifest)
+		}
 		return err
 	}
 
@@ -410,6 +695,7 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 	outputDir := ""
 	usePrivileged := true
 	pullNewer := true
+	useLibrepo := true
 	timeoutInput := ""
 
 	typeOptions := make([]huh.Option[string], 0)
@@ -424,6 +710,12 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 			label = "ISO Installer (Anaconda)"
 		case "raw":
 			label = "Raw Disk Image"
+		case "gce":
+			label = "Google Compute Engine (tar.gz)"
+		case "azure":
+			label = "Microsoft Azure (fixed VHD)"
+		case "oci-cloud":
+			label = "Oracle Cloud Infrastructure (QCOW2)"
 		}
 		typeOptions = append(typeOptions, huh.NewOption(label, t))
 	}
@@ -473,6 +765,10 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 				Title("Pull Newer").
 				Description("Always pull a newer bootc-image-builder image").
 				Value(&pullNewer),
+			huh.NewConfirm().
+				Title("Use librepo").
+				Description("Download packages with librepo").
+				Value(&useLibrepo),
 			huh.NewInput().
 				Title("Timeout").
 				Description("Duration (e.g. 45m, 2h)").
@@ -499,6 +795,17 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 		return err
 	}
 
+	if configFile == "" {
+		generated, err := promptGenerateDiskConfig(rootDir, outputType)
+		if err != nil {
+			if errors.Is(err, huh.ErrUserAborted) {
+				return nil
+			}
+			return err
+		}
+		configFile = generated
+	}
+
 	imageRef := diskImage
 	if imageRef == "" {
 		imageRef = cfg.ImageRef("main", "latest")
@@ -511,7 +818,7 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 	)
 	if advancedMode {
 		buildPlan = fmt.Sprintf(
-			"Build Plan\n\nOutput: %s\nSource Image: %s\nRootFS: %s\nConfig: %s\nOutput Dir: %s\nPrivileged: %t\nPull Newer: %t\nTimeout: %s",
+			"Build Plan\n\nOutput: %s\nSource Image: %s\nRootFS: %s\nConfig: %s\nOutput Dir: %s\nPrivileged: %t\nPull Newer: %t\nLibrepo: %t\nTimeout: %s",
 			outputType,
 			imageRef,
 			rootfsType,
@@ -519,24 +826,30 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 			defaultIfEmpty(outputDir, "./output"),
 			usePrivileged,
 			pullNewer,
+			useLibrepo,
 			defaultIfEmpty(timeoutInput, "default"),
 		)
 	}
 
+	if size, ok := build.EstimateBuild(rootDir, build.BuildOptions{}).DiskSizes[build.DiskKindForOutput(outputType)]; ok {
+		buildPlan += "\nEstimated size: ~" + formatBytes(size) + " (last build)"
+	}
+
 	fmt.Println(ui.InfoBox.Render(buildPlan))
 
 	fmt.Println(ui.WizardStep.Render("▶ Converting to " + outputType + "..."))
 
-	diskBuilder := build.NewDiskBuilder(cfg, rootDir, logger)
+	diskBuilder := build.NewDiskBuilder(cfg, rootDir, logger).WithRootfulPodman()
 	opts := build.DefaultDiskOptions()
 	opts.ImageRef = imageRef
 	opts.OutputType = outputType
+	opts.ConfigFile = configFile
 	if advancedMode {
 		opts.OutputDir = outputDir
-		opts.ConfigFile = configFile
 		opts.RootFSType = rootfsType
 		opts.Privileged = usePrivileged
 		opts.PullNewer = pullNewer
+		opts.UseLibrepo = useLibrepo
 		if timeoutInput != "" {
 			parsed, err := time.ParseDuration(timeoutInput)
 			if err != nil {
@@ -550,9 +863,16 @@ func interactiveDiskBuild(ctx context.Context, rootDir string) error {
 	if err != nil {
 		return err
 	}
+	checksums, err := checksumDisk(ctx, rootDir, outputType, outputPath, opts.OutputDir)
+	if err != nil {
+		return err
+	}
 
 	fmt.Println(ui.SuccessStyle.Render("\n✔ Disk Build Complete"))
 	fmt.Println(ui.MutedStyle.Render("Output: " + outputPath))
+	if checksums != nil {
+		fmt.Println(ui.MutedStyle.Render("Checksums: " + checksums.SHA256Sums))
+	}
 	return nil
 }
 
@@ -585,12 +905,22 @@ func applyBuildDefaults(cmd *cobra.Command) {
 	if !cmd.Flags().Changed("rechunk") {
 		buildRechunk = defaults.Rechunk
 	}
+	buildDryRun = dryRun
 	if !cmd.Flags().Changed("dry-run") {
 		buildDryRun = defaults.DryRun
 	}
 	if !cmd.Flags().Changed("just") {
 		buildUseJust = defaults.UseJust
 	}
+	if !cmd.Flags().Changed("healthcheck") {
+		buildHealthcheck = cfg.Build.Healthcheck.Enabled
+	}
+	if !cmd.Flags().Changed("test") {
+		buildTest = cfg.Build.Tests.Enabled
+	}
+	if !cmd.Flags().Changed("dirty-policy") {
+		buildDirtyPolicy = cfg.Build.DirtyPolicy
+	}
 }
 
 func applyBuildTimeout(cmd *cobra.Command) error {
@@ -603,6 +933,106 @@ func applyBuildTimeout(cmd *cobra.Command) error {
 	return nil
 }
 
+// acquireBuildLock takes the build lock of the project, logging once when
+// it waits for another build
+func acquireBuildLock(ctx context.Context, rootDir, command string, wait bool) (*build.BuildLock, error) {
+	return build.AcquireBuildLock(ctx, rootDir, command, wait, func(holder build.LockInfo) {
+		logger.Info("waiting for another build to finish", "command", holder.Command, "pid", holder.PID, "host", holder.Host)
+	})
+}
+
+func releaseBuildLock(lock *build.BuildLock) {
+	if err := lock.Release(); err != nil {
+		logger.Warn("could not release the build lock", "error", err)
+	}
+}
+
+func applyBuildCache() {
+	if cfg == nil {
+		return
+	}
+	buildCacheFrom, buildCacheTo = build.CacheSources(cfg.Build.Cache, buildCacheFrom, buildCacheTo)
+}
+
+// validateDirtyPolicy rejects a --dirty-policy galena does not know, which
+// would otherwise build as warn
+func validateDirtyPolicy(policy string) error {
+	if policy == "" || slices.Contains(config.DirtyPolicies(), policy) {
+		return nil
+	}
+	return fmt.Errorf("--dirty-policy must be one of %s, not %q", strings.Join(config.DirtyPolicies(), ", "), policy)
+}
+
+func dirtyTreeNotice(policy string) string {
+	policy = defaultIfEmpty(policy, config.DirtyPolicyWarn)
+	notice := "Working tree has uncommitted changes\n\nDirty Policy: " + policy
+	switch policy {
+	case config.DirtyPolicyBlockPush:
+		notice += "\nPushing this build will be refused."
+	case config.DirtyPolicySuffix:
+		notice += "\nThe image tag will carry a -dirty suffix and cannot be promoted."
+	default:
+		notice += "\nThe image will be labeled io.galena.git.dirty=true."
+	}
+	return notice
+}
+
+// estimateSummary describes the expected cost of a build based on earlier runs
+func estimateSummary(rootDir string, opts build.BuildOptions) string {
+	est := build.EstimateBuild(rootDir, opts)
+	if !est.HasData() {
+		return "No earlier builds to estimate from yet."
+	}
+
+	lines := []string{}
+	switch {
+	case opts.DryRun:
+		lines = append(lines, "Duration: none (dry run)")
+	case est.Duration > 0:
+		duration := "~" + est.Duration.Round(time.Minute).String()
+		if est.Duration < time.Minute {
+			duration = "~" + est.Duration.Round(time.Second).String()
+		}
+		if len(est.Unknown) > 0 {
+			duration += " + " + strings.Join(est.Unknown, ", ") + " (no history)"
+		}
+		lines = append(lines, "Duration: "+duration)
+	default:
+		lines = append(lines, "Duration: unknown")
+	}
+	if est.ImageSize > 0 {
+		lines = append(lines, "Image size: ~"+formatBytes(est.ImageSize))
+	}
+	if est.PushSize > 0 {
+		lines = append(lines, "Push upload: ~"+formatBytes(est.PushSize))
+	}
+	kinds := make([]string, 0, len(est.DiskSizes))
+	for kind := range est.DiskSizes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		lines = append(lines, fmt.Sprintf("Disk (%s, last): %s", kind, formatBytes(est.DiskSizes[kind])))
+	}
+	if est.Samples > 0 {
+		lines = append(lines, fmt.Sprintf("Based on %d earlier build(s)", est.Samples))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func defaultIfEmpty(value string, fallback string) string {
 	if strings.TrimSpace(value) == "" {
 		return fallback
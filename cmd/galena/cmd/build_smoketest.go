@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	testVariant string
+	testTag     string
+)
+
+var buildTestCmd = &cobra.Command{
+	Use:   "test [image]",
+	Short: "Run smoke tests inside a built image",
+	Long: `Run the checks configured in build.tests inside a throwaway container of
+a built image and report pass/fail per check.
+
+A check runs a shell command, a script from the project, an rpm -q check
+for installed packages, or a systemctl is-enabled check for units. The
+command fails when any check fails. Use build --test to run the same
+checks as part of every build.
+
+Examples:
+  # Test the locally built main image
+  galena-build build test
+
+  # Test a variant
+  galena-build build test --variant nvidia --tag stable
+
+  # Test any image
+  galena-build build test ghcr.io/acme/galena:stable`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runBuildTest,
+}
+
+func init() {
+	buildCmd.AddCommand(buildTestCmd)
+
+	buildTestCmd.Flags().StringVarP(&testVariant, "variant", "V", "main", "Image variant to test")
+	buildTestCmd.Flags().StringVarP(&testTag, "tag", "t", "latest", "Image tag to test")
+}
+
+func runBuildTest(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "build test"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	imageRef := cfg.ImageRef(testVariant, testTag)
+	if len(args) > 0 {
+		imageRef = args[0]
+	}
+
+	checks := cfg.Build.Tests.Checks
+	if len(checks) == 0 {
+		return output.EmitSummary("build test", nil, fmt.Errorf("no smoke tests configured in build.tests.checks"))
+	}
+
+	builder := build.NewBuilder(cfg, rootDir, logger)
+	results, err := builder.SmokeTest(ctx, imageRef, checks)
+	if output.IsJSON() {
+		return output.EmitSummary("build test", map[string]any{"image": imageRef, "tests": results}, err)
+	}
+
+	passed := printTestResults(results)
+	summary := fmt.Sprintf("%d of %d smoke tests passed\n\nImage: %s", passed, len(results), imageRef)
+	if err != nil {
+		fmt.Println(ui.ErrorBox.Render(summary))
+		return err
+	}
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
+
+// printTestResults prints a pass/fail line per test with the output of
+// failed tests and returns the number that passed
+func printTestResults(results []build.TestResult) int {
+	fmt.Println()
+	lines := []string{}
+	passed := 0
+	for _, r := range results {
+		status := ui.SuccessStyle.Render("✓")
+		if r.Passed {
+			passed++
+		} else {
+			status = ui.ErrorStyle.Render("✗")
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", status, r.Name, ui.MutedStyle.Render(r.Duration.Round(time.Millisecond).String())))
+		if !r.Passed && r.Output != "" {
+			for _, line := range strings.Split(r.Output, "\n") {
+				lines = append(lines, "    "+ui.MutedStyle.Render(line))
+			}
+		}
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+	fmt.Println()
+	return passed
+}
@@ -1,36 +1,55 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/build"
 	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/config"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
 	"github.com/iiroan/galena/internal/version"
 )
 
 var (
 	ciDefaultTag    string
+	ciVariant       string
+	ciNoCache       bool
+	ciBuildArgs     []string
 	ciPush          bool
 	ciSign          bool
 	ciSBOM          bool
+	ciSBOMTool      string
+	ciPublishSBOM   bool
 	ciSkipLint      bool
 	ciImageDesc     string
 	ciImageKeywords string
 	ciImageLogoURL  string
+	ciCacheFrom     []string
+	ciCacheTo       string
+	ciSecrets       []string
+	ciProvenance    bool
+	ciScan          bool
+	ciScanFailOn    string
+	ciPRComment     bool
+	ciWait          bool
 )
 
 var ciCmd = &cobra.Command{
 	Use:   "ci",
 	Short: "CI/CD pipeline commands",
-	Long: `Commands optimized for CI/CD pipelines (GitHub Actions, etc.).
+	Long: `Commands optimized for CI/CD pipelines (GitHub Actions, GitLab CI,
+and Forgejo/Gitea Actions).
 
 These commands automatically detect the CI environment and configure
 themselves appropriately for automated builds.`,
@@ -42,13 +61,23 @@ var ciBuildCmd = &cobra.Command{
 	Long: `Build a container image optimized for CI/CD.
 
 This command:
-  - Detects GitHub Actions environment
-  - Generates appropriate tags based on branch/PR
-  - Sets GitHub Actions outputs for downstream steps
+  - Detects GitHub Actions, GitLab CI, or Forgejo/Gitea Actions
+  - Builds every variant in galena.yaml, or those given with --variant, with
+    the build args of build.build_args, the variant, and --build-arg
+  - Takes --default-tag, --push, --sign, --sbom, and --no-cache from
+    build.defaults when they are not given
+  - Generates appropriate tags based on branch/PR (mr-<iid> on GitLab)
+  - Sets step outputs for downstream steps; on GitLab CI they go to the
+    galena.env dotenv report as GALENA_<NAME> variables
   - Handles push/sign based on branch
+  - With --pr-comment, keeps a comment on the pull request with the build
+    summary, pull commands, and package and vulnerability changes against
+    the --default-tag image
 
 Environment variables:
-  IMAGE_REGISTRY  - Override registry (default: ghcr.io/<owner>)
+  IMAGE_REGISTRY  - Override registry (default: ghcr.io/<owner>, the GitLab
+                    project registry, or the Forgejo instance registry)
+  GALENA_DOTENV   - Dotenv report path on GitLab CI (default: galena.env)
   IMAGE_NAME      - Override image name (default: repo name)
   IMAGE_DESC      - Image description for labels
 
@@ -59,8 +88,20 @@ Examples:
   # Build and push (if on default branch)
   galena-build ci build --push
 
+  # Build only the nvidia variant, pushed as <image>-nvidia
+  galena-build ci build --variant nvidia --sign --sbom
+
   # Build with signing and SBOM
-  galena-build ci build --push --sign --sbom`,
+  galena-build ci build --push --sign --sbom
+
+  # Block the push when high or critical vulnerabilities are found
+  galena-build ci build --push --scan --scan-fail-on HIGH
+
+  # Report the build on its pull request (env: GITHUB_TOKEN)
+  galena-build ci build --sbom --scan --pr-comment
+
+  # Reuse layers cached in GHCR by earlier runs
+  galena-build ci build --cache-from ghcr.io/acme/galena-cache --cache-to ghcr.io/acme/galena-cache`,
 	RunE: runCIBuild,
 }
 
@@ -85,21 +126,37 @@ func init() {
 	ciCmd.AddCommand(ciBuildCmd)
 	ciCmd.AddCommand(ciSetupCmd)
 	ciCmd.AddCommand(ciInfoCmd)
+	ciCmd.AddCommand(ciInitCmd)
 
 	ciBuildCmd.Flags().StringVar(&ciDefaultTag, "default-tag", "stable", "Default tag for releases")
+	ciBuildCmd.Flags().StringVar(&ciVariant, "variant", "", "Variants to build, comma-separated (default: every variant in galena.yaml)")
+	ciBuildCmd.Flags().BoolVar(&ciNoCache, "no-cache", false, "Build without cache")
+	ciBuildCmd.Flags().StringArrayVar(&ciBuildArgs, "build-arg", nil, "Additional build arg (KEY=VALUE)")
 	ciBuildCmd.Flags().BoolVar(&ciPush, "push", false, "Push image to registry")
 	ciBuildCmd.Flags().BoolVar(&ciSign, "sign", false, "Sign image with cosign")
 	ciBuildCmd.Flags().BoolVar(&ciSBOM, "sbom", false, "Generate SBOM")
+	ciBuildCmd.Flags().StringVar(&ciSBOMTool, "sbom-tool", build.SBOMToolAuto, "SBOM tool (auto, trivy, syft)")
+	ciBuildCmd.Flags().BoolVar(&ciPublishSBOM, "publish-sbom", false, "Upload a CycloneDX SBOM to Dependency-Track (see sbom.dependency_track)")
 	ciBuildCmd.Flags().BoolVar(&ciSkipLint, "skip-lint", false, "Skip bootc lint")
 	ciBuildCmd.Flags().StringVar(&ciImageDesc, "description", "", "Image description")
 	ciBuildCmd.Flags().StringVar(&ciImageKeywords, "keywords", "", "Image keywords (default: bootc,ublue,universal-blue)")
 	ciBuildCmd.Flags().StringVar(&ciImageLogoURL, "logo-url", "", "Image logo URL for ArtifactHub")
+	ciBuildCmd.Flags().StringSliceVar(&ciCacheFrom, "cache-from", nil, "Registry repositories to reuse cached layers from (default: build.cache.from)")
+	ciBuildCmd.Flags().StringArrayVar(&ciSecrets, "secret", nil, "Build secret (id=NAME,src=FILE or id=NAME,env=VAR); adds to build.secrets")
+	ciBuildCmd.Flags().BoolVar(&ciProvenance, "provenance", false, "Generate SLSA provenance and attest it to the pushed image")
+	ciBuildCmd.Flags().BoolVar(&ciScan, "scan", false, "Scan the image for vulnerabilities before pushing")
+	ciBuildCmd.Flags().StringVar(&ciScanFailOn, "scan-fail-on", "", "Lowest severity that fails the scan (default: scan.fail_on)")
+	ciBuildCmd.Flags().BoolVar(&ciWait, "wait", false, "Wait for another build of the project to finish instead of failing")
+	ciBuildCmd.Flags().BoolVar(&ciPRComment, "pr-comment", false, "Post or update a pull request comment with the build summary (GitHub, needs GITHUB_TOKEN)")
+	ciBuildCmd.Flags().StringVar(&ciCacheTo, "cache-to", "", "Registry repository to push cached layers to (default: build.cache.to)")
 }
 
-func runCIBuild(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+func runCIBuild(cmd *cobra.Command, args []string) (err error) {
+	ctx, stop := interruptibleContext()
+	defer stop()
+	started := time.Now()
 	env := ci.Detect()
-	if err := platform.RequireLinux("ci build"); err != nil {
+	if err := platform.Require(platform.ImageBuilds, "ci build"); err != nil {
 		return err
 	}
 
@@ -107,22 +164,65 @@ func runCIBuild(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("finding project root: %w", err)
 	}
+	applyCIBuildDefaults(cmd)
+	lock, err := acquireBuildLock(ctx, rootDir, cmd.CommandPath(), ciWait)
+	if err != nil {
+		return err
+	}
+	defer releaseBuildLock(lock)
+	session := startSession(rootDir, "ci-build")
+	defer func() { endSession(session, err) }()
+
+	// Every configured variant unless --variant narrows it down
+	variants := build.ParseVariants(ciVariant)
+	if len(variants) == 0 {
+		variants = cfg.ListVariantNames()
+	}
+	if len(variants) == 0 {
+		variants = []string{"main"}
+	}
+	if len(cfg.Variants) > 0 {
+		for _, variant := range variants {
+			if _, err := cfg.GetVariant(variant); err != nil {
+				return err
+			}
+		}
+	}
+	extraArgs, err := parseKeyValuePairs(ciBuildArgs)
+	if err != nil {
+		return err
+	}
 
 	ci.StartGroup("Environment Detection")
 	logger.Info("CI environment detected",
-		"github_actions", env.IsGitHubActions,
+		"provider", defaultIfEmpty(env.Provider, "none"),
 		"repository", env.Repository,
 		"ref", env.RefName,
 		"is_pr", env.IsPullRequest,
 		"is_default_branch", env.IsDefaultBranch,
+		"variants", strings.Join(variants, ", "),
 	)
 	ci.EndGroup()
 
+	engine, err := containerEngine()
+	if err != nil {
+		return err
+	}
+	if err := exec.RequireCommands(engine.Name()); err != nil {
+		return err
+	}
+
 	if ciSign && !exec.CheckCommand("cosign") {
 		return fmt.Errorf("cosign is required for --sign (install with: go install github.com/sigstore/cosign/v2/cmd/cosign@latest)")
 	}
-	if ciSBOM && !exec.CheckCommand("trivy") && !exec.CheckCommand("podman") {
-		return fmt.Errorf("trivy or podman is required for --sbom")
+	var sbomProvider build.SBOMProvider
+	if ciSBOM || ciPublishSBOM {
+		if sbomProvider, err = build.NewSBOMProvider(ciSBOMTool, rootDir); err != nil {
+			return fmt.Errorf("SBOM tool: %w", err)
+		}
+	}
+	if ciScan && !exec.CheckCommand("trivy") && !exec.CheckCommand("podman") {
+		return fmt.Errorf("trivy or podman is required for --scan")
 	}
 
 	// Generate tags
@@ -130,17 +230,49 @@ func runCIBuild(cmd *cobra.Command, args []string) error {
 	if len(tags) == 0 {
 		tags = []string{ciDefaultTag}
 	}
-	primaryTag := tags[0]
 
-	imageName := env.ImageName()
-	registry := env.ImageRegistry()
-	fullImageRef := fmt.Sprintf("%s/%s:%s", registry, imageName, primaryTag)
+	// Determine if we should push
+	shouldPush := ciPush
+	if !shouldPush && env.ShouldPush() {
+		logger.Info("auto-enabling push for default branch")
+		shouldPush = true
+	}
 
-	logger.Info("image configuration",
-		"name", imageName,
-		"registry", registry,
-		"tags", strings.Join(tags, ", "),
-	)
+	// Don't push PRs unless explicitly requested
+	if env.IsPullRequest && !ciPush {
+		shouldPush = false
+		logger.Info("skipping push for pull request")
+	}
+
+	// Apply the dirty working tree policy before anything is built or pushed
+	gitDirty := false
+	if statusResult := exec.Git(ctx, rootDir, build.GitStatusArgs()...); statusResult.Err == nil {
+		gitDirty = build.TreeDirty(statusResult.Stdout)
+	}
+	if gitDirty {
+		policy := cfg.Build.DirtyPolicy
+		ci.LogWarning(fmt.Sprintf("Building from a dirty working tree (dirty_policy: %s)", policy))
+		for i, tag := range tags {
+			dirtyTag, err := build.ApplyDirtyPolicy(policy, tag, shouldPush)
+			if err != nil {
+				ci.LogError(err.Error(), "", 0)
+				return err
+			}
+			tags[i] = dirtyTag
+		}
+	}
+
+	// Version the build from the run number, or build.defaults outside CI
+	buildNumber := env.RunNumber
+	if buildNumber == 0 {
+		buildNumber = cfg.Build.Defaults.BuildNumber
+	}
+	commit := env.SHA
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	versionInfo := version.NewInfo(cfg.Build.FedoraVersion, buildNumber).WithGit(commit, env.RefName, gitDirty)
+	versionStr := versionInfo.Version
 
 	// Generate labels
 	labelCfg := ci.LabelConfig{
@@ -160,147 +292,381 @@ func runCIBuild(cmd *cobra.Command, args []string) error {
 		labelCfg.LogoURL = os.Getenv("IMAGE_LOGO_URL")
 	}
 
-	labels := env.GenerateLabels(imageName, labelCfg)
+	run := &ciBuildRun{
+		env:          env,
+		engine:       engine,
+		builder:      build.NewBuilder(cfg, rootDir, logger),
+		rootDir:      rootDir,
+		registry:     env.ImageRegistry(),
+		tags:         tags,
+		version:      versionInfo,
+		labelConfig:  labelCfg,
+		extraArgs:    extraArgs,
+		shouldPush:   shouldPush,
+		sbomProvider: sbomProvider,
+		started:      started,
+	}
 
-	// Add version label
-	versionStr := version.Compute(cfg.Build.FedoraVersion, env.RunNumber)
-	labels["org.opencontainers.image.version"] = versionStr
+	manifest := version.NewBuildManifest(env.ImageName(), versionInfo)
+	var results []*ciVariantResult
+	for _, variant := range variants {
+		result, err := run.buildVariant(ctx, variant)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
 
-	// Build the image
-	ci.StartGroup("Building Image")
+		manifest.AddImage(result.imageName, tags[0], result.digest, variant, 0)
+		for _, p := range result.pushes {
+			manifest.SetPush(p)
+		}
+		for _, artifact := range result.artifacts {
+			manifest.AddArtifact(artifact)
+		}
+	}
+
+	// Set outputs for downstream steps; the first variant fills the plain
+	// outputs and every variant of a multi-variant build gets its own
+	first := results[0]
+	setCIOutput("image", first.imageRef)
+	setCIOutput("tags", strings.Join(tags, " "))
+	setCIOutput("digest", first.digest)
+	setCIOutput("version", versionStr)
+	setCIOutput("registry", run.registry)
+	setCIOutput("image_name", first.imageName)
+	for name, value := range first.outputs {
+		setCIOutput(name, value)
+	}
+	if len(results) > 1 {
+		setCIOutput("variants", strings.Join(variants, " "))
+		for _, r := range results {
+			setCIOutput("image_"+r.variant, r.imageRef)
+			setCIOutput("digest_"+r.variant, r.digest)
+		}
+	}
+
+	manifest.Version = manifest.Version.WithImage(first.imageRef, first.variant, tags[0])
+	manifestPath := filepath.Join(rootDir, "build-manifest.json")
+	if err := manifest.Save(manifestPath); err != nil {
+		logger.Warn("could not save manifest", "error", err)
+	} else {
+		setCIOutput("manifest", manifestPath)
+	}
+
+	// Add job summary
+	var images strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&images, "| Image | `%s` |\n| Digest | `%s` |\n", r.imageRef, r.digest)
+	}
+	summary := fmt.Sprintf("## Build Summary\n\n"+
+		"| Property | Value |\n"+
+		"|----------|-------|\n"+
+		"%s"+
+		"| Tags | %s |\n"+
+		"| Version | `%s` |\n"+
+		"| Dirty | %v |\n"+
+		"| Pushed | %v |\n"+
+		"| Signed | %v |\n\n"+
+		"Built with [galena](https://github.com/iiroan/galena) at %s\n",
+		images.String(),
+		strings.Join(tags, ", "),
+		versionStr,
+		gitDirty,
+		shouldPush,
+		ciSign && shouldPush,
+		time.Now().Format(time.RFC3339),
+	)
+	addCISummary(summary)
+
+	if ciPRComment {
+		postCIComment(ctx, run, results)
+	}
+
+	logger.Info("CI build completed successfully",
+		"variants", strings.Join(variants, ", "),
+		"version", versionStr,
+		"pushed", shouldPush,
+	)
+
+	return nil
+}
+
+// applyCIBuildDefaults fills the ci build flags that were not given from
+// build.defaults, like the local build path. The variant default is not
+// used: ci build covers every variant unless --variant is given.
+func applyCIBuildDefaults(cmd *cobra.Command) {
+	if cfg == nil {
+		return
+	}
+	defaults := cfg.Build.Defaults
+	if !cmd.Flags().Changed("default-tag") && defaults.Tag != "" {
+		ciDefaultTag = defaults.Tag
+	}
+	if !cmd.Flags().Changed("push") {
+		ciPush = defaults.Push
+	}
+	if !cmd.Flags().Changed("sign") {
+		ciSign = defaults.Sign
+	}
+	if !cmd.Flags().Changed("sbom") {
+		ciSBOM = defaults.SBOM
+	}
+	if !cmd.Flags().Changed("no-cache") {
+		ciNoCache = defaults.NoCache
+	}
+}
+
+// ciBuildRun is the state shared by the variants of a ci build
+type ciBuildRun struct {
+	env          *ci.Environment
+	engine       exec.Engine
+	builder      *build.Builder
+	rootDir      string
+	registry     string
+	tags         []string
+	version      version.Info
+	labelConfig  ci.LabelConfig
+	extraArgs    map[string]string
+	shouldPush   bool
+	sbomProvider build.SBOMProvider
+	started      time.Time
+}
+
+// ciVariantResult is the outcome of building one variant in ci build
+type ciVariantResult struct {
+	variant   string
+	imageName string
+	imageRef  string // Image with the primary tag
+	digest    string
+	pushes    []version.Push
+	artifacts []string
+	outputs   map[string]string // Step outputs of artifacts such as the SBOM
+}
+
+// variantFile names a per-variant file in the project root; main keeps the
+// plain name
+func (r *ciBuildRun) variantFile(name, variant string) string {
+	if variant != "main" {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "-" + variant + ext
+	}
+	return filepath.Join(r.rootDir, name)
+}
+
+// variantLocation returns the registry (with its namespace) and image name
+// a variant is published under. The CI registry and image name apply unless
+// the variant overrides them in galena.yaml.
+func (r *ciBuildRun) variantLocation(variant string) (registry, imageName string) {
+	registry, imageName = r.registry, r.env.ImageName()
+	if variant != "main" {
+		imageName += "-" + variant
+	}
+	if cfg == nil {
+		return registry, imageName
+	}
+	v, err := cfg.GetVariant(variant)
+	if err != nil {
+		return registry, imageName
+	}
+	host, namespace, _ := strings.Cut(registry, "/")
+	host, namespace = cmp.Or(v.Registry, host), cmp.Or(v.Repository, namespace)
+	registry = host
+	if namespace != "" {
+		registry += "/" + namespace
+	}
+	return registry, cmp.Or(v.Image, imageName)
+}
+
+// buildVariant builds, checks, pushes, and signs the image of one variant.
+// Variants other than main are published as <image>-<variant>, unless
+// the variant sets its own registry, repository, or image name.
+func (r *ciBuildRun) buildVariant(ctx context.Context, variant string) (*ciVariantResult, error) {
+	registry, imageName := r.variantLocation(variant)
+	primaryTag := r.tags[0]
+	fullImageRef := fmt.Sprintf("%s/%s:%s", registry, imageName, primaryTag)
+	localImageRef := fmt.Sprintf("%s:%s", imageName, primaryTag)
+	result := &ciVariantResult{variant: variant, imageName: imageName, imageRef: fullImageRef, outputs: map[string]string{}}
 
-	buildArgs := []string{}
-	for k, v := range labels {
-		buildArgs = append(buildArgs, "--label", fmt.Sprintf("%s=%s", k, v))
+	logger.Info("image configuration",
+		"variant", variant,
+		"name", imageName,
+		"registry", registry,
+		"tags", strings.Join(r.tags, ", "),
+	)
+
+	labels := r.env.GenerateLabels(imageName, r.labelConfig)
+	labels["org.opencontainers.image.version"] = r.version.Version
+
+	// Build the image
+	ci.StartGroup("Building " + variant)
+
+	cacheFrom, cacheTo := build.CacheSources(cfg.Build.Cache, ciCacheFrom, ciCacheTo)
+	buildArgs := r.builder.BuildArgs(build.BuildOptions{
+		Variant:        variant,
+		NoCache:        ciNoCache,
+		ExtraBuildArgs: r.extraArgs,
+		CacheFrom:      cacheFrom,
+		CacheTo:        cacheTo,
+	}, r.version.WithImage(fullImageRef, variant, primaryTag))
+
+	// CI labels come last so they win over the version labels
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buildArgs = append(buildArgs, "--label", fmt.Sprintf("%s=%s", k, labels[k]))
 	}
 
 	// Add all tags
-	for _, tag := range tags {
+	for _, tag := range r.tags {
 		buildArgs = append(buildArgs, "-t", fmt.Sprintf("%s/%s:%s", registry, imageName, tag))
 	}
 
 	// Also tag locally without registry for lint
-	buildArgs = append(buildArgs, "-t", fmt.Sprintf("%s:%s", imageName, primaryTag))
+	buildArgs = append(buildArgs, "-t", localImageRef)
+
+	secretArgs, err := build.SecretArgs(r.rootDir, cfg.Build.Secrets, ciSecrets)
+	if err != nil {
+		ci.LogError(err.Error(), "", 0)
+		return nil, err
+	}
+	buildArgs = append(buildArgs, secretArgs...)
 
+	containerfile, err := r.builder.Containerfile(variant, primaryTag)
+	if err != nil {
+		ci.LogError(err.Error(), "", 0)
+		return nil, err
+	}
 	buildArgs = append(buildArgs,
-		"-f", filepath.Join(rootDir, "Containerfile"),
-		rootDir,
+		"-f", containerfile,
+		r.rootDir,
 	)
 
-	logger.Info("running podman build")
-	result := exec.PodmanBuild(ctx, rootDir, buildArgs)
-	if result.Err != nil {
-		ci.LogError(fmt.Sprintf("Build failed: %v", result.Err), "", 0)
-		return fmt.Errorf("build failed: %w", result.Err)
+	logger.Info("running image build", "engine", r.engine.Name(), "variant", variant)
+	buildResult := r.engine.Build(ctx, r.rootDir, buildArgs)
+	if buildResult.Err != nil {
+		ci.LogError(fmt.Sprintf("Build of %s failed: %v", variant, buildResult.Err), "", 0)
+		return nil, fmt.Errorf("build of %s failed: %w", variant, buildResult.Err)
 	}
 	ci.EndGroup()
 
 	// Run bootc lint
 	if !ciSkipLint {
 		ci.StartGroup("Running bootc lint")
-		lintResult := exec.Podman(ctx, "run", "--rm", fmt.Sprintf("%s:%s", imageName, primaryTag), "bootc", "container", "lint")
+		lintResult := r.engine.RunImage(ctx, localImageRef, "bootc", "container", "lint")
 		if lintResult.Err != nil {
-			ci.LogError("bootc lint failed", "", 0)
-			return fmt.Errorf("bootc lint failed: %w", lintResult.Err)
+			ci.LogError("bootc lint failed for "+variant, "", 0)
+			return nil, fmt.Errorf("bootc lint failed for %s: %w", variant, lintResult.Err)
 		}
-		logger.Info("bootc lint passed")
+		logger.Info("bootc lint passed", "variant", variant)
 		ci.EndGroup()
 	}
 
 	// Get image digest
-	digestResult := exec.Podman(ctx, "inspect", "--format", "{{.Digest}}", fmt.Sprintf("%s:%s", imageName, primaryTag))
-	digest := strings.TrimSpace(digestResult.Stdout)
+	result.digest, _ = r.engine.ImageDigest(ctx, localImageRef)
 
-	// Set outputs for GitHub Actions
-	setCIOutput("image", fullImageRef)
-	setCIOutput("tags", strings.Join(tags, " "))
-	setCIOutput("digest", digest)
-	setCIOutput("version", versionStr)
-	setCIOutput("registry", registry)
-	setCIOutput("image_name", imageName)
+	// Scan for vulnerabilities before anything is pushed
+	if ciScan {
+		ci.StartGroup("Scanning Image")
 
-	// Determine if we should push
-	shouldPush := ciPush
-	if !shouldPush && env.ShouldPush() {
-		logger.Info("auto-enabling push for default branch")
-		shouldPush = true
-	}
+		policy := cfg.Scan
+		if ciScanFailOn != "" {
+			policy.FailOn = ciScanFailOn
+		}
+		reportPath := r.variantFile("vulnerabilities.json", variant)
+		report, err := scanImage(ctx, r.rootDir, localImageRef, true, reportPath, policy)
+		if err != nil {
+			ci.LogError(fmt.Sprintf("Vulnerability scan failed: %v", err), "", 0)
+			return nil, fmt.Errorf("vulnerability scan failed: %w", err)
+		}
+		result.outputs["vulnerabilities"] = reportPath
+		result.artifacts = append(result.artifacts, reportPath)
+		for _, sev := range config.Severities() {
+			if n := report.Counts[sev]; n > 0 {
+				logger.Info("vulnerabilities", "severity", sev, "count", n)
+			}
+		}
+		if err := report.Check(policy.FailOn); err != nil {
+			ci.LogError(fmt.Sprintf("Vulnerability policy failed: %v", err), "", 0)
+			return nil, err
+		}
 
-	// Don't push PRs unless explicitly requested
-	if env.IsPullRequest && !ciPush {
-		shouldPush = false
-		logger.Info("skipping push for pull request")
+		ci.EndGroup()
 	}
 
 	// Generate SBOM if requested (always run if flag is set, even if not pushing)
+	sbomPath := filepath.Join(r.rootDir, build.SBOMFileName(build.SBOMFormatSPDX, variant))
 	if ciSBOM {
 		ci.StartGroup("Generating SBOM")
 
-		sbomPath := filepath.Join(rootDir, "sbom.spdx.json")
-		localImageRef := fmt.Sprintf("%s:%s", imageName, primaryTag)
-
-		var err error
-		if exec.CheckCommand("trivy") {
-			if versionResult := exec.Trivy(ctx, "--version"); versionResult.Err == nil {
-				logger.Info("trivy", "version", strings.TrimSpace(versionResult.Stdout))
-			}
-			err = generateSBOMWithTrivy(ctx, localImageRef, sbomPath, true, rootDir)
-		} else {
-			err = generateSBOMWithTrivyContainer(ctx, localImageRef, sbomPath, true, rootDir)
+		if err := generateSBOM(ctx, r.sbomProvider, localImageRef, true, build.SBOMFormatSPDX, sbomPath, r.rootDir); err != nil {
+			ci.LogError(fmt.Sprintf("SBOM generation failed: %v", err), "", 0)
+			return nil, fmt.Errorf("SBOM generation failed: %w", err)
 		}
+		result.outputs["sbom"] = sbomPath
 
-		if err != nil {
-			ci.LogError(fmt.Sprintf("SBOM generation failed: %v", err), "", 0)
-			return fmt.Errorf("SBOM generation failed: %w", err)
-		} else {
-			setCIOutput("sbom", sbomPath)
+		ci.EndGroup()
+	}
+
+	// Keep Dependency-Track current; a failed upload does not fail the build
+	if ciPublishSBOM {
+		ci.StartGroup("Publishing SBOM")
+
+		cdxPath := filepath.Join(r.rootDir, build.SBOMFileName(build.SBOMFormatCycloneDX, variant))
+		if err := generateSBOM(ctx, r.sbomProvider, localImageRef, true, build.SBOMFormatCycloneDX, cdxPath, r.rootDir); err != nil {
+			ci.LogWarning(fmt.Sprintf("CycloneDX SBOM generation failed: %v", err))
+		} else if _, err := publishSBOM(ctx, cdxPath, "", r.version.Version); err != nil {
+			ci.LogWarning(err.Error())
 		}
 
 		ci.EndGroup()
 	}
 
-	if shouldPush {
+	if r.shouldPush {
 		ci.StartGroup("Pushing Image")
 
-		for _, tag := range tags {
+		for _, tag := range r.tags {
 			imageRef := fmt.Sprintf("%s/%s:%s", registry, imageName, tag)
 			logger.Info("pushing", "image", imageRef)
 
-			pushResult := exec.PodmanPush(ctx, imageRef)
-			if pushResult.Err != nil {
-				ci.LogError(fmt.Sprintf("Push failed for %s: %v", imageRef, pushResult.Err), "", 0)
-				return fmt.Errorf("push failed: %w", pushResult.Err)
+			tagPushes, err := r.builder.PushAll(ctx, imageRef, false, cfg.Registries)
+			result.pushes = append(result.pushes, tagPushes...)
+			for _, p := range tagPushes {
+				if p.Status == build.PushStatusFailed {
+					ci.LogError(fmt.Sprintf("Push failed for %s: %s", p.Image, p.Error), "", 0)
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("push failed: %w", err)
 			}
 		}
 
 		ci.EndGroup()
 
 		// Get digest after push
-		digestResult := exec.Podman(ctx, "inspect", "--format", "{{.Digest}}", fullImageRef)
-		digest = strings.TrimSpace(digestResult.Stdout)
-		setCIOutput("digest", digest)
+		result.digest, _ = r.engine.ImageDigest(ctx, fullImageRef)
 
 		// Sign and attest if requested
 		if ciSign && exec.CheckCommand("cosign") {
 			ci.StartGroup("Signing and Attesting")
 
-			for _, tag := range tags {
+			signer := build.NewSigner(r.rootDir, cfg.Signing)
+			for _, tag := range r.tags {
 				imageRef := fmt.Sprintf("%s/%s:%s", registry, imageName, tag)
-				logger.Info("signing", "image", imageRef)
+				logger.Info("signing", "image", imageRef, "keyless", signer.Keyless())
 
-				signResult := exec.Cosign(ctx, "sign", "--yes", imageRef)
-				if signResult.Err != nil {
-					ci.LogWarning(fmt.Sprintf("Signing failed for %s: %v", imageRef, signResult.Err))
+				if err := signer.Sign(ctx, imageRef, nil); err != nil {
+					ci.LogWarning(fmt.Sprintf("Signing failed for %s: %v", imageRef, err))
 				}
 			}
 
 			// Attest SBOM if generated
-			sbomPath := filepath.Join(rootDir, "sbom.spdx.json")
 			if _, err := os.Stat(sbomPath); err == nil {
 				logger.Info("attesting SBOM")
-				attestResult := exec.Cosign(ctx, "attest", "--yes", "--predicate", sbomPath, "--type", "spdxjson", fmt.Sprintf("%s/%s@%s", registry, imageName, digest))
-				if attestResult.Err != nil {
-					ci.LogWarning(fmt.Sprintf("SBOM attestation failed: %v", attestResult.Err))
+				if err := signer.Attest(ctx, fmt.Sprintf("%s/%s@%s", registry, imageName, result.digest), sbomPath, build.SBOMPredicateType(build.SBOMFormatSPDX)); err != nil {
+					ci.LogWarning(fmt.Sprintf("SBOM attestation failed: %v", err))
 				}
 			}
 
@@ -308,55 +674,33 @@ func runCIBuild(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Create build manifest
-	versionInfo := version.NewInfo(cfg.Build.FedoraVersion, env.RunNumber)
-	if env.SHA != "" {
-		short := env.SHA
-		if len(short) > 12 {
-			short = short[:12]
+	if ciProvenance {
+		ci.StartGroup("Generating Provenance")
+
+		provenance := r.builder.NewProvenance(ctx, build.ProvenanceInput{
+			Image:      fullImageRef,
+			Variant:    variant,
+			Tag:        primaryTag,
+			Ref:        r.env.Ref,
+			StartedOn:  r.started,
+			FinishedOn: time.Now(),
+		})
+		provenancePath := r.builder.ProvenancePath(variant)
+		if r.shouldPush {
+			if err := r.builder.AttestProvenance(ctx, fmt.Sprintf("%s/%s@%s", registry, imageName, result.digest), provenancePath, provenance); err != nil {
+				ci.LogError(fmt.Sprintf("Provenance attestation failed: %v", err), "", 0)
+				return nil, fmt.Errorf("provenance attestation failed: %w", err)
+			}
+		} else if err := provenance.Save(provenancePath); err != nil {
+			return nil, err
 		}
-		versionInfo = versionInfo.WithGit(short, env.RefName, false)
-	}
-	versionInfo = versionInfo.WithImage(fullImageRef, "main", primaryTag)
+		result.outputs["provenance"] = provenancePath
+		result.artifacts = append(result.artifacts, provenancePath)
 
-	manifest := version.NewBuildManifest(imageName, versionInfo)
-	manifest.AddImage(imageName, primaryTag, digest, "main", 0)
-
-	manifestPath := filepath.Join(rootDir, "build-manifest.json")
-	if err := manifest.Save(manifestPath); err != nil {
-		logger.Warn("could not save manifest", "error", err)
-	} else {
-		setCIOutput("manifest", manifestPath)
+		ci.EndGroup()
 	}
 
-	// Add job summary
-	summary := fmt.Sprintf("## Build Summary\n\n"+
-		"| Property | Value |\n"+
-		"|----------|-------|\n"+
-		"| Image | `%s` |\n"+
-		"| Tags | %s |\n"+
-		"| Version | `%s` |\n"+
-		"| Digest | `%s` |\n"+
-		"| Pushed | %v |\n"+
-		"| Signed | %v |\n\n"+
-		"Built with [galena](https://github.com/iiroan/galena) at %s\n",
-		fullImageRef,
-		strings.Join(tags, ", "),
-		versionStr,
-		digest,
-		shouldPush,
-		ciSign && shouldPush,
-		time.Now().Format(time.RFC3339),
-	)
-	addCISummary(summary)
-
-	logger.Info("CI build completed successfully",
-		"image", fullImageRef,
-		"version", versionStr,
-		"pushed", shouldPush,
-	)
-
-	return nil
+	return result, nil
 }
 
 func setCIOutput(name, value string) {
@@ -380,14 +724,19 @@ func addCISummary(summary string) {
 func runCISetup(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 	env := ci.Detect()
-	if err := platform.RequireLinux("ci setup"); err != nil {
+	if err := platform.Require(platform.ImageBuilds, "ci setup"); err != nil {
 		return err
 	}
 
 	logger.Info("setting up CI environment")
 
+	engine, err := containerEngine()
+	if err != nil {
+		return err
+	}
+
 	// Check required tools
-	required := []string{"podman"}
+	required := []string{engine.Name()}
 	missing := []string{}
 	for _, tool := range required {
 		if !exec.CheckCommand(tool) {
@@ -402,9 +751,9 @@ func runCISetup(cmd *cobra.Command, args []string) error {
 	// Log tool versions
 	ci.StartGroup("Tool Versions")
 
-	result := exec.Podman(ctx, "--version")
+	result := engine.Command(ctx, "--version")
 	if result.Err == nil {
-		logger.Info("podman", "version", strings.TrimSpace(result.Stdout))
+		logger.Info(engine.Name(), "version", strings.TrimSpace(result.Stdout))
 	}
 
 	if exec.CheckCommand("cosign") {
@@ -424,7 +773,7 @@ func runCISetup(cmd *cobra.Command, args []string) error {
 	ci.EndGroup()
 
 	// Set environment for subsequent steps
-	if env.IsGitHubActions {
+	if env.Provider != "" {
 		setCIEnv("GALENA_CI", "true")
 	}
 
@@ -435,9 +784,9 @@ func runCISetup(cmd *cobra.Command, args []string) error {
 func runCIInfo(cmd *cobra.Command, args []string) error {
 	env := ci.Detect()
 
-	logger.Info("ci environment",
+	fields := []any{
 		"ci", env.IsCI,
-		"github_actions", env.IsGitHubActions,
+		"provider", defaultIfEmpty(env.Provider, "none"),
 		"repository", env.Repository,
 		"repository_owner", env.RepositoryOwner,
 		"repository_name", env.RepositoryName,
@@ -450,14 +799,29 @@ func runCIInfo(cmd *cobra.Command, args []string) error {
 		"default_branch", env.DefaultBranch,
 		"is_default_branch", env.IsDefaultBranch,
 		"is_pull_request", env.IsPullRequest,
+		"pull_request", env.PullRequestNumber,
 		"actor", env.Actor,
-	)
-	logger.Info("ci computed values",
+		"run_url", env.RunURL(),
+	}
+	computed := []any{
 		"image_registry", env.ImageRegistry(),
 		"image_name", env.ImageName(),
 		"should_push", env.ShouldPush(),
-		"tags", strings.Join(env.GenerateTags("stable"), ", "),
-	)
+		"tags", env.GenerateTags("stable"),
+	}
+
+	if output.IsJSON() {
+		// The logged key-value pairs, as one object
+		info := map[string]any{}
+		pairs := append(append([]any{}, fields...), computed...)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			info[pairs[i].(string)] = pairs[i+1]
+		}
+		return output.EmitSummary("ci info", info, nil)
+	}
 
+	computed[len(computed)-1] = strings.Join(env.GenerateTags("stable"), ", ")
+	logger.Info("ci environment", fields...)
+	logger.Info("ci computed values", computed...)
 	return nil
 }
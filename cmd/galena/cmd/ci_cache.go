@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	ciCacheKey         string
+	ciCacheRestoreKeys []string
+	ciCachePath        string
+	ciCacheOnly        []string
+)
+
+// ciCacheNames lists the caches ci cache handles
+var ciCacheNames = []string{"podman", "trivy", "bib"}
+
+var ciCacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Save and restore build caches between CI runs",
+	Long: `Save and restore the caches that make image and disk builds fast:
+
+  podman  - container layer storage (the graph root of podman)
+  trivy   - trivy vulnerability and Java databases
+  bib     - the osbuild store and RPM metadata of bootc-image-builder
+
+The trivy and bib caches live in $XDG_CACHE_HOME/galena (~/.cache/galena),
+outside the checkout, so restoring them does not dirty the working tree.
+
+Caches are stored in the GitHub Actions cache service, or in a directory
+given with --path or GALENA_CACHE_PATH on self-hosted runners. The cache
+service is only reachable from run steps when the workflow exposes its
+runtime variables:
+
+  - uses: crazy-max/ghaction-github-runtime@v3
+  - run: galena-build ci cache restore --key "main-${{ github.sha }}" --restore-key main-
+  - run: galena-build ci build --push
+  - if: always()
+    run: galena-build ci cache save --key "main-${{ github.sha }}"
+
+Every cache is stored under <cache>-<key>. Restore before anything is
+pulled or built, since it writes into the storage of podman. Cache failures
+are reported as warnings and never fail the job.`,
+}
+
+var ciCacheSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "Save build caches under a key",
+	Long: `Archive the build caches and store them under --key. Keys are
+immutable: a key that is already stored is left as is.
+
+Examples:
+  galena-build ci cache save --key "main-${GITHUB_SHA}"
+  galena-build ci cache save --key nightly --only trivy,bib --path /srv/ci-cache`,
+	Args: cobra.NoArgs,
+	RunE: runCICacheSave,
+}
+
+var ciCacheRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore build caches saved under a key",
+	Long: `Restore the build caches saved under --key, falling back to the newest
+entry whose key starts with a --restore-key. Sets the cache_hit output to
+true when every cache matched --key exactly.
+
+Examples:
+  galena-build ci cache restore --key "main-${GITHUB_SHA}" --restore-key main-
+  galena-build ci cache restore --key nightly --path /srv/ci-cache`,
+	Args: cobra.NoArgs,
+	RunE: runCICacheRestore,
+}
+
+func init() {
+	ciCmd.AddCommand(ciCacheCmd)
+	ciCacheCmd.AddCommand(ciCacheSaveCmd)
+	ciCacheCmd.AddCommand(ciCacheRestoreCmd)
+
+	ciCacheCmd.PersistentFlags().StringVar(&ciCacheKey, "key", "", "Cache key")
+	ciCacheCmd.PersistentFlags().StringVar(&ciCachePath, "path", os.Getenv("GALENA_CACHE_PATH"), "Directory to store caches in instead of the GitHub Actions cache")
+	ciCacheCmd.PersistentFlags().StringSliceVar(&ciCacheOnly, "only", nil, "Caches to handle ("+strings.Join(ciCacheNames, ", ")+"; default: all)")
+	_ = ciCacheCmd.MarkPersistentFlagRequired("key")
+	ciCacheRestoreCmd.Flags().StringArrayVar(&ciCacheRestoreKeys, "restore-key", nil, "Key prefix to fall back to when --key has no entry (repeatable)")
+}
+
+// ciCache is one cache directory
+type ciCache struct {
+	name    string
+	dir     string
+	unshare bool // archive in the user namespace of rootless podman
+}
+
+// ciCacheResult is the outcome of saving or restoring one cache
+type ciCacheResult struct {
+	Cache   string `json:"cache"`
+	Dir     string `json:"dir"`
+	Key     string `json:"key"`
+	Matched string `json:"matched,omitempty"`
+	Saved   bool   `json:"saved,omitempty"`
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ciCaches resolves the directories of the selected caches
+func ciCaches(ctx context.Context, rootDir string) ([]ciCache, error) {
+	names := ciCacheNames
+	if len(ciCacheOnly) > 0 {
+		names = ciCacheOnly
+	}
+	var caches []ciCache
+	for _, name := range names {
+		switch name {
+		case "podman":
+			if !exec.CheckCommand("podman") {
+				logger.Warn("podman not found, skipping its cache")
+				continue
+			}
+			res := exec.RunSimple(ctx, "podman", "info", "--format", "{{.Store.GraphRoot}}")
+			if res.Err != nil {
+				logger.Warn("could not find podman storage, skipping its cache", "error", exec.LastNLines(res.Stderr, 3))
+				continue
+			}
+			caches = append(caches, ciCache{name: name, dir: strings.TrimSpace(res.Stdout), unshare: os.Geteuid() != 0})
+		case "trivy":
+			dir := os.Getenv("TRIVY_CACHE_DIR")
+			if dir == "" {
+				dir = build.ToolCacheDir(rootDir, "trivy")
+			}
+			caches = append(caches, ciCache{name: name, dir: dir})
+		case "bib":
+			caches = append(caches, ciCache{name: name, dir: build.BIBCacheDir(rootDir)})
+		default:
+			return nil, fmt.Errorf("unknown cache %q (use %s)", name, strings.Join(ciCacheNames, ", "))
+		}
+	}
+	return caches, nil
+}
+
+// ciCacheCompression returns the tar compression flag, preferring zstd
+func ciCacheCompression() string {
+	if exec.CheckCommand("zstd") {
+		return "--zstd"
+	}
+	return "--gzip"
+}
+
+// version identifies the contents of a cache archive, so an entry is only
+// restored to the same directory with the same compression
+func (c ciCache) version(compression string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{"galena", c.name, c.dir, compression}, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// tar runs tar for the cache, inside podman unshare for rootless storage
+// whose files belong to subordinate IDs
+func (c ciCache) tar(ctx context.Context, args ...string) error {
+	args = append([]string{"--xattrs", "--xattrs-include=*"}, args...)
+	name := "tar"
+	if c.unshare {
+		name, args = "podman", append([]string{"unshare", "tar"}, args...)
+	}
+	opts := exec.DefaultOptions()
+	opts.Timeout = 60 * time.Minute
+	if res := exec.Run(ctx, name, args, opts); res.Err != nil {
+		return fmt.Errorf("tar: %s", exec.LastNLines(res.Stderr, 3))
+	}
+	return nil
+}
+
+// ciCacheSetup resolves the store, the caches, and a scratch directory for
+// archives, which the caller removes
+func ciCacheSetup(ctx context.Context) (ci.CacheStore, []ciCache, string, error) {
+	if err := exec.RequireCommands("tar"); err != nil {
+		return nil, nil, "", err
+	}
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("finding project root: %w", err)
+	}
+	store, err := ci.NewCacheStore(ciCachePath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	caches, err := ciCaches(ctx, rootDir)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := os.MkdirAll(ci.CacheDir(), 0o755); err != nil {
+		return nil, nil, "", err
+	}
+	tmp, err := os.MkdirTemp(ci.CacheDir(), "archives-")
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return store, caches, tmp, nil
+}
+
+func runCICacheSave(cmd *cobra.Command, args []string) error {
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	store, caches, tmp, err := ciCacheSetup(ctx)
+	if err != nil {
+		if output.IsJSON() {
+			return output.EmitSummary("ci cache save", nil, err)
+		}
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	compression := ciCacheCompression()
+	results := []ciCacheResult{}
+	for _, c := range caches {
+		result := ciCacheResult{Cache: c.name, Dir: c.dir, Key: c.name + "-" + ciCacheKey}
+		entries, err := os.ReadDir(c.dir)
+		if err != nil || len(entries) == 0 {
+			result.Skipped = "empty"
+			results = append(results, result)
+			continue
+		}
+
+		ci.StartGroup("Save " + c.name + " cache")
+		archive := filepath.Join(tmp, c.name+".tar")
+		err = c.tar(ctx, compression, "-C", c.dir, "-cf", archive, ".")
+		if err == nil {
+			if info, statErr := os.Stat(archive); statErr == nil {
+				logger.Info("saving cache", "cache", c.name, "key", result.Key, "size", formatBytes(info.Size()), "store", store.Name())
+			}
+			err = store.Save(ctx, result.Key, c.version(compression), archive)
+		}
+		switch {
+		case errors.Is(err, ci.ErrCacheExists):
+			result.Skipped = "already cached"
+			logger.Info("cache already saved", "cache", c.name, "key", result.Key)
+		case err != nil:
+			result.Error = err.Error()
+			logger.Warn("could not save cache", "cache", c.name, "error", err)
+			ci.LogWarning(fmt.Sprintf("could not save %s cache: %v", c.name, err))
+		default:
+			result.Saved = true
+		}
+		_ = os.Remove(archive)
+		ci.EndGroup()
+		results = append(results, result)
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("ci cache save", results, nil)
+	}
+	printCICacheResults(results)
+	return nil
+}
+
+func runCICacheRestore(cmd *cobra.Command, args []string) error {
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	store, caches, tmp, err := ciCacheSetup(ctx)
+	if err != nil {
+		if output.IsJSON() {
+			return output.EmitSummary("ci cache restore", nil, err)
+		}
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	compression := ciCacheCompression()
+	results := []ciCacheResult{}
+	hit := len(caches) > 0
+	for _, c := range caches {
+		result := ciCacheResult{Cache: c.name, Dir: c.dir, Key: c.name + "-" + ciCacheKey}
+		restoreKeys := make([]string, 0, len(ciCacheRestoreKeys))
+		for _, k := range ciCacheRestoreKeys {
+			restoreKeys = append(restoreKeys, c.name+"-"+k)
+		}
+
+		ci.StartGroup("Restore " + c.name + " cache")
+		archive := filepath.Join(tmp, c.name+".tar")
+		matched, err := store.Restore(ctx, result.Key, restoreKeys, c.version(compression), archive)
+		if err == nil && matched != "" {
+			logger.Info("restoring cache", "cache", c.name, "key", matched, "dir", c.dir)
+			if err = os.MkdirAll(c.dir, 0o755); err == nil {
+				err = c.tar(ctx, compression, "-C", c.dir, "-xf", archive)
+			}
+		}
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+			logger.Warn("could not restore cache", "cache", c.name, "error", err)
+			ci.LogWarning(fmt.Sprintf("could not restore %s cache: %v", c.name, err))
+		case matched == "":
+			result.Skipped = "miss"
+			logger.Info("cache miss", "cache", c.name, "key", result.Key)
+		default:
+			result.Matched = matched
+		}
+		if result.Matched != result.Key {
+			hit = false
+		}
+		_ = os.Remove(archive)
+		ci.EndGroup()
+		results = append(results, result)
+	}
+
+	setCIOutput("cache_hit", strconv.FormatBool(hit))
+	if output.IsJSON() {
+		return output.EmitSummary("ci cache restore", map[string]any{"hit": hit, "caches": results}, nil)
+	}
+	printCICacheResults(results)
+	return nil
+}
+
+func printCICacheResults(results []ciCacheResult) {
+	fmt.Println()
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			fmt.Printf("%s %s: %s\n", ui.ErrorStyle.Render("✗"), r.Cache, r.Error)
+		case r.Skipped != "":
+			fmt.Printf("%s %s: %s\n", ui.MutedStyle.Render("-"), r.Cache, r.Skipped)
+		case r.Saved:
+			fmt.Printf("%s %s: saved as %s\n", ui.SuccessStyle.Render("✓"), r.Cache, r.Key)
+		default:
+			fmt.Printf("%s %s: restored from %s\n", ui.SuccessStyle.Render("✓"), r.Cache, r.Matched)
+		}
+	}
+}
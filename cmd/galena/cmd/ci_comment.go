@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// postCIComment posts or updates the pull request comment of a ci build.
+// Each job keeps its own comment, keyed by the variants it builds. Failures
+// are warnings: a fork's read-only token must not fail the build.
+func postCIComment(ctx context.Context, run *ciBuildRun, results []*ciVariantResult) {
+	env := run.env
+	if env.Provider != ci.ProviderGitHub || !env.IsPullRequest || env.PullRequestNumber == "" {
+		logger.Info("not a GitHub pull request, skipping the PR comment")
+		return
+	}
+	client, err := ci.NewGitHubClient(env.Repository)
+	if err != nil {
+		ci.LogWarning("Skipping the PR comment: " + err.Error())
+		return
+	}
+
+	ci.StartGroup("Commenting on pull request")
+	defer ci.EndGroup()
+
+	variants := make([]string, 0, len(results))
+	for _, r := range results {
+		variants = append(variants, r.variant)
+	}
+	marker := fmt.Sprintf("<!-- galena-build ci build: %s -->", strings.Join(variants, ","))
+	body := ciCommentBody(ctx, run, results)
+
+	comment, err := client.UpsertComment(ctx, env.PullRequestNumber, marker, body)
+	if err != nil {
+		ci.LogWarning("Could not comment on the pull request: " + err.Error())
+		return
+	}
+	logger.Info("updated PR comment", "url", comment.HTMLURL)
+	setCIOutput("pr_comment", comment.HTMLURL)
+}
+
+// ciCommentBody renders the build summary, pull commands, SBOM and
+// vulnerability deltas against the default tag, and the artifact link
+func ciCommentBody(ctx context.Context, run *ciBuildRun, results []*ciVariantResult) string {
+	var b strings.Builder
+	b.WriteString("## Build Summary\n\n")
+	b.WriteString("| Variant | Image | Digest |\n|---------|-------|--------|\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "| %s | `%s` | `%s` |\n", r.variant, r.imageRef, defaultIfEmpty(r.digest, "-"))
+	}
+	fmt.Fprintf(&b, "\n**Version:** `%s` · **Commit:** `%s`\n", run.version.Version, run.version.GitCommit)
+
+	// Pull requests are tagged pr-<number>
+	prTag := run.tags[0]
+	for _, tag := range run.tags {
+		if strings.HasPrefix(tag, "pr-") {
+			prTag = tag
+		}
+	}
+	b.WriteString("\n### Try it\n\n")
+	if run.shouldPush {
+		b.WriteString("```bash\n")
+		for _, r := range results {
+			fmt.Fprintf(&b, "sudo bootc switch %s/%s:%s\n", run.registry, r.imageName, prTag)
+		}
+		b.WriteString("```\n")
+	} else {
+		b.WriteString("Images of pull requests are not pushed; build with `--push` to publish them as `" + prTag + "`.\n")
+	}
+
+	for _, r := range results {
+		baseRef := fmt.Sprintf("%s/%s:%s", run.registry, r.imageName, ciDefaultTag)
+		if section := ciCommentDeltas(ctx, run.rootDir, r, baseRef); section != "" {
+			fmt.Fprintf(&b, "\n### %s compared to `%s`\n\n%s", r.variant, ciDefaultTag, section)
+		}
+	}
+
+	if runURL := run.env.RunURL(); runURL != "" {
+		fmt.Fprintf(&b, "\nDisk images, SBOMs, and reports are in the [workflow run artifacts](%s#artifacts).\n", runURL)
+	}
+	return b.String()
+}
+
+// ciCommentDeltas compares the SBOM and vulnerability counts of a variant
+// with the attested SBOM of its default tag image. It returns "" when the
+// build has no SBOM or the base has none.
+func ciCommentDeltas(ctx context.Context, rootDir string, r *ciVariantResult, baseRef string) string {
+	sbomPath := r.outputs["sbom"]
+	if sbomPath == "" || !exec.CheckCommand("cosign") {
+		return ""
+	}
+	data, err := os.ReadFile(sbomPath)
+	if err != nil {
+		return ""
+	}
+	newPkgs, err := build.ParseSBOMPackages(data)
+	if err != nil {
+		return ""
+	}
+	baseSBOM, err := build.DownloadSBOM(ctx, baseRef)
+	if err != nil {
+		logger.Info("no SBOM of the base image, skipping deltas", "image", baseRef, "reason", err)
+		return ""
+	}
+	oldPkgs, err := build.ParseSBOMPackages(baseSBOM)
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	diff := build.DiffSBOMs(baseRef, oldPkgs, r.imageRef, newPkgs)
+	fmt.Fprintf(&b, "**Packages:** %d added, %d updated, %d removed\n",
+		len(diff.Added), len(diff.Updated), len(diff.Removed))
+	if !diff.Empty() {
+		fmt.Fprintf(&b, "\n<details><summary>Package changes</summary>\n\n%s\n</details>\n", diff.Markdown())
+	}
+
+	// Vulnerability deltas need the scan of this build and a scan of the
+	// base SBOM
+	reportPath := r.outputs["vulnerabilities"]
+	if reportPath == "" {
+		return b.String()
+	}
+	current, err := build.ParseScanReport(r.imageRef, reportPath)
+	if err != nil {
+		return b.String()
+	}
+	tmp, err := os.MkdirTemp("", "galena-comment-")
+	if err != nil {
+		return b.String()
+	}
+	defer os.RemoveAll(tmp)
+	basePath := filepath.Join(tmp, "base.spdx.json")
+	if err := os.WriteFile(basePath, baseSBOM, 0o644); err != nil {
+		return b.String()
+	}
+	base, err := scanSBOM(ctx, rootDir, basePath, filepath.Join(tmp, "base-vulnerabilities.json"), build.SBOMToolAuto, cfg.Scan)
+	if err != nil {
+		logger.Info("could not scan the base SBOM, skipping vulnerability deltas", "error", err)
+		return b.String()
+	}
+
+	b.WriteString("\n| Severity | Base | This build | Change |\n|----------|------|------------|--------|\n")
+	for _, sev := range config.Severities() {
+		oldN, newN := base.Counts[sev], current.Counts[sev]
+		if oldN == 0 && newN == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d | %+d |\n", sev, oldN, newN, newN-oldN)
+	}
+	return b.String()
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	ciInitProvider   string
+	ciInitOutput     string
+	ciInitForce      bool
+	ciInitCheck      bool
+	ciInitBranch     string
+	ciInitDefaultTag string
+	ciInitDisk       []string
+	ciInitVersion    string
+)
+
+var ciInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a CI workflow that builds, pushes, and signs the image",
+	Long: `Write a ready-to-use CI workflow derived from galena.yaml.
+
+The workflow builds every variant in a job matrix with galena-build ci build,
+generates SBOMs, and on the default branch pushes and signs the images with
+cosign keyless signing and builds disk images from them.
+
+Providers:
+  github  - .github/workflows/galena.yml
+  gitlab  - .gitlab-ci.yml; outputs reach later jobs through the galena.env
+            dotenv report
+
+The provider defaults to the CI the command runs in, else github.
+
+--check compares the variant matrix of an existing workflow with the variants
+in galena.yaml and fails when they differ, so a CI step can catch a workflow
+that was not updated after adding a variant.
+
+Examples:
+  galena-build ci init
+  galena-build ci init --provider gitlab
+  galena-build ci init --disk anaconda-iso,qcow2 --force
+  galena-build ci init --check`,
+	Args: cobra.NoArgs,
+	RunE: runCIInit,
+}
+
+func init() {
+	ciInitCmd.Flags().StringVar(&ciInitProvider, "provider", "", "CI provider ("+strings.Join(ci.WorkflowProviders(), ", ")+")")
+	ciInitCmd.Flags().StringVarP(&ciInitOutput, "output", "o", "", "Workflow path (default: the provider's workflow file)")
+	ciInitCmd.Flags().BoolVarP(&ciInitForce, "force", "f", false, "Overwrite an existing workflow")
+	ciInitCmd.Flags().BoolVar(&ciInitCheck, "check", false, "Fail when the workflow's variant matrix differs from galena.yaml")
+	ciInitCmd.Flags().StringVar(&ciInitBranch, "branch", "main", "Default branch whose builds are pushed (github)")
+	ciInitCmd.Flags().StringVar(&ciInitDefaultTag, "default-tag", "stable", "Tag of default branch builds")
+	ciInitCmd.Flags().StringSliceVar(&ciInitDisk, "disk", []string{"anaconda-iso"}, "Disk images built on the default branch; empty for none")
+	ciInitCmd.Flags().StringVar(&ciInitVersion, "galena-version", "latest", "galena-build version the workflow installs")
+}
+
+func runCIInit(cmd *cobra.Command, args []string) error {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	provider := ciInitProvider
+	if provider == "" {
+		provider = ci.Detect().Provider
+		if provider != ci.ProviderGitLab {
+			provider = ci.ProviderGitHub
+		}
+	}
+	path := ciInitOutput
+	if path == "" {
+		rel, err := ci.WorkflowPath(provider)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(rootDir, rel)
+	}
+	variants := cfg.ListVariantNames()
+
+	if ciInitCheck {
+		missing, extra, err := checkWorkflowDrift(provider, path, variants)
+		if output.IsJSON() {
+			return output.EmitSummary("ci init", map[string]any{"path": path, "provider": provider, "missing": missing, "extra": extra}, err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(ui.SuccessStyle.Render("✓") + " " + path + " builds " + strings.Join(variants, ", "))
+		return nil
+	}
+
+	if _, err := os.Stat(path); err == nil && !ciInitForce {
+		return fmt.Errorf("%s already exists (use --force to overwrite, or --check to compare it)", path)
+	}
+	disks := []string{}
+	for _, d := range ciInitDisk {
+		if d = strings.TrimSpace(d); d != "" {
+			disks = append(disks, d)
+		}
+	}
+	workflow, err := ci.RenderWorkflow(provider, ci.WorkflowOptions{
+		Variants:   variants,
+		Branch:     ciInitBranch,
+		DefaultTag: ciInitDefaultTag,
+		DiskTypes:  disks,
+		Version:    ciInitVersion,
+	})
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			err = os.WriteFile(path, []byte(workflow), 0o644)
+		}
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("ci init", map[string]any{"path": path, "provider": provider, "variants": variants, "disk": disks}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Workflow written!\n\nPath: %s\nProvider: %s\nVariants: %s\nDisk images: %s",
+		path, provider, strings.Join(variants, ", "), defaultIfEmpty(strings.Join(disks, ", "), "none"))))
+	return nil
+}
+
+// checkWorkflowDrift compares the variant matrix of the workflow at path
+// with the configured variants
+func checkWorkflowDrift(provider, path string, variants []string) (missing, extra []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading workflow: %w", err)
+	}
+	workflowVariants, err := ci.WorkflowVariants(provider, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	missing, extra = ci.VariantDrift(workflowVariants, variants)
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil, nil, nil
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, "no longer configured "+strings.Join(extra, ", "))
+	}
+	for _, p := range problems {
+		ci.LogError(path+": variant matrix "+p, "", 0)
+	}
+	return missing, extra, fmt.Errorf("%s is out of date with galena.yaml (%s); update the matrix or rerun galena-build ci init --force", path, strings.Join(problems, "; "))
+}
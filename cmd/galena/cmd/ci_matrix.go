@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/output"
+)
+
+var (
+	ciMatrixVariants []string
+	ciMatrixTags     []string
+	ciMatrixArches   []string
+)
+
+var ciMatrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "Emit the build matrix of galena.yaml as JSON",
+	Long: `Emit a JSON build matrix with a job for every variant, tag, and
+architecture, so workflows fan out from the variants in galena.yaml instead
+of a hard-coded list.
+
+The matrix is printed and, in CI, set as the "matrix" step output. Every
+job has variant, tag, arch, platform, image, and runner (the GitHub-hosted
+runner of the architecture).
+
+Example workflow:
+  jobs:
+    matrix:
+      runs-on: ubuntu-24.04
+      outputs:
+        matrix: ${{ steps.matrix.outputs.matrix }}
+      steps:
+        - uses: actions/checkout@v4
+        - id: matrix
+          run: galena-build ci matrix --arch amd64,arm64
+    build:
+      needs: matrix
+      strategy:
+        matrix: ${{ fromJSON(needs.matrix.outputs.matrix) }}
+      runs-on: ${{ matrix.runner }}
+      steps:
+        - run: galena-build ci build --variant "${{ matrix.variant }}"
+
+Examples:
+  galena-build ci matrix
+  galena-build ci matrix --variant main,nvidia --tag stable,beta`,
+	Args: cobra.NoArgs,
+	RunE: runCIMatrix,
+}
+
+func init() {
+	ciCmd.AddCommand(ciMatrixCmd)
+
+	ciMatrixCmd.Flags().StringSliceVar(&ciMatrixVariants, "variant", nil, "Variants to include (default: every variant in galena.yaml)")
+	ciMatrixCmd.Flags().StringSliceVar(&ciMatrixTags, "tag", []string{"stable"}, "Image tags to build")
+	ciMatrixCmd.Flags().StringSliceVar(&ciMatrixArches, "arch", []string{"amd64"}, "Architectures to build (amd64, arm64)")
+}
+
+func runCIMatrix(cmd *cobra.Command, args []string) error {
+	env := ci.Detect()
+	matrix, err := buildCIMatrix(env)
+	if output.IsJSON() {
+		return output.EmitSummary("ci matrix", matrix, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(matrix)
+	if err != nil {
+		return fmt.Errorf("marshaling matrix: %w", err)
+	}
+	if env.Provider != "" {
+		setCIOutput("matrix", string(data))
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func buildCIMatrix(env *ci.Environment) (*ci.Matrix, error) {
+	variants := ciMatrixVariants
+	if len(variants) == 0 {
+		variants = cfg.ListVariantNames()
+	}
+	for _, v := range variants {
+		if _, err := cfg.GetVariant(v); err != nil {
+			return nil, err
+		}
+	}
+	return env.NewMatrix(variants, ciMatrixTags, ciMatrixArches)
+}
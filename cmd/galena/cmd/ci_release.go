@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+	"github.com/iiroan/galena/internal/version"
+)
+
+var (
+	ciReleaseManifest   string
+	ciReleaseRepo       string
+	ciReleaseStableTag  string
+	ciReleaseArtifacts  []string
+	ciReleasePrevious   string
+	ciReleaseDraft      bool
+	ciReleasePrerelease bool
+	ciReleaseForce      bool
+)
+
+var ciReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Publish a GitHub release for a stable build",
+	Long: `Create a GitHub release for the build recorded in build-manifest.json.
+
+Run it after ci build in the same job. The release is tagged with the
+computed version of the build and its notes list the images, the commits
+since the previous release, and the package changes against the SBOM of the
+previous release.
+
+Attached assets:
+  build-manifest.json
+  sbom*.spdx.json and sbom*.cyclonedx.json from the project root
+  files and directories given with --artifact, such as ISOs in output/
+  SHA256SUMS covering every other asset
+
+Only stable builds are released: the build's tag must be --stable-tag and
+it must not come from a pull request. Other builds are skipped without an
+error, so the step can run unconditionally; --force releases them anyway.
+
+The token comes from GITHUB_TOKEN or GH_TOKEN and needs contents: write.
+Commit notes need the previous release tag in the clone (fetch-depth: 0).
+
+Examples:
+  galena-build ci release
+  galena-build ci release --artifact output/
+  galena-build ci release --draft --previous-sbom old-sbom.spdx.json`,
+	Args: cobra.NoArgs,
+	RunE: runCIRelease,
+}
+
+func init() {
+	ciCmd.AddCommand(ciReleaseCmd)
+
+	ciReleaseCmd.Flags().StringVar(&ciReleaseManifest, "manifest", "", "Build manifest (default: build-manifest.json in the project root)")
+	ciReleaseCmd.Flags().StringVar(&ciReleaseRepo, "repo", "", "Repository owner/name (default: the CI repository)")
+	ciReleaseCmd.Flags().StringVar(&ciReleaseStableTag, "stable-tag", "stable", "Image tag of builds that are released")
+	ciReleaseCmd.Flags().StringArrayVar(&ciReleaseArtifacts, "artifact", nil, "Extra file or directory to attach, e.g. output/ for ISOs (repeatable)")
+	ciReleaseCmd.Flags().StringVar(&ciReleasePrevious, "previous-sbom", "", "SBOM file or image to diff packages against (default: SBOM of the previous release)")
+	ciReleaseCmd.Flags().BoolVar(&ciReleaseDraft, "draft", false, "Create a draft release")
+	ciReleaseCmd.Flags().BoolVar(&ciReleasePrerelease, "prerelease", false, "Mark the release as a prerelease")
+	ciReleaseCmd.Flags().BoolVarP(&ciReleaseForce, "force", "f", false, "Release builds that are not stable")
+}
+
+// ciReleaseResult is the outcome of ci release
+type ciReleaseResult struct {
+	Tag     string   `json:"tag,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Assets  []string `json:"assets,omitempty"`
+	Skipped string   `json:"skipped,omitempty"`
+}
+
+func runCIRelease(cmd *cobra.Command, args []string) error {
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	result, err := ciRelease(ctx)
+	if output.IsJSON() {
+		return output.EmitSummary("ci release", result, err)
+	}
+	if err != nil {
+		return err
+	}
+	if result.Skipped != "" {
+		logger.Info("release skipped", "reason", result.Skipped)
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Release published!\n\nTag: %s\nAssets: %d\nURL: %s",
+		result.Tag, len(result.Assets), result.URL)))
+	return nil
+}
+
+func ciRelease(ctx context.Context) (*ciReleaseResult, error) {
+	env := ci.Detect()
+	result := &ciReleaseResult{}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return result, fmt.Errorf("finding project root: %w", err)
+	}
+	manifestPath := ciReleaseManifest
+	if manifestPath == "" {
+		manifestPath = filepath.Join(rootDir, "build-manifest.json")
+	}
+	manifest, err := version.LoadManifest(manifestPath)
+	if err != nil {
+		return result, fmt.Errorf("%w (run ci build first)", err)
+	}
+
+	if !ciReleaseForce {
+		switch {
+		case env.IsPullRequest:
+			result.Skipped = "pull request build"
+			return result, nil
+		case manifest.Version.Tag != ciReleaseStableTag:
+			result.Skipped = fmt.Sprintf("build tag %q is not %q", manifest.Version.Tag, ciReleaseStableTag)
+			return result, nil
+		}
+	}
+	if env.Provider != "" && env.Provider != ci.ProviderGitHub {
+		return result, fmt.Errorf("ci release publishes GitHub releases; %s is not supported", env.Provider)
+	}
+
+	repo := defaultIfEmpty(ciReleaseRepo, env.Repository)
+	if repo == "" {
+		return result, fmt.Errorf("no repository: pass --repo owner/name")
+	}
+	client, err := ci.NewGitHubClient(repo)
+	if err != nil {
+		return result, err
+	}
+
+	tag := manifest.Version.Version
+	if tag == "" {
+		return result, fmt.Errorf("%s has no version", manifestPath)
+	}
+	result.Tag = tag
+	if existing, err := client.ReleaseByTag(ctx, tag); err != nil {
+		return result, err
+	} else if existing != nil {
+		return result, fmt.Errorf("release %s already exists: %s", tag, existing.HTMLURL)
+	}
+	previous, err := client.LatestRelease(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	assets, err := releaseAssets(rootDir, manifestPath)
+	if err != nil {
+		return result, err
+	}
+	tmp, err := os.MkdirTemp("", "galena-release-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(tmp)
+	sums, err := releaseChecksums(tmp, assets)
+	if err != nil {
+		return result, err
+	}
+	assets = append(assets, sums)
+
+	ci.StartGroup("Release notes")
+	notes := releaseNotes(ctx, rootDir, client, manifest, previous)
+	fmt.Println(notes)
+	ci.EndGroup()
+
+	release, err := client.CreateRelease(ctx, ci.NewRelease{
+		TagName:    tag,
+		Target:     env.SHA,
+		Name:       fmt.Sprintf("%s %s", manifest.Project, tag),
+		Body:       notes,
+		Draft:      ciReleaseDraft,
+		Prerelease: ciReleasePrerelease,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.URL = release.HTMLURL
+	logger.Info("created release", "tag", tag, "url", release.HTMLURL)
+
+	for _, path := range assets {
+		logger.Info("uploading release asset", "file", filepath.Base(path))
+		if err := client.UploadAsset(ctx, release, path); err != nil {
+			return result, err
+		}
+		result.Assets = append(result.Assets, filepath.Base(path))
+	}
+
+	setCIOutput("release_tag", tag)
+	setCIOutput("release_url", release.HTMLURL)
+	addCISummary(fmt.Sprintf("## Release\n\n| Property | Value |\n|----------|-------|\n| Tag | [`%s`](%s) |\n| Assets | %d |\n",
+		tag, release.HTMLURL, len(result.Assets)))
+	return result, nil
+}
+
+// releaseAssets collects the manifest, SBOMs, and --artifact files. Asset
+// names must be unique, and checksum files of disk builds are replaced by
+// the release's own SHA256SUMS.
+func releaseAssets(rootDir, manifestPath string) ([]string, error) {
+	assets := []string{manifestPath}
+	for _, pattern := range []string{"sbom*.spdx.json", "sbom*.cyclonedx.json"} {
+		matches, err := filepath.Glob(filepath.Join(rootDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, matches...)
+	}
+
+	for _, artifact := range ciReleaseArtifacts {
+		err := filepath.WalkDir(artifact, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			name := d.Name()
+			if strings.HasPrefix(name, build.SHA256SumsFile) || strings.HasPrefix(name, build.SHA512SumsFile) {
+				return nil
+			}
+			assets = append(assets, path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("collecting artifacts: %w", err)
+		}
+	}
+
+	seen := map[string]string{}
+	for _, path := range assets {
+		name := filepath.Base(path)
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("release assets %s and %s have the same name", other, path)
+		}
+		seen[name] = path
+	}
+	return assets, nil
+}
+
+// releaseChecksums writes a SHA256SUMS of the assets to dir
+func releaseChecksums(dir string, assets []string) (string, error) {
+	var b strings.Builder
+	for _, path := range assets {
+		sum, err := build.ChecksumFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum.SHA256, filepath.Base(path))
+	}
+	path := filepath.Join(dir, build.SHA256SumsFile)
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// releaseNotes renders the images, commit log, and package changes of a
+// release. Sections that cannot be computed are left out with a warning
+// rather than failing the release.
+func releaseNotes(ctx context.Context, rootDir string, client *ci.GitHubClient, manifest *version.BuildManifest, previous *ci.Release) string {
+	var b strings.Builder
+
+	b.WriteString("## Images\n\n")
+	for _, img := range manifest.Images {
+		line := fmt.Sprintf("- `%s:%s`", img.Name, img.Tag)
+		if img.Digest != "" {
+			line += fmt.Sprintf(" (`%s`)", img.Digest)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n## Commits\n\n")
+	gitArgs := []string{"log", "--no-merges", "--pretty=format:- %s (%h)"}
+	if previous != nil {
+		gitArgs = append(gitArgs, previous.TagName+"..HEAD")
+	} else {
+		gitArgs = append(gitArgs, "-n", "50")
+	}
+	if res := exec.Git(ctx, rootDir, gitArgs...); res.Err != nil {
+		logger.Warn("could not read the commit log", "error", exec.LastNLines(res.Stderr, 3))
+		b.WriteString("Commit log unavailable.\n")
+	} else if log := strings.TrimSpace(res.Stdout); log != "" {
+		b.WriteString(log + "\n")
+	} else {
+		b.WriteString("No commits.\n")
+	}
+
+	if diff := releasePackageDiff(ctx, rootDir, client, manifest, previous); diff != nil {
+		b.WriteString("\n" + diff.Markdown())
+	}
+	return b.String()
+}
+
+// releasePackageDiff compares the SBOM of the build with --previous-sbom or
+// the SBOM attached to the previous release
+func releasePackageDiff(ctx context.Context, rootDir string, client *ci.GitHubClient, manifest *version.BuildManifest, previous *ci.Release) *build.SBOMDiff {
+	variant := "main"
+	if len(manifest.Images) > 0 && manifest.Images[0].Variant != "" {
+		variant = manifest.Images[0].Variant
+	}
+	name := build.SBOMFileName(build.SBOMFormatSPDX, variant)
+	data, err := os.ReadFile(filepath.Join(rootDir, name))
+	if err != nil {
+		logger.Warn("no SBOM of this build, skipping package changes", "file", name)
+		return nil
+	}
+	newPkgs, err := build.ParseSBOMPackages(data)
+	if err != nil {
+		logger.Warn("could not parse SBOM", "file", name, "error", err)
+		return nil
+	}
+
+	var oldRef string
+	var oldPkgs []build.SBOMPackage
+	switch {
+	case ciReleasePrevious != "":
+		oldRef = ciReleasePrevious
+		oldPkgs, err = sbomPackages(ctx, rootDir, ciReleasePrevious)
+	case previous != nil:
+		asset, ok := previous.Asset(name)
+		if !ok {
+			logger.Warn("previous release has no SBOM, skipping package changes", "release", previous.TagName, "asset", name)
+			return nil
+		}
+		oldRef = previous.TagName
+		var old []byte
+		if old, err = client.DownloadAsset(ctx, asset); err == nil {
+			oldPkgs, err = build.ParseSBOMPackages(old)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		logger.Warn("could not load the previous SBOM, skipping package changes", "error", err)
+		return nil
+	}
+	return build.DiffSBOMs(oldRef, oldPkgs, manifest.Version.Version, newPkgs)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/spf13/cobra"
@@ -16,10 +17,12 @@ import (
 )
 
 var (
-	cleanImages  bool
-	cleanOutput  bool
-	cleanAll     bool
-	cleanConfirm bool
+	cleanImages bool
+	cleanOutput bool
+	cleanAll    bool
+	cleanKeep   int
+	cleanMaxAge time.Duration
+	cleanPrune  bool
 )
 
 var cleanCmd = &cobra.Command{
@@ -31,6 +34,10 @@ By default, removes:
   - Local container images matching the project name
   - Generated disk images in the output directory
 
+With --keep, --max-age, or a clean.policy in galena.yaml, only image tags
+outside the retention policy are removed. Tags are grouped per variant and
+the newest tag of each variant is always kept.
+
 Examples:
   # Clean local images only
   galena-build clean --images
@@ -38,6 +45,12 @@ Examples:
   # Clean output directory only
   galena-build clean --output
 
+  # Keep the 3 newest tags of each variant
+  galena-build clean --images --keep 3
+
+  # Remove tags older than a week and dangling layers
+  galena-build clean --images --max-age 168h --prune
+
   # Clean everything
   galena-build clean --all
 
@@ -50,12 +63,14 @@ func init() {
 	cleanCmd.Flags().BoolVar(&cleanImages, "images", false, "Clean local container images")
 	cleanCmd.Flags().BoolVar(&cleanOutput, "output", false, "Clean output directory")
 	cleanCmd.Flags().BoolVar(&cleanAll, "all", false, "Clean everything")
-	cleanCmd.Flags().BoolVarP(&cleanConfirm, "yes", "y", false, "Skip confirmation prompt")
+	cleanCmd.Flags().IntVar(&cleanKeep, "keep", 0, "Keep the N newest image tags per variant (overrides clean.policy.keep_last)")
+	cleanCmd.Flags().DurationVar(&cleanMaxAge, "max-age", 0, "Remove image tags older than this (overrides clean.policy.max_age)")
+	cleanCmd.Flags().BoolVar(&cleanPrune, "prune", false, "Also prune dangling images and layers")
 }
 
 func runClean(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	if err := platform.RequireLinux("clean"); err != nil {
+	if err := platform.Require(platform.ContainerTools, "clean"); err != nil {
 		return err
 	}
 
@@ -74,14 +89,40 @@ func runClean(cmd *cobra.Command, args []string) error {
 		cleanOutput = true
 	}
 
-	// Confirm unless -y flag
-	if !cleanConfirm {
+	policy, err := build.NewRetentionPolicy(cfg.Clean.Policy)
+	if err != nil {
+		return fmt.Errorf("clean policy: %w", err)
+	}
+	if cmd.Flags().Changed("keep") {
+		if cleanKeep < 1 {
+			return fmt.Errorf("--keep must be at least 1")
+		}
+		policy.KeepLast = cleanKeep
+	}
+	if cmd.Flags().Changed("max-age") {
+		policy.MaxAge = cleanMaxAge
+	}
+	pruneDangling := cleanPrune || cfg.Clean.Policy.PruneDangling
+
+	description := "This will remove local images and output files"
+	if cleanImages && policy.Enabled() {
+		description = "This will remove image tags outside the retention policy"
+		if cleanOutput {
+			description += " and output files"
+		}
+	}
+
+	// Confirm unless -y flag; a dry run removes nothing
+	if !assumeYes && !dryRun {
+		if err := ui.RequireInteractive("clean", "--yes"); err != nil {
+			return err
+		}
 		var confirm bool
 		form := huh.NewForm(
 			huh.NewGroup(
 				huh.NewConfirm().
 					Title("Clean build artifacts?").
-					Description("This will remove local images and output files").
+					Description(description).
 					Value(&confirm),
 			),
 		)
@@ -99,18 +140,36 @@ func runClean(cmd *cobra.Command, args []string) error {
 	// Clean images
 	if cleanImages {
 		builder := build.NewBuilder(cfg, rootDir, logger)
-		images, err := builder.ListLocalImages(ctx)
-		if err != nil {
-			logger.Warn("could not list images", "error", err)
+		var images []string
+		if policy.Enabled() {
+			prunable, err := builder.PrunableImages(ctx, policy)
+			if err != nil {
+				logger.Warn("could not list images", "error", err)
+			}
+			for _, img := range prunable {
+				images = append(images, img.Name)
+			}
 		} else {
-			for _, img := range images {
-				logger.Info("removing image", "image", img)
-				result := exec.Podman(ctx, "rmi", "-f", img)
-				if result.Err != nil {
-					logger.Warn("could not remove image", "image", img, "error", result.Err)
-				} else {
-					cleaned = append(cleaned, img)
-				}
+			images, err = builder.ListLocalImages(ctx)
+			if err != nil {
+				logger.Warn("could not list images", "error", err)
+			}
+		}
+
+		for _, img := range images {
+			logger.Info("removing image", "image", img)
+			result := builder.Engine().RemoveImage(ctx, img)
+			if result.Err != nil {
+				logger.Warn("could not remove image", "image", img, "error", result.Err)
+			} else {
+				cleaned = append(cleaned, img)
+			}
+		}
+
+		if pruneDangling {
+			logger.Info("pruning dangling images")
+			if err := builder.PruneDangling(ctx); err != nil {
+				logger.Warn("could not prune dangling images", "error", err)
 			}
 		}
 	}
@@ -120,7 +179,7 @@ func runClean(cmd *cobra.Command, args []string) error {
 		outputDir := filepath.Join(rootDir, "output")
 		if _, err := os.Stat(outputDir); err == nil {
 			logger.Info("removing output directory", "path", outputDir)
-			if err := os.RemoveAll(outputDir); err != nil {
+			if err := removePath(outputDir); err != nil {
 				logger.Warn("could not remove output directory", "error", err)
 			} else {
 				cleaned = append(cleaned, outputDir)
@@ -131,7 +190,7 @@ func runClean(cmd *cobra.Command, args []string) error {
 		manifestPath := filepath.Join(rootDir, "build-manifest.json")
 		if _, err := os.Stat(manifestPath); err == nil {
 			logger.Info("removing manifest", "path", manifestPath)
-			if err := os.Remove(manifestPath); err != nil {
+			if err := removePath(manifestPath); err != nil {
 				logger.Warn("could not remove manifest", "error", err)
 			} else {
 				cleaned = append(cleaned, manifestPath)
@@ -142,7 +201,7 @@ func runClean(cmd *cobra.Command, args []string) error {
 		sbomPath := filepath.Join(rootDir, "sbom.spdx.json")
 		if _, err := os.Stat(sbomPath); err == nil {
 			logger.Info("removing SBOM", "path", sbomPath)
-			if err := os.Remove(sbomPath); err != nil {
+			if err := removePath(sbomPath); err != nil {
 				logger.Warn("could not remove SBOM", "error", err)
 			} else {
 				cleaned = append(cleaned, sbomPath)
@@ -151,6 +210,11 @@ func runClean(cmd *cobra.Command, args []string) error {
 	}
 
 	// Print summary
+	if dryRun {
+		fmt.Println()
+		fmt.Println(dryRunBox(fmt.Sprintf("nothing was removed; %d item(s) would be.", len(cleaned)), ""))
+		return nil
+	}
 	if len(cleaned) > 0 {
 		fmt.Println()
 		fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Cleaned %d items", len(cleaned))))
@@ -161,3 +225,13 @@ func runClean(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// removePath removes a file or directory tree, printing the command instead
+// in dry-run mode
+func removePath(path string) error {
+	if exec.DryRun() {
+		exec.PrintDryRun("rm", []string{"-rf", path})
+		return nil
+	}
+	return os.RemoveAll(path)
+}
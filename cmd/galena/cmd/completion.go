@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/scaffold"
+)
+
+// completionTimeout bounds completions that query podman or docker
+const completionTimeout = 3 * time.Second
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Generate shell completion scripts",
+	Long: `Generate a completion script for bash, zsh, or fish. Besides commands and
+flags it completes values from the project: variant names and tags from
+galena.yaml, disk output types, output formats, workspace projects, session
+logs, ujust recipes, and devcontainer workspaces.
+
+Load completions for the current shell:
+  source <(galena-build completion bash)
+  source <(galena-build completion zsh)
+  galena-build completion fish | source
+
+Install them for every session:
+  galena-build completion bash > ~/.local/share/bash-completion/completions/galena-build
+  galena-build completion zsh > "${fpath[1]}/_galena-build"
+  galena-build completion fish > ~/.config/fish/completions/galena-build.fish
+
+The galena device CLI works the same way.`,
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	DisableFlagsInUseLine: true,
+	RunE:                  runCompletion,
+}
+
+func runCompletion(cmd *cobra.Command, args []string) error {
+	switch args[0] {
+	case "bash":
+		return cmd.Root().GenBashCompletionV2(os.Stdout, true)
+	case "zsh":
+		return cmd.Root().GenZshCompletion(os.Stdout)
+	case "fish":
+		return cmd.Root().GenFishCompletion(os.Stdout, true)
+	}
+	return fmt.Errorf("unsupported shell %q (expected bash, zsh, or fish)", args[0])
+}
+
+func init() {
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+}
+
+// registerCompletions adds the dynamic completions to the commands of the
+// active profile. Flags are matched by name, so commands added later get
+// them without further wiring.
+func registerCompletions() {
+	flagCompletions := map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+		"variant": completeVariants,
+		"tag":     completeTags,
+	}
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		for name, complete := range flagCompletions {
+			if c.LocalFlags().Lookup(name) != nil {
+				_ = c.RegisterFlagCompletionFunc(name, complete)
+			}
+		}
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(rootCmd)
+
+	_ = rootCmd.RegisterFlagCompletionFunc("output-format", cobra.FixedCompletions(output.Formats(), cobra.ShellCompDirectiveNoFileComp))
+	_ = rootCmd.RegisterFlagCompletionFunc("engine", cobra.FixedCompletions(config.ContainerEngines(), cobra.ShellCompDirectiveNoFileComp))
+	_ = rootCmd.RegisterFlagCompletionFunc("project-name", completeWorkspaceProjects)
+	_ = buildCmd.RegisterFlagCompletionFunc("dirty-policy", cobra.FixedCompletions(config.DirtyPolicies(), cobra.ShellCompDirectiveNoFileComp))
+	_ = devCmd.RegisterFlagCompletionFunc("workspace", completeDevWorkspaces)
+	_ = initCmd.RegisterFlagCompletionFunc("template", completeInitTemplates)
+
+	diskCmd.ValidArgsFunction = completeDiskTypes
+	logsCmd.ValidArgsFunction = completeSessions
+	logsShowCmd.ValidArgsFunction = completeSessions
+	ujustCmd.ValidArgsFunction = completeUJustRecipes
+}
+
+// completionConfig loads the project config for a completion, which runs
+// without the root command's PersistentPreRunE
+func completionConfig() *config.Config {
+	if cfg != nil {
+		return cfg
+	}
+	if err := resolveWorkspaceProject(); err != nil {
+		return nil
+	}
+	var loaded *config.Config
+	var err error
+	switch {
+	case cfgFile != "":
+		loaded, err = config.Load(cfgFile)
+	case projectDir != "":
+		loaded, err = config.Load(filepath.Join(projectDir, "galena.yaml"))
+	default:
+		loaded, err = config.LoadFromProject()
+	}
+	if err != nil {
+		return nil
+	}
+	return loaded
+}
+
+// completeVariants completes variant names from galena.yaml, including
+// after a comma in variant lists such as main,nvidia
+func completeVariants(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c := completionConfig()
+	if c == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	prefix := ""
+	chosen := []string{}
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+		chosen = strings.Split(toComplete[:i], ",")
+	}
+	completions := []string{}
+	for _, v := range c.Variants {
+		if slices.Contains(chosen, v.Name) {
+			continue
+		}
+		completions = append(completions, completionWithDesc(prefix+v.Name, v.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTags completes the usual image tags and the tags of the
+// channels in galena.yaml
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	tags := []string{"latest", "stable", "beta"}
+	completions := slices.Clone(tags)
+	if c := completionConfig(); c != nil {
+		for _, ch := range c.Channels {
+			if tag := ch.ImageTag(); !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+				completions = append(completions, completionWithDesc(tag, ch.Description))
+			}
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeDiskTypes completes the output type of disk
+func completeDiskTypes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return build.ListOutputTypes(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeWorkspaceProjects completes the projects of the surrounding
+// workspace
+func completeWorkspaceProjects(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	start := projectDir
+	if start == "" {
+		start, _ = os.Getwd()
+	}
+	ws, err := config.FindWorkspace(start)
+	if err != nil || ws == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return ws.ProjectNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSessions completes session log names and kinds
+func completeSessions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	sessions, err := build.ListSessions(rootDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	completions := []string{}
+	kinds := map[string]bool{}
+	for _, s := range sessions {
+		if !kinds[s.Kind] {
+			kinds[s.Kind] = true
+			completions = append(completions, completionWithDesc(s.Kind, "newest "+s.Kind+" session"))
+		}
+		completions = append(completions, completionWithDesc(s.Name, s.Status))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeUJustRecipes completes ujust recipe names
+func completeUJustRecipes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	recipes, err := loadUJustRecipes()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	completions := make([]string, 0, len(recipes))
+	for _, recipe := range recipes {
+		completions = append(completions, completionWithDesc(recipe.Name, recipe.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeDevWorkspaces completes the workspaces of known devcontainers,
+// falling back to directories
+func completeDevWorkspaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	containers, err := discoverDevcontainers(ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	completions := []string{}
+	for _, container := range containers {
+		if container.Workspace == "" || slices.Contains(completions, container.Workspace) {
+			continue
+		}
+		completions = append(completions, container.Workspace)
+	}
+	if len(completions) == 0 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionWithDesc adds a description that zsh and fish show next to the
+// value
+func completionWithDesc(value, description string) string {
+	if description == "" {
+		return value
+	}
+	return value + "\t" + description
+}
+
+// completeInitTemplates completes the project templates of galena-build init
+func completeInitTemplates(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var completions []string
+	for _, t := range scaffold.Templates() {
+		completions = append(completions, completionWithDesc(t.Name, t.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,472 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/iiroan/galena/internal/config"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config <command>",
+	Short: "Work with galena.yaml",
+	Long: `Work with the project configuration in galena.yaml.
+
+Subcommands:
+  show   - Print galena.yaml, or with --resolved the effective configuration
+  get    - Print the effective value of a key
+  set    - Set a key in galena.yaml
+  unset  - Remove a key from galena.yaml
+  migrate - Convert a finctl.yaml into galena.yaml
+  schema - Print the JSON Schema of galena.yaml for editor integration
+  env    - List the GALENA_* variables that override galena.yaml
+  device - Write the settings a device reads, for shipping in the image
+
+galena.yaml can build on shared configs with extends (one base) and include
+(a list of fragments), each a path relative to the file or an https URL:
+
+  extends: ../base/galena.yaml
+  include:
+    - https://example.org/galena/signing.yaml
+
+The base, then each include, then the file itself are deep-merged: mappings
+merge key by key, while lists and values replace what they inherit.
+
+galena-build validate checks galena.yaml against the same schema and reports
+unknown keys, wrong types, invalid enum values, durations, and digests with
+their line and column.`,
+}
+
+var configShowResolved bool
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print galena.yaml or the effective configuration",
+	Long: `Print galena.yaml as written. With --resolved, print the configuration
+galena-build actually uses: the built-in defaults, overlaid by the configs
+the file extends and includes, by the file itself, and by GALENA_*
+environment variables.
+
+Examples:
+  galena-build config show
+  galena-build config show --resolved`,
+	Args: cobra.NoArgs,
+	RunE: runConfigShow,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a configuration key",
+	Long: `Print the value galena-build uses for a key, after defaults, extends,
+include, and environment overrides. Keys are dotted paths; list items are
+addressed by index or, for lists of named entries, by name.
+
+Examples:
+  galena-build config get build.defaults.tag
+  galena-build config get variants.nvidia.packages
+  galena-build config get variants[0]`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigKeys,
+	RunE:              runConfigGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a configuration key in galena.yaml",
+	Long: `Set a key in galena.yaml without editing YAML by hand. The value is
+parsed for the type of the key: numbers and booleans are checked, lists of
+strings take comma-separated items, and mappings or lists of objects take a
+YAML value. Comments and layout of the file are kept, and the file is only
+written when the result passes validation.
+
+Examples:
+  galena-build config set build.defaults.tag stable
+  galena-build config set build.defaults.push true
+  galena-build config set variants.main.packages htop,tmux
+  galena-build config set build.build_args.VENDOR acme
+  galena-build config set variants[1] '{name: dx, flavor: dx, description: Developer tools}'`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeConfigKeys,
+	RunE:              runConfigSet,
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a configuration key from galena.yaml",
+	Long: `Remove a key or list item from galena.yaml, so the value falls back to
+what the file extends or includes, or to the built-in default.
+
+Examples:
+  galena-build config unset build.defaults.tag
+  galena-build config unset variants.nvidia`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigKeys,
+	RunE:              runConfigUnset,
+}
+
+var (
+	configMigrateFrom  string
+	configMigrateForce bool
+)
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Convert a finctl.yaml into galena.yaml",
+	Long: `Convert the finctl.yaml of a project into galena.yaml. finctl defaults
+such as the project name are renamed, keys galena does not know are dropped
+and listed, and the result is validated before it is written. Comments and
+key order are kept; finctl.yaml itself is left in place.
+
+With --dry-run the converted config is printed instead of written.
+
+Examples:
+  galena-build config migrate
+  galena-build config migrate --from old/finctl.yaml --force`,
+	Args: cobra.NoArgs,
+	RunE: runConfigMigrate,
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of galena.yaml",
+	Long: `Print a JSON Schema (draft 2020-12) describing galena.yaml, so editors
+can complete keys and flag mistakes while you type.
+
+Examples:
+  galena-build config schema > galena.schema.json
+
+  # Then point the YAML language server at it, either in galena.yaml:
+  # yaml-language-server: $schema=./galena.schema.json
+
+  # or in VS Code settings.json:
+  "yaml.schemas": { "./galena.schema.json": "galena.yaml" }`,
+	Args: cobra.NoArgs,
+	RunE: runConfigSchema,
+}
+
+var configEnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "List the environment variables that override galena.yaml",
+	Long: `List the GALENA_* environment variables that override galena.yaml, and
+which of them are set.
+
+Settings are layered: command line flags win over environment variables,
+which win over galena.yaml, which wins over the built-in defaults. Every
+field holding a string, number, boolean, or list has a variable named after
+its path, e.g. build.fedora_version is GALENA_BUILD_FEDORA_VERSION. Lists
+are comma-separated, and entries of maps such as build.build_args take the
+key as a suffix. Fields inside lists of objects, such as variants, cannot be
+overridden. Values from the environment are never written back to
+galena.yaml.
+
+Examples:
+  GALENA_BUILD_FEDORA_VERSION=43 galena-build build
+  GALENA_REGISTRY=registry.internal GALENA_REPOSITORY=os galena-build build --push
+  GALENA_BUILD_BUILD_ARGS_IMAGE_VENDOR=acme galena-build build`,
+	Args: cobra.NoArgs,
+	RunE: runConfigEnv,
+}
+
+var configDeviceKeyDir string
+
+var configDeviceCmd = &cobra.Command{
+	Use:   "device <dir>",
+	Short: "Write the galena.yaml shipped in the image",
+	Long: `Write <dir>/galena.yaml with only the settings galena reads on a device:
+the name, registry, and repository of the image and its variants, the
+release channels, and signature verification. Build settings, hooks,
+notifications, and credentials are left out, and extends and include are
+resolved, so the file needs nothing else from the project.
+
+When verify.key names a public key file, the key is copied next to the
+config and verify.key points at it under --key-dir.
+
+The Containerfile runs this in its build stage and copies <dir> to
+/usr/share/galena.
+
+Examples:
+  galena-build config device out/device
+  galena-build --config galena.yaml config device /out/device`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigDevice,
+}
+
+func init() {
+	configDeviceCmd.Flags().StringVar(&configDeviceKeyDir, "key-dir", "/usr/share/galena", "Directory the verify key is installed to on the device")
+	configShowCmd.Flags().BoolVar(&configShowResolved, "resolved", false, "Print the effective configuration with bases, defaults, and environment overrides applied")
+
+	configMigrateCmd.Flags().StringVar(&configMigrateFrom, "from", "", "finctl config to convert (default: finctl.yaml in the project root)")
+	configMigrateCmd.Flags().BoolVarP(&configMigrateForce, "force", "f", false, "Overwrite an existing galena.yaml")
+
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configEnvCmd)
+	configCmd.AddCommand(configDeviceCmd)
+}
+
+// projectConfigPath returns the galena.yaml of the project, or --config
+func projectConfigPath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return "", fmt.Errorf("finding project root: %w", err)
+	}
+	return filepath.Join(rootDir, "galena.yaml"), nil
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if !configShowResolved {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading config: %w", err)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	resolved, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	// The bases are merged in, so naming them again would be misleading
+	resolved.Extends = ""
+	resolved.Include = nil
+	data, err := yaml.Marshal(resolved)
+	if err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+	fmt.Printf("# Effective configuration of %s\n", path)
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func runConfigDevice(cmd *cobra.Command, args []string) error {
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+	// Unlike other commands, never fall back to defaults: the image would
+	// follow the wrong registry
+	effective, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	dir := args[0]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	device := *effective
+	if key := device.Verify.Key; key != "" && !strings.Contains(key, "://") {
+		if !filepath.IsAbs(key) {
+			key = filepath.Join(filepath.Dir(path), key)
+		}
+		data, err := os.ReadFile(key)
+		if err != nil {
+			return fmt.Errorf("reading verify.key: %w", err)
+		}
+		name := filepath.Base(key)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return fmt.Errorf("writing verify key: %w", err)
+		}
+		device.Verify.Key = filepath.Join(configDeviceKeyDir, name)
+	}
+
+	data, err := device.DeviceYAML()
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(dir, "galena.yaml")
+	if err := os.WriteFile(target, data, 0o644); err != nil {
+		return fmt.Errorf("writing device config: %w", err)
+	}
+	logger.Info("wrote device config", "path", target)
+	return nil
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+	effective, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	value, err := effective.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if output.IsJSON() {
+		// Round-trip through YAML so the value uses the keys of galena.yaml
+		var generic any
+		if data, err := yaml.Marshal(value); err == nil {
+			_ = yaml.Unmarshal(data, &generic)
+		}
+		return output.EmitSummary("config get", map[string]any{"key": args[0], "value": generic}, nil)
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case string, int, bool:
+		fmt.Println(v)
+	default:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	}
+	return nil
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := config.SetFileValue(path, args[0], args[1]); err != nil {
+		return err
+	}
+	logger.Info("updated config", "key", args[0], "path", path)
+	warnEnvOverride(args[0])
+	return nil
+}
+
+func runConfigUnset(cmd *cobra.Command, args []string) error {
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := config.UnsetFileValue(path, args[0]); err != nil {
+		return err
+	}
+	logger.Info("removed config key", "key", args[0], "path", path)
+	warnEnvOverride(args[0])
+	return nil
+}
+
+// warnEnvOverride points out that an environment variable still overrides
+// the key that was just changed
+func warnEnvOverride(key string) {
+	if cfg == nil {
+		return
+	}
+	for _, o := range cfg.EnvOverrides() {
+		if o.Path == key {
+			logger.Warn("the environment overrides this key", "var", o.Var)
+		}
+	}
+}
+
+// completeConfigKeys completes the keys of galena.yaml
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return config.Keys(), cobra.ShellCompDirectiveNoFileComp
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+	from := configMigrateFrom
+	if from == "" {
+		from = filepath.Join(filepath.Dir(path), config.LegacyFile)
+	}
+	if _, err := os.Stat(from); err != nil {
+		return fmt.Errorf("no %s to migrate: %w", config.LegacyFile, err)
+	}
+	if _, err := os.Stat(path); err == nil && !configMigrateForce && !galexec.DryRun() {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+	}
+
+	migration, err := config.MigrateLegacy(from)
+	if err != nil {
+		return err
+	}
+	for _, rename := range migration.Renamed {
+		logger.Info("renamed finctl default", "change", rename)
+	}
+	for _, key := range migration.Dropped {
+		logger.Warn("dropped key galena does not know", "key", key)
+	}
+
+	if galexec.DryRun() {
+		_, err := os.Stdout.Write(migration.Data)
+		return err
+	}
+	if err := config.WriteMigration(path, migration); err != nil {
+		return err
+	}
+	logger.Info("migrated config", "from", from, "to", path)
+	return nil
+}
+
+func runConfigSchema(cmd *cobra.Command, args []string) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(config.JSONSchema())
+}
+
+type configEnvRow struct {
+	Var  string `json:"var"`
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	Set  bool   `json:"set"`
+}
+
+func runConfigEnv(cmd *cobra.Command, args []string) error {
+	var overrides []config.EnvOverride
+	if cfg != nil {
+		overrides = cfg.EnvOverrides()
+	}
+
+	rows := []configEnvRow{}
+	for _, f := range config.EnvFields() {
+		row := configEnvRow{Var: f.Var, Key: f.Path, Type: f.Type}
+		for _, o := range overrides {
+			// Map entries are overridden under the path of their map
+			if o.Path == f.Path || strings.HasPrefix(o.Path, f.Path+".") {
+				row.Set = true
+			}
+		}
+		rows = append(rows, row)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("config env", rows, nil)
+	}
+
+	fmt.Printf("%-48s  %-40s  %s\n", "VARIABLE", "KEY", "TYPE")
+	for _, r := range rows {
+		line := fmt.Sprintf("%-48s  %-40s  %s", r.Var, r.Key, r.Type)
+		if r.Set {
+			line = ui.SuccessStyle.Render(line + "  (set)")
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
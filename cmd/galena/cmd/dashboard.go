@@ -0,0 +1,643 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	"github.com/iiroan/galena/internal/build"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// dashboardLogLines is the number of lines kept from the newest session log
+const dashboardLogLines = 200
+
+var dashboardRefresh time.Duration
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Home screen tying together device, build, and app status",
+	Long: `Show a live home screen with one pane for each status source:
+  - Deployment:    the booted, staged, and rollback bootc deployments
+  - Last Build:    the images, pushes, and disks in build-manifest.json
+  - Devcontainers: running and stopped devcontainers on this host
+  - Apps:          install status of the Brewfile and Flatpak catalogs
+  - Recent Logs:   the newest session logs and the end of the last one
+
+The build panes read the project in the current directory or given with -C.
+Panes reload every --refresh interval and on r. Move between panes with
+tab and shift+tab or the arrow keys, and press enter to expand one.
+
+With --plain or --json the status is printed once instead.
+
+Examples:
+  galena dashboard
+  galena dashboard -C ~/src/my-os --refresh 10s
+  galena dashboard --json`,
+	Args: cobra.NoArgs,
+	RunE: runDashboard,
+}
+
+func init() {
+	dashboardCmd.Flags().DurationVar(&dashboardRefresh, "refresh", 30*time.Second, "How often the panes reload (0 to reload only on r)")
+}
+
+// dashboardStatus is everything the dashboard shows, loaded at once
+type dashboardStatus struct {
+	Loaded time.Time `json:"loaded"`
+
+	Deployment      *bootc.Host `json:"deployment,omitempty"`
+	DeploymentError string      `json:"deployment_error,omitempty"`
+
+	Project       string                 `json:"project,omitempty"`
+	Manifest      *version.BuildManifest `json:"manifest,omitempty"`
+	ManifestError string                 `json:"manifest_error,omitempty"`
+
+	Devcontainers      []discoveredDevcontainer `json:"devcontainers"`
+	DevcontainersError string                   `json:"devcontainers_error,omitempty"`
+
+	Catalogs []catalogCoverage `json:"catalogs"`
+
+	Sessions      []build.SessionInfo `json:"sessions"`
+	SessionsError string              `json:"sessions_error,omitempty"`
+	LogTail       string              `json:"log_tail,omitempty"`
+}
+
+// loadDashboardStatus reads every status source concurrently. Failures are
+// recorded per source so one broken pane does not hide the others.
+func loadDashboardStatus(ctx context.Context) dashboardStatus {
+	status := dashboardStatus{
+		Devcontainers: []discoveredDevcontainer{},
+		Catalogs:      make([]catalogCoverage, 2),
+		Sessions:      []build.SessionInfo{},
+	}
+	var wg sync.WaitGroup
+	run := func(load func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			load()
+		}()
+	}
+
+	run(func() {
+		// bootc.Status rather than loadHostStatus: a password prompt cannot
+		// be answered from inside the dashboard
+		host, err := bootc.Status(ctx)
+		if err != nil {
+			status.DeploymentError = err.Error()
+			return
+		}
+		status.Deployment = host
+	})
+	run(func() {
+		containers, err := discoverDevcontainers(ctx)
+		if err != nil {
+			status.DevcontainersError = err.Error()
+		}
+		if containers != nil {
+			status.Devcontainers = containers
+		}
+	})
+	run(func() { status.Catalogs[0] = loadCatalogCoverage(catalogKindBrew) })
+	run(func() { status.Catalogs[1] = loadCatalogCoverage(catalogKindFlatpak) })
+
+	rootDir, err := dashboardProjectRoot()
+	if err != nil {
+		status.ManifestError = "not in a Galena project; pass -C <dir> to show its builds"
+		status.SessionsError = status.ManifestError
+	} else {
+		status.Project = rootDir
+		run(func() {
+			manifest, err := version.LoadManifest(filepath.Join(rootDir, "build-manifest.json"))
+			if errors.Is(err, fs.ErrNotExist) {
+				status.ManifestError = "no build-manifest.json yet; build with galena-build build"
+				return
+			}
+			if err != nil {
+				status.ManifestError = err.Error()
+				return
+			}
+			status.Manifest = manifest
+		})
+		run(func() {
+			sessions, err := build.ListSessions(rootDir)
+			if err != nil {
+				status.SessionsError = err.Error()
+				return
+			}
+			status.Sessions = sessions
+			if len(sessions) == 0 {
+				return
+			}
+			tail, err := readLogTail(sessions[0].Path, dashboardLogLines)
+			if err != nil {
+				status.SessionsError = err.Error()
+				return
+			}
+			status.LogTail = tail
+		})
+	}
+
+	wg.Wait()
+	status.Loaded = time.Now()
+	return status
+}
+
+// dashboardProjectRoot returns the project root when there is a project:
+// without galena.yaml getProjectRoot falls back to the working directory
+func dashboardProjectRoot() (string, error) {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return "", err
+	}
+	path, err := projectConfigPath()
+	if err != nil {
+		return "", err
+	}
+	if !markerPresent(path) {
+		return "", fmt.Errorf("no %s", path)
+	}
+	return rootDir, nil
+}
+
+// readLogTail returns the last n lines of a log without reading all of it
+func readLogTail(path string, n int) (string, error) {
+	const window = 64 << 10
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening session log: %w", err)
+	}
+	defer file.Close()
+	if fi, err := file.Stat(); err == nil && fi.Size() > window {
+		if _, err := file.Seek(-window, io.SeekEnd); err != nil {
+			return "", fmt.Errorf("reading session log: %w", err)
+		}
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("reading session log: %w", err)
+	}
+	return galexec.LastNLines(string(data), n), nil
+}
+
+func runDashboard(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if cmd != nil && cmd.Context() != nil {
+		ctx = cmd.Context()
+	}
+	if output.IsJSON() || !ui.IsInteractiveTerminal() {
+		status := loadDashboardStatus(ctx)
+		return output.Render("dashboard", status, nil, func() { printDashboardStatus(status) })
+	}
+
+	p := tea.NewProgram(newDashboardModel(ctx, dashboardRefresh))
+	_, err := p.Run()
+	return err
+}
+
+// printDashboardStatus prints the panes one after another, for plain mode
+func printDashboardStatus(status dashboardStatus) {
+	for _, pane := range dashboardPanes {
+		fmt.Println(ui.Title.Render(pane.title))
+		for _, line := range pane.render(status) {
+			fmt.Println("  " + line)
+		}
+	}
+}
+
+// dashboardPane is one pane of the dashboard and how to render its lines
+type dashboardPane struct {
+	title  string
+	render func(status dashboardStatus) []string
+}
+
+var dashboardPanes = []dashboardPane{
+	{"Deployment", renderDeploymentPane},
+	{"Last Build", renderBuildPane},
+	{"Devcontainers", renderDevcontainersPane},
+	{"Apps", renderAppsPane},
+	{"Recent Logs", renderLogsPane},
+}
+
+// dashboardLogsPane is the index of the logs pane, which spans the bottom row
+const dashboardLogsPane = 4
+
+func renderDeploymentPane(status dashboardStatus) []string {
+	if status.DeploymentError != "" {
+		return []string{ui.MutedStyle.Render("bootc status unavailable: " + status.DeploymentError)}
+	}
+	host := status.Deployment
+	lines := []string{}
+	if host.Spec.Image != nil {
+		lines = append(lines, dashboardKV("Tracking", host.Spec.Image.Image))
+	}
+	pending := ui.SuccessStyle.Render("up to date")
+	switch {
+	case host.Status.Staged != nil:
+		pending = ui.WarningStyle.Render("update staged for next boot")
+	case host.PendingDigest() != "":
+		pending = ui.WarningStyle.Render("update available " + bootc.ShortDigest(host.PendingDigest()))
+	}
+	lines = append(lines, dashboardKV("Updates", pending))
+	if host.Status.RollbackQueued {
+		lines = append(lines, dashboardKV("Next Boot", ui.WarningStyle.Render("rollback")))
+	}
+	for _, d := range host.Deployments() {
+		role := strings.ToUpper(d.Role[:1]) + d.Role[1:]
+		if d.Entry.Pinned {
+			role += " (pinned)"
+		}
+		lines = append(lines, "", ui.PanelTitle.Render(role))
+		if d.Entry.Image == nil {
+			lines = append(lines, ui.MutedStyle.Render("not an image deployment"))
+			continue
+		}
+		image := d.Entry.Image
+		lines = append(lines,
+			dashboardKV("Image", image.Image.Image),
+			dashboardKV("Version", defaultIfEmpty(image.Version, "-")),
+			dashboardKV("Digest", bootc.ShortDigest(image.ImageDigest)),
+		)
+		if image.Timestamp != nil {
+			lines = append(lines, dashboardKV("Built", image.Timestamp.Local().Format("2006-01-02 15:04")))
+		}
+	}
+	return lines
+}
+
+func renderBuildPane(status dashboardStatus) []string {
+	if status.Manifest == nil {
+		return []string{ui.MutedStyle.Render(status.ManifestError)}
+	}
+	m := status.Manifest
+	lines := []string{
+		dashboardKV("Project", m.Project),
+		dashboardKV("Version", m.Version.Version),
+		dashboardKV("Built", m.GeneratedAt.Local().Format("2006-01-02 15:04")),
+	}
+	if m.Version.GitCommit != "" {
+		commit := m.Version.GitCommit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if m.Version.GitDirty {
+			commit += " (dirty)"
+		}
+		lines = append(lines, dashboardKV("Commit", commit))
+	}
+	if len(m.Images) > 0 {
+		lines = append(lines, "", ui.PanelTitle.Render("Images"))
+	}
+	for _, image := range m.Images {
+		state := ui.StatusSuccess.String()
+		details := bootc.ShortDigest(image.Digest)
+		if image.Status == "failed" {
+			state = ui.StatusError.String()
+			details = image.Error
+		}
+		lines = append(lines, fmt.Sprintf("%s %s:%s %s", state, image.Name, image.Tag, ui.MutedStyle.Render(details)))
+	}
+	if len(m.Pushes) > 0 {
+		lines = append(lines, "", ui.PanelTitle.Render("Pushes"))
+	}
+	for _, push := range m.Pushes {
+		state := ui.StatusSuccess.String()
+		if push.Status != "pushed" {
+			state = ui.StatusError.String()
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", state, push.Registry, ui.MutedStyle.Render(push.Status)))
+	}
+	if len(m.Disks) > 0 {
+		lines = append(lines, "", ui.PanelTitle.Render("Disks"))
+	}
+	for _, disk := range m.Disks {
+		lines = append(lines, fmt.Sprintf("%s %s %s", disk.Type, filepath.Base(disk.Path), ui.MutedStyle.Render(formatBytes(disk.Size))))
+	}
+	return lines
+}
+
+func renderDevcontainersPane(status dashboardStatus) []string {
+	var lines []string
+	if status.DevcontainersError != "" {
+		lines = append(lines, ui.WarningStyle.Render("Could not discover devcontainers: "+status.DevcontainersError))
+	}
+	if len(status.Devcontainers) == 0 && status.DevcontainersError == "" {
+		lines = append(lines, ui.MutedStyle.Render("No devcontainers; create one with galena dev init"))
+	}
+	for _, entry := range status.Devcontainers {
+		state := ui.MutedStyle.Render(fmt.Sprintf("%-8s", entry.State))
+		if strings.EqualFold(entry.State, "running") {
+			state = ui.SuccessStyle.Render(fmt.Sprintf("%-8s", entry.State))
+		}
+		workspace := defaultIfEmpty(entry.Workspace, "(workspace label unavailable)")
+		lines = append(lines, fmt.Sprintf("%s %s %s", state, entry.Name, ui.MutedStyle.Render(workspace)))
+	}
+	return lines
+}
+
+func renderAppsPane(status dashboardStatus) []string {
+	lines := []string{
+		dashboardKV("Setup", markerStatus(statePath("setup.done"))),
+		dashboardKV("Dev Mode", readStateValue(statePath("dev-mode"), "host-only")),
+		"",
+	}
+	missing := false
+	for _, coverage := range status.Catalogs {
+		label := "Brew"
+		if coverage.Kind == catalogKindFlatpak {
+			label = "Flatpak"
+		}
+		if coverage.Error != "" {
+			lines = append(lines, dashboardKV(label, ui.MutedStyle.Render("unavailable ("+coverage.Error+")")))
+			continue
+		}
+		count := fmt.Sprintf("%d/%d installed", coverage.Installed, coverage.Total)
+		if coverage.Installed < coverage.Total {
+			missing = true
+			count = ui.WarningStyle.Render(count)
+		} else {
+			count = ui.SuccessStyle.Render(count)
+		}
+		lines = append(lines, dashboardKV(label, count))
+	}
+	if missing {
+		lines = append(lines, "", ui.MutedStyle.Render("Install the rest with galena apps install --missing"))
+	}
+	return lines
+}
+
+func renderLogsPane(status dashboardStatus) []string {
+	if len(status.Sessions) == 0 {
+		if status.SessionsError != "" {
+			return []string{ui.MutedStyle.Render(status.SessionsError)}
+		}
+		return []string{ui.MutedStyle.Render("No session logs yet; build, disk, and ci build write them")}
+	}
+	var lines []string
+	for i, s := range status.Sessions {
+		if i == 3 {
+			break
+		}
+		state := ui.StatusPending.String()
+		switch s.Status {
+		case "succeeded":
+			state = ui.StatusSuccess.String()
+		case "failed":
+			state = ui.StatusError.String()
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", state, s.Name, ui.MutedStyle.Render(s.Status)))
+	}
+	if status.SessionsError != "" {
+		lines = append(lines, ui.WarningStyle.Render(status.SessionsError))
+	}
+	if status.LogTail != "" {
+		lines = append(lines, "", ui.PanelTitle.Render(status.Sessions[0].Name))
+		for _, line := range strings.Split(strings.TrimRight(status.LogTail, "\n"), "\n") {
+			lines = append(lines, ui.MutedStyle.Render(line))
+		}
+	}
+	return lines
+}
+
+// dashboardKV formats a label and value like printKV, for a pane
+func dashboardKV(label, value string) string {
+	return ui.MutedStyle.Render(fmt.Sprintf("%-10s", label)) + " " + value
+}
+
+type dashboardLoadedMsg dashboardStatus
+
+type dashboardTickMsg time.Time
+
+// dashboardModel is the live dashboard: a grid of panes, one focused, that
+// can be expanded to fill the screen
+type dashboardModel struct {
+	ctx      context.Context
+	refresh  time.Duration
+	status   dashboardStatus
+	loaded   bool
+	loading  bool
+	focus    int
+	expanded bool
+	scroll   int
+	width    int
+	height   int
+}
+
+func newDashboardModel(ctx context.Context, refresh time.Duration) dashboardModel {
+	return dashboardModel{ctx: ctx, refresh: refresh, loading: true}
+}
+
+func (m dashboardModel) Init() tea.Cmd {
+	return m.load()
+}
+
+func (m dashboardModel) load() tea.Cmd {
+	ctx := m.ctx
+	return func() tea.Msg {
+		return dashboardLoadedMsg(loadDashboardStatus(ctx))
+	}
+}
+
+func (m dashboardModel) tick() tea.Cmd {
+	if m.refresh <= 0 {
+		return nil
+	}
+	return tea.Tick(m.refresh, func(t time.Time) tea.Msg {
+		return dashboardTickMsg(t)
+	})
+}
+
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	case dashboardLoadedMsg:
+		m.status = dashboardStatus(msg)
+		m.loaded = true
+		m.loading = false
+		return m, m.tick()
+	case dashboardTickMsg:
+		if m.loading {
+			return m, m.tick()
+		}
+		m.loading = true
+		return m, m.load()
+	case tea.KeyPressMsg:
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		case "esc":
+			if !m.expanded {
+				return m, tea.Quit
+			}
+			m.expanded = false
+		case "r":
+			if !m.loading {
+				m.loading = true
+				return m, m.load()
+			}
+		case "enter", "space":
+			m.expanded = !m.expanded
+			m.scroll = 0
+		case "tab", "right", "l":
+			m.focus = (m.focus + 1) % len(dashboardPanes)
+			m.scroll = 0
+		case "shift+tab", "left", "h":
+			m.focus = (m.focus + len(dashboardPanes) - 1) % len(dashboardPanes)
+			m.scroll = 0
+		case "down", "j":
+			if m.expanded {
+				m.scrollBy(1)
+			} else {
+				m.focus = min(m.focus+2, len(dashboardPanes)-1)
+			}
+		case "up", "k":
+			if m.expanded {
+				m.scrollBy(-1)
+			} else if m.focus == dashboardLogsPane {
+				m.focus -= 2
+			} else {
+				m.focus = max(m.focus-2, 0)
+			}
+		}
+	}
+	return m, nil
+}
+
+// scrollBy moves the expanded pane down (positive) or up by lines. The
+// logs pane counts its scroll back from the end of the log.
+func (m *dashboardModel) scrollBy(lines int) {
+	if !m.loaded {
+		return
+	}
+	if m.focus == dashboardLogsPane {
+		lines = -lines
+	}
+	total := len(dashboardPanes[m.focus].render(m.status))
+	m.scroll = min(max(m.scroll+lines, 0), max(total-1, 0))
+}
+
+func (m dashboardModel) View() tea.View {
+	start := time.Now()
+	width := m.width
+	if width <= 0 {
+		width = 100
+	}
+	height := m.height
+	if height <= 0 {
+		height = 30
+	}
+
+	state := "loaded " + m.status.Loaded.Format("15:04:05")
+	if m.loading {
+		state = "loading…"
+	}
+	header := ui.Header("dashboard")
+	subtitle := ui.MutedStyle.Render(defaultIfEmpty(m.status.Project, "no project") + " · " + state)
+	help := ui.HintStyle.Render("tab/←→ move · enter expand · r refresh · q quit")
+	if m.expanded {
+		help = ui.HintStyle.Render("↑↓ scroll · enter/esc back · r refresh · q quit")
+	}
+
+	bodyHeight := max(height-lipgloss.Height(header)-3, 6)
+	var body string
+	switch {
+	case m.expanded:
+		body = m.renderPane(m.focus, width, bodyHeight, m.scroll)
+	case width < 90:
+		// Too narrow for two columns: only the focused pane and a tab bar
+		tabs := make([]string, len(dashboardPanes))
+		for i, pane := range dashboardPanes {
+			tabs[i] = ui.MutedStyle.Render(pane.title)
+			if i == m.focus {
+				tabs[i] = ui.PrimaryStyle().Render(pane.title)
+			}
+		}
+		body = lipgloss.JoinVertical(lipgloss.Left,
+			strings.Join(tabs, ui.MutedStyle.Render(" · ")),
+			m.renderPane(m.focus, width, bodyHeight-1, 0),
+		)
+	default:
+		left := width / 2
+		right := width - left
+		rowHeight := bodyHeight / 3
+		logsHeight := bodyHeight - 2*rowHeight
+		body = lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Top, m.renderPane(0, left, rowHeight, 0), m.renderPane(1, right, rowHeight, 0)),
+			lipgloss.JoinHorizontal(lipgloss.Top, m.renderPane(2, left, rowHeight, 0), m.renderPane(3, right, rowHeight, 0)),
+			m.renderPane(dashboardLogsPane, width, logsHeight, 0),
+		)
+	}
+
+	screen := lipgloss.JoinVertical(lipgloss.Left, header, subtitle, body, help)
+	if status := ui.DebugStatus("dashboard", width, height, time.Since(start)); status != "" {
+		screen = lipgloss.JoinVertical(lipgloss.Left, screen, status)
+	}
+	v := tea.NewView(screen)
+	v.AltScreen = true
+	v.WindowTitle = "Galena Dashboard"
+	return v
+}
+
+// renderPane draws pane i in a bordered box of the given outer size. The
+// logs pane shows its last lines; the others their first, from scroll on.
+func (m dashboardModel) renderPane(i, width, height, scroll int) string {
+	pane := dashboardPanes[i]
+	innerWidth := max(width-4, 10)
+	innerHeight := max(height-3, 1)
+
+	var lines []string
+	if m.loaded {
+		lines = pane.render(m.status)
+	} else {
+		lines = []string{ui.MutedStyle.Render("loading…")}
+	}
+	if len(lines) > innerHeight {
+		if i == dashboardLogsPane {
+			// Follow the end of the log, scrolling back from there
+			end := max(len(lines)-scroll, innerHeight)
+			lines = lines[end-innerHeight : end]
+		} else {
+			offset := min(scroll, len(lines)-innerHeight)
+			lines = lines[offset : offset+innerHeight]
+		}
+	}
+	for j, line := range lines {
+		lines[j] = ansi.Truncate(line, innerWidth, "…")
+	}
+
+	title := ui.MutedStyle.Bold(true).Render(pane.title)
+	border := ui.Border
+	if i == m.focus {
+		title = ui.PanelTitle.Render(pane.title)
+		border = ui.Primary
+	}
+	content := lipgloss.JoinVertical(lipgloss.Left, title, strings.Join(lines, "\n"))
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(border).
+		Padding(0, 1).
+		Width(width - 2).
+		Height(height - 2).
+		MaxHeight(height).
+		Render(content)
+}
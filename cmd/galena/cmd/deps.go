@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	depsCheckFail bool
+)
+
+var depsCmd = &cobra.Command{
+	Use:   "deps",
+	Short: "Manage pinned base image and dependency digests",
+	Long: `Manage the digests pinned for build.base_image and the images listed
+under dependencies in galena.yaml.`,
+}
+
+var depsUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Resolve dependency tags to their current digests",
+	Long: `Resolve the tag of build.base_image and of every dependency to its
+current digest and record it in galena.yaml.
+
+Digests are resolved with skopeo when installed, otherwise through the
+registry API with an anonymous pull token. A diff of every changed digest
+is shown before galena.yaml is rewritten.
+
+Examples:
+  galena-build deps update
+  galena-build deps update --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: runDepsUpdate,
+}
+
+var depsCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report pinned digests that are behind their tags",
+	Long: `Compare the digests pinned for build.base_image and every dependency
+with the current digests of their tags, without changing galena.yaml.
+
+Stale dependencies are listed with the creation dates of the pinned and the
+current digest, the version label of the current image, and a link to the
+release notes of its source repository (dates and links need skopeo).
+
+Meant for a scheduled workflow: --json prints a report to build a pull
+request from, and in CI the stale output holds the number of stale
+dependencies. Apply the updates with deps update.
+
+Examples:
+  galena-build deps check
+  galena-build deps check --json
+  galena-build deps check --exit-code`,
+	Args: cobra.NoArgs,
+	RunE: runDepsCheck,
+}
+
+func init() {
+	depsCmd.AddCommand(depsUpdateCmd)
+	depsCmd.AddCommand(depsCheckCmd)
+
+	depsCheckCmd.Flags().BoolVar(&depsCheckFail, "exit-code", false, "Exit with an error when a dependency is stale")
+}
+
+func runDepsUpdate(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	logger.Info("resolving dependency digests")
+	updates, err := build.ResolveDependencies(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, u := range updates {
+		if u.Changed() {
+			changed++
+		}
+	}
+	if changed == 0 {
+		fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("All %d dependencies are pinned to their current digests.", len(updates))))
+		return nil
+	}
+
+	fmt.Println(ui.InfoBox.Render(fmt.Sprintf("Dependency Updates (%d of %d)\n\n%s", changed, len(updates), formatDependencyDiff(updates))))
+	if dryRun {
+		return nil
+	}
+
+	path := cfgFile
+	if path == "" {
+		path, err = config.GetConfigPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := build.ApplyDependencyUpdates(path, updates); err != nil {
+		return err
+	}
+
+	logger.Info("pinned dependency digests", "path", path, "updated", changed)
+	return nil
+}
+
+func formatDependencyDiff(updates []build.DependencyUpdate) string {
+	var b strings.Builder
+	for _, u := range updates {
+		if !u.Changed() {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s %s\n", u.Name, ui.MutedStyle.Render(u.Image+":"+u.Tag))
+		fmt.Fprintf(&b, "  %s\n", ui.ErrorStyle.Render("- "+defaultIfEmpty(u.OldDigest, "(unpinned)")))
+		fmt.Fprintf(&b, "  %s\n", ui.SuccessStyle.Render("+ "+u.NewDigest))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func runDepsCheck(cmd *cobra.Command, args []string) error {
+	ctx, cancel := interruptibleContext()
+	defer cancel()
+
+	logger.Info("checking dependency digests")
+	statuses, err := build.CheckDependencies(ctx, cfg)
+	stale := 0
+	for _, s := range statuses {
+		if s.Stale {
+			stale++
+		}
+	}
+	if err == nil {
+		setCIOutput("stale", strconv.Itoa(stale))
+		if depsCheckFail && stale > 0 {
+			err = fmt.Errorf("%d of %d dependencies are stale (run deps update)", stale, len(statuses))
+		}
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("deps check", map[string]any{"stale": stale, "dependencies": statuses}, err)
+	}
+	if statuses == nil {
+		return err
+	}
+
+	fmt.Println()
+	for _, s := range statuses {
+		if !s.Stale {
+			fmt.Printf("%s %s %s\n", ui.SuccessStyle.Render("✓"), s.Name, ui.MutedStyle.Render(s.Image+":"+s.Tag))
+			continue
+		}
+		fmt.Printf("%s %s %s\n", ui.WarningStyle.Render("!"), s.Name, ui.MutedStyle.Render(s.Image+":"+s.Tag))
+		printKV("Pinned", defaultIfEmpty(s.PinnedDigest, "(unpinned)")+formatCreated(s.PinnedCreated))
+		printKV("Current", s.CurrentDigest+formatCreated(s.CurrentCreated))
+		if s.CurrentVersion != "" {
+			printKV("Version", s.CurrentVersion)
+		}
+		if s.ReleaseNotes != "" {
+			printKV("Release notes", s.ReleaseNotes)
+		}
+	}
+	fmt.Println()
+	if stale == 0 {
+		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("All %d dependencies are pinned to their current digests.", len(statuses))))
+	} else {
+		fmt.Println(ui.WarningStyle.Render(fmt.Sprintf("%d of %d dependencies are stale; run deps update to pin them.", stale, len(statuses))))
+	}
+	return err
+}
+
+// formatCreated renders an optional image creation date after a digest
+func formatCreated(created *time.Time) string {
+	if created == nil {
+		return ""
+	}
+	return " (" + created.Format("2006-01-02") + ")"
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	diffVariant  string
+	diffOnly     []string
+	diffLimit    int
+	diffMarkdown bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <imageA> <imageB>",
+	Short: "Compare the contents of two images",
+	Long: `Compare two images and report what was added, removed, or changed
+between them:
+  - rpms:      installed RPM packages and versions
+  - flatpaks:  flatpak preinstalls and branches
+  - files:     files under /usr and /etc (changed when the size differs)
+  - labels:    OCI image labels
+
+An argument without a registry, tag, or digest is a tag of the configured
+image; a sha256: digest selects that digest of the configured image. Images
+missing locally are pulled.
+
+Examples:
+  # Changes between two releases, as release notes
+  galena-build diff stable.20250101 stable.20250201 --markdown
+
+  # Only package changes of the nvidia variant
+  galena-build diff stable latest --variant nvidia --only rpms
+
+  # Any two images
+  galena-build diff ghcr.io/acme/galena:stable localhost/galena:latest`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDiff,
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffVariant, "variant", "V", "main", "Variant used to resolve bare tags and digests")
+	diffCmd.Flags().StringSliceVar(&diffOnly, "only", nil, "Sections to compare ("+strings.Join(build.DiffSections(), ", ")+")")
+	diffCmd.Flags().IntVar(&diffLimit, "limit", 50, "Entries listed per change type and section (0 for all)")
+	diffCmd.Flags().BoolVar(&diffMarkdown, "markdown", false, "Print the report as Markdown for release notes")
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "diff"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	from := resolveDiffImage(args[0])
+	to := resolveDiffImage(args[1])
+
+	builder := build.NewBuilder(cfg, rootDir, logger)
+	diff, err := builder.DiffImages(ctx, from, to, diffOnly)
+	if err != nil {
+		return output.EmitSummary("diff", nil, err)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("diff", diff, nil)
+	}
+
+	if diffMarkdown {
+		fmt.Print(formatDiffMarkdown(diff))
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println(ui.MutedStyle.Render(fmt.Sprintf("%s → %s", diff.From, diff.To)))
+	for _, section := range diff.Sections {
+		fmt.Println()
+		fmt.Println(ui.Title.Render(fmt.Sprintf("%s (+%d -%d ~%d)", section.Section, len(section.Added), len(section.Removed), len(section.Changed))))
+		if section.Empty() {
+			fmt.Println(ui.MutedStyle.Render("  No changes"))
+			continue
+		}
+		printDiffChanges(section.Added, func(c build.Change) string {
+			return ui.SuccessStyle.Render("  + "+c.Key) + " " + ui.MutedStyle.Render(c.To)
+		})
+		printDiffChanges(section.Removed, func(c build.Change) string {
+			return ui.ErrorStyle.Render("  - "+c.Key) + " " + ui.MutedStyle.Render(c.From)
+		})
+		printDiffChanges(section.Changed, func(c build.Change) string {
+			return ui.WarningStyle.Render("  ~ "+c.Key) + " " + ui.MutedStyle.Render(c.From+" → "+c.To)
+		})
+	}
+	return nil
+}
+
+// resolveDiffImage turns a bare tag or digest into a reference of the configured image
+func resolveDiffImage(arg string) string {
+	switch {
+	case strings.HasPrefix(arg, "sha256:"):
+		ref := cfg.ImageRef(diffVariant, "latest")
+		return strings.TrimSuffix(ref, ":latest") + "@" + arg
+	case strings.ContainsAny(arg, "/:@"):
+		return arg
+	default:
+		return cfg.ImageRef(diffVariant, arg)
+	}
+}
+
+func printDiffChanges(changes []build.Change, format func(build.Change) string) {
+	shown := changes
+	if diffLimit > 0 && len(shown) > diffLimit {
+		shown = shown[:diffLimit]
+	}
+	for _, c := range shown {
+		fmt.Println(format(c))
+	}
+	if len(shown) < len(changes) {
+		fmt.Println(ui.MutedStyle.Render(fmt.Sprintf("    … %d more", len(changes)-len(shown))))
+	}
+}
+
+func formatDiffMarkdown(diff *build.ImageDiff) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Changes from `%s` to `%s`\n", diff.From, diff.To)
+	for _, section := range diff.Sections {
+		fmt.Fprintf(&b, "\n### %s\n\n", section.Section)
+		if section.Empty() {
+			b.WriteString("No changes.\n")
+			continue
+		}
+		writeList := func(title string, changes []build.Change, format func(build.Change) string) {
+			if len(changes) == 0 {
+				return
+			}
+			fmt.Fprintf(&b, "**%s**\n\n", title)
+			shown := changes
+			if diffLimit > 0 && len(shown) > diffLimit {
+				shown = shown[:diffLimit]
+			}
+			for _, c := range shown {
+				b.WriteString("- " + format(c) + "\n")
+			}
+			if len(shown) < len(changes) {
+				fmt.Fprintf(&b, "- … %d more\n", len(changes)-len(shown))
+			}
+			b.WriteString("\n")
+		}
+		writeList("Added", section.Added, func(c build.Change) string {
+			return fmt.Sprintf("`%s` %s", c.Key, c.To)
+		})
+		writeList("Removed", section.Removed, func(c build.Change) string {
+			return fmt.Sprintf("`%s` %s", c.Key, c.From)
+		})
+		writeList("Changed", section.Changed, func(c build.Change) string {
+			return fmt.Sprintf("`%s` %s → %s", c.Key, c.From, c.To)
+		})
+	}
+	return b.String()
+}
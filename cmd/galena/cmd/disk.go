@@ -4,13 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/spf13/cobra"
 
 	"github.com/iiroan/galena/internal/build"
 	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
 	"github.com/iiroan/galena/internal/ui"
+	"github.com/iiroan/galena/internal/version"
 )
 
 var (
@@ -20,6 +25,14 @@ var (
 	diskRootFS      string
 	diskUseJust     bool
 	diskInteractive bool
+	diskNoChecksums bool
+	diskSignSums    string
+	diskKickstart   string
+	diskUseLibrepo  bool
+	diskForce       bool
+	diskTargetArch  string
+	diskEncrypt     string
+	diskLUKSEnv     string
 )
 
 var diskCmd = &cobra.Command{
@@ -27,6 +40,10 @@ var diskCmd = &cobra.Command{
 	Short: "Build bootable disk images (qcow2, raw, iso)",
 	Long: `Build bootable disk images using bootc-image-builder.
 
+An image is not rebuilt when the source image, disk config, kickstart, and
+options match the previous build of the same type in the output directory;
+--force rebuilds it anyway.
+
 Supported output types:
   qcow2           - QCOW2 disk image (for QEMU/KVM)
   raw             - Raw disk image
@@ -35,6 +52,10 @@ Supported output types:
   ami             - Amazon Machine Image
   anaconda-iso    - Anaconda-based installer ISO
   bootc-installer - Bootc installer ISO
+  vhd             - Virtual Hard Disk (Hyper-V)
+  gce             - Google Compute Engine image tarball (image.tar.gz)
+  azure           - Fixed-size VHD for Azure (requires qemu-img)
+  oci-cloud       - QCOW2 image for Oracle Cloud Infrastructure import
 
 Examples:
   # Build a QCOW2 image for VM testing
@@ -43,6 +64,9 @@ Examples:
   # Build an ISO installer
   galena-build disk iso
 
+  # Build an image for Google Compute Engine
+  galena-build disk gce
+
   # Build with a specific image reference
   galena-build disk qcow2 --image ghcr.io/myorg/myimage:stable
 
@@ -50,7 +74,25 @@ Examples:
   galena-build disk qcow2 --output ./images
 
   # Use existing Justfile recipes
-  galena-build disk qcow2 --just`,
+  galena-build disk qcow2 --just
+
+  # Build an ARM image on an x86 host (needs qemu-user-static)
+  galena-build disk raw --target-arch aarch64 --image ghcr.io/myorg/myimage:stable
+
+  # Installer that encrypts the root filesystem and unlocks it with the TPM
+  galena-build disk anaconda-iso --encrypt tpm2
+
+  # Rebuild an unchanged image
+  galena-build disk iso --force
+
+  # Build an unattended installer from a kickstart
+  galena-build disk anaconda-iso --kickstart ks.cfg
+
+  # Sign the SHA256SUMS of an ISO with GPG
+  galena-build disk iso --sign-checksums gpg
+
+  # Generate iso/disk.toml with users, SSH keys and sizes
+  galena-build disk config init`,
 	Args:      cobra.ExactArgs(1),
 	ValidArgs: build.ListOutputTypes(),
 	RunE:      runDisk,
@@ -60,12 +102,21 @@ func init() {
 	diskCmd.Flags().StringVar(&diskImage, "image", "", "Source container image (default: local build)")
 	diskCmd.Flags().StringVarP(&diskOutputDir, "output", "o", "", "Output directory (default: ./output)")
 	diskCmd.Flags().StringVar(&diskConfigFile, "config", "", "Disk config TOML file")
-	diskCmd.Flags().StringVar(&diskRootFS, "rootfs", "ext4", "Root filesystem type (ext4, xfs, btrfs)")
+	diskCmd.Flags().StringVar(&diskRootFS, "rootfs", "btrfs", "Root filesystem type (btrfs, ext4, xfs; empty for the image default)")
+	diskCmd.Flags().BoolVar(&diskUseLibrepo, "use-librepo", true, "Download packages with librepo")
 	diskCmd.Flags().BoolVar(&diskUseJust, "just", false, "Use existing Justfile recipes")
 	diskCmd.Flags().BoolVarP(&diskInteractive, "interactive", "i", false, "Interactive mode")
+	diskCmd.Flags().StringVar(&diskKickstart, "kickstart", "", "Kickstart file embedded in installer ISOs for unattended installs")
+	diskCmd.Flags().StringVar(&diskEncrypt, "encrypt", "", "Encrypt the root filesystem of installer ISOs (luks, tpm2)")
+	diskCmd.Flags().StringVar(&diskLUKSEnv, "luks-passphrase-env", "", "Unused; the installer asks for the LUKS passphrase")
+	_ = diskCmd.Flags().MarkDeprecated("luks-passphrase-env", "the installer asks for the LUKS passphrase, which is no longer part of the ISO")
+	diskCmd.Flags().StringVar(&diskTargetArch, "target-arch", "", "Architecture to build for (x86_64, aarch64; default: host)")
+	diskCmd.Flags().BoolVar(&diskForce, "force", false, "Rebuild even when the image and disk config are unchanged")
+	diskCmd.Flags().BoolVar(&diskNoChecksums, "no-checksums", false, "Skip writing SHA256SUMS and SHA512SUMS")
+	diskCmd.Flags().StringVar(&diskSignSums, "sign-checksums", "", "Sign SHA256SUMS with gpg or cosign (default: signing.checksums)")
 }
 
-func runDisk(cmd *cobra.Command, args []string) error {
+func runDisk(cmd *cobra.Command, args []string) (err error) {
 	ctx := context.Background()
 	outputType := args[0]
 
@@ -73,21 +124,37 @@ func runDisk(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("finding project root: %w", err)
 	}
-	if err := platform.RequireLinux("disk builds"); err != nil {
+	if err := platform.Require(platform.DiskBuilds, "disk builds"); err != nil {
 		return err
 	}
 
 	// Interactive mode
 	if diskInteractive {
+		if err := ui.RequireInteractive("disk --interactive", "--config, --rootfs, and --output"); err != nil {
+			return err
+		}
 		if err := promptDiskOptions(&outputType); err != nil {
 			if errors.Is(err, huh.ErrUserAborted) {
 				return nil
 			}
 			return err
 		}
+		if diskConfigFile == "" && !diskUseJust {
+			generated, err := promptGenerateDiskConfig(rootDir, outputType)
+			if err != nil {
+				if errors.Is(err, huh.ErrUserAborted) {
+					return nil
+				}
+				return err
+			}
+			diskConfigFile = generated
+		}
 	}
 
-	diskBuilder := build.NewDiskBuilder(cfg, rootDir, logger)
+	session := startSession(rootDir, "disk")
+	defer func() { endSession(session, err) }()
+
+	diskBuilder := build.NewDiskBuilder(cfg, rootDir, logger).WithRootfulPodman()
 
 	// Use just if requested
 	if diskUseJust {
@@ -99,32 +166,117 @@ func runDisk(cmd *cobra.Command, args []string) error {
 	if imageRef == "" {
 		imageRef = cfg.ImageRef("main", "latest")
 	}
+	imageRef, err = ref.Normalize(imageRef)
+	if err != nil {
+		return err
+	}
 
 	opts := build.DefaultDiskOptions()
 	opts.ImageRef = imageRef
 	opts.OutputType = outputType
 	opts.OutputDir = diskOutputDir
 	opts.ConfigFile = diskConfigFile
-	if diskRootFS != "" {
-		opts.RootFSType = diskRootFS
+	opts.Kickstart = diskKickstart
+	opts.RootFSType = diskRootFS
+	opts.UseLibrepo = diskUseLibrepo
+	opts.Force = diskForce
+	opts.TargetArch = diskTargetArch
+	if diskEncrypt != "" {
+		opts.Encryption = &build.DiskEncryption{Mode: diskEncrypt}
 	}
 
+	started := time.Now()
 	outputPath, err := diskBuilder.Build(ctx, opts)
+	defer func() { notifyDisk(ctx, imageRef, outputType, outputPath, started, err) }()
 	if err != nil {
 		return err
 	}
+	if dryRun {
+		fmt.Println()
+		fmt.Println(dryRunBox("no disk image was built.", fmt.Sprintf("Type: %s\nOutput: %s", outputType, outputPath)))
+		return nil
+	}
+
+	summary := fmt.Sprintf("Disk image created successfully!\n\nType: %s\nOutput: %s", outputType, outputPath)
+	if !diskNoChecksums {
+		checksums, err := checksumDisk(ctx, rootDir, outputType, outputPath, opts.OutputDir)
+		if err != nil {
+			return err
+		}
+		if checksums != nil {
+			summary += "\nChecksums: " + checksums.SHA256Sums
+			if checksums.Signature != "" {
+				summary += "\nSignature: " + checksums.Signature
+			}
+		}
+	}
 
 	// Print success message
 	fmt.Println()
-	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf(
-		"Disk image created successfully!\n\nType: %s\nOutput: %s",
-		outputType,
-		outputPath,
-	)))
+	fmt.Println(ui.SuccessBox.Render(summary))
 
 	return nil
 }
 
+// checksumDisk writes the SHA256SUMS and SHA512SUMS of a disk image to the
+// output directory, signs SHA256SUMS when --sign-checksums or
+// signing.checksums asks for it, and records the image in the build
+// manifest of the last build. It returns nil when the image file is unknown.
+func checksumDisk(ctx context.Context, rootDir, outputType, outputPath, outputDir string) (*build.DiskChecksums, error) {
+	if info, err := os.Stat(outputPath); err != nil || info.IsDir() {
+		return nil, nil
+	}
+	if outputDir == "" {
+		outputDir = filepath.Join(rootDir, "output")
+	}
+
+	logger.Info("computing disk image checksums", "image", outputPath)
+	checksums, err := build.ChecksumDiskArtifacts(outputDir, outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	method := diskSignSums
+	if method == "" {
+		method = cfg.Signing.Checksums
+	}
+	if method != "" {
+		logger.Info("signing checksums", "file", checksums.SHA256Sums, "signer", method)
+		if err := checksums.Sign(ctx, method, build.NewSigner(rootDir, cfg.Signing), cfg.Signing.GPGKey); err != nil {
+			return nil, fmt.Errorf("signing checksums: %w", err)
+		}
+	}
+
+	manifestPath := filepath.Join(rootDir, "build-manifest.json")
+	manifest, err := version.LoadManifest(manifestPath)
+	if err != nil {
+		logger.Debug("no build manifest to record the disk image in", "error", err)
+		return checksums, nil
+	}
+	for _, sum := range checksums.Artifacts {
+		manifest.AddDisk(version.Disk{Type: outputType, Path: sum.Path, Size: sum.Size, SHA256: sum.SHA256, SHA512: sum.SHA512})
+	}
+	for _, path := range []string{checksums.SHA256Sums, checksums.SHA512Sums, checksums.Signature} {
+		if path != "" && !containsArtifact(manifest.Artifacts, path) {
+			manifest.AddArtifact(path)
+		}
+	}
+	if err := manifest.Save(manifestPath); err != nil {
+		logger.Warn("could not update manifest", "error", err)
+	}
+	return checksums, nil
+}
+
+// containsArtifact reports whether a manifest already lists an artifact
+func containsArtifact(artifacts []string, path string) bool {
+	for _, a := range artifacts {
+		if a == path {
+			return true
+		}
+	}
+	return false
+}
+
 func promptDiskOptions(outputType *string) error {
 	advancedMode := ui.CurrentPreferences.Advanced
 	typeOptions := make([]huh.Option[string], 0)
@@ -163,11 +315,15 @@ func promptDiskOptions(outputType *string) error {
 				Title("Root filesystem").
 				Description("Filesystem for the disk image").
 				Options(
+					huh.NewOption("btrfs", "btrfs"),
 					huh.NewOption("ext4", "ext4"),
 					huh.NewOption("xfs", "xfs"),
-					huh.NewOption("btrfs", "btrfs"),
 				).
 				Value(&diskRootFS),
+			huh.NewConfirm().
+				Title("Use librepo").
+				Description("Download packages with librepo").
+				Value(&diskUseLibrepo),
 			huh.NewConfirm().
 				Title("Use Justfile").
 				Description("Run disk build via existing Just recipes").
@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	diskConfigOutput   string
+	diskConfigForce    bool
+	diskConfigUser     string
+	diskConfigSSHKey   string
+	diskConfigGroups   []string
+	diskConfigRootSize string
+	diskConfigVarSize  string
+	diskConfigKargs    []string
+)
+
+var diskConfigCmd = &cobra.Command{
+	Use:   "config <command>",
+	Short: "Manage bootc-image-builder disk configs",
+	Long: `Manage the bootc-image-builder config used by disk builds.
+
+Subcommands:
+  init   - Generate a disk config with users, SSH keys, sizes and kernel args`,
+}
+
+var diskConfigInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a bootc-image-builder disk config",
+	Long: `Generate a bootc-image-builder TOML config instead of writing
+iso/disk.toml by hand. In a terminal a form asks for the user, SSH key,
+password, filesystem sizes, and kernel arguments; otherwise they come from
+flags. The config is validated before it is written.
+
+The SSH key may be a public key or the path of a .pub file, and defaults to
+the first key in ~/.ssh. Disk builds pick up iso/disk.toml automatically.
+
+Examples:
+  # Answer the questions in a form
+  galena-build disk config init
+
+  # Generate a config from flags
+  galena-build disk config init --user galena --ssh-key ~/.ssh/id_ed25519.pub --root-size "40 GiB"
+
+  # Write somewhere else, with extra kernel arguments
+  galena-build disk config init -o vm.toml --kargs console=ttyS0 --kargs quiet`,
+	Args: cobra.NoArgs,
+	RunE: runDiskConfigInit,
+}
+
+func init() {
+	diskCmd.AddCommand(diskConfigCmd)
+	diskConfigCmd.AddCommand(diskConfigInitCmd)
+
+	diskConfigInitCmd.Flags().StringVarP(&diskConfigOutput, "output", "o", "", "Config file path (default: iso/disk.toml)")
+	diskConfigInitCmd.Flags().BoolVarP(&diskConfigForce, "force", "f", false, "Overwrite an existing config")
+	diskConfigInitCmd.Flags().StringVar(&diskConfigUser, "user", "", "User to create")
+	diskConfigInitCmd.Flags().StringVar(&diskConfigSSHKey, "ssh-key", "", "SSH public key or .pub file (default: first key in ~/.ssh)")
+	diskConfigInitCmd.Flags().StringSliceVar(&diskConfigGroups, "groups", []string{"wheel"}, "Groups of the user")
+	diskConfigInitCmd.Flags().StringVar(&diskConfigRootSize, "root-size", "20 GiB", "Minimum size of the root filesystem")
+	diskConfigInitCmd.Flags().StringVar(&diskConfigVarSize, "var-size", "", "Minimum size of a separate /var filesystem")
+	diskConfigInitCmd.Flags().StringSliceVar(&diskConfigKargs, "kargs", nil, "Kernel arguments to append")
+}
+
+func runDiskConfigInit(cmd *cobra.Command, args []string) error {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	path := diskConfigOutput
+	if path == "" {
+		path = filepath.Join(rootDir, "iso", "disk.toml")
+	}
+	if _, err := os.Stat(path); err == nil && !diskConfigForce {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+	}
+
+	var diskConfig build.DiskConfig
+	if ui.IsInteractiveTerminal() && !output.IsJSON() && !cmd.Flags().Changed("user") {
+		diskConfig, err = promptDiskConfig()
+		if errors.Is(err, huh.ErrUserAborted) {
+			return nil
+		}
+	} else {
+		diskConfig, err = diskConfigFromFlags()
+	}
+	if err == nil {
+		err = writeDiskConfig(path, diskConfig)
+	}
+
+	if output.IsJSON() {
+		result := map[string]any{"path": path, "users": len(diskConfig.Users), "filesystems": diskConfig.Filesystems, "kernel_args": diskConfig.KernelArgs}
+		return output.EmitSummary("disk-config", result, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Disk config written!\n\nPath: %s\nUsers: %d\nFilesystems: %d\nKernel args: %s",
+		path, len(diskConfig.Users), len(diskConfig.Filesystems), defaultIfEmpty(strings.Join(diskConfig.KernelArgs, " "), "none"))))
+	return nil
+}
+
+// diskConfigFromFlags builds a disk config from the disk config init flags
+func diskConfigFromFlags() (build.DiskConfig, error) {
+	var c build.DiskConfig
+	if diskConfigUser != "" {
+		keyInput := diskConfigSSHKey
+		if keyInput == "" {
+			keyInput = build.DefaultSSHKeyPath()
+		}
+		var key string
+		if keyInput != "" {
+			var err error
+			if key, err = build.ReadSSHKey(keyInput); err != nil {
+				return c, err
+			}
+		}
+		c.Users = append(c.Users, build.DiskUser{Name: diskConfigUser, Key: key, Groups: diskConfigGroups})
+	}
+	c.Filesystems = diskFilesystems(diskConfigRootSize, diskConfigVarSize)
+	c.KernelArgs = diskConfigKargs
+	return c, nil
+}
+
+// diskFilesystems returns the filesystem sizes of a disk config, skipping empty sizes
+func diskFilesystems(rootSize, varSize string) []build.DiskFilesystem {
+	var filesystems []build.DiskFilesystem
+	if strings.TrimSpace(rootSize) != "" {
+		filesystems = append(filesystems, build.DiskFilesystem{Mountpoint: "/", MinSize: strings.TrimSpace(rootSize)})
+	}
+	if strings.TrimSpace(varSize) != "" {
+		filesystems = append(filesystems, build.DiskFilesystem{Mountpoint: "/var", MinSize: strings.TrimSpace(varSize)})
+	}
+	return filesystems
+}
+
+// promptDiskConfig asks for the users, sizes, and kernel arguments of a disk config
+func promptDiskConfig() (build.DiskConfig, error) {
+	var c build.DiskConfig
+	userName := ""
+	sshKey := build.DefaultSSHKeyPath()
+	password := ""
+	admin := true
+	rootSize := "20 GiB"
+	varSize := ""
+	kargs := ""
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("User").
+				Description("User to create (empty for none)").
+				Placeholder("galena").
+				Value(&userName).
+				Validate(func(value string) error {
+					if value == "" {
+						return nil
+					}
+					return build.ValidateDiskUserName(value)
+				}),
+			huh.NewInput().
+				Title("SSH key").
+				Description("Public key or .pub file").
+				Placeholder("~/.ssh/id_ed25519.pub").
+				Value(&sshKey).
+				Validate(func(value string) error {
+					if value == "" {
+						return nil
+					}
+					_, err := build.ReadSSHKey(value)
+					return err
+				}),
+			huh.NewInput().
+				Title("Password").
+				Description("Optional, plain text or a crypt(3) hash").
+				EchoMode(huh.EchoModePassword).
+				Value(&password),
+			huh.NewConfirm().
+				Title("Administrator").
+				Description("Add the user to the wheel group").
+				Value(&admin),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Root filesystem size").
+				Description("Minimum size of /").
+				Placeholder("20 GiB").
+				Value(&rootSize).
+				Validate(func(value string) error {
+					if value == "" {
+						return nil
+					}
+					return build.ValidateDiskSize(value)
+				}),
+			huh.NewInput().
+				Title("/var size").
+				Description("Minimum size of a separate /var (empty for none)").
+				Value(&varSize).
+				Validate(func(value string) error {
+					if value == "" {
+						return nil
+					}
+					return build.ValidateDiskSize(value)
+				}),
+			huh.NewInput().
+				Title("Kernel arguments").
+				Description("Space-separated, e.g. console=ttyS0 quiet").
+				Value(&kargs),
+		),
+	)
+	if err := form.WithTheme(ui.HuhTheme()).Run(); err != nil {
+		return c, err
+	}
+
+	if userName != "" {
+		user := build.DiskUser{Name: userName, Password: password}
+		if sshKey != "" {
+			key, err := build.ReadSSHKey(sshKey)
+			if err != nil {
+				return c, err
+			}
+			user.Key = key
+		}
+		if admin {
+			user.Groups = []string{"wheel"}
+		}
+		c.Users = append(c.Users, user)
+	}
+	c.Filesystems = diskFilesystems(rootSize, varSize)
+	c.KernelArgs = strings.Fields(kargs)
+	return c, nil
+}
+
+// writeDiskConfig validates a disk config and writes it as TOML
+func writeDiskConfig(path string, c build.DiskConfig) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid disk config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	// The config may hold a password, so it is only readable by the owner
+	if err := os.WriteFile(path, []byte(c.TOML()), 0o600); err != nil {
+		return fmt.Errorf("writing disk config: %w", err)
+	}
+	logger.Info("disk config written", "path", path)
+	return nil
+}
+
+// promptGenerateDiskConfig offers to generate iso/disk.toml from the disk
+// wizard. It returns the config path, or empty when the user declines or
+// the output type is an installer, which uses iso/iso.toml.
+func promptGenerateDiskConfig(rootDir, outputType string) (string, error) {
+	if outputType == "anaconda-iso" || outputType == "bootc-installer" {
+		return "", nil
+	}
+
+	path := filepath.Join(rootDir, "iso", "disk.toml")
+	description := "Create users, SSH keys, sizes and kernel args in iso/disk.toml"
+	if _, err := os.Stat(path); err == nil {
+		description = "Replaces the existing iso/disk.toml"
+	}
+	generate := false
+	confirm := huh.NewConfirm().
+		Title("Generate disk config").
+		Description(description).
+		Value(&generate)
+	if err := huh.NewForm(huh.NewGroup(confirm)).WithTheme(ui.HuhTheme()).Run(); err != nil || !generate {
+		return "", err
+	}
+
+	diskConfig, err := promptDiskConfig()
+	if err != nil {
+		return "", err
+	}
+	if err := writeDiskConfig(path, diskConfig); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	uploadProvider string
+	uploadName     string
+	uploadArch     string
+)
+
+var diskUploadCmd = &cobra.Command{
+	Use:   "upload <artifact>",
+	Short: "Import a disk image into a cloud",
+	Long: `Import a disk image into AWS, GCP, or Azure and print the image ID.
+
+The image is staged in the provider's object storage and imported with the
+provider CLI, which supplies the credentials:
+
+  aws    - raw, vhd, or vmdk image, imported as an EBS snapshot and registered
+           as an AMI (aws CLI, cloud.aws.bucket)
+  gcp    - image.tar.gz from galena-build disk gce, created as a GCE image
+           (gcloud CLI, cloud.gcp.bucket)
+  azure  - fixed VHD from galena-build disk azure, created as a managed image
+           (az CLI, cloud.azure.resource_group and storage_account)
+
+Examples:
+  # Register an AMI from a raw disk
+  galena-build disk upload output/image/disk.raw --provider aws
+
+  # Create a GCE image with a custom name
+  galena-build disk upload output/gce/image.tar.gz --provider gcp --name galena-43
+
+  # Create an Azure managed image
+  galena-build disk upload output/image/disk.vhd --provider azure`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDiskUpload,
+}
+
+func init() {
+	diskCmd.AddCommand(diskUploadCmd)
+	diskUploadCmd.Flags().StringVar(&uploadProvider, "provider", "", "Cloud provider (aws, gcp, azure)")
+	diskUploadCmd.Flags().StringVar(&uploadName, "name", "", "Image name (default: <project>-<timestamp>)")
+	diskUploadCmd.Flags().StringVar(&uploadArch, "arch", "x86_64", "Image architecture (x86_64, aarch64)")
+}
+
+func runDiskUpload(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if uploadProvider == "" {
+		return fmt.Errorf("--provider is required (%s)", strings.Join(config.CloudProviders(), ", "))
+	}
+
+	artifact, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(artifact); err != nil {
+		return fmt.Errorf("disk image: %w", err)
+	} else if info.IsDir() {
+		return fmt.Errorf("%s is a directory, pass the disk image file", artifact)
+	}
+
+	name := uploadName
+	if name == "" {
+		name = strings.ToLower(cfg.Name) + "-" + time.Now().UTC().Format("20060102-150405")
+	}
+
+	uploader := build.NewCloudUploader(cfg.Cloud, logger)
+	image, err := uploader.Upload(ctx, build.CloudUploadOptions{
+		Provider: uploadProvider,
+		Artifact: artifact,
+		Name:     name,
+		Arch:     uploadArch,
+	})
+	if output.IsJSON() {
+		return output.EmitSummary("disk-upload", image, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("Disk image imported!\n\nProvider: %s\nImage: %s\nID: %s", image.Provider, image.Name, image.ID)
+	if image.Region != "" {
+		summary += "\nRegion: " + image.Region
+	}
+	summary += "\nSource: " + image.Source
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
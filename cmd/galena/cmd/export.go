@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	exportFormat     string
+	exportFile       string
+	exportVariant    string
+	exportTag        string
+	exportSignatures bool
+	importRegistry   string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [image]",
+	Short: "Export an image bundle for disconnected networks",
+	Long: `Write an image into a single bundle that can be carried into a
+disconnected network. The bundle contains:
+  - the image as an oci-archive or docker-archive
+  - build-manifest.json from the project root, if present
+  - the cosign signatures and attestations of the image, if it was pushed
+  - bundle.json with sha256 checksums of every file
+
+Examples:
+  # Export the locally built main image
+  galena-build export -o galena.tar
+
+  # Export a signed release image from the registry
+  galena-build export ghcr.io/acme/galena:stable -o galena-stable.tar
+
+  # Export without signatures, in docker-archive format
+  galena-build export --variant nvidia --format docker-archive --signatures=false -o nvidia.tar`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExport,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Import an image bundle",
+	Long: `Verify the checksums of a bundle written by export and load its image
+into local storage under its original reference. The build manifest is
+written next to the bundle.
+
+With --registry, the image is also loaded into a registry reachable from
+the disconnected network together with its signatures, so it can be
+verified with cosign there.
+
+Examples:
+  # Load the image into local storage
+  galena-build import galena.tar
+
+  # Load into a local mirror and verify the signature
+  galena-build import galena.tar --registry registry.internal/galena
+  cosign verify --key cosign.pub registry.internal/galena:stable`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", exec.ArchiveOCI, "Archive format ("+exec.ArchiveOCI+" or "+exec.ArchiveDocker+")")
+	exportCmd.Flags().StringVarP(&exportFile, "file", "o", "", "Bundle file to write (default <image>-<tag>.tar)")
+	exportCmd.Flags().StringVarP(&exportVariant, "variant", "V", "main", "Image variant to export")
+	exportCmd.Flags().StringVarP(&exportTag, "tag", "t", "latest", "Image tag to export")
+	exportCmd.Flags().BoolVar(&exportSignatures, "signatures", true, "Include cosign signatures from the registry")
+
+	importCmd.Flags().StringVar(&importRegistry, "registry", "", "Registry repository to load the signed image into")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "export"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	imageRef := cfg.ImageRef(exportVariant, exportTag)
+	if len(args) > 0 {
+		imageRef = args[0]
+	}
+	file := exportFile
+	if file == "" {
+		file = bundleFileName(imageRef)
+	}
+
+	builder := build.NewBuilder(cfg, rootDir, logger)
+	info, err := builder.ExportBundle(ctx, build.ExportOptions{
+		Image:      imageRef,
+		Output:     file,
+		Format:     exportFormat,
+		Signatures: exportSignatures,
+	})
+	if output.IsJSON() {
+		return output.EmitSummary("export", info, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	summary := []string{
+		"Image: " + info.Image,
+		"Bundle: " + file,
+		"Format: " + info.Format,
+	}
+	if fi, err := os.Stat(file); err == nil {
+		summary = append(summary, "Size: "+formatBytes(fi.Size()))
+	}
+	if info.Signed {
+		summary = append(summary, "Signatures: included")
+	} else {
+		summary = append(summary, "Signatures: none")
+	}
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(strings.Join(summary, "\n")))
+	return nil
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "import"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	builder := build.NewBuilder(cfg, rootDir, logger)
+	info, err := builder.ImportBundle(ctx, build.ImportOptions{
+		Path:     args[0],
+		Registry: importRegistry,
+	})
+	if output.IsJSON() {
+		return output.EmitSummary("import", info, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	summary := []string{
+		"Image: " + info.Image,
+		"Built: " + info.CreatedAt.Format("2006-01-02 15:04 MST"),
+	}
+	if info.Digest != "" {
+		summary = append(summary, "Digest: "+info.Digest)
+	}
+	if importRegistry != "" {
+		summary = append(summary, "Registry: "+importRegistry)
+	}
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(strings.Join(summary, "\n")))
+	return nil
+}
+
+// bundleFileName derives a file name from an image reference
+func bundleFileName(imageRef string) string {
+	name := imageRef[strings.LastIndex(imageRef, "/")+1:]
+	name = strings.NewReplacer(":", "-", "@", "-").Replace(name)
+	return name + ".tar"
+}
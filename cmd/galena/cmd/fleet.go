@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	fleetVariant   string
+	fleetDigest    string
+	fleetHosts     int
+	fleetStart     string
+	fleetFormats   []string
+	fleetOutputDir string
+)
+
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Plan staged rollouts of a digest to many devices",
+	Long: `Plan and render staged rollouts from the channels: and fleet: sections
+of galena.yaml.
+
+A rollout moves the devices of a fleet to one digest of a channel in waves.
+Each wave reaches a share of the fleet a set time after the rollout starts;
+devices pick their wave from a stable bucket derived from their machine-id.
+Reboots can be serialized by a FleetLock server such as Airlock.
+
+Subcommands:
+  plan    - Show the waves of a rollout
+  render  - Write the rollout plan, device units, or Airlock config
+
+Examples:
+  galena-build fleet plan stable
+  galena-build fleet render stable --format plan,systemd,airlock
+  galena-build fleet render beta --variant nvidia --hosts 400`,
+}
+
+var fleetPlanCmd = &cobra.Command{
+	Use:   "plan <channel>",
+	Short: "Show the waves of a rollout",
+	Long: `Resolve the digest a channel points to and show when each wave of the
+rollout starts and how much of the fleet it reaches.
+
+Examples:
+  galena-build fleet plan stable
+  galena-build fleet plan stable --hosts 250 --start 2026-11-02T08:00:00Z
+  galena-build fleet plan beta --digest sha256:3f1c...`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFleetPlan,
+}
+
+var fleetRenderCmd = &cobra.Command{
+	Use:   "render <channel>",
+	Short: "Write the rollout plan, device units, or Airlock config",
+	Long: `Render the manifests of a rollout into ./output/fleet/<channel>.
+
+Formats:
+  plan     - rollout.json with the digest and the start of every wave
+  systemd  - galena-rollout.sh, .service, and .timer for the devices; the
+             script goes to /etc/galena and the units to /etc/systemd/system.
+             With fleet.fleetlock_url set, a release service frees the reboot
+             slot after the device booted the new digest.
+  airlock  - airlock.toml for an Airlock FleetLock server
+
+Examples:
+  galena-build fleet render stable
+  galena-build fleet render stable --format systemd,airlock -o /srv/rollout`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFleetRender,
+}
+
+func init() {
+	fleetCmd.AddCommand(fleetPlanCmd)
+	fleetCmd.AddCommand(fleetRenderCmd)
+
+	for _, c := range []*cobra.Command{fleetPlanCmd, fleetRenderCmd} {
+		c.Flags().StringVar(&fleetVariant, "variant", "main", "Variant whose image is rolled out")
+		c.Flags().StringVar(&fleetDigest, "digest", "", "Digest to roll out (default: the digest the channel points to)")
+		c.Flags().IntVar(&fleetHosts, "hosts", 0, "Fleet size, to count the devices of every wave")
+		c.Flags().StringVar(&fleetStart, "start", "", "Rollout start in RFC 3339 (default: now)")
+	}
+	fleetRenderCmd.Flags().StringSliceVar(&fleetFormats, "format", []string{build.FleetFormatPlan, build.FleetFormatSystemd}, "Formats to render ("+strings.Join(build.FleetFormats(), ", ")+")")
+	fleetRenderCmd.Flags().StringVarP(&fleetOutputDir, "output", "o", "", "Output directory (default: ./output/fleet/<channel>)")
+}
+
+// planRollout resolves the channel image and digest and plans its waves
+func planRollout(ctx context.Context, channelName string) (*build.RolloutPlan, error) {
+	channel, err := cfg.GetChannel(channelName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cfg.GetVariant(fleetVariant); err != nil {
+		return nil, err
+	}
+	if !cfg.HasRegistry(fleetVariant) {
+		return nil, fmt.Errorf("rollouts need registry and repository set in galena.yaml")
+	}
+	image := cfg.ImageRef(fleetVariant, channel.ImageTag())
+
+	start := time.Now()
+	if fleetStart != "" {
+		if start, err = time.Parse(time.RFC3339, fleetStart); err != nil {
+			return nil, fmt.Errorf("invalid --start: %w", err)
+		}
+	}
+
+	digest := fleetDigest
+	if digest == "" {
+		logger.Info("resolving channel digest", "image", image)
+		if digest, err = build.ResolveDigest(ctx, image); err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", image, err)
+		}
+	}
+	return build.NewRolloutPlan(cfg.Fleet, channel.Name, image, digest, start, fleetHosts)
+}
+
+func runFleetPlan(cmd *cobra.Command, args []string) error {
+	plan, err := planRollout(context.Background(), args[0])
+	if output.IsJSON() {
+		return output.EmitSummary("fleet plan", plan, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.StartScreen("ROLLOUT PLAN", "Staged rollout of the "+plan.Channel+" channel")
+	printKV("Image", plan.Image)
+	if plan.FleetLockURL != "" {
+		printKV("FleetLock", fmt.Sprintf("%s (group %s, %d slots)", plan.FleetLockURL, plan.Group, plan.Slots))
+	}
+	fmt.Println()
+	for _, w := range plan.Waves {
+		reach := fmt.Sprintf("%d%%", w.Percent)
+		if w.Hosts > 0 {
+			reach += fmt.Sprintf(" (%d devices)", w.Hosts)
+		}
+		printKV(w.Name, w.StartsAt.Local().Format("2006-01-02 15:04")+"  "+reach)
+	}
+	return nil
+}
+
+func runFleetRender(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	plan, err := planRollout(ctx, args[0])
+	if err != nil {
+		if output.IsJSON() {
+			return output.EmitSummary("fleet render", nil, err)
+		}
+		return err
+	}
+
+	dir := fleetOutputDir
+	if dir == "" {
+		dir = filepath.Join(rootDir, "output", "fleet", plan.Channel)
+	}
+	files, err := build.WriteFleetManifests(plan, fleetFormats, dir)
+	if output.IsJSON() {
+		return output.EmitSummary("fleet render", map[string]any{"plan": plan, "files": files}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Rollout manifests written!\n\nDigest: %s\nWaves: %d\n\n%s",
+		plan.Digest, len(plan.Waves), strings.Join(files, "\n"))))
+	return nil
+}
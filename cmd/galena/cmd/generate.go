@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/serve"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	netbootISO        string
+	netbootOutputDir  string
+	netbootBaseURL    string
+	netbootKickstart  string
+	netbootKernelArgs []string
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate deployment assets from build outputs",
+}
+
+var generateNetbootCmd = &cobra.Command{
+	Use:   "netboot",
+	Short: "Generate iPXE netboot assets from an installer ISO",
+	Long: `Extract the kernel, initrd, and installer image from a built ISO and
+write an iPXE script that boots them over HTTP.
+
+The assets are written to ./output/netboot by default so they can be
+served with 'galena-build serve artifacts'. The generated README.txt
+documents the kernel arguments used for automated installs.
+
+Examples:
+  # Use the newest ISO in ./output and the first LAN address
+  galena-build generate netboot
+
+  # Point at an explicit artifacts server and kickstart
+  galena-build generate netboot --base-url http://10.0.0.5:8080/netboot \
+    --kickstart http://10.0.0.5:8080/galena.ks
+
+  # Add kernel arguments
+  galena-build generate netboot --karg console=ttyS0,115200 --karg inst.text`,
+	Args: cobra.NoArgs,
+	RunE: runGenerateNetboot,
+}
+
+func init() {
+	generateCmd.AddCommand(generateNetbootCmd)
+
+	generateNetbootCmd.Flags().StringVar(&netbootISO, "iso", "", "Installer ISO (default: newest ISO in ./output)")
+	generateNetbootCmd.Flags().StringVarP(&netbootOutputDir, "output", "o", "", "Output directory (default: ./output/netboot)")
+	generateNetbootCmd.Flags().StringVar(&netbootBaseURL, "base-url", "", "URL serving the output directory (default: first LAN address on :8080)")
+	generateNetbootCmd.Flags().StringVar(&netbootKickstart, "kickstart", "", "Kickstart URL passed as inst.ks")
+	generateNetbootCmd.Flags().StringArrayVar(&netbootKernelArgs, "karg", nil, "Extra kernel argument (repeatable)")
+}
+
+func runGenerateNetboot(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	netboot := build.NewNetbootBuilder(cfg, rootDir, logger)
+
+	isoPath := netbootISO
+	if isoPath == "" {
+		isoPath, err = netboot.FindISO("")
+		if err != nil {
+			return fmt.Errorf("no ISO found: %w\nRun 'galena-build disk anaconda-iso' first to create one", err)
+		}
+		logger.Info("auto-detected ISO", "path", isoPath)
+	}
+
+	artifactsDir := filepath.Join(rootDir, "output")
+	outputDir := netbootOutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(artifactsDir, "netboot")
+	}
+
+	baseURL := netbootBaseURL
+	if baseURL == "" {
+		baseURL, err = defaultNetbootBaseURL(artifactsDir, outputDir)
+		if err != nil {
+			return err
+		}
+		logger.Info("using artifacts server URL", "url", baseURL)
+	}
+
+	result, err := netboot.Generate(ctx, build.NetbootOptions{
+		ISOPath:    isoPath,
+		OutputDir:  outputDir,
+		BaseURL:    baseURL,
+		Kickstart:  netbootKickstart,
+		KernelArgs: netbootKernelArgs,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf(
+		"Netboot assets generated!\n\niPXE script: %s\nKernel args: %s\n\nServe with: galena-build serve artifacts\nChainload:  chain %s/%s",
+		result.Script,
+		strings.Join(result.KernelArgs, " "),
+		strings.TrimRight(baseURL, "/"),
+		filepath.Base(result.Script),
+	)))
+
+	return nil
+}
+
+func defaultNetbootBaseURL(artifactsDir, outputDir string) (string, error) {
+	rel, err := filepath.Rel(artifactsDir, outputDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("output %s is outside %s; set --base-url explicitly", outputDir, artifactsDir)
+	}
+
+	urls := serve.LANURLs(serve.DefaultOptions().Addr)
+	if len(urls) == 0 {
+		return "", fmt.Errorf("no LAN address detected; set --base-url explicitly")
+	}
+
+	base := strings.TrimRight(urls[0], "/")
+	if rel != "." {
+		base += "/" + filepath.ToSlash(rel)
+	}
+	return base, nil
+}
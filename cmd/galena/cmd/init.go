@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/scaffold"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	initTemplate      string
+	initName          string
+	initDescription   string
+	initRegistry      string
+	initRepository    string
+	initFedoraVersion string
+	initNoWorkflow    bool
+	initForce         bool
+)
+
+// imageNamePattern matches a valid last path component of an image name
+var imageNamePattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*$`)
+
+var initCmd = &cobra.Command{
+	Use:   "init [dir]",
+	Short: "Create a new image project from a template",
+	Long: `Scaffold a new bootc image project in dir (default: the current directory).
+
+The project gets a galena.yaml, a Containerfile, build scripts under build/,
+Homebrew and Flatpak catalogs under custom/, a devcontainer profile,
+bootc-image-builder settings in iso/disk.toml, and a GitHub Actions workflow
+that builds, pushes, and signs the image.
+
+Templates:
+  gnome    - Fedora Silverblue with GNOME, from Universal Blue
+  kde      - Fedora Kinoite with KDE Plasma, from Universal Blue
+  minimal  - Fedora bootc without a desktop
+  gh:owner/repo[//subdir][@ref]
+           - a template repository on GitHub, such as a community starter
+
+A repository template is fetched at the ref (default: its default branch),
+and __GALENA_NAME__, __GALENA_DESCRIPTION__, __GALENA_REGISTRY__,
+__GALENA_REPOSITORY__, and __GALENA_FEDORA_VERSION__ are replaced in its file
+contents and paths. The name, registry, and repository are then set in its
+galena.yaml, which is written when the template has none. The template
+source, ref, and commit are recorded under template in galena.yaml.
+
+Without --template, init asks for the template, name, and repository in a
+terminal and uses gnome otherwise. Existing files are kept unless --force is
+given, so init can fill in what an existing project lacks.
+
+Examples:
+  galena-build init
+  galena-build init my-os --template kde --repository octocat
+  galena-build init --template minimal --no-workflow
+  galena-build init my-os --template gh:acme/bootc-templates//desktop@v2
+  galena-build init --dry-run`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runInit,
+}
+
+func init() {
+	initCmd.Flags().StringVarP(&initTemplate, "template", "t", "", "Project template: "+strings.Join(scaffold.TemplateNames(), ", ")+", or gh:owner/repo[//subdir][@ref]")
+	initCmd.Flags().StringVar(&initName, "name", "", "Image name (default: the directory name)")
+	initCmd.Flags().StringVar(&initDescription, "description", "", "Image description (default: the template's)")
+	initCmd.Flags().StringVar(&initRegistry, "registry", "ghcr.io", "Registry images are pushed to")
+	initCmd.Flags().StringVar(&initRepository, "repository", "", "Repository on the registry, e.g. the GitHub owner")
+	initCmd.Flags().StringVar(&initFedoraVersion, "fedora-version", "42", "Fedora version of the base image")
+	initCmd.Flags().BoolVar(&initNoWorkflow, "no-workflow", false, "Skip the GitHub Actions workflow")
+	initCmd.Flags().BoolVarP(&initForce, "force", "f", false, "Overwrite existing files")
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	dir := projectDir
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	opts := scaffold.Options{
+		Name:          initName,
+		Description:   initDescription,
+		Registry:      initRegistry,
+		Repository:    initRepository,
+		FedoraVersion: initFedoraVersion,
+		Workflow:      !initNoWorkflow,
+	}
+	if opts.Name == "" {
+		opts.Name = defaultImageName(filepath.Base(dir))
+	}
+
+	templateName := initTemplate
+	if templateName == "" && !output.IsJSON() && ui.IsInteractiveTerminal() {
+		if err := promptInit(&templateName, &opts); err != nil {
+			if errors.Is(err, huh.ErrUserAborted) {
+				return nil
+			}
+			return err
+		}
+	}
+	if templateName == "" {
+		templateName = scaffold.TemplateNames()[0]
+	}
+	if !imageNamePattern.MatchString(opts.Name) {
+		return fmt.Errorf("invalid image name %q: use lowercase letters, digits, and . _ - separators (set one with --name)", opts.Name)
+	}
+
+	var (
+		files  []scaffold.File
+		remote *config.TemplateConfig
+	)
+	if scaffold.IsRemote(templateName) {
+		r, err := scaffold.ParseRemote(templateName)
+		if err != nil {
+			return err
+		}
+		opts.Template = scaffold.Template{Name: r.Source(), Title: r.String()}
+		if exec.DryRun() {
+			exec.PrintDryRunAction("fetch %s from %s", r, r.URL())
+			exec.PrintDryRunAction("write its files to %s and record the template in galena.yaml", dir)
+			return nil
+		}
+		files, remote, err = renderRemoteTemplate(context.Background(), r, opts)
+		if err != nil {
+			return output.EmitSummary("init", map[string]any{"dir": dir, "template": r.String()}, err)
+		}
+	} else {
+		opts.Template, err = scaffold.LookupTemplate(templateName)
+		if err != nil {
+			return err
+		}
+		files, err = scaffold.Render(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if exec.DryRun() {
+		for _, f := range files {
+			exec.PrintDryRunAction("write %s", filepath.Join(dir, filepath.FromSlash(f.Path)))
+		}
+		return nil
+	}
+
+	written, kept, err := scaffold.Write(dir, files, initForce)
+	if err == nil && remote != nil {
+		written, err = recordTemplate(dir, written, kept, opts, *remote)
+	}
+	if err == nil && slices.Contains(written, "galena.yaml") {
+		err = config.ValidateFile(filepath.Join(dir, "galena.yaml"))
+	}
+	summary := map[string]any{"dir": dir, "template": opts.Template.Name, "name": opts.Name, "written": written, "kept": kept}
+	if output.IsJSON() {
+		return output.EmitSummary("init", summary, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, path := range kept {
+		fmt.Println(ui.MutedStyle.Render("  kept " + path + " (exists; use --force to overwrite)"))
+	}
+	if len(written) == 0 {
+		fmt.Println(ui.MutedStyle.Render("Nothing written: " + dir + " already has every file of the template."))
+		return nil
+	}
+	logger.Info("project created", "dir", dir, "template", opts.Template.Name, "files", len(written))
+
+	next := "galena-build build"
+	if dir != mustGetwd() {
+		next = "cd " + dir + " && " + next
+	}
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Project created!\n\nDirectory: %s\nTemplate: %s\nImage: %s\nFiles written: %d\n\nNext: %s",
+		dir, opts.Template.Title, opts.Name, len(written), next)))
+	return nil
+}
+
+// renderRemoteTemplate fetches a repository template and returns the files
+// of the new project and the provenance to record in galena.yaml
+func renderRemoteTemplate(ctx context.Context, r scaffold.Remote, opts scaffold.Options) ([]scaffold.File, *config.TemplateConfig, error) {
+	tmp, err := os.MkdirTemp("", "galena-template-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	logger.Info("fetching template", "template", r.String())
+	commit, err := r.Fetch(ctx, tmp)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := filepath.Join(tmp, filepath.FromSlash(r.Subdir))
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s has no directory %s", r.URL(), r.Subdir)
+	}
+	files, err := scaffold.RenderDir(root, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", r, err)
+	}
+	return files, &config.TemplateConfig{Source: r.Source(), Ref: r.Ref, Commit: commit}, nil
+}
+
+// recordTemplate sets the project settings and the template provenance in
+// the galena.yaml of a project created from a repository template, writing
+// one when the template has none. A galena.yaml that was kept is left alone.
+func recordTemplate(dir string, written, kept []string, opts scaffold.Options, source config.TemplateConfig) ([]string, error) {
+	if slices.Contains(kept, "galena.yaml") {
+		logger.Warn("galena.yaml exists, not recording the template", "template", source.Source)
+		return written, nil
+	}
+	// The template block is replaced as a whole, dropping what the template
+	// itself was created from
+	provenance := []string{"source: " + strconv.Quote(source.Source)}
+	if source.Ref != "" {
+		provenance = append(provenance, "ref: "+strconv.Quote(source.Ref))
+	}
+	provenance = append(provenance, "commit: "+strconv.Quote(source.Commit))
+	settings := [][2]string{
+		{"name", opts.Name},
+		{"description", opts.Description},
+		{"registry", opts.Registry},
+		{"repository", opts.Repository},
+		{"template", "{" + strings.Join(provenance, ", ") + "}"},
+	}
+	path := filepath.Join(dir, "galena.yaml")
+	for _, s := range settings {
+		// Keep what the template's galena.yaml says unless a value was given
+		if s[1] == "" {
+			continue
+		}
+		if err := config.SetFileValue(path, s[0], s[1]); err != nil {
+			return written, fmt.Errorf("recording template in galena.yaml: %w", err)
+		}
+	}
+	if !slices.Contains(written, "galena.yaml") {
+		written = append(written, "galena.yaml")
+	}
+	return written, nil
+}
+
+// promptInit asks for the template, image name, and repository of a new
+// project
+func promptInit(templateName *string, opts *scaffold.Options) error {
+	var options []huh.Option[string]
+	for _, t := range scaffold.Templates() {
+		options = append(options, huh.NewOption(t.Title+" - "+t.Description, t.Name))
+	}
+	*templateName = scaffold.TemplateNames()[0]
+
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Template").
+				Description("What should the image start from?").
+				Options(options...).
+				Value(templateName),
+			huh.NewInput().
+				Title("Image Name").
+				Value(&opts.Name).
+				Validate(func(value string) error {
+					if !imageNamePattern.MatchString(value) {
+						return fmt.Errorf("use lowercase letters, digits, and . _ - separators")
+					}
+					return nil
+				}),
+			huh.NewInput().
+				Title("Repository").
+				Description("Namespace on "+opts.Registry+", e.g. your GitHub user or organization").
+				Value(&opts.Repository),
+		),
+	).WithTheme(ui.HuhTheme()).Run()
+}
+
+// defaultImageName turns a directory name into an image name
+func defaultImageName(base string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, base)
+	return strings.Trim(name, "._-")
+}
+
+func mustGetwd() string {
+	wd, _ := os.Getwd()
+	return wd
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	inspectVariant string
+	inspectTag     string
+	inspectTop     int
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Inspect built images",
+	Long: `Inspect the contents of built container images.
+
+Examples:
+  galena-build inspect layers`,
+}
+
+var inspectLayersCmd = &cobra.Command{
+	Use:   "layers [image]",
+	Short: "Show per-layer sizes and wasted space",
+	Long: `Break an image down by layer: the instruction that created each layer,
+its size and file count, and the space it wastes.
+
+Wasted space is content a layer adds that a later layer overwrites or
+deletes. It still ships in the image, so a build script that removes its
+caches in a separate step shows up here. Files are read from the saved
+image layers.
+
+Examples:
+  # Analyze the locally built main image
+  galena-build inspect layers
+
+  # Analyze a variant and list the 20 largest wasted files
+  galena-build inspect layers --variant nvidia --top 20
+
+  # Analyze any local image
+  galena-build inspect layers ghcr.io/acme/galena:stable`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runInspectLayers,
+}
+
+func init() {
+	inspectCmd.AddCommand(inspectLayersCmd)
+
+	inspectLayersCmd.Flags().StringVarP(&inspectVariant, "variant", "V", "main", "Image variant to inspect")
+	inspectLayersCmd.Flags().StringVarP(&inspectTag, "tag", "t", "latest", "Image tag to inspect")
+	inspectLayersCmd.Flags().IntVar(&inspectTop, "top", 10, "Number of wasted files to list")
+}
+
+func runInspectLayers(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "inspect layers"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	imageRef := cfg.ImageRef(inspectVariant, inspectTag)
+	if len(args) > 0 {
+		imageRef = args[0]
+	}
+
+	builder := build.NewBuilder(cfg, rootDir, logger)
+	analysis, err := builder.AnalyzeLayers(ctx, imageRef)
+	if err != nil {
+		return output.EmitSummary("inspect layers", nil, err)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("inspect layers", analysis, nil)
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Title.Render("Layers"))
+	width := 60
+	for _, l := range analysis.Layers {
+		createdBy := l.CreatedBy
+		if runes := []rune(createdBy); len(runes) > width {
+			createdBy = string(runes[:width-1]) + "…"
+		}
+		line := fmt.Sprintf("  %3d  %10s  %7d files  %s", l.Index, formatBytes(l.Size), l.Files, createdBy)
+		if l.Wasted > 0 {
+			line += " " + ui.WarningStyle.Render(fmt.Sprintf("(%s wasted)", formatBytes(l.Wasted)))
+		}
+		fmt.Println(line)
+	}
+
+	if len(analysis.WastedFiles) > 0 && inspectTop > 0 {
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Wasted Files"))
+		files := analysis.WastedFiles
+		if len(files) > inspectTop {
+			files = files[:inspectTop]
+		}
+		for _, f := range files {
+			fmt.Printf("  %10s  %s %s\n", formatBytes(f.Size), f.Path, ui.MutedStyle.Render(fmt.Sprintf("×%d", f.Copies)))
+		}
+	}
+
+	summary := []string{
+		"Image: " + analysis.Image,
+		"Layers: " + fmt.Sprint(len(analysis.Layers)),
+		"Total size: " + formatBytes(analysis.TotalSize),
+		"Wasted: " + formatBytes(analysis.WastedSize),
+		fmt.Sprintf("Efficiency: %.1f%%", analysis.Efficiency()*100),
+	}
+	fmt.Println()
+	if analysis.Efficiency() < 0.95 {
+		fmt.Println(ui.WarningBox.Render(strings.Join(summary, "\n")))
+	} else {
+		fmt.Println(ui.InfoBox.Render(strings.Join(summary, "\n")))
+	}
+	return nil
+}
@@ -32,7 +32,7 @@ Examples:
 
 func runLint(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	if err := platform.RequireLinux("lint"); err != nil {
+	if err := platform.Require(platform.ContainerTools, "lint"); err != nil {
 		return err
 	}
 
@@ -43,10 +43,15 @@ func runLint(cmd *cobra.Command, args []string) error {
 		imageRef = cfg.ImageRef("main", "latest")
 	}
 
+	engine, err := containerEngine()
+	if err != nil {
+		return err
+	}
+
 	logger.Info("running bootc container lint", "image", imageRef)
 
 	// Run bootc container lint inside the image
-	result := exec.Podman(ctx, "run", "--rm", imageRef, "bootc", "container", "lint")
+	result := engine.RunImage(ctx, imageRef, "bootc", "container", "lint")
 	if result.Err != nil {
 		logger.Error("lint failed", "stderr", result.Stderr)
 		fmt.Println()
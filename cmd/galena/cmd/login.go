@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/secrets"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login [registry]",
+	Short: "Set up registry credentials without storing the secret",
+	Long: `Record where the credentials of a registry come from and check them
+against the registry. galena.yaml only holds a reference to the password;
+the secret is read when an image is pushed, promoted, or signed, and handed
+to podman, skopeo, oras, or cosign for that command only. Nothing is
+written to an auth file.
+
+A secret reference is one of:
+  env:VAR                an environment variable
+  file:PATH              a file, relative to the project root
+  pass:NAME              the first line of pass show NAME
+  gopass:NAME            gopass show --password NAME
+  op://VAULT/ITEM/FIELD  a 1Password field, via op read
+  cmd:COMMAND            the output of a shell command
+
+The username can be a reference too. The registry defaults to registry in
+galena.yaml. Without flags, login checks the saved credentials of the
+registry; without a registry either, it lists every saved credential and
+whether its secret can be read.
+
+The signing key and its password can come from references as well, with
+signing.key_from and signing.password_from.
+
+Secrets are masked in dry-run output, session logs, and the audit log.
+docker pushes with its own docker login.
+
+Examples:
+  galena-build login ghcr.io -u octocat --password-from pass:registries/ghcr
+  galena-build login quay.io -u env:QUAY_USER --password-from env:QUAY_TOKEN
+  galena-build login ghcr.io -u octocat --password-from op://ci/ghcr/token
+  galena-build login ghcr.io
+  galena-build login
+  galena-build login quay.io --remove`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogin,
+}
+
+var (
+	loginUsername     string
+	loginPasswordFrom string
+	loginRemove       bool
+	loginNoVerify     bool
+)
+
+func init() {
+	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "Username, or a secret reference to it")
+	loginCmd.Flags().StringVar(&loginPasswordFrom, "password-from", "", "Secret reference to the password or token (env:, file:, pass:, gopass:, op://, cmd:)")
+	loginCmd.Flags().BoolVar(&loginRemove, "remove", false, "Remove the credentials of the registry from galena.yaml")
+	loginCmd.Flags().BoolVar(&loginNoVerify, "no-verify", false, "Save without reading the secret or checking it against the registry")
+}
+
+// loginStatus is the state of one saved credential
+type loginStatus struct {
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password"` // The reference, never the secret
+	Error    string `json:"error,omitempty"`
+}
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	saving := loginUsername != "" || loginPasswordFrom != ""
+	if len(args) == 0 && !saving && !loginRemove {
+		return runLoginList(ctx)
+	}
+
+	registry := cfg.Registry
+	if len(args) == 1 {
+		registry = args[0]
+	}
+	registry = strings.TrimSuffix(strings.TrimPrefix(registry, "https://"), "/")
+	if registry == "" {
+		return fmt.Errorf("no registry given and none set in galena.yaml")
+	}
+
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if loginRemove {
+		if saving {
+			return fmt.Errorf("--remove cannot be combined with --username or --password-from")
+		}
+		if exec.DryRun() {
+			exec.PrintDryRunAction("remove the credentials of %s from %s", registry, path)
+			return nil
+		}
+		if err := config.RemoveCredential(path, registry); err != nil {
+			return err
+		}
+		logger.Info("removed credentials", "registry", registry, "path", path)
+		return output.EmitSummary("login", map[string]any{"registry": registry, "removed": true}, nil)
+	}
+
+	entry := config.CredentialConfig{Registry: registry, Username: loginUsername, Password: loginPasswordFrom}
+	if saving {
+		if entry.Username == "" || entry.Password == "" {
+			return fmt.Errorf("saving credentials needs both --username and --password-from")
+		}
+		if !config.IsSecretRef(entry.Password) {
+			return fmt.Errorf("--password-from takes a secret reference starting with one of %s, not the password itself", strings.Join(config.SecretSchemes(), ", "))
+		}
+	} else {
+		found := false
+		for _, c := range cfg.Credentials {
+			if c.Registry == registry {
+				entry, found = c, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no credentials for %s; save them with --username and --password-from", registry)
+		}
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	// Without verification the secret may only exist elsewhere, e.g. in CI
+	cred := secrets.Credential{Registry: registry, Username: entry.Username}
+	if !loginNoVerify {
+		cred, _, err = secrets.NewStore(rootDir, []config.CredentialConfig{entry}).Lookup(ctx, registry)
+		if err != nil {
+			return output.EmitSummary("login", map[string]any{"registry": registry}, err)
+		}
+		if err := secrets.Verify(ctx, cred); err != nil {
+			return output.EmitSummary("login", map[string]any{"registry": registry, "username": cred.Username}, fmt.Errorf("login to %s failed: %w", registry, err))
+		}
+		logger.Info("credentials accepted", "registry", registry, "username", cred.Username)
+	}
+
+	if saving {
+		if exec.DryRun() {
+			exec.PrintDryRunAction("save the credentials of %s (password from %s) to %s", registry, entry.Password, path)
+			return nil
+		}
+		if err := config.SetCredential(path, entry); err != nil {
+			return err
+		}
+		logger.Info("saved credentials", "registry", registry, "password", entry.Password, "path", path)
+	}
+	if !output.IsJSON() && !loginNoVerify {
+		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ Login to %s succeeded", registry)))
+	}
+	return output.EmitSummary("login", map[string]any{"registry": registry, "username": cred.Username, "verified": !loginNoVerify, "saved": saving}, nil)
+}
+
+// runLoginList shows every saved credential and whether its secret can be read
+func runLoginList(ctx context.Context) error {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	store := secrets.NewStore(rootDir, cfg.Credentials)
+
+	statuses := []loginStatus{}
+	for _, c := range cfg.Credentials {
+		status := loginStatus{Registry: c.Registry, Username: c.Username, Password: c.Password}
+		if _, _, err := store.Lookup(ctx, c.Registry); err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("login", map[string]any{"credentials": statuses}, nil)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println(ui.MutedStyle.Render("No registry credentials in galena.yaml. Add some with galena-build login <registry> -u <user> --password-from <ref>."))
+		return nil
+	}
+	fmt.Println(ui.HeaderStyle.Render("Registry credentials"))
+	for _, s := range statuses {
+		state := ui.SuccessStyle.Render("readable")
+		if s.Error != "" {
+			state = ui.ErrorStyle.Render(s.Error)
+		}
+		printKV(s.Registry, fmt.Sprintf("%s, password from %s: %s", s.Username, s.Password, state))
+	}
+	return nil
+}
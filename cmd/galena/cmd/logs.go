@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	logsFollow bool
+	logsLines  int
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [session]",
+	Short: "Browse the session logs of past builds",
+	Long: `Open a session log in a scrollable viewer: the newest one, the newest of a
+kind such as build, fast-build, or disk, or one by name. Every build, disk,
+fast build, and ci build run writes one to logs/sessions, holding each command
+it ran together with its full output. The newest logs.keep sessions are kept
+(default 20).
+
+The viewer highlights commands, warnings, and errors. Press / to search and
+n/N to step through the matches, p/P to show one phase of a fast build at a
+time, e to show only warnings and errors, and f to follow new output. Logs of
+sessions still running are followed from the start, as with --follow.
+
+Without a terminal the sessions are listed instead, or with a session or
+--follow the log is printed as by logs show.
+
+Examples:
+  galena-build logs
+  galena-build logs fast-build
+  galena-build logs build -f
+  galena-build logs list
+  galena-build logs show disk -n 200`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogs,
+}
+
+var logsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the session logs with their status",
+	Args:  cobra.NoArgs,
+	RunE:  runLogsList,
+}
+
+var logsShowCmd = &cobra.Command{
+	Use:   "show [session]",
+	Short: "Show a session log",
+	Long: `Show the end of a session log: the newest one, the newest of a kind such as
+build or disk, or one by name. With -f new output is printed as a running
+session writes it until Ctrl+C.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogsShow,
+}
+
+func init() {
+	logsCmd.AddCommand(logsListCmd)
+	logsCmd.AddCommand(logsShowCmd)
+
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Follow new output as it is written")
+	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 100, "Number of lines to print without a terminal (0 for all)")
+
+	logsShowCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Print new output as it is written")
+	logsShowCmd.Flags().IntVarP(&logsLines, "lines", "n", 100, "Number of lines to show (0 for all)")
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	if output.IsJSON() || !ui.IsInteractiveTerminal() {
+		if len(args) == 0 && !logsFollow {
+			return runLogsList(cmd, args)
+		}
+		return runLogsShow(cmd, args)
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	session, err := build.FindSession(rootDir, name)
+	if err != nil {
+		return err
+	}
+	return viewSessionLog(session.Name, session.Path, logsFollow || session.Status == "incomplete")
+}
+
+// viewSessionLog opens a session log in the log viewer
+func viewSessionLog(name, path string, follow bool) error {
+	logger.Debug("viewing session log", "path", path)
+	return ui.RunLogViewer(ui.LogViewerOptions{
+		Title:  name,
+		Path:   path,
+		Follow: follow,
+		Phase:  build.SessionPhase,
+	})
+}
+
+// offerSessionLog asks to open the log of a finished session in the viewer,
+// defaulting to yes when the session failed. Without a terminal it prints
+// how to open the log later.
+func offerSessionLog(session *build.Session, err error) {
+	if session == nil {
+		return
+	}
+	hint := "galena-build logs " + session.Name
+	if !ui.IsInteractiveTerminal() {
+		fmt.Println(ui.MutedStyle.Render("View the session log with: " + hint))
+		return
+	}
+	open := err != nil
+	confirmErr := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Open the session log?").
+				Description("Later with: " + hint).
+				Value(&open),
+		),
+	).WithTheme(ui.HuhTheme()).Run()
+	if confirmErr != nil || !open {
+		return
+	}
+	if viewErr := viewSessionLog(session.Name, session.Path, false); viewErr != nil {
+		fmt.Println(ui.WarningStyle.Render("Could not open the session log: " + viewErr.Error()))
+	}
+}
+
+func runLogsList(cmd *cobra.Command, args []string) error {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	sessions, err := build.ListSessions(rootDir)
+	if err != nil {
+		return err
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("logs", sessions, nil)
+	}
+	if len(sessions) == 0 {
+		fmt.Println(ui.MutedStyle.Render("No session logs yet; build, disk, and ci build write them to " + build.SessionsDir(rootDir)))
+		return nil
+	}
+
+	fmt.Printf("%-32s  %-10s  %-17s  %9s\n", "SESSION", "STATUS", "STARTED", "SIZE")
+	for _, s := range sessions {
+		status := s.Status
+		switch status {
+		case "succeeded":
+			status = ui.SuccessStyle.Render(fmt.Sprintf("%-10s", status))
+		case "failed":
+			status = ui.ErrorStyle.Render(fmt.Sprintf("%-10s", status))
+		default:
+			status = ui.WarningStyle.Render(fmt.Sprintf("%-10s", status))
+		}
+		fmt.Printf("%-32s  %s  %-17s  %9s\n", s.Name, status, s.Started.Format("2006-01-02 15:04"), formatBytes(s.Size))
+	}
+	return nil
+}
+
+func runLogsShow(cmd *cobra.Command, args []string) error {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	session, err := build.FindSession(rootDir, name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(session.Path)
+	if err != nil {
+		return fmt.Errorf("opening session log: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("reading session log: %w", err)
+	}
+	logger.Debug("showing session log", "path", session.Path)
+	text := string(data)
+	if logsLines > 0 {
+		text = exec.LastNLines(text, logsLines)
+	}
+	if text != "" {
+		fmt.Println(strings.TrimRight(text, "\n"))
+	}
+	if !logsFollow {
+		return nil
+	}
+
+	ctx, stop := interruptibleContext()
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+		if _, err := io.Copy(os.Stdout, file); err != nil {
+			return fmt.Errorf("reading session log: %w", err)
+		}
+	}
+}
+
+// startSession opens the session log of a command and logs every command
+// run with default options to it. Failures are warnings.
+func startSession(rootDir, kind string) *build.Session {
+	keep := 0
+	if cfg != nil {
+		keep = cfg.Logs.Keep
+	}
+	session, err := build.StartSession(rootDir, kind, commandLine(), keep)
+	if err != nil {
+		logger.Warn("could not start the session log", "error", err)
+	}
+	if session == nil {
+		return nil
+	}
+	exec.SetSessionLog(session)
+	logger.Debug("logging session", "path", session.Path)
+	return session
+}
+
+// commandLine returns the galena invocation being run
+func commandLine() string {
+	return strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+}
+
+// endSession records the outcome of a session and stops logging to it
+func endSession(session *build.Session, err error) {
+	if session == nil {
+		return
+	}
+	exec.SetSessionLog(nil)
+	if closeErr := session.Close(err); closeErr != nil {
+		logger.Warn("could not close the session log", "error", closeErr)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/cobra"
 
 	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/ui"
 )
 
@@ -19,6 +20,7 @@ var (
 	appsInstallBrew    bool
 	appsInstallFlatpak bool
 	appsInstallAll     bool
+	appsInstallMissing bool
 )
 
 var appsCmd = &cobra.Command{
@@ -36,9 +38,19 @@ var appsStatusCmd = &cobra.Command{
 }
 
 var appsInstallCmd = &cobra.Command{
-	Use:   "install",
+	Use:   "install [name...]",
 	Short: "Install applications from catalog definitions",
-	RunE:  runAppsInstall,
+	Long: `Install applications from the Homebrew and Flatpak catalogs.
+
+Without arguments, install asks which items to install or uninstall. Name
+catalog items, or pass --missing for every item not yet installed, to
+install without asking, as scripts and --plain need.
+
+Examples:
+  galena apps install
+  galena apps install --flatpak --missing
+  galena apps install ripgrep org.mozilla.firefox`,
+	RunE: runAppsInstall,
 }
 
 func init() {
@@ -48,9 +60,15 @@ func init() {
 	appsInstallCmd.Flags().BoolVar(&appsInstallBrew, "brew", false, "Install from Brewfile catalogs only")
 	appsInstallCmd.Flags().BoolVar(&appsInstallFlatpak, "flatpak", false, "Install from Flatpak catalogs only")
 	appsInstallCmd.Flags().BoolVar(&appsInstallAll, "all", false, "Install from both catalogs")
+	appsInstallCmd.Flags().BoolVar(&appsInstallMissing, "missing", false, "Install every missing item without asking")
 }
 
 func runApps(cmd *cobra.Command, args []string) error {
+	if !ui.IsInteractiveTerminal() {
+		return showCatalogStatus([]catalogKind{catalogKindBrew, catalogKindFlatpak})
+	}
+
+	defer ui.PushScreen("Applications")()
 	ui.StartScreen("APPLICATIONS", "Manage Homebrew and Flatpak applications from Galena catalogs")
 
 	for {
@@ -66,8 +84,8 @@ func runApps(cmd *cobra.Command, args []string) error {
 		}
 
 		switch choice {
-		case ui.MenuActionBack, ui.MenuActionQuit, "back":
-			return nil
+		case ui.MenuActionBack, ui.MenuActionHome, ui.MenuActionQuit, "back":
+			return ui.NavigationError(choice)
 		case "status":
 			if err := showCatalogStatus([]catalogKind{catalogKindBrew, catalogKindFlatpak}); err != nil {
 				return err
@@ -159,6 +177,12 @@ func runAppsInstall(cmd *cobra.Command, args []string) error {
 			kinds = append(kinds, catalogKindFlatpak)
 		}
 	}
+	if len(args) > 0 || appsInstallMissing {
+		return installCatalogSelection(kinds, args)
+	}
+	if err := ui.RequireInteractive("apps install", "catalog item names or --missing"); err != nil {
+		return err
+	}
 	err := runCatalogInstallFlow(kinds)
 	if errors.Is(err, huh.ErrUserAborted) {
 		return nil
@@ -233,6 +257,50 @@ func runCatalogInstallFlow(kinds []catalogKind) error {
 	return installCatalogItems(selected)
 }
 
+// installCatalogSelection installs the named catalog items, or every
+// missing item when no names are given
+func installCatalogSelection(kinds []catalogKind, names []string) error {
+	if err := ensureCatalogManagers(kinds); err != nil {
+		return err
+	}
+	items, err := loadCatalogForKinds(kinds)
+	if err != nil {
+		return err
+	}
+
+	selected := []catalogItem{}
+	if len(names) == 0 {
+		for _, item := range items {
+			if !item.Installed {
+				selected = append(selected, item)
+			}
+		}
+	} else {
+		for _, name := range names {
+			found := false
+			for _, item := range items {
+				if item.Name != name {
+					continue
+				}
+				found = true
+				if item.Installed {
+					fmt.Println(ui.MutedStyle.Render(fmt.Sprintf("%s (%s) is already installed", item.Name, item.Kind)))
+					continue
+				}
+				selected = append(selected, item)
+			}
+			if !found {
+				return fmt.Errorf("%s is not in the catalogs (see galena apps status)", name)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Println(ui.InfoBox.Render("Nothing to install."))
+		return nil
+	}
+	return installCatalogItems(sortCatalogItemsForSelection(selected))
+}
+
 func installCatalogItems(items []catalogItem) error {
 	ctx := context.Background()
 	installed := 0
@@ -311,15 +379,7 @@ func installCatalogItem(ctx context.Context, item catalogItem) error {
 			return fmt.Errorf("%w\n%s", remoteAdd.Err, galexec.LastNLines(remoteAdd.Stderr, 10))
 		}
 
-		result := galexec.Run(ctx, "flatpak", []string{
-			"install", "-y", "--system", "flathub", item.Name,
-		}, galexec.DefaultOptions())
-		if result.Err != nil {
-			// Fallback to user scope if system scope is unavailable.
-			result = galexec.Run(ctx, "flatpak", []string{
-				"install", "-y", "flathub", item.Name,
-			}, galexec.DefaultOptions())
-		}
+		result := runSystemFlatpak(ctx, "install system-wide Flatpak applications", "install", "flathub", item.Name)
 		if result.Err != nil {
 			return fmt.Errorf("%w\n%s", result.Err, galexec.LastNLines(result.Stderr, 10))
 		}
@@ -344,15 +404,7 @@ func uninstallCatalogItem(ctx context.Context, item catalogItem) error {
 		if err := galexec.RequireCommands("flatpak"); err != nil {
 			return err
 		}
-		result := galexec.Run(ctx, "flatpak", []string{
-			"uninstall", "-y", "--system", item.Name,
-		}, galexec.DefaultOptions())
-		if result.Err != nil {
-			// Fallback to user scope if system scope is unavailable.
-			result = galexec.Run(ctx, "flatpak", []string{
-				"uninstall", "-y", item.Name,
-			}, galexec.DefaultOptions())
-		}
+		result := runSystemFlatpak(ctx, "remove system-wide Flatpak applications", "uninstall", item.Name)
 		if result.Err != nil {
 			return fmt.Errorf("%w\n%s", result.Err, galexec.LastNLines(result.Stderr, 10))
 		}
@@ -395,13 +447,27 @@ func renderCatalogOptionLabel(item catalogItem, containerPreferred map[string]st
 func showCatalogStatus(kinds []catalogKind) error {
 	items, err := loadCatalogForKinds(kinds)
 	if err != nil {
-		return err
+		return output.EmitSummary("apps status", nil, err)
 	}
 	containerPreferred := containerPreferredBrewSet()
 
 	brewAvailable := galexec.CheckCommand("brew")
 	flatpakAvailable := galexec.CheckCommand("flatpak")
 
+	if output.IsJSON() {
+		preferred := []string{}
+		for _, item := range items {
+			if _, ok := containerPreferred[item.Name]; ok && item.Kind == catalogKindBrew {
+				preferred = append(preferred, item.Name)
+			}
+		}
+		return output.EmitSummary("apps status", map[string]any{
+			"managers":            map[string]bool{"brew": brewAvailable, "flatpak": flatpakAvailable},
+			"items":               append([]catalogItem{}, items...),
+			"container_preferred": preferred,
+		}, nil)
+	}
+
 	ui.StartScreen("CATALOG STATUS", "Installed vs missing applications from Brew and Flatpak manifests")
 
 	fmt.Println(ui.Title.Render("Managers"))
@@ -481,3 +547,19 @@ func ensureCatalogManagers(kinds []catalogKind) error {
 	}
 	return nil
 }
+
+// runSystemFlatpak runs a flatpak operation in the system scope. When polkit
+// refuses it, the privilege broker re-runs it as root; when that is declined
+// or fails too, it runs in the user scope instead.
+func runSystemFlatpak(ctx context.Context, reason, operation string, args ...string) *galexec.Result {
+	opts := galexec.DefaultOptions()
+	opts.Escalate = reason
+	opts.Logger = logger
+	result := galexec.Run(ctx, "flatpak", append([]string{operation, "-y", "--system"}, args...), opts)
+	if result.Err == nil {
+		return result
+	}
+
+	logger.Warn("falling back to user scope", "cmd", "flatpak "+operation, "reason", result.Err)
+	return galexec.Run(ctx, "flatpak", append([]string{operation, "-y", "--user"}, args...), galexec.DefaultOptions())
+}
@@ -15,6 +15,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/ui"
 )
 
@@ -104,6 +105,11 @@ func init() {
 }
 
 func runDev(cmd *cobra.Command, args []string) error {
+	if !ui.IsInteractiveTerminal() {
+		return runDevStatus(cmd, args)
+	}
+
+	defer ui.PushScreen("Development")()
 	ui.StartScreen("DEVELOPMENT", "Devcontainer-first workflows for Galena")
 
 	for {
@@ -129,8 +135,8 @@ func runDev(cmd *cobra.Command, args []string) error {
 		}
 
 		switch choice {
-		case ui.MenuActionBack, ui.MenuActionQuit, "back":
-			return nil
+		case ui.MenuActionBack, ui.MenuActionHome, ui.MenuActionQuit, "back":
+			return ui.NavigationError(choice)
 		case "list":
 			if !runDevActionWithPause(func() error { return runDevList(devListCmd, nil) }) {
 				return nil
@@ -234,19 +240,25 @@ type podmanContainerEntry struct {
 }
 
 type discoveredDevcontainer struct {
-	ID        string
-	Name      string
-	State     string
-	Status    string
-	Workspace string
-	Config    string
-	Runtime   string
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Status    string `json:"status"`
+	Workspace string `json:"workspace"`
+	Config    string `json:"config"`
+	Runtime   string `json:"runtime"`
 }
 
 func runDevList(cmd *cobra.Command, args []string) error {
-	ui.StartScreen("DEV CONTAINERS", "Running and stopped devcontainers on this host")
-
 	containers, err := discoverDevcontainers(context.Background())
+	if containers == nil {
+		containers = []discoveredDevcontainer{}
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("dev list", containers, err)
+	}
+
+	ui.StartScreen("DEV CONTAINERS", "Running and stopped devcontainers on this host")
 	if err != nil {
 		fmt.Println(ui.WarningStyle.Render("Could not discover devcontainers: " + err.Error()))
 		return nil
@@ -1,34 +1,115 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
-	osexec "os/exec"
+	"path/filepath"
+	"strings"
 
-	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/charmbracelet/huh"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/privilege"
+	"github.com/iiroan/galena/internal/ui"
 )
 
-func commandWithPrivilege(name string, args ...string) (string, []string) {
-	if os.Geteuid() == 0 {
-		return name, args
+const systemStateDir = "/var/lib/galena"
+
+var escalator *privilege.Escalator
+
+// privilegeEscalator returns the session-wide escalator so consent is asked once
+func privilegeEscalator() *privilege.Escalator {
+	if escalator == nil {
+		escalator = privilege.NewEscalator(logger, confirmPrivilege)
+	}
+	return escalator
+}
+
+// confirmPrivilege asks before elevating. Without a terminal nobody can be
+// asked, so only an explicit --yes approves it.
+func confirmPrivilege(reason string, commands []string) bool {
+	if assumeYes {
+		logger.Info("elevating privileges", "reason", reason, "commands", strings.Join(commands, "; "))
+		return true
+	}
+	if !ui.IsInteractiveTerminal() {
+		logger.Warn("administrator rights needed without a terminal; pass --yes to allow it", "reason", reason)
+		return false
+	}
+
+	description := "galena needs administrator rights to " + reason + "."
+	if len(commands) > 0 {
+		description += "\n\nWill run:\n  " + strings.Join(commands, "\n  ")
+	}
+	description += "\n\nDeclining continues with user-scope alternatives where possible."
+
+	confirm := true
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Administrator access required").
+				Description(description).
+				Affirmative("Elevate").
+				Negative("Stay in user scope").
+				Value(&confirm),
+		),
+	).WithTheme(ui.HuhTheme()).Run()
+	if err != nil {
+		return false
 	}
-	if galexec.CheckCommand("sudo") {
-		return "sudo", append([]string{name}, args...)
+	return confirm
+}
+
+// userStateDir returns the per-user fallback for galena state markers
+func userStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "galena")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "galena-state")
+	}
+	return filepath.Join(home, ".local", "state", "galena")
+}
+
+// statePath resolves a state file, preferring the system location
+func statePath(name string) string {
+	systemPath := filepath.Join(systemStateDir, name)
+	if _, err := os.Stat(systemPath); err == nil {
+		return systemPath
 	}
-	if galexec.CheckCommand("pkexec") {
-		return "pkexec", append([]string{name}, args...)
+	userPath := filepath.Join(userStateDir(), name)
+	if _, err := os.Stat(userPath); err == nil {
+		return userPath
+	}
+	return systemPath
+}
+
+// writeStateFile records state under /var/lib/galena, falling back to the user state dir
+func writeStateFile(ctx context.Context, name string, data []byte) error {
+	systemPath := filepath.Join(systemStateDir, name)
+	err := privilegeEscalator().WriteFile(ctx, "record device state in "+systemStateDir, systemPath, data)
+	if err == nil {
+		return nil
+	}
+
+	userPath := filepath.Join(userStateDir(), name)
+	logger.Warn("could not write system state, using user state", "path", userPath, "error", err)
+	if err := os.MkdirAll(filepath.Dir(userPath), 0o755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
 	}
-	return name, args
+	return os.WriteFile(userPath, data, 0o644)
 }
 
+// runAttachedCommand runs an interactive command on a pseudo-terminal of
+// its own, without a timeout
 func runAttachedCommand(name string, args []string) error {
-	cmd := osexec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Env = os.Environ()
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("running %s: %w", name, err)
+	opts := exec.DefaultOptions()
+	opts.Timeout = 0
+	opts.Logger = logger
+	if result := exec.RunAttached(context.Background(), name, args, opts); result.Err != nil {
+		return fmt.Errorf("running %s: %w", name, result.Err)
 	}
 	return nil
 }
@@ -8,7 +8,9 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/bootc"
 	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/ui"
 )
 
@@ -23,35 +25,83 @@ var manageStatusCmd = &cobra.Command{
 	RunE: runManageStatus,
 }
 
+// deviceStatus is the runtime status printed by status
+type deviceStatus struct {
+	OS         string            `json:"os"`
+	SetupDone  bool              `json:"setup_done"`
+	VSCodeInit bool              `json:"vscode_init"`
+	DevMode    string            `json:"dev_mode"`
+	Tools      map[string]bool   `json:"tools"`
+	Catalogs   []catalogCoverage `json:"catalogs"`
+	Bootc      *bootc.Host       `json:"bootc,omitempty"`
+}
+
+// catalogCoverage counts the installed items of one catalog
+type catalogCoverage struct {
+	Kind      catalogKind `json:"kind"`
+	Installed int         `json:"installed"`
+	Total     int         `json:"total"`
+	Error     string      `json:"error,omitempty"`
+}
+
 func runManageStatus(cmd *cobra.Command, args []string) error {
 	ctx := context.TODO()
 	if cmd != nil && cmd.Context() != nil {
 		ctx = cmd.Context()
 	}
 
+	tools := []string{"bootc", "brew", "flatpak", "ujust", "galena-build", "devcontainer"}
+	status := deviceStatus{
+		OS:         readOSReleaseValue("PRETTY_NAME", "unknown"),
+		SetupDone:  markerPresent(statePath("setup.done")),
+		VSCodeInit: markerPresent(statePath("vscode-settings.done")),
+		DevMode:    readStateValue(statePath("dev-mode"), "host-only"),
+		Tools:      map[string]bool{},
+		Catalogs: []catalogCoverage{
+			loadCatalogCoverage(catalogKindBrew),
+			loadCatalogCoverage(catalogKindFlatpak),
+		},
+	}
+	for _, tool := range tools {
+		status.Tools[tool] = galexec.CheckCommand(tool)
+	}
+
+	if output.IsJSON() {
+		if status.Tools["bootc"] {
+			status.Bootc, _ = bootc.Status(ctx)
+		}
+		return output.EmitSummary("status", status, nil)
+	}
+
 	ui.StartScreen("DEVICE STATUS", "Runtime overview for this Galena installation")
 
 	fmt.Println(ui.Title.Render("System"))
-	printKV("OS", readOSReleaseValue("PRETTY_NAME", "unknown"))
-	printKV("Setup Done", markerStatus("/var/lib/galena/setup.done"))
-	printKV("VS Code Init", markerStatus("/var/lib/galena/vscode-settings.done"))
-	printKV("Dev Mode", readStateValue("/var/lib/galena/dev-mode", "host-only"))
+	printKV("OS", status.OS)
+	printKV("Setup Done", markerStatus(statePath("setup.done")))
+	printKV("VS Code Init", markerStatus(statePath("vscode-settings.done")))
+	printKV("Dev Mode", status.DevMode)
 
 	fmt.Println()
 	fmt.Println(ui.Title.Render("Tooling"))
-	printTool("bootc")
-	printTool("brew")
-	printTool("flatpak")
-	printTool("ujust")
-	printTool("galena-build")
-	printTool("devcontainer")
+	for _, tool := range tools {
+		printTool(tool)
+	}
 
 	fmt.Println()
 	fmt.Println(ui.Title.Render("Catalog Coverage"))
-	printCatalogCoverage(catalogKindBrew, "Brew")
-	printCatalogCoverage(catalogKindFlatpak, "Flatpak")
+	for _, coverage := range status.Catalogs {
+		label := "Brew"
+		if coverage.Kind == catalogKindFlatpak {
+			label = "Flatpak"
+		}
+		if coverage.Error != "" {
+			printKV(label, ui.MutedStyle.Render("unavailable ("+coverage.Error+")"))
+			continue
+		}
+		printKV(label, fmt.Sprintf("%d/%d installed", coverage.Installed, coverage.Total))
+	}
 
-	if galexec.CheckCommand("bootc") {
+	if status.Tools["bootc"] {
 		fmt.Println()
 		fmt.Println(ui.Title.Render("Bootc Status"))
 		result := galexec.RunSimple(ctx, "bootc", "status")
@@ -74,20 +124,20 @@ func runManageStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func printCatalogCoverage(kind catalogKind, label string) {
+func loadCatalogCoverage(kind catalogKind) catalogCoverage {
+	coverage := catalogCoverage{Kind: kind}
 	items, err := loadCatalogForKinds([]catalogKind{kind})
 	if err != nil {
-		printKV(label, ui.MutedStyle.Render("unavailable ("+err.Error()+")"))
-		return
+		coverage.Error = err.Error()
+		return coverage
 	}
-	total := len(items)
-	installed := 0
+	coverage.Total = len(items)
 	for _, item := range items {
 		if item.Installed {
-			installed++
+			coverage.Installed++
 		}
 	}
-	printKV(label, fmt.Sprintf("%d/%d installed", installed, total))
+	return coverage
 }
 
 func printTool(name string) {
@@ -100,8 +150,13 @@ func printTool(name string) {
 	fmt.Printf("  %s %-14s %s\n", state, name, details)
 }
 
+func markerPresent(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 func markerStatus(path string) string {
-	if _, err := os.Stat(path); err == nil {
+	if markerPresent(path) {
 		return ui.SuccessStyle.Render("present")
 	}
 	return ui.MutedStyle.Render("missing")
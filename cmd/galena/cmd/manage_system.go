@@ -0,0 +1,489 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/privilege"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	systemApply     bool
+	systemCheck     bool
+	systemTransport string
+)
+
+var systemCmd = &cobra.Command{
+	Use:   "system",
+	Short: "Upgrade, roll back, and switch the OS image with bootc",
+	Long: `Manage the bootc deployments of this device.
+
+A bootc system keeps the booted deployment, an update staged for the next
+boot, and the previous deployment to roll back to. Without a subcommand a
+console shows them with the pending image digest and the package changelog.
+
+Subcommands:
+  status    - Show the staged, booted, and rollback deployments
+  upgrade   - Stage the latest version of the booted image
+  rollback  - Boot the previous deployment next
+  switch    - Track a different image
+  channel   - Switch between release channels
+  auto-update - Manage the automatic update timer
+  kargs     - List, add, and remove kernel arguments
+  pin       - Keep a deployment from being garbage collected
+  health    - Check whether the booted deployment is healthy
+
+Examples:
+  galena system
+  galena system status --output-format json
+  galena system upgrade --check
+  galena system upgrade --apply
+  galena system rollback
+  galena system switch ghcr.io/iiroan/galena:testing
+  galena system auto-update enable --schedule weekly`,
+	Args: cobra.NoArgs,
+	RunE: runSystem,
+}
+
+var systemStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the staged, booted, and rollback deployments",
+	Long: `Show the deployments from bootc status --json: the image, version,
+digest, and timestamp of each, and the digest of a pending update.
+
+Examples:
+  galena system status
+  galena system status --output-format json`,
+	Args: cobra.NoArgs,
+	RunE: runSystemStatus,
+}
+
+var systemUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Stage the latest version of the booted image",
+	Long: `Download the latest version of the booted image and stage it for the
+next boot with bootc upgrade. --check only looks for an update, and --apply
+reboots into it once staged.
+
+Examples:
+  galena system upgrade
+  galena system upgrade --check
+  galena system upgrade --apply -y`,
+	Args: cobra.NoArgs,
+	RunE: runSystemUpgrade,
+}
+
+var systemRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Boot the previous deployment next",
+	Long: `Swap the booted and rollback deployments with bootc rollback, so the
+next boot starts the previous image. A staged update is discarded.
+
+Examples:
+  galena system rollback
+  galena system rollback --apply -y`,
+	Args: cobra.NoArgs,
+	RunE: runSystemRollback,
+}
+
+var systemSwitchCmd = &cobra.Command{
+	Use:   "switch <image>",
+	Short: "Track a different image",
+	Long: `Stage a different image with bootc switch. Later upgrades follow the new
+image, which makes switch the way to move between tags such as stable and
+testing.
+
+Examples:
+  galena system switch ghcr.io/iiroan/galena:testing
+  galena system switch --transport containers-storage localhost/galena:dev`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSystemSwitch,
+}
+
+func init() {
+	systemCmd.AddCommand(systemStatusCmd)
+	systemCmd.AddCommand(systemUpgradeCmd)
+	systemCmd.AddCommand(systemRollbackCmd)
+	systemCmd.AddCommand(systemSwitchCmd)
+
+	for _, c := range []*cobra.Command{systemUpgradeCmd, systemRollbackCmd, systemSwitchCmd} {
+		c.Flags().BoolVar(&systemApply, "apply", false, "Reboot into the new deployment")
+	}
+	systemUpgradeCmd.Flags().BoolVar(&systemCheck, "check", false, "Only check for an update")
+	systemSwitchCmd.Flags().StringVar(&systemTransport, "transport", "registry", "Image transport (registry, oci, oci-archive, containers-storage)")
+}
+
+func runSystem(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("bootc"); err != nil {
+		return fmt.Errorf("bootc is required to manage the system: %w", err)
+	}
+	if !ui.IsInteractiveTerminal() {
+		return runSystemStatus(cmd, args)
+	}
+	defer ui.PushScreen("System")()
+
+	for {
+		host, err := loadHostStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		choice, err := ui.RunMenuWithOptions("SYSTEM", systemSummary(host), []ui.MenuItem{
+			{ID: "status", TitleText: "Deployments", Details: "Show the staged, booted, and rollback deployments"},
+			{ID: "changelog", TitleText: "Changelog", Details: "Package changes between the booted and staged deployment"},
+			{ID: "check", TitleText: "Check for Updates", Details: "Look for a newer version of the booted image"},
+			{ID: "upgrade", TitleText: "Stage Update", Details: "Download the latest image for the next boot"},
+			{ID: "rollback", TitleText: "Roll Back", Details: "Boot the previous deployment next"},
+			{ID: "switch", TitleText: "Switch Image", Details: "Track a different image or tag"},
+			{ID: "channel", TitleText: "Release Channel", Details: "Follow stable, latest, or beta builds"},
+			{ID: "health", TitleText: "Health Check", Details: "Failed units, free space, and boot state of this deployment"},
+			{ID: "kargs", TitleText: "Kernel Arguments", Details: "Show the kernel command line and recorded changes"},
+			{ID: "auto-update", TitleText: "Automatic Updates", Details: "Show the update timer schedule and last run"},
+			{ID: "back", TitleText: "Back", Details: "Return to the previous menu"},
+		}, ui.WithBackNavigation("Back"))
+		if err != nil {
+			return systemFallbackMenu(ctx)
+		}
+
+		switch choice {
+		case ui.MenuActionBack, ui.MenuActionHome, ui.MenuActionQuit, "back":
+			return ui.NavigationError(choice)
+		default:
+			if !runSystemActionWithPause(func() error { return runSystemChoice(ctx, choice) }) {
+				return nil
+			}
+		}
+	}
+}
+
+func systemFallbackMenu(ctx context.Context) error {
+	var choice string
+	err := huh.NewSelect[string]().
+		Title("System").
+		Description("Choose a deployment action").
+		Options(
+			huh.NewOption("Deployments", "status"),
+			huh.NewOption("Changelog", "changelog"),
+			huh.NewOption("Check for Updates", "check"),
+			huh.NewOption("Stage Update", "upgrade"),
+			huh.NewOption("Roll Back", "rollback"),
+			huh.NewOption("Switch Image", "switch"),
+			huh.NewOption("Release Channel", "channel"),
+			huh.NewOption("Health Check", "health"),
+			huh.NewOption("Kernel Arguments", "kargs"),
+			huh.NewOption("Automatic Updates", "auto-update"),
+			huh.NewOption("Back", "back"),
+		).
+		Value(&choice).
+		WithTheme(ui.HuhTheme()).
+		Run()
+	if err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return nil
+		}
+		return err
+	}
+	if choice == "back" {
+		return nil
+	}
+	return runSystemChoice(ctx, choice)
+}
+
+func runSystemChoice(ctx context.Context, choice string) error {
+	systemApply, systemCheck, assumeYes = false, false, false
+	switch choice {
+	case "status":
+		return runSystemStatus(systemStatusCmd, nil)
+	case "changelog":
+		return showSystemChangelog(ctx)
+	case "check":
+		systemCheck = true
+		return runSystemUpgrade(systemUpgradeCmd, nil)
+	case "upgrade":
+		return runSystemUpgrade(systemUpgradeCmd, nil)
+	case "rollback":
+		return runSystemRollback(systemRollbackCmd, nil)
+	case "channel":
+		channelVariant, channelNoVerify = "", false
+		return runSystemChannel(systemChannelCmd, nil)
+	case "health":
+		healthQuiet, healthRecordBoot = false, false
+		return runSystemHealth(systemHealthCmd, nil)
+	case "kargs":
+		kargsHistory = true
+		return runKargsList(systemKargsListCmd, nil)
+	case "auto-update":
+		return runAutoUpdateStatus(systemAutoUpdateStatusCmd, nil)
+	case "switch":
+		image := ""
+		err := huh.NewForm(
+			huh.NewGroup(
+				huh.NewInput().
+					Title("Image").
+					Description("Container image to track, e.g. ghcr.io/iiroan/galena:testing").
+					Value(&image),
+			),
+		).WithTheme(ui.HuhTheme()).Run()
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(image) == "" {
+			return nil
+		}
+		systemTransport = "registry"
+		return runSystemSwitch(systemSwitchCmd, []string{strings.TrimSpace(image)})
+	}
+	return nil
+}
+
+func runSystemActionWithPause(action func() error) bool {
+	err := action()
+	if err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return true
+		}
+		fmt.Println(ui.ErrorStyle.Render("Error: " + err.Error()))
+	}
+	if err := waitForEnter("Press enter to return to System"); err != nil {
+		fmt.Println(ui.WarningStyle.Render("Could not pause for input: " + err.Error()))
+		return false
+	}
+	return true
+}
+
+// loadHostStatus reads the bootc status, elevating when bootc only shows it to root
+func loadHostStatus(ctx context.Context) (*bootc.Host, error) {
+	host, err := bootc.Status(ctx)
+	if err == nil || privilege.IsRoot() || !galexec.CheckCommand("bootc") {
+		return host, err
+	}
+	result := privilegeEscalator().Run(ctx, "read the bootc deployment status", "bootc", []string{"status", "--json"}, galexec.DefaultOptions())
+	if result.Err != nil {
+		return nil, err
+	}
+	return bootc.ParseStatus([]byte(result.Stdout))
+}
+
+// systemSummary describes the booted image and any pending update in one line
+func systemSummary(host *bootc.Host) string {
+	summary := "Booted: " + defaultIfEmpty(host.BootedImage(), "unknown")
+	if b := host.Status.Booted; b != nil && b.Image != nil && b.Image.Version != "" {
+		summary += " (" + b.Image.Version + ")"
+	}
+	switch {
+	case host.Status.Staged != nil:
+		summary += " · update staged for next boot"
+	case host.PendingDigest() != "":
+		summary += " · update available " + bootc.ShortDigest(host.PendingDigest())
+	default:
+		summary += " · up to date"
+	}
+	return summary
+}
+
+func runSystemStatus(cmd *cobra.Command, args []string) error {
+	host, err := loadHostStatus(context.Background())
+	return output.Render("system status", host, err, func() {
+		ui.StartScreen("SYSTEM STATUS", "bootc deployments of this device")
+		if host.Spec.Image != nil {
+			printKV("Tracking", host.Spec.Image.Image)
+		}
+		pending := host.PendingDigest()
+		printKV("Pending", defaultIfEmpty(bootc.ShortDigest(pending), ui.MutedStyle.Render("none")))
+		if host.Status.RollbackQueued {
+			printKV("Next Boot", ui.WarningStyle.Render("rollback"))
+		}
+
+		for _, d := range host.Deployments() {
+			fmt.Println()
+			title := strings.ToUpper(d.Role[:1]) + d.Role[1:]
+			if d.Entry.Pinned {
+				title += " (pinned)"
+			}
+			fmt.Println(ui.Title.Render(title))
+			printBootEntry(d.Entry)
+		}
+	})
+}
+
+func printBootEntry(entry *bootc.BootEntry) {
+	if entry.Image == nil {
+		printKV("Image", ui.MutedStyle.Render("not an image deployment"))
+		return
+	}
+	printKV("Image", entry.Image.Image.Image)
+	printKV("Version", defaultIfEmpty(entry.Image.Version, "-"))
+	printKV("Digest", bootc.ShortDigest(entry.Image.ImageDigest))
+	if entry.Image.Timestamp != nil {
+		printKV("Built", entry.Image.Timestamp.Local().Format("2006-01-02 15:04"))
+	}
+	if entry.Incompatible {
+		printKV("Warning", ui.WarningStyle.Render("has local changes bootc cannot manage"))
+	}
+}
+
+func showSystemChangelog(ctx context.Context) error {
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return err
+	}
+	ui.StartScreen("CHANGELOG", "Package changes in the staged deployment")
+	if host.Status.Staged == nil {
+		fmt.Println(ui.InfoBox.Render("No update is staged.\n\nStage one with: galena system upgrade"))
+		return nil
+	}
+	changelog, err := bootc.Changelog(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println(changelog)
+	return nil
+}
+
+func runSystemUpgrade(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("bootc"); err != nil {
+		return fmt.Errorf("bootc is required for updates: %w", err)
+	}
+
+	if systemCheck {
+		err := runBootc(ctx, "check for a system update", "upgrade", "--check")
+		if output.IsJSON() {
+			host, _ := loadHostStatus(ctx)
+			return output.EmitSummary("system upgrade", host, err)
+		}
+		return err
+	}
+
+	if ok, err := confirmSystemAction("Stage a system update?", "bootc upgrade downloads the latest image for the next boot.", systemApply); !ok {
+		return err
+	}
+	upgradeArgs := []string{"upgrade"}
+	if systemApply {
+		upgradeArgs = append(upgradeArgs, "--apply")
+	}
+	err := runBootc(ctx, "stage a system update with bootc", upgradeArgs...)
+	if output.IsJSON() {
+		return output.EmitSummary("system upgrade", map[string]bool{"applied": systemApply}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render("System update staged.\n\nReboot to apply it, or review it with: galena system"))
+	return nil
+}
+
+func runSystemRollback(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if host.Status.Rollback == nil {
+		return fmt.Errorf("there is no rollback deployment")
+	}
+
+	target := "the previous deployment"
+	if r := host.Status.Rollback.Image; r != nil {
+		target = fmt.Sprintf("%s (%s)", r.Image.Image, defaultIfEmpty(r.Version, bootc.ShortDigest(r.ImageDigest)))
+	}
+	if ok, err := confirmSystemAction("Roll back?", "The next boot starts "+target+".", systemApply); !ok {
+		return err
+	}
+	rollbackArgs := []string{"rollback"}
+	if systemApply {
+		rollbackArgs = append(rollbackArgs, "--apply")
+	}
+	err = runBootc(ctx, "roll back to the previous deployment", rollbackArgs...)
+	if output.IsJSON() {
+		return output.EmitSummary("system rollback", map[string]string{"target": target}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render("Rollback queued.\n\nThe next boot starts " + target + "."))
+	return nil
+}
+
+func runSystemSwitch(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("bootc"); err != nil {
+		return fmt.Errorf("bootc is required to switch images: %w", err)
+	}
+	image := args[0]
+
+	if ok, err := confirmSystemAction("Switch to "+image+"?", "Later upgrades follow this image.", systemApply); !ok {
+		return err
+	}
+	switchArgs := []string{"switch", "--transport", systemTransport}
+	if systemApply {
+		switchArgs = append(switchArgs, "--apply")
+	}
+	switchArgs = append(switchArgs, image)
+	err := runBootc(ctx, "switch the system image with bootc", switchArgs...)
+	if output.IsJSON() {
+		return output.EmitSummary("system switch", map[string]string{"image": image, "transport": systemTransport}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Switched to %s.\n\nReboot to apply it.", image)))
+	return nil
+}
+
+// confirmSystemAction asks before changing the deployments unless --yes was
+// given. Non-interactive sessions must pass --yes.
+func confirmSystemAction(title, description string, reboot bool) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+	if !ui.IsInteractiveTerminal() {
+		return false, fmt.Errorf("pass --yes to confirm in a non-interactive session")
+	}
+	if reboot {
+		description += " The system reboots right away."
+	}
+	confirm := false
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title(title).
+				Description(description).
+				Value(&confirm),
+		),
+	).WithTheme(ui.HuhTheme()).Run()
+	if err != nil {
+		return false, err
+	}
+	if !confirm {
+		fmt.Println(ui.InfoBox.Render("Canceled."))
+	}
+	return confirm, nil
+}
+
+// runBootc runs bootc as root, streaming its output unless JSON output is selected
+func runBootc(ctx context.Context, reason string, args ...string) error {
+	opts := galexec.DefaultOptions()
+	opts.StreamStdio = !output.IsJSON()
+	result := privilegeEscalator().Run(ctx, reason, "bootc", args, opts)
+	if result.Err != nil {
+		return fmt.Errorf("bootc %s failed: %w", args[0], result.Err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	autoUpdateSchedule  string
+	autoUpdateMode      string
+	autoUpdateDelay     string
+	autoUpdateOnBattery bool
+	autoUpdateOnMetered bool
+	autoUpdateKeepBootc bool
+	autoUpdateHealthy   bool
+)
+
+var systemAutoUpdateCmd = &cobra.Command{
+	Use:   "auto-update",
+	Short: "Manage the automatic update timer",
+	Long: `Install and manage a systemd timer that runs bootc upgrade on a schedule.
+
+The timer and service are generated by galena and written to
+/etc/systemd/system. Runs are skipped on battery power and on metered
+networks unless --on-battery or --on-metered is given, and with
+--require-healthy while galena system health reports a problem. While the
+galena timer is enabled the stock bootc-fetch-apply-updates.timer is disabled.
+
+Modes:
+  check  - Only look for an update; galena system shows it as available
+  stage  - Stage the update for the next boot
+  apply  - Stage the update and reboot into it
+
+Examples:
+  galena system auto-update status
+  galena system auto-update enable
+  galena system auto-update enable --schedule "Sun 03:00" --mode apply
+  galena system auto-update disable`,
+	Args: cobra.NoArgs,
+	RunE: runAutoUpdateStatus,
+}
+
+var systemAutoUpdateEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Install and start the automatic update timer",
+	Long: `Write the galena-auto-update service and timer and enable the timer.
+Running enable again replaces the units with the new settings.
+
+Examples:
+  galena system auto-update enable
+  galena system auto-update enable --schedule weekly --mode check
+  galena system auto-update enable --on-battery --on-metered
+  galena system auto-update enable --mode apply --require-healthy`,
+	Args: cobra.NoArgs,
+	RunE: runAutoUpdateEnable,
+}
+
+var systemAutoUpdateDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop and remove the automatic update timer",
+	Long: `Disable the galena-auto-update timer, remove its units, and re-enable
+the stock bootc-fetch-apply-updates.timer unless --keep-bootc-timer-off is given.
+
+Examples:
+  galena system auto-update disable
+  galena system auto-update disable --keep-bootc-timer-off`,
+	Args: cobra.NoArgs,
+	RunE: runAutoUpdateDisable,
+}
+
+var systemAutoUpdateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the automatic update schedule and last run",
+	Args:  cobra.NoArgs,
+	RunE:  runAutoUpdateStatus,
+}
+
+func init() {
+	systemCmd.AddCommand(systemAutoUpdateCmd)
+	systemAutoUpdateCmd.AddCommand(systemAutoUpdateEnableCmd)
+	systemAutoUpdateCmd.AddCommand(systemAutoUpdateDisableCmd)
+	systemAutoUpdateCmd.AddCommand(systemAutoUpdateStatusCmd)
+
+	defaults := bootc.DefaultAutoUpdateConfig()
+	systemAutoUpdateEnableCmd.Flags().StringVar(&autoUpdateSchedule, "schedule", defaults.Schedule, "systemd OnCalendar schedule (daily, weekly, \"Sun 03:00\")")
+	systemAutoUpdateEnableCmd.Flags().StringVar(&autoUpdateMode, "mode", defaults.Mode, "What a run does (check, stage, apply)")
+	systemAutoUpdateEnableCmd.Flags().StringVar(&autoUpdateDelay, "random-delay", defaults.RandomDelay, "Randomized delay added to each run")
+	systemAutoUpdateEnableCmd.Flags().BoolVar(&autoUpdateOnBattery, "on-battery", false, "Also run on battery power")
+	systemAutoUpdateEnableCmd.Flags().BoolVar(&autoUpdateOnMetered, "on-metered", false, "Also run on metered networks")
+	systemAutoUpdateEnableCmd.Flags().BoolVar(&autoUpdateHealthy, "require-healthy", false, "Skip runs while galena system health reports a problem")
+	systemAutoUpdateDisableCmd.Flags().BoolVar(&autoUpdateKeepBootc, "keep-bootc-timer-off", false, "Leave bootc-fetch-apply-updates.timer disabled")
+}
+
+func autoUpdateUnitPath(suffix string) string {
+	return filepath.Join(bootc.AutoUpdateUnitDir, bootc.AutoUpdateUnit+suffix)
+}
+
+func runAutoUpdateEnable(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("systemctl", "bootc"); err != nil {
+		return fmt.Errorf("automatic updates need systemd and bootc: %w", err)
+	}
+
+	cfg := bootc.AutoUpdateConfig{
+		Schedule:        autoUpdateSchedule,
+		Mode:            autoUpdateMode,
+		RandomDelay:     autoUpdateDelay,
+		SkipOnBattery:   !autoUpdateOnBattery,
+		SkipWhenMetered: !autoUpdateOnMetered,
+		RequireHealthy:  autoUpdateHealthy,
+		GalenaPath:      galenaExecutable(),
+	}
+	if err := cfg.Validate(ctx); err != nil {
+		return err
+	}
+	if cfg.Mode == bootc.AutoUpdateApply {
+		if ok, err := confirmSystemAction("Enable automatic reboots?", "In apply mode each run that finds an update reboots the device.", false); !ok {
+			return err
+		}
+	}
+
+	reason := "install the automatic update timer"
+	if err := privilegeEscalator().WriteFile(ctx, reason, autoUpdateUnitPath(".service"), []byte(cfg.ServiceUnit())); err != nil {
+		return err
+	}
+	if err := privilegeEscalator().WriteFile(ctx, reason, autoUpdateUnitPath(".timer"), []byte(cfg.TimerUnit())); err != nil {
+		return err
+	}
+	if err := runSystemctl(ctx, reason, "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runSystemctl(ctx, reason, "enable", "--now", bootc.AutoUpdateUnit+".timer"); err != nil {
+		return err
+	}
+	if err := runSystemctl(ctx, reason, "disable", "--now", bootc.StockUpdateTimer); err != nil {
+		logger.Warn("could not disable the stock bootc timer", "timer", bootc.StockUpdateTimer, "error", err)
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("system auto-update enable", cfg, nil)
+	}
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Automatic updates enabled.\n\nSchedule: %s\nMode: %s", cfg.Schedule, cfg.Mode)))
+	return nil
+}
+
+func runAutoUpdateDisable(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("systemctl"); err != nil {
+		return err
+	}
+
+	reason := "remove the automatic update timer"
+	if err := runSystemctl(ctx, reason, "disable", "--now", bootc.AutoUpdateUnit+".timer"); err != nil {
+		logger.Warn("could not disable the auto-update timer", "error", err)
+	}
+	for _, suffix := range []string{".timer", ".service"} {
+		path := autoUpdateUnitPath(suffix)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if result := privilegeEscalator().Run(ctx, reason, "rm", []string{"-f", path}, galexec.DefaultOptions()); result.Err != nil {
+			return fmt.Errorf("removing %s: %w", path, result.Err)
+		}
+	}
+	if err := runSystemctl(ctx, reason, "daemon-reload"); err != nil {
+		return err
+	}
+	if !autoUpdateKeepBootc {
+		if err := runSystemctl(ctx, reason, "enable", bootc.StockUpdateTimer); err != nil {
+			logger.Warn("could not re-enable the stock bootc timer", "timer", bootc.StockUpdateTimer, "error", err)
+		}
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("system auto-update disable", map[string]bool{"bootcTimerRestored": !autoUpdateKeepBootc}, nil)
+	}
+	fmt.Println(ui.SuccessBox.Render("Automatic updates disabled."))
+	return nil
+}
+
+// autoUpdateStatus is the JSON shape of galena system auto-update status
+type autoUpdateStatus struct {
+	Installed bool                    `json:"installed"`
+	Config    *bootc.AutoUpdateConfig `json:"config,omitempty"`
+	Timer     bootc.TimerState        `json:"timer"`
+	Pending   string                  `json:"pending,omitempty"`
+	Staged    bool                    `json:"staged"`
+}
+
+func loadAutoUpdateStatus(ctx context.Context) (autoUpdateStatus, error) {
+	var status autoUpdateStatus
+	service, serviceErr := os.ReadFile(autoUpdateUnitPath(".service"))
+	timer, timerErr := os.ReadFile(autoUpdateUnitPath(".timer"))
+	if serviceErr == nil && timerErr == nil {
+		cfg := bootc.ParseAutoUpdateUnits(string(service), string(timer))
+		status.Installed = true
+		status.Config = &cfg
+	}
+	if host, err := loadHostStatus(ctx); err == nil {
+		status.Pending = host.PendingDigest()
+		status.Staged = host.Status.Staged != nil
+	}
+	state, err := bootc.AutoUpdateTimerState(ctx)
+	status.Timer = state
+	return status, err
+}
+
+func runAutoUpdateStatus(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	status, err := loadAutoUpdateStatus(ctx)
+	if output.IsJSON() {
+		return output.EmitSummary("system auto-update status", status, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.StartScreen("AUTO-UPDATE", "Scheduled bootc upgrades")
+	if !status.Installed {
+		fmt.Println(ui.InfoBox.Render("Automatic updates are not managed by galena.\n\nEnable them with: galena system auto-update enable"))
+		return nil
+	}
+	enabled := ui.WarningStyle.Render("disabled")
+	if status.Timer.Enabled {
+		enabled = ui.SuccessStyle.Render("enabled")
+	}
+	printKV("Timer", enabled)
+	printKV("Schedule", status.Config.Schedule)
+	printKV("Mode", status.Config.Mode)
+	printKV("On Battery", skipLabel(status.Config.SkipOnBattery))
+	printKV("On Metered", skipLabel(status.Config.SkipWhenMetered))
+	if status.Config.RequireHealthy {
+		printKV("Unhealthy", skipLabel(true))
+	}
+	if t := status.Timer.NextRun; t != nil {
+		printKV("Next Run", t.Local().Format("2006-01-02 15:04"))
+	}
+	if t := status.Timer.LastRun; t != nil {
+		printKV("Last Run", t.Local().Format("2006-01-02 15:04")+" ("+defaultIfEmpty(status.Timer.LastResult, "unknown")+")")
+	}
+
+	switch {
+	case status.Staged:
+		fmt.Println()
+		fmt.Println(ui.InfoBox.Render("An update is staged for the next boot.\n\nReview it with: galena system"))
+	case status.Pending != "":
+		fmt.Println()
+		fmt.Println(ui.InfoBox.Render("Update " + bootc.ShortDigest(status.Pending) + " is available.\n\nStage it with: galena system upgrade"))
+	}
+	return nil
+}
+
+func skipLabel(skip bool) string {
+	if skip {
+		return "skip"
+	}
+	return "run"
+}
+
+// runSystemctl runs a systemctl command, as root when polkit refuses it
+func runSystemctl(ctx context.Context, reason string, args ...string) error {
+	opts := galexec.DefaultOptions()
+	opts.Escalate = reason
+	result := galexec.Run(ctx, "systemctl", args, opts)
+	if result.Err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", args[0], result.Err, galexec.LastNLines(result.Stderr, 3))
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ref"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+// deviceConfigPaths are searched for galena.yaml when --config is not given:
+// a local override, then the copy shipped in the image (written by
+// galena-build config device)
+var deviceConfigPaths = []string{
+	"/etc/galena/galena.yaml",
+	"/usr/share/galena/galena.yaml",
+}
+
+var (
+	channelVariant  string
+	channelNoVerify bool
+)
+
+var systemChannelCmd = &cobra.Command{
+	Use:   "channel",
+	Short: "Switch between release channels",
+	Long: `Follow a different release channel of the booted image.
+
+Channels come from channels: in galena.yaml, read from --config,
+/etc/galena/galena.yaml, or the copy shipped in the image. Each channel is an
+image tag; set rewrites the tag of the booted image, verifies the target
+exists and is signed, and stages the switch with bootc switch.
+
+Without a subcommand an interactive picker lists the channels with the build
+date of their latest image.
+
+Subcommands:
+  list  - Show the channels and their latest builds
+  set   - Stage the switch to a channel
+
+Examples:
+  galena system channel
+  galena system channel list
+  galena system channel set beta
+  galena system channel set stable --variant nvidia --apply -y`,
+	Args: cobra.NoArgs,
+	RunE: runSystemChannel,
+}
+
+var systemChannelListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the channels and their latest builds",
+	Args:  cobra.NoArgs,
+	RunE:  runSystemChannelList,
+}
+
+var systemChannelSetCmd = &cobra.Command{
+	Use:   "set <channel>",
+	Short: "Stage the switch to a channel",
+	Long: `Rewrite the tag of the booted image to the channel tag, verify the
+target with the verify: constraints in galena.yaml, and stage it with bootc
+switch. --variant also switches to the image of another variant, which needs
+registry and repository set in galena.yaml.
+
+Examples:
+  galena system channel set beta
+  galena system channel set stable --variant nvidia
+  galena system channel set latest --no-verify`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSystemChannelSet,
+}
+
+func init() {
+	systemCmd.AddCommand(systemChannelCmd)
+	systemChannelCmd.AddCommand(systemChannelListCmd)
+	systemChannelCmd.AddCommand(systemChannelSetCmd)
+
+	for _, c := range []*cobra.Command{systemChannelCmd, systemChannelListCmd, systemChannelSetCmd} {
+		c.Flags().StringVar(&channelVariant, "variant", "", "Follow the image of this variant instead of the booted one")
+	}
+	systemChannelCmd.Flags().BoolVar(&channelNoVerify, "no-verify", false, "Skip signature verification")
+	systemChannelSetCmd.Flags().BoolVar(&channelNoVerify, "no-verify", false, "Skip signature verification")
+	systemChannelSetCmd.Flags().BoolVar(&systemApply, "apply", false, "Reboot into the new deployment")
+}
+
+// deviceConfig returns the configuration given with --config, else the
+// first galena.yaml found in deviceConfigPaths, else the defaults
+func deviceConfig() *config.Config {
+	if cfgFile != "" {
+		return cfg
+	}
+	for _, path := range deviceConfigPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		loaded, err := config.Load(path)
+		if err != nil {
+			logger.Warn("could not load config", "path", path, "error", err)
+			continue
+		}
+		return loaded
+	}
+	return cfg
+}
+
+// channelStatus is a channel with the latest image it points to
+type channelStatus struct {
+	Channel config.Channel     `json:"channel"`
+	Image   string             `json:"image"`
+	Current bool               `json:"current"`
+	Latest  *build.RemoteImage `json:"latest,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// channelImage returns the image a channel points to for the booted image
+// or, with --variant, for another variant
+func channelImage(c *config.Config, booted string, channel config.Channel) (string, error) {
+	if channelVariant != "" {
+		if _, err := c.GetVariant(channelVariant); err != nil {
+			return "", err
+		}
+		if !c.HasRegistry(channelVariant) {
+			return "", fmt.Errorf("--variant needs registry and repository set in galena.yaml")
+		}
+		return c.ImageRef(channelVariant, channel.ImageTag()), nil
+	}
+	if booted == "" {
+		return "", fmt.Errorf("the booted deployment is not an image; pass --variant")
+	}
+	r, err := ref.Parse(booted)
+	if err != nil {
+		return "", err
+	}
+	r.Digest = ""
+	target := r.WithTag(channel.ImageTag())
+	if err := target.Validate(); err != nil {
+		return "", fmt.Errorf("invalid channel tag %q: %w", channel.ImageTag(), err)
+	}
+	return target.String(), nil
+}
+
+// loadChannels resolves every channel to its image and latest build
+func loadChannels(ctx context.Context, c *config.Config) ([]channelStatus, error) {
+	if len(c.Channels) == 0 {
+		return nil, fmt.Errorf("no channels defined in galena.yaml")
+	}
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	booted := host.BootedImage()
+
+	statuses := make([]channelStatus, 0, len(c.Channels))
+	for _, ch := range c.Channels {
+		image, err := channelImage(c, booted, ch)
+		if err != nil {
+			return nil, err
+		}
+		status := channelStatus{Channel: ch, Image: image, Current: image == booted}
+		if latest, err := build.InspectRemote(ctx, image); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Latest = latest
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// channelDetails describes the latest build of a channel in one line
+func channelDetails(s channelStatus) string {
+	if s.Latest == nil {
+		return "unavailable"
+	}
+	parts := []string{bootc.ShortDigest(s.Latest.Digest)}
+	if s.Latest.Version != "" {
+		parts = append(parts, s.Latest.Version)
+	}
+	if s.Latest.Created != nil {
+		parts = append(parts, "built "+s.Latest.Created.Local().Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func runSystemChannel(cmd *cobra.Command, args []string) error {
+	if output.IsJSON() || !ui.IsInteractiveTerminal() {
+		return runSystemChannelList(cmd, args)
+	}
+	ctx := context.Background()
+	defer ui.PushScreen("Channels")()
+
+	var statuses []channelStatus
+	err := ui.RunWithSpinner("Looking up channels", func() error {
+		var err error
+		statuses, err = loadChannels(ctx, deviceConfig())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	items := make([]ui.MenuItem, 0, len(statuses)+1)
+	current := ""
+	for _, s := range statuses {
+		title := s.Channel.Name
+		if s.Current {
+			title += " (current)"
+			current = s.Channel.Name
+		}
+		details := channelDetails(s)
+		if s.Channel.Description != "" {
+			details = s.Channel.Description + " · " + details
+		}
+		items = append(items, ui.MenuItem{ID: s.Channel.Name, TitleText: title, Details: details})
+	}
+	items = append(items, ui.MenuItem{ID: "back", TitleText: "Back", Details: "Return to the previous menu"})
+
+	choice, err := ui.RunMenuWithOptions("CHANNELS", "Pick the release channel this device follows.", items,
+		ui.WithBackNavigation("Back"), ui.WithInitialSelectionID(current))
+	if err != nil {
+		return err
+	}
+	switch choice {
+	case ui.MenuActionBack, ui.MenuActionHome, ui.MenuActionQuit, "back", "":
+		return ui.NavigationError(choice)
+	case current:
+		fmt.Println(ui.InfoBox.Render("This device already follows " + current + "."))
+		return nil
+	}
+	return runSystemChannelSet(systemChannelSetCmd, []string{choice})
+}
+
+func runSystemChannelList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	statuses, err := loadChannels(ctx, deviceConfig())
+	if output.IsJSON() {
+		return output.EmitSummary("system channel list", statuses, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.StartScreen("CHANNELS", "Release channels of the booted image")
+	for _, s := range statuses {
+		name := s.Channel.Name
+		if s.Current {
+			name = ui.SuccessStyle.Render(name + " *")
+		}
+		printKV(name, s.Image)
+		if s.Latest == nil {
+			printKV("", ui.WarningStyle.Render(s.Error))
+			continue
+		}
+		printKV("", channelDetails(s))
+	}
+	return nil
+}
+
+func runSystemChannelSet(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("bootc"); err != nil {
+		return fmt.Errorf("bootc is required to switch channels: %w", err)
+	}
+	c := deviceConfig()
+	channel, err := c.GetChannel(args[0])
+	if err != nil {
+		return fmt.Errorf("%w (channels: %s)", err, strings.Join(channelNames(c), ", "))
+	}
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return err
+	}
+	target, err := channelImage(c, host.BootedImage(), *channel)
+	if err != nil {
+		return err
+	}
+
+	latest, err := build.InspectRemote(ctx, target)
+	if err != nil {
+		return fmt.Errorf("channel %s has no image: %w", channel.Name, err)
+	}
+	if !channelNoVerify {
+		if _, err := build.VerifyImage(ctx, target, c.Verify); err != nil {
+			return fmt.Errorf("%s is not signed as galena.yaml requires (pass --no-verify to skip): %w", target, err)
+		}
+	}
+
+	description := fmt.Sprintf("bootc switch stages %s (%s). Later upgrades follow the %s channel.", target, bootc.ShortDigest(latest.Digest), channel.Name)
+	if ok, err := confirmSystemAction("Switch to the "+channel.Name+" channel?", description, systemApply); !ok {
+		return err
+	}
+	switchArgs := []string{"switch", "--transport", "registry"}
+	if systemApply {
+		switchArgs = append(switchArgs, "--apply")
+	}
+	err = runBootc(ctx, "switch the release channel with bootc", append(switchArgs, target)...)
+	if output.IsJSON() {
+		return output.EmitSummary("system channel set", map[string]any{"channel": channel.Name, "image": target, "latest": latest, "verified": !channelNoVerify}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Switched to the %s channel.\n\n%s\n\nReboot to apply it.", channel.Name, target)))
+	return nil
+}
+
+func channelNames(c *config.Config) []string {
+	names := make([]string, len(c.Channels))
+	for i, ch := range c.Channels {
+		names[i] = ch.Name
+	}
+	return names
+}
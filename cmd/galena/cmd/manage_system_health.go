@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+// bootHealthFile counts unhealthy boots of the booted deployment
+const bootHealthFile = "boot-health.json"
+
+var (
+	pinUnpin            bool
+	healthQuiet         bool
+	healthRecordBoot    bool
+	healthRollbackAfter int
+	healthMinFreeGB     int
+	healthIgnoreUnits   []string
+)
+
+var systemPinCmd = &cobra.Command{
+	Use:   "pin <booted|rollback>",
+	Short: "Keep a deployment from being garbage collected",
+	Long: `Pin a deployment with ostree admin pin so later upgrades do not remove
+it. A pinned deployment stays available to boot from the bootloader menu.
+
+Examples:
+  galena system pin booted
+  galena system pin rollback --unpin`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"booted", "rollback"},
+	RunE:      runSystemPin,
+}
+
+var systemHealthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check whether the booted deployment is healthy",
+	Long: `Run greenboot-style health checks: the system finished booting, no
+systemd units failed, and the sysroot and /var have free space. The command
+exits non-zero when a check fails, so it can gate automatic updates with
+galena system auto-update enable --require-healthy.
+
+--record-boot counts unhealthy boots of the booted deployment in
+/var/lib/galena, and --rollback-after rolls back and reboots once the count
+is reached. The boot check service installed by galena system health install
+runs both once per boot.
+
+Examples:
+  galena system health
+  galena system health --ignore-unit nvidia-powerd.service
+  galena system health install --rollback-after 3`,
+	Args: cobra.NoArgs,
+	RunE: runSystemHealth,
+}
+
+var systemHealthInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Check health once per boot with a systemd service",
+	Long: `Write and enable the galena-boot-health service, which records the health
+of every boot and optionally rolls back after repeated unhealthy boots.
+
+Examples:
+  galena system health install
+  galena system health install --rollback-after 3`,
+	Args: cobra.NoArgs,
+	RunE: runSystemHealthInstall,
+}
+
+var systemHealthUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the boot health check service",
+	Args:  cobra.NoArgs,
+	RunE:  runSystemHealthUninstall,
+}
+
+func init() {
+	systemCmd.AddCommand(systemPinCmd)
+	systemCmd.AddCommand(systemHealthCmd)
+	systemHealthCmd.AddCommand(systemHealthInstallCmd)
+	systemHealthCmd.AddCommand(systemHealthUninstallCmd)
+
+	systemPinCmd.Flags().BoolVar(&pinUnpin, "unpin", false, "Remove the pin instead")
+
+	defaults := bootc.DefaultHealthOptions()
+	systemHealthCmd.Flags().BoolVarP(&healthQuiet, "quiet", "q", false, "Only set the exit status")
+	systemHealthCmd.Flags().BoolVar(&healthRecordBoot, "record-boot", false, "Count the result against the booted deployment")
+	systemHealthCmd.Flags().IntVar(&healthMinFreeGB, "min-free", defaults.MinFreeGB, "Minimum free space in GiB")
+	systemHealthCmd.Flags().StringSliceVar(&healthIgnoreUnits, "ignore-unit", nil, "Failed unit that does not count as unhealthy (repeatable)")
+	for _, c := range []*cobra.Command{systemHealthCmd, systemHealthInstallCmd} {
+		c.Flags().IntVar(&healthRollbackAfter, "rollback-after", 0, "Roll back after this many unhealthy boots (0 disables)")
+	}
+}
+
+func runSystemPin(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("ostree"); err != nil {
+		return fmt.Errorf("ostree is required to pin deployments: %w", err)
+	}
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return err
+	}
+	pinArgs, err := host.PinArgs(args[0], pinUnpin)
+	if err != nil {
+		return err
+	}
+
+	result := privilegeEscalator().Run(ctx, "pin a deployment with ostree", "ostree", pinArgs, galexec.DefaultOptions())
+	if output.IsJSON() {
+		return output.EmitSummary("system pin", map[string]any{"deployment": args[0], "pinned": !pinUnpin}, result.Err)
+	}
+	if result.Err != nil {
+		return fmt.Errorf("ostree admin pin failed: %w: %s", result.Err, galexec.LastNLines(result.Stderr, 3))
+	}
+	action := "pinned"
+	if pinUnpin {
+		action = "unpinned"
+	}
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("The %s deployment is %s.", args[0], action)))
+	return nil
+}
+
+// bootHealth counts consecutive unhealthy boots of one deployment
+type bootHealth struct {
+	Digest         string    `json:"digest"`
+	UnhealthyBoots int       `json:"unhealthyBoots"`
+	LastCheck      time.Time `json:"lastCheck"`
+}
+
+func runSystemHealth(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	opts := bootc.DefaultHealthOptions()
+	opts.MinFreeGB = healthMinFreeGB
+	opts.IgnoreUnits = healthIgnoreUnits
+	report := bootc.CheckHealth(ctx, opts)
+
+	var record *bootHealth
+	if healthRecordBoot {
+		r, err := recordBootHealth(ctx, report.Healthy)
+		if err != nil {
+			logger.Warn("could not record boot health", "error", err)
+		}
+		record = r
+	}
+
+	var err error
+	if !report.Healthy {
+		err = fmt.Errorf("the system is unhealthy")
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("system health", map[string]any{"report": report, "boot": record}, err)
+	}
+	if !healthQuiet {
+		ui.StartScreen("SYSTEM HEALTH", "Checks of the booted deployment")
+		for _, c := range report.Checks {
+			status := ui.SuccessStyle.Render("ok")
+			if !c.OK {
+				status = ui.ErrorStyle.Render("fail")
+			}
+			printKV(c.Name, status+"  "+c.Detail)
+		}
+		if record != nil {
+			printKV("Unhealthy Boots", fmt.Sprint(record.UnhealthyBoots))
+		}
+	}
+
+	if record != nil && healthRollbackAfter > 0 && record.UnhealthyBoots >= healthRollbackAfter {
+		return rollbackUnhealthy(ctx, record)
+	}
+	return err
+}
+
+// recordBootHealth updates the unhealthy boot count of the booted deployment
+func recordBootHealth(ctx context.Context, healthy bool) (*bootHealth, error) {
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	digest := ""
+	if b := host.Status.Booted; b != nil && b.Image != nil {
+		digest = b.Image.ImageDigest
+	}
+
+	var record bootHealth
+	if data, err := os.ReadFile(statePath(bootHealthFile)); err == nil {
+		_ = json.Unmarshal(data, &record)
+	}
+	if record.Digest != digest || healthy {
+		record.UnhealthyBoots = 0
+	}
+	record.Digest = digest
+	if !healthy {
+		record.UnhealthyBoots++
+	}
+	record.LastCheck = time.Now().UTC()
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return &record, err
+	}
+	return &record, writeStateFile(ctx, bootHealthFile, data)
+}
+
+// rollbackUnhealthy boots the rollback deployment after repeated unhealthy boots
+func rollbackUnhealthy(ctx context.Context, record *bootHealth) error {
+	host, err := loadHostStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if host.Status.Rollback == nil {
+		return fmt.Errorf("%d unhealthy boots but there is no rollback deployment", record.UnhealthyBoots)
+	}
+	logger.Warn("rolling back after unhealthy boots", "boots", record.UnhealthyBoots, "digest", bootc.ShortDigest(record.Digest))
+	return runBootc(ctx, "roll back an unhealthy deployment", "rollback", "--apply")
+}
+
+func healthUnitPath() string {
+	return filepath.Join(bootc.AutoUpdateUnitDir, bootc.HealthUnit+".service")
+}
+
+func runSystemHealthInstall(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("systemctl"); err != nil {
+		return err
+	}
+	reason := "install the boot health check"
+	unit := bootc.HealthServiceUnit(galenaExecutable(), healthRollbackAfter)
+	if err := privilegeEscalator().WriteFile(ctx, reason, healthUnitPath(), []byte(unit)); err != nil {
+		return err
+	}
+	if err := runSystemctl(ctx, reason, "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runSystemctl(ctx, reason, "enable", bootc.HealthUnit+".service"); err != nil {
+		return err
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("system health install", map[string]int{"rollbackAfter": healthRollbackAfter}, nil)
+	}
+	message := "Boot health check installed.\n\nEvery boot is checked and recorded."
+	if healthRollbackAfter > 0 {
+		message += fmt.Sprintf("\nAfter %d unhealthy boots the system rolls back.", healthRollbackAfter)
+	}
+	fmt.Println(ui.SuccessBox.Render(message))
+	return nil
+}
+
+func runSystemHealthUninstall(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := galexec.RequireCommands("systemctl"); err != nil {
+		return err
+	}
+	reason := "remove the boot health check"
+	if err := runSystemctl(ctx, reason, "disable", bootc.HealthUnit+".service"); err != nil {
+		logger.Warn("could not disable the boot health check", "error", err)
+	}
+	if result := privilegeEscalator().Run(ctx, reason, "rm", []string{"-f", healthUnitPath()}, galexec.DefaultOptions()); result.Err != nil {
+		return fmt.Errorf("removing %s: %w", healthUnitPath(), result.Err)
+	}
+	if err := runSystemctl(ctx, reason, "daemon-reload"); err != nil {
+		return err
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("system health uninstall", nil, nil)
+	}
+	fmt.Println(ui.SuccessBox.Render("Boot health check removed."))
+	return nil
+}
+
+// galenaExecutable returns the path generated units run galena from
+func galenaExecutable() string {
+	if path, err := os.Executable(); err == nil && filepath.IsAbs(path) {
+		return path
+	}
+	return "/usr/bin/galena"
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+// kargsHistoryFile records kernel argument changes in the state directory
+const kargsHistoryFile = "kargs-history.jsonl"
+
+var kargsHistory bool
+
+var systemKargsCmd = &cobra.Command{
+	Use:   "kargs",
+	Short: "List, add, and remove kernel arguments",
+	Long: `Manage the kernel arguments of the deployment with rpm-ostree kargs.
+
+Changes create a new deployment with the updated arguments, which takes
+effect on the next boot. Arguments owned by ostree and the bootloader, such
+as root= and ostree=, are refused. Every change is recorded in
+/var/lib/galena/kargs-history.jsonl.
+
+Subcommands:
+  list    - Show the kernel arguments of the booted deployment
+  add     - Append kernel arguments
+  remove  - Delete kernel arguments
+
+Examples:
+  galena system kargs
+  galena system kargs list --history
+  galena system kargs add mitigations=off
+  galena system kargs remove quiet rhgb`,
+	Args: cobra.NoArgs,
+	RunE: runKargsList,
+}
+
+var systemKargsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the kernel arguments of the booted deployment",
+	Args:  cobra.NoArgs,
+	RunE:  runKargsList,
+}
+
+var systemKargsAddCmd = &cobra.Command{
+	Use:   "add <karg>...",
+	Short: "Append kernel arguments",
+	Long: `Append kernel arguments to the next deployment. Arguments that are
+already set are skipped.
+
+Examples:
+  galena system kargs add mitigations=off
+  galena system kargs add amd_pstate=active --apply -y`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runKargsAdd,
+}
+
+var systemKargsRemoveCmd = &cobra.Command{
+	Use:   "remove <karg>...",
+	Short: "Delete kernel arguments",
+	Long: `Delete kernel arguments from the next deployment. Give key=value to
+delete one value of a repeated argument.
+
+Examples:
+  galena system kargs remove quiet
+  galena system kargs remove console=ttyS0`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runKargsRemove,
+}
+
+func init() {
+	systemCmd.AddCommand(systemKargsCmd)
+	systemKargsCmd.AddCommand(systemKargsListCmd)
+	systemKargsCmd.AddCommand(systemKargsAddCmd)
+	systemKargsCmd.AddCommand(systemKargsRemoveCmd)
+
+	for _, c := range []*cobra.Command{systemKargsCmd, systemKargsListCmd} {
+		c.Flags().BoolVar(&kargsHistory, "history", false, "Also show recorded kernel argument changes")
+	}
+	for _, c := range []*cobra.Command{systemKargsAddCmd, systemKargsRemoveCmd} {
+		c.Flags().BoolVar(&systemApply, "apply", false, "Reboot into the new deployment")
+	}
+}
+
+// kargsList is the JSON shape of galena system kargs list
+type kargsList struct {
+	Kargs   []string            `json:"kargs"`
+	History []bootc.KargsChange `json:"history,omitempty"`
+}
+
+func runKargsList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	kargs, err := bootc.Kargs(ctx)
+	list := kargsList{Kargs: kargs}
+	if err == nil && kargsHistory {
+		list.History, err = loadKargsHistory()
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("system kargs list", list, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.StartScreen("KERNEL ARGUMENTS", "Kernel command line of the booted deployment")
+	for _, k := range kargs {
+		if bootc.CheckKarg(k) != nil {
+			fmt.Println("  " + ui.MutedStyle.Render(k))
+			continue
+		}
+		fmt.Println("  " + k)
+	}
+	if !kargsHistory {
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Title.Render("History"))
+	if len(list.History) == 0 {
+		fmt.Println(ui.MutedStyle.Render("  No recorded changes"))
+	}
+	for _, c := range list.History {
+		var parts []string
+		for _, a := range c.Added {
+			parts = append(parts, "+"+a)
+		}
+		for _, r := range c.Removed {
+			parts = append(parts, "-"+r)
+		}
+		printKV(c.Time.Local().Format("2006-01-02 15:04"), strings.Join(parts, " "))
+	}
+	return nil
+}
+
+func runKargsAdd(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	current, err := bootc.Kargs(ctx)
+	if err != nil {
+		return err
+	}
+	var add []string
+	for _, a := range args {
+		if err := bootc.CheckKarg(a); err != nil {
+			return err
+		}
+		if slices.Contains(current, a) {
+			logger.Info("kernel argument already set", "karg", a)
+			continue
+		}
+		add = append(add, a)
+	}
+	return changeKargs(ctx, add, nil)
+}
+
+func runKargsRemove(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	current, err := bootc.Kargs(ctx)
+	if err != nil {
+		return err
+	}
+	var remove []string
+	for _, r := range args {
+		if err := bootc.CheckKarg(r); err != nil {
+			return err
+		}
+		if !kargSet(current, r) {
+			logger.Info("kernel argument not set", "karg", r)
+			continue
+		}
+		remove = append(remove, r)
+	}
+	return changeKargs(ctx, nil, remove)
+}
+
+// kargSet reports whether arg, or any value of a bare key, is on the command line
+func kargSet(kargs []string, arg string) bool {
+	for _, k := range kargs {
+		if k == arg || (!strings.Contains(arg, "=") && bootc.KargKey(k) == arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func changeKargs(ctx context.Context, add, remove []string) error {
+	if len(add) == 0 && len(remove) == 0 {
+		if output.IsJSON() {
+			return output.EmitSummary("system kargs", bootc.KargsChange{}, nil)
+		}
+		fmt.Println(ui.InfoBox.Render("Nothing to change."))
+		return nil
+	}
+	if err := galexec.RequireCommands("rpm-ostree"); err != nil {
+		return fmt.Errorf("rpm-ostree is required to change kernel arguments: %w", err)
+	}
+
+	var summary []string
+	if len(add) > 0 {
+		summary = append(summary, "Add: "+strings.Join(add, " "))
+	}
+	if len(remove) > 0 {
+		summary = append(summary, "Remove: "+strings.Join(remove, " "))
+	}
+	if ok, err := confirmSystemAction("Change kernel arguments?", strings.Join(summary, "\n")+"\nThe change takes effect on the next boot.", systemApply); !ok {
+		return err
+	}
+
+	opts := galexec.DefaultOptions()
+	opts.StreamStdio = !output.IsJSON()
+	// rpm-ostree asks polkit first; sudo is only used when that is refused
+	opts.Escalate = "change kernel arguments with rpm-ostree"
+	result := galexec.Run(ctx, "rpm-ostree", bootc.KargsArgs(add, remove, systemApply), opts)
+	change := bootc.KargsChange{Time: time.Now().UTC(), Added: add, Removed: remove}
+	if result.Err == nil {
+		if host, err := loadHostStatus(ctx); err == nil {
+			change.Image = host.BootedImage()
+		}
+		if err := recordKargsChange(ctx, change); err != nil {
+			logger.Warn("could not record kernel argument change", "error", err)
+		}
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("system kargs", change, result.Err)
+	}
+	if result.Err != nil {
+		return fmt.Errorf("rpm-ostree kargs failed: %w", result.Err)
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render("Kernel arguments updated.\n\n" + strings.Join(summary, "\n") + "\n\nReboot to apply them."))
+	return nil
+}
+
+// loadKargsHistory reads the recorded kernel argument changes, oldest first
+func loadKargsHistory() ([]bootc.KargsChange, error) {
+	data, err := os.ReadFile(statePath(kargsHistoryFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading kernel argument history: %w", err)
+	}
+	var changes []bootc.KargsChange
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var c bootc.KargsChange
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes, scanner.Err()
+}
+
+// recordKargsChange appends a change to the kernel argument history
+func recordKargsChange(ctx context.Context, change bootc.KargsChange) error {
+	data, err := os.ReadFile(statePath(kargsHistoryFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	data = append(data, append(line, '\n')...)
+	return writeStateFile(ctx, kargsHistoryFile, data)
+}
@@ -40,6 +40,13 @@ func runUJustTasks(cmd *cobra.Command, args []string) error {
 	}
 
 	recipes, _ := loadUJustRecipes()
+	if !ui.IsInteractiveTerminal() {
+		if len(recipes) == 0 {
+			return ui.RequireInteractive("ujust", "a recipe name")
+		}
+		printUJustRecipes(recipes)
+		return nil
+	}
 	if len(recipes) == 0 {
 		return runAttachedCommand("ujust", nil)
 	}
@@ -74,13 +81,15 @@ func runUJustTasks(cmd *cobra.Command, args []string) error {
 		Details:   "Return to the previous menu",
 	})
 
+	defer ui.PushScreen("Bluefin Tasks")()
 	choice, err := ui.RunMenuWithOptions("BLUEFIN TASKS", "Choose a ujust task to run", menuItems, ui.WithBackNavigation("Back"))
 	if err != nil {
 		return runUJustFallback(recipes)
 	}
 
-	if choice == ui.MenuActionBack || choice == ui.MenuActionQuit || choice == "back" {
-		return nil
+	switch choice {
+	case ui.MenuActionBack, ui.MenuActionHome, ui.MenuActionQuit, "back":
+		return ui.NavigationError(choice)
 	}
 
 	if choice == "open-menu" {
@@ -148,6 +157,22 @@ func runUJustFallback(recipes []ujustRecipe) error {
 	return runAttachedCommand("ujust", append([]string{recipe.Name}, params...))
 }
 
+// printUJustRecipes lists the recipes and how to run them without the menu
+func printUJustRecipes(recipes []ujustRecipe) {
+	for _, recipe := range recipes {
+		usage := strings.Join(append([]string{recipe.Name}, recipe.Params...), " ")
+		if recipe.Group != "" {
+			usage = fmt.Sprintf("[%s] %s", recipe.Group, usage)
+		}
+		if recipe.Description != "" {
+			usage += "  " + ui.MutedStyle.Render(recipe.Description)
+		}
+		fmt.Println(usage)
+	}
+	fmt.Println()
+	fmt.Println(ui.MutedStyle.Render("Run one with: galena ujust <recipe> [args...]"))
+}
+
 func promptRecipeParameters(recipe ujustRecipe) ([]string, error) {
 	if len(recipe.Params) == 0 {
 		return nil, nil
@@ -13,7 +13,6 @@ import (
 
 var (
 	updateReboot bool
-	updateYes    bool
 	updateCheck  bool
 )
 
@@ -27,7 +26,6 @@ optionally, reboots the machine to apply it.`,
 
 func init() {
 	updateCmd.Flags().BoolVar(&updateReboot, "reboot", false, "Reboot automatically after a successful upgrade")
-	updateCmd.Flags().BoolVarP(&updateYes, "yes", "y", false, "Skip confirmation prompt")
 	updateCmd.Flags().BoolVar(&updateCheck, "check", false, "Show current bootc status without upgrading")
 }
 
@@ -47,7 +45,10 @@ func runSystemUpdate(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	if !updateYes {
+	if !assumeYes {
+		if err := ui.RequireInteractive("update", "--yes"); err != nil {
+			return err
+		}
 		confirm := false
 		err := huh.NewForm(
 			huh.NewGroup(
@@ -66,7 +67,10 @@ func runSystemUpdate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	updateName, updateArgs := commandWithPrivilege("bootc", "upgrade")
+	updateName, updateArgs, err := privilegeEscalator().Command(ctx, "stage a system update with bootc", "bootc", "upgrade")
+	if err != nil {
+		return fmt.Errorf("bootc upgrade requires root: %w", err)
+	}
 	result := galexec.RunStreaming(ctx, updateName, updateArgs, galexec.DefaultOptions())
 	if result.Err != nil {
 		return fmt.Errorf("bootc upgrade failed: %w", result.Err)
@@ -80,7 +84,11 @@ func runSystemUpdate(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	rebootName, rebootArgs := commandWithPrivilege("systemctl", "reboot")
+	rebootName, rebootArgs, err := privilegeEscalator().Command(ctx, "reboot into the updated deployment", "systemctl", "reboot")
+	if err != nil {
+		fmt.Println(ui.InfoBox.Render("Reboot to apply the updated deployment."))
+		return nil
+	}
 	reboot := galexec.RunStreaming(ctx, rebootName, rebootArgs, galexec.DefaultOptions())
 	if reboot.Err != nil {
 		return fmt.Errorf("reboot command failed: %w", reboot.Err)
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/notify"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// notifyEvent announces an event to the targets in the notifications block
+func notifyEvent(ctx context.Context, event notify.Event) {
+	if cfg == nil || len(cfg.Notifications) == 0 {
+		return
+	}
+	event.Project = cfg.Name
+	notify.New(cfg.Notifications, logger).Send(ctx, event)
+}
+
+// notifyBuild announces the outcome of a build and, when it pushed, the push
+func notifyBuild(ctx context.Context, manifest *version.BuildManifest, opts build.BuildOptions, started time.Time, err error) {
+	if cfg == nil || len(cfg.Notifications) == 0 {
+		return
+	}
+	event := notify.Event{
+		Event:    notify.EventBuildSucceeded,
+		ImageRef: cfg.ImageRef(opts.Variant, opts.Tag),
+		Variant:  opts.Variant,
+		Tag:      opts.Tag,
+		Duration: time.Since(started).Seconds(),
+	}
+	if manifest != nil {
+		event.ImageRef = manifest.Version.ImageRef
+		event.Version = manifest.Version.Version
+		event.Variant = manifest.Version.Variant
+		event.Tag = manifest.Version.Tag
+		if len(manifest.Images) == 1 {
+			event.Digest = manifest.Images[0].Digest
+		}
+	}
+	if err != nil {
+		event.Event = notify.EventBuildFailed
+		event.Error = err.Error()
+	}
+	notifyEvent(ctx, event)
+	if err == nil && manifest != nil {
+		notifyPush(ctx, manifest.Version.ImageRef, manifest.Pushes, started)
+	}
+}
+
+// notifyPush announces the registries an image was pushed to
+func notifyPush(ctx context.Context, imageRef string, pushes []version.Push, started time.Time) {
+	event := notify.Event{Event: notify.EventPush, ImageRef: imageRef, Duration: time.Since(started).Seconds()}
+	for _, p := range pushes {
+		if p.Status != build.PushStatusPushed {
+			continue
+		}
+		event.Artifacts = append(event.Artifacts, p.Image)
+		if event.Digest == "" {
+			event.Digest = p.Digest
+		}
+	}
+	if len(event.Artifacts) == 0 {
+		return
+	}
+	notifyEvent(ctx, event)
+}
+
+// notifyDisk announces a finished disk image build
+func notifyDisk(ctx context.Context, imageRef, outputType, outputPath string, started time.Time, err error) {
+	event := notify.Event{
+		Event:    notify.EventDiskSucceeded,
+		ImageRef: imageRef,
+		DiskType: outputType,
+		Duration: time.Since(started).Seconds(),
+	}
+	if outputPath != "" {
+		event.Artifacts = []string{outputPath}
+	}
+	if err != nil {
+		event.Event = notify.EventDiskFailed
+		event.Error = err.Error()
+	}
+	notifyEvent(ctx, event)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	promoteFrom       string
+	promoteTo         string
+	promoteSign       bool
+	promoteKey        string
+	promoteAllowDirty bool
+	promoteChannels   string
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote [image]",
+	Short: "Promote a pushed image between channels",
+	Long: `Point a channel tag at the exact digest another channel tag points to,
+copying it within the registry with skopeo instead of rebuilding. The
+promoted image is byte-for-byte the one that was tested.
+
+The image is a registry repository or a variant of the configured image
+(default: main). Images built from a dirty working tree are refused.
+
+Examples:
+  # Promote the main image from beta to stable
+  galena-build promote --from beta --to stable
+
+  # Promote a variant, sign the promoted digest, and record it
+  galena-build promote nvidia --from beta --to stable --sign --channels channels.json
+
+  # Promote any repository
+  galena-build promote ghcr.io/acme/galena --from testing --to stable`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPromote,
+}
+
+func init() {
+	promoteCmd.Flags().StringVar(&promoteFrom, "from", "beta", "Channel tag to promote from")
+	promoteCmd.Flags().StringVar(&promoteTo, "to", "stable", "Channel tag to promote to")
+	promoteCmd.Flags().BoolVar(&promoteSign, "sign", false, "Sign the promoted digest with cosign")
+	promoteCmd.Flags().StringVarP(&promoteKey, "key", "k", "", "cosign key overriding signing.key in galena.yaml")
+	promoteCmd.Flags().BoolVar(&promoteAllowDirty, "allow-dirty", false, "Promote images built from a dirty working tree")
+	promoteCmd.Flags().StringVar(&promoteChannels, "channels", "", "Channel manifest to update (JSON, relative to the project root)")
+}
+
+func runPromote(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "promote"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	image := cfg.ImageRef("main", promoteFrom)
+	if len(args) > 0 {
+		image = args[0]
+		if !strings.Contains(image, "/") {
+			if _, err := cfg.GetVariant(image); err != nil {
+				return err
+			}
+			image = cfg.ImageRef(image, promoteFrom)
+		}
+	}
+
+	channels := promoteChannels
+	if channels != "" && !filepath.IsAbs(channels) {
+		channels = filepath.Join(rootDir, channels)
+	}
+
+	var signer *build.Signer
+	if promoteSign {
+		s := build.NewSigner(rootDir, signingConfig(promoteKey))
+		signer = &s
+	}
+
+	logger.Info("promoting image", "image", image, "from", promoteFrom, "to", promoteTo)
+	promotion, err := build.Promote(ctx, build.PromoteOptions{
+		Image:           image,
+		From:            promoteFrom,
+		To:              promoteTo,
+		Signer:          signer,
+		AllowDirty:      promoteAllowDirty,
+		ChannelManifest: channels,
+		DryRun:          dryRun,
+	})
+	if output.IsJSON() {
+		return output.EmitSummary("promote", promotion, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	summary := []string{
+		"From: " + promotion.Source,
+		"To: " + promotion.Destination,
+		"Digest: " + promotion.Digest,
+	}
+	if promotion.Signed {
+		summary = append(summary, "Signed: yes")
+	}
+	if channels != "" && !dryRun {
+		summary = append(summary, "Channel manifest: "+channels)
+	}
+
+	fmt.Println()
+	if dryRun {
+		fmt.Println(ui.InfoBox.Render("Dry run: nothing promoted\n\n" + strings.Join(summary, "\n")))
+		return nil
+	}
+	fmt.Println(ui.SuccessBox.Render("Image promoted!\n\n" + strings.Join(summary, "\n")))
+	return nil
+}
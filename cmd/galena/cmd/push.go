@@ -3,12 +3,19 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
 	"github.com/iiroan/galena/internal/ui"
+	"github.com/iiroan/galena/internal/version"
 )
 
 var pushCmd = &cobra.Command{
@@ -17,43 +24,124 @@ var pushCmd = &cobra.Command{
 	Long: `Push a built container image to the configured registry.
 
 If no image is specified, pushes the default image with the latest tag.
+The image is also copied to every mirror under registries: in galena.yaml
+with skopeo. Each registry is retried independently, and the result for
+every registry is recorded in build-manifest.json. An image built from a
+dirty working tree is refused when build.dirty_policy is block-push.
 
 Examples:
   galena-build push
   galena-build push ghcr.io/myorg/myimage:stable
-  galena-build push --tag stable`,
+  galena-build push --tag stable
+  galena-build push --mirrors=false`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runPush,
 }
 
-var pushTag string
+var (
+	pushTag     string
+	pushMirrors bool
+)
 
 func init() {
 	pushCmd.Flags().StringVarP(&pushTag, "tag", "t", "latest", "Image tag to push")
+	pushCmd.Flags().BoolVar(&pushMirrors, "mirrors", true, "Also push to the mirror registries in galena.yaml")
 }
 
 func runPush(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	if err := platform.RequireLinux("push"); err != nil {
+	if err := platform.Require(platform.ContainerTools, "push"); err != nil {
 		return err
 	}
 
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
 	imageRef := ""
 	if len(args) > 0 {
 		imageRef = args[0]
 	} else {
 		imageRef = cfg.ImageRef("main", pushTag)
 	}
+	imageRef, err = ref.Normalize(imageRef)
+	if err != nil {
+		return err
+	}
+
+	var mirrors []config.RegistryConfig
+	if pushMirrors {
+		mirrors = cfg.Registries
+	}
+
+	builder := build.NewBuilder(cfg, rootDir, logger)
+
+	// An image built from a dirty working tree is labeled so; block-push
+	// refuses it here as well as when building with --push
+	if labels, err := builder.Engine().ImageLabels(ctx, imageRef); err == nil && labels["io.galena.git.dirty"] == "true" {
+		if _, err := build.ApplyDirtyPolicy(cfg.Build.DirtyPolicy, pushTag, true); err != nil {
+			return err
+		}
+	}
 
-	logger.Info("pushing image", "image", imageRef)
+	logger.Info("pushing image", "image", imageRef, "mirrors", len(mirrors))
+	started := time.Now()
+	pushes, pushErr := builder.PushAll(ctx, imageRef, false, mirrors)
+	recordPushes(rootDir, pushes)
+	notifyPush(ctx, imageRef, pushes, started)
 
-	result := exec.PodmanPush(ctx, imageRef)
-	if result.Err != nil {
-		return fmt.Errorf("push failed: %w", result.Err)
+	if output.IsJSON() {
+		return output.EmitSummary("push", map[string]any{"image": imageRef, "pushes": pushes}, pushErr)
+	}
+
+	if len(pushes) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Registries"))
+		for _, p := range pushes {
+			if p.Status == build.PushStatusPushed {
+				fmt.Printf("  %s %s %s\n", ui.SuccessStyle.Render("✓"), p.Image, ui.MutedStyle.Render(attemptsLabel(p.Attempts)))
+			} else {
+				fmt.Printf("  %s %s %s\n", ui.ErrorStyle.Render("✗"), p.Image, ui.MutedStyle.Render(attemptsLabel(p.Attempts)))
+				fmt.Println(ui.MutedStyle.Render("    " + exec.LastNLines(p.Error, 1)))
+			}
+		}
+	}
+	if pushErr != nil {
+		return pushErr
 	}
 
 	fmt.Println()
+	if dryRun {
+		fmt.Println(dryRunBox("nothing was pushed.", imageRef))
+		return nil
+	}
 	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Image pushed successfully!\n\n%s", imageRef)))
 
 	return nil
 }
+
+// recordPushes adds push results to the build manifest of the last build, if any
+func recordPushes(rootDir string, pushes []version.Push) {
+	if dryRun {
+		return
+	}
+	manifestPath := filepath.Join(rootDir, "build-manifest.json")
+	manifest, err := version.LoadManifest(manifestPath)
+	if err != nil {
+		return
+	}
+	for _, p := range pushes {
+		manifest.SetPush(p)
+	}
+	if err := manifest.Save(manifestPath); err != nil {
+		logger.Warn("could not update manifest", "error", err)
+	}
+}
+
+func attemptsLabel(attempts int) string {
+	if attempts == 1 {
+		return "(1 attempt)"
+	}
+	return fmt.Sprintf("(%d attempts)", attempts)
+}
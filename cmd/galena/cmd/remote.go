@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/bootc"
+	"github.com/iiroan/galena/internal/build"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/remote"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	remoteIdentity string
+	remoteParallel int
+	remoteApply    bool
+	remoteAll      bool
+)
+
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Check and update Galena hosts over SSH",
+	Long: `Manage other Galena machines over SSH, for labs that want push-button
+updates without fleet tooling.
+
+Hosts are kept in ~/.config/galena/remotes.yaml. Commands run bootc on each
+host over ssh in batch mode, with sudo -n unless the login user is root, so
+the hosts need key-based login and a NOPASSWD rule for bootc (and for
+systemctl reboot with upgrade --apply). Hosts are contacted in parallel and
+the results summarized in one table.
+
+Subcommands:
+  add      - Add a host
+  remove   - Forget a host
+  list     - List the added hosts
+  status   - Compare each host's booted digest with the registry
+  upgrade  - Stage or apply updates on hosts
+
+Examples:
+  galena remote add lab1 admin@10.0.0.21
+  galena remote status
+  galena remote upgrade lab1 lab2 --apply -y`,
+}
+
+var remoteAddCmd = &cobra.Command{
+	Use:   "add <name> <[user@]host[:port]>",
+	Short: "Add a host",
+	Long: `Add a host and check that bootc status can be read on it. Adding a name
+again replaces the host.
+
+Examples:
+  galena remote add lab1 admin@10.0.0.21
+  galena remote add nas root@nas.lan:2222 --identity ~/.ssh/lab_ed25519`,
+	Args: cobra.ExactArgs(2),
+	RunE: runRemoteAdd,
+}
+
+var remoteRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Forget a host",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRemoteRemove,
+}
+
+var remoteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the added hosts",
+	Args:  cobra.NoArgs,
+	RunE:  runRemoteList,
+}
+
+var remoteStatusCmd = &cobra.Command{
+	Use:   "status [name...]",
+	Short: "Compare each host's booted digest with the registry",
+	Long: `Read bootc status on every host (or the named ones) and compare the
+booted digest with the digest its image tag points to in the registry.
+
+Examples:
+  galena remote status
+  galena remote status lab1 --output-format json`,
+	RunE: runRemoteStatus,
+}
+
+var remoteUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [name...]",
+	Short: "Stage or apply updates on hosts",
+	Long: `Run bootc upgrade on the named hosts, or with --all on every host that is
+behind the registry. --apply reboots each host into the update.
+
+Examples:
+  galena remote upgrade lab1
+  galena remote upgrade --all --apply -y --parallel 2`,
+	RunE: runRemoteUpgrade,
+}
+
+func init() {
+	remoteCmd.AddCommand(remoteAddCmd)
+	remoteCmd.AddCommand(remoteRemoveCmd)
+	remoteCmd.AddCommand(remoteListCmd)
+	remoteCmd.AddCommand(remoteStatusCmd)
+	remoteCmd.AddCommand(remoteUpgradeCmd)
+
+	remoteAddCmd.Flags().StringVarP(&remoteIdentity, "identity", "i", "", "SSH private key for the host")
+	for _, c := range []*cobra.Command{remoteStatusCmd, remoteUpgradeCmd} {
+		c.Flags().IntVarP(&remoteParallel, "parallel", "p", 4, "Hosts to contact at once")
+	}
+	remoteUpgradeCmd.Flags().BoolVar(&remoteApply, "apply", false, "Reboot hosts into the update")
+	remoteUpgradeCmd.Flags().BoolVar(&remoteAll, "all", false, "Upgrade every host that is behind")
+}
+
+func loadRemoteStore() (*remote.Store, error) {
+	path, err := remote.DefaultStorePath()
+	if err != nil {
+		return nil, err
+	}
+	return remote.LoadStore(path)
+}
+
+func runRemoteAdd(cmd *cobra.Command, args []string) error {
+	if err := galexec.RequireCommands("ssh"); err != nil {
+		return err
+	}
+	host, err := remote.ParseTarget(args[1])
+	if err != nil {
+		return err
+	}
+	host.Name = args[0]
+	host.Identity = remoteIdentity
+
+	store, err := loadRemoteStore()
+	if err != nil {
+		return err
+	}
+	if _, err := host.Status(context.Background()); err != nil {
+		logger.Warn("host added, but bootc status failed", "host", host.Name, "error", err)
+	}
+	store.Add(host)
+	if err := store.Save(); err != nil {
+		return err
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("remote add", host, nil)
+	}
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Added %s (%s).\n\nCheck it with: galena remote status %s", host.Name, host.Target(), host.Name)))
+	return nil
+}
+
+func runRemoteRemove(cmd *cobra.Command, args []string) error {
+	store, err := loadRemoteStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Remove(args[0]); err != nil {
+		return err
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("remote remove", map[string]string{"name": args[0]}, nil)
+	}
+	fmt.Println(ui.SuccessBox.Render("Removed " + args[0] + "."))
+	return nil
+}
+
+func runRemoteList(cmd *cobra.Command, args []string) error {
+	store, err := loadRemoteStore()
+	if output.IsJSON() {
+		var hosts []remote.Host
+		if store != nil {
+			hosts = store.Hosts
+		}
+		return output.EmitSummary("remote list", hosts, err)
+	}
+	if err != nil {
+		return err
+	}
+	ui.StartScreen("REMOTE HOSTS", "Galena hosts managed over SSH")
+	if len(store.Hosts) == 0 {
+		fmt.Println(ui.InfoBox.Render("No hosts added.\n\nAdd one with: galena remote add <name> <user@host>"))
+		return nil
+	}
+	for _, h := range store.Hosts {
+		target := h.Target()
+		if h.Port != 0 {
+			target += fmt.Sprintf(":%d", h.Port)
+		}
+		printKV(h.Name, target)
+	}
+	return nil
+}
+
+// Remote host states
+const (
+	remoteUpToDate    = "up to date"
+	remoteBehind      = "update available"
+	remoteStaged      = "update staged"
+	remoteUnknown     = "unknown"
+	remoteUnreachable = "unreachable"
+)
+
+// remoteHostStatus is one row of the remote status table
+type remoteHostStatus struct {
+	Name     string `json:"name"`
+	Image    string `json:"image,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Booted   string `json:"booted,omitempty"`
+	Latest   string `json:"latest,omitempty"`
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	Upgraded bool   `json:"upgraded,omitempty"`
+}
+
+// digestCache resolves each image tag once, however many hosts run it
+type digestCache struct {
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+func (c *digestCache) resolve(ctx context.Context, image string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.digests[image]; ok {
+		return d, nil
+	}
+	d, err := build.ResolveDigest(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	c.digests[image] = d
+	return d, nil
+}
+
+// remoteStatus reads the deployments of a host and compares the booted
+// digest with the registry
+func remoteStatus(ctx context.Context, h remote.Host, cache *digestCache) remoteHostStatus {
+	status := remoteHostStatus{Name: h.Name, State: remoteUnreachable}
+	host, err := h.Status(ctx)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Image = host.BootedImage()
+	if b := host.Status.Booted; b != nil && b.Image != nil {
+		status.Version = b.Image.Version
+		status.Booted = b.Image.ImageDigest
+	}
+
+	status.State = remoteUnknown
+	if status.Image == "" {
+		return status
+	}
+	latest, err := cache.resolve(ctx, status.Image)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Latest = latest
+	switch {
+	case latest == status.Booted:
+		status.State = remoteUpToDate
+	case host.Status.Staged != nil && host.Status.Staged.Image != nil && host.Status.Staged.Image.ImageDigest == latest:
+		status.State = remoteStaged
+	default:
+		status.State = remoteBehind
+	}
+	return status
+}
+
+func collectRemoteStatus(ctx context.Context, names []string) ([]remoteHostStatus, error) {
+	if err := galexec.RequireCommands("ssh"); err != nil {
+		return nil, err
+	}
+	store, err := loadRemoteStore()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := store.Select(names)
+	if err != nil {
+		return nil, err
+	}
+	cache := &digestCache{digests: map[string]string{}}
+	var statuses []remoteHostStatus
+	check := func() error {
+		statuses = remote.ForEach(hosts, remoteParallel, func(h remote.Host) remoteHostStatus {
+			return remoteStatus(ctx, h, cache)
+		})
+		return nil
+	}
+	if output.IsJSON() || !ui.IsInteractiveTerminal() {
+		return statuses, check()
+	}
+	return statuses, ui.RunWithSpinner(fmt.Sprintf("Checking %d hosts", len(hosts)), check)
+}
+
+func runRemoteStatus(cmd *cobra.Command, args []string) error {
+	statuses, err := collectRemoteStatus(context.Background(), args)
+	if output.IsJSON() {
+		return output.EmitSummary("remote status", statuses, err)
+	}
+	if err != nil {
+		return err
+	}
+	ui.StartScreen("REMOTE STATUS", "Booted digests compared with the registry")
+	printRemoteTable(statuses)
+	return nil
+}
+
+func runRemoteUpgrade(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if len(args) == 0 && !remoteAll {
+		return fmt.Errorf("name the hosts to upgrade, or pass --all")
+	}
+	statuses, err := collectRemoteStatus(ctx, args)
+	if err != nil {
+		if output.IsJSON() {
+			return output.EmitSummary("remote upgrade", nil, err)
+		}
+		return err
+	}
+
+	store, err := loadRemoteStore()
+	if err != nil {
+		return err
+	}
+	var targets []remote.Host
+	for _, s := range statuses {
+		if s.State != remoteBehind && !(remoteApply && s.State == remoteStaged) {
+			continue
+		}
+		if hosts, err := store.Select([]string{s.Name}); err == nil {
+			targets = append(targets, hosts...)
+		}
+	}
+	if len(targets) == 0 {
+		if output.IsJSON() {
+			return output.EmitSummary("remote upgrade", statuses, nil)
+		}
+		printRemoteTable(statuses)
+		fmt.Println()
+		fmt.Println(ui.InfoBox.Render("No host needs an update."))
+		return nil
+	}
+
+	names := make([]string, len(targets))
+	for i, h := range targets {
+		names[i] = h.Name
+	}
+	description := "bootc upgrade stages the update on " + strings.Join(names, ", ") + "."
+	if ok, err := confirmSystemAction(fmt.Sprintf("Upgrade %d hosts?", len(targets)), description, remoteApply); !ok {
+		return err
+	}
+
+	errs := remote.ForEach(targets, remoteParallel, func(h remote.Host) error {
+		logger.Info("upgrading host", "host", h.Name, "apply", remoteApply)
+		return h.Upgrade(ctx, remoteApply)
+	})
+	var failed []string
+	for i, err := range errs {
+		for j := range statuses {
+			if statuses[j].Name != targets[i].Name {
+				continue
+			}
+			if err != nil {
+				statuses[j].Error = err.Error()
+				failed = append(failed, targets[i].Name)
+				continue
+			}
+			statuses[j].Upgraded = true
+			statuses[j].State = remoteStaged
+			if remoteApply {
+				statuses[j].State = "rebooting"
+			}
+		}
+	}
+	var upgradeErr error
+	if len(failed) > 0 {
+		upgradeErr = fmt.Errorf("upgrade failed on %s", strings.Join(failed, ", "))
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("remote upgrade", statuses, upgradeErr)
+	}
+	ui.StartScreen("REMOTE UPGRADE", "Results of bootc upgrade on each host")
+	printRemoteTable(statuses)
+	return upgradeErr
+}
+
+func printRemoteTable(statuses []remoteHostStatus) {
+	width := len("HOST")
+	for _, s := range statuses {
+		width = max(width, len(s.Name))
+	}
+	fmt.Printf("  %-*s  %-16s  %-12s  %-12s  %s\n", width, "HOST", "STATE", "BOOTED", "LATEST", "VERSION")
+	for _, s := range statuses {
+		state := fmt.Sprintf("%-16s", s.State)
+		switch s.State {
+		case remoteUpToDate:
+			state = ui.SuccessStyle.Render(state)
+		case remoteBehind, remoteStaged:
+			state = ui.WarningStyle.Render(state)
+		case remoteUnreachable:
+			state = ui.ErrorStyle.Render(state)
+		}
+		fmt.Printf("  %-*s  %s  %-12s  %-12s  %s\n", width, s.Name, state,
+			defaultIfEmpty(bootc.ShortDigest(s.Booted), "-"), defaultIfEmpty(bootc.ShortDigest(s.Latest), "-"), defaultIfEmpty(s.Version, "-"))
+	}
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Println(ui.MutedStyle.Render("  " + s.Name + ": " + s.Error))
+		}
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/huh"
@@ -17,26 +21,31 @@ import (
 	"github.com/iiroan/galena/internal/build"
 	"github.com/iiroan/galena/internal/ci"
 	"github.com/iiroan/galena/internal/config"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/secrets"
 	"github.com/iiroan/galena/internal/ui"
 	"github.com/iiroan/galena/internal/validate"
 )
 
 var (
-	verbose    bool
-	quiet      bool
-	noColor    bool
-	cfgFile    string
-	projectDir string
-	logger     *log.Logger
-	cfg        *config.Config
-)
-
-type ctxKey string
-
-const (
-	buildPhaseKey ctxKey = "build-phase"
-	logFileKey    ctxKey = "log-file"
+	verbose          bool
+	quiet            bool
+	noColor          bool
+	plainMode        bool
+	dryRun           bool
+	noSudo           bool
+	cfgFile          string
+	projectDir       string
+	projectName      string
+	workspaceProject string
+	engineName       string
+	outputFormat     string
+	jsonOutput       bool
+	assumeYes        bool
+	logger           *log.Logger
+	cfg              *config.Config
 )
 
 var rootCmd = &cobra.Command{
@@ -47,24 +56,61 @@ application management, and first-boot workflows.`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if jsonOutput {
+			outputFormat = output.FormatJSON
+		}
+		if err := output.SetFormat(outputFormat); err != nil {
+			return err
+		}
+		if output.IsJSON() {
+			galexec.SetStreamStdout(os.Stderr)
+		}
+		// JSON on stdout leaves no room for menus or live views
+		if plainMode || output.IsJSON() {
+			ui.SetMode(ui.ModePlain)
+		}
+		galexec.SetDryRun(dryRun)
 		setupLogger()
 
-		if cmd.Name() != "version" && cmd.Name() != "help" {
+		if cmd.Name() != "version" && cmd.Name() != "help" && cmd.Name() != "completion" {
 			switch activeProfile {
 			case cliProfileBuild:
+				if err := resolveWorkspaceProject(); err != nil {
+					return err
+				}
+
 				var err error
 				if cfgFile != "" {
 					cfg, err = config.Load(cfgFile)
 				} else {
 					cfg, err = config.LoadFromProject()
 				}
+				// A malformed GALENA_* variable must not swap the project
+				// config for defaults, which could push to the wrong registry
+				if errors.Is(err, config.ErrEnvOverride) {
+					logger.Error("could not load config", "error", err)
+					return err
+				}
 				if err != nil {
 					logger.Warn("could not load config, using defaults", "error", err)
 					cfg = config.DefaultConfig()
 				}
+				// Commands that never validate the config would otherwise
+				// fall back to podman for an unknown engine
+				if engineName != "" {
+					if _, err := galexec.NewEngine(engineName); err != nil {
+						logger.Error("invalid --engine", "error", err)
+						return err
+					}
+					cfg.Build.Engine = engineName
+				}
 			default:
 				if cfgFile != "" {
 					loaded, err := config.Load(cfgFile)
+					if errors.Is(err, config.ErrEnvOverride) {
+						logger.Error("could not load config", "error", err)
+						return err
+					}
 					if err != nil {
 						logger.Warn("could not load config, using defaults", "error", err)
 						cfg = config.DefaultConfig()
@@ -73,16 +119,33 @@ application management, and first-boot workflows.`,
 					}
 				} else {
 					cfg = config.DefaultConfig()
+					if err := cfg.ApplyEnv(os.Environ()); err != nil {
+						logger.Error("could not load config", "error", err)
+						return err
+					}
 				}
 			}
+			for _, o := range cfg.EnvOverrides() {
+				logger.Debug("config overridden by environment", "var", o.Var, "key", o.Path)
+			}
 		}
 
 		applyUISettings()
 		setupLogger()
+		if err := applyRetryPolicy(); err != nil {
+			logger.Error("invalid retry policy", "error", err)
+			return err
+		}
+		applyCredentials()
+		applyAuditLog()
+		applyPrivilegePolicy()
 
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !ui.IsInteractiveTerminal() {
+			return cmd.Help()
+		}
 		if len(args) == 0 {
 			if activeProfile == cliProfileBuild {
 				return runRootTUI()
@@ -94,6 +157,8 @@ application management, and first-boot workflows.`,
 }
 
 func runRootTUI() error {
+	defer ui.PushScreen("Control Plane")()
+
 	menuItems := []ui.MenuItem{
 		{ID: "build", TitleText: "Build", Details: "Step-by-step flow for container or disk builds with a clear plan summary"},
 		{ID: "fast-build", TitleText: "Fast Build", Details: "One-shot local build for a container and standard ISO"},
@@ -116,9 +181,12 @@ func runRootTUI() error {
 		}
 
 		if err := runRootChoice(choice); err != nil {
-			if errors.Is(err, huh.ErrUserAborted) {
+			if errors.Is(err, huh.ErrUserAborted) || errors.Is(err, ui.ErrNavigateHome) {
 				continue
 			}
+			if errors.Is(err, ui.ErrQuit) {
+				return nil
+			}
 			return err
 		}
 
@@ -190,23 +258,28 @@ func waitForEnter(prompt string) error {
 	return err
 }
 
-func runFastBuild() error {
+func runFastBuild() (err error) {
 	rootDir, err := getProjectRoot()
 	if err != nil {
 		return err
 	}
-	if err := platform.RequireLinux("fast build"); err != nil {
+	if err := platform.Require(platform.ImageBuilds, "fast build"); err != nil {
 		return err
 	}
 
-	logDir := filepath.Join(rootDir, "logs")
-	_ = os.MkdirAll(logDir, 0755)
-	logFile := filepath.Join(logDir, fmt.Sprintf("fast-build-%s.log", time.Now().Format("20060102-150405")))
+	ctx := context.Background()
+	session := startSession(rootDir, "fast-build")
+	defer func() {
+		endSession(session, err)
+		offerSessionLog(session, err)
+	}()
+	logHint := "the output above"
 
-	ctx := context.WithValue(context.Background(), buildPhaseKey, "fast-build")
-	ctx = context.WithValue(ctx, logFileKey, logFile)
 	ui.StartScreen("FAST BUILD", "Building local container image and standard ISO...")
-	fmt.Println(ui.MutedStyle.Render("Logging session to: " + logFile))
+	if session != nil {
+		logHint = "galena-build logs " + session.Name
+		fmt.Println(ui.MutedStyle.Render("Logging session to: " + session.Path))
+	}
 	fmt.Println()
 
 	builder := build.NewBuilder(cfg, rootDir, logger)
@@ -215,29 +288,35 @@ func runFastBuild() error {
 	buildOpts.Tag = "latest"
 
 	fmt.Println(ui.WizardStep.Render("▶ Step 1: Building OCI Container..."))
-	_, err = builder.Build(ctx, buildOpts)
+	session.Phase("container build")
+	started := time.Now()
+	manifest, err := builder.Build(ctx, buildOpts)
+	notifyBuild(ctx, manifest, buildOpts, started, err)
 	if err != nil {
-		return fmt.Errorf("container build failed (check %s): %w", logFile, err)
+		return fmt.Errorf("container build failed (see %s): %w", logHint, err)
 	}
 	fmt.Println(ui.SuccessStyle.Render("✔ Container build complete"))
 
 	fmt.Println(ui.WizardStep.Render("▶ Step 2: Generating ISO Installer..."))
-	diskBuilder := build.NewDiskBuilder(cfg, rootDir, logger)
+	session.Phase("iso build")
+	diskBuilder := build.NewDiskBuilder(cfg, rootDir, logger).WithRootfulPodman()
 	diskOpts := build.DefaultDiskOptions()
 	diskOpts.ImageRef = cfg.ImageRef("main", "latest")
 	diskOpts.OutputType = "iso"
 
 	outputPath, err := diskBuilder.Build(ctx, diskOpts)
 	if err != nil {
-		return fmt.Errorf("iso build failed (check %s): %w", logFile, err)
+		return fmt.Errorf("iso build failed (see %s): %w", logHint, err)
+	}
+	if _, err := checksumDisk(ctx, rootDir, diskOpts.OutputType, outputPath, diskOpts.OutputDir); err != nil {
+		return fmt.Errorf("iso checksums failed (see %s): %w", logHint, err)
 	}
 
 	fmt.Println(ui.SuccessStyle.Render("✔ ISO generation complete"))
 	fmt.Println()
 	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf(
-		"Fast Build Finished!\n\nISO Location: %s\nLog File: %s",
+		"Fast Build Finished!\n\nISO Location: %s",
 		outputPath,
-		logFile,
 	)))
 
 	return nil
@@ -274,40 +353,142 @@ func Execute() error {
 
 func ExecuteManagement() error {
 	configureRootForProfile(cliProfileManagement)
-	return rootCmd.Execute()
+	return executeRoot()
 }
 
 func ExecuteBuild() error {
 	configureRootForProfile(cliProfileBuild)
-	return rootCmd.Execute()
+	return executeRoot()
+}
+
+// executeRoot runs the root command, treating menu navigation signals as a clean exit
+func executeRoot() error {
+	cmd, err := rootCmd.ExecuteC()
+	if ui.IsNavigation(err) {
+		return nil
+	}
+	if err != nil && cmd != nil {
+		return output.EmitSummary(cmd.Name(), nil, err)
+	}
+	return err
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress non-essential output")
 	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+	rootCmd.PersistentFlags().BoolVar(&plainMode, "plain", false, "Never prompt or take over the screen; take selections from flags and print plain text")
+	rootCmd.PersistentFlags().BoolVar(&plainMode, "non-interactive", false, "Same as --plain")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the commands that would change state instead of running them")
+	rootCmd.PersistentFlags().BoolVar(&noSudo, "no-sudo", false, "Never elevate with sudo or pkexec; commands that need root fail instead")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Skip confirmation prompts, and elevate without a terminal")
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default: galena.yaml)")
 	rootCmd.PersistentFlags().StringVarP(&projectDir, "project", "C", "", "Project directory")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", output.FormatText, "Output format (text, json)")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Print machine-readable JSON (same as --output-format json)")
+	rootCmd.PersistentFlags().StringVar(&engineName, "engine", "", "Container engine ("+strings.Join(config.ContainerEngines(), ", ")+"; default: build.engine)")
+	rootCmd.PersistentFlags().StringVar(&projectName, "project-name", "", "Workspace project to use (from "+config.WorkspaceFile+")")
 }
 
 func applyUISettings() {
+	prefs := ui.Preferences{
+		Theme:   ui.AutoTheme,
+		NoColor: noColor || ui.IsPlain(),
+	}
+	if cfg != nil {
+		prefs.Theme = cfg.UI.Theme
+		prefs.Dense = cfg.UI.Dense
+		prefs.NoColor = prefs.NoColor || cfg.UI.NoColor
+		prefs.Advanced = cfg.UI.Advanced
+	}
+	if err := ui.ApplyPreferences(prefs); err != nil {
+		logger.Warn("using the default theme", "error", err)
+	}
+}
+
+// applyRetryPolicy configures the retries of registry operations from the
+// retry section of galena.yaml. Empty durations keep the defaults.
+func applyRetryPolicy() error {
+	policy := galexec.DefaultRetryPolicy()
+	if cfg != nil {
+		r := cfg.Retry
+		if r.Attempts > 0 {
+			policy.Attempts = r.Attempts
+		}
+		if r.Delay != "" {
+			d, err := time.ParseDuration(r.Delay)
+			if err != nil {
+				return fmt.Errorf("retry.delay: %w", err)
+			}
+			policy.Delay = d
+		}
+		if r.MaxDelay != "" {
+			d, err := time.ParseDuration(r.MaxDelay)
+			if err != nil {
+				return fmt.Errorf("retry.max_delay: %w", err)
+			}
+			policy.MaxDelay = d
+		}
+		policy.ExitCodes = r.ExitCodes
+		policy.Patterns = append(slices.Clone(policy.Patterns), r.Patterns...)
+	}
+	galexec.SetRetryPolicy(policy, logger)
+	return nil
+}
+
+// applyCredentials makes the credentials section of galena.yaml available
+// to pushes and signing. Secrets are resolved when first needed.
+func applyCredentials() {
 	if cfg == nil {
-		ui.ApplyPreferences(ui.Preferences{
-			Theme:      "space",
-			ShowBanner: false,
-			Dense:      false,
-			NoColor:    noColor,
-			Advanced:   false,
-		})
+		secrets.Configure("", nil)
 		return
 	}
-	ui.ApplyPreferences(ui.Preferences{
-		Theme:      "space",
-		ShowBanner: false,
-		Dense:      cfg.UI.Dense,
-		NoColor:    cfg.UI.NoColor || noColor,
-		Advanced:   cfg.UI.Advanced,
-	})
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		rootDir = "."
+	}
+	secrets.Configure(rootDir, cfg.Credentials)
+}
+
+// dryRunBox renders the closing message of a dry run
+func dryRunBox(summary, detail string) string {
+	message := "Dry run finished: " + summary
+	if detail != "" {
+		message += "\n\n" + detail
+	}
+	return ui.InfoBox.Render(message)
+}
+
+// applyAuditLog records the commands of this run to the project audit log
+// when audit.enabled is set
+func applyAuditLog() {
+	galexec.SetRecorder(nil)
+	if cfg == nil || !cfg.Audit.Enabled {
+		return
+	}
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return
+	}
+	path := defaultIfEmpty(cfg.Audit.Path, filepath.Join("logs", "audit.jsonl"))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, path)
+	}
+	recorder, err := galexec.NewJSONLRecorder(path, cfg.Audit.MaxOutput, commandLine())
+	if err != nil {
+		logger.Warn("audit log disabled", "error", err)
+		return
+	}
+	galexec.SetRecorder(recorder)
+}
+
+// applyPrivilegePolicy lets commands refused for lack of privileges be
+// re-run as root, unless --no-sudo is set
+func applyPrivilegePolicy() {
+	if noSudo {
+		privilegeEscalator().Disable()
+	}
+	galexec.SetPrivilegeBroker(privilegeEscalator())
 }
 
 func setupLogger() {
@@ -319,6 +500,17 @@ func setupLogger() {
 		level = log.WarnLevel
 	}
 
+	// Log records double as machine-readable build events in JSON mode
+	if output.IsJSON() {
+		logger = log.NewWithOptions(output.Writer(), log.Options{
+			ReportTimestamp: true,
+			TimeFormat:      time.RFC3339,
+			Formatter:       log.JSONFormatter,
+			Level:           level,
+		})
+		return
+	}
+
 	styles := log.DefaultStyles()
 	disableColor := noColor || os.Getenv("NO_COLOR") != "" || ui.CurrentPreferences.NoColor
 	if !disableColor {
@@ -348,6 +540,66 @@ func setupLogger() {
 	logger.SetStyles(styles)
 }
 
+// resolveWorkspaceProject points the project directory and config file at a
+// workspace project, selected by --project-name or detected from the cwd
+func resolveWorkspaceProject() error {
+	start := projectDir
+	if start == "" {
+		var err error
+		start, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting working directory: %w", err)
+		}
+	}
+
+	ws, err := config.FindWorkspace(start)
+	if err != nil {
+		return fmt.Errorf("loading workspace: %w", err)
+	}
+	if ws == nil {
+		if projectName != "" {
+			return fmt.Errorf("--project-name %q requires a %s", projectName, config.WorkspaceFile)
+		}
+		return nil
+	}
+
+	var project *config.WorkspaceProject
+	if projectName != "" {
+		project, err = ws.Project(projectName)
+		if err != nil {
+			return err
+		}
+	} else {
+		project = ws.ProjectForDir(start)
+		if project == nil {
+			logger.Debug("not inside a workspace project", "workspace", ws.Root(), "projects", ws.ProjectNames())
+			return nil
+		}
+	}
+
+	workspaceProject = project.Name
+	projectDir = ws.ProjectDir(project)
+	if cfgFile == "" {
+		cfgFile = ws.ConfigPath(project)
+	}
+	logger.Debug("using workspace project", "name", project.Name, "dir", projectDir, "config", cfgFile)
+	return nil
+}
+
+// containerEngine returns the engine selected by --engine or build.engine
+func containerEngine() (galexec.Engine, error) {
+	if cfg == nil {
+		return galexec.NewEngine("")
+	}
+	return galexec.NewEngine(cfg.Build.Engine)
+}
+
+// interruptibleContext returns a context cancelled on SIGINT or SIGTERM so
+// long-running commands can clean up before exiting
+func interruptibleContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
 func getProjectRoot() (string, error) {
 	if projectDir != "" {
 		return projectDir, nil
@@ -9,13 +9,17 @@ import (
 )
 
 func runManagementTUI() error {
+	defer ui.PushScreen("Management")()
+
 	menuItems := []ui.MenuItem{
 		{ID: "apps", TitleText: "Applications", Details: "Manage Homebrew and Flatpak installs from the Galena catalog"},
 		{ID: "dev", TitleText: "Development Environment", Details: "Devcontainer-first setup, status, and lifecycle management"},
 		{ID: "status", TitleText: "Device Status", Details: "Inspect setup markers, tool availability, and catalog coverage"},
 		{ID: "update", TitleText: "System Update", Details: "Run bootc upgrade and optionally reboot"},
+		{ID: "system", TitleText: "Deployments", Details: "Review staged and rollback deployments, roll back, or switch images"},
 		{ID: "ujust", TitleText: "Bluefin Tasks", Details: "Browse and run ujust workflows from the shipped recipes"},
 		{ID: "setup", TitleText: "Setup Wizard", Details: "Run the first-boot setup wizard manually"},
+		{ID: "vm", TitleText: "Test VM", Details: "Boot a built disk image in QEMU and connect over SSH"},
 		{ID: "exit", TitleText: "Exit", Details: "Close the management console"},
 	}
 	lastChoice := ""
@@ -37,9 +41,12 @@ func runManagementTUI() error {
 		lastChoice = choice
 
 		if err := runManagementChoice(choice); err != nil {
-			if errors.Is(err, huh.ErrUserAborted) {
+			if errors.Is(err, huh.ErrUserAborted) || errors.Is(err, ui.ErrNavigateHome) {
 				continue
 			}
+			if errors.Is(err, ui.ErrQuit) {
+				return nil
+			}
 			return err
 		}
 	}
@@ -56,8 +63,10 @@ func runManagementFallback() error {
 			huh.NewOption("Development Environment", "dev"),
 			huh.NewOption("Device Status", "status"),
 			huh.NewOption("System Update", "update"),
+			huh.NewOption("Deployments", "system"),
 			huh.NewOption("Bluefin Tasks", "ujust"),
 			huh.NewOption("Setup Wizard", "setup"),
+			huh.NewOption("Test VM", "vm"),
 			huh.NewOption("Exit", "exit"),
 		).
 		Value(&fallbackChoice).
@@ -82,10 +91,15 @@ func runManagementChoice(choice string) error {
 		return manageStatusCmd.RunE(manageStatusCmd, []string{})
 	case "update":
 		return updateCmd.RunE(updateCmd, []string{})
+	case "system":
+		return systemCmd.RunE(systemCmd, []string{})
 	case "ujust":
 		return ujustCmd.RunE(ujustCmd, []string{})
 	case "setup":
 		return setupCmd.RunE(setupCmd, []string{})
+	case "vm":
+		vmInteractive = true
+		return vmRunCmd.RunE(vmRunCmd, []string{})
 	case "exit", ui.MenuActionQuit, ui.MenuActionBack, "":
 		return nil
 	default:
@@ -27,15 +27,20 @@ func configureRootForProfile(profile cliProfile) {
 			"application management, and first-boot workflows."
 		addManagementCommands()
 	}
+	registerCompletions()
 }
 
 func addBuildCommands() {
+	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(buildCmd)
 	rootCmd.AddCommand(diskCmd)
 	rootCmd.AddCommand(vmCmd)
 	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(sbomCmd)
+	rootCmd.AddCommand(scanCmd)
 	rootCmd.AddCommand(cliCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(versionCmd)
@@ -43,15 +48,36 @@ func addBuildCommands() {
 	rootCmd.AddCommand(lintCmd)
 	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(settingsCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(variantCmd)
 	rootCmd.AddCommand(ciCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(generateCmd)
+	rootCmd.AddCommand(depsCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(promoteCmd)
+	rootCmd.AddCommand(fleetCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(uiCmd)
+	rootCmd.AddCommand(completionCmd)
 }
 
 func addManagementCommands() {
 	rootCmd.AddCommand(appsCmd)
 	rootCmd.AddCommand(devCmd)
 	rootCmd.AddCommand(manageStatusCmd)
+	rootCmd.AddCommand(dashboardCmd)
+	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(systemCmd)
+	rootCmd.AddCommand(remoteCmd)
 	rootCmd.AddCommand(ujustCmd)
 	rootCmd.AddCommand(setupCmd)
+	rootCmd.AddCommand(vmCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(uiCmd)
+	rootCmd.AddCommand(completionCmd)
 }
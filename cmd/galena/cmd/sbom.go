@@ -9,30 +9,37 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/build"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
 	"github.com/iiroan/galena/internal/ui"
 )
 
-const trivyContainerImage = "ghcr.io/aquasecurity/trivy:0.69.3"
-const defaultTrivyTimeout = "30m"
-
 var (
-	sbomImage  string
-	sbomOutput string
-	sbomFormat string
-	sbomAttest bool
+	sbomImage    string
+	sbomOutput   string
+	sbomFormat   string
+	sbomTool     string
+	sbomAttest   bool
+	sbomGenerate bool // Subcommands: generate even when an SBOM is attested
 )
 
 var sbomCmd = &cobra.Command{
 	Use:   "sbom [image]",
 	Short: "Generate SBOM for a container image",
-	Long: `Generate a Software Bill of Materials (SBOM) for a container image using Trivy.
+	Long: `Generate a Software Bill of Materials (SBOM) for a container image.
+
+Supported tools:
+  auto         - trivy if installed, then syft, then trivy in a container (default)
+  trivy        - Trivy, from PATH or in a podman container
+  syft         - Syft
 
 Supported formats:
   spdx-json    - SPDX JSON format (default)
   cyclonedx    - CycloneDX JSON format
-  json         - Trivy JSON format
+  json         - Trivy JSON format (trivy only)
 
 Defaults:
   - If no image is provided, defaults to galena:main
@@ -45,6 +52,9 @@ Examples:
   # Generate CycloneDX SBOM
   galena-build sbom ghcr.io/myorg/myimage:stable --format cyclonedx
 
+  # Generate SBOM with syft
+  galena-build sbom ghcr.io/myorg/myimage:stable --tool syft
+
   # Generate SBOM for default image (galena:main)
   galena-build sbom
 
@@ -56,8 +66,9 @@ Examples:
 
 func init() {
 	sbomCmd.Flags().StringVar(&sbomImage, "image", "", "Image reference (default: galena:main)")
-	sbomCmd.Flags().StringVarP(&sbomOutput, "output", "o", "", "Output file path (default: sbom.<format>)")
+	sbomCmd.Flags().StringVarP(&sbomOutput, "output", "o", "", "Output file path (default: sbom.<format>.json)")
 	sbomCmd.Flags().StringVarP(&sbomFormat, "format", "f", "spdx-json", "SBOM format (spdx-json, cyclonedx, json)")
+	sbomCmd.Flags().StringVar(&sbomTool, "tool", build.SBOMToolAuto, "SBOM tool (auto, trivy, syft)")
 	sbomCmd.Flags().BoolVar(&sbomAttest, "attest", false, "Attest SBOM to image using cosign")
 }
 
@@ -74,19 +85,28 @@ func runSBOM(cmd *cobra.Command, args []string) error {
 	} else {
 		imageRef = "galena:main"
 	}
-	if err := platform.RequireLinux("sbom"); err != nil {
+	if err := platform.Require(platform.ContainerTools, "sbom"); err != nil {
 		cmd.PrintErrln(err)
 		return err
 	}
 
+	format, err := build.NormalizeSBOMFormat(sbomFormat)
+	if err != nil {
+		return err
+	}
+	provider, err := build.NewSBOMProvider(sbomTool, rootDir)
+	if err != nil {
+		return err
+	}
+
 	// Determine output file
 	outputFile := sbomOutput
 	if outputFile == "" {
-		format := sbomFormat
-		if format == "spdx-json" {
-			format = "spdx"
-		}
-		outputFile = filepath.Join(rootDir, fmt.Sprintf("sbom.%s.json", format))
+		outputFile = filepath.Join(rootDir, build.SBOMFileName(format, ""))
+	}
+
+	if err := ref.Validate(imageRef); err != nil {
+		return err
 	}
 
 	resolvedRef, localImage := ensureLocalImage(ctx, imageRef)
@@ -94,25 +114,29 @@ func runSBOM(cmd *cobra.Command, args []string) error {
 		imageRef = resolvedRef
 	}
 
-	if exec.CheckCommand("trivy") {
-		if err := generateSBOMWithTrivy(ctx, imageRef, outputFile, localImage, rootDir); err != nil {
-			return err
-		}
-	} else {
-		if err := generateSBOMWithTrivyContainer(ctx, imageRef, outputFile, localImage, rootDir); err != nil {
-			return err
-		}
+	if err := generateSBOM(ctx, provider, imageRef, localImage, format, outputFile, rootDir); err != nil {
+		return err
 	}
 
 	// Attest if requested
 	if sbomAttest {
-		if err := attestSBOM(ctx, imageRef, outputFile); err != nil {
+		if err := attestSBOM(ctx, imageRef, outputFile, format); err != nil {
 			return err
 		}
 	}
 
+	if output.IsJSON() {
+		return output.EmitSummary("sbom", map[string]any{
+			"image":    imageRef,
+			"tool":     provider.Name(),
+			"format":   format,
+			"output":   outputFile,
+			"attested": sbomAttest,
+		}, nil)
+	}
+
 	fmt.Println()
-	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("SBOM generated successfully!\n\nFormat: %s\nOutput: %s", sbomFormat, outputFile)))
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("SBOM generated successfully!\n\nTool: %s\nFormat: %s\nOutput: %s", provider.Name(), format, outputFile)))
 
 	return nil
 }
@@ -131,7 +155,7 @@ func ensureLocalImage(ctx context.Context, imageRef string) (string, bool) {
 
 	for _, candidate := range candidates {
 		logger.Info("image not found locally, attempting pull", "image", candidate)
-		pull := exec.Podman(ctx, "pull", candidate)
+		pull := exec.Pull(ctx, "podman", candidate)
 		if pull.Err == nil {
 			return candidate, true
 		}
@@ -145,198 +169,58 @@ func ensureLocalImage(ctx context.Context, imageRef string) (string, bool) {
 	return "", false
 }
 
-func createSBOMArchivePath(rootDir string) (string, func(), error) {
-	candidates := []string{}
-	if v := strings.TrimSpace(os.Getenv("GALENA_SBOM_ARCHIVE_DIR")); v != "" {
-		candidates = append(candidates, v)
-	}
-	// GitHub Actions workflow mounts podman storage here (large btrfs volume)
-	candidates = append(candidates,
-		"/var/lib/containers",
-		filepath.Join(rootDir, ".cache"),
-		os.TempDir(),
-	)
-
-	for _, dir := range candidates {
-		if strings.TrimSpace(dir) == "" {
-			continue
-		}
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			continue
-		}
-		f, err := os.CreateTemp(dir, "galena-sbom-*.tar")
+// generateSBOM writes the SBOM of an image with a provider. Local images
+// are scanned from a docker archive so the tool sees the local copy.
+func generateSBOM(ctx context.Context, provider build.SBOMProvider, imageRef string, localImage bool, format, outputFile, rootDir string) error {
+	req := build.SBOMRequest{Image: imageRef, Format: format, Output: outputFile}
+	if localImage && exec.CheckCommand("podman") {
+		archivePath, cleanup, err := saveImageArchive(ctx, rootDir, imageRef)
 		if err != nil {
-			continue
-		}
-		path := f.Name()
-		_ = f.Close()
-		_ = os.Remove(path)
-
-		cleanup := func() {
-			_ = os.Remove(path)
+			return err
 		}
-		return path, cleanup, nil
+		defer cleanup()
+		req.Archive = archivePath
 	}
 
-	return "", nil, fmt.Errorf("no writable directory found for SBOM archive")
-}
-
-func generateSBOMWithTrivy(ctx context.Context, imageRef, outputFile string, localImage bool, rootDir string) error {
-	trivyEnv := ensureTrivyEnv(rootDir)
-	timeout := trivyTimeout()
 	logger.Info("generating SBOM",
 		"image", imageRef,
-		"format", sbomFormat,
+		"tool", provider.Name(),
+		"format", format,
 		"output", outputFile,
-		"timeout", timeout,
 	)
-
-	if localImage && exec.CheckCommand("podman") {
-		archivePath, cleanup, err := createSBOMArchivePath(rootDir)
-		if err == nil {
-			defer cleanup()
-			logger.Info("trivy scan via podman archive", "path", archivePath)
-			save := exec.Podman(ctx, "image", "save", "--format", "docker-archive", "-o", archivePath, imageRef)
-			if save.Err == nil {
-				result := runTrivy(ctx, trivyEnv, "image", "--timeout", timeout, "--input", archivePath, "--format", sbomFormat, "--output", outputFile)
-				if result.Err == nil {
-					logger.Info("SBOM generated", "output", outputFile)
-					return nil
-				}
-				logger.Error("SBOM generation via archive failed", "stderr", exec.LastNLines(result.Stderr, 20))
-				return fmt.Errorf("SBOM generation via archive failed: %w", result.Err)
-			} else {
-				logger.Error("podman image save failed", "stderr", exec.LastNLines(save.Stderr, 20))
-				return fmt.Errorf("podman image save failed: %w", save.Err)
-			}
-		} else {
-			logger.Error("could not create SBOM archive path", "error", err)
-			return fmt.Errorf("could not create SBOM archive path: %w", err)
-		}
-	}
-
-	result := runTrivy(ctx, trivyEnv, "image", "--timeout", timeout, "--format", sbomFormat, "--output", outputFile, imageRef)
-	if result.Err != nil {
-		logger.Error("SBOM generation failed", "stderr", exec.LastNLines(result.Stderr, 20))
-		return fmt.Errorf("SBOM generation failed: %w", result.Err)
-	}
-
-	logger.Info("SBOM generated", "output", outputFile)
-	return nil
-}
-
-func generateSBOMWithTrivyContainer(ctx context.Context, imageRef, outputFile string, localImage bool, rootDir string) error {
-	if !exec.CheckCommand("podman") {
-		msg := "trivy not found and podman unavailable; cannot generate SBOM"
-		logger.Error(msg)
-		return fmt.Errorf("%s", msg)
-	}
-
-	logger.Info("trivy not found; using container fallback")
-	timeout := trivyTimeout()
-
-	if localImage {
-		archivePath, cleanup, err := createSBOMArchivePath(rootDir)
-		if err == nil {
-			defer cleanup()
-			logger.Info("trivy container scan via podman archive", "path", archivePath)
-			save := exec.Podman(ctx, "image", "save", "--format", "docker-archive", "-o", archivePath, imageRef)
-			if save.Err == nil {
-				archiveDir := filepath.Dir(archivePath)
-				args := []string{
-					"run", "--rm",
-					"-v", fmt.Sprintf("%s:%s:Z", rootDir, rootDir),
-					"-v", fmt.Sprintf("%s:%s:Z", archiveDir, archiveDir),
-					"-w", rootDir,
-					trivyContainerImage,
-					"image", "--input", archivePath,
-					"--timeout", timeout,
-					"--format", sbomFormat, "--output", outputFile,
-				}
-				result := exec.Podman(ctx, args...)
-				if result.Err == nil {
-					logger.Info("SBOM generated", "output", outputFile)
-					return nil
-				}
-				logger.Error("SBOM generation via archive failed", "stderr", exec.LastNLines(result.Stderr, 20))
-				return fmt.Errorf("SBOM generation via archive failed: %w", result.Err)
-			} else {
-				logger.Error("podman image save failed", "stderr", exec.LastNLines(save.Stderr, 20))
-				return fmt.Errorf("podman image save failed: %w", save.Err)
-			}
-		} else {
-			logger.Error("could not create SBOM archive path", "error", err)
-			return fmt.Errorf("could not create SBOM archive path: %w", err)
-		}
-	}
-
-	// Direct scan fallback if not local or pipe failed
-	directArgs := []string{
-		"run", "--rm",
-		"-v", fmt.Sprintf("%s:%s:Z", rootDir, rootDir),
-		"-w", rootDir,
-		trivyContainerImage,
-		"image", "--timeout", timeout, "--format", sbomFormat, "--output", outputFile, imageRef,
-	}
-
-	result := exec.Podman(ctx, directArgs...)
-	if result.Err != nil {
-		logger.Error("SBOM generation failed", "stderr", exec.LastNLines(result.Stderr, 20))
-		return fmt.Errorf("SBOM generation failed: %w", result.Err)
+	if err := provider.Generate(ctx, req); err != nil {
+		logger.Error("SBOM generation failed", "error", err)
+		return fmt.Errorf("SBOM generation failed: %w", err)
 	}
 
 	logger.Info("SBOM generated", "output", outputFile)
 	return nil
 }
 
-func trivyTimeout() string {
-	if timeout := strings.TrimSpace(os.Getenv("GALENA_TRIVY_TIMEOUT")); timeout != "" {
-		return timeout
+// saveImageArchive saves a local image to a temporary docker archive
+func saveImageArchive(ctx context.Context, rootDir, imageRef string) (string, func(), error) {
+	archivePath, cleanup, err := build.ImageArchivePath(rootDir)
+	if err != nil {
+		return "", nil, err
 	}
-	if timeout := strings.TrimSpace(os.Getenv("TRIVY_TIMEOUT")); timeout != "" {
-		return timeout
+	logger.Info("saving image archive", "image", imageRef, "path", archivePath)
+	save := exec.Podman(ctx, "image", "save", "--format", "docker-archive", "-o", archivePath, imageRef)
+	if save.Err != nil {
+		cleanup()
+		logger.Error("podman image save failed", "stderr", exec.LastNLines(save.Stderr, 20))
+		return "", nil, fmt.Errorf("podman image save failed: %w", save.Err)
 	}
-	return defaultTrivyTimeout
+	return archivePath, cleanup, nil
 }
 
 func candidateImageRefs(imageRef string) []string {
-	candidates := []string{imageRef}
-	if strings.Contains(imageRef, "/") || strings.HasPrefix(imageRef, "localhost/") {
-		return candidates
-	}
-
-	name, tag := splitSimpleRef(imageRef)
-	if name == "" {
-		return candidates
+	exp := ref.Expansion{}
+	if cfg != nil {
+		exp.Registry = cfg.Registry
+		exp.Repository = cfg.Repository
 	}
-
-	registry := "ghcr.io"
-	if cfg != nil && cfg.Registry != "" {
-		registry = cfg.Registry
-	}
-
-	if cfg != nil && cfg.Repository != "" {
-		candidates = append(candidates, fmt.Sprintf("%s/%s/%s:%s", registry, cfg.Repository, name, tag))
-	}
-
-	if owner, repo := detectGitHubOwnerRepo(); owner != "" {
-		repoName := strings.ToLower(repo)
-		if repoName == "" {
-			repoName = name
-		}
-		candidates = append(candidates, fmt.Sprintf("%s/%s/%s:%s", registry, owner, name, tag))
-		candidates = append(candidates, fmt.Sprintf("%s/%s/%s:%s", registry, owner, repoName, tag))
-	}
-
-	return uniqueStrings(candidates)
-}
-
-func splitSimpleRef(imageRef string) (string, string) {
-	parts := strings.Split(imageRef, ":")
-	if len(parts) == 1 {
-		return parts[0], "latest"
-	}
-	return parts[0], parts[len(parts)-1]
+	exp.Owner, exp.Repo = detectGitHubOwnerRepo()
+	return ref.Candidates(imageRef, exp)
 }
 
 func detectGitHubOwnerRepo() (string, string) {
@@ -375,30 +259,19 @@ func splitOwnerRepo(value string) (string, string) {
 	return parts[0], parts[1]
 }
 
-func uniqueStrings(values []string) []string {
-	seen := make(map[string]struct{}, len(values))
-	unique := make([]string, 0, len(values))
-	for _, value := range values {
-		if _, ok := seen[value]; ok {
-			continue
-		}
-		seen[value] = struct{}{}
-		unique = append(unique, value)
-	}
-	return unique
-}
-
-func attestSBOM(ctx context.Context, imageRef, sbomFile string) error {
+func attestSBOM(ctx context.Context, imageRef, sbomFile, format string) error {
 	if err := exec.RequireCommands("cosign"); err != nil {
 		return fmt.Errorf("cosign not found for attestation: %w", err)
 	}
 
 	logger.Info("attesting SBOM to image", "image", imageRef)
 
-	result := exec.Cosign(ctx, "attest", "--yes", "--predicate", sbomFile, "--type", "spdxjson", imageRef)
-	if result.Err != nil {
-		logger.Error("SBOM attestation failed", "stderr", result.Stderr)
-		return fmt.Errorf("SBOM attestation failed: %w", result.Err)
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	if err := build.NewSigner(rootDir, cfg.Signing).Attest(ctx, imageRef, sbomFile, build.SBOMPredicateType(format)); err != nil {
+		return fmt.Errorf("SBOM attestation failed: %w", err)
 	}
 
 	logger.Info("SBOM attested to image")
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	attachSBOMFile   string
+	attachAsReferrer bool
+)
+
+var sbomAttachCmd = &cobra.Command{
+	Use:   "attach <image>",
+	Short: "Attach an SBOM to a pushed image",
+	Long: `Attach an SBOM to an image in a registry.
+
+By default the SBOM is attached as a signed cosign attestation, which
+verify and cosign verify-attestation check. With --as-referrer it is pushed
+as an OCI 1.1 referrer artifact (with oras, or cosign when oras is not
+installed), which registries like GHCR and Harbor list next to the image.
+
+The SBOM defaults to sbom.spdx.json in the project root and is generated
+(see --tool) when it does not exist. SPDX and CycloneDX JSON are supported.
+
+Examples:
+  # Attest the SBOM of the last build
+  galena-build sbom attach ghcr.io/acme/galena:stable
+
+  # Attach a CycloneDX SBOM as an OCI referrer
+  galena-build sbom attach ghcr.io/acme/galena:stable --sbom sbom.cyclonedx.json --as-referrer`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSBOMAttach,
+}
+
+func init() {
+	sbomCmd.AddCommand(sbomAttachCmd)
+	sbomAttachCmd.Flags().StringVar(&attachSBOMFile, "sbom", "", "SBOM file (default: sbom.spdx.json)")
+	sbomAttachCmd.Flags().BoolVar(&attachAsReferrer, "as-referrer", false, "Attach as an OCI 1.1 referrer instead of a cosign attestation")
+	sbomAttachCmd.Flags().StringVar(&sbomTool, "tool", build.SBOMToolAuto, "SBOM tool when the SBOM must be generated (auto, trivy, syft)")
+}
+
+func runSBOMAttach(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "sbom attach"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	imageRef, err := ref.Normalize(args[0])
+	if err != nil {
+		return err
+	}
+
+	path := attachSBOMFile
+	if path == "" {
+		path = filepath.Join(rootDir, build.SBOMFileName(build.SBOMFormatSPDX, ""))
+		if _, err := os.Stat(path); err != nil {
+			provider, err := build.NewSBOMProvider(sbomTool, rootDir)
+			if err != nil {
+				return err
+			}
+			if err := generateSBOM(ctx, provider, imageRef, false, build.SBOMFormatSPDX, path, rootDir); err != nil {
+				return err
+			}
+		}
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading SBOM: %w", err)
+	}
+	format, err := build.DetectSBOMFormat(data)
+	if err != nil {
+		return err
+	}
+
+	var referrer *build.SBOMReferrer
+	if attachAsReferrer {
+		logger.Info("attaching SBOM as referrer", "image", imageRef, "sbom", path)
+		referrer, err = build.AttachSBOMReferrer(ctx, imageRef, path)
+	} else {
+		err = attestSBOM(ctx, imageRef, path, format)
+	}
+
+	if output.IsJSON() {
+		result := map[string]any{"image": imageRef, "sbom": path, "format": format, "referrer": referrer}
+		return output.EmitSummary("sbom-attach", result, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("SBOM attached!\n\nImage: %s\nSBOM: %s", imageRef, path)
+	if referrer != nil {
+		summary += fmt.Sprintf("\nReferrer: %s (%s)", referrer.ArtifactType, referrer.Tool)
+		if referrer.Digest != "" {
+			summary += "\nDigest: " + referrer.Digest
+		}
+	} else {
+		summary += "\nAttestation: " + build.SBOMPredicateType(format)
+	}
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
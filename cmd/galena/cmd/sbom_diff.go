@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	sbomDiffMarkdown bool
+	sbomDiffOutput   string
+)
+
+var sbomDiffCmd = &cobra.Command{
+	Use:   "diff <old-image> <new-image>",
+	Short: "Show package changes between two images",
+	Long: `Compare the SBOMs of two images and list the packages that were added,
+removed, or updated, grouped by package type (rpm, pypi, golang, ...).
+
+The SBOM attested to each image is downloaded with cosign; images without
+an attested SBOM are scanned with the SBOM tool (see --tool). SPDX and
+CycloneDX JSON files can be passed instead of images.
+
+--markdown renders a "Package Changes" section for release notes.
+
+Examples:
+  # Compare two releases
+  galena-build sbom diff ghcr.io/acme/galena:43.20250101 ghcr.io/acme/galena:43.20250201
+
+  # Write release notes from the previous stable image and a fresh build
+  galena-build sbom diff ghcr.io/acme/galena:stable galena:main --markdown -o package-changes.md
+
+  # Compare SBOM files
+  galena-build sbom diff old.spdx.json sbom.spdx.json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSBOMDiff,
+}
+
+func init() {
+	sbomCmd.AddCommand(sbomDiffCmd)
+	sbomDiffCmd.Flags().StringVar(&sbomTool, "tool", build.SBOMToolAuto, "SBOM tool for images without an attested SBOM (auto, trivy, syft)")
+	sbomDiffCmd.Flags().BoolVar(&sbomGenerate, "generate", false, "Always generate SBOMs instead of downloading attested ones")
+	sbomDiffCmd.Flags().BoolVar(&sbomDiffMarkdown, "markdown", false, "Print the changes as a Markdown release notes section")
+	sbomDiffCmd.Flags().StringVarP(&sbomDiffOutput, "file", "o", "", "Write the Markdown section to a file")
+}
+
+func runSBOMDiff(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "sbom diff"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	oldPkgs, err := sbomPackages(ctx, rootDir, args[0])
+	if err != nil {
+		return err
+	}
+	newPkgs, err := sbomPackages(ctx, rootDir, args[1])
+	if err != nil {
+		return err
+	}
+	diff := build.DiffSBOMs(args[0], oldPkgs, args[1], newPkgs)
+
+	if sbomDiffOutput != "" {
+		if err := os.WriteFile(sbomDiffOutput, []byte(diff.Markdown()), 0o644); err != nil {
+			return fmt.Errorf("writing %s: %w", sbomDiffOutput, err)
+		}
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("sbom-diff", diff, nil)
+	}
+	if sbomDiffMarkdown {
+		fmt.Print(diff.Markdown())
+		return nil
+	}
+
+	if diff.Empty() {
+		fmt.Println()
+		fmt.Println(ui.InfoBox.Render(fmt.Sprintf("No package changes\n\n%s\n%s", args[0], args[1])))
+		return nil
+	}
+
+	for _, typ := range diff.Types() {
+		fmt.Println()
+		fmt.Println(ui.Title.Render(typ))
+		for _, c := range diff.Added {
+			if c.Type == typ {
+				fmt.Printf("  %s %s %s\n", ui.SuccessStyle.Render("+"), c.Name, ui.MutedStyle.Render(c.NewVersion))
+			}
+		}
+		for _, c := range diff.Updated {
+			if c.Type == typ {
+				fmt.Printf("  %s %s %s\n", ui.WarningStyle.Render("~"), c.Name, ui.MutedStyle.Render(c.OldVersion+" → "+c.NewVersion))
+			}
+		}
+		for _, c := range diff.Removed {
+			if c.Type == typ {
+				fmt.Printf("  %s %s %s\n", ui.ErrorStyle.Render("-"), c.Name, ui.MutedStyle.Render(c.OldVersion))
+			}
+		}
+	}
+
+	summary := fmt.Sprintf("Package changes\n\nAdded: %d\nUpdated: %d\nRemoved: %d", len(diff.Added), len(diff.Updated), len(diff.Removed))
+	if sbomDiffOutput != "" {
+		summary += "\nRelease notes: " + sbomDiffOutput
+	}
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
+
+// sbomPackages lists the packages of an SBOM file, the SBOM attested to an
+// image, or a freshly generated SBOM of the image
+func sbomPackages(ctx context.Context, rootDir, target string) ([]build.SBOMPackage, error) {
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+		return build.ParseSBOMPackages(data)
+	}
+	if err := ref.Validate(target); err != nil {
+		return nil, err
+	}
+
+	if !sbomGenerate && exec.CheckCommand("cosign") {
+		data, err := build.DownloadSBOM(ctx, target)
+		if err == nil {
+			logger.Info("using attested SBOM", "image", target)
+			return build.ParseSBOMPackages(data)
+		}
+		logger.Info("no attested SBOM, generating one", "image", target, "reason", err)
+	}
+
+	provider, err := build.NewSBOMProvider(sbomTool, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	cacheDir := build.ToolCacheDir(rootDir, "sbom")
+	_ = os.MkdirAll(cacheDir, 0o755)
+	tmp, err := os.MkdirTemp(cacheDir, "galena-sbom-")
+	if err != nil {
+		if tmp, err = os.MkdirTemp("", "galena-sbom-"); err != nil {
+			return nil, err
+		}
+	}
+	defer os.RemoveAll(tmp)
+
+	imageRef := target
+	resolvedRef, localImage := ensureLocalImage(ctx, imageRef)
+	if resolvedRef != "" {
+		imageRef = resolvedRef
+	}
+	path := filepath.Join(tmp, build.SBOMFileName(build.SBOMFormatSPDX, ""))
+	if err := generateSBOM(ctx, provider, imageRef, localImage, build.SBOMFormatSPDX, path, rootDir); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return build.ParseSBOMPackages(data)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	licensesFormat string
+	licensesOutput string
+	licensesStrict bool
+)
+
+var sbomLicensesCmd = &cobra.Command{
+	Use:   "licenses [image]",
+	Short: "Summarize the licenses in an image SBOM",
+	Long: `List the licenses of the packages in an image and check them against
+sbom.licenses in galena.yaml. With an allow list every package needs an
+allowed license; denied licenses are always violations. Entries are SPDX
+license IDs or glob patterns like GPL-*.
+
+The SBOM attested to the image is used when present; otherwise one is
+generated (see --tool). An SPDX or CycloneDX JSON file can be passed instead
+of an image. Defaults to galena:main.
+
+Examples:
+  # License summary of the main image
+  galena-build sbom licenses
+
+  # CSV for compliance review
+  galena-build sbom licenses ghcr.io/acme/galena:stable --format csv -o licenses.csv
+
+  # Fail when a package breaks the policy
+  galena-build sbom licenses sbom.spdx.json --strict`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSBOMLicenses,
+}
+
+func init() {
+	sbomCmd.AddCommand(sbomLicensesCmd)
+	sbomLicensesCmd.Flags().StringVar(&licensesFormat, "format", "table", "Output format (table, json, csv, markdown)")
+	sbomLicensesCmd.Flags().StringVarP(&licensesOutput, "file", "o", "", "Write the report to a file instead of stdout")
+	sbomLicensesCmd.Flags().StringVar(&sbomTool, "tool", build.SBOMToolAuto, "SBOM tool for images without an attested SBOM (auto, trivy, syft)")
+	sbomLicensesCmd.Flags().BoolVar(&sbomGenerate, "generate", false, "Always generate the SBOM instead of downloading the attested one")
+	sbomLicensesCmd.Flags().BoolVar(&licensesStrict, "strict", false, "Exit with an error when a package breaks the license policy")
+}
+
+func runSBOMLicenses(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "sbom licenses"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	target := "galena:main"
+	if len(args) > 0 {
+		target = args[0]
+	}
+	pkgs, err := sbomPackages(ctx, rootDir, target)
+	if err != nil {
+		return err
+	}
+	report := build.NewLicenseReport(target, pkgs, cfg.SBOM.Licenses)
+
+	var violationErr error
+	if licensesStrict && len(report.Violations) > 0 {
+		violationErr = fmt.Errorf("%d packages break the license policy", len(report.Violations))
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("sbom-licenses", report, violationErr)
+	}
+
+	var rendered string
+	switch licensesFormat {
+	case "table":
+		if licensesOutput == "" {
+			printLicenseReport(report)
+			return violationErr
+		}
+		rendered = report.Markdown()
+	case "markdown":
+		rendered = report.Markdown()
+	case "csv":
+		rendered = report.CSV()
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		rendered = string(data) + "\n"
+	default:
+		return fmt.Errorf("unknown format %q (use table, json, csv, or markdown)", licensesFormat)
+	}
+
+	if licensesOutput != "" {
+		if err := os.WriteFile(licensesOutput, []byte(rendered), 0o644); err != nil {
+			return fmt.Errorf("writing %s: %w", licensesOutput, err)
+		}
+		logger.Info("license report written", "file", licensesOutput, "violations", len(report.Violations))
+	} else {
+		fmt.Print(rendered)
+	}
+	return violationErr
+}
+
+// printLicenseReport prints the license counts and violations
+func printLicenseReport(report *build.LicenseReport) {
+	fmt.Println()
+	fmt.Println(ui.Title.Render("Licenses"))
+	for _, l := range report.Licenses {
+		line := fmt.Sprintf("  %5d  %s", l.Packages, l.License)
+		if l.Violation != "" {
+			fmt.Println(ui.ErrorStyle.Render(line))
+		} else {
+			fmt.Println(line)
+		}
+	}
+
+	fmt.Println()
+	if len(report.Violations) == 0 {
+		fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("No license policy violations\n\n%d packages in %s", report.Packages, report.Source)))
+		return
+	}
+	fmt.Println(ui.Title.Render("Violations"))
+	for _, v := range report.Violations {
+		fmt.Printf("  %s %s %s\n", ui.ErrorStyle.Render("✗"), v.Package, ui.MutedStyle.Render(v.Version))
+		fmt.Println(ui.MutedStyle.Render("    " + v.License + ": " + v.Reason))
+	}
+	fmt.Println()
+	fmt.Println(ui.WarningBox.Render(fmt.Sprintf("%d of %d packages break the license policy", len(report.Violations), report.Packages)))
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	publishProject string
+	publishVersion string
+	publishURL     string
+)
+
+var sbomPublishCmd = &cobra.Command{
+	Use:   "publish [image|sbom]",
+	Short: "Upload an image SBOM to Dependency-Track",
+	Long: `Upload a CycloneDX SBOM to Dependency-Track so its dashboards track
+the image. The SBOM is uploaded as a version of the project named in
+sbom.dependency_track.project (default: the project name); the project is
+created on first upload.
+
+For an image, a CycloneDX SBOM is generated (see --tool) and the image tag
+is the version. A CycloneDX JSON file can be passed instead, with --version.
+
+The server comes from sbom.dependency_track.url or DEPENDENCY_TRACK_URL and
+the API key from the variable named in sbom.dependency_track.api_key_env
+(default DEPENDENCY_TRACK_API_KEY). The key needs the BOM_UPLOAD and
+PROJECT_CREATION_UPLOAD permissions.
+
+Examples:
+  # Publish the SBOM of a release
+  galena-build sbom publish ghcr.io/acme/galena:43.20250201
+
+  # Publish an existing CycloneDX SBOM
+  galena-build sbom publish sbom.cyclonedx.json --version 43.20250201`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSBOMPublish,
+}
+
+func init() {
+	sbomCmd.AddCommand(sbomPublishCmd)
+	sbomPublishCmd.Flags().StringVar(&publishProject, "project", "", "Dependency-Track project name (default: sbom.dependency_track.project)")
+	sbomPublishCmd.Flags().StringVar(&publishVersion, "version", "", "Project version (default: the image tag)")
+	sbomPublishCmd.Flags().StringVar(&publishURL, "url", "", "Dependency-Track server URL (default: sbom.dependency_track.url)")
+	sbomPublishCmd.Flags().StringVar(&sbomTool, "tool", build.SBOMToolAuto, "SBOM tool (auto, trivy, syft)")
+}
+
+func runSBOMPublish(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "sbom publish"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	target := "galena:main"
+	if len(args) > 0 {
+		target = args[0]
+	}
+	version := publishVersion
+
+	path := target
+	if info, err := os.Stat(target); err != nil || info.IsDir() {
+		r, err := ref.Parse(target)
+		if err != nil {
+			return err
+		}
+		if version == "" {
+			version = r.Tag
+		}
+		if version == "" {
+			version = ref.DefaultTag
+		}
+
+		path = filepath.Join(rootDir, build.SBOMFileName(build.SBOMFormatCycloneDX, ""))
+		if err := generateCycloneDX(ctx, rootDir, target, path); err != nil {
+			return err
+		}
+	} else if version == "" {
+		return fmt.Errorf("--version is required when publishing an SBOM file")
+	}
+
+	publication, err := publishSBOM(ctx, path, publishProject, version)
+	if output.IsJSON() {
+		return output.EmitSummary("sbom-publish", publication, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("SBOM published!\n\nServer: %s\nProject: %s\nVersion: %s\nSBOM: %s",
+		publication.Server, publication.Project, publication.Version, path)))
+	return nil
+}
+
+// generateCycloneDX writes the CycloneDX SBOM of an image
+func generateCycloneDX(ctx context.Context, rootDir, imageRef, path string) error {
+	provider, err := build.NewSBOMProvider(sbomTool, rootDir)
+	if err != nil {
+		return err
+	}
+	resolvedRef, localImage := ensureLocalImage(ctx, imageRef)
+	if resolvedRef != "" {
+		imageRef = resolvedRef
+	}
+	return generateSBOM(ctx, provider, imageRef, localImage, build.SBOMFormatCycloneDX, path, rootDir)
+}
+
+// publishSBOM uploads an SBOM to the configured Dependency-Track server.
+// The project defaults to sbom.dependency_track.project, then the project name.
+func publishSBOM(ctx context.Context, path, project, version string) (*build.SBOMPublication, error) {
+	dt := cfg.SBOM.DependencyTrack
+	if publishURL != "" {
+		dt.URL = publishURL
+	}
+	if project == "" {
+		project = dt.Project
+	}
+	if project == "" {
+		project = cfg.Name
+	}
+
+	logger.Info("publishing SBOM", "sbom", path, "project", project, "version", version)
+	publication, err := build.PublishSBOM(ctx, dt, path, project, version)
+	if err != nil {
+		return nil, fmt.Errorf("publishing SBOM: %w", err)
+	}
+	logger.Info("SBOM published", "server", publication.Server, "token", publication.Token)
+	return publication, nil
+}
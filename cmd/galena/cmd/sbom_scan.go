@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var sbomScanner string
+
+var sbomScanCmd = &cobra.Command{
+	Use:   "scan <sbom>",
+	Short: "Scan an existing SBOM for vulnerabilities",
+	Long: `Match the packages of an existing SPDX or CycloneDX SBOM against
+vulnerability databases with grype or trivy, without rescanning the image.
+This is much faster than scan when the SBOM is already a build artifact.
+
+The same policy as scan applies: --severity, --ignore-file, --ignore-unfixed,
+--fail-on, and the scan section of galena.yaml. For grype, the ignore file
+is read as a list of vulnerability IDs.
+
+Examples:
+  # Scan the SBOM of the last build
+  galena-build sbom scan sbom.spdx.json
+
+  # Gate on critical vulnerabilities with grype
+  galena-build sbom scan sbom.spdx.json --scanner grype --fail-on CRITICAL`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSBOMScan,
+}
+
+func init() {
+	sbomCmd.AddCommand(sbomScanCmd)
+	sbomScanCmd.Flags().StringVar(&sbomScanner, "scanner", build.SBOMToolAuto, "Vulnerability scanner (auto, trivy, grype)")
+	sbomScanCmd.Flags().StringVarP(&scanOutput, "file", "o", "", "Report file path (default: vulnerabilities.json)")
+	sbomScanCmd.Flags().StringSliceVar(&scanSeverity, "severity", nil, "Severities to report (UNKNOWN, LOW, MEDIUM, HIGH, CRITICAL)")
+	sbomScanCmd.Flags().StringVar(&scanIgnoreFile, "ignore-file", "", "Ignore file (default: .trivyignore)")
+	sbomScanCmd.Flags().StringVar(&scanFailOn, "fail-on", "", "Fail when a vulnerability of at least this severity is found")
+	sbomScanCmd.Flags().BoolVar(&scanIgnoreUnfixed, "ignore-unfixed", false, "Skip vulnerabilities without a fixed version")
+	sbomScanCmd.Flags().IntVar(&scanTop, "top", 10, "Number of findings to list")
+}
+
+func runSBOMScan(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "sbom scan"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	sbomPath, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(sbomPath); err != nil {
+		return fmt.Errorf("SBOM: %w", err)
+	}
+
+	policy := scanPolicy()
+	reportFile := scanOutput
+	if reportFile == "" {
+		reportFile = filepath.Join(rootDir, "vulnerabilities.json")
+	}
+
+	report, err := scanSBOM(ctx, rootDir, sbomPath, reportFile, sbomScanner, policy)
+	if err == nil {
+		err = report.Check(policy.FailOn)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("sbom-scan", report, err)
+	}
+	if report == nil {
+		return err
+	}
+
+	printScanReport(report, scanTop)
+
+	fmt.Println()
+	if err != nil {
+		fmt.Println(ui.ErrorBox.Render(fmt.Sprintf("Scan failed\n\n%s\nReport: %s", err, report.Report)))
+		return err
+	}
+	summary := fmt.Sprintf("Scan complete!\n\nSBOM: %s\nVulnerabilities: %d\nReport: %s", report.Image, len(report.Vulnerabilities), report.Report)
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
+
+// scanSBOM writes the vulnerability report of an SBOM file and parses it.
+// With "auto" an installed trivy is preferred, then grype, then trivy in a
+// container.
+func scanSBOM(ctx context.Context, rootDir, sbomPath, reportFile, scanner string, policy config.ScanConfig) (*build.ScanReport, error) {
+	ignoreFile, err := scanIgnorePath(rootDir, policy.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if scanner == build.SBOMToolAuto || scanner == "" {
+		scanner = build.ScannerTrivy
+		if !exec.CheckCommand("trivy") && exec.CheckCommand("grype") {
+			scanner = build.ScannerGrype
+		}
+	}
+
+	switch scanner {
+	case build.ScannerGrype:
+		if err := exec.RequireCommands("grype"); err != nil {
+			return nil, err
+		}
+		args := []string{"sbom:" + sbomPath, "--output", "json", "--file", reportFile}
+		if policy.IgnoreUnfixed {
+			args = append(args, "--only-fixed")
+		}
+		logger.Info("scanning SBOM", "sbom", sbomPath, "scanner", scanner, "report", reportFile)
+		if result := exec.Grype(ctx, args...); result.Err != nil {
+			logger.Error("vulnerability scan failed", "stderr", exec.LastNLines(result.Stderr, 20))
+			return nil, fmt.Errorf("vulnerability scan failed: %w", result.Err)
+		}
+
+		report, err := build.ParseGrypeReport(sbomPath, reportFile)
+		if err != nil {
+			return nil, err
+		}
+		var ignored []string
+		if ignoreFile != "" {
+			if ignored, err = build.ReadIgnoreFile(ignoreFile); err != nil {
+				return nil, fmt.Errorf("ignore file: %w", err)
+			}
+		}
+		report.Filter(policy, ignored)
+		return report, nil
+
+	case build.ScannerTrivy:
+		useContainer := !exec.CheckCommand("trivy")
+		if useContainer && !exec.CheckCommand("podman") {
+			return nil, fmt.Errorf("trivy not found and podman unavailable; cannot scan SBOM")
+		}
+		args := []string{"sbom", "--timeout", build.TrivyTimeout(), "--output", reportFile}
+		args = append(args, build.TrivyScanFlags(policy, ignoreFile)...)
+		mounts := []string{filepath.Dir(reportFile), filepath.Dir(sbomPath)}
+		if ignoreFile != "" {
+			mounts = append(mounts, filepath.Dir(ignoreFile))
+		}
+
+		logger.Info("scanning SBOM", "sbom", sbomPath, "scanner", scanner, "report", reportFile, "container", useContainer)
+		result := build.RunTrivy(ctx, rootDir, useContainer, mounts, append(args, sbomPath)...)
+		if result.Err != nil {
+			logger.Error("vulnerability scan failed", "stderr", exec.LastNLines(result.Stderr, 20))
+			return nil, fmt.Errorf("vulnerability scan failed: %w", result.Err)
+		}
+		return build.ParseScanReport(sbomPath, reportFile)
+	}
+	return nil, fmt.Errorf("unknown scanner %q (use auto, trivy, or grype)", scanner)
+}
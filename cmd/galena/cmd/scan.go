@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	scanOutput        string
+	scanSeverity      []string
+	scanIgnoreFile    string
+	scanFailOn        string
+	scanIgnoreUnfixed bool
+	scanTop           int
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [image]",
+	Short: "Scan an image for vulnerabilities",
+	Long: `Scan a container image for known vulnerabilities using Trivy.
+
+Trivy runs from PATH, or in a container when it is not installed. Local
+images are scanned from an archive; others are pulled by Trivy. The full
+Trivy JSON report is written to a file and the most severe findings are
+listed.
+
+--fail-on sets the lowest severity that fails the scan, so it can gate
+releases. Findings listed in the ignore file (default: .trivyignore in the
+project root) are not reported. Flags override the scan section of
+galena.yaml.
+
+Examples:
+  # Scan the main image
+  galena-build scan
+
+  # Fail on high and critical vulnerabilities that have a fix
+  galena-build scan ghcr.io/acme/galena:stable --fail-on HIGH --ignore-unfixed
+
+  # Only report critical vulnerabilities
+  galena-build scan galena:main --severity CRITICAL`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runScan,
+}
+
+func init() {
+	scanCmd.Flags().StringVarP(&scanOutput, "file", "o", "", "Report file path (default: vulnerabilities.json)")
+	scanCmd.Flags().StringSliceVar(&scanSeverity, "severity", nil, "Severities to report (UNKNOWN, LOW, MEDIUM, HIGH, CRITICAL)")
+	scanCmd.Flags().StringVar(&scanIgnoreFile, "ignore-file", "", "Trivy ignore file (default: .trivyignore)")
+	scanCmd.Flags().StringVar(&scanFailOn, "fail-on", "", "Fail when a vulnerability of at least this severity is found")
+	scanCmd.Flags().BoolVar(&scanIgnoreUnfixed, "ignore-unfixed", false, "Skip vulnerabilities without a fixed version")
+	scanCmd.Flags().IntVar(&scanTop, "top", 10, "Number of findings to list")
+}
+
+func runScan(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "scan"); err != nil {
+		return err
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	imageRef := "galena:main"
+	if len(args) > 0 {
+		imageRef = args[0]
+	}
+	if err := ref.Validate(imageRef); err != nil {
+		return err
+	}
+
+	policy := scanPolicy()
+	reportFile := scanOutput
+	if reportFile == "" {
+		reportFile = filepath.Join(rootDir, "vulnerabilities.json")
+	}
+
+	resolvedRef, localImage := ensureLocalImage(ctx, imageRef)
+	if resolvedRef != "" {
+		imageRef = resolvedRef
+	}
+
+	report, err := scanImage(ctx, rootDir, imageRef, localImage, reportFile, policy)
+	if err == nil {
+		err = report.Check(policy.FailOn)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("scan", report, err)
+	}
+	if report == nil {
+		return err
+	}
+
+	printScanReport(report, scanTop)
+
+	fmt.Println()
+	if err != nil {
+		fmt.Println(ui.ErrorBox.Render(fmt.Sprintf("Scan failed\n\n%s\nReport: %s", err, report.Report)))
+		return err
+	}
+	summary := fmt.Sprintf("Scan complete!\n\nImage: %s\nVulnerabilities: %d\nReport: %s", report.Image, len(report.Vulnerabilities), report.Report)
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
+
+// scanPolicy returns the scan section of galena.yaml with the flags applied
+func scanPolicy() config.ScanConfig {
+	policy := cfg.Scan
+	if len(scanSeverity) > 0 {
+		policy.Severity = scanSeverity
+	}
+	if scanIgnoreFile != "" {
+		policy.IgnoreFile = scanIgnoreFile
+	}
+	if scanFailOn != "" {
+		policy.FailOn = scanFailOn
+	}
+	if scanIgnoreUnfixed {
+		policy.IgnoreUnfixed = true
+	}
+	return policy
+}
+
+// scanImage writes the Trivy vulnerability report of an image and parses it.
+// Trivy runs from PATH or, like the trivy SBOM provider, in a container.
+func scanImage(ctx context.Context, rootDir, imageRef string, localImage bool, reportFile string, policy config.ScanConfig) (*build.ScanReport, error) {
+	ignoreFile, err := scanIgnorePath(rootDir, policy.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	useContainer := !exec.CheckCommand("trivy")
+	if useContainer && !exec.CheckCommand("podman") {
+		return nil, fmt.Errorf("trivy not found and podman unavailable; cannot scan image")
+	}
+
+	args := []string{"image", "--timeout", build.TrivyTimeout(), "--output", reportFile}
+	args = append(args, build.TrivyScanFlags(policy, ignoreFile)...)
+	mounts := []string{filepath.Dir(reportFile)}
+	if ignoreFile != "" {
+		mounts = append(mounts, filepath.Dir(ignoreFile))
+	}
+
+	if localImage && exec.CheckCommand("podman") {
+		archivePath, cleanup, err := saveImageArchive(ctx, rootDir, imageRef)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		args = append(args, "--input", archivePath)
+		mounts = append(mounts, filepath.Dir(archivePath))
+	} else {
+		args = append(args, imageRef)
+	}
+
+	logger.Info("scanning image", "image", imageRef, "report", reportFile, "container", useContainer)
+	result := build.RunTrivy(ctx, rootDir, useContainer, mounts, args...)
+	if result.Err != nil {
+		logger.Error("vulnerability scan failed", "stderr", exec.LastNLines(result.Stderr, 20))
+		return nil, fmt.Errorf("vulnerability scan failed: %w", result.Err)
+	}
+
+	return build.ParseScanReport(imageRef, reportFile)
+}
+
+// scanIgnorePath resolves the ignore file relative to the project root. The
+// default .trivyignore is optional; an explicit file must exist.
+func scanIgnorePath(rootDir, path string) (string, error) {
+	if path == "" {
+		def := filepath.Join(rootDir, ".trivyignore")
+		if _, err := os.Stat(def); err != nil {
+			return "", nil
+		}
+		return def, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("ignore file: %w", err)
+	}
+	return path, nil
+}
+
+// printScanReport prints the severity counts and the top findings
+func printScanReport(report *build.ScanReport, top int) {
+	fmt.Println()
+	fmt.Println(ui.Title.Render("Vulnerabilities"))
+	severities := config.Severities()
+	for i := len(severities) - 1; i >= 0; i-- {
+		sev := severities[i]
+		line := fmt.Sprintf("  %-9s %d", sev, report.Counts[sev])
+		switch {
+		case report.Counts[sev] == 0:
+			fmt.Println(ui.MutedStyle.Render(line))
+		case sev == "CRITICAL" || sev == "HIGH":
+			fmt.Println(ui.ErrorStyle.Render(line))
+		case sev == "MEDIUM":
+			fmt.Println(ui.WarningStyle.Render(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+
+	if top <= 0 || len(report.Vulnerabilities) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(ui.Title.Render("Top Findings"))
+	for i, v := range report.Vulnerabilities {
+		if i == top {
+			fmt.Println(ui.MutedStyle.Render(fmt.Sprintf("  ... and %d more", len(report.Vulnerabilities)-top)))
+			break
+		}
+		fixed := "no fix"
+		if v.FixedVersion != "" {
+			fixed = "fixed in " + v.FixedVersion
+		}
+		fmt.Printf("  %-9s %s %s %s\n", v.Severity, v.ID, v.Package, v.InstalledVersion)
+		detail := fixed
+		if v.Title != "" {
+			detail = strings.TrimSpace(v.Title) + " (" + fixed + ")"
+		}
+		fmt.Println(ui.MutedStyle.Render("            " + detail))
+	}
+}
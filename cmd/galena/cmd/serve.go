@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	galexec "github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/serve"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	serveDir      string
+	serveAddr     string
+	serveUser     string
+	servePassword string
+	apiAddr       string
+	apiToken      string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the build API, or build outputs with serve artifacts",
+	Long: `Serve an HTTP+JSON API that dashboards and bots use to start builds and disk
+images, follow their logs, and read their results without running the CLI.
+
+Jobs run one at a time, each as a galena-build process with --output-format json.
+Their output is written to logs/api/<job>.log.
+
+Endpoints:
+  GET    /v1/status          Project status, running job, and queue length
+  GET    /v1/manifest        The build manifest of the last build
+  POST   /v1/builds          Start a build: {"variant", "tag", "no_cache", "push", ...}
+  POST   /v1/disks           Start a disk image build: {"type", "image", ...}
+  GET    /v1/jobs            Jobs, newest first
+  GET    /v1/jobs/{id}       A job with its exit code and JSON summary
+  DELETE /v1/jobs/{id}       Cancel a queued or running job
+  GET    /v1/jobs/{id}/log   Job output; ?follow=true streams until it finishes
+
+The API listens on localhost. Requests need "Authorization: Bearer <token>"
+when --token or GALENA_API_TOKEN is set, which is required to listen on other
+addresses. POST bodies must be sent with "Content-Type: application/json".
+
+Examples:
+  galena-build serve
+  curl -X POST localhost:7878/v1/builds -H 'Content-Type: application/json' \
+    -d '{"variant":"main","tag":"stable"}'
+  curl localhost:7878/v1/jobs/<id>/log?follow=true
+
+  # Reachable from other machines
+  GALENA_API_TOKEN=secret galena-build serve --addr 0.0.0.0:7878`,
+	Args: cobra.NoArgs,
+	RunE: runServeAPI,
+}
+
+var serveArtifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Serve the output directory over HTTP",
+	Long: `Expose the output directory over HTTP so ISOs and disk images can be
+fetched by other machines on the LAN or by netboot tooling.
+
+The index page lists every artifact with its size and SHA256 checksum.
+A sha256sum-compatible listing is available at /SHA256SUMS.
+
+Basic auth is enabled when --user is set. The password can also be
+provided with the GALENA_SERVE_PASSWORD environment variable.
+
+Examples:
+  # Serve ./output on port 8080
+  galena-build serve artifacts
+
+  # Serve a custom directory on a specific address
+  galena-build serve artifacts --dir ./images --addr 192.168.1.10:9000
+
+  # Require basic auth
+  GALENA_SERVE_PASSWORD=secret galena-build serve artifacts --user lab`,
+	Args: cobra.NoArgs,
+	RunE: runServeArtifacts,
+}
+
+func init() {
+	serveCmd.AddCommand(serveArtifactsCmd)
+
+	serveCmd.Flags().StringVar(&apiAddr, "addr", serve.DefaultAPIOptions().Addr, "Listen address")
+	serveCmd.Flags().StringVar(&apiToken, "token", "", "Bearer token required on every request (default: $GALENA_API_TOKEN)")
+
+	serveArtifactsCmd.Flags().StringVar(&serveDir, "dir", "", "Directory to serve (default: ./output)")
+	serveArtifactsCmd.Flags().StringVar(&serveAddr, "addr", serve.DefaultOptions().Addr, "Listen address")
+	serveArtifactsCmd.Flags().StringVar(&serveUser, "user", "", "Basic auth username")
+	serveArtifactsCmd.Flags().StringVar(&servePassword, "password", "", "Basic auth password (default: $GALENA_SERVE_PASSWORD)")
+}
+
+func runServeArtifacts(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	opts := serve.DefaultOptions()
+	opts.Dir = serveDir
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(rootDir, "output")
+	}
+	opts.Addr = serveAddr
+	opts.Username = serveUser
+	opts.Password = servePassword
+	if opts.Password == "" {
+		opts.Password = os.Getenv("GALENA_SERVE_PASSWORD")
+	}
+	if opts.Username != "" && opts.Password == "" {
+		return fmt.Errorf("--user requires --password or GALENA_SERVE_PASSWORD")
+	}
+
+	server := serve.NewServer(opts, logger)
+
+	urls := serve.LANURLs(opts.Addr)
+	if len(urls) == 0 {
+		urls = []string{"http://" + opts.Addr + "/"}
+	}
+	fmt.Println(ui.InfoBox.Render(fmt.Sprintf(
+		"Serving artifacts\n\nDirectory: %s\nURLs:\n  %s\nAuth: %t\n\nPress Ctrl+C to stop.",
+		opts.Dir,
+		strings.Join(urls, "\n  "),
+		opts.Username != "",
+	)))
+
+	logger.Info("artifacts server listening", "addr", opts.Addr, "dir", opts.Dir)
+	if err := server.ListenAndServe(ctx); err != nil {
+		return fmt.Errorf("artifacts server: %w", err)
+	}
+
+	logger.Info("artifacts server stopped")
+	return nil
+}
+
+func runServeAPI(cmd *cobra.Command, args []string) error {
+	ctx, stop := interruptibleContext()
+	defer stop()
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding the galena-build binary: %w", err)
+	}
+
+	opts := serve.DefaultAPIOptions()
+	opts.Addr = apiAddr
+	opts.Token = defaultIfEmpty(apiToken, os.Getenv("GALENA_API_TOKEN"))
+	opts.RootDir = rootDir
+	opts.Executable = executable
+	opts.BaseArgs = []string{"--project", rootDir}
+	if cfgFile != "" {
+		opts.BaseArgs = append(opts.BaseArgs, "--config", cfgFile)
+	}
+	if engineName != "" {
+		opts.BaseArgs = append(opts.BaseArgs, "--engine", engineName)
+	}
+	if noSudo {
+		opts.BaseArgs = append(opts.BaseArgs, "--no-sudo")
+	}
+	if dryRun {
+		// Jobs run with --dry-run instead of being skipped by the server
+		opts.BaseArgs = append(opts.BaseArgs, "--dry-run")
+		galexec.SetDryRun(false)
+	}
+	opts.DiskTypes = build.ListOutputTypes()
+	opts.Status = func(ctx context.Context) (map[string]any, error) {
+		status, err := build.NewBuilder(cfg, rootDir, logger).Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		status["galena_version"] = Version
+		if lock := build.CurrentBuildLock(rootDir); lock != nil {
+			status["build_lock"] = lock
+		}
+		return status, nil
+	}
+
+	server := serve.NewAPIServer(opts, logger)
+	fmt.Println(ui.InfoBox.Render(fmt.Sprintf(
+		"Serving the build API\n\nURL: http://%s/v1/\nJob logs: %s\nAuth: %t\n\nPress Ctrl+C to stop; a running job is canceled.",
+		opts.Addr,
+		server.LogDir(),
+		opts.Token != "",
+	)))
+
+	logger.Info("api server listening", "addr", opts.Addr)
+	if err := server.ListenAndServe(ctx); err != nil {
+		return fmt.Errorf("api server: %w", err)
+	}
+	logger.Info("api server stopped")
+	return nil
+}
@@ -20,10 +20,18 @@ var settingsCmd = &cobra.Command{
 }
 
 func runSettings(cmd *cobra.Command, args []string) error {
+	// Each setting is a galena.yaml key, so scripts edit them directly
+	if err := ui.RequireInteractive("settings", "galena-build config set <key> <value> (e.g. ui.dense true, build.defaults.tag stable)"); err != nil {
+		return err
+	}
 	if cfg == nil {
 		cfg = config.DefaultConfig()
 	}
 
+	theme := cfg.UI.Theme
+	if theme == "" {
+		theme = ui.AutoTheme
+	}
 	dense := cfg.UI.Dense
 	noColorPref := cfg.UI.NoColor
 	advancedMode := cfg.UI.Advanced
@@ -57,17 +65,29 @@ func runSettings(cmd *cobra.Command, args []string) error {
 		variantOptions = append(variantOptions, huh.NewOption("main", "main"))
 	}
 
+	themeOptions := make([]huh.Option[string], 0)
+	for _, name := range ui.ThemeNames() {
+		themeOptions = append(themeOptions, huh.NewOption(name, name))
+	}
+	if _, err := ui.UserThemes(); err != nil {
+		logger.Warn("skipping themes that do not load", "error", err)
+	}
+	// Resolve auto before the form owns the terminal, so its preview does
+	// not query the terminal background mid-form
+	_ = ui.PaletteByName(ui.AutoTheme)
+
 	var save bool
 	changedUI := false
 	changedDefaults := false
 	changedFlags := false
 	changedAdvanced := false
 
+	defer ui.PushScreen("Settings")()
 	ui.StartScreen("SETTINGS", "Select a settings section to edit")
 
 	for {
 		choice, err := ui.RunMenuWithOptions("SETTINGS", "Select a settings section", []ui.MenuItem{
-			{ID: "ui", TitleText: "Display & Prompts", Details: "Layout density, color mode, and advanced prompts"},
+			{ID: "ui", TitleText: "Display & Prompts", Details: "Theme, layout density, color mode, and advanced prompts"},
 			{ID: "defaults", TitleText: "Build Defaults", Details: "Default variant, tag, and build number"},
 			{ID: "flags", TitleText: "Build Flags", Details: "Push/sign/SBOM defaults and cache behavior"},
 			{ID: "advanced", TitleText: "Advanced Build Options", Details: "Build args and timeouts"},
@@ -79,10 +99,20 @@ func runSettings(cmd *cobra.Command, args []string) error {
 		}
 
 		switch choice {
-		case ui.MenuActionBack, ui.MenuActionQuit:
-			return nil
+		case ui.MenuActionBack, ui.MenuActionHome, ui.MenuActionQuit:
+			return ui.NavigationError(choice)
 		case "ui":
 			form := huh.NewForm(
+				huh.NewGroup(
+					huh.NewSelect[string]().
+						Title("Theme").
+						Description("auto follows the terminal background; add themes in ~/.config/galena/themes").
+						Options(themeOptions...).
+						Value(&theme),
+					huh.NewNote().
+						Title("Preview").
+						DescriptionFunc(func() string { return ui.ThemePreview(theme) }, &theme),
+				),
 				huh.NewGroup(
 					huh.NewConfirm().
 						Title("Dense Layout").
@@ -257,7 +287,7 @@ Save:
 
 	if changedUI {
 		cfg.UI = config.UIConfig{
-			Theme:      "space",
+			Theme:      theme,
 			ShowBanner: false,
 			Dense:      dense,
 			NoColor:    noColorPref,
@@ -298,13 +328,7 @@ Save:
 		return fmt.Errorf("saving config: %w", err)
 	}
 
-	ui.ApplyPreferences(ui.Preferences{
-		Theme:      "space",
-		ShowBanner: false,
-		Dense:      cfg.UI.Dense,
-		NoColor:    cfg.UI.NoColor || noColor,
-		Advanced:   cfg.UI.Advanced,
-	})
+	applyUISettings()
 
 	fmt.Println()
 	fmt.Println(ui.SuccessBox.Render("Settings saved to " + path))
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	settingsProfileName string
+)
+
+var settingsExportCmd = &cobra.Command{
+	Use:   "export <profile.yaml>",
+	Short: "Export UI preferences and build defaults as a shareable profile",
+	Long: `Write the shareable part of galena.yaml (theme, density, build defaults,
+build args, timeout, dirty policy, and release channels) to a standalone
+profile file.
+
+Profiles can be committed to a team repository and applied on other
+machines or CI runners with 'galena-build settings import'.
+
+Examples:
+  galena-build settings export team.yaml
+  galena-build settings export ci.yaml --name ci-runners`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSettingsExport,
+}
+
+var settingsImportCmd = &cobra.Command{
+	Use:   "import <profile.yaml>",
+	Short: "Apply a settings profile to galena.yaml",
+	Long: `Apply a settings profile exported with 'galena-build settings export'.
+
+Only the settings the profile names change, so a partial profile leaves
+the rest of galena.yaml alone. Build args are merged by name, and each
+channel replaces the channel of the same name or is added. A preview of
+every setting that changes is shown before anything is written. The saved galena.yaml records which profile it came from in a
+leading comment.
+
+Examples:
+  galena-build settings import team.yaml
+  galena-build settings import ci.yaml --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSettingsImport,
+}
+
+func init() {
+	settingsCmd.AddCommand(settingsExportCmd)
+	settingsCmd.AddCommand(settingsImportCmd)
+
+	settingsExportCmd.Flags().StringVar(&settingsProfileName, "name", "", "Profile name (default: file name)")
+}
+
+func runSettingsExport(cmd *cobra.Command, args []string) error {
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+
+	path := args[0]
+	name := settingsProfileName
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	profile := cfg.ExportProfile(name)
+	if err := profile.Save(path); err != nil {
+		return err
+	}
+
+	logger.Info("exported settings profile", "name", name, "path", path)
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Settings profile %q exported to %s", name, path)))
+	return nil
+}
+
+func runSettingsImport(cmd *cobra.Command, args []string) error {
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+
+	profilePath := args[0]
+	profile, err := config.LoadProfile(profilePath)
+	if err != nil {
+		return err
+	}
+
+	changes, err := cfg.PreviewProfile(profile)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println(ui.InfoBox.Render("Settings already match " + profilePath))
+		return nil
+	}
+
+	fmt.Println(ui.InfoBox.Render(formatProfileChanges(profilePath, changes)))
+
+	if !assumeYes {
+		if !ui.IsInteractiveTerminal() {
+			return fmt.Errorf("refusing to apply profile without confirmation; pass --yes")
+		}
+		confirm := false
+		err := huh.NewForm(
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title("Apply settings profile?").
+					Description(fmt.Sprintf("%d setting(s) will change", len(changes))).
+					Value(&confirm),
+			),
+		).WithTheme(ui.HuhTheme()).Run()
+		if err != nil || !confirm {
+			logger.Info("settings import cancelled")
+			return nil
+		}
+	}
+
+	if err := cfg.ApplyProfile(profile); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("profile produces invalid config: %w", err)
+	}
+
+	path := cfgFile
+	if path == "" {
+		path, err = config.GetConfigPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.SaveWithComment(path, profileProvenance(profilePath, profile)); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+
+	logger.Info("imported settings profile", "path", profilePath, "changes", len(changes))
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Applied %d setting(s) to %s", len(changes), path)))
+	return nil
+}
+
+func formatProfileChanges(path string, changes []config.ProfileChange) string {
+	var b strings.Builder
+	b.WriteString("Changes from " + path + "\n")
+	for _, change := range changes {
+		from := change.From
+		if from == "" {
+			from = "(unset)"
+		}
+		to := change.To
+		if to == "" {
+			to = "(unset)"
+		}
+		b.WriteString(fmt.Sprintf("\n  %s: %s -> %s", change.Key, from, to))
+	}
+	return b.String()
+}
+
+func profileProvenance(path string, profile *config.SettingsProfile) string {
+	source := path
+	if abs, err := filepath.Abs(path); err == nil {
+		source = abs
+	}
+	lines := []string{
+		"Settings imported from " + source,
+	}
+	if profile.Name != "" {
+		lines = append(lines, "Profile: "+profile.Name)
+	}
+	if profile.ExportedAt != "" {
+		lines = append(lines, "Exported: "+profile.ExportedAt)
+	}
+	lines = append(lines, "Imported: "+time.Now().UTC().Format(time.RFC3339))
+	return strings.Join(lines, "\n")
+}
@@ -2,12 +2,13 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"charm.land/bubbles/v2/spinner"
 	tea "charm.land/bubbletea/v2"
@@ -16,16 +17,40 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/exec"
 	"github.com/iiroan/galena/internal/ui"
 )
 
+var (
+	setupBrew        []string
+	setupFlatpaks    []string
+	setupDevModeFlag string
+	setupKeepShowing bool
+)
+
 var setupCmd = &cobra.Command{
 	Use:   "setup",
 	Short: "High-fidelity system setup wizard",
-	RunE:  runSetup,
+	Long: `Personalize the installation: pick the Homebrew CLI tools and Flatpak
+apps to install and where development toolchains live.
+
+In a terminal, setup asks for each choice. With any of the flags below, with
+--plain, or without a terminal, it takes the choices from the flags instead
+and prints progress line by line. --brew and --flatpak take names from the
+image's catalogs or "all"; nothing is installed when they are omitted.
+
+Examples:
+  galena setup
+  galena setup --brew all --flatpak org.mozilla.firefox --dev-mode host-only
+  galena setup --plain --flatpak all --keep-showing`,
+	RunE: runSetup,
 }
 
 func init() {
+	setupCmd.Flags().StringSliceVar(&setupBrew, "brew", nil, `Homebrew packages to install, or "all"`)
+	setupCmd.Flags().StringSliceVar(&setupFlatpaks, "flatpak", nil, `Flatpak apps to install, or "all"`)
+	setupCmd.Flags().StringVar(&setupDevModeFlag, "dev-mode", string(setupDevModeDevcontainerOnly), "Where development toolchains live (devcontainer-first, host-only)")
+	setupCmd.Flags().BoolVar(&setupKeepShowing, "keep-showing", false, "Show setup again on next boot")
 }
 
 type installTask struct {
@@ -75,8 +100,7 @@ type deploymentModel struct {
 }
 
 func runSetup(cmd *cobra.Command, args []string) error {
-	stateDir := "/var/lib/galena"
-	doneFile := filepath.Join(stateDir, "setup.done")
+	doneFile := statePath("setup.done")
 
 	if _, err := os.Stat(doneFile); err == nil {
 		fmt.Println(ui.SuccessStyle.Render("Setup already completed!"))
@@ -93,7 +117,20 @@ func runSetup(cmd *cobra.Command, args []string) error {
 		flatpakApps, _ = getFlatpakApps("custom/flatpaks/default.preinstall")
 	}
 
-	selectedBrew, selectedFlatpaks, disableSetup, devMode, err := promptSetupSelections(brewPackages, flatpakApps)
+	var (
+		selectedBrew, selectedFlatpaks []string
+		disableSetup                   bool
+		devMode                        setupDevMode
+		err                            error
+	)
+	fromFlags := !ui.IsInteractiveTerminal() || cmd.Flags().Changed("brew") || cmd.Flags().Changed("flatpak") ||
+		cmd.Flags().Changed("dev-mode") || cmd.Flags().Changed("keep-showing")
+	if fromFlags {
+		selectedBrew, selectedFlatpaks, devMode, err = setupSelectionsFromFlags(brewPackages, flatpakApps)
+		disableSetup = !setupKeepShowing
+	} else {
+		selectedBrew, selectedFlatpaks, disableSetup, devMode, err = promptSetupSelections(brewPackages, flatpakApps)
+	}
 	if err != nil {
 		if errors.Is(err, huh.ErrUserAborted) {
 			return nil
@@ -113,6 +150,20 @@ func runSetup(cmd *cobra.Command, args []string) error {
 		spinner:          s,
 	}
 
+	// Ask for elevation once, before the deployment TUI takes over the terminal
+	authCommands := []string{"write " + systemStateDir}
+	if len(selectedFlatpaks) > 0 {
+		authCommands = append(authCommands, "flatpak install --system flathub "+strings.Join(selectedFlatpaks, " "))
+	}
+	if err := privilegeEscalator().Authorize(context.Background(), "install system Flatpaks and record setup state", authCommands...); err != nil {
+		logger.Warn("continuing without elevation; Flatpaks will be installed for the current user", "error", err)
+	}
+
+	if fromFlags {
+		runSetupPlain(m)
+		return nil
+	}
+
 	p := tea.NewProgram(m)
 	finalModel, err := p.Run()
 	if err != nil {
@@ -132,6 +183,45 @@ func runSetup(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// setupSelectionsFromFlags returns the packages, apps, and development mode
+// given with --brew, --flatpak, and --dev-mode
+func setupSelectionsFromFlags(brewPackages, flatpakApps []string) ([]string, []string, setupDevMode, error) {
+	brew, err := selectSetupItems("--brew", setupBrew, brewPackages)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	flatpaks, err := selectSetupItems("--flatpak", setupFlatpaks, flatpakApps)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	devMode := setupDevMode(setupDevModeFlag)
+	if devMode != setupDevModeDevcontainerOnly && devMode != setupDevModeHostOnly {
+		return nil, nil, "", fmt.Errorf("invalid --dev-mode %q: use %s or %s", setupDevModeFlag, setupDevModeDevcontainerOnly, setupDevModeHostOnly)
+	}
+	return brew, flatpaks, devMode, nil
+}
+
+// selectSetupItems resolves the names given with flag against a catalog,
+// where "all" selects the whole catalog
+func selectSetupItems(flag string, names, catalog []string) ([]string, error) {
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "all" {
+			return append([]string{}, catalog...), nil
+		}
+		if !slices.Contains(catalog, name) {
+			if len(catalog) == 0 {
+				return nil, fmt.Errorf("%s %s: the image has no catalog to install from", flag, name)
+			}
+			return nil, fmt.Errorf("%s %s: not in the catalog (available: %s)", flag, name, strings.Join(catalog, ", "))
+		}
+		if !slices.Contains(selected, name) {
+			selected = append(selected, name)
+		}
+	}
+	return selected, nil
+}
+
 func promptSetupSelections(brewPackages []string, flatpakApps []string) ([]string, []string, bool, setupDevMode, error) {
 	if err := huh.NewForm(
 		huh.NewGroup(
@@ -305,21 +395,7 @@ func (m *deploymentModel) nextTask() tea.Cmd {
 	return tea.Batch(
 		func() tea.Msg { return taskStartedMsg(task) },
 		func() tea.Msg {
-			var err error
-			skipped := false
-			if task.kind == "brew" {
-				if exec.Command("brew", "list", task.name).Run() == nil {
-					skipped = true
-				} else {
-					err = exec.Command("brew", "install", task.name).Run()
-				}
-			} else {
-				if exec.Command("flatpak", "info", task.name).Run() == nil {
-					skipped = true
-				} else {
-					err = exec.Command("flatpak", "install", "-y", "--system", "flathub", task.name).Run()
-				}
-			}
+			skipped, err := runInstallTask(context.Background(), task)
 			return taskFinishedMsg{task: task, skipped: skipped, err: err}
 		},
 	)
@@ -327,19 +403,73 @@ func (m *deploymentModel) nextTask() tea.Cmd {
 
 func (m *deploymentModel) finalize() tea.Cmd {
 	return func() tea.Msg {
-		_ = os.MkdirAll("/var/lib/galena", 0o755)
-		_ = os.WriteFile("/var/lib/galena/dev-mode", []byte(string(m.devMode)+"\n"), 0o644)
-		if m.disableSetup {
-			_ = os.WriteFile("/var/lib/galena/setup.done", []byte("done"), 0o644)
-		}
+		m.recordState(context.Background())
 		return allFinishedMsg{}
 	}
 }
 
+// recordState saves the development mode and, unless setup should show
+// again, that setup is done
+func (m *deploymentModel) recordState(ctx context.Context) {
+	_ = writeStateFile(ctx, "dev-mode", []byte(string(m.devMode)+"\n"))
+	if m.disableSetup {
+		_ = writeStateFile(ctx, "setup.done", []byte("done"))
+	}
+}
+
+// runInstallTask installs a package or app, skipping it when it is
+// already installed
+func runInstallTask(ctx context.Context, task installTask) (bool, error) {
+	if task.kind == "brew" {
+		if exec.RunSimple(ctx, "brew", "list", task.name).Err == nil {
+			return true, nil
+		}
+		return false, exec.RunSimple(ctx, "brew", "install", task.name).Err
+	}
+	if exec.RunSimple(ctx, "flatpak", "info", task.name).Err == nil {
+		return true, nil
+	}
+	return false, runSystemFlatpak(ctx, "install system Flatpaks", "install", "flathub", task.name).Err
+}
+
+// runSetupPlain runs the deployment without the TUI, one line per task
+func runSetupPlain(m *deploymentModel) {
+	ctx := context.Background()
+	m.prepareTasks()
+	for i, task := range m.pendingTasks {
+		fmt.Printf("[%d/%d] %s (%s)\n", i+1, m.totalTasks, task.name, task.kind)
+		skipped, err := runInstallTask(ctx, task)
+		m.completedTasks++
+		switch {
+		case skipped:
+			m.skippedItems = append(m.skippedItems, task.name)
+			fmt.Println("  already installed")
+		case err != nil:
+			m.failedItems = append(m.failedItems, fmt.Sprintf("%s: %v", task.name, err))
+			fmt.Printf("  failed: %v\n", err)
+		default:
+			fmt.Println("  installed")
+		}
+	}
+	m.pendingTasks = nil
+	m.recordState(ctx)
+	m.finished = true
+
+	if m.devMode == setupDevModeDevcontainerOnly {
+		if err := ui.RunWithSpinner("Bootstrapping devcontainer workspace", func() error {
+			return bootstrapSetupDevcontainer(defaultDevProfileID)
+		}); err != nil {
+			m.devBootstrapErr = err.Error()
+		}
+	}
+	printSetupSummary(m)
+}
+
 func (m *deploymentModel) View() tea.View {
 	if m.quitting {
 		return tea.View{}
 	}
+	start := time.Now()
 
 	width := m.width
 	if width <= 0 {
@@ -392,11 +522,15 @@ func (m *deploymentModel) View() tea.View {
 	header := ui.Header(" SYSTEM SETUP ")
 	main := lipgloss.JoinHorizontal(
 		lipgloss.Top,
-		sidebarStyle.Render(sb.String()),
-		contentStyle.Render(m.renderDeploymentView(contentInnerWidth)),
+		ui.DebugOutline("sidebar", sidebarStyle.Render(sb.String())),
+		ui.DebugOutline("content", contentStyle.Render(m.renderDeploymentView(contentInnerWidth))),
 	)
 
-	v := tea.NewView(lipgloss.JoinVertical(lipgloss.Left, header, main))
+	screen := lipgloss.JoinVertical(lipgloss.Left, header, main)
+	if status := ui.DebugStatus("setup", width, height, time.Since(start)); status != "" {
+		screen = lipgloss.JoinVertical(lipgloss.Left, screen, status)
+	}
+	v := tea.NewView(screen)
 	v.AltScreen = true
 	v.WindowTitle = "Galena Setup"
 	v.KeyboardEnhancements.ReportEventTypes = true
@@ -3,18 +3,27 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
 	"github.com/iiroan/galena/internal/ui"
 )
 
 var (
-	signKeyless bool
-	signKey     string
-	signVerify  bool
+	signKeyless  bool
+	signKey      string
+	signVerify   bool
+	keygenKMS    string
+	keygenPrefix string
+	keygenSave   bool
 )
 
 var signCmd = &cobra.Command{
@@ -23,7 +32,10 @@ var signCmd = &cobra.Command{
 	Long: `Sign a container image using cosign.
 
 By default, uses keyless signing with GitHub OIDC (recommended for CI/CD).
-You can also use a local key file for signing.
+A key configured as signing.key in galena.yaml, or given with --key, is used
+instead. Keys can be files, env://VAR references holding the key, or KMS
+URIs (awskms://, gcpkms://, azurekms://, hashivault://). The key password is
+read from COSIGN_PASSWORD, or from signing.password_env.
 
 Examples:
   # Keyless signing (GitHub OIDC)
@@ -32,6 +44,9 @@ Examples:
   # Sign with a key file
   galena-build sign ghcr.io/myorg/myimage:stable --key cosign.key
 
+  # Sign with a key held in AWS KMS
+  galena-build sign ghcr.io/myorg/myimage:stable --key awskms:///alias/galena
+
   # Verify a signature
   galena-build sign --verify ghcr.io/myorg/myimage:stable`,
 	Args: cobra.ExactArgs(1),
@@ -39,15 +54,43 @@ Examples:
 }
 
 func init() {
-	signCmd.Flags().BoolVar(&signKeyless, "keyless", true, "Use keyless signing with OIDC")
-	signCmd.Flags().StringVarP(&signKey, "key", "k", "", "Path to cosign private key")
+	signCmd.Flags().BoolVar(&signKeyless, "keyless", true, "Use keyless signing with OIDC when no key is configured (--keyless forces it)")
+	signCmd.Flags().StringVarP(&signKey, "key", "k", "", "cosign key: file, env://VAR, or KMS URI")
 	signCmd.Flags().BoolVar(&signVerify, "verify", false, "Verify signature instead of signing")
+
+	signCmd.AddCommand(signKeygenCmd)
+	signKeygenCmd.Flags().StringVar(&keygenKMS, "kms", "", "Create the private key in a KMS (awskms://, gcpkms://, azurekms://, hashivault://)")
+	signKeygenCmd.Flags().StringVar(&keygenPrefix, "output-key-prefix", "cosign", "File name prefix of the generated keys")
+	signKeygenCmd.Flags().BoolVar(&keygenSave, "save", false, "Set signing.key and verify.key in galena.yaml")
+}
+
+var signKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a cosign key pair for signing",
+	Long: `Generate a cosign key pair in the project root. The private key is written
+to cosign.key, or created in a KMS with --kms; the public key is written to
+cosign.pub. cosign prompts for a password unless COSIGN_PASSWORD is set.
+
+Keep cosign.key out of version control: store it as a CI secret and
+reference it with signing.key: env://COSIGN_PRIVATE_KEY.
+
+Examples:
+  # Generate a password-protected key pair
+  galena-build sign keygen
+
+  # Create the key in Google Cloud KMS and configure galena.yaml
+  galena-build sign keygen --kms gcpkms://projects/acme/locations/global/keyRings/galena/cryptoKeys/signing --save`,
+	Args: cobra.NoArgs,
+	RunE: runSignKeygen,
 }
 
 func runSign(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	imageRef := args[0]
-	if err := platform.RequireLinux("signing"); err != nil {
+	if err := platform.Require(platform.ContainerTools, "signing"); err != nil {
+		return err
+	}
+	imageRef, err := ref.Normalize(args[0])
+	if err != nil {
 		return err
 	}
 
@@ -59,26 +102,53 @@ func runSign(cmd *cobra.Command, args []string) error {
 		return verifySig(ctx, imageRef)
 	}
 
-	return signImage(ctx, imageRef)
+	if cmd.Flags().Changed("keyless") && signKeyless {
+		if signKey != "" {
+			return fmt.Errorf("--keyless and --key are mutually exclusive")
+		}
+		return signImage(ctx, imageRef, config.SigningConfig{})
+	}
+	return signImage(ctx, imageRef, signingConfig(signKey))
 }
 
-func signImage(ctx context.Context, imageRef string) error {
-	logger.Info("signing image", "image", imageRef)
+// signingConfig returns the configured signing settings, with a key given on
+// the command line taking precedence
+func signingConfig(key string) config.SigningConfig {
+	signing := cfg.Signing
+	if key != "" {
+		if !strings.Contains(key, "://") {
+			if abs, err := filepath.Abs(key); err == nil {
+				key = abs
+			}
+		}
+		signing.Key = key
+		signing.KeyFrom = ""
+	}
+	return signing
+}
 
-	var result *exec.Result
-	if signKey != "" {
-		result = exec.Cosign(ctx, "sign", "--key", signKey, "--yes", imageRef)
-	} else {
-		// Keyless signing
-		result = exec.Cosign(ctx, "sign", "--yes", imageRef)
+func signImage(ctx context.Context, imageRef string, signing config.SigningConfig) error {
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
 	}
 
-	if result.Err != nil {
-		logger.Error("signing failed", "stderr", result.Stderr)
-		return fmt.Errorf("signing failed: %w", result.Err)
+	signer := build.NewSigner(rootDir, signing)
+	logger.Info("signing image", "image", imageRef, "keyless", signer.Keyless())
+
+	if err := signer.Sign(ctx, imageRef, nil); err != nil {
+		return fmt.Errorf("signing failed: %w", err)
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("sign", map[string]string{"image": imageRef}, nil)
 	}
 
 	fmt.Println()
+	if dryRun {
+		fmt.Println(dryRunBox("nothing was signed.", imageRef))
+		return nil
+	}
 	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Image signed successfully!\n\n%s", imageRef)))
 
 	return nil
@@ -100,8 +170,65 @@ func verifySig(ctx context.Context, imageRef string) error {
 		return fmt.Errorf("verification failed: %w", result.Err)
 	}
 
+	if output.IsJSON() {
+		return output.EmitSummary("sign", map[string]any{"image": imageRef, "verified": true}, nil)
+	}
+
 	fmt.Println()
 	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Signature verified!\n\n%s", imageRef)))
 
 	return nil
 }
+
+func runSignKeygen(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+
+	privateKey, publicKey, err := build.GenerateKeyPair(ctx, rootDir, keygenPrefix, keygenKMS)
+	if err != nil {
+		return err
+	}
+
+	if keygenSave {
+		rel := func(path string) string {
+			if r, err := filepath.Rel(rootDir, path); err == nil && !strings.Contains(path, "://") {
+				return r
+			}
+			return path
+		}
+		path := cfgFile
+		if path == "" {
+			path, err = config.GetConfigPath()
+			if err != nil {
+				return err
+			}
+		}
+		// Edit only the two keys, keeping the comments of galena.yaml
+		if err := config.SetFileValue(path, "signing.key", rel(privateKey)); err != nil {
+			return fmt.Errorf("saving config: %w", err)
+		}
+		if err := config.SetFileValue(path, "verify.key", rel(publicKey)); err != nil {
+			return fmt.Errorf("saving config: %w", err)
+		}
+		cfg.Signing.Key = rel(privateKey)
+		cfg.Verify.Key = rel(publicKey)
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("sign keygen", map[string]any{"private_key": privateKey, "public_key": publicKey, "saved": keygenSave}, nil)
+	}
+
+	summary := []string{"Key pair generated!", "", "Private key: " + privateKey, "Public key:  " + publicKey}
+	if keygenSave {
+		summary = append(summary, "", "signing.key and verify.key set in galena.yaml")
+	}
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(strings.Join(summary, "\n")))
+	if keygenKMS == "" {
+		fmt.Println(ui.WarningStyle.Render("Do not commit " + filepath.Base(privateKey) + "; store it as a CI secret and use signing.key: env://COSIGN_PRIVATE_KEY"))
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/iiroan/galena/internal/build"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/ui"
 )
 
@@ -21,7 +22,8 @@ var statusCmd = &cobra.Command{
   - Tool availability
 
 Examples:
-  galena-build status`,
+  galena-build status
+  galena-build status --json`,
 	RunE: runStatus,
 }
 
@@ -36,66 +38,88 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	builder := build.NewBuilder(cfg, rootDir, logger)
 	status, err := builder.Status(ctx)
 	if err != nil {
-		return fmt.Errorf("getting status: %w", err)
+		return output.EmitSummary("status", nil, fmt.Errorf("getting status: %w", err))
+	}
+	if workspaceProject != "" {
+		status["workspace_project"] = workspaceProject
 	}
 
-	ui.StartScreen("STATUS", "Project and tool overview")
+	tools := []string{"podman", "buildah", "docker", "just", "qemu-system-x86_64", "cosign", "trivy", "bootc"}
+	available := map[string]bool{}
+	for _, tool := range tools {
+		available[tool] = exec.CheckCommand(tool)
+	}
+	status["tools"] = available
 
-	fmt.Println(ui.Title.Render("Project"))
-	printKV("Name", fmt.Sprintf("%v", status["project"]))
-	printKV("Root", fmt.Sprintf("%v", status["root_dir"]))
-	printKV("Base Image", fmt.Sprintf("%v", status["base_image"]))
-	printKV("Fedora Version", fmt.Sprintf("%v", status["fedora_version"]))
+	git := map[string]any{}
+	if result := exec.Git(ctx, rootDir, "rev-parse", "--short", "HEAD"); result.Err == nil {
+		git["commit"] = strings.TrimSpace(result.Stdout)
+	}
+	if result := exec.Git(ctx, rootDir, "rev-parse", "--abbrev-ref", "HEAD"); result.Err == nil {
+		git["branch"] = strings.TrimSpace(result.Stdout)
+	}
+	if result := exec.Git(ctx, rootDir, build.GitStatusArgs()...); result.Err == nil {
+		git["dirty"] = build.TreeDirty(result.Stdout)
+	}
+	status["git"] = git
+
+	return output.Render("status", status, nil, func() {
+		ui.StartScreen("STATUS", "Project and tool overview")
 
-	fmt.Println()
-	fmt.Println(ui.Title.Render("Variants"))
-	if variants, ok := status["variants"].([]string); ok {
-		for _, v := range variants {
-			fmt.Printf("  %s %s\n", ui.StatusPending.String(), v)
+		fmt.Println(ui.Title.Render("Project"))
+		printKV("Name", fmt.Sprintf("%v", status["project"]))
+		if workspaceProject != "" {
+			printKV("Workspace Project", workspaceProject)
 		}
-	}
+		printKV("Root", fmt.Sprintf("%v", status["root_dir"]))
+		printKV("Base Image", fmt.Sprintf("%v", status["base_image"]))
+		printKV("Fedora Version", fmt.Sprintf("%v", status["fedora_version"]))
+		printKV("Engine", fmt.Sprintf("%v", status["engine"]))
 
-	fmt.Println()
-	fmt.Println(ui.Title.Render("Local Images"))
-	if images, ok := status["local_images"].([]string); ok && len(images) > 0 {
-		for _, img := range images {
-			fmt.Printf("  %s %s\n", ui.StatusSuccess.String(), img)
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Variants"))
+		if variants, ok := status["variants"].([]string); ok {
+			for _, v := range variants {
+				fmt.Printf("  %s %s\n", ui.StatusPending.String(), v)
+			}
 		}
-	} else {
-		fmt.Println(ui.MutedStyle.Render("  No local images found"))
-	}
 
-	fmt.Println()
-	fmt.Println(ui.Title.Render("Tools"))
-	tools := []string{"podman", "just", "qemu-system-x86_64", "cosign", "trivy", "bootc"}
-	for _, tool := range tools {
-		if exec.CheckCommand(tool) {
-			fmt.Printf("  %s %s\n", ui.StatusSuccess.String(), tool)
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Local Images"))
+		if images, ok := status["local_images"].([]string); ok && len(images) > 0 {
+			for _, img := range images {
+				fmt.Printf("  %s %s\n", ui.StatusSuccess.String(), img)
+			}
 		} else {
-			fmt.Printf("  %s %s %s\n", ui.StatusError.String(), tool, ui.MutedStyle.Render("(not found)"))
+			fmt.Println(ui.MutedStyle.Render("  No local images found"))
 		}
-	}
 
-	fmt.Println()
-	fmt.Println(ui.Title.Render("Git"))
-	gitResult := exec.Git(ctx, rootDir, "rev-parse", "--short", "HEAD")
-	if gitResult.Err == nil {
-		printKV("Commit", strings.TrimSpace(gitResult.Stdout))
-	}
-	gitResult = exec.Git(ctx, rootDir, "rev-parse", "--abbrev-ref", "HEAD")
-	if gitResult.Err == nil {
-		printKV("Branch", strings.TrimSpace(gitResult.Stdout))
-	}
-	gitResult = exec.Git(ctx, rootDir, "status", "--porcelain")
-	if gitResult.Err == nil {
-		if strings.TrimSpace(gitResult.Stdout) != "" {
-			printKV("Status", ui.WarningStyle.Render("dirty"))
-		} else {
-			printKV("Status", ui.SuccessStyle.Render("clean"))
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Tools"))
+		for _, tool := range tools {
+			if available[tool] {
+				fmt.Printf("  %s %s\n", ui.StatusSuccess.String(), tool)
+			} else {
+				fmt.Printf("  %s %s %s\n", ui.StatusError.String(), tool, ui.MutedStyle.Render("(not found)"))
+			}
 		}
-	}
 
-	return nil
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Git"))
+		if commit, ok := git["commit"].(string); ok {
+			printKV("Commit", commit)
+		}
+		if branch, ok := git["branch"].(string); ok {
+			printKV("Branch", branch)
+		}
+		if dirty, ok := git["dirty"].(bool); ok {
+			if dirty {
+				printKV("Status", ui.WarningStyle.Render("dirty"))
+			} else {
+				printKV("Status", ui.SuccessStyle.Render("clean"))
+			}
+		}
+	})
 }
 
 func printKV(key, value string) {
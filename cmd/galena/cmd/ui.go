@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	uiSelftestWidth  int
+	uiSelftestHeight int
+	uiSelftestQuiet  bool
+)
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Diagnose terminal rendering",
+	Long: `Tools for diagnosing truncation and misalignment on unusual terminals.
+
+Set GALENA_UI_DEBUG=1 on any interactive command to outline layout
+boundaries, show terminal size and color capabilities, and log render
+timings to $GALENA_UI_DEBUG_LOG (default: galena-ui-debug.log in the
+temp directory).`,
+}
+
+var uiSelftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Render every UI component and report overflow",
+	Long: `Render every UI component at the current (or given) terminal size and
+report dimensions, render time, and whether it overflows the width.
+
+Examples:
+  # Render at the current terminal size
+  galena ui selftest
+
+  # Simulate a narrow terminal and only print the summary
+  galena ui selftest --width 60 --height 20 --summary`,
+	Args: cobra.NoArgs,
+	RunE: runUISelftest,
+}
+
+var uiThemesCmd = &cobra.Command{
+	Use:   "themes",
+	Short: "Preview the available themes",
+	Long: `Preview the built-in themes and the user themes in
+~/.config/galena/themes. Select one with ui.theme in galena.yaml, the
+settings menu, or GALENA_UI_THEME.
+
+auto, the default, uses space on dark terminal backgrounds and daylight on
+light ones. A user theme is a YAML file named after the theme that sets any
+of primary, secondary, accent, info, success, warning, error, muted,
+background, foreground, border, and highlight, as #RRGGBB or an ANSI number;
+the rest come from base (space or daylight, default space):
+
+  # ~/.config/galena/themes/ember.yaml
+  base: space
+  primary: "#FF7A45"
+  accent: "#FFB86B"
+  border: "#4A2A1F"`,
+	Args: cobra.NoArgs,
+	RunE: runUIThemes,
+}
+
+func init() {
+	uiCmd.AddCommand(uiSelftestCmd)
+	uiCmd.AddCommand(uiThemesCmd)
+
+	uiSelftestCmd.Flags().IntVar(&uiSelftestWidth, "width", 0, "Width to render at (default: terminal width)")
+	uiSelftestCmd.Flags().IntVar(&uiSelftestHeight, "height", 0, "Height to render at (default: terminal height)")
+	uiSelftestCmd.Flags().BoolVar(&uiSelftestQuiet, "summary", false, "Only print the summary table")
+}
+
+func runUISelftest(cmd *cobra.Command, args []string) error {
+	info := ui.DetectTerminal()
+
+	width := uiSelftestWidth
+	if width <= 0 {
+		width = info.Width
+	}
+	if width <= 0 {
+		width = 80
+	}
+	height := uiSelftestHeight
+	if height <= 0 {
+		height = info.Height
+	}
+	if height <= 0 {
+		height = 24
+	}
+
+	results := ui.SelfTest(width, height)
+
+	if !uiSelftestQuiet {
+		for _, r := range results {
+			fmt.Println(ui.MutedStyle.Render(fmt.Sprintf("── %s ──", r.Component)))
+			fmt.Println(r.Output)
+			fmt.Println()
+		}
+	}
+
+	overflow := 0
+	for _, r := range results {
+		if r.Overflow {
+			overflow++
+		}
+	}
+
+	fmt.Println(ui.InfoBox.Render(fmt.Sprintf("Terminal: %s\nRender size: %dx%d\nDebug overlay: %t\n\n%s",
+		info, width, height, ui.DebugEnabled(), ui.FormatSelfTestSummary(results, width))))
+
+	if overflow > 0 {
+		return fmt.Errorf("%d component(s) overflow a %d column terminal", overflow, width)
+	}
+	return nil
+}
+
+func runUIThemes(cmd *cobra.Command, args []string) error {
+	if _, err := ui.UserThemes(); err != nil {
+		logger.Warn("skipping themes that do not load", "error", err)
+	}
+	for i, name := range ui.ThemeNames() {
+		if i > 0 {
+			fmt.Println()
+		}
+		title := name
+		if name == ui.CurrentPreferences.Theme || (name == ui.AutoTheme && ui.CurrentPreferences.Theme == "") {
+			title += " (active)"
+		}
+		fmt.Println(ui.Title.Render(title))
+		fmt.Println(ui.ThemePreview(name))
+	}
+	return nil
+}
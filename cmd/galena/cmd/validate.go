@@ -7,7 +7,9 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/iiroan/galena/internal/build"
 	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/output"
 	"github.com/iiroan/galena/internal/platform"
 	"github.com/iiroan/galena/internal/ui"
 	"github.com/iiroan/galena/internal/validate"
@@ -66,7 +68,7 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("finding project root: %w", err)
 	}
 
-	if err := platform.RequireLinux("validation"); err != nil {
+	if err := platform.Require(platform.ImageBuilds, "validation"); err != nil {
 		return err
 	}
 
@@ -79,7 +81,9 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	var warnings []string
 	var pending []string
 
-	ui.StartScreen("VALIDATION", "Scan configuration and build scripts")
+	if !output.IsJSON() {
+		ui.StartScreen("VALIDATION", "Scan configuration and build scripts")
+	}
 
 	sections := []validationSection{
 		{
@@ -93,7 +97,14 @@ func runValidate(cmd *cobra.Command, args []string) error {
 			ID:    "containerfile",
 			Title: "Containerfile",
 			Run: func(ctx context.Context) validate.Result {
-				return validate.Containerfile(ctx, rootDir)
+				containerfile, err := build.NewBuilder(cfg, rootDir, logger).Containerfile("main", "latest")
+				if err != nil {
+					result := validate.Result{}
+					result.AddError(err.Error())
+					result.AddItem(validate.StatusError, "Containerfile.tmpl", "render failed")
+					return result
+				}
+				return validate.ContainerfileAt(ctx, rootDir, containerfile)
 			},
 		},
 		{
@@ -140,27 +151,46 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		},
 	}
 
+	reports := []validationReport{}
 	first := true
 	for _, section := range sections {
 		if !checks[section.ID] {
 			continue
 		}
 
-		if !first {
-			fmt.Println()
-		}
-		first = false
+		var result validate.Result
+		if output.IsJSON() {
+			result = section.Run(ctx)
+			reports = append(reports, validationReport{ID: section.ID, Title: section.Title, Result: result})
+		} else {
+			if !first {
+				fmt.Println()
+			}
+			first = false
 
-		ci.StartGroup(section.Title)
-		fmt.Println(ui.Title.Render(section.Title))
+			ci.StartGroup(section.Title)
+			fmt.Println(ui.Title.Render(section.Title))
 
-		result := section.Run(ctx)
-		printValidationResult(ciEnv, section.Title, result)
+			result = section.Run(ctx)
+			printValidationResult(ciEnv, section.Title, result)
+			ci.EndGroup()
+		}
 
 		errors = append(errors, result.Errors...)
 		warnings = append(warnings, result.Warnings...)
 		pending = append(pending, result.Pending...)
-		ci.EndGroup()
+	}
+
+	if output.IsJSON() {
+		var err error
+		if len(errors) > 0 {
+			err = fmt.Errorf("validation failed with %d error(s)", len(errors))
+		}
+		return output.EmitSummary("validate", map[string]any{
+			"checks":   reports,
+			"errors":   len(errors),
+			"warnings": len(warnings),
+		}, err)
 	}
 
 	fmt.Println()
@@ -186,6 +216,13 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// validationReport is the result of one check in validate --json
+type validationReport struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	validate.Result
+}
+
 type validationSection struct {
 	ID    string
 	Title string
@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/scaffold"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	variantDescription   string
+	variantFlavor        string
+	variantBase          string
+	variantScripts       []string
+	variantPackages      []string
+	variantDeleteScripts bool
+)
+
+// buildScriptPattern matches the build scripts the Containerfile runs
+var buildScriptPattern = regexp.MustCompile(`^[0-9][0-9]-[A-Za-z0-9._-]+\.sh$`)
+
+var variantCmd = &cobra.Command{
+	Use:   "variant",
+	Short: "Add, remove, and list image variants",
+	Long: `Manage the variants in galena.yaml and the files that go with them.
+
+Subcommands:
+  add     - Add a variant, its build scripts, and the Containerfile args
+  remove  - Remove a variant
+  list    - List the variants and their images
+
+Examples:
+  galena-build variant add nvidia --base ghcr.io/ublue-os/bluefin-dx-nvidia:stable --scripts 20-nvidia.sh
+  galena-build variant list
+  galena-build variant remove nvidia --delete-scripts`,
+}
+
+var variantAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a variant, its build scripts, and the Containerfile args",
+	Long: `Add a variant to galena.yaml and wire it into the build.
+
+Every variant gets build_args.VARIANT set to its name, and the final stage of
+the Containerfile declares ARG VARIANT (default main) so build scripts can
+tell variants apart. Scripts given with --scripts that do not exist yet are
+created in build/ as stubs that only run for this variant; scripts must be
+named like 20-name.sh, as the Containerfile runs build/[0-9][0-9]-*.sh in
+order.
+
+--base builds the variant from another image: the final FROM of the
+Containerfile becomes ${BASE_IMAGE}, defaulting to the image it named, and
+the variant sets build_args.BASE_IMAGE.
+
+Packages are listed under the variant's packages for Containerfile.tmpl;
+with a plain Containerfile the first new script installs them.
+
+Examples:
+  galena-build variant add nvidia --base ghcr.io/ublue-os/bluefin-dx-nvidia:stable --scripts 20-nvidia.sh
+  galena-build variant add dev --description "With developer tools" --scripts 30-dev.sh --packages gcc,make
+  galena-build variant add server --dry-run`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVariantAdd,
+}
+
+var variantRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a variant",
+	Long: `Remove a variant from galena.yaml. Its build scripts are kept unless
+--delete-scripts is given, which deletes those no other variant lists.
+
+Examples:
+  galena-build variant remove nvidia
+  galena-build variant remove nvidia --delete-scripts`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVariantRemove,
+}
+
+var variantListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the variants and their images",
+	Args:  cobra.NoArgs,
+	RunE:  runVariantList,
+}
+
+func init() {
+	variantCmd.AddCommand(variantAddCmd)
+	variantCmd.AddCommand(variantRemoveCmd)
+	variantCmd.AddCommand(variantListCmd)
+
+	variantAddCmd.Flags().StringVar(&variantDescription, "description", "", "Description of the variant")
+	variantAddCmd.Flags().StringVar(&variantFlavor, "flavor", "", "Flavor of the variant (default: its name)")
+	variantAddCmd.Flags().StringVar(&variantBase, "base", "", "Base image of the variant (default: the Containerfile's)")
+	variantAddCmd.Flags().StringSliceVar(&variantScripts, "scripts", nil, "Build scripts of the variant, created in build/ when missing")
+	variantAddCmd.Flags().StringSliceVar(&variantPackages, "packages", nil, "Packages of the variant")
+	variantRemoveCmd.Flags().BoolVar(&variantDeleteScripts, "delete-scripts", false, "Delete build scripts no other variant lists")
+}
+
+func runVariantAdd(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if !imageNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid variant name %q: use lowercase letters, digits, and . _ - separators", name)
+	}
+	if _, err := cfg.GetVariant(name); err == nil {
+		return fmt.Errorf("variant %s already exists", name)
+	}
+	for _, script := range variantScripts {
+		if !buildScriptPattern.MatchString(script) {
+			return fmt.Errorf("invalid script %q: name build scripts like 20-%s.sh so the Containerfile runs them", script, name)
+		}
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+
+	variant := config.Variant{
+		Name:        name,
+		Description: variantDescription,
+		Flavor:      cmp.Or(variantFlavor, name),
+		Scripts:     variantScripts,
+		Packages:    variantPackages,
+		BuildArgs:   map[string]string{build.VariantArg: name},
+	}
+	if variantBase != "" {
+		variant.BuildArgs[build.BaseImageArg] = variantBase
+	}
+
+	// Wire the Containerfile the variant will build from
+	source := build.ContainerfileSource(rootDir, cfg, name)
+	containerfile := filepath.Join(rootDir, source)
+	original, err := os.ReadFile(containerfile)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", source, err)
+	}
+	wired, changes, err := build.WireVariantArgs(original, variantBase != "")
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	// Stub the scripts that do not exist yet
+	var stubs []scaffold.File
+	for _, script := range variantScripts {
+		if _, err := os.Stat(filepath.Join(rootDir, "build", script)); err == nil {
+			continue
+		}
+		var packages []string
+		if len(stubs) == 0 && !strings.HasSuffix(source, ".tmpl") {
+			packages = variantPackages
+		}
+		stub, err := scaffold.VariantScript(name, script, packages)
+		if err != nil {
+			return err
+		}
+		stubs = append(stubs, stub)
+	}
+
+	if exec.DryRun() {
+		exec.PrintDryRunAction("add variant %s to %s", name, path)
+		for _, change := range changes {
+			exec.PrintDryRunAction("%s: %s", source, change)
+		}
+		for _, stub := range stubs {
+			exec.PrintDryRunAction("write %s", filepath.Join(rootDir, filepath.FromSlash(stub.Path)))
+		}
+		return nil
+	}
+
+	if err := config.AddVariant(path, variant); err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		if err := os.WriteFile(containerfile, wired, 0o644); err != nil {
+			return err
+		}
+	}
+	created, _, err := scaffold.Write(rootDir, stubs, false)
+	if err != nil {
+		return err
+	}
+	logger.Info("added variant", "variant", name, "path", path)
+
+	image := cfg.ImageRef(name, cmp.Or(cfg.Build.Defaults.Tag, "latest"))
+	summary := map[string]any{"variant": name, "image": image, "containerfile": source, "changes": changes, "scripts": created}
+	if output.IsJSON() {
+		return output.EmitSummary("variant add", summary, nil)
+	}
+	lines := []string{fmt.Sprintf("Variant %s added!", name), "", "Image: " + image}
+	for _, change := range changes {
+		lines = append(lines, source+": "+change)
+	}
+	for _, script := range created {
+		lines = append(lines, "Created "+script)
+	}
+	lines = append(lines, "", "Build it with: galena-build build --variant "+name)
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(strings.Join(lines, "\n")))
+	if _, err := os.Stat(filepath.Join(rootDir, ".github", "workflows", "galena.yml")); err == nil {
+		fmt.Println(ui.MutedStyle.Render("Update the CI matrix with: galena-build ci init --force"))
+	}
+	return nil
+}
+
+func runVariantRemove(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	variant, err := cfg.GetVariant(name)
+	if err != nil {
+		return err
+	}
+	if name == cfg.Build.Defaults.Variant {
+		return fmt.Errorf("variant %s is build.defaults.variant; change that first", name)
+	}
+
+	rootDir, err := getProjectRoot()
+	if err != nil {
+		return fmt.Errorf("finding project root: %w", err)
+	}
+	path, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+
+	var orphans []string
+	for _, script := range variant.Scripts {
+		shared := false
+		for _, other := range cfg.Variants {
+			if other.Name != name && slices.Contains(other.Scripts, script) {
+				shared = true
+			}
+		}
+		if !shared {
+			orphans = append(orphans, filepath.Join("build", script))
+		}
+	}
+
+	if exec.DryRun() {
+		exec.PrintDryRunAction("remove variant %s from %s", name, path)
+		if variantDeleteScripts {
+			for _, script := range orphans {
+				exec.PrintDryRunAction("delete %s", filepath.Join(rootDir, script))
+			}
+		}
+		return nil
+	}
+
+	if err := config.RemoveVariant(path, name); err != nil {
+		return err
+	}
+	logger.Info("removed variant", "variant", name, "path", path)
+
+	var deleted []string
+	if variantDeleteScripts {
+		for _, script := range orphans {
+			if err := os.Remove(filepath.Join(rootDir, script)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			deleted = append(deleted, script)
+		}
+	}
+
+	if output.IsJSON() {
+		return output.EmitSummary("variant remove", map[string]any{"variant": name, "deleted": deleted}, nil)
+	}
+	fmt.Println(ui.SuccessStyle.Render("✓ Removed variant " + name))
+	for _, script := range deleted {
+		fmt.Println(ui.MutedStyle.Render("  deleted " + script))
+	}
+	if !variantDeleteScripts && len(orphans) > 0 {
+		fmt.Println(ui.MutedStyle.Render("  kept " + strings.Join(orphans, ", ") + " (use --delete-scripts to delete)"))
+	}
+	return nil
+}
+
+// variantInfo is one variant in variant list
+type variantInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Flavor      string   `json:"flavor,omitempty"`
+	Image       string   `json:"image"`
+	Base        string   `json:"base"`
+	Scripts     []string `json:"scripts"`
+	Packages    []string `json:"packages"`
+	Default     bool     `json:"default"`
+}
+
+func runVariantList(cmd *cobra.Command, args []string) error {
+	variants := []variantInfo{}
+	for _, v := range cfg.Variants {
+		info := variantInfo{
+			Name:        v.Name,
+			Description: v.Description,
+			Flavor:      v.Flavor,
+			Image:       cfg.ImageRef(v.Name, cmp.Or(cfg.Build.Defaults.Tag, "latest")),
+			Base:        cmp.Or(v.BuildArgs[build.BaseImageArg], cfg.Build.BuildArgs[build.BaseImageArg], cfg.Build.BaseImage),
+			Scripts:     append([]string{}, v.Scripts...),
+			Packages:    append([]string{}, v.Packages...),
+			Default:     v.Name == cfg.Build.Defaults.Variant,
+		}
+		variants = append(variants, info)
+	}
+	if output.IsJSON() {
+		return output.EmitSummary("variant list", variants, nil)
+	}
+
+	if len(variants) == 0 {
+		fmt.Println(ui.MutedStyle.Render("No variants in galena.yaml. Add one with galena-build variant add <name>."))
+		return nil
+	}
+	for i, v := range variants {
+		if i > 0 {
+			fmt.Println()
+		}
+		title := v.Name
+		if v.Default {
+			title += " (default)"
+		}
+		fmt.Println(ui.Title.Render(title))
+		if v.Description != "" {
+			fmt.Println(ui.MutedStyle.Render("  " + v.Description))
+		}
+		printKV("Image", v.Image)
+		printKV("Base", v.Base)
+		if v.Flavor != "" {
+			printKV("Flavor", v.Flavor)
+		}
+		if len(v.Scripts) > 0 {
+			printKV("Scripts", strings.Join(v.Scripts, ", "))
+		}
+		if len(v.Packages) > 0 {
+			printKV("Packages", strings.Join(v.Packages, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ref"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	verifyKey            string
+	verifyIdentity       string
+	verifyIdentityRegexp string
+	verifyIssuer         string
+	verifyIssuerRegexp   string
+	verifyAttestations   []string
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <image>",
+	Short: "Verify the signatures and attestations of an image",
+	Long: `Verify an image with cosign before deploying it.
+
+Signatures must match the constraints under verify: in galena.yaml: a public
+key, or for keyless signatures a certificate identity and OIDC issuer. Flags
+override the configured constraints. The summary lists the certificate
+identity and Rekor entry of every signature and which attestations are
+attached; attestation types in verify.attestations are required.
+
+Examples:
+  # Verify with the constraints from galena.yaml
+  galena-build verify ghcr.io/acme/galena:stable
+
+  # Verify a keyless signature from a GitHub Actions workflow
+  galena-build verify ghcr.io/acme/galena:stable \
+    --certificate-identity-regexp '^https://github.com/acme/galena/' \
+    --certificate-oidc-issuer https://token.actions.githubusercontent.com
+
+  # Verify with a public key and require an SBOM attestation
+  galena-build verify ghcr.io/acme/galena:stable --key cosign.pub --attestation spdxjson`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().StringVarP(&verifyKey, "key", "k", "", "Public key file or KMS URI")
+	verifyCmd.Flags().StringVar(&verifyIdentity, "certificate-identity", "", "Expected certificate identity")
+	verifyCmd.Flags().StringVar(&verifyIdentityRegexp, "certificate-identity-regexp", "", "Expected certificate identity pattern")
+	verifyCmd.Flags().StringVar(&verifyIssuer, "certificate-oidc-issuer", "", "Expected OIDC issuer")
+	verifyCmd.Flags().StringVar(&verifyIssuerRegexp, "certificate-oidc-issuer-regexp", "", "Expected OIDC issuer pattern")
+	verifyCmd.Flags().StringSliceVar(&verifyAttestations, "attestation", nil, "Attestation types that must be attached (e.g. spdxjson, slsaprovenance1)")
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.ContainerTools, "verify"); err != nil {
+		return err
+	}
+	imageRef, err := ref.Normalize(args[0])
+	if err != nil {
+		return err
+	}
+
+	constraints := cfg.Verify
+	if verifyKey != "" {
+		constraints.Key = verifyKey
+	}
+	if verifyIdentity != "" || verifyIdentityRegexp != "" {
+		constraints.Identity, constraints.IdentityRegexp = verifyIdentity, verifyIdentityRegexp
+	}
+	if verifyIssuer != "" || verifyIssuerRegexp != "" {
+		constraints.Issuer, constraints.IssuerRegexp = verifyIssuer, verifyIssuerRegexp
+	}
+	if len(verifyAttestations) > 0 {
+		constraints.Attestations = verifyAttestations
+	}
+
+	logger.Info("verifying image", "image", imageRef)
+	verification, err := build.VerifyImage(ctx, imageRef, constraints)
+	if output.IsJSON() {
+		return output.EmitSummary("verify", verification, err)
+	}
+	if verification == nil {
+		return err
+	}
+
+	if len(verification.Signatures) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Signatures"))
+		for _, s := range verification.Signatures {
+			fmt.Printf("  %s %s\n", ui.SuccessStyle.Render("✓"), s.Digest)
+			if s.Identity != "" {
+				fmt.Println(ui.MutedStyle.Render("    Identity: " + s.Identity))
+				fmt.Println(ui.MutedStyle.Render("    Issuer:   " + s.Issuer))
+			} else {
+				fmt.Println(ui.MutedStyle.Render("    Signed with key"))
+			}
+			if !s.RekorTimestamp.IsZero() {
+				fmt.Println(ui.MutedStyle.Render(fmt.Sprintf("    Rekor:    entry %d at %s", s.RekorLogIndex, s.RekorTimestamp.Format("2006-01-02 15:04 MST"))))
+			}
+		}
+	}
+
+	if len(verification.Attestations) > 0 {
+		fmt.Println()
+		fmt.Println(ui.Title.Render("Attestations"))
+		for _, a := range verification.Attestations {
+			label := a.Type
+			if a.Required {
+				label += " (required)"
+			}
+			switch {
+			case a.Present:
+				fmt.Printf("  %s %s\n", ui.SuccessStyle.Render("✓"), label)
+			case a.Required:
+				fmt.Printf("  %s %s\n", ui.ErrorStyle.Render("✗"), label)
+			default:
+				fmt.Printf("  %s %s\n", ui.MutedStyle.Render("○"), ui.MutedStyle.Render(label+" not attached"))
+			}
+		}
+	}
+
+	fmt.Println()
+	if err != nil {
+		fmt.Println(ui.ErrorBox.Render(fmt.Sprintf("Verification failed\n\n%s\n%s", imageRef, err)))
+		return err
+	}
+	summary := []string{"Image verified!", "", imageRef, fmt.Sprintf("%d signature(s)", len(verification.Signatures))}
+	fmt.Println(ui.SuccessBox.Render(strings.Join(summary, "\n")))
+	return nil
+}
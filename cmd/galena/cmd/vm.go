@@ -2,11 +2,20 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 
+	"github.com/charmbracelet/huh"
 	"github.com/spf13/cobra"
 
 	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
 )
 
 var (
@@ -18,6 +27,18 @@ var (
 	vmNoKVM   bool
 	vmNoBIOS  bool
 	vmUseJust bool
+
+	vmInteractive bool
+	vmHeadless    bool
+	vmPublish     []string
+	vmVolumes     []string
+	vmTPM         bool
+	vmSecureBoot  bool
+
+	vmProvisionMethod string
+	vmUser            string
+	vmSSHKey          string
+	vmHostname        string
 )
 
 var vmCmd = &cobra.Command{
@@ -26,13 +47,22 @@ var vmCmd = &cobra.Command{
 	Long: `Run and manage virtual machines for testing disk images.
 
 Subcommands:
-  run    - Start a VM with a disk image
-  ssh    - Connect to a running VM via SSH
+  run      - Start a VM with a disk image
+  ssh      - Connect to a running VM via SSH
+  test     - Boot a disk image and run smoke tests over SSH
+  snapshot - Save and restore the disk state of a qcow2 image
+  logs     - Show the serial console log of a headless VM
+
+Both galena and galena-build expose these commands. Outside a project,
+disk images are looked up in ./output.
 
 Examples:
   # Run a VM with the most recent disk image
   galena-build vm run
 
+  # Pick the image and resources in a form
+  galena vm run -i
+
   # Run a VM with a specific image
   galena-build vm run --image ./output/disk.qcow2
 
@@ -49,13 +79,48 @@ var vmRunCmd = &cobra.Command{
 	Long: `Start a virtual machine using QEMU with the specified disk image.
 
 If no image is specified, it will look for the most recent disk image
-in the output directory.
+in the output directory. With -i a form asks for the image, memory, CPUs,
+and display.
+
+--headless runs the VM without a display: the serial console is attached
+to the terminal and also written to logs/vm-<timestamp>.log, which vm logs
+shows. On Linux it is the default when neither DISPLAY nor WAYLAND_DISPLAY
+is set.
+
+On macOS the VM runs in qemu-system-aarch64 with HVF acceleration and a
+Cocoa window; build the disk for it with --target-arch aarch64. Secure
+Boot emulation needs an x86_64 host.
+
+--publish forwards a host port to a guest port like podman, and --volume
+shares a host directory over 9p. systemd 254+ guests mount volumes at the
+guest path on boot; elsewhere mount the galena0, galena1, ... tags with
+mount -t 9p -o trans=virtio,version=9p2000.L.
+
+--tpm attaches a swtpm TPM 2.0 emulator and --secure-boot boots OVMF with
+Secure Boot enforced and the Microsoft keys enrolled, to check that the
+signed shim and kernel boot before an ISO reaches real hardware. The TPM
+state and UEFI variables are kept per image in output/.galena-vm.
+
+--provision makes the VM reachable over SSH without a console login:
+
+  cloud-init  - attach a NoCloud seed ISO that creates --user with the SSH
+                key and passwordless sudo (needs cloud-init in the image and
+                genisoimage, mkisofs, or xorriso on the host)
+  smbios      - pass the SSH key for root and the hostname as systemd
+                credentials (any systemd 254+ image)
 
 Examples:
   galena-build vm run
+  galena vm run -i
+  galena-build vm run --provision cloud-init --user tester
+  galena-build vm run --provision smbios --headless
   galena-build vm run ./output/disk.qcow2
   galena-build vm run --memory 8G --cpus 4
-  galena-build vm run --display vnc`,
+  galena-build vm run --display vnc
+  galena-build vm run --headless
+  galena-build vm run --secure-boot --tpm
+  galena-build vm run -p 8080:80 -p 127.0.0.1:5353:53/udp
+  galena-build vm run --volume .:/var/mnt/project --volume ~/data:/var/mnt/data:ro`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runVMRun,
 }
@@ -83,11 +148,21 @@ func init() {
 	vmRunCmd.Flags().StringVar(&vmImage, "image", "", "Disk image path (default: auto-detect)")
 	vmRunCmd.Flags().StringVarP(&vmMemory, "memory", "m", "4G", "VM memory (e.g., 4G, 8192M)")
 	vmRunCmd.Flags().IntVarP(&vmCPUs, "cpus", "c", 2, "Number of CPUs")
-	vmRunCmd.Flags().StringVar(&vmDisplay, "display", "gtk", "Display type (gtk, sdl, vnc, none)")
+	vmRunCmd.Flags().StringVar(&vmDisplay, "display", build.DefaultVMOptions().Display, "Display type (gtk, sdl, cocoa, vnc, none)")
 	vmRunCmd.Flags().IntVar(&vmSSHPort, "ssh-port", 2222, "SSH port forwarding")
-	vmRunCmd.Flags().BoolVar(&vmNoKVM, "no-kvm", false, "Disable KVM acceleration")
+	vmRunCmd.Flags().BoolVar(&vmNoKVM, "no-kvm", false, "Disable KVM (or HVF on macOS) acceleration")
 	vmRunCmd.Flags().BoolVar(&vmNoBIOS, "no-uefi", false, "Use legacy BIOS instead of UEFI")
 	vmRunCmd.Flags().BoolVar(&vmUseJust, "just", false, "Use existing Justfile recipes")
+	vmRunCmd.Flags().BoolVarP(&vmInteractive, "interactive", "i", false, "Interactive mode")
+	vmRunCmd.Flags().BoolVar(&vmHeadless, "headless", false, "Run without a display, logging the serial console to logs/")
+	vmRunCmd.Flags().StringArrayVarP(&vmPublish, "publish", "p", nil, "Publish a guest port on the host ([ip:]host:guest[/udp], repeatable)")
+	vmRunCmd.Flags().StringArrayVar(&vmVolumes, "volume", nil, "Share a host directory with the guest (host:guest[:ro], repeatable)")
+	vmRunCmd.Flags().BoolVar(&vmTPM, "tpm", false, "Attach a TPM 2.0 emulator (swtpm)")
+	vmRunCmd.Flags().BoolVar(&vmSecureBoot, "secure-boot", false, "Enforce UEFI Secure Boot with the Microsoft keys enrolled")
+	vmRunCmd.Flags().StringVar(&vmProvisionMethod, "provision", "", "First-boot SSH provisioning (cloud-init, smbios)")
+	vmRunCmd.Flags().StringVar(&vmUser, "user", "galena", "User created by cloud-init provisioning")
+	vmRunCmd.Flags().StringVar(&vmSSHKey, "ssh-key", "", "SSH public key or .pub file (default: first key in ~/.ssh)")
+	vmRunCmd.Flags().StringVar(&vmHostname, "hostname", "galena-vm", "Hostname of the provisioned VM")
 
 	// vm ssh flags
 	vmSSHCmd.Flags().IntVar(&vmSSHPort, "port", 2222, "SSH port")
@@ -95,14 +170,22 @@ func init() {
 
 func runVMRun(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
+	if err := platform.Require(platform.VMs, "vm run"); err != nil {
+		return err
+	}
 
-	rootDir, err := getProjectRoot()
+	rootDir, err := vmRootDir()
 	if err != nil {
-		return fmt.Errorf("finding project root: %w", err)
+		return err
 	}
 
 	vmRunner := build.NewVMRunner(cfg, rootDir, logger)
 
+	// Interactive mode
+	if vmInteractive {
+		return runVMInteractive(ctx, vmRunner)
+	}
+
 	// Use just if requested
 	if vmUseJust {
 		image := "galena"
@@ -127,25 +210,99 @@ func runVMRun(cmd *cobra.Command, args []string) error {
 	}
 
 	opts := build.VMOptions{
-		ImagePath: imagePath,
-		Memory:    vmMemory,
-		CPUs:      vmCPUs,
-		Display:   vmDisplay,
-		SSH:       true,
-		SSHPort:   vmSSHPort,
-		KVM:       !vmNoKVM,
-		UEFI:      !vmNoBIOS,
+		ImagePath:  imagePath,
+		Memory:     vmMemory,
+		CPUs:       vmCPUs,
+		Display:    vmDisplay,
+		SSH:        true,
+		SSHPort:    vmSSHPort,
+		KVM:        !vmNoKVM,
+		UEFI:       !vmNoBIOS,
+		Headless:   vmHeadless,
+		TPM:        vmTPM,
+		SecureBoot: vmSecureBoot,
+	}
+	// Without a display server the gtk and sdl displays cannot open
+	if !opts.Headless && !cmd.Flags().Changed("display") && platform.IsLinux() && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		logger.Info("no display found, running headless")
+		opts.Headless = true
+	}
+	if opts.Headless {
+		opts.SerialLog = vmRunner.SerialLogPath()
+	}
+	for _, spec := range vmPublish {
+		forward, err := build.ParsePortForward(spec)
+		if err != nil {
+			return err
+		}
+		if forward.HostPort == opts.SSHPort && forward.Protocol == "tcp" {
+			return fmt.Errorf("host port %d is used for SSH, pick another or change --ssh-port", forward.HostPort)
+		}
+		opts.Publish = append(opts.Publish, forward)
+	}
+	for _, spec := range vmVolumes {
+		volume, err := build.ParseVolume(spec)
+		if err != nil {
+			return err
+		}
+		opts.Volumes = append(opts.Volumes, volume)
+	}
+	if vmProvisionMethod != "" {
+		if opts.Provision, err = vmProvision(vmProvisionMethod); err != nil {
+			return err
+		}
+		logger.Info("connect once the VM has booted", "command", fmt.Sprintf("vm ssh %s --port %d", opts.Provision.LoginUser(), opts.SSHPort))
 	}
 
 	return vmRunner.Run(ctx, opts)
 }
 
+// vmProvision returns the first-boot provisioning of the vm run flags
+func vmProvision(method string) (*build.VMProvision, error) {
+	keyInput := vmSSHKey
+	if keyInput == "" {
+		keyInput = build.DefaultSSHKeyPath()
+	}
+	if keyInput == "" {
+		return nil, fmt.Errorf("no SSH key found in ~/.ssh, pass one with --ssh-key")
+	}
+	key, err := build.ReadSSHKey(keyInput)
+	if err != nil {
+		return nil, err
+	}
+	provision := &build.VMProvision{Method: method, User: vmUser, SSHKey: key, Hostname: vmHostname}
+	if err := provision.Validate(); err != nil {
+		return nil, err
+	}
+	return provision, nil
+}
+
+// vmIdentity returns the private key of a --ssh-key .pub file, or empty to
+// let ssh pick its own
+func vmIdentity() string {
+	key := strings.TrimSuffix(vmSSHKey, ".pub")
+	if key == vmSSHKey {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(key, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		key = filepath.Join(home, rest)
+	}
+	if _, err := os.Stat(key); err != nil {
+		return ""
+	}
+	return key
+}
+
 func runVMSSH(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	rootDir, err := getProjectRoot()
+	rootDir, err := vmRootDir()
 	if err != nil {
-		return fmt.Errorf("finding project root: %w", err)
+		return err
 	}
 
 	vmRunner := build.NewVMRunner(cfg, rootDir, logger)
@@ -157,3 +314,135 @@ func runVMSSH(cmd *cobra.Command, args []string) error {
 
 	return vmRunner.SSH(ctx, vmSSHPort, user)
 }
+
+// vmRootDir returns the project root, or the working directory when galena
+// runs outside a project, e.g. on a device testing a downloaded image
+func vmRootDir() (string, error) {
+	if rootDir, err := getProjectRoot(); err == nil {
+		return rootDir, nil
+	}
+	rootDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("finding working directory: %w", err)
+	}
+	return rootDir, nil
+}
+
+// displayOptions returns the QEMU displays the host offers, the default first
+func displayOptions() []huh.Option[string] {
+	var options []huh.Option[string]
+	if runtime.GOOS == "darwin" {
+		options = append(options, huh.NewOption("Cocoa window", "cocoa"))
+	} else {
+		options = append(options,
+			huh.NewOption("GTK window", "gtk"),
+			huh.NewOption("SDL window", "sdl"),
+		)
+	}
+	return append(options,
+		huh.NewOption("VNC", "vnc"),
+		huh.NewOption("None (serial console)", "none"),
+	)
+}
+
+// runVMInteractive asks for the disk image and VM resources and starts the VM
+func runVMInteractive(ctx context.Context, vmRunner *build.VMRunner) error {
+	if !ui.IsInteractiveTerminal() {
+		return fmt.Errorf("interactive mode requires a terminal")
+	}
+
+	opts := build.DefaultVMOptions()
+	opts.ImagePath = vmImage
+	cpus := strconv.Itoa(opts.CPUs)
+	provisionMethod := vmProvisionMethod
+
+	var imageField huh.Field
+	images, _ := vmRunner.FindDiskImages("")
+	if opts.ImagePath == "" && len(images) > 0 {
+		imageOptions := make([]huh.Option[string], 0, len(images))
+		for _, image := range images {
+			label := image
+			if wd, err := os.Getwd(); err == nil {
+				if rel, err := filepath.Rel(wd, image); err == nil {
+					label = rel
+				}
+			}
+			imageOptions = append(imageOptions, huh.NewOption(label, image))
+		}
+		imageField = huh.NewSelect[string]().
+			Title("Disk Image").
+			Description("Newest first").
+			Options(imageOptions...).
+			Value(&opts.ImagePath)
+	} else {
+		imageField = huh.NewInput().
+			Title("Disk Image").
+			Description("qcow2 or raw image to boot").
+			Placeholder("./output/qcow2/disk.qcow2").
+			Value(&opts.ImagePath).
+			Validate(func(value string) error {
+				if value == "" {
+					return fmt.Errorf("a disk image is required")
+				}
+				_, err := os.Stat(value)
+				return err
+			})
+	}
+
+	form := huh.NewForm(
+		huh.NewGroup(imageField),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Memory").
+				Description("VM memory, e.g. 4G or 8192M").
+				Value(&opts.Memory),
+			huh.NewSelect[string]().
+				Title("CPUs").
+				Options(
+					huh.NewOption("1", "1"),
+					huh.NewOption("2", "2"),
+					huh.NewOption("4", "4"),
+					huh.NewOption("8", "8"),
+				).
+				Value(&cpus),
+			huh.NewSelect[string]().
+				Title("Display").
+				Description("None attaches the serial console to this terminal and logs/").
+				Options(displayOptions()...).
+				Value(&opts.Display),
+			huh.NewSelect[string]().
+				Title("SSH Provisioning").
+				Description("Authorize your SSH key on first boot").
+				Options(
+					huh.NewOption("None", ""),
+					huh.NewOption("cloud-init seed ISO", build.ProvisionCloudInit),
+					huh.NewOption("systemd credentials (SMBIOS)", build.ProvisionSMBIOS),
+				).
+				Value(&provisionMethod),
+		),
+	)
+	if err := form.WithTheme(ui.HuhTheme()).Run(); err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return nil
+		}
+		return err
+	}
+	opts.CPUs, _ = strconv.Atoi(cpus)
+	if opts.Display == "none" {
+		opts.Headless = true
+		opts.SerialLog = vmRunner.SerialLogPath()
+	}
+	sshUser := "galena"
+	if provisionMethod != "" {
+		var err error
+		if opts.Provision, err = vmProvision(provisionMethod); err != nil {
+			return err
+		}
+		sshUser = opts.Provision.LoginUser()
+	}
+
+	fmt.Println()
+	fmt.Println(ui.InfoBox.Render(fmt.Sprintf("Starting VM\n\nImage: %s\nMemory: %s\nCPUs: %d\nDisplay: %s\nProvisioning: %s\nSSH: galena vm ssh %s --port %d",
+		opts.ImagePath, opts.Memory, opts.CPUs, opts.Display, defaultIfEmpty(provisionMethod, "none"), sshUser, opts.SSHPort)))
+	return vmRunner.Run(ctx, opts)
+}
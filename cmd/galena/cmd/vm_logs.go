@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+var (
+	vmLogsFollow bool
+	vmLogsLines  int
+)
+
+var vmLogsCmd = &cobra.Command{
+	Use:   "logs [file]",
+	Short: "Show the serial console log of a headless VM",
+	Long: `Show the end of the most recent VM serial console log in logs/, written by
+vm run --headless and vm test. With -f new output is printed as the VM
+writes it until Ctrl+C.
+
+Examples:
+  galena vm logs
+  galena vm logs -f
+  galena vm logs -n 200 logs/vm-test-20260101-120000.log`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runVMLogs,
+}
+
+func init() {
+	vmCmd.AddCommand(vmLogsCmd)
+
+	vmLogsCmd.Flags().BoolVarP(&vmLogsFollow, "follow", "f", false, "Print new output as it is written")
+	vmLogsCmd.Flags().IntVarP(&vmLogsLines, "lines", "n", 50, "Number of lines to show")
+}
+
+func runVMLogs(cmd *cobra.Command, args []string) error {
+	rootDir, err := vmRootDir()
+	if err != nil {
+		return err
+	}
+
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		if path, err = build.NewVMRunner(cfg, rootDir, logger).FindSerialLog(); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening VM log: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("reading VM log: %w", err)
+	}
+	logger.Debug("showing VM log", "path", path)
+	if tail := exec.LastNLines(string(data), vmLogsLines); tail != "" {
+		fmt.Println(strings.TrimRight(tail, "\n"))
+	}
+	if !vmLogsFollow {
+		return nil
+	}
+
+	ctx, stop := interruptibleContext()
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+		if _, err := io.Copy(os.Stdout, file); err != nil {
+			return fmt.Errorf("reading VM log: %w", err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/platform"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var (
+	vmTestProvision   string
+	vmTestBootTimeout string
+	vmTestSerialLog   string
+)
+
+var vmTestCmd = &cobra.Command{
+	Use:   "test [image]",
+	Short: "Boot a disk image and run smoke tests over SSH",
+	Long: `Boot a disk image headless, wait for SSH, and run a checklist in the VM.
+Writes to the image are discarded, so the tested artifact is unchanged.
+
+The built-in checks in vm.tests.builtin are:
+
+  bootc-status  - bootc status succeeds
+  failed-units  - no systemd unit failed once boot settled
+  flatpaks      - every flatpak preinstall in the image is installed
+
+followed by vm.tests.checks, which take the same command, script, packages,
+or units checks as build.tests and run as root. The serial console is
+written to logs/vm-test-<timestamp>.log. The command fails when the VM does
+not come up within vm.tests.boot_timeout or any check fails, so it can gate
+disk artifacts in CI.
+
+SSH access is provisioned on first boot, with systemd credentials by default
+(see vm run --provision).
+
+Examples:
+  # Test the most recent disk image
+  galena-build vm test
+
+  # Test a specific image, provisioned with cloud-init
+  galena-build vm test --image output/qcow2/disk.qcow2 --provision cloud-init
+
+  # Check that the image boots with Secure Boot enforced
+  galena-build vm test --secure-boot --tpm
+
+  # Report as JSON in CI
+  galena-build vm test --output-format json --boot-timeout 15m`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runVMTest,
+}
+
+func init() {
+	vmCmd.AddCommand(vmTestCmd)
+
+	vmTestCmd.Flags().StringVar(&vmImage, "image", "", "Disk image path (default: auto-detect)")
+	vmTestCmd.Flags().StringVarP(&vmMemory, "memory", "m", "4G", "VM memory (e.g., 4G, 8192M)")
+	vmTestCmd.Flags().IntVarP(&vmCPUs, "cpus", "c", 2, "Number of CPUs")
+	vmTestCmd.Flags().IntVar(&vmSSHPort, "ssh-port", 2222, "SSH port forwarding")
+	vmTestCmd.Flags().BoolVar(&vmNoKVM, "no-kvm", false, "Disable KVM (or HVF on macOS) acceleration")
+	vmTestCmd.Flags().BoolVar(&vmTPM, "tpm", false, "Attach a TPM 2.0 emulator (swtpm)")
+	vmTestCmd.Flags().BoolVar(&vmSecureBoot, "secure-boot", false, "Enforce UEFI Secure Boot with the Microsoft keys enrolled")
+	vmTestCmd.Flags().StringVar(&vmTestProvision, "provision", build.ProvisionSMBIOS, "SSH provisioning (cloud-init, smbios)")
+	vmTestCmd.Flags().StringVar(&vmUser, "user", "galena", "User created by cloud-init provisioning")
+	vmTestCmd.Flags().StringVar(&vmSSHKey, "ssh-key", "", "SSH public key or .pub file (default: first key in ~/.ssh)")
+	vmTestCmd.Flags().StringVar(&vmHostname, "hostname", "galena-vm", "Hostname of the test VM")
+	vmTestCmd.Flags().StringVar(&vmTestBootTimeout, "boot-timeout", "", "Time to wait for SSH (default: vm.tests.boot_timeout)")
+	vmTestCmd.Flags().StringVar(&vmTestSerialLog, "serial-log", "", "Serial console log (default: logs/vm-test-<timestamp>.log)")
+}
+
+func runVMTest(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if err := platform.Require(platform.VMs, "vm test"); err != nil {
+		return err
+	}
+
+	rootDir, err := vmRootDir()
+	if err != nil {
+		return err
+	}
+	vmRunner := build.NewVMRunner(cfg, rootDir, logger)
+
+	imagePath := vmImage
+	if imagePath == "" && len(args) > 0 {
+		imagePath = args[0]
+	}
+	if imagePath == "" {
+		imagePath, err = vmRunner.FindDiskImage("")
+		if err != nil {
+			return fmt.Errorf("no disk image found: %w\nRun 'galena-build disk qcow2' first to create one", err)
+		}
+		logger.Info("auto-detected disk image", "path", imagePath)
+	}
+
+	bootTimeout := defaultIfEmpty(vmTestBootTimeout, cfg.VM.Tests.BootTimeout)
+	opts := build.VMTestOptions{
+		VM: build.VMOptions{
+			ImagePath:  imagePath,
+			Memory:     vmMemory,
+			CPUs:       vmCPUs,
+			SSHPort:    vmSSHPort,
+			KVM:        !vmNoKVM,
+			UEFI:       true,
+			SerialLog:  vmTestSerialLog,
+			TPM:        vmTPM,
+			SecureBoot: vmSecureBoot,
+		},
+		Builtin:  cfg.VM.Tests.Builtin,
+		Checks:   cfg.VM.Tests.Checks,
+		Identity: vmIdentity(),
+	}
+	if bootTimeout != "" {
+		if opts.BootTimeout, err = time.ParseDuration(bootTimeout); err != nil {
+			return fmt.Errorf("invalid boot timeout: %w", err)
+		}
+	}
+	if opts.VM.Provision, err = vmProvision(vmTestProvision); err != nil {
+		return err
+	}
+
+	report, err := vmRunner.Test(ctx, opts)
+	if output.IsJSON() {
+		return output.EmitSummary("vm test", report, err)
+	}
+	if report == nil {
+		return err
+	}
+
+	passed := printTestResults(report.Tests)
+	summary := fmt.Sprintf("%d of %d VM checks passed\n\nImage: %s\nSerial log: %s", passed, len(report.Tests), report.Image, report.SerialLog)
+	if report.BootTime > 0 {
+		summary += "\nBoot time: " + report.BootTime.Round(time.Second).String()
+	}
+	if err != nil {
+		fmt.Println(ui.ErrorBox.Render(summary))
+		return err
+	}
+	fmt.Println(ui.SuccessBox.Render(summary))
+	return nil
+}
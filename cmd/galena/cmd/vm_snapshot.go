@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iiroan/galena/internal/build"
+	"github.com/iiroan/galena/internal/output"
+	"github.com/iiroan/galena/internal/ui"
+)
+
+var vmSnapshotImage string
+
+var vmSnapshotCmd = &cobra.Command{
+	Use:   "snapshot <command>",
+	Short: "Save and restore VM disk states",
+	Long: `Manage internal snapshots of a qcow2 disk image with qemu-img.
+
+Capture a known-good state before running destructive ujust recipes in a
+test VM and roll back in seconds instead of rebuilding the image. Shut the
+VM down before creating or reverting a snapshot.
+
+Subcommands:
+  create  - Snapshot the current disk state
+  list    - List the snapshots of an image
+  revert  - Roll the disk back to a snapshot
+
+Examples:
+  galena vm snapshot create clean-install
+  galena vm snapshot list
+  galena vm snapshot revert clean-install`,
+}
+
+var vmSnapshotCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Snapshot the current disk state",
+	Long: `Snapshot the current state of a qcow2 disk image.
+
+The name defaults to a timestamp. The image defaults to the most recent
+qcow2 image in the output directory.
+
+Examples:
+  galena vm snapshot create
+  galena vm snapshot create before-ujust --image output/qcow2/disk.qcow2`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runVMSnapshotCreate,
+}
+
+var vmSnapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots of an image",
+	Args:  cobra.NoArgs,
+	RunE:  runVMSnapshotList,
+}
+
+var vmSnapshotRevertCmd = &cobra.Command{
+	Use:   "revert [name]",
+	Short: "Roll the disk back to a snapshot",
+	Long: `Roll a qcow2 disk image back to a snapshot, discarding every change
+made since. Without a name the newest snapshot is used. The snapshot is
+kept, so the image can be reverted to it again.
+
+Examples:
+  galena vm snapshot revert
+  galena vm snapshot revert clean-install`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runVMSnapshotRevert,
+}
+
+func init() {
+	vmCmd.AddCommand(vmSnapshotCmd)
+	vmSnapshotCmd.AddCommand(vmSnapshotCreateCmd)
+	vmSnapshotCmd.AddCommand(vmSnapshotListCmd)
+	vmSnapshotCmd.AddCommand(vmSnapshotRevertCmd)
+
+	vmSnapshotCmd.PersistentFlags().StringVar(&vmSnapshotImage, "image", "", "qcow2 disk image (default: most recent in output)")
+}
+
+// snapshotImage returns the --image flag or the newest qcow2 image in the
+// output directory
+func snapshotImage(vmRunner *build.VMRunner) (string, error) {
+	if vmSnapshotImage != "" {
+		return vmSnapshotImage, nil
+	}
+	images, err := vmRunner.FindDiskImages("")
+	if err == nil {
+		for _, image := range images {
+			if filepath.Ext(image) == ".qcow2" {
+				logger.Info("auto-detected disk image", "path", image)
+				return image, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no qcow2 disk image found, pass one with --image or run 'galena-build disk qcow2'")
+}
+
+// newSnapshotRunner returns a VM runner and the image the snapshot command works on
+func newSnapshotRunner() (*build.VMRunner, string, error) {
+	rootDir, err := vmRootDir()
+	if err != nil {
+		return nil, "", err
+	}
+	vmRunner := build.NewVMRunner(cfg, rootDir, logger)
+	image, err := snapshotImage(vmRunner)
+	if err != nil {
+		return nil, "", err
+	}
+	return vmRunner, image, nil
+}
+
+func runVMSnapshotCreate(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	vmRunner, image, err := newSnapshotRunner()
+	if err != nil {
+		return err
+	}
+
+	name := "galena-" + time.Now().Format("20060102-150405")
+	if len(args) > 0 {
+		name = args[0]
+	}
+	err = vmRunner.CreateSnapshot(ctx, image, name)
+	if output.IsJSON() {
+		return output.EmitSummary("vm snapshot create", map[string]string{"image": image, "name": name}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Snapshot created!\n\nImage: %s\nName: %s\n\nRoll back with: vm snapshot revert %s", image, name, name)))
+	return nil
+}
+
+func runVMSnapshotList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	vmRunner, image, err := newSnapshotRunner()
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := vmRunner.ListSnapshots(ctx, image)
+	if output.IsJSON() {
+		return output.EmitSummary("vm snapshot list", map[string]any{"image": image, "snapshots": snapshots}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(snapshots) == 0 {
+		fmt.Println(ui.InfoBox.Render(fmt.Sprintf("No snapshots in %s\n\nCreate one with: vm snapshot create", image)))
+		return nil
+	}
+	lines := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		lines = append(lines, fmt.Sprintf("%-4s %-28s %s", s.ID, s.Name, ui.MutedStyle.Render(s.Created.Format("2006-01-02 15:04:05"))))
+	}
+	fmt.Println(ui.InfoBox.Render(fmt.Sprintf("Snapshots of %s (%d)\n\n%s", image, len(snapshots), strings.Join(lines, "\n"))))
+	return nil
+}
+
+func runVMSnapshotRevert(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	vmRunner, image, err := newSnapshotRunner()
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	snapshot, err := vmRunner.RevertSnapshot(ctx, image, name)
+	if output.IsJSON() {
+		return output.EmitSummary("vm snapshot revert", map[string]any{"image": image, "snapshot": snapshot}, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(ui.SuccessBox.Render(fmt.Sprintf("Disk reverted!\n\nImage: %s\nSnapshot: %s (%s)", image, snapshot.Name, snapshot.Created.Format("2006-01-02 15:04:05"))))
+	return nil
+}
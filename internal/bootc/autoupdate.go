@@ -0,0 +1,236 @@
+package bootc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Auto-update unit names and the directory they are installed to
+const (
+	AutoUpdateUnit    = "galena-auto-update"
+	AutoUpdateUnitDir = "/etc/systemd/system"
+
+	// StockUpdateTimer is the timer bootc ships; it is disabled while the
+	// galena timer manages updates so the two do not race
+	StockUpdateTimer = "bootc-fetch-apply-updates.timer"
+)
+
+// Auto-update modes
+const (
+	AutoUpdateCheck = "check" // bootc upgrade --check: only record an available update
+	AutoUpdateStage = "stage" // bootc upgrade: stage the update for the next boot
+	AutoUpdateApply = "apply" // bootc upgrade --apply: stage and reboot into it
+)
+
+// AutoUpdateModes lists the supported auto-update modes
+func AutoUpdateModes() []string {
+	return []string{AutoUpdateCheck, AutoUpdateStage, AutoUpdateApply}
+}
+
+// meteredCheck exits non-zero when NetworkManager reports a metered
+// connection (1 yes, 3 guess-yes), which makes systemd skip the run
+const meteredCheck = `/bin/sh -c 'm=$(busctl get-property org.freedesktop.NetworkManager /org/freedesktop/NetworkManager org.freedesktop.NetworkManager Metered 2>/dev/null | cut -d" " -f2); [ "$m" != 1 ] && [ "$m" != 3 ]'`
+
+// AutoUpdateConfig describes the generated auto-update timer and service
+type AutoUpdateConfig struct {
+	Schedule        string `json:"schedule"` // systemd OnCalendar expression
+	Mode            string `json:"mode"`
+	RandomDelay     string `json:"randomDelay,omitempty"`
+	SkipOnBattery   bool   `json:"skipOnBattery"`
+	SkipWhenMetered bool   `json:"skipWhenMetered"`
+	RequireHealthy  bool   `json:"requireHealthy"` // Skip runs while galena system health fails
+	GalenaPath      string `json:"-"`
+}
+
+// DefaultAutoUpdateConfig stages updates daily on AC power and unmetered networks
+func DefaultAutoUpdateConfig() AutoUpdateConfig {
+	return AutoUpdateConfig{
+		Schedule:        "daily",
+		Mode:            AutoUpdateStage,
+		RandomDelay:     "1h",
+		SkipOnBattery:   true,
+		SkipWhenMetered: true,
+	}
+}
+
+// Validate checks the mode and the schedule
+func (c AutoUpdateConfig) Validate(ctx context.Context) error {
+	switch c.Mode {
+	case AutoUpdateCheck, AutoUpdateStage, AutoUpdateApply:
+	default:
+		return fmt.Errorf("unknown auto-update mode %q (use %s)", c.Mode, strings.Join(AutoUpdateModes(), ", "))
+	}
+	if strings.TrimSpace(c.Schedule) == "" {
+		return fmt.Errorf("auto-update schedule is empty")
+	}
+	if exec.CheckCommand("systemd-analyze") {
+		result := exec.RunSimple(ctx, "systemd-analyze", "calendar", c.Schedule)
+		if result.Err != nil {
+			return fmt.Errorf("invalid schedule %q: %s", c.Schedule, exec.LastNLines(result.Stderr, 1))
+		}
+	}
+	return nil
+}
+
+// upgradeArgs returns the bootc upgrade arguments of the mode
+func (c AutoUpdateConfig) upgradeArgs() string {
+	switch c.Mode {
+	case AutoUpdateCheck:
+		return "upgrade --check"
+	case AutoUpdateApply:
+		return "upgrade --apply"
+	}
+	return "upgrade"
+}
+
+// galenaPath returns the galena binary the units run
+func (c AutoUpdateConfig) galenaPath() string {
+	if c.GalenaPath != "" {
+		return c.GalenaPath
+	}
+	return "/usr/bin/galena"
+}
+
+// ServiceUnit renders the oneshot service the timer starts
+func (c AutoUpdateConfig) ServiceUnit() string {
+	var b strings.Builder
+	b.WriteString("# Generated by galena system auto-update; changes are overwritten\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Galena automatic bootc update (" + c.Mode + ")\n")
+	b.WriteString("Documentation=man:bootc-upgrade(8)\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("ConditionPathExists=/run/ostree-booted\n")
+	if c.SkipOnBattery {
+		b.WriteString("ConditionACPower=true\n")
+	}
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	if c.SkipWhenMetered {
+		b.WriteString("ExecCondition=" + meteredCheck + "\n")
+	}
+	if c.RequireHealthy {
+		b.WriteString("ExecCondition=" + c.galenaPath() + " system health --quiet\n")
+	}
+	b.WriteString("ExecStart=/usr/bin/bootc " + c.upgradeArgs() + " --quiet\n")
+	return b.String()
+}
+
+// TimerUnit renders the timer that schedules the service
+func (c AutoUpdateConfig) TimerUnit() string {
+	var b strings.Builder
+	b.WriteString("# Generated by galena system auto-update; changes are overwritten\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Galena automatic bootc update timer\n")
+	b.WriteString("\n[Timer]\n")
+	b.WriteString("OnCalendar=" + c.Schedule + "\n")
+	if c.RandomDelay != "" {
+		b.WriteString("RandomizedDelaySec=" + c.RandomDelay + "\n")
+	}
+	b.WriteString("Persistent=true\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=timers.target\n")
+	return b.String()
+}
+
+// ParseAutoUpdateUnits recovers the configuration from generated units
+func ParseAutoUpdateUnits(service, timer string) AutoUpdateConfig {
+	cfg := AutoUpdateConfig{Mode: AutoUpdateStage}
+	for _, line := range strings.Split(service, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "ConditionACPower=true":
+			cfg.SkipOnBattery = true
+		case strings.HasPrefix(line, "ExecCondition=") && strings.Contains(line, "system health"):
+			cfg.RequireHealthy = true
+		case strings.HasPrefix(line, "ExecCondition="):
+			cfg.SkipWhenMetered = true
+		case strings.HasPrefix(line, "ExecStart="):
+			switch {
+			case strings.Contains(line, "--check"):
+				cfg.Mode = AutoUpdateCheck
+			case strings.Contains(line, "--apply"):
+				cfg.Mode = AutoUpdateApply
+			}
+		}
+	}
+	for _, line := range strings.Split(timer, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "OnCalendar":
+			cfg.Schedule = value
+		case "RandomizedDelaySec":
+			cfg.RandomDelay = value
+		}
+	}
+	return cfg
+}
+
+// TimerState is the runtime state of the auto-update timer and its last run
+type TimerState struct {
+	Enabled    bool       `json:"enabled"`
+	Active     bool       `json:"active"`
+	NextRun    *time.Time `json:"nextRun,omitempty"`
+	LastRun    *time.Time `json:"lastRun,omitempty"`
+	LastResult string     `json:"lastResult,omitempty"` // success, exit-code, or condition skips
+}
+
+// AutoUpdateTimerState reads the timer and service state from systemctl show
+func AutoUpdateTimerState(ctx context.Context) (TimerState, error) {
+	var state TimerState
+	if err := exec.RequireCommands("systemctl"); err != nil {
+		return state, err
+	}
+	timer := exec.RunSimple(ctx, "systemctl", "show", AutoUpdateUnit+".timer",
+		"--property=UnitFileState,ActiveState,NextElapseUSecRealtime,LastTriggerUSec", "--timestamp=unix")
+	if timer.Err != nil {
+		return state, fmt.Errorf("systemctl show: %w: %s", timer.Err, exec.LastNLines(timer.Stderr, 3))
+	}
+	props := parseProperties(timer.Stdout)
+	state.Enabled = props["UnitFileState"] == "enabled"
+	state.Active = props["ActiveState"] == "active"
+	state.NextRun = parseUnixTimestamp(props["NextElapseUSecRealtime"])
+	state.LastRun = parseUnixTimestamp(props["LastTriggerUSec"])
+
+	service := exec.RunSimple(ctx, "systemctl", "show", AutoUpdateUnit+".service", "--property=Result,ConditionResult")
+	if service.Err == nil {
+		props := parseProperties(service.Stdout)
+		state.LastResult = props["Result"]
+		if props["ConditionResult"] == "no" && state.LastRun != nil {
+			state.LastResult = "skipped by a run condition"
+		}
+	}
+	return state, nil
+}
+
+// parseProperties parses the key=value lines of systemctl show
+func parseProperties(out string) map[string]string {
+	props := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[key] = strings.TrimSpace(value)
+		}
+	}
+	return props
+}
+
+// parseUnixTimestamp parses the @seconds timestamps of systemctl show --timestamp=unix
+func parseUnixTimestamp(value string) *time.Time {
+	value = strings.TrimPrefix(value, "@")
+	if value == "" || value == "n/a" || value == "0" {
+		return nil
+	}
+	var secs int64
+	if _, err := fmt.Sscanf(value, "%d", &secs); err != nil || secs == 0 {
+		return nil
+	}
+	t := time.Unix(secs, 0)
+	return &t
+}
@@ -0,0 +1,150 @@
+// Package bootc reads the deployment state of a bootc host
+package bootc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Host is the output of bootc status --json
+type Host struct {
+	Spec   HostSpec   `json:"spec"`
+	Status HostStatus `json:"status"`
+}
+
+// HostSpec is the desired state of the host
+type HostSpec struct {
+	Image *ImageReference `json:"image"`
+}
+
+// HostStatus lists the deployments of the host
+type HostStatus struct {
+	Staged         *BootEntry `json:"staged"`
+	Booted         *BootEntry `json:"booted"`
+	Rollback       *BootEntry `json:"rollback"`
+	RollbackQueued bool       `json:"rollbackQueued"`
+	Type           string     `json:"type"`
+}
+
+// BootEntry is a deployment the host can boot
+type BootEntry struct {
+	Image        *ImageStatus  `json:"image"`
+	CachedUpdate *ImageStatus  `json:"cachedUpdate"` // Update found by bootc upgrade --check
+	Incompatible bool          `json:"incompatible"`
+	Pinned       bool          `json:"pinned"`
+	Ostree       *OstreeStatus `json:"ostree"`
+}
+
+// ImageStatus describes the image of a deployment
+type ImageStatus struct {
+	Image        ImageReference `json:"image"`
+	Version      string         `json:"version"`
+	Timestamp    *time.Time     `json:"timestamp"`
+	ImageDigest  string         `json:"imageDigest"`
+	Architecture string         `json:"architecture"`
+}
+
+// ImageReference is a container image and the transport it is pulled with
+type ImageReference struct {
+	Image     string `json:"image"`
+	Transport string `json:"transport"`
+}
+
+// OstreeStatus is the ostree commit backing a deployment
+type OstreeStatus struct {
+	Checksum     string `json:"checksum"`
+	DeploySerial int    `json:"deploySerial"`
+}
+
+// Deployment is a boot entry with its role on the host
+type Deployment struct {
+	Role  string     `json:"role"` // staged, booted, or rollback
+	Entry *BootEntry `json:"entry"`
+}
+
+// Status runs bootc status --json and parses it
+func Status(ctx context.Context) (*Host, error) {
+	if err := exec.RequireCommands("bootc"); err != nil {
+		return nil, err
+	}
+	result := exec.RunSimple(ctx, "bootc", "status", "--json")
+	if result.Err != nil {
+		return nil, fmt.Errorf("bootc status: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return ParseStatus([]byte(result.Stdout))
+}
+
+// ParseStatus parses the output of bootc status --json
+func ParseStatus(data []byte) (*Host, error) {
+	var host Host
+	if err := json.Unmarshal(data, &host); err != nil {
+		return nil, fmt.Errorf("parsing bootc status: %w", err)
+	}
+	return &host, nil
+}
+
+// Deployments returns the staged, booted, and rollback deployments that
+// exist, in boot order
+func (h *Host) Deployments() []Deployment {
+	var deployments []Deployment
+	for _, d := range []Deployment{
+		{Role: "staged", Entry: h.Status.Staged},
+		{Role: "booted", Entry: h.Status.Booted},
+		{Role: "rollback", Entry: h.Status.Rollback},
+	} {
+		if d.Entry != nil {
+			deployments = append(deployments, d)
+		}
+	}
+	return deployments
+}
+
+// PendingDigest returns the digest of the image the next boot or upgrade
+// brings: the staged deployment, else an update found by
+// bootc upgrade --check. It is empty when the host is up to date.
+func (h *Host) PendingDigest() string {
+	if s := h.Status.Staged; s != nil && s.Image != nil {
+		return s.Image.ImageDigest
+	}
+	if b := h.Status.Booted; b != nil && b.CachedUpdate != nil {
+		if b.Image == nil || b.CachedUpdate.ImageDigest != b.Image.ImageDigest {
+			return b.CachedUpdate.ImageDigest
+		}
+	}
+	return ""
+}
+
+// BootedImage returns the image reference of the booted deployment
+func (h *Host) BootedImage() string {
+	if b := h.Status.Booted; b != nil && b.Image != nil {
+		return b.Image.Image.Image
+	}
+	return ""
+}
+
+// ShortDigest abbreviates a sha256 digest for display
+func ShortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// Changelog returns the package changes between the booted and the staged
+// deployment, with the RPM changelog entries, from rpm-ostree db diff
+func Changelog(ctx context.Context) (string, error) {
+	if err := exec.RequireCommands("rpm-ostree"); err != nil {
+		return "", err
+	}
+	result := exec.RunSimple(ctx, "rpm-ostree", "db", "diff", "--changelogs")
+	if result.Err != nil {
+		return "", fmt.Errorf("rpm-ostree db diff: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
@@ -0,0 +1,166 @@
+package bootc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// HealthUnit is the boot-time health check service
+const HealthUnit = "galena-boot-health"
+
+// HealthCheck is the result of one health check
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// HealthReport is the result of all health checks of a boot
+type HealthReport struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// HealthOptions configures the health checks
+type HealthOptions struct {
+	MinFreeGB   int      // Minimum free space on each of Paths
+	Paths       []string // Filesystems to check for free space
+	IgnoreUnits []string // Failed units that do not make the system unhealthy
+}
+
+// DefaultHealthOptions checks for 2 GiB free on the ostree sysroot and /var
+func DefaultHealthOptions() HealthOptions {
+	return HealthOptions{
+		MinFreeGB: 2,
+		Paths:     []string{"/sysroot", "/var"},
+	}
+}
+
+// CheckHealth runs greenboot-style checks: failed systemd units, free disk
+// space, and whether the system finished booting
+func CheckHealth(ctx context.Context, opts HealthOptions) HealthReport {
+	checks := []HealthCheck{checkBootFinished(ctx), checkFailedUnits(ctx, opts.IgnoreUnits)}
+	for _, path := range opts.Paths {
+		checks = append(checks, checkFreeSpace(path, opts.MinFreeGB))
+	}
+
+	report := HealthReport{Healthy: true, Checks: checks}
+	for _, c := range checks {
+		if !c.OK {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+func checkBootFinished(ctx context.Context) HealthCheck {
+	check := HealthCheck{Name: "boot"}
+	if !exec.CheckCommand("systemctl") {
+		check.OK, check.Detail = true, "systemctl not available; skipped"
+		return check
+	}
+	state := strings.TrimSpace(exec.RunSimple(ctx, "systemctl", "is-system-running").Stdout)
+	switch state {
+	case "running", "starting", "initializing":
+		check.OK = true
+	}
+	check.Detail = "system is " + state
+	return check
+}
+
+func checkFailedUnits(ctx context.Context, ignore []string) HealthCheck {
+	check := HealthCheck{Name: "failed-units"}
+	if !exec.CheckCommand("systemctl") {
+		check.OK, check.Detail = true, "systemctl not available; skipped"
+		return check
+	}
+	result := exec.RunSimple(ctx, "systemctl", "list-units", "--failed", "--plain", "--no-legend")
+	if result.Err != nil {
+		check.Detail = "listing failed units: " + exec.LastNLines(result.Stderr, 1)
+		return check
+	}
+
+	var failed []string
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		unit := fields[0]
+		ignored := false
+		for _, i := range ignore {
+			if unit == i {
+				ignored = true
+			}
+		}
+		if !ignored {
+			failed = append(failed, unit)
+		}
+	}
+	check.OK = len(failed) == 0
+	check.Detail = "no failed units"
+	if !check.OK {
+		check.Detail = "failed: " + strings.Join(failed, ", ")
+	}
+	return check
+}
+
+func checkFreeSpace(path string, minFreeGB int) HealthCheck {
+	check := HealthCheck{Name: "disk " + path}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		check.OK, check.Detail = true, "not mounted; skipped"
+		return check
+	}
+	free := st.Bavail * uint64(st.Bsize)
+	freeGB := float64(free) / (1 << 30)
+	check.OK = freeGB >= float64(minFreeGB)
+	check.Detail = fmt.Sprintf("%.1f GiB free (minimum %d GiB)", freeGB, minFreeGB)
+	return check
+}
+
+// PinArgs returns the ostree admin pin arguments for a deployment role.
+// ostree numbers deployments in boot order, as Deployments returns them.
+func (h *Host) PinArgs(role string, unpin bool) ([]string, error) {
+	for i, d := range h.Deployments() {
+		if d.Role != role {
+			continue
+		}
+		if role == "staged" {
+			return nil, fmt.Errorf("a staged deployment cannot be pinned; reboot into it first")
+		}
+		args := []string{"admin", "pin"}
+		if unpin {
+			args = append(args, "--unpin")
+		}
+		return append(args, fmt.Sprint(i)), nil
+	}
+	return nil, fmt.Errorf("there is no %s deployment", role)
+}
+
+// HealthServiceUnit renders the service that checks health once per boot.
+// With rollbackAfter above zero it rolls back after that many unhealthy
+// boots of the same deployment.
+func HealthServiceUnit(galenaPath string, rollbackAfter int) string {
+	cmd := galenaPath + " system health --record-boot"
+	if rollbackAfter > 0 {
+		cmd += fmt.Sprintf(" --rollback-after %d", rollbackAfter)
+	}
+	var b strings.Builder
+	b.WriteString("# Generated by galena system health install; changes are overwritten\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Galena boot health check\n")
+	b.WriteString("After=multi-user.target\n")
+	b.WriteString("ConditionPathExists=/run/ostree-booted\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("ExecStartPre=/bin/sleep 60\n")
+	b.WriteString("ExecStart=" + cmd + "\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package bootc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// deniedKargs are kernel arguments owned by ostree, the bootloader, or the
+// initramfs. Changing them leaves the deployment unbootable.
+var deniedKargs = map[string]string{
+	"root":         "the root filesystem is set by the deployment",
+	"rootflags":    "the root mount options are set by the deployment",
+	"ostree":       "ostree selects the deployment with it",
+	"BOOT_IMAGE":   "the bootloader sets it",
+	"initrd":       "the initramfs is part of the deployment",
+	"init":         "systemd must stay PID 1",
+	"rd.luks.uuid": "removing it breaks unlocking the encrypted root",
+}
+
+// CheckKarg rejects kernel arguments on the deny-list and malformed ones
+func CheckKarg(arg string) error {
+	if arg == "" || strings.ContainsAny(arg, " \t\n") {
+		return fmt.Errorf("invalid kernel argument %q: must be a single word", arg)
+	}
+	if why, ok := deniedKargs[KargKey(arg)]; ok {
+		return fmt.Errorf("kernel argument %s cannot be changed: %s", KargKey(arg), why)
+	}
+	return nil
+}
+
+// KargKey returns the name of a key=value kernel argument
+func KargKey(arg string) string {
+	key, _, _ := strings.Cut(arg, "=")
+	return key
+}
+
+// ParseKargs splits a kernel command line into its arguments
+func ParseKargs(cmdline string) []string {
+	return strings.Fields(cmdline)
+}
+
+// Kargs returns the kernel arguments of the booted deployment from
+// rpm-ostree kargs, or /proc/cmdline when rpm-ostree is not installed
+func Kargs(ctx context.Context) ([]string, error) {
+	if exec.CheckCommand("rpm-ostree") {
+		result := exec.RunSimple(ctx, "rpm-ostree", "kargs")
+		if result.Err == nil {
+			return ParseKargs(result.Stdout), nil
+		}
+	}
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return nil, fmt.Errorf("reading kernel command line: %w", err)
+	}
+	return ParseKargs(string(data)), nil
+}
+
+// KargsArgs returns the rpm-ostree kargs arguments that append and delete
+// the given kernel arguments
+func KargsArgs(add, remove []string, reboot bool) []string {
+	args := []string{"kargs"}
+	for _, a := range add {
+		args = append(args, "--append-if-missing="+a)
+	}
+	for _, r := range remove {
+		args = append(args, "--delete-if-present="+r)
+	}
+	if reboot {
+		args = append(args, "--reboot")
+	}
+	return args
+}
+
+// KargsChange is a record of a kernel argument change
+type KargsChange struct {
+	Time    time.Time `json:"time"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	Image   string    `json:"image,omitempty"` // Booted image when the change was made
+}
@@ -3,15 +3,21 @@ package build
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/iiroan/galena/internal/config"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/ref"
 	"github.com/iiroan/galena/internal/version"
 )
 
@@ -20,6 +26,7 @@ type Builder struct {
 	cfg     *config.Config
 	rootDir string
 	logger  *log.Logger
+	engine  exec.Engine
 }
 
 // BuildOptions configures a build
@@ -31,12 +38,28 @@ type BuildOptions struct {
 	Push           bool
 	Sign           bool
 	SBOM           bool
+	SBOMTool       string
 	Rechunk        bool
 	DryRun         bool
+	Healthcheck    bool
+	Test           bool
+	DirtyPolicy    string
 	ExtraBuildArgs map[string]string
 	Timeout        time.Duration
+	Arch           []string
+	Reproducible   bool
+	CacheFrom      []string
+	CacheTo        string
+	Secrets        []string
+	Resume         bool
+	Provenance     bool
+	Progress       ProgressFunc
 }
 
+// ProgressFunc presents an image build. It calls run with the context and
+// output writer the build should use; a nil writer streams to the terminal.
+type ProgressFunc func(ctx context.Context, title string, run func(ctx context.Context, out io.Writer) error) error
+
 // DefaultBuildOptions returns default build options
 func DefaultBuildOptions() BuildOptions {
 	return BuildOptions{
@@ -49,6 +72,7 @@ func DefaultBuildOptions() BuildOptions {
 		SBOM:           false,
 		Rechunk:        false,
 		DryRun:         false,
+		DirtyPolicy:    config.DirtyPolicyWarn,
 		ExtraBuildArgs: nil,
 		Timeout:        60 * time.Minute,
 	}
@@ -56,14 +80,28 @@ func DefaultBuildOptions() BuildOptions {
 
 // NewBuilder creates a new builder
 func NewBuilder(cfg *config.Config, rootDir string, logger *log.Logger) *Builder {
+	// An unknown engine is rejected by cfg.Validate and the --engine flag
+	// check; a config that skipped both gets podman
+	engine, err := exec.NewEngine(cfg.Build.Engine)
+	if err != nil {
+		engine, _ = exec.NewEngine(exec.EnginePodman)
+	}
 	return &Builder{
 		cfg:     cfg,
 		rootDir: rootDir,
 		logger:  logger,
+		engine:  engine,
 	}
 }
 
-// Build builds an image with the given options
+// Engine returns the container engine used by the builder
+func (b *Builder) Engine() exec.Engine {
+	return b.engine
+}
+
+// Build builds an image with the given options. When the build is
+// interrupted or times out, Build removes the build containers it leaked and
+// returns a failure manifest together with the error.
 func (b *Builder) Build(ctx context.Context, opts BuildOptions) (*version.BuildManifest, error) {
 	if opts.Timeout > 0 {
 		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
@@ -79,7 +117,20 @@ func (b *Builder) Build(ctx context.Context, opts BuildOptions) (*version.BuildM
 	}
 
 	// Check required tools
-	if err := exec.RequireCommands("podman"); err != nil {
+	if err := exec.RequireCommands(b.engine.Name()); err != nil {
+		return nil, err
+	}
+
+	platforms, err := Platforms(opts.Arch)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkEngineSupport(opts, platforms); err != nil {
+		return nil, err
+	}
+
+	secretArgs, err := SecretArgs(b.rootDir, b.cfg.Build.Secrets, opts.Secrets)
+	if err != nil {
 		return nil, err
 	}
 
@@ -90,60 +141,320 @@ func (b *Builder) Build(ctx context.Context, opts BuildOptions) (*version.BuildM
 	gitCommit, gitBranch, gitDirty := b.getGitInfo(ctx)
 	versionInfo = versionInfo.WithGit(gitCommit, gitBranch, gitDirty)
 
+	if opts.Reproducible {
+		epoch, err := b.SourceDateEpoch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		versionInfo = versionInfo.WithSourceDate(epoch)
+		b.logger.Info("reproducible build", "source_date_epoch", epoch)
+	}
+
+	if gitDirty {
+		tag, err := ApplyDirtyPolicy(opts.DirtyPolicy, opts.Tag, opts.Push)
+		if err != nil {
+			return nil, err
+		}
+		b.logger.Warn("building from a dirty working tree",
+			"commit", gitCommit,
+			"policy", defaultDirtyPolicy(opts.DirtyPolicy),
+			"tag", tag,
+		)
+		opts.Tag = tag
+	}
+
 	// Compute image reference
-	imageRef := b.cfg.ImageRef(opts.Variant, opts.Tag)
+	imageRef, err := ref.Normalize(b.cfg.ImageRef(opts.Variant, opts.Tag))
+	if err != nil {
+		return nil, err
+	}
 	versionInfo = versionInfo.WithImage(imageRef, opts.Variant, opts.Tag)
 
 	b.logger.Info("starting build",
 		"image", imageRef,
 		"version", versionInfo.Version,
 		"variant", opts.Variant,
+		"platforms", strings.Join(platforms, ","),
 	)
 
 	// Create manifest
 	manifest := version.NewBuildManifest(b.cfg.Name, versionInfo)
 
-	if opts.DryRun {
-		b.logger.Info("dry run - skipping actual build")
-		return manifest, nil
+	// A dry run walks the pipeline with exec printing every command that
+	// would change state, and leaves checkpoints and history untouched.
+	// BuildMatrix switches the mode on before its variants start, so this
+	// only toggles it for a single build.
+	if opts.DryRun && !exec.DryRun() {
+		exec.SetDryRun(true)
+		defer exec.SetDryRun(false)
+	}
+	dryRun := exec.DryRun()
+	if dryRun {
+		b.logger.Info("dry run - printing commands instead of running them")
+	}
+
+	started := time.Now()
+	stages := map[string]float64{}
+
+	// Resume an earlier failed run of the same build, or start a fresh checkpoint
+	fingerprint := b.buildFingerprint(ctx, opts, imageRef, versionInfo, platforms, secretArgs)
+	checkpoint := NewCheckpoint(opts.Variant, imageRef, fingerprint, versionInfo, manifest)
+	if opts.Resume {
+		if cp := b.resumeCheckpoint(ctx, opts.Variant, fingerprint); cp != nil {
+			checkpoint = cp
+			versionInfo = cp.Version
+			manifest = cp.Manifest
+		}
 	}
+	digest := checkpoint.Digest
 
-	// Build the image
-	buildArgs := b.prepareBuildArgs(opts, versionInfo)
-	if err := b.runPodmanBuild(ctx, opts, buildArgs); err != nil {
-		return nil, fmt.Errorf("build failed: %w", err)
+	// step runs a pipeline step unless the checkpoint already records it,
+	// then records it so a later --resume can skip it
+	step := func(name string, timed bool, fn func() error) error {
+		if checkpoint.Done(name) {
+			b.logger.Info("skipping completed stage", "stage", name)
+			return nil
+		}
+		stageStart := time.Now()
+		if err := fn(); err != nil {
+			return err
+		}
+		if timed {
+			stages[name] = time.Since(stageStart).Seconds()
+		}
+		checkpoint.Complete(name, digest)
+		if dryRun {
+			return nil
+		}
+		if err := checkpoint.Save(b.rootDir); err != nil {
+			b.logger.Warn("could not save build checkpoint", "error", err)
+		}
+		return nil
+	}
+
+	// An interrupted or timed out build returns a manifest recording the
+	// failure along with the error; its leaked containers are removed once
+	// no other build in this process is running
+	interrupted := false
+	b.beginBuild(ctx)
+	defer func() { b.endBuild(ctx, interrupted) }()
+	fail := func(err error) (*version.BuildManifest, error) {
+		if ctx.Err() == nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		err = wrapInterrupted(ctx, opts.Timeout, err)
+		interrupted = true
+		manifest.AddFailedImage(b.cfg.Name, opts.Tag, opts.Variant, err)
+		return manifest, err
 	}
 
-	// Get image digest
-	digest, err := b.getImageDigest(ctx, imageRef)
+	// Build the image
+	multiArch := len(platforms) > 0
+	err = step(StageBuild, true, func() error {
+		if err := b.runHooks(ctx, HookPreBuild, b.cfg.Hooks.PreBuild, versionInfo, ""); err != nil {
+			return err
+		}
+
+		buildArgs := append(b.prepareBuildArgs(opts, versionInfo), secretArgs...)
+		if multiArch {
+			if err := b.runManifestBuild(ctx, opts, platforms, buildArgs); err != nil {
+				return fmt.Errorf("build failed: %w", err)
+			}
+		} else if err := b.runImageBuild(ctx, opts, buildArgs); err != nil {
+			return fmt.Errorf("build failed: %w", err)
+		}
+
+		// Get image digest
+		var err error
+		digest, err = b.getImageDigest(ctx, imageRef)
+		if err != nil {
+			b.logger.Warn("could not get image digest", "error", err)
+		}
+
+		if multiArch {
+			manifest.AddManifestList(b.cfg.Name, opts.Tag, digest, opts.Variant, platforms)
+		} else {
+			manifest.AddImage(b.cfg.Name, opts.Tag, digest, opts.Variant, b.getImageSize(ctx, imageRef))
+		}
+		return nil
+	})
 	if err != nil {
-		b.logger.Warn("could not get image digest", "error", err)
+		return fail(err)
+	}
+
+	// Rechunk before validation and push so both operate on the shipped layout
+	if opts.Rechunk {
+		if multiArch {
+			b.logger.Warn("skipping rechunk: not supported for multi-arch manifest lists")
+		} else if err := step(StageRechunk, true, func() error {
+			rechunked, err := b.Rechunk(ctx, imageRef, RechunkOptions{})
+			if err != nil {
+				return fmt.Errorf("rechunk failed: %w", err)
+			}
+			manifest.Images[len(manifest.Images)-1].RechunkedDigest = rechunked
+			digest = rechunked
+			return nil
+		}); err != nil {
+			return fail(err)
+		}
+	}
+
+	if opts.Healthcheck && multiArch && !containsPlatform(platforms, HostPlatform()) {
+		b.logger.Warn("skipping healthcheck: host platform not in build", "host", HostPlatform())
+		opts.Healthcheck = false
+	}
+	if opts.Test && multiArch && !containsPlatform(platforms, HostPlatform()) {
+		b.logger.Warn("skipping smoke tests: host platform not in build", "host", HostPlatform())
+		opts.Test = false
 	}
 
-	manifest.AddImage(b.cfg.Name, opts.Tag, digest, opts.Variant, 0)
+	if dryRun && (opts.Healthcheck || opts.Test) {
+		b.logger.Info("dry run - skipping healthcheck and smoke tests, which need the built image")
+		opts.Healthcheck, opts.Test = false, false
+	}
+
+	// Validate services before the image leaves this machine
+	if opts.Healthcheck {
+		hcOpts := HealthcheckOptions{Units: b.cfg.Build.Healthcheck.Units}
+		if b.cfg.Build.Healthcheck.Timeout != "" {
+			timeout, err := time.ParseDuration(b.cfg.Build.Healthcheck.Timeout)
+			if err != nil {
+				return fail(fmt.Errorf("invalid build.healthcheck.timeout: %w", err))
+			}
+			hcOpts.Timeout = timeout
+		}
+		if err := step(StageHealthcheck, true, func() error {
+			if _, err := b.Healthcheck(ctx, imageRef, hcOpts); err != nil {
+				return fmt.Errorf("healthcheck failed: %w", err)
+			}
+			return nil
+		}); err != nil {
+			return fail(err)
+		}
+	}
+
+	// Smoke test the image contents
+	if opts.Test {
+		if err := step(StageTest, true, func() error {
+			_, err := b.SmokeTest(ctx, imageRef, b.cfg.Build.Tests.Checks)
+			return err
+		}); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := step(HookPostBuild, false, func() error {
+		return b.runHooks(ctx, HookPostBuild, b.cfg.Hooks.PostBuild, versionInfo, digest)
+	}); err != nil {
+		return fail(err)
+	}
 
 	// Push if requested
 	if opts.Push {
-		if err := b.push(ctx, imageRef); err != nil {
-			return nil, fmt.Errorf("push failed: %w", err)
+		if err := step(StagePush, true, func() error {
+			pushes, err := b.PushAll(ctx, imageRef, multiArch, b.cfg.Registries)
+			for _, p := range pushes {
+				manifest.SetPush(p)
+			}
+			if err != nil {
+				return fmt.Errorf("push failed: %w", err)
+			}
+			return nil
+		}); err != nil {
+			return fail(err)
+		}
+
+		if err := step(HookPostPush, false, func() error {
+			return b.runHooks(ctx, HookPostPush, b.cfg.Hooks.PostPush, versionInfo, digest)
+		}); err != nil {
+			return fail(err)
 		}
 	}
 
 	// Sign if requested
 	if opts.Sign {
-		if err := b.sign(ctx, imageRef); err != nil {
-			return nil, fmt.Errorf("signing failed: %w", err)
+		if err := step(StageSign, true, func() error {
+			if err := b.sign(ctx, imageRef); err != nil {
+				return fmt.Errorf("signing failed: %w", err)
+			}
+			manifest.AddSignature(imageRef + ".sig")
+			return nil
+		}); err != nil {
+			return fail(err)
 		}
-		manifest.AddSignature(imageRef + ".sig")
 	}
 
 	// Generate SBOM if requested
 	if opts.SBOM {
-		sbomPath, err := b.generateSBOM(ctx, imageRef)
-		if err != nil {
-			return nil, fmt.Errorf("SBOM generation failed: %w", err)
+		if err := step(StageSBOM, true, func() error {
+			sbomPath, err := b.generateSBOM(ctx, imageRef, opts.Variant, opts.SBOMTool)
+			if err != nil {
+				return fmt.Errorf("SBOM generation failed: %w", err)
+			}
+			manifest.SetSBOM(SBOMFormatSPDX, sbomPath)
+			return nil
+		}); err != nil {
+			return fail(err)
+		}
+	}
+
+	// Record SLSA provenance, attached to the image when it was pushed
+	if opts.Provenance && dryRun {
+		b.logger.Info("dry run - skipping provenance, which records the built image")
+	} else if opts.Provenance {
+		if err := step(StageProvenance, true, func() error {
+			provenance := b.NewProvenance(ctx, ProvenanceInput{
+				Image:      imageRef,
+				Variant:    opts.Variant,
+				Tag:        opts.Tag,
+				Ref:        versionInfo.GitBranch,
+				BuildArgs:  buildArgMap(b.prepareBuildArgs(opts, versionInfo)),
+				Platforms:  platforms,
+				StartedOn:  started,
+				FinishedOn: time.Now(),
+			})
+			path := b.ProvenancePath(opts.Variant)
+			if opts.Push {
+				if err := b.AttestProvenance(ctx, imageRef, path, provenance); err != nil {
+					return fmt.Errorf("provenance attestation failed: %w", err)
+				}
+			} else {
+				b.logger.Info("image not pushed; writing provenance without attesting", "path", path)
+				if err := provenance.Save(path); err != nil {
+					return err
+				}
+			}
+			manifest.AddArtifact(path)
+			return nil
+		}); err != nil {
+			return fail(err)
 		}
-		manifest.SetSBOM("spdx-json", sbomPath)
+	}
+
+	if dryRun {
+		b.logger.Info("dry run finished", "image", imageRef)
+		return manifest, nil
+	}
+
+	if err := ClearCheckpoint(b.rootDir, opts.Variant); err != nil {
+		b.logger.Warn("could not remove build checkpoint", "error", err)
+	}
+
+	var imageSize int64
+	if len(manifest.Images) > 0 {
+		imageSize = manifest.Images[len(manifest.Images)-1].Size
+	}
+	if err := AppendHistory(b.rootDir, HistoryEntry{
+		FinishedAt: time.Now().UTC(),
+		Variant:    opts.Variant,
+		Tag:        opts.Tag,
+		NoCache:    opts.NoCache,
+		Platforms:  platforms,
+		Duration:   time.Since(started).Seconds(),
+		Stages:     stages,
+		ImageSize:  imageSize,
+	}); err != nil {
+		b.logger.Warn("could not record build history", "error", err)
 	}
 
 	b.logger.Info("build completed successfully",
@@ -154,26 +465,85 @@ func (b *Builder) Build(ctx context.Context, opts BuildOptions) (*version.BuildM
 	return manifest, nil
 }
 
+// ApplyDirtyPolicy applies the dirty working tree policy to a build and returns
+// the tag to use. It fails when the policy forbids the requested push.
+func ApplyDirtyPolicy(policy, tag string, push bool) (string, error) {
+	switch defaultDirtyPolicy(policy) {
+	case config.DirtyPolicyBlockPush:
+		if push {
+			return "", fmt.Errorf("refusing to push a build from a dirty working tree (dirty_policy: %s)", config.DirtyPolicyBlockPush)
+		}
+	case config.DirtyPolicySuffix:
+		if !IsDirtyTag(tag) {
+			tag += dirtyTagSuffix
+		}
+	}
+	return tag, nil
+}
+
+const dirtyTagSuffix = "-dirty"
+
+// IsDirtyTag reports whether a tag was produced from a dirty working tree
+func IsDirtyTag(tag string) bool {
+	return strings.HasSuffix(tag, dirtyTagSuffix)
+}
+
+func defaultDirtyPolicy(policy string) string {
+	if policy == "" {
+		return config.DirtyPolicyWarn
+	}
+	return policy
+}
+
+// WorkingTreeDirty reports whether the project has uncommitted changes
+func (b *Builder) WorkingTreeDirty(ctx context.Context) bool {
+	_, _, dirty := b.getGitInfo(ctx)
+	return dirty
+}
+
+// BuildArgs returns the labels, build args, and cache flags a build of
+// opts.Variant passes to the engine, for callers that run the engine
+// themselves such as ci build
+func (b *Builder) BuildArgs(opts BuildOptions, ver version.Info) []string {
+	return b.prepareBuildArgs(opts, ver)
+}
+
 // prepareBuildArgs prepares build arguments for podman build
 func (b *Builder) prepareBuildArgs(opts BuildOptions, ver version.Info) []string {
 	args := []string{}
 
-	// Add labels
+	variant, _ := b.cfg.GetVariant(opts.Variant)
+	if variant == nil {
+		variant = &config.Variant{}
+	}
+
+	// Add labels, sorted so identical inputs produce identical commands.
+	// Version labels win over variant labels so provenance stays accurate.
+	labels := map[string]string{}
+	for k, v := range variant.Labels {
+		labels[k] = v
+	}
 	for k, v := range ver.Labels() {
-		args = append(args, "--label", fmt.Sprintf("%s=%s", k, v))
+		labels[k] = v
+	}
+	for _, k := range sortedKeys(labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, labels[k]))
 	}
 
 	mergedArgs := map[string]string{}
 	for k, v := range b.cfg.Build.BuildArgs {
 		mergedArgs[k] = v
 	}
+	for k, v := range variant.BuildArgs {
+		mergedArgs[k] = v
+	}
 	for k, v := range opts.ExtraBuildArgs {
 		mergedArgs[k] = v
 	}
 
 	// Add build args from config and overrides
-	for k, v := range mergedArgs {
-		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", k, v))
+	for _, k := range sortedKeys(mergedArgs) {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", k, mergedArgs[k]))
 	}
 
 	// Standard build args
@@ -182,24 +552,113 @@ func (b *Builder) prepareBuildArgs(opts BuildOptions, ver version.Info) []string
 		"--build-arg", fmt.Sprintf("IMAGE_VERSION=%s", ver.Version),
 	)
 
+	// Pin layer and config timestamps to the source date
+	if ver.Reproducible {
+		epoch := strconv.FormatInt(ver.BuildDate.Unix(), 10)
+		args = append(args,
+			"--build-arg", "SOURCE_DATE_EPOCH="+epoch,
+			"--timestamp", epoch,
+		)
+	}
+
 	if opts.NoCache {
 		args = append(args, "--no-cache")
+	} else {
+		args = append(args, CacheArgs(b.engine.Name(), opts.CacheFrom, opts.CacheTo)...)
 	}
 
 	return args
 }
 
-// runPodmanBuild executes the podman build command
-func (b *Builder) runPodmanBuild(ctx context.Context, opts BuildOptions, buildArgs []string) error {
+// checkEngineSupport rejects options the selected container engine cannot honor
+func (b *Builder) checkEngineSupport(opts BuildOptions, platforms []string) error {
+	name := b.engine.Name()
+	if len(platforms) > 0 && !b.engine.SupportsManifestLists() {
+		return fmt.Errorf("multi-arch builds require podman (engine: %s)", name)
+	}
+	if name == exec.EnginePodman {
+		return nil
+	}
+	if opts.Rechunk {
+		return fmt.Errorf("rechunk requires podman (engine: %s)", name)
+	}
+	if opts.Healthcheck {
+		return fmt.Errorf("healthcheck requires podman (engine: %s)", name)
+	}
+	if opts.Reproducible && name == exec.EngineDocker {
+		return fmt.Errorf("reproducible builds require podman or buildah (engine: %s)", name)
+	}
+	return nil
+}
+
+// runImageBuild executes the build command of the selected engine
+func (b *Builder) runImageBuild(ctx context.Context, opts BuildOptions, buildArgs []string) error {
 	imageRef := b.cfg.ImageRef(opts.Variant, opts.Tag)
+	containerfile, err := b.Containerfile(opts.Variant, opts.Tag)
+	if err != nil {
+		return err
+	}
 
 	args := append([]string{}, buildArgs...)
 	args = append(args,
 		"-t", imageRef,
-		"-f", filepath.Join(b.rootDir, "Containerfile"),
+		"-f", containerfile,
 		b.rootDir,
 	)
 
+	b.logger.Debug("running image build", "engine", b.engine.Name(), "args", args)
+
+	var result *exec.Result
+	if opts.Progress == nil {
+		result = b.engine.Build(ctx, b.rootDir, args)
+		err = result.Err
+	} else {
+		err = opts.Progress(ctx, imageRef, func(ctx context.Context, out io.Writer) error {
+			result = b.engine.Build(exec.WithBuildOutput(ctx, out), b.rootDir, args)
+			return result.Err
+		})
+	}
+	if err != nil {
+		if result != nil {
+			b.logger.Error("image build failed",
+				"engine", b.engine.Name(),
+				"exit_code", result.ExitCode,
+				"stderr", exec.LastNLines(result.Stderr, 20),
+			)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// runManifestBuild builds every platform into a fresh manifest list
+func (b *Builder) runManifestBuild(ctx context.Context, opts BuildOptions, platforms []string, buildArgs []string) error {
+	imageRef := b.cfg.ImageRef(opts.Variant, opts.Tag)
+	containerfile, err := b.Containerfile(opts.Variant, opts.Tag)
+	if err != nil {
+		return err
+	}
+
+	// A stale list with the same name would accumulate images from earlier builds
+	if exists := exec.Podman(ctx, "manifest", "exists", imageRef); exists.Err == nil {
+		if rm := exec.Podman(ctx, "manifest", "rm", imageRef); rm.Err != nil {
+			return fmt.Errorf("removing existing manifest list: %w: %s", rm.Err, exec.LastNLines(rm.Stderr, 5))
+		}
+	}
+	if create := exec.Podman(ctx, "manifest", "create", imageRef); create.Err != nil {
+		return fmt.Errorf("creating manifest list: %w: %s", create.Err, exec.LastNLines(create.Stderr, 5))
+	}
+
+	args := append([]string{}, buildArgs...)
+	args = append(args,
+		"--platform", strings.Join(platforms, ","),
+		"--manifest", imageRef,
+		"-f", containerfile,
+		b.rootDir,
+	)
+
+	b.logger.Info("building manifest list", "image", imageRef, "platforms", strings.Join(platforms, ","))
 	b.logger.Debug("running podman build", "args", args)
 
 	result := exec.PodmanBuild(ctx, b.rootDir, args)
@@ -214,20 +673,84 @@ func (b *Builder) runPodmanBuild(ctx context.Context, opts BuildOptions, buildAr
 	return nil
 }
 
+// Platforms converts architecture names into podman platform strings.
+// It accepts short names (amd64, arm64), uname names (x86_64, aarch64),
+// and full os/arch[/variant] platforms.
+func Platforms(arches []string) ([]string, error) {
+	platforms := []string{}
+	seen := map[string]bool{}
+	for _, raw := range arches {
+		for _, arch := range strings.Split(raw, ",") {
+			arch = strings.TrimSpace(strings.ToLower(arch))
+			if arch == "" {
+				continue
+			}
+			platform, err := normalizePlatform(arch)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[platform] {
+				seen[platform] = true
+				platforms = append(platforms, platform)
+			}
+		}
+	}
+	return platforms, nil
+}
+
+func normalizePlatform(arch string) (string, error) {
+	if strings.Contains(arch, "/") {
+		return arch, nil
+	}
+	switch arch {
+	case "amd64", "x86_64":
+		return "linux/amd64", nil
+	case "arm64", "aarch64":
+		return "linux/arm64", nil
+	case "ppc64le", "s390x":
+		return "linux/" + arch, nil
+	default:
+		return "", fmt.Errorf("unsupported architecture %q (expected amd64, arm64, ppc64le, or s390x)", arch)
+	}
+}
+
+// HostPlatform returns the podman platform string of the build host
+func HostPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+func containsPlatform(platforms []string, platform string) bool {
+	for _, p := range platforms {
+		if p == platform || strings.HasPrefix(p, platform+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // getImageDigest gets the digest of a local image
 func (b *Builder) getImageDigest(ctx context.Context, imageRef string) (string, error) {
-	result := exec.Podman(ctx, "inspect", "--format", "{{.Digest}}", imageRef)
-	if result.Err != nil {
-		return "", result.Err
+	return b.engine.ImageDigest(ctx, imageRef)
+}
+
+// getImageSize returns the size of a local image in bytes, or 0 if unknown
+func (b *Builder) getImageSize(ctx context.Context, imageRef string) int64 {
+	size, err := b.engine.ImageSize(ctx, imageRef)
+	if err != nil {
+		return 0
 	}
-	return strings.TrimSpace(result.Stdout), nil
+	return size
 }
 
 // push pushes an image to the registry
 func (b *Builder) push(ctx context.Context, imageRef string) error {
 	b.logger.Info("pushing image", "image", imageRef)
 
-	result := exec.PodmanPush(ctx, imageRef)
+	creds, err := b.engineCreds(ctx, imageRef)
+	if err != nil {
+		return err
+	}
+	result := b.engine.Push(ctx, imageRef, creds)
 	if result.Err != nil {
 		return result.Err
 	}
@@ -235,44 +758,56 @@ func (b *Builder) push(ctx context.Context, imageRef string) error {
 	return nil
 }
 
-// sign signs an image with cosign
-func (b *Builder) sign(ctx context.Context, imageRef string) error {
-	if err := exec.RequireCommands("cosign"); err != nil {
+// pushManifestList pushes a manifest list together with its per-platform images
+func (b *Builder) pushManifestList(ctx context.Context, imageRef string) error {
+	b.logger.Info("pushing manifest list", "image", imageRef)
+
+	creds, err := b.engineCreds(ctx, imageRef)
+	if err != nil {
 		return err
 	}
-
-	b.logger.Info("signing image", "image", imageRef)
-
-	// Use keyless signing with GitHub OIDC
-	result := exec.Cosign(ctx, "sign", "--yes", imageRef)
+	result := exec.PodmanManifestPush(ctx, imageRef, imageRef, creds)
 	if result.Err != nil {
-		b.logger.Error("cosign sign failed", "stderr", result.Stderr)
 		return result.Err
 	}
 
 	return nil
 }
 
-// generateSBOM generates an SBOM for the image
-func (b *Builder) generateSBOM(ctx context.Context, imageRef string) (string, error) {
-	if err := exec.RequireCommands("trivy"); err != nil {
+// sign signs an image with cosign
+func (b *Builder) sign(ctx context.Context, imageRef string) error {
+	signer := NewSigner(b.rootDir, b.cfg.Signing)
+	b.logger.Info("signing image", "image", imageRef, "keyless", signer.Keyless())
+
+	// Without a key, cosign signs keyless with the OIDC identity (e.g. GitHub Actions)
+	return signer.Sign(ctx, imageRef, nil)
+}
+
+// generateSBOM generates an SBOM for the image, scanning an archive of the
+// local image so every tool sees the image just built
+func (b *Builder) generateSBOM(ctx context.Context, imageRef string, variant, tool string) (string, error) {
+	provider, err := NewSBOMProvider(tool, b.rootDir)
+	if err != nil {
 		return "", err
 	}
 
-	b.logger.Info("generating SBOM", "image", imageRef)
+	outputPath := filepath.Join(b.rootDir, SBOMFileName(SBOMFormatSPDX, variant))
+	b.logger.Info("generating SBOM", "image", imageRef, "tool", provider.Name())
 
-	outputPath := filepath.Join(b.rootDir, "sbom.spdx.json")
-
-	result := exec.Trivy(ctx,
-		"image", imageRef,
-		"--format", "spdx-json",
-		"--output", outputPath,
-	)
-	if result.Err != nil {
-		b.logger.Error("trivy scan failed", "stderr", result.Stderr)
-		return "", result.Err
+	archive, cleanup, err := ImageArchivePath(b.rootDir)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	if result := b.engine.SaveImage(ctx, imageRef, archive, exec.ArchiveDocker); result.Err != nil {
+		return "", fmt.Errorf("saving image: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
 	}
 
+	req := SBOMRequest{Image: imageRef, Archive: archive, Format: SBOMFormatSPDX, Output: outputPath}
+	if err := provider.Generate(ctx, req); err != nil {
+		b.logger.Error("SBOM generation failed", "error", err)
+		return "", err
+	}
 	return outputPath, nil
 }
 
@@ -294,14 +829,65 @@ func (b *Builder) getGitInfo(ctx context.Context) (commit, branch string, dirty
 	}
 
 	// Check if dirty
-	result = exec.Git(ctx, b.rootDir, "status", "--porcelain")
+	result = exec.Git(ctx, b.rootDir, GitStatusArgs()...)
 	if result.Err == nil {
-		dirty = len(strings.TrimSpace(result.Stdout)) > 0
+		dirty = TreeDirty(result.Stdout)
 	}
 
 	return
 }
 
+// generatedPaths are the project paths galena itself writes: session and
+// audit logs, state, tool caches, disk images, and build reports
+var generatedPaths = []string{
+	"logs",
+	".galena",
+	".cache",
+	"output",
+	"build-manifest.json",
+	"sbom*.json",
+	"provenance*.json",
+	"vulnerabilities.json",
+	"galena-summary.md",
+}
+
+// GitStatusArgs returns the git status arguments of the dirty working tree
+// check, whose output TreeDirty reads
+func GitStatusArgs() []string {
+	return []string{"status", "--porcelain"}
+}
+
+// TreeDirty reports whether git status --porcelain output lists changes.
+// Untracked files galena writes while it runs do not count; changes to
+// tracked files always do, even under generatedPaths.
+func TreeDirty(porcelain string) bool {
+	for _, line := range strings.Split(porcelain, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if rel, untracked := strings.CutPrefix(line, "?? "); untracked && generatedPath(strings.TrimSuffix(rel, "/")) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// generatedPath reports whether a path relative to the project root is one
+// galena writes, or lies inside one
+func generatedPath(rel string) bool {
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range segments {
+		prefix := strings.Join(segments[:i+1], "/")
+		for _, pattern := range generatedPaths {
+			if ok, _ := path.Match(pattern, prefix); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // BuildViaJust builds using the existing Justfile (Phase 1 approach)
 func (b *Builder) BuildViaJust(ctx context.Context, opts BuildOptions) error {
 	if err := exec.RequireCommands("just"); err != nil {
@@ -314,10 +900,7 @@ func (b *Builder) BuildViaJust(ctx context.Context, opts BuildOptions) error {
 	)
 
 	// Determine image name (match Justfile expectations)
-	image := b.cfg.Name
-	if opts.Variant != "" && opts.Variant != "main" {
-		image = image + "-" + opts.Variant
-	}
+	_, _, image := b.cfg.ImageLocation(opts.Variant)
 
 	result := exec.Just(ctx, b.rootDir, "build", image, opts.Tag)
 	if result.Err != nil {
@@ -335,7 +918,7 @@ func (b *Builder) BuildViaJust(ctx context.Context, opts BuildOptions) error {
 func (b *Builder) Lint(ctx context.Context, imageRef string) error {
 	b.logger.Info("linting image", "image", imageRef)
 
-	result := exec.Podman(ctx, "run", "--rm", imageRef, "bootc", "container", "lint")
+	result := b.engine.RunImage(ctx, imageRef, "bootc", "container", "lint")
 	if result.Err != nil {
 		b.logger.Error("bootc lint failed", "stderr", result.Stderr)
 		return result.Err
@@ -348,7 +931,7 @@ func (b *Builder) Lint(ctx context.Context, imageRef string) error {
 func (b *Builder) Clean(ctx context.Context, imageRef string) error {
 	b.logger.Info("removing image", "image", imageRef)
 
-	result := exec.Podman(ctx, "rmi", "-f", imageRef)
+	result := b.engine.RemoveImage(ctx, imageRef)
 	if result.Err != nil {
 		b.logger.Warn("could not remove image", "error", result.Err)
 	}
@@ -358,21 +941,7 @@ func (b *Builder) Clean(ctx context.Context, imageRef string) error {
 
 // ListLocalImages lists locally built images
 func (b *Builder) ListLocalImages(ctx context.Context) ([]string, error) {
-	filter := fmt.Sprintf("reference=*%s*", b.cfg.Name)
-	result := exec.Podman(ctx, "images", "--filter", filter, "--format", "{{.Repository}}:{{.Tag}}")
-	if result.Err != nil {
-		return nil, result.Err
-	}
-
-	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
-	images := []string{}
-	for _, line := range lines {
-		if line != "" {
-			images = append(images, line)
-		}
-	}
-
-	return images, nil
+	return b.engine.ListImages(ctx, fmt.Sprintf("*%s*", b.cfg.Name))
 }
 
 // Status returns the current build status
@@ -383,6 +952,7 @@ func (b *Builder) Status(ctx context.Context) (map[string]interface{}, error) {
 		"base_image":     b.cfg.Build.BaseImage,
 		"fedora_version": b.cfg.Build.FedoraVersion,
 		"variants":       b.cfg.ListVariantNames(),
+		"engine":         b.engine.Name(),
 	}
 
 	// Check for Containerfile
@@ -390,6 +960,10 @@ func (b *Builder) Status(ctx context.Context) (map[string]interface{}, error) {
 	if _, err := os.Stat(containerfile); err == nil {
 		status["containerfile"] = containerfile
 	}
+	template := filepath.Join(b.rootDir, ContainerfileTemplate)
+	if _, err := os.Stat(template); err == nil {
+		status["containerfile_template"] = template
+	}
 
 	// Check for Justfile
 	justfile := filepath.Join(b.rootDir, "Justfile")
@@ -0,0 +1,349 @@
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Files inside an image bundle
+const (
+	bundleIndex      = "bundle.json"
+	bundleImage      = "image.tar"
+	bundleManifest   = "build-manifest.json"
+	bundleSignatures = "signatures"
+)
+
+// BundleInfo is the index of an image bundle
+type BundleInfo struct {
+	Image     string            `json:"image"`
+	Digest    string            `json:"digest,omitempty"`
+	Format    string            `json:"format"`
+	CreatedAt time.Time         `json:"created_at"`
+	Signed    bool              `json:"signed"`
+	Checksums map[string]string `json:"checksums"` // sha256 of every file, by path in the bundle
+}
+
+// ExportOptions configures ExportBundle
+type ExportOptions struct {
+	Image      string
+	Output     string
+	Format     string // docker-archive or oci-archive
+	Signatures bool   // Include cosign signatures from the registry
+}
+
+// ExportBundle writes an image, its build manifest, and its signatures into a
+// single tarball that can be carried into a disconnected network
+func (b *Builder) ExportBundle(ctx context.Context, opts ExportOptions) (*BundleInfo, error) {
+	if opts.Format != exec.ArchiveDocker && opts.Format != exec.ArchiveOCI {
+		return nil, fmt.Errorf("unsupported archive format %q (use %s or %s)", opts.Format, exec.ArchiveOCI, exec.ArchiveDocker)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "galena-export-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	info := &BundleInfo{
+		Image:     opts.Image,
+		Format:    opts.Format,
+		CreatedAt: time.Now().UTC(),
+	}
+	if digest, err := b.engine.ImageDigest(ctx, opts.Image); err == nil {
+		info.Digest = digest
+	}
+
+	b.logger.Info("saving image", "image", opts.Image, "format", opts.Format)
+	if result := b.engine.SaveImage(ctx, opts.Image, filepath.Join(tmpDir, bundleImage), opts.Format); result.Err != nil {
+		return nil, fmt.Errorf("saving image: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+
+	if data, err := os.ReadFile(filepath.Join(b.rootDir, bundleManifest)); err == nil {
+		if err := os.WriteFile(filepath.Join(tmpDir, bundleManifest), data, 0o644); err != nil {
+			return nil, fmt.Errorf("copying build manifest: %w", err)
+		}
+	}
+
+	if opts.Signatures {
+		info.Signed = b.saveSignatures(ctx, opts.Image, filepath.Join(tmpDir, bundleSignatures))
+	}
+
+	if info.Checksums, err = checksumTree(tmpDir); err != nil {
+		return nil, err
+	}
+	index, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling bundle index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, bundleIndex), index, 0o644); err != nil {
+		return nil, fmt.Errorf("writing bundle index: %w", err)
+	}
+
+	if err := tarTree(tmpDir, opts.Output); err != nil {
+		return nil, err
+	}
+	b.logger.Info("image bundle written", "path", opts.Output, "signed", info.Signed)
+	return info, nil
+}
+
+// saveSignatures stores the image with its cosign signatures and attestations
+// as an OCI layout. Local-only images have nothing to save.
+func (b *Builder) saveSignatures(ctx context.Context, imageRef, dir string) bool {
+	if strings.HasPrefix(imageRef, "localhost/") {
+		b.logger.Warn("skipping signatures: image has not been pushed", "image", imageRef)
+		return false
+	}
+	if err := exec.RequireCommands("cosign"); err != nil {
+		b.logger.Warn("skipping signatures", "error", err)
+		return false
+	}
+	if result := exec.Cosign(ctx, "save", imageRef, "--dir", dir); result.Err != nil {
+		b.logger.Warn("could not save signatures", "image", imageRef, "stderr", exec.LastNLines(result.Stderr, 5))
+		os.RemoveAll(dir)
+		return false
+	}
+	return true
+}
+
+// ImportOptions configures ImportBundle
+type ImportOptions struct {
+	Path     string
+	Registry string // Optional registry repository to load the signed image into
+}
+
+// ImportBundle verifies the checksums of a bundle, loads its image into local
+// storage under the original reference, and restores the build manifest next
+// to the bundle. With a registry, the image and its signatures are also
+// loaded there so cosign can verify them.
+func (b *Builder) ImportBundle(ctx context.Context, opts ImportOptions) (*BundleInfo, error) {
+	tmpDir, err := os.MkdirTemp("", "galena-import-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := untar(opts.Path, tmpDir); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, bundleIndex))
+	if err != nil {
+		return nil, fmt.Errorf("not an image bundle: %w", err)
+	}
+	var info BundleInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("parsing bundle index: %w", err)
+	}
+
+	checksums, err := checksumTree(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	delete(checksums, bundleIndex)
+	for name, want := range info.Checksums {
+		if checksums[name] != want {
+			return nil, fmt.Errorf("bundle file %s does not match its checksum", name)
+		}
+	}
+	for name := range checksums {
+		if _, ok := info.Checksums[name]; !ok {
+			return nil, fmt.Errorf("bundle file %s is not in the bundle index", name)
+		}
+	}
+	b.logger.Info("bundle checksums verified", "files", len(checksums))
+
+	b.logger.Info("loading image", "image", info.Image)
+	result := b.engine.LoadImage(ctx, filepath.Join(tmpDir, bundleImage), info.Format)
+	if result.Err != nil {
+		return nil, fmt.Errorf("loading image: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	if loaded := loadedImage(result.Stdout); loaded != "" && loaded != info.Image {
+		if tag := b.engine.Command(ctx, "tag", loaded, info.Image); tag.Err != nil {
+			return nil, fmt.Errorf("tagging %s as %s: %w", loaded, info.Image, tag.Err)
+		}
+	}
+
+	if manifest, err := os.ReadFile(filepath.Join(tmpDir, bundleManifest)); err == nil {
+		path := strings.TrimSuffix(opts.Path, filepath.Ext(opts.Path)) + "." + bundleManifest
+		if err := os.WriteFile(path, manifest, 0o644); err != nil {
+			b.logger.Warn("could not restore build manifest", "error", err)
+		} else {
+			b.logger.Info("build manifest restored", "path", path)
+		}
+	}
+
+	if opts.Registry != "" {
+		if !info.Signed {
+			return &info, fmt.Errorf("bundle has no signatures to load into %s", opts.Registry)
+		}
+		if err := exec.RequireCommands("cosign"); err != nil {
+			return &info, err
+		}
+		b.logger.Info("loading signed image into registry", "registry", opts.Registry)
+		if result := exec.Cosign(ctx, "load", "--dir", filepath.Join(tmpDir, bundleSignatures), opts.Registry); result.Err != nil {
+			return &info, fmt.Errorf("loading signatures: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+		}
+	}
+
+	return &info, nil
+}
+
+// loadedImage extracts the image name or ID reported by an engine load
+func loadedImage(stdout string) string {
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		for _, prefix := range []string{"Loaded image(s): ", "Loaded image: ", "Loaded image ID: "} {
+			if name, ok := strings.CutPrefix(line, prefix); ok {
+				name, _, _ = strings.Cut(name, ",")
+				return strings.TrimSpace(name)
+			}
+		}
+	}
+	// buildah pull prints only the image ID
+	if len(lines) > 0 && !strings.Contains(lines[len(lines)-1], " ") {
+		return strings.TrimSpace(lines[len(lines)-1])
+	}
+	return ""
+}
+
+// checksumTree returns the sha256 of every file below dir, by relative path
+func checksumTree(dir string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checksumming bundle: %w", err)
+	}
+	return sums, nil
+}
+
+// tarTree writes the files below dir into an uncompressed tarball
+func tarTree(dir, output string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating bundle: %w", err)
+	}
+	tw := tar.NewWriter(out)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	return nil
+}
+
+// untar extracts a bundle into dir, rejecting paths that escape it
+func untar(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening bundle: %w", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading bundle: %w", err)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("bundle entry %s escapes the bundle", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("extracting bundle: %w", err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return fmt.Errorf("extracting bundle: %w", err)
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return fmt.Errorf("extracting bundle: %w", err)
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("extracting bundle: %w", err)
+			}
+		default:
+			return fmt.Errorf("bundle entry %s has unsupported type", hdr.Name)
+		}
+	}
+}
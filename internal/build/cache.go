@@ -0,0 +1,44 @@
+package build
+
+import (
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// CacheArgs returns the registry cache flags for an engine. Podman and
+// buildah take plain repositories, while docker expects BuildKit cache specs.
+func CacheArgs(engine string, from []string, to string) []string {
+	args := []string{}
+	for _, repo := range from {
+		if repo == "" {
+			continue
+		}
+		if engine == exec.EngineDocker {
+			repo = "type=registry,ref=" + repo
+		}
+		args = append(args, "--cache-from", repo)
+	}
+	if to != "" {
+		if engine == exec.EngineDocker {
+			to = "type=registry,ref=" + to + ",mode=max"
+		}
+		args = append(args, "--cache-to", to)
+	}
+	if len(args) > 0 && engine != exec.EngineDocker {
+		// Podman only consults remote caches for intermediate layers
+		args = append(args, "--layers")
+	}
+	return args
+}
+
+// CacheSources merges configured and requested cache repositories,
+// with flag values taking precedence over galena.yaml
+func CacheSources(cfg config.CacheConfig, from []string, to string) ([]string, string) {
+	if len(from) == 0 {
+		from = cfg.From
+	}
+	if to == "" {
+		to = cfg.To
+	}
+	return from, to
+}
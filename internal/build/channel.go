@@ -0,0 +1,48 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// RemoteImage is the registry metadata of an image tag
+type RemoteImage struct {
+	Image   string     `json:"image"`
+	Digest  string     `json:"digest"`
+	Created *time.Time `json:"created,omitempty"`
+	Version string     `json:"version,omitempty"` // org.opencontainers.image.version label
+	Source  string     `json:"source,omitempty"`  // org.opencontainers.image.source label
+}
+
+// InspectRemote reads the digest, build date, and version of a registry
+// image with skopeo inspect
+func InspectRemote(ctx context.Context, imageRef string) (*RemoteImage, error) {
+	if err := exec.RequireCommands("skopeo"); err != nil {
+		return nil, err
+	}
+	result := exec.Skopeo(ctx, "inspect", "docker://"+imageRef)
+	if result.Err != nil {
+		return nil, fmt.Errorf("inspecting %s: %s", imageRef, exec.LastNLines(result.Stderr, 3))
+	}
+
+	var inspect struct {
+		Digest  string            `json:"Digest"`
+		Created *time.Time        `json:"Created"`
+		Labels  map[string]string `json:"Labels"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(result.Stdout)), &inspect); err != nil {
+		return nil, fmt.Errorf("parsing skopeo inspect output: %w", err)
+	}
+	return &RemoteImage{
+		Image:   imageRef,
+		Digest:  inspect.Digest,
+		Created: inspect.Created,
+		Version: inspect.Labels["org.opencontainers.image.version"],
+		Source:  inspect.Labels["org.opencontainers.image.source"],
+	}, nil
+}
@@ -0,0 +1,228 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// Checkpoint records the pipeline steps a build has completed so a failed
+// run can be resumed with --resume instead of rebuilding from scratch
+type Checkpoint struct {
+	Variant     string                 `json:"variant"`
+	ImageRef    string                 `json:"image_ref"`
+	Fingerprint string                 `json:"fingerprint"`
+	Digest      string                 `json:"digest,omitempty"`
+	Completed   []string               `json:"completed"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	Version     version.Info           `json:"version"`
+	Manifest    *version.BuildManifest `json:"manifest"`
+}
+
+// NewCheckpoint creates an empty checkpoint for a build
+func NewCheckpoint(variant, imageRef, fingerprint string, info version.Info, manifest *version.BuildManifest) *Checkpoint {
+	return &Checkpoint{
+		Variant:     variant,
+		ImageRef:    imageRef,
+		Fingerprint: fingerprint,
+		Completed:   []string{},
+		Version:     info,
+		Manifest:    manifest,
+	}
+}
+
+// CheckpointPath returns the checkpoint file of a variant. Variants use
+// separate files so matrix builds do not overwrite each other.
+func CheckpointPath(rootDir, variant string) string {
+	if variant == "" {
+		variant = "main"
+	}
+	return filepath.Join(StateDir(rootDir), "build-state-"+variant+".json")
+}
+
+// LoadCheckpoint loads the checkpoint of a variant, returning nil if none exists
+func LoadCheckpoint(rootDir, variant string) (*Checkpoint, error) {
+	data, err := os.ReadFile(CheckpointPath(rootDir, variant))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint: %w", err)
+	}
+	if cp.Manifest == nil {
+		return nil, fmt.Errorf("checkpoint has no manifest")
+	}
+	return &cp, nil
+}
+
+// ClearCheckpoint removes the checkpoint of a variant after a successful build
+func ClearCheckpoint(rootDir, variant string) error {
+	if err := os.Remove(CheckpointPath(rootDir, variant)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Done reports whether a step has completed
+func (c *Checkpoint) Done(step string) bool {
+	for _, s := range c.Completed {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete marks a step as completed with the current image digest
+func (c *Checkpoint) Complete(step, digest string) {
+	if !c.Done(step) {
+		c.Completed = append(c.Completed, step)
+	}
+	c.Digest = digest
+	c.UpdatedAt = time.Now().UTC()
+}
+
+// Save writes the checkpoint to the project
+func (c *Checkpoint) Save(rootDir string) error {
+	path := CheckpointPath(rootDir, c.Variant)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating checkpoint directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling checkpoint: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// buildFingerprint identifies the inputs that determine the built image, so a
+// checkpoint is only resumed for the same source and build settings
+func (b *Builder) buildFingerprint(ctx context.Context, opts BuildOptions, imageRef string, info version.Info, platforms, secretArgs []string) string {
+	args := map[string]string{}
+	for k, v := range b.cfg.Build.BuildArgs {
+		args[k] = v
+	}
+	if variant, err := b.cfg.GetVariant(opts.Variant); err == nil {
+		for k, v := range variant.BuildArgs {
+			args[k] = v
+		}
+		for k, v := range variant.Labels {
+			args["label:"+k] = v
+		}
+	}
+	for k, v := range opts.ExtraBuildArgs {
+		args[k] = v
+	}
+
+	parts := []string{
+		imageRef,
+		info.GitCommit,
+		"source=" + b.sourceDigest(ctx, info),
+		"base=" + b.cfg.Build.BaseImage + ":" + b.cfg.Build.FedoraVersion,
+		fmt.Sprintf("reproducible=%t", opts.Reproducible),
+		fmt.Sprintf("rechunk=%t", opts.Rechunk),
+		"platforms=" + strings.Join(platforms, ","),
+		"secrets=" + strings.Join(secretArgs, " "),
+	}
+	for _, k := range sortedKeys(args) {
+		parts = append(parts, k+"="+args[k])
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// sourceDigest hashes what the commit does not pin down: in a dirty tree the
+// diff against HEAD and the untracked files, and outside git the path, size,
+// and modification time of every file in the build context. A clean tree
+// yields an empty digest.
+func (b *Builder) sourceDigest(ctx context.Context, info version.Info) string {
+	h := sha256.New()
+	switch {
+	case info.GitCommit == "":
+		_ = filepath.WalkDir(b.rootDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(b.rootDir, path)
+			if d.IsDir() && (d.Name() == ".git" || generatedPath(rel)) {
+				return filepath.SkipDir
+			}
+			if fi, err := d.Info(); err == nil && !d.IsDir() && !generatedPath(rel) {
+				fmt.Fprintf(h, "%s %d %d\n", rel, fi.Size(), fi.ModTime().UnixNano())
+			}
+			return nil
+		})
+	case info.GitDirty:
+		opts := exec.DefaultOptions()
+		opts.Dir = b.rootDir
+		opts.SessionLog = nil
+		diff := exec.Run(ctx, "git", []string{"diff", "HEAD", "--binary"}, opts)
+		h.Write([]byte(diff.Stdout))
+		untracked := exec.Run(ctx, "git", []string{"ls-files", "--others", "--exclude-standard", "-z"}, opts)
+		for _, rel := range strings.Split(untracked.Stdout, "\x00") {
+			if rel == "" || generatedPath(rel) {
+				continue
+			}
+			data, _ := os.ReadFile(filepath.Join(b.rootDir, rel))
+			fmt.Fprintf(h, "%s %x\n", rel, sha256.Sum256(data))
+		}
+	default:
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// resumeCheckpoint returns the checkpoint of an earlier run when it matches
+// this build and its image is still present locally
+func (b *Builder) resumeCheckpoint(ctx context.Context, variant, fingerprint string) *Checkpoint {
+	cp, err := LoadCheckpoint(b.rootDir, variant)
+	if err != nil {
+		b.logger.Warn("ignoring unreadable build checkpoint", "error", err)
+		return nil
+	}
+	if cp == nil {
+		b.logger.Info("no build checkpoint found, starting from scratch")
+		return nil
+	}
+	if cp.Fingerprint != fingerprint {
+		b.logger.Warn("build checkpoint is for different inputs, starting from scratch",
+			"checkpoint_image", cp.ImageRef,
+			"updated", cp.UpdatedAt.Format(time.RFC3339),
+		)
+		return nil
+	}
+	if cp.Done(StageBuild) && cp.Digest != "" {
+		digest, err := b.getImageDigest(ctx, cp.ImageRef)
+		if err != nil || digest != cp.Digest {
+			b.logger.Warn("checkpointed image is missing or changed, starting from scratch", "image", cp.ImageRef)
+			return nil
+		}
+	}
+
+	b.logger.Info("resuming build from checkpoint",
+		"image", cp.ImageRef,
+		"completed", strings.Join(cp.Completed, ","),
+	)
+	return cp
+}
@@ -0,0 +1,76 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/version"
+)
+
+func TestFingerprintTracksDirtyChanges(t *testing.T) {
+	dir := gitRepo(t)
+	ctx := context.Background()
+	builder := NewBuilder(config.DefaultConfig(), dir, log.New(nil))
+	opts := DefaultBuildOptions()
+
+	fingerprint := func() string {
+		commit, branch, dirty := builder.getGitInfo(ctx)
+		info := version.Info{}.WithGit(commit, branch, dirty)
+		return builder.buildFingerprint(ctx, opts, "localhost/galena:latest", info, nil, nil)
+	}
+
+	clean := fingerprint()
+	if clean != fingerprint() {
+		t.Fatal("fingerprint of a clean tree is not stable")
+	}
+
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Containerfile", "FROM fedora\n")
+	first := fingerprint()
+	write("Containerfile", "FROM fedora:42\n")
+	second := fingerprint()
+	write("extra.sh", "echo hi\n")
+	third := fingerprint()
+
+	if first == clean || second == first || third == second {
+		t.Fatalf("fingerprint did not follow the working tree: %s", strings.Join([]string{clean, first, second, third}, " "))
+	}
+
+	// Files galena writes itself do not change the inputs
+	write("build-manifest.json", "{}")
+	if fingerprint() != third {
+		t.Fatal("fingerprint changed for a generated file")
+	}
+
+	secret := builder.buildFingerprint(ctx, opts, "localhost/galena:latest", version.Info{}, nil, []string{"--secret", "id=token,env=TOKEN"})
+	if secret == builder.buildFingerprint(ctx, opts, "localhost/galena:latest", version.Info{}, nil, nil) {
+		t.Fatal("fingerprint ignores secrets")
+	}
+}
+
+func TestCheckpointOutsideWorktree(t *testing.T) {
+	dir := gitRepo(t)
+	cp := NewCheckpoint("main", "localhost/galena:latest", "abc", version.Info{}, version.NewBuildManifest("galena", version.Info{}))
+	if err := cp.Save(dir); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	out, err := gitCmd(dir, "status", "--porcelain")
+	if err != nil {
+		t.Fatalf("git status: %v: %s", err, out)
+	}
+	if strings.TrimSpace(out) != "" {
+		t.Fatalf("checkpoint dirtied the tree:\n%s", out)
+	}
+}
@@ -0,0 +1,175 @@
+package build
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Checksum files written next to disk images
+const (
+	SHA256SumsFile = "SHA256SUMS"
+	SHA512SumsFile = "SHA512SUMS"
+)
+
+// DiskChecksum holds the checksums of one disk artifact
+type DiskChecksum struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+}
+
+// DiskChecksums is the result of checksumming the artifacts of a disk build
+type DiskChecksums struct {
+	Artifacts  []DiskChecksum `json:"artifacts"`
+	SHA256Sums string         `json:"sha256sums"`
+	SHA512Sums string         `json:"sha512sums"`
+	Signature  string         `json:"signature,omitempty"` // GPG signature or cosign bundle of SHA256SUMS
+	Signer     string         `json:"signer,omitempty"`
+}
+
+// ChecksumFile returns the SHA256 and SHA512 checksums and size of a file,
+// reading it once
+func ChecksumFile(path string) (DiskChecksum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DiskChecksum{}, err
+	}
+	defer f.Close()
+
+	h256, h512 := sha256.New(), sha512.New()
+	size, err := io.Copy(io.MultiWriter(h256, h512), f)
+	if err != nil {
+		return DiskChecksum{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return DiskChecksum{
+		Path:   path,
+		Size:   size,
+		SHA256: hex.EncodeToString(h256.Sum(nil)),
+		SHA512: hex.EncodeToString(h512.Sum(nil)),
+	}, nil
+}
+
+// ChecksumDiskArtifacts checksums disk artifacts and writes SHA256SUMS and
+// SHA512SUMS to dir, in the format sha256sum -c reads from dir. Entries of
+// other artifacts already listed in the files are kept.
+func ChecksumDiskArtifacts(dir string, paths ...string) (*DiskChecksums, error) {
+	result := &DiskChecksums{
+		SHA256Sums: filepath.Join(dir, SHA256SumsFile),
+		SHA512Sums: filepath.Join(dir, SHA512SumsFile),
+	}
+	sums256, err := readChecksumFile(result.SHA256Sums)
+	if err != nil {
+		return nil, err
+	}
+	sums512, err := readChecksumFile(result.SHA512Sums)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		sum, err := ChecksumFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("checksumming disk artifact: %w", err)
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || strings.HasPrefix(name, "..") {
+			name = filepath.Base(path)
+		}
+		name = filepath.ToSlash(name)
+		sums256[name] = sum.SHA256
+		sums512[name] = sum.SHA512
+		result.Artifacts = append(result.Artifacts, sum)
+	}
+
+	if err := writeChecksumFile(result.SHA256Sums, sums256); err != nil {
+		return nil, err
+	}
+	if err := writeChecksumFile(result.SHA512Sums, sums512); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readChecksumFile reads a sha256sum-style file into a map of file name to
+// checksum. A missing file is empty.
+func readChecksumFile(path string) (map[string]string, error) {
+	sums := map[string]string{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		// Binary mode entries mark the name with a leading '*'
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		sums[name] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return sums, nil
+}
+
+// writeChecksumFile writes checksums sorted by file name
+func writeChecksumFile(path string, sums map[string]string) error {
+	var b strings.Builder
+	for _, name := range sortedKeys(sums) {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Sign signs SHA256SUMS with gpg (an armored detached signature,
+// SHA256SUMS.asc) or cosign (a signature bundle, SHA256SUMS.cosign.bundle)
+// and records the signature in the result. gpgKey selects the GPG key; the
+// cosign key comes from the signer.
+func (c *DiskChecksums) Sign(ctx context.Context, method string, signer Signer, gpgKey string) error {
+	switch method {
+	case "gpg":
+		if err := exec.RequireCommands("gpg"); err != nil {
+			return err
+		}
+		signature := c.SHA256Sums + ".asc"
+		args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", signature}
+		if gpgKey != "" {
+			args = append(args, "--local-user", gpgKey)
+		}
+		if result := exec.Run(ctx, "gpg", append(args, c.SHA256Sums), exec.DefaultOptions()); result.Err != nil {
+			return fmt.Errorf("gpg: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+		}
+		c.Signature = signature
+	case "cosign":
+		bundle := c.SHA256Sums + ".cosign.bundle"
+		if err := signer.SignBlob(ctx, c.SHA256Sums, bundle); err != nil {
+			return err
+		}
+		c.Signature = bundle
+	default:
+		return fmt.Errorf("unknown checksum signer %q (use gpg or cosign)", method)
+	}
+	c.Signer = method
+	return nil
+}
@@ -0,0 +1,103 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cleanupTimeout bounds the cleanup after an interrupted build
+const cleanupTimeout = 2 * time.Minute
+
+// containerSnapshot records the build containers present before a build so
+// an interrupted build only removes the ones created after it started
+type containerSnapshot map[string]bool
+
+// activeBuilds tracks the builds running in this process, such as the
+// variants of a matrix. Leaked build containers are removed only once none
+// of them is still running, so an interrupted build never removes the
+// working containers of a sibling that carries on.
+var activeBuilds struct {
+	sync.Mutex
+	count       int
+	before      containerSnapshot
+	interrupted bool
+}
+
+// beginBuild registers a running build, snapshotting the build containers
+// when it is the first
+func (b *Builder) beginBuild(ctx context.Context) {
+	activeBuilds.Lock()
+	defer activeBuilds.Unlock()
+	if activeBuilds.count == 0 {
+		activeBuilds.before = b.snapshotContainers(ctx)
+		activeBuilds.interrupted = false
+	}
+	activeBuilds.count++
+}
+
+// endBuild unregisters a build. When the last running build ends and any
+// of them was interrupted, it removes the build containers they leaked.
+func (b *Builder) endBuild(ctx context.Context, interrupted bool) {
+	activeBuilds.Lock()
+	defer activeBuilds.Unlock()
+	activeBuilds.count--
+	if interrupted {
+		activeBuilds.interrupted = true
+	}
+	if activeBuilds.count > 0 || !activeBuilds.interrupted || activeBuilds.before == nil {
+		return
+	}
+	b.cleanupInterrupted(ctx, activeBuilds.before)
+}
+
+func (b *Builder) snapshotContainers(ctx context.Context) containerSnapshot {
+	ids, err := b.engine.ListBuildContainers(ctx)
+	if err != nil {
+		b.logger.Debug("could not list build containers", "error", err)
+		return nil
+	}
+	snapshot := containerSnapshot{}
+	for _, id := range ids {
+		snapshot[id] = true
+	}
+	return snapshot
+}
+
+// wrapInterrupted explains why the build context ended
+func wrapInterrupted(ctx context.Context, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("build timed out after %s: %w", timeout, err)
+	}
+	return fmt.Errorf("build interrupted: %w", err)
+}
+
+// cleanupInterrupted removes the build containers created since the
+// snapshot. The target image is never touched: an interrupted build has not
+// tagged it, so the tag still names the previous good image. It runs on a
+// fresh context because the build context is already done.
+func (b *Builder) cleanupInterrupted(ctx context.Context, before containerSnapshot) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	ids, err := b.engine.ListBuildContainers(ctx)
+	if err != nil {
+		b.logger.Warn("could not list build containers", "error", err)
+		return
+	}
+	leaked := []string{}
+	for _, id := range ids {
+		if !before[id] {
+			leaked = append(leaked, id)
+		}
+	}
+	if len(leaked) == 0 {
+		return
+	}
+	b.logger.Info("removing build containers of interrupted build", "count", len(leaked))
+	if result := b.engine.RemoveContainers(ctx, leaked...); result.Err != nil {
+		b.logger.Warn("could not remove build containers", "error", result.Err)
+	}
+}
@@ -0,0 +1,116 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Build args a Containerfile declares so variants can set them with
+// build_args
+const (
+	BaseImageArg = "BASE_IMAGE" // Image of the final stage
+	VariantArg   = "VARIANT"    // Variant being built, for shared build scripts
+)
+
+// instruction returns the upper-cased instruction and arguments of a
+// Containerfile line, or empty strings for comments and blank lines
+func instruction(line string) (string, []string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return "", nil
+	}
+	return strings.ToUpper(fields[0]), fields[1:]
+}
+
+// declaresArg reports whether lines hold an ARG instruction for name
+func declaresArg(lines []string, name string) bool {
+	for _, line := range lines {
+		inst, args := instruction(line)
+		if inst != "ARG" {
+			continue
+		}
+		for _, arg := range args {
+			if key, _, _ := strings.Cut(arg, "="); key == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WireVariantArgs declares the build args variants set in a Containerfile.
+// With base, the image of the final stage becomes ${BASE_IMAGE}, which
+// defaults to the image it had, so existing variants build as before.
+// VARIANT is declared in the final stage, defaulting to main. It returns
+// the new Containerfile and a description of each change; a Containerfile
+// that is already wired is returned as it is.
+func WireVariantArgs(data []byte, base bool) ([]byte, []string, error) {
+	lines := strings.Split(string(data), "\n")
+
+	var froms []int
+	stages := map[string]bool{}
+	for i, line := range lines {
+		inst, args := instruction(line)
+		if inst != "FROM" {
+			continue
+		}
+		froms = append(froms, i)
+		if n := len(args); n >= 2 && strings.EqualFold(args[n-2], "AS") {
+			stages[strings.ToLower(args[n-1])] = true
+		}
+	}
+	if len(froms) == 0 {
+		return nil, nil, fmt.Errorf("no FROM instruction")
+	}
+	first, final := froms[0], froms[len(froms)-1]
+
+	changes := []string{}
+	if !declaresArg(lines[final+1:], VariantArg) {
+		arg := []string{
+			"# Variant being built; build scripts shared by variants can check it",
+			"ARG " + VariantArg + "=main",
+		}
+		lines = append(lines[:final+1], append(arg, lines[final+1:]...)...)
+		changes = append(changes, "declared ARG "+VariantArg+" in the final stage")
+	}
+
+	if base {
+		line := lines[final]
+		_, args := instruction(line)
+		image := ""
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "--") {
+				image = arg
+				break
+			}
+		}
+		switch {
+		case image == "":
+			return nil, nil, fmt.Errorf("final FROM instruction names no image")
+		case strings.Contains(image, "$"+BaseImageArg) || strings.Contains(image, "${"+BaseImageArg):
+			// Already wired
+		case strings.Contains(line, "{{") || strings.Contains(image, "$"):
+			return nil, nil, fmt.Errorf("final FROM instruction %q uses variables; declare ARG %s and use it there by hand", strings.TrimSpace(line), BaseImageArg)
+		case stages[strings.ToLower(image)]:
+			return nil, nil, fmt.Errorf("final stage builds on stage %s; declare ARG %s and use it in that stage's FROM by hand", image, BaseImageArg)
+		default:
+			lines[final] = strings.Replace(line, image, "${"+BaseImageArg+"}", 1)
+			if !declaresArg(lines[:first], BaseImageArg) {
+				// Above the comments that describe the first stage
+				at := first
+				for at > 0 && strings.HasPrefix(strings.TrimSpace(lines[at-1]), "#") {
+					at--
+				}
+				arg := []string{
+					"# Base image of the final stage; variants override it with build_args",
+					"ARG " + BaseImageArg + "=" + image,
+					"",
+				}
+				lines = append(lines[:at], append(arg, lines[at:]...)...)
+			}
+			changes = append(changes, "final stage built FROM ${"+BaseImageArg+"} (default "+image+")")
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), changes, nil
+}
@@ -0,0 +1,315 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/ref"
+)
+
+// BaseImageDependency names build.base_image in dependency updates
+const BaseImageDependency = "base_image"
+
+// DependencyUpdate describes the digest refresh of one pinned image
+type DependencyUpdate struct {
+	Name      string
+	Image     string
+	Tag       string
+	OldDigest string
+	NewDigest string
+}
+
+// Changed reports whether the digest moved
+func (u DependencyUpdate) Changed() bool {
+	return u.OldDigest != u.NewDigest
+}
+
+// manifestMediaTypes are accepted when resolving a tag through the registry API
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ResolveDependencies resolves build.base_image and every dependency tag to
+// its current digest. The configuration is not modified.
+func ResolveDependencies(ctx context.Context, cfg *config.Config) ([]DependencyUpdate, error) {
+	updates := []DependencyUpdate{}
+
+	base, err := ref.Parse(cfg.Build.BaseImage)
+	if err != nil {
+		return nil, fmt.Errorf("build.base_image: %w", err)
+	}
+	baseTag := base.Tag
+	if baseTag == "" {
+		baseTag = ref.DefaultTag
+	}
+	baseImage := base.Name()
+	digest, err := ResolveDigest(ctx, baseImage+":"+baseTag)
+	if err != nil {
+		return nil, fmt.Errorf("resolving build.base_image: %w", err)
+	}
+	updates = append(updates, DependencyUpdate{
+		Name:      BaseImageDependency,
+		Image:     baseImage,
+		Tag:       baseTag,
+		OldDigest: cfg.Build.BaseImageDigest,
+		NewDigest: digest,
+	})
+
+	names := make([]string, 0, len(cfg.Dependencies))
+	for name := range cfg.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dep := cfg.Dependencies[name]
+		tag := dep.Tag
+		if tag == "" {
+			tag = ref.DefaultTag
+		}
+		digest, err := ResolveDigest(ctx, dep.Image+":"+tag)
+		if err != nil {
+			return nil, fmt.Errorf("resolving dependency %s: %w", name, err)
+		}
+		updates = append(updates, DependencyUpdate{
+			Name:      name,
+			Image:     dep.Image,
+			Tag:       tag,
+			OldDigest: dep.Digest,
+			NewDigest: digest,
+		})
+	}
+
+	return updates, nil
+}
+
+// DependencyStatus reports whether a pinned image is behind its tag
+type DependencyStatus struct {
+	Name           string     `json:"name"`
+	Image          string     `json:"image"`
+	Tag            string     `json:"tag"`
+	PinnedDigest   string     `json:"pinned_digest,omitempty"`
+	CurrentDigest  string     `json:"current_digest"`
+	Stale          bool       `json:"stale"`
+	PinnedCreated  *time.Time `json:"pinned_created,omitempty"`
+	CurrentCreated *time.Time `json:"current_created,omitempty"`
+	CurrentVersion string     `json:"current_version,omitempty"`
+	ReleaseNotes   string     `json:"release_notes,omitempty"`
+}
+
+// CheckDependencies compares the pinned digests with the current digests of
+// their tags. Stale dependencies get the creation dates of both digests and
+// a release notes link from the image labels when skopeo is installed.
+func CheckDependencies(ctx context.Context, cfg *config.Config) ([]DependencyStatus, error) {
+	updates, err := ResolveDependencies(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	inspect := exec.CheckCommand("skopeo")
+
+	statuses := make([]DependencyStatus, 0, len(updates))
+	for _, u := range updates {
+		status := DependencyStatus{
+			Name:          u.Name,
+			Image:         u.Image,
+			Tag:           u.Tag,
+			PinnedDigest:  u.OldDigest,
+			CurrentDigest: u.NewDigest,
+			Stale:         u.Changed(),
+		}
+		if status.Stale && inspect {
+			if current, err := InspectRemote(ctx, u.Image+"@"+u.NewDigest); err == nil {
+				status.CurrentCreated = current.Created
+				status.CurrentVersion = current.Version
+				status.ReleaseNotes = ReleaseNotesURL(current.Source)
+			}
+			if u.OldDigest != "" {
+				if pinned, err := InspectRemote(ctx, u.Image+"@"+u.OldDigest); err == nil {
+					status.PinnedCreated = pinned.Created
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ReleaseNotesURL returns the releases page of an image source repository,
+// or the source itself for forges without one
+func ReleaseNotesURL(source string) string {
+	source = strings.TrimSuffix(strings.TrimRight(source, "/"), ".git")
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	switch {
+	case u.Host == "github.com" || strings.Contains(u.Host, "forgejo") || strings.Contains(u.Host, "gitea") || u.Host == "codeberg.org":
+		return source + "/releases"
+	case strings.Contains(u.Host, "gitlab"):
+		return source + "/-/releases"
+	}
+	return source
+}
+
+// ApplyDependencyUpdates pins the resolved digests in a config file. Only
+// the digest keys are edited, so comments and layout of the file are kept.
+func ApplyDependencyUpdates(path string, updates []DependencyUpdate) error {
+	for _, u := range updates {
+		if !u.Changed() {
+			continue
+		}
+		key := "dependencies." + u.Name + ".digest"
+		if u.Name == BaseImageDependency {
+			key = "build.base_image_digest"
+		}
+		if err := config.SetFileValue(path, key, u.NewDigest); err != nil {
+			return fmt.Errorf("pinning %s: %w", u.Name, err)
+		}
+	}
+	return nil
+}
+
+// ResolveDigest returns the current manifest digest of a remote image tag,
+// using skopeo when installed and the registry API otherwise
+func ResolveDigest(ctx context.Context, imageRef string) (string, error) {
+	if exec.CheckCommand("skopeo") {
+		authFile, cleanup, err := storeAuthFile(ctx, imageRef)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		args := append([]string{"inspect", "--format", "{{.Digest}}"}, registryFlags("", authFile, nil)...)
+		result := exec.Skopeo(ctx, append(args, "docker://"+imageRef)...)
+		if result.Err == nil {
+			return strings.TrimSpace(result.Stdout), nil
+		}
+	}
+	return resolveDigestFromRegistry(ctx, imageRef)
+}
+
+// resolveDigestFromRegistry issues a manifest HEAD request, fetching an
+// anonymous bearer token when the registry asks for one
+func resolveDigestFromRegistry(ctx context.Context, imageRef string) (string, error) {
+	r, err := ref.Parse(imageRef)
+	if err != nil {
+		return "", err
+	}
+	registry, repository := r.Registry, r.Repository
+	if registry == "" || registry == "docker.io" {
+		registry = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+	tag := r.Tag
+	if tag == "" {
+		tag = ref.DefaultTag
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, tag)
+
+	resp, err := headManifest(ctx, client, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := fetchRegistryToken(ctx, client, resp.Header.Get("WWW-Authenticate"), repository)
+		if err != nil {
+			return "", err
+		}
+		resp, err = headManifest(ctx, client, manifestURL, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned %s for %s", resp.Status, imageRef)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not report a digest for %s", imageRef)
+	}
+	return digest, nil
+}
+
+func headManifest(ctx context.Context, client *http.Client, manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying registry: %w", err)
+	}
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// fetchRegistryToken requests an anonymous pull token from the realm named
+// in a WWW-Authenticate: Bearer challenge
+func fetchRegistryToken(ctx context.Context, client *http.Client, challenge, repository string) (string, error) {
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("registry requires authentication (challenge: %q)", challenge)
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting registry token: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request returned %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("parsing registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
@@ -0,0 +1,197 @@
+package build
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Image diff sections
+const (
+	DiffPackages = "rpms"
+	DiffFlatpaks = "flatpaks"
+	DiffFiles    = "files"
+	DiffLabels   = "labels"
+)
+
+// DiffSections returns the sections compared by DiffImages, in report order
+func DiffSections() []string {
+	return []string{DiffPackages, DiffFlatpaks, DiffFiles, DiffLabels}
+}
+
+// ImageSnapshot is the comparable contents of an image, keyed by section
+type ImageSnapshot struct {
+	Image    string
+	Sections map[string]map[string]string
+}
+
+// Change is one added, removed, or changed entry of a section
+type Change struct {
+	Key  string `json:"key"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// SectionDiff lists the changes of one section
+type SectionDiff struct {
+	Section string   `json:"section"`
+	Added   []Change `json:"added"`
+	Removed []Change `json:"removed"`
+	Changed []Change `json:"changed"`
+}
+
+// Empty reports whether the section is unchanged
+func (d SectionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// ImageDiff is the comparison of two images
+type ImageDiff struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Sections []SectionDiff `json:"sections"`
+}
+
+// rpmQueryFormat keys packages by name and arch so multilib installs stay apart
+const rpmQueryFormat = `%{NAME}.%{ARCH}\t%{EPOCHNUM}:%{VERSION}-%{RELEASE}\n`
+
+// fileListScript lists the files of the immutable and config trees with their
+// size; files of equal size count as unchanged
+const fileListScript = `find /usr /etc -xdev \( -type f -o -type l \) -printf '%p\t%s\n' 2>/dev/null; true`
+
+// preinstallScript prints every flatpak preinstall file in the image
+const preinstallScript = `cat /etc/flatpak/preinstall.d/*.preinstall /usr/share/flatpak/preinstall.d/*.preinstall 2>/dev/null; true`
+
+// DiffImages compares the selected sections of two images. Images that are
+// not available locally are pulled.
+func (b *Builder) DiffImages(ctx context.Context, from, to string, sections []string) (*ImageDiff, error) {
+	if len(sections) == 0 {
+		sections = DiffSections()
+	}
+	for _, s := range sections {
+		if !containsString(DiffSections(), s) {
+			return nil, fmt.Errorf("unknown diff section %q (available: %s)", s, strings.Join(DiffSections(), ", "))
+		}
+	}
+
+	before, err := b.Snapshot(ctx, from, sections)
+	if err != nil {
+		return nil, err
+	}
+	after, err := b.Snapshot(ctx, to, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ImageDiff{From: from, To: to}
+	for _, s := range DiffSections() {
+		if containsString(sections, s) {
+			diff.Sections = append(diff.Sections, diffMaps(s, before.Sections[s], after.Sections[s]))
+		}
+	}
+	return diff, nil
+}
+
+// Snapshot collects the selected sections of an image
+func (b *Builder) Snapshot(ctx context.Context, imageRef string, sections []string) (*ImageSnapshot, error) {
+	if _, err := b.engine.ImageDigest(ctx, imageRef); err != nil {
+		b.logger.Info("pulling image", "image", imageRef)
+		if result := exec.Pull(ctx, b.engine.Name(), imageRef); result.Err != nil {
+			return nil, fmt.Errorf("pulling %s: %w: %s", imageRef, result.Err, exec.LastNLines(result.Stderr, 5))
+		}
+	}
+
+	snapshot := &ImageSnapshot{Image: imageRef, Sections: map[string]map[string]string{}}
+	for _, s := range sections {
+		b.logger.Info("reading image contents", "image", imageRef, "section", s)
+		var entries map[string]string
+		var err error
+		switch s {
+		case DiffPackages:
+			entries, err = b.runInImage(ctx, imageRef, parseTabbed, "rpm", "-qa", "--qf", rpmQueryFormat)
+		case DiffFlatpaks:
+			entries, err = b.runInImage(ctx, imageRef, parsePreinstalls, "/bin/sh", "-c", preinstallScript)
+		case DiffFiles:
+			entries, err = b.runInImage(ctx, imageRef, parseTabbed, "/bin/sh", "-c", fileListScript)
+		case DiffLabels:
+			entries, err = b.engine.ImageLabels(ctx, imageRef)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s of %s: %w", s, imageRef, err)
+		}
+		snapshot.Sections[s] = entries
+	}
+	return snapshot, nil
+}
+
+func (b *Builder) runInImage(ctx context.Context, imageRef string, parse func(string) map[string]string, command ...string) (map[string]string, error) {
+	result := b.engine.RunImage(ctx, imageRef, command...)
+	if result.Err != nil {
+		return nil, fmt.Errorf("%w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return parse(result.Stdout), nil
+}
+
+// parseTabbed parses key<TAB>value lines
+func parseTabbed(out string) map[string]string {
+	entries := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			entries[key] = value
+		}
+	}
+	return entries
+}
+
+// parsePreinstalls maps flatpak preinstall app IDs to their branch
+func parsePreinstalls(out string) map[string]string {
+	entries := map[string]string{}
+	current := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "[Flatpak Preinstall ") && strings.HasSuffix(line, "]"):
+			current = strings.TrimSuffix(strings.TrimPrefix(line, "[Flatpak Preinstall "), "]")
+			entries[current] = ""
+		case strings.HasPrefix(line, "["):
+			current = ""
+		case current != "" && strings.HasPrefix(line, "Branch="):
+			entries[current] = strings.TrimPrefix(line, "Branch=")
+		}
+	}
+	return entries
+}
+
+// diffMaps compares two sections entry by entry
+func diffMaps(section string, from, to map[string]string) SectionDiff {
+	diff := SectionDiff{Section: section, Added: []Change{}, Removed: []Change{}, Changed: []Change{}}
+	for _, k := range sortedKeys(to) {
+		old, ok := from[k]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, Change{Key: k, To: to[k]})
+		case old != to[k]:
+			diff.Changed = append(diff.Changed, Change{Key: k, From: old, To: to[k]})
+		}
+	}
+	for _, k := range sortedKeys(from) {
+		if _, ok := to[k]; !ok {
+			diff.Removed = append(diff.Removed, Change{Key: k, From: from[k]})
+		}
+	}
+	return diff
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
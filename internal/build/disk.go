@@ -11,32 +11,45 @@ import (
 	"github.com/charmbracelet/log"
 	"github.com/iiroan/galena/internal/config"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/privilege"
 )
 
-// DiskBuilder builds disk images (qcow2, raw, iso) using bootc-image-builder
+// DiskBuilder builds disk images (qcow2, raw, iso, cloud) using bootc-image-builder
 type DiskBuilder struct {
 	cfg     *config.Config
 	rootDir string
 	logger  *log.Logger
+	rootful bool
 }
 
 // DiskOptions configures disk image generation
 type DiskOptions struct {
 	ImageRef   string
-	OutputType string // qcow2, raw, iso, vmdk, ami
+	OutputType string // qcow2, raw, iso, vmdk, ami, vhd, gce, azure, oci-cloud
 	OutputDir  string
 	ConfigFile string // Path to disk config TOML (optional)
-	RootFSType string // ext4, xfs, btrfs
+	Kickstart  string // Kickstart embedded in installer ISOs (optional)
+	Encryption *DiskEncryption
+	RootFSType string // ext4, xfs, btrfs; empty uses the image default
+	UseLibrepo bool   // Download RPMs with librepo, which picks faster mirrors
 	Timeout    time.Duration
 	Privileged bool
 	PullNewer  bool
+	Force      bool   // Rebuild even when the image and config are unchanged
+	TargetArch string // Architecture to build for (x86_64, aarch64); empty for the host
+}
+
+// RootFilesystems returns the root filesystem types bootc-image-builder supports
+func RootFilesystems() []string {
+	return []string{"btrfs", "ext4", "xfs"}
 }
 
 // DefaultDiskOptions returns default disk options
 func DefaultDiskOptions() DiskOptions {
 	return DiskOptions{
 		OutputType: "qcow2",
-		RootFSType: "ext4",
+		RootFSType: "btrfs",
+		UseLibrepo: true,
 		Timeout:    60 * time.Minute,
 		Privileged: true,
 		PullNewer:  true,
@@ -52,6 +65,41 @@ func NewDiskBuilder(cfg *config.Config, rootDir string, logger *log.Logger) *Dis
 	}
 }
 
+// WithRootfulPodman runs bootc-image-builder through rootful podman, elevated
+// by the privilege broker, loading local images from rootless storage first.
+// bootc-image-builder requires root.
+func (d *DiskBuilder) WithRootfulPodman() *DiskBuilder {
+	d.rootful = true
+	return d
+}
+
+// podmanCommand returns the podman invocation, elevated for rootful podman
+func (d *DiskBuilder) podmanCommand(ctx context.Context, reason string, args ...string) (string, []string, error) {
+	return d.command(ctx, reason, "podman", args...)
+}
+
+// command returns a command invocation, elevated for rootful podman
+func (d *DiskBuilder) command(ctx context.Context, reason, name string, args ...string) (string, []string, error) {
+	if !d.rootful {
+		return name, args, nil
+	}
+	return exec.Elevate(ctx, reason, name, args...)
+}
+
+// loadIntoRootfulStorage copies a local image from rootless into rootful podman storage
+func (d *DiskBuilder) loadIntoRootfulStorage(ctx context.Context, imageRef string) error {
+	name, args, err := d.podmanCommand(ctx, "build disk images with bootc-image-builder", "load")
+	if err != nil {
+		return err
+	}
+	d.logger.Info("loading image into rootful storage", "image", imageRef)
+	result := exec.RunPipe(ctx, "podman", []string{"save", imageRef}, name, args, exec.DefaultOptions())
+	if result.Err != nil {
+		return fmt.Errorf("loading image into rootful storage: %w", result.Err)
+	}
+	return nil
+}
+
 // Build builds a disk image using bootc-image-builder
 func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, error) {
 	// Validate
@@ -59,20 +107,43 @@ func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, erro
 		return "", fmt.Errorf("image reference is required")
 	}
 
-	validTypes := map[string]bool{
-		"qcow2":           true,
-		"raw":             true,
-		"iso":             true,
-		"vmdk":            true,
-		"ami":             true,
-		"anaconda-iso":    true,
-		"bootc-installer": true,
+	if !containsString(ListOutputTypes(), opts.OutputType) {
+		return "", fmt.Errorf("invalid output type %q, valid types: %s", opts.OutputType, strings.Join(ListOutputTypes(), ", "))
 	}
-	if !validTypes[opts.OutputType] {
-		return "", fmt.Errorf("invalid output type %q, valid types: qcow2, raw, iso, vmdk, ami, anaconda-iso, bootc-installer", opts.OutputType)
+
+	if opts.RootFSType != "" && !containsString(RootFilesystems(), opts.RootFSType) {
+		return "", fmt.Errorf("invalid root filesystem %q, valid types: %s", opts.RootFSType, strings.Join(RootFilesystems(), ", "))
+	}
+	platform := ""
+	if opts.TargetArch != "" {
+		var err error
+		if platform, err = diskPlatform(opts.TargetArch); err != nil {
+			return "", err
+		}
+		opts.TargetArch = unameArch(platform)
+		if platform != HostPlatform() {
+			if err := checkBinfmt(opts.TargetArch); err != nil {
+				return "", err
+			}
+		}
+	}
+	if opts.Kickstart != "" && !isInstallerType(opts.OutputType) {
+		return "", fmt.Errorf("kickstarts apply to installer ISOs (anaconda-iso, bootc-installer), not %s", opts.OutputType)
+	}
+	if opts.Encryption != nil {
+		if !isInstallerType(opts.OutputType) {
+			return "", fmt.Errorf("bootc-image-builder cannot encrypt %s images; encryption applies to installer ISOs (anaconda-iso, bootc-installer)", opts.OutputType)
+		}
+		if err := opts.Encryption.Validate(); err != nil {
+			return "", err
+		}
 	}
 
-	if err := exec.RequireCommands("podman"); err != nil {
+	required := []string{"podman"}
+	if opts.OutputType == "azure" {
+		required = append(required, "qemu-img")
+	}
+	if err := exec.RequireCommands(required...); err != nil {
 		return "", err
 	}
 
@@ -95,10 +166,27 @@ func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, erro
 
 	if isLocal {
 		d.logger.Info("using local container image", "image", opts.ImageRef)
-		// Skip pull for local images - they're already in storage
+		if platform != "" {
+			if err := checkImagePlatform(ctx, opts.ImageRef, platform); err != nil {
+				return "", err
+			}
+		}
+		if d.rootful && !privilege.IsRoot() {
+			if err := d.loadIntoRootfulStorage(ctx, opts.ImageRef); err != nil {
+				return "", err
+			}
+		}
 	} else {
 		d.logger.Info("pulling container image", "image", opts.ImageRef)
-		pullResult := exec.Run(ctx, "podman", []string{"pull", opts.ImageRef}, exec.DefaultOptions())
+		pull := []string{"pull"}
+		if platform != "" {
+			pull = append(pull, "--platform", platform)
+		}
+		pullName, pullArgs, err := d.podmanCommand(ctx, "pull images for bootc-image-builder", append(pull, opts.ImageRef)...)
+		if err != nil {
+			return "", err
+		}
+		pullResult := exec.RunRetry(ctx, pullName, pullArgs, exec.DefaultOptions())
 		if pullResult.Err != nil {
 			d.logger.Error("failed to pull image",
 				"exit_code", pullResult.ExitCode,
@@ -113,7 +201,7 @@ func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, erro
 	if configFile == "" {
 		// Select default config based on output type
 		var defaultConfigs []string
-		if opts.OutputType == "anaconda-iso" || opts.OutputType == "bootc-installer" {
+		if isInstallerType(opts.OutputType) {
 			// Interactive installers use iso.toml
 			defaultConfigs = []string{
 				filepath.Join(d.rootDir, "iso", "iso.toml"),
@@ -134,6 +222,49 @@ func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, erro
 		}
 	}
 
+	// Skip the build when the image and config are unchanged since the last one
+	var imageID, fingerprint string
+	if id, err := d.sourceImageID(ctx, opts.ImageRef); err != nil {
+		d.logger.Warn("cannot identify source image, disk build cache disabled", "error", err)
+	} else if fingerprint, err = diskFingerprint(opts, id, configFile); err != nil {
+		d.logger.Warn("cannot fingerprint disk inputs, disk build cache disabled", "error", err)
+	} else {
+		imageID = id
+		if cached := d.cachedDisk(opts.OutputDir, opts.OutputType, fingerprint); cached != "" && !opts.Force {
+			d.logger.Info("disk image is up to date, skipping build (use --force to rebuild)", "output", cached)
+			return cached, nil
+		}
+	}
+
+	// Embed the kickstart through the config, or inject it into the finished
+	// ISO with mkksiso when the config sets a kickstart of its own
+	injectKickstart := ""
+	if kickstart, err := installerKickstart(opts, configFile); err != nil {
+		return "", err
+	} else if kickstart != "" {
+		dir, err := os.MkdirTemp("", "galena-kickstart-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+
+		merged, err := kickstartConfig(dir, configFile, kickstart, opts.Kickstart == "")
+		if err != nil {
+			return "", err
+		}
+		if merged != "" {
+			configFile = merged
+		} else {
+			if err := exec.RequireCommands("mkksiso"); err != nil {
+				return "", fmt.Errorf("the disk config already sets a kickstart, injecting another one needs mkksiso (lorax): %w", err)
+			}
+			injectKickstart = filepath.Join(dir, "ks.cfg")
+			if err := os.WriteFile(injectKickstart, []byte(kickstart), 0o600); err != nil {
+				return "", fmt.Errorf("writing kickstart: %w", err)
+			}
+		}
+	}
+
 	// Build the bootc-image-builder command
 	args := d.buildBIBArgs(opts, configFile)
 
@@ -143,7 +274,12 @@ func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, erro
 	execOpts.StreamStdio = true
 	execOpts.Timeout = opts.Timeout
 
-	result := exec.Run(ctx, "podman", args, execOpts)
+	podmanName, podmanArgs, err := d.podmanCommand(ctx, "build disk images with bootc-image-builder", args...)
+	if err != nil {
+		return "", err
+	}
+
+	result := exec.Run(ctx, podmanName, podmanArgs, execOpts)
 	if result.Err != nil {
 		d.logger.Error("bootc-image-builder failed",
 			"exit_code", result.ExitCode,
@@ -151,14 +287,41 @@ func (d *DiskBuilder) Build(ctx context.Context, opts DiskOptions) (string, erro
 		)
 		return "", result.Err
 	}
+	if exec.DryRun() {
+		return opts.OutputDir, nil
+	}
 
 	// Find the output file
-	outputFile := d.findOutputFile(opts.OutputDir, opts.OutputType)
+	outputFile := d.findOutputFile(opts.OutputDir, bibOutputType(opts.OutputType))
 	if outputFile == "" {
 		d.logger.Warn("could not locate output file in directory", "dir", opts.OutputDir)
 		return opts.OutputDir, nil
 	}
 
+	outputFile, err = d.postProcess(ctx, opts.OutputType, outputFile)
+	if err != nil {
+		return "", err
+	}
+	if injectKickstart != "" {
+		if err := d.injectKickstart(ctx, outputFile, injectKickstart); err != nil {
+			return "", err
+		}
+	}
+
+	if fingerprint != "" {
+		record := DiskCacheRecord{
+			OutputType:  opts.OutputType,
+			ImageRef:    opts.ImageRef,
+			ImageID:     imageID,
+			Fingerprint: fingerprint,
+			Output:      outputFile,
+			BuiltAt:     time.Now(),
+		}
+		if err := saveDiskCache(opts.OutputDir, record); err != nil {
+			d.logger.Warn("failed to save disk build cache", "error", err)
+		}
+	}
+
 	d.logger.Info("disk image created successfully",
 		"type", opts.OutputType,
 		"output", outputFile,
@@ -198,6 +361,16 @@ func (d *DiskBuilder) buildBIBArgs(opts DiskOptions, configFile string) []string
 		"-v", "/var/lib/containers/storage:/var/lib/containers/storage",
 	)
 
+	// Reuse the osbuild store and RPM metadata of earlier builds
+	if d.rootDir != "" {
+		cache := BIBCacheDir(d.rootDir)
+		for _, sub := range []string{"store", "rpmmd"} {
+			if err := os.MkdirAll(filepath.Join(cache, sub), 0o755); err == nil {
+				args = append(args, "-v", filepath.Join(cache, sub)+":/"+sub)
+			}
+		}
+	}
+
 	// Mount output directory
 	args = append(args, "-v", opts.OutputDir+":/output")
 
@@ -205,25 +378,34 @@ func (d *DiskBuilder) buildBIBArgs(opts DiskOptions, configFile string) []string
 	args = append(args, "quay.io/centos-bootc/bootc-image-builder:latest")
 
 	// BIB arguments
-	args = append(args, "--type", opts.OutputType)
+	args = append(args, bibFlags(opts, configFile != "")...)
 
-	// Align with Justfile parameters
-	args = append(args, "--use-librepo=True")
-	args = append(args, "--rootfs=btrfs")
+	// The source image - pass directly (including localhost/ for local builds)
+	args = append(args, opts.ImageRef)
+
+	return args
+}
+
+// bibFlags maps disk options to bootc-image-builder flags. Each option
+// produces at most one flag, so the options are the single source of truth.
+func bibFlags(opts DiskOptions, hasConfig bool) []string {
+	flags := []string{"--type", bibOutputType(opts.OutputType)}
+
+	// Passed either way so the choice shows in the logged arguments
+	flags = append(flags, fmt.Sprintf("--use-librepo=%t", opts.UseLibrepo))
 
 	if opts.RootFSType != "" {
-		args = append(args, "--rootfs", opts.RootFSType)
+		flags = append(flags, "--rootfs", opts.RootFSType)
 	}
 
-	// Add config if present
-	if configFile != "" {
-		args = append(args, "--config", "/config.toml")
+	if opts.TargetArch != "" {
+		flags = append(flags, "--target-arch", opts.TargetArch)
 	}
 
-	// The source image - pass directly (including localhost/ for local builds)
-	args = append(args, opts.ImageRef)
-
-	return args
+	if hasConfig {
+		flags = append(flags, "--config", "/config.toml")
+	}
+	return flags
 }
 
 // findOutputFile finds the generated output file
@@ -236,6 +418,8 @@ func (d *DiskBuilder) findOutputFile(outputDir, outputType string) string {
 		"ami":             {".raw"},
 		"anaconda-iso":    {".iso"},
 		"bootc-installer": {".iso"},
+		"vhd":             {".vhd"},
+		"gce":             {".gz", ".raw"},
 	}
 
 	exts, ok := extensions[outputType]
@@ -264,6 +448,158 @@ func (d *DiskBuilder) findOutputFile(outputDir, outputType string) string {
 	return found
 }
 
+// diskPlatform returns the podman platform of a disk target architecture.
+// bootc-image-builder builds x86_64 and aarch64 images.
+func diskPlatform(arch string) (string, error) {
+	platform, err := normalizePlatform(strings.ToLower(arch))
+	if err != nil {
+		return "", err
+	}
+	if platform != "linux/amd64" && platform != "linux/arm64" {
+		return "", fmt.Errorf("disk images can be built for x86_64 or aarch64, not %s", arch)
+	}
+	return platform, nil
+}
+
+// unameArch returns the kernel architecture name of a podman platform
+func unameArch(platform string) string {
+	switch platform {
+	case "linux/amd64":
+		return "x86_64"
+	case "linux/arm64":
+		return "aarch64"
+	}
+	return strings.TrimPrefix(platform, "linux/")
+}
+
+// checkBinfmt verifies that qemu-user-static is registered with binfmt_misc
+// for an architecture, which cross-architecture builds run their tools with
+func checkBinfmt(arch string) error {
+	path := "/proc/sys/fs/binfmt_misc/qemu-" + arch
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("building %s images on %s needs qemu-user-static: install it and restart systemd-binfmt (%s not found)", arch, unameArch(HostPlatform()), path)
+	}
+	if !strings.HasPrefix(string(data), "enabled") {
+		return fmt.Errorf("binfmt handler %s is disabled", path)
+	}
+	return nil
+}
+
+// checkImagePlatform verifies that a local image was built for a platform
+func checkImagePlatform(ctx context.Context, imageRef, platform string) error {
+	result := exec.RunSimple(ctx, "podman", "image", "inspect", "--format", "{{.Os}}/{{.Architecture}}", imageRef)
+	if result.Err != nil {
+		return fmt.Errorf("inspecting image: %w", result.Err)
+	}
+	if got := strings.TrimSpace(result.Stdout); got != platform {
+		return fmt.Errorf("local image %s is %s, not %s: build it with --arch %s first", imageRef, got, platform, strings.TrimPrefix(platform, "linux/"))
+	}
+	return nil
+}
+
+// isInstallerType reports whether an output type is an installer ISO
+func isInstallerType(outputType string) bool {
+	return outputType == "anaconda-iso" || outputType == "bootc-installer"
+}
+
+// cloudOutputTypes maps the output types galena post-processes for a cloud
+// provider to the bootc-image-builder type they are built from
+var cloudOutputTypes = map[string]string{
+	"azure":     "raw",
+	"oci-cloud": "qcow2",
+}
+
+// BIBCacheDir returns where bootc-image-builder keeps its osbuild store and
+// RPM metadata between disk builds
+func BIBCacheDir(rootDir string) string {
+	return ToolCacheDir(rootDir, "bootc-image-builder")
+}
+
+// bibOutputType returns the bootc-image-builder type of an output type
+func bibOutputType(outputType string) string {
+	if t, ok := cloudOutputTypes[outputType]; ok {
+		return t
+	}
+	return outputType
+}
+
+// postProcess converts bootc-image-builder output into the format a cloud
+// provider imports: a gzip tarball holding disk.raw for GCE and a fixed VHD
+// with a 1 MiB aligned size for Azure. Other types are returned unchanged.
+func (d *DiskBuilder) postProcess(ctx context.Context, outputType, path string) (string, error) {
+	switch outputType {
+	case "gce":
+		if strings.HasSuffix(path, ".tar.gz") {
+			return path, nil
+		}
+		return d.gceTarball(ctx, path)
+	case "azure":
+		return d.azureVHD(ctx, path)
+	}
+	return path, nil
+}
+
+// gceTarball packs a raw disk into the image.tar.gz GCE imports. GCE
+// requires the disk to be named disk.raw and the tarball in oldgnu format.
+func (d *DiskBuilder) gceTarball(ctx context.Context, path string) (string, error) {
+	dir := filepath.Dir(path)
+	diskRaw := filepath.Join(dir, "disk.raw")
+	if path != diskRaw {
+		if err := d.runTool(ctx, "mv", "-f", path, diskRaw); err != nil {
+			return "", err
+		}
+	}
+
+	tarball := filepath.Join(dir, "image.tar.gz")
+	d.logger.Info("creating GCE image tarball", "output", tarball)
+	if err := d.runTool(ctx, "tar", "--format=oldgnu", "--remove-files", "-Sczf", tarball, "-C", dir, "disk.raw"); err != nil {
+		return "", err
+	}
+	return tarball, nil
+}
+
+// azureVHD converts a raw disk into the fixed VHD Azure imports. Azure
+// rejects disks whose virtual size is not a whole number of MiB.
+func (d *DiskBuilder) azureVHD(ctx context.Context, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading disk image: %w", err)
+	}
+	const mib = 1 << 20
+	if size := (info.Size() + mib - 1) / mib * mib; size != info.Size() {
+		d.logger.Info("aligning disk size for Azure", "size", size)
+		if err := d.runTool(ctx, "qemu-img", "resize", "-f", "raw", path, fmt.Sprintf("%d", size)); err != nil {
+			return "", err
+		}
+	}
+
+	vhd := strings.TrimSuffix(path, filepath.Ext(path)) + ".vhd"
+	d.logger.Info("converting to fixed VHD", "output", vhd)
+	if err := d.runTool(ctx, "qemu-img", "convert", "-f", "raw", "-O", "vpc", "-o", "subformat=fixed,force_size", path, vhd); err != nil {
+		return "", err
+	}
+	if err := d.runTool(ctx, "rm", "-f", path); err != nil {
+		d.logger.Warn("failed to remove raw disk", "path", path, "error", err)
+	}
+	return vhd, nil
+}
+
+// runTool runs a post-processing command. bootc-image-builder output is
+// owned by root when it ran through rootful podman, so it is elevated too.
+func (d *DiskBuilder) runTool(ctx context.Context, name string, args ...string) error {
+	cmdName, cmdArgs, err := d.command(ctx, "post-process disk images", name, args...)
+	if err != nil {
+		return err
+	}
+	opts := exec.DefaultOptions()
+	opts.Timeout = 30 * time.Minute
+	if result := exec.Run(ctx, cmdName, cmdArgs, opts); result.Err != nil {
+		return fmt.Errorf("%s: %w: %s", name, result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return nil
+}
+
 // BuildViaJust builds disk image using the existing Justfile
 func (d *DiskBuilder) BuildViaJust(ctx context.Context, outputType string) error {
 	if err := exec.RequireCommands("just"); err != nil {
@@ -299,5 +635,9 @@ func ListOutputTypes() []string {
 		"ami",
 		"anaconda-iso",
 		"bootc-installer",
+		"vhd",
+		"gce",
+		"azure",
+		"oci-cloud",
 	}
 }
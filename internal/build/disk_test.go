@@ -0,0 +1,61 @@
+package build
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBIBFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      DiskOptions
+		hasConfig bool
+		want      []string
+	}{
+		{
+			name: "defaults",
+			opts: DefaultDiskOptions(),
+			want: []string{"--type", "qcow2", "--use-librepo=true", "--rootfs", "btrfs"},
+		},
+		{
+			name: "without librepo",
+			opts: DiskOptions{OutputType: "raw"},
+			want: []string{"--type", "raw", "--use-librepo=false"},
+		},
+		{
+			name: "rootfs",
+			opts: DiskOptions{OutputType: "qcow2", RootFSType: "ext4", UseLibrepo: true},
+			want: []string{"--type", "qcow2", "--use-librepo=true", "--rootfs", "ext4"},
+		},
+		{
+			name: "target arch",
+			opts: DiskOptions{OutputType: "raw", TargetArch: "aarch64", UseLibrepo: true},
+			want: []string{"--type", "raw", "--use-librepo=true", "--target-arch", "aarch64"},
+		},
+		{
+			name:      "config",
+			opts:      DiskOptions{OutputType: "anaconda-iso", RootFSType: "xfs"},
+			hasConfig: true,
+			want:      []string{"--type", "anaconda-iso", "--use-librepo=false", "--rootfs", "xfs", "--config", "/config.toml"},
+		},
+		{
+			name: "azure builds raw",
+			opts: DiskOptions{OutputType: "azure", UseLibrepo: true},
+			want: []string{"--type", "raw", "--use-librepo=true"},
+		},
+		{
+			name: "oci-cloud builds qcow2",
+			opts: DiskOptions{OutputType: "oci-cloud", UseLibrepo: true},
+			want: []string{"--type", "qcow2", "--use-librepo=true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bibFlags(tt.opts, tt.hasConfig)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("bibFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
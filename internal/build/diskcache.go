@@ -0,0 +1,109 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// DiskCacheRecord describes the inputs of a built disk image. It is stored
+// in the output directory so an image whose inputs are unchanged is not
+// rebuilt.
+type DiskCacheRecord struct {
+	OutputType  string    `json:"output_type"`
+	ImageRef    string    `json:"image_ref"`
+	ImageID     string    `json:"image_id"`
+	Fingerprint string    `json:"fingerprint"`
+	Output      string    `json:"output"`
+	BuiltAt     time.Time `json:"built_at"`
+}
+
+// DiskCachePath returns the cache record of an output type in an output directory
+func DiskCachePath(outputDir, outputType string) string {
+	return filepath.Join(outputDir, ".galena-disk-"+outputType+".json")
+}
+
+// diskFingerprint hashes everything that changes a disk image: the source
+// image ID, the disk options, and the contents of the config and kickstart
+func diskFingerprint(opts DiskOptions, imageID, configFile string) (string, error) {
+	parts := []string{
+		imageID,
+		"type=" + opts.OutputType,
+		"rootfs=" + opts.RootFSType,
+		fmt.Sprintf("librepo=%t", opts.UseLibrepo),
+		"arch=" + opts.TargetArch,
+	}
+	// The passphrase is left out so the stored fingerprint cannot be used to
+	// guess it; changing only the passphrase needs --force
+	if opts.Encryption != nil {
+		parts = append(parts, "encryption="+opts.Encryption.Mode)
+	}
+	for _, file := range []string{configFile, opts.Kickstart} {
+		if file == "" {
+			parts = append(parts, "")
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		parts = append(parts, hex.EncodeToString(sum[:]))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sourceImageID returns the ID of the source image in the storage
+// bootc-image-builder reads
+func (d *DiskBuilder) sourceImageID(ctx context.Context, imageRef string) (string, error) {
+	name, args, err := d.podmanCommand(ctx, "inspect images for bootc-image-builder", "image", "inspect", "--format", "{{.Id}}", imageRef)
+	if err != nil {
+		return "", err
+	}
+	result := exec.Run(ctx, name, args, exec.DefaultOptions())
+	if result.Err != nil {
+		return "", fmt.Errorf("inspecting image: %w", result.Err)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// cachedDisk returns the output of an earlier build with the same
+// fingerprint, or empty when the image must be built
+func (d *DiskBuilder) cachedDisk(outputDir, outputType, fingerprint string) string {
+	data, err := os.ReadFile(DiskCachePath(outputDir, outputType))
+	if err != nil {
+		return ""
+	}
+	var record DiskCacheRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		d.logger.Warn("ignoring unreadable disk cache record", "error", err)
+		return ""
+	}
+	if record.Fingerprint != fingerprint {
+		d.logger.Debug("disk inputs changed since the last build", "built", record.BuiltAt.Format(time.RFC3339))
+		return ""
+	}
+	if _, err := os.Stat(record.Output); err != nil {
+		return ""
+	}
+	return record.Output
+}
+
+// saveDiskCache records the inputs of a finished disk build
+func saveDiskCache(outputDir string, record DiskCacheRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(DiskCachePath(outputDir, record.OutputType), data, 0o644)
+}
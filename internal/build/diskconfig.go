@@ -0,0 +1,220 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DiskConfig is the part of a bootc-image-builder config that galena
+// generates: users, filesystem sizes, and kernel arguments
+type DiskConfig struct {
+	Users       []DiskUser
+	Filesystems []DiskFilesystem
+	KernelArgs  []string // Appended to the kernel command line
+}
+
+// DiskUser is a user created in the disk image
+type DiskUser struct {
+	Name     string
+	Password string // Plain text or crypt(3) hash, optional
+	Key      string // SSH public key, optional
+	Groups   []string
+}
+
+// DiskFilesystem is the minimum size of a mount point
+type DiskFilesystem struct {
+	Mountpoint string
+	MinSize    string // e.g. "20 GiB"
+}
+
+var (
+	diskUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	diskSizePattern = regexp.MustCompile(`^[0-9]+ ?(B|KB|MB|GB|TB|KiB|MiB|GiB|TiB)?$`)
+	sshKeyTypes     = []string{"ssh-ed25519", "ssh-rsa", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "sk-ssh-ed25519@openssh.com", "sk-ecdsa-sha2-nistp256@openssh.com"}
+)
+
+// ValidateDiskUserName checks a user name against the useradd rules
+func ValidateDiskUserName(name string) error {
+	if name == "root" {
+		return fmt.Errorf("root cannot be created, pick another user name")
+	}
+	if !diskUserPattern.MatchString(name) {
+		return fmt.Errorf("invalid user name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// ValidateSSHKey checks that key is a single SSH public key line
+func ValidateSSHKey(key string) error {
+	fields := strings.Fields(key)
+	if len(fields) < 2 || strings.Contains(strings.TrimSpace(key), "\n") {
+		return fmt.Errorf("invalid SSH public key: expected \"<type> <key> [comment]\"")
+	}
+	if !containsString(sshKeyTypes, fields[0]) {
+		return fmt.Errorf("unsupported SSH key type %q", fields[0])
+	}
+	return nil
+}
+
+// ValidateDiskSize checks a bootc-image-builder size such as "20 GiB"
+func ValidateDiskSize(size string) error {
+	if !diskSizePattern.MatchString(strings.TrimSpace(size)) {
+		return fmt.Errorf("invalid size %q: use a number with a unit, e.g. 20 GiB", size)
+	}
+	return nil
+}
+
+// ValidateMountpoint checks a mount point bootc-image-builder can size.
+// bootc images only allow / and /boot, and directories under /var.
+func ValidateMountpoint(mountpoint string) error {
+	clean := filepath.Clean(mountpoint)
+	if !filepath.IsAbs(mountpoint) || clean != mountpoint {
+		return fmt.Errorf("invalid mount point %q: use a clean absolute path", mountpoint)
+	}
+	if clean != "/" && clean != "/boot" && clean != "/var" && !strings.HasPrefix(clean, "/var/") {
+		return fmt.Errorf("unsupported mount point %q: use /, /boot, or a path under /var", mountpoint)
+	}
+	return nil
+}
+
+// ReadSSHKey returns the public key in value, reading it from a file when
+// value is a path. A leading ~/ is expanded to the home directory.
+func ReadSSHKey(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if ValidateSSHKey(value) == nil {
+		return value, nil
+	}
+	path := value
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading SSH key: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if err := ValidateSSHKey(key); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// DefaultSSHKeyPath returns the first public key found in ~/.ssh, or empty
+func DefaultSSHKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"id_ed25519.pub", "id_ecdsa.pub", "id_rsa.pub"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Validate checks the config before it is written or built
+func (c DiskConfig) Validate() error {
+	for _, u := range c.Users {
+		if err := ValidateDiskUserName(u.Name); err != nil {
+			return err
+		}
+		if u.Password == "" && u.Key == "" {
+			return fmt.Errorf("user %s needs a password or an SSH key to log in", u.Name)
+		}
+		if u.Key != "" {
+			if err := ValidateSSHKey(u.Key); err != nil {
+				return fmt.Errorf("user %s: %w", u.Name, err)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, fs := range c.Filesystems {
+		if err := ValidateMountpoint(fs.Mountpoint); err != nil {
+			return err
+		}
+		if seen[fs.Mountpoint] {
+			return fmt.Errorf("mount point %s is listed twice", fs.Mountpoint)
+		}
+		seen[fs.Mountpoint] = true
+		if err := ValidateDiskSize(fs.MinSize); err != nil {
+			return fmt.Errorf("%s: %w", fs.Mountpoint, err)
+		}
+	}
+
+	for _, arg := range c.KernelArgs {
+		if strings.ContainsAny(arg, " \t\n\"'") {
+			return fmt.Errorf("invalid kernel argument %q", arg)
+		}
+	}
+	return nil
+}
+
+// TOML renders the config in the bootc-image-builder format
+func (c DiskConfig) TOML() string {
+	var b strings.Builder
+	b.WriteString("# bootc-image-builder disk configuration\n")
+	b.WriteString("# Generated by galena-build disk config init\n")
+
+	for _, u := range c.Users {
+		b.WriteString("\n[[customizations.user]]\n")
+		fmt.Fprintf(&b, "name = %s\n", tomlString(u.Name))
+		if u.Password != "" {
+			fmt.Fprintf(&b, "password = %s\n", tomlString(u.Password))
+		}
+		if u.Key != "" {
+			fmt.Fprintf(&b, "key = %s\n", tomlString(u.Key))
+		}
+		if len(u.Groups) > 0 {
+			groups := make([]string, len(u.Groups))
+			for i, g := range u.Groups {
+				groups[i] = tomlString(g)
+			}
+			fmt.Fprintf(&b, "groups = [%s]\n", strings.Join(groups, ", "))
+		}
+	}
+
+	for _, fs := range c.Filesystems {
+		b.WriteString("\n[[customizations.filesystem]]\n")
+		fmt.Fprintf(&b, "mountpoint = %s\n", tomlString(fs.Mountpoint))
+		fmt.Fprintf(&b, "minsize = %s\n", tomlString(strings.TrimSpace(fs.MinSize)))
+	}
+
+	if len(c.KernelArgs) > 0 {
+		b.WriteString("\n[customizations.kernel]\n")
+		fmt.Fprintf(&b, "append = %s\n", tomlString(strings.Join(c.KernelArgs, " ")))
+	}
+	return b.String()
+}
+
+// tomlString quotes s as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/version"
+)
+
+// pushCompressionRatio approximates how much smaller the compressed layers
+// uploaded by a push are than the uncompressed local image size
+const pushCompressionRatio = 0.45
+
+// Estimate predicts the cost of a build from earlier runs
+type Estimate struct {
+	Samples   int
+	Duration  time.Duration
+	Stages    map[string]time.Duration
+	Unknown   []string
+	ImageSize int64
+	PushSize  int64
+	DiskSizes map[string]int64
+}
+
+// HasData reports whether any earlier build informed the estimate
+func (e Estimate) HasData() bool {
+	return e.Samples > 0 || e.ImageSize > 0 || len(e.DiskSizes) > 0
+}
+
+// EstimateBuild estimates duration and sizes for a build with the given
+// options, using the project's build history, the last build manifest, and
+// existing disk artifacts in ./output.
+func EstimateBuild(rootDir string, opts BuildOptions) Estimate {
+	est := Estimate{
+		Stages:    map[string]time.Duration{},
+		DiskSizes: latestDiskSizes(filepath.Join(rootDir, "output")),
+	}
+
+	history, _ := LoadHistory(rootDir)
+	matching := filterHistory(history, func(e HistoryEntry) bool { return e.Variant == opts.Variant })
+	if len(matching) == 0 {
+		matching = history
+	}
+	est.Samples = len(matching)
+
+	if len(matching) > 0 {
+		est.ImageSize = matching[len(matching)-1].ImageSize
+	} else if manifest, err := version.LoadManifest(filepath.Join(rootDir, "build-manifest.json")); err == nil {
+		for _, image := range manifest.Images {
+			if image.Variant == opts.Variant && image.Size > 0 {
+				est.ImageSize = image.Size
+			}
+		}
+	}
+	if opts.Push && est.ImageSize > 0 {
+		est.PushSize = int64(float64(est.ImageSize) * pushCompressionRatio)
+	}
+
+	if opts.DryRun {
+		return est
+	}
+
+	// Cached and uncached builds differ by an order of magnitude, so prefer like for like
+	buildSamples := filterHistory(matching, func(e HistoryEntry) bool { return e.NoCache == opts.NoCache })
+	if len(buildSamples) == 0 {
+		buildSamples = matching
+	}
+
+	stages := []string{StageBuild}
+	if opts.Rechunk {
+		stages = append(stages, StageRechunk)
+	}
+	if opts.Healthcheck {
+		stages = append(stages, StageHealthcheck)
+	}
+	if opts.Test {
+		stages = append(stages, StageTest)
+	}
+	if opts.Push {
+		stages = append(stages, StagePush)
+	}
+	if opts.Sign {
+		stages = append(stages, StageSign)
+	}
+	if opts.SBOM {
+		stages = append(stages, StageSBOM)
+	}
+	if opts.Provenance {
+		stages = append(stages, StageProvenance)
+	}
+
+	for _, stage := range stages {
+		samples := matching
+		if stage == StageBuild {
+			samples = buildSamples
+		}
+		if avg, ok := averageStage(samples, stage); ok {
+			est.Stages[stage] = avg
+			est.Duration += avg
+		} else {
+			est.Unknown = append(est.Unknown, stage)
+		}
+	}
+
+	return est
+}
+
+func filterHistory(entries []HistoryEntry, keep func(HistoryEntry) bool) []HistoryEntry {
+	filtered := []HistoryEntry{}
+	for _, e := range entries {
+		if keep(e) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// averageStage averages a stage over the most recent entries that ran it
+func averageStage(entries []HistoryEntry, stage string) (time.Duration, bool) {
+	const window = 5
+	total := 0.0
+	count := 0
+	for i := len(entries) - 1; i >= 0 && count < window; i-- {
+		if seconds, ok := entries[i].Stages[stage]; ok {
+			total += seconds
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return time.Duration(total / float64(count) * float64(time.Second)), true
+}
+
+// latestDiskSizes returns the size of the newest artifact per disk type
+func latestDiskSizes(outputDir string) map[string]int64 {
+	sizes := map[string]int64{}
+	newest := map[string]time.Time{}
+
+	_ = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			// Netboot assets are extracted from the ISO, not disk builds
+			if info.Name() == "netboot" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		kind := diskKind(path)
+		if kind == "" {
+			return nil
+		}
+		if info.ModTime().After(newest[kind]) {
+			newest[kind] = info.ModTime()
+			sizes[kind] = info.Size()
+		}
+		return nil
+	})
+
+	return sizes
+}
+
+// DiskKindForOutput maps a bootc-image-builder output type to its artifact kind
+func DiskKindForOutput(outputType string) string {
+	switch outputType {
+	case "anaconda-iso", "iso":
+		return "iso"
+	case "raw", "ami":
+		return "raw"
+	case "vhd", "azure":
+		return "vhd"
+	case "oci-cloud":
+		return "qcow2"
+	default:
+		return outputType
+	}
+}
+
+func diskKind(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".qcow2":
+		return "qcow2"
+	case ".iso":
+		return "iso"
+	case ".raw", ".img":
+		return "raw"
+	case ".vmdk":
+		return "vmdk"
+	case ".vhd", ".vhdx":
+		return "vhd"
+	default:
+		return ""
+	}
+}
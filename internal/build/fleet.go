@@ -0,0 +1,249 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+)
+
+// Fleet manifest formats rendered by WriteFleetManifests
+const (
+	FleetFormatPlan    = "plan"    // rollout.json: the waves with their start times
+	FleetFormatSystemd = "systemd" // Units and a script that roll devices out by machine-id bucket
+	FleetFormatAirlock = "airlock" // Airlock server config for FleetLock reboot coordination
+)
+
+// FleetFormats lists the supported fleet manifest formats
+func FleetFormats() []string {
+	return []string{FleetFormatPlan, FleetFormatSystemd, FleetFormatAirlock}
+}
+
+// rolloutUnit is the name of the generated device units
+const rolloutUnit = "galena-rollout"
+
+// RolloutPlan is a staged rollout of one digest to a fleet
+type RolloutPlan struct {
+	Channel      string        `json:"channel"`
+	Image        string        `json:"image"` // Repository and digest devices switch to
+	Digest       string        `json:"digest"`
+	Start        time.Time     `json:"start"`
+	Group        string        `json:"group,omitempty"`
+	FleetLockURL string        `json:"fleetlock_url,omitempty"`
+	Slots        int           `json:"slots,omitempty"`
+	Waves        []PlannedWave `json:"waves"`
+}
+
+// PlannedWave is a wave of a rollout plan with its start time
+type PlannedWave struct {
+	Name     string    `json:"name"`
+	Percent  int       `json:"percent"`
+	StartsAt time.Time `json:"starts_at"`
+	Hosts    int       `json:"hosts,omitempty"` // Devices updated once the wave starts, when the fleet size is known
+}
+
+// NewRolloutPlan plans the rollout of image at digest in the configured
+// waves. With hosts above zero every wave also counts its devices.
+func NewRolloutPlan(fleet config.FleetConfig, channel, image, digest string, start time.Time, hosts int) (*RolloutPlan, error) {
+	if len(fleet.Waves) == 0 {
+		return nil, fmt.Errorf("no rollout waves defined under fleet.waves in galena.yaml")
+	}
+	if digest == "" {
+		return nil, fmt.Errorf("a rollout needs a digest")
+	}
+	repository := image
+	if at := strings.Index(repository, "@"); at >= 0 {
+		repository = repository[:at]
+	}
+	if colon := strings.LastIndex(repository, ":"); colon > strings.LastIndex(repository, "/") {
+		repository = repository[:colon]
+	}
+
+	plan := &RolloutPlan{
+		Channel:      channel,
+		Image:        repository + "@" + digest,
+		Digest:       digest,
+		Start:        start.UTC(),
+		Group:        fleet.Group,
+		FleetLockURL: strings.TrimRight(fleet.FleetLockURL, "/"),
+		Slots:        fleet.Slots,
+	}
+	for _, w := range fleet.Waves {
+		delay := time.Duration(0)
+		if w.Delay != "" {
+			d, err := time.ParseDuration(w.Delay)
+			if err != nil {
+				return nil, fmt.Errorf("wave %s: invalid delay: %w", w.Name, err)
+			}
+			delay = d
+		}
+		wave := PlannedWave{Name: w.Name, Percent: w.Percent, StartsAt: plan.Start.Add(delay)}
+		if hosts > 0 {
+			wave.Hosts = (hosts*w.Percent + 99) / 100
+		}
+		plan.Waves = append(plan.Waves, wave)
+	}
+	if last := plan.Waves[len(plan.Waves)-1]; last.Percent != 100 {
+		return nil, fmt.Errorf("the last wave (%s) reaches %d%% of the fleet; it must reach 100%%", last.Name, last.Percent)
+	}
+	return plan, nil
+}
+
+// WriteFleetManifests renders the plan in the given formats into dir and
+// returns the written files
+func WriteFleetManifests(plan *RolloutPlan, formats []string, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	files := map[string]string{}
+	for _, format := range formats {
+		switch format {
+		case FleetFormatPlan:
+			data, err := json.MarshalIndent(plan, "", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("marshaling rollout plan: %w", err)
+			}
+			files["rollout.json"] = string(data) + "\n"
+		case FleetFormatSystemd:
+			files[rolloutUnit+".sh"] = rolloutScript(plan)
+			files[rolloutUnit+".service"] = rolloutService()
+			files[rolloutUnit+".timer"] = rolloutTimer()
+			if plan.FleetLockURL != "" {
+				files[rolloutUnit+"-release.service"] = rolloutReleaseService(plan)
+			}
+		case FleetFormatAirlock:
+			files["airlock.toml"] = airlockConfig(plan)
+		default:
+			return nil, fmt.Errorf("unknown fleet format %q (use %s)", format, strings.Join(FleetFormats(), ", "))
+		}
+	}
+
+	var written []string
+	for _, name := range sortedKeys(files) {
+		path := filepath.Join(dir, name)
+		mode := os.FileMode(0o644)
+		if strings.HasSuffix(name, ".sh") {
+			mode = 0o755
+		}
+		if err := os.WriteFile(path, []byte(files[name]), mode); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// fleetLockRequest returns a curl command for a FleetLock endpoint
+func fleetLockRequest(plan *RolloutPlan, endpoint string) string {
+	body := `{"client_params":{"id":"'"$(cat /etc/machine-id)"'","group":"` + plan.Group + `"}}`
+	return fmt.Sprintf(`curl -fsS -X POST -H 'fleet-lock-protocol: true' -d '%s' %s/v1/%s`, body, plan.FleetLockURL, endpoint)
+}
+
+// rolloutScript decides whether this device is in a started wave: the
+// first 32 bits of the machine-id put every device in a stable bucket
+// from 0 to 99, and a wave covers the buckets below its percentage
+func rolloutScript(plan *RolloutPlan) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Generated by galena-build fleet render; changes are overwritten.\n")
+	fmt.Fprintf(&b, "# Rolls the %s channel out to %s.\n", plan.Channel, plan.Image)
+	b.WriteString("set -eu\n\n")
+	fmt.Fprintf(&b, "IMAGE=%q\n", plan.Image)
+	fmt.Fprintf(&b, "DIGEST=%q\n\n", plan.Digest)
+	b.WriteString("# Nothing to do once the digest is booted or staged\n")
+	b.WriteString("if bootc status --json | grep -q \"$DIGEST\"; then\n\texit 0\nfi\n\n")
+	b.WriteString("bucket=$(( 0x$(cut -c1-8 /etc/machine-id) % 100 ))\n")
+	b.WriteString("now=$(date +%s)\n")
+	b.WriteString("percent=0\n")
+	for _, w := range plan.Waves {
+		fmt.Fprintf(&b, "[ \"$now\" -ge %d ] && percent=%d # %s from %s\n", w.StartsAt.Unix(), w.Percent, w.Name, w.StartsAt.Format(time.RFC3339))
+	}
+	b.WriteString("if [ \"$bucket\" -ge \"$percent\" ]; then\n\texit 0\nfi\n\n")
+	if plan.FleetLockURL != "" {
+		b.WriteString("# Take a reboot slot; try again on the next timer run when none is free\n")
+		b.WriteString(fleetLockRequest(plan, "pre-reboot") + " || exit 0\n")
+	}
+	b.WriteString("exec bootc switch --apply --transport registry \"$IMAGE\"\n")
+	return b.String()
+}
+
+func rolloutService() string {
+	return `# Generated by galena-build fleet render; changes are overwritten
+[Unit]
+Description=Galena staged rollout
+Wants=network-online.target
+After=network-online.target
+ConditionPathExists=/run/ostree-booted
+
+[Service]
+Type=oneshot
+ExecStart=/etc/galena/` + rolloutUnit + `.sh
+`
+}
+
+func rolloutTimer() string {
+	return `# Generated by galena-build fleet render; changes are overwritten
+[Unit]
+Description=Galena staged rollout timer
+
+[Timer]
+OnCalendar=hourly
+RandomizedDelaySec=30m
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+}
+
+// rolloutReleaseService releases the FleetLock slot once the device booted
+func rolloutReleaseService(plan *RolloutPlan) string {
+	// Quote for sh -c and escape $ so systemd leaves the substitution to the shell
+	command := strings.ReplaceAll(fleetLockRequest(plan, "steady-state"), "'", `'\''`)
+	command = strings.ReplaceAll(command, "$", "$$")
+	return `# Generated by galena-build fleet render; changes are overwritten
+[Unit]
+Description=Release the Galena rollout reboot slot
+Wants=network-online.target
+After=network-online.target multi-user.target
+
+[Service]
+Type=oneshot
+ExecStart=/bin/sh -c '` + command + `'
+
+[Install]
+WantedBy=multi-user.target
+`
+}
+
+func airlockConfig(plan *RolloutPlan) string {
+	group := plan.Group
+	if group == "" {
+		group = "default"
+	}
+	slots := plan.Slots
+	if slots <= 0 {
+		slots = 1
+	}
+	return fmt.Sprintf(`# Generated by galena-build fleet render for the %s channel
+[service]
+address = "0.0.0.0"
+port = 3333
+
+[etcd3]
+endpoints = ["http://127.0.0.1:2379"]
+
+[lock]
+default_group_name = %q
+default_slots = %d
+
+[[lock.groups]]
+name = %q
+slots = %d
+`, plan.Channel, group, slots, group, slots)
+}
@@ -0,0 +1,110 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// UnitStatus reports the state of a systemd unit inside the booted container
+type UnitStatus struct {
+	Unit    string
+	Active  string
+	Enabled string
+}
+
+// Healthy reports whether the unit is active and enabled
+func (u UnitStatus) Healthy() bool {
+	return u.Active == "active" && (u.Enabled == "enabled" || u.Enabled == "static" || u.Enabled == "alias")
+}
+
+// HealthcheckOptions configures the post-build service validation stage
+type HealthcheckOptions struct {
+	Units   []string
+	Timeout time.Duration
+}
+
+// Healthcheck boots the image with systemd as PID 1, waits for default.target,
+// and asserts that the configured units are active and enabled.
+func (b *Builder) Healthcheck(ctx context.Context, imageRef string, opts HealthcheckOptions) ([]UnitStatus, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Minute
+	}
+
+	name := fmt.Sprintf("galena-healthcheck-%d", time.Now().UnixNano())
+	b.logger.Info("booting image for healthcheck", "image", imageRef, "container", name)
+
+	start := exec.Podman(ctx, "run", "-d", "--rm",
+		"--name", name,
+		"--systemd=always",
+		imageRef, "/sbin/init",
+	)
+	if start.Err != nil {
+		return nil, fmt.Errorf("starting healthcheck container: %w: %s", start.Err, exec.LastNLines(start.Stderr, 10))
+	}
+	defer func() {
+		if stop := exec.Podman(context.Background(), "rm", "-f", name); stop.Err != nil {
+			b.logger.Warn("could not remove healthcheck container", "container", name, "error", stop.Err)
+		}
+	}()
+
+	if err := b.waitForDefaultTarget(ctx, name, opts.Timeout); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]UnitStatus, 0, len(opts.Units))
+	failed := []string{}
+	for _, unit := range opts.Units {
+		status := UnitStatus{
+			Unit:    unit,
+			Active:  b.systemctlQuery(ctx, name, "is-active", unit),
+			Enabled: b.systemctlQuery(ctx, name, "is-enabled", unit),
+		}
+		statuses = append(statuses, status)
+		if !status.Healthy() {
+			failed = append(failed, fmt.Sprintf("%s (%s/%s)", unit, status.Active, status.Enabled))
+		}
+	}
+
+	if len(failed) > 0 {
+		return statuses, fmt.Errorf("healthcheck failed for units: %s", strings.Join(failed, ", "))
+	}
+
+	b.logger.Info("healthcheck passed", "units", len(statuses))
+	return statuses, nil
+}
+
+// waitForDefaultTarget polls until default.target is reached or the timeout expires
+func (b *Builder) waitForDefaultTarget(ctx context.Context, container string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if b.systemctlQuery(ctx, container, "is-active", "default.target") == "active" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			state := b.systemctlQuery(ctx, container, "is-system-running")
+			failedUnits := exec.Podman(ctx, "exec", container, "systemctl", "--failed", "--no-legend", "--plain")
+			return fmt.Errorf("default.target not reached within %s (system state: %s)\n%s",
+				timeout, state, strings.TrimSpace(failedUnits.Stdout))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// systemctlQuery runs a systemctl query in the container and returns its first output line
+func (b *Builder) systemctlQuery(ctx context.Context, container string, args ...string) string {
+	allArgs := append([]string{"exec", container, "systemctl"}, args...)
+	result := exec.Podman(ctx, allArgs...)
+	value := strings.TrimSpace(strings.SplitN(result.Stdout, "\n", 2)[0])
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,103 @@
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Build stages timed during Builder.Build and recorded in the history
+const (
+	StageBuild       = "build"
+	StageRechunk     = "rechunk"
+	StageHealthcheck = "healthcheck"
+	StageTest        = "test"
+	StagePush        = "push"
+	StageSign        = "sign"
+	StageSBOM        = "sbom"
+	StageProvenance  = "provenance"
+)
+
+// historyFile is relative to the project's state directory
+const historyFile = "build-history.jsonl"
+
+// maxHistoryEntries bounds how many past builds are read back
+const maxHistoryEntries = 200
+
+// HistoryEntry records the timings and size of a completed build
+type HistoryEntry struct {
+	FinishedAt time.Time          `json:"finished_at"`
+	Variant    string             `json:"variant"`
+	Tag        string             `json:"tag"`
+	NoCache    bool               `json:"no_cache,omitempty"`
+	Platforms  []string           `json:"platforms,omitempty"`
+	Duration   float64            `json:"duration_seconds"`
+	Stages     map[string]float64 `json:"stages"`
+	ImageSize  int64              `json:"image_size,omitempty"`
+}
+
+// HistoryPath returns the build history file for a project
+func HistoryPath(rootDir string) string {
+	return filepath.Join(StateDir(rootDir), historyFile)
+}
+
+// AppendHistory appends an entry to the project's build history
+func AppendHistory(rootDir string, entry HistoryEntry) error {
+	migrateState(rootDir, historyFile)
+	path := HistoryPath(rootDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating history directory: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshaling history entry: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	return nil
+}
+
+// LoadHistory reads the most recent build history entries, oldest first.
+// A missing history file yields no entries.
+func LoadHistory(rootDir string) ([]HistoryEntry, error) {
+	migrateState(rootDir, historyFile)
+	f, err := os.Open(HistoryPath(rootDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening history: %w", err)
+	}
+	defer f.Close()
+
+	entries := []HistoryEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip lines from interrupted writes rather than failing the estimate
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,63 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// Hook names, also exported to hook commands as GALENA_HOOK
+const (
+	HookPreBuild  = "pre_build"
+	HookPostBuild = "post_build"
+	HookPostPush  = "post_push"
+)
+
+// hookEnv builds the environment exported to hook commands
+func (b *Builder) hookEnv(hook string, info version.Info, digest string) []string {
+	env := []string{
+		"GALENA_HOOK=" + hook,
+		"GALENA_PROJECT=" + b.cfg.Name,
+		"GALENA_ROOT=" + b.rootDir,
+		"GALENA_VERSION=" + info.Version,
+		"GALENA_IMAGE_REF=" + info.ImageRef,
+		"GALENA_VARIANT=" + info.Variant,
+		"GALENA_TAG=" + info.Tag,
+		"GALENA_FEDORA_VERSION=" + info.FedoraVersion,
+		fmt.Sprintf("GALENA_BUILD_NUMBER=%d", info.BuildNumber),
+		"GALENA_GIT_COMMIT=" + info.GitCommit,
+	}
+	if digest != "" {
+		env = append(env, "GALENA_IMAGE_DIGEST="+digest)
+	}
+	return env
+}
+
+// runHooks runs the commands configured for a hook in order, stopping at the first failure
+func (b *Builder) runHooks(ctx context.Context, hook string, commands []string, info version.Info, digest string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	opts := exec.DefaultOptions()
+	opts.Dir = b.rootDir
+	opts.Env = b.hookEnv(hook, info, digest)
+	opts.StreamStdio = true
+
+	for i, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		b.logger.Info("running hook", "hook", hook, "step", i+1, "command", command)
+		result := exec.Run(ctx, "sh", []string{"-c", command}, opts)
+		if result.Err != nil {
+			return fmt.Errorf("%s hook %q failed (exit %d): %w", hook, command, result.ExitCode, result.Err)
+		}
+	}
+
+	return nil
+}
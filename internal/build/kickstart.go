@@ -0,0 +1,226 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Disk encryption modes
+const (
+	EncryptionLUKS = "luks" // LUKS2 root, unlocked with the passphrase at boot
+	EncryptionTPM2 = "tpm2" // LUKS2 root, unlocked by the TPM; the passphrase is the recovery key
+)
+
+// EncryptionModes returns the supported disk encryption modes
+func EncryptionModes() []string {
+	return []string{EncryptionLUKS, EncryptionTPM2}
+}
+
+// DiskEncryption encrypts the root filesystem of installer ISO installs.
+// bootc-image-builder has no encryption for disk images, so it is applied
+// by the installer's kickstart. The passphrase is never part of the ISO:
+// the installer asks for it, and with tpm2 the TPM is enrolled on first
+// boot after the passphrase unlocks the disk once.
+type DiskEncryption struct {
+	Mode string // luks or tpm2
+}
+
+// Validate checks the mode
+func (e DiskEncryption) Validate() error {
+	if !containsString(EncryptionModes(), e.Mode) {
+		return fmt.Errorf("unknown encryption mode %q (use %s)", e.Mode, strings.Join(EncryptionModes(), " or "))
+	}
+	return nil
+}
+
+// tpm2EnrollScript enrolls the TPM in every LUKS volume. systemd-cryptenroll
+// asks for the passphrase through the boot password agent.
+const tpm2EnrollScript = `#!/bin/sh
+set -e
+for dev in $(lsblk -rpno NAME,FSTYPE | awk '$2 == "crypto_LUKS" { print $1 }'); do
+    systemd-cryptenroll --tpm2-device=auto --tpm2-pcrs=7 "$dev"
+done
+mkdir -p /var/lib/galena
+touch /var/lib/galena/tpm2-enrolled
+`
+
+// tpm2EnrollUnit runs the enrollment once, on the first boot
+const tpm2EnrollUnit = `[Unit]
+Description=Enroll the TPM to unlock the encrypted root filesystem
+ConditionPathExists=!/var/lib/galena/tpm2-enrolled
+After=local-fs.target
+Before=display-manager.service
+
+[Service]
+Type=oneshot
+ExecStart=/bin/sh /etc/galena/tpm2-enroll.sh
+StandardOutput=journal+console
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Kickstart returns the kickstart commands that encrypt the root filesystem.
+// autopart without --passphrase makes the installer ask for it. Without
+// autopart, the user's kickstart partitions the disk and sets --encrypted
+// itself. With tpm2 a %post section installs a first-boot unit that enrolls
+// the TPM and marks every LUKS volume for TPM unlock in crypttab; until it
+// has run, the passphrase unlocks them.
+func (e DiskEncryption) Kickstart(autopart bool) string {
+	var b strings.Builder
+	if autopart {
+		b.WriteString("# Encrypted root filesystem; the installer asks for the passphrase\n")
+		b.WriteString("autopart --encrypted --luks-version=luks2\n")
+	}
+	if e.Mode != EncryptionTPM2 {
+		return b.String()
+	}
+	if autopart {
+		b.WriteString("\n")
+	}
+
+	b.WriteString("%post --erroronfail\n")
+	b.WriteString("# Unlock the root volume with the TPM, bound to the Secure Boot state,\n")
+	b.WriteString("# once the passphrase has unlocked it on first boot\n")
+	b.WriteString("mkdir -p /etc/galena\n")
+	b.WriteString("cat > /etc/galena/tpm2-enroll.sh <<'GALENA_EOF'\n" + tpm2EnrollScript + "GALENA_EOF\n")
+	b.WriteString("cat > /etc/systemd/system/galena-tpm2-enroll.service <<'GALENA_EOF'\n" + tpm2EnrollUnit + "GALENA_EOF\n")
+	b.WriteString("systemctl enable galena-tpm2-enroll.service\n")
+	b.WriteString("awk '$1 ~ /^luks-/ && $4 !~ /tpm2-device/ { $4 = ($4 == \"\" ? \"tpm2-device=auto\" : $4 \",tpm2-device=auto\") } { print }' /etc/crypttab > /etc/crypttab.galena\n")
+	b.WriteString("mv /etc/crypttab.galena /etc/crypttab\n")
+	b.WriteString("%end\n")
+	return b.String()
+}
+
+// partitionCommands are the kickstart commands that lay out the disk
+var partitionCommands = []string{"autopart", "part", "partition", "logvol", "volgroup", "raid", "reqpart"}
+
+// kickstartPartitioning reports whether a kickstart partitions the disk
+// itself and whether that partitioning is encrypted
+func kickstartPartitioning(kickstart string) (partitions, encrypted bool) {
+	for _, line := range strings.Split(kickstart, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !containsString(partitionCommands, fields[0]) {
+			continue
+		}
+		partitions = true
+		if containsString(fields[1:], "--encrypted") {
+			encrypted = true
+		}
+	}
+	return partitions, encrypted
+}
+
+// installerKickstart returns the kickstart of an installer build: the
+// --kickstart file followed by the encryption commands. It is empty when
+// neither is set. Without --kickstart the encryption commands join the
+// kickstart of the disk config, if any. A kickstart that partitions the disk
+// must encrypt it itself, since a second layout would conflict with its own.
+func installerKickstart(opts DiskOptions, configFile string) (string, error) {
+	var parts []string
+	var base string
+	if opts.Kickstart == "" && configFile != "" {
+		if data, err := os.ReadFile(configFile); err == nil && strings.Contains(string(data), "customizations.installer.kickstart") {
+			base = string(data)
+		}
+	}
+	if opts.Kickstart != "" {
+		data, err := os.ReadFile(opts.Kickstart)
+		if err != nil {
+			return "", fmt.Errorf("reading kickstart: %w", err)
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			return "", fmt.Errorf("kickstart %s is empty", opts.Kickstart)
+		}
+		base = string(data)
+		parts = append(parts, strings.TrimRight(base, "\n"))
+	}
+	if opts.Encryption != nil {
+		partitions, encrypted := kickstartPartitioning(base)
+		if partitions && !encrypted {
+			return "", fmt.Errorf("the kickstart partitions the disk itself; add --encrypted to its partitioning instead of using --encrypt %s alone", opts.Encryption.Mode)
+		}
+		if ks := strings.TrimRight(opts.Encryption.Kickstart(!partitions), "\n"); ks != "" {
+			parts = append(parts, ks)
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return strings.Join(parts, "\n\n") + "\n", nil
+}
+
+// kickstartConfig writes a copy of the disk config that embeds the
+// kickstart to dir and returns its path. Without a kickstart in the config
+// it is added as customizations.installer.kickstart. When the config sets
+// one, the kickstart is prepended to it if prepend is set; otherwise the
+// path is empty, since bootc-image-builder accepts only one kickstart.
+func kickstartConfig(dir, configFile, kickstart string, prepend bool) (string, error) {
+	var base string
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return "", fmt.Errorf("reading disk config: %w", err)
+		}
+		base = string(data)
+	}
+
+	var content string
+	if !strings.Contains(base, "customizations.installer.kickstart") {
+		content = strings.TrimRight(base, "\n")
+		if content != "" {
+			content += "\n\n"
+		}
+		content += "[customizations.installer.kickstart]\ncontents = " + tomlString(kickstart) + "\n"
+	} else {
+		if !prepend {
+			return "", nil
+		}
+		// Only multi-line strings can be extended in place
+		const opening = `contents = """`
+		i := strings.Index(base, opening)
+		if i < 0 {
+			return "", fmt.Errorf("the kickstart in %s is not a \"\"\" string, add the encryption commands to it by hand", configFile)
+		}
+		i += len(opening)
+		if strings.HasPrefix(base[i:], "\n") {
+			i++
+		}
+		content = base[:i] + tomlMultilineEscape(kickstart) + "\n" + base[i:]
+	}
+
+	merged := filepath.Join(dir, "config.toml")
+	// bootc-image-builder runs as root, which reads the file regardless of mode
+	if err := os.WriteFile(merged, []byte(content), 0o600); err != nil {
+		return "", fmt.Errorf("writing disk config: %w", err)
+	}
+	return merged, nil
+}
+
+// injectKickstart embeds a kickstart into a finished installer ISO with
+// mkksiso, which adds inst.ks to the boot entries
+func (d *DiskBuilder) injectKickstart(ctx context.Context, iso, kickstart string) error {
+	ks, err := filepath.Abs(kickstart)
+	if err != nil {
+		return err
+	}
+	d.logger.Info("injecting kickstart", "iso", iso, "kickstart", ks)
+	tmp := strings.TrimSuffix(iso, filepath.Ext(iso)) + "-ks.iso"
+	if err := d.runTool(ctx, "mkksiso", "--ks", ks, iso, tmp); err != nil {
+		return err
+	}
+	return d.runTool(ctx, "mv", "-f", tmp, iso)
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// tomlMultilineEscape escapes s for a TOML multi-line basic string
+func tomlMultilineEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
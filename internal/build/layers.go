@@ -0,0 +1,322 @@
+package build
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// LayerInfo describes one filesystem layer of an image
+type LayerInfo struct {
+	Index     int    `json:"index"`
+	CreatedBy string `json:"created_by"`
+	Size      int64  `json:"size"`
+	Files     int    `json:"files"`
+	Wasted    int64  `json:"wasted"` // Bytes added here that later layers overwrite or delete
+}
+
+// WastedFile is a path whose earlier copies are hidden by later layers
+type WastedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`   // Total size of the hidden copies
+	Copies int    `json:"copies"` // Number of hidden copies
+}
+
+// LayerAnalysis is the dive-style breakdown of an image
+type LayerAnalysis struct {
+	Image       string       `json:"image"`
+	Layers      []LayerInfo  `json:"layers"`
+	TotalSize   int64        `json:"total_size"`
+	WastedSize  int64        `json:"wasted_size"`
+	WastedFiles []WastedFile `json:"wasted_files"`
+}
+
+// Efficiency is the share of layer content that is visible in the final image
+func (a *LayerAnalysis) Efficiency() float64 {
+	if a.TotalSize == 0 {
+		return 1
+	}
+	return 1 - float64(a.WastedSize)/float64(a.TotalSize)
+}
+
+// AnalyzeLayers saves a local image to a temporary archive and analyzes its layers
+func (b *Builder) AnalyzeLayers(ctx context.Context, imageRef string) (*LayerAnalysis, error) {
+	tmpDir, err := os.MkdirTemp("", "galena-layers-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, "image.tar")
+	b.logger.Info("saving image for layer analysis", "image", imageRef)
+	if result := b.engine.SaveImage(ctx, imageRef, archive, exec.ArchiveDocker); result.Err != nil {
+		return nil, fmt.Errorf("saving image: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+
+	analysis, err := AnalyzeArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	analysis.Image = imageRef
+	return analysis, nil
+}
+
+// archiveManifest is an entry of manifest.json in a docker archive
+type archiveManifest struct {
+	Config string   `json:"Config"`
+	Layers []string `json:"Layers"`
+}
+
+// imageConfig holds the parts of an image config used for layer analysis
+type imageConfig struct {
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// layerContents is the file listing of a single layer tar
+type layerContents struct {
+	files     map[string]int64
+	whiteouts []string // Paths deleted from lower layers
+	opaques   []string // Directories whose lower contents are hidden
+}
+
+// AnalyzeArchive analyzes the layers of a docker-archive image tarball
+func AnalyzeArchive(archivePath string) (*LayerAnalysis, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening image archive: %w", err)
+	}
+	defer f.Close()
+
+	// The manifest may come after the layers, so find it first
+	var manifests []archiveManifest
+	if err := readArchiveEntry(f, "manifest.json", func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&manifests)
+	}); err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 || len(manifests[0].Layers) == 0 {
+		return nil, fmt.Errorf("image archive has no layers")
+	}
+	manifest := manifests[0]
+
+	var config imageConfig
+	if err := readArchiveEntry(f, manifest.Config, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&config)
+	}); err != nil {
+		return nil, err
+	}
+
+	layerIndex := map[string]int{}
+	for i, l := range manifest.Layers {
+		layerIndex[path.Clean(l)] = i
+	}
+	contents := make([]*layerContents, len(manifest.Layers))
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("reading image archive: %w", err)
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading image archive: %w", err)
+		}
+		i, ok := layerIndex[path.Clean(hdr.Name)]
+		if !ok || contents[i] != nil {
+			continue
+		}
+		if contents[i], err = readLayer(tr); err != nil {
+			return nil, fmt.Errorf("reading layer %s: %w", hdr.Name, err)
+		}
+	}
+	for i, c := range contents {
+		if c == nil {
+			return nil, fmt.Errorf("layer %s missing from image archive", manifest.Layers[i])
+		}
+	}
+
+	createdBy := []string{}
+	for _, h := range config.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, cleanCreatedBy(h.CreatedBy))
+		}
+	}
+
+	analysis := analyzeContents(contents)
+	for i := range analysis.Layers {
+		if i < len(createdBy) {
+			analysis.Layers[i].CreatedBy = createdBy[i]
+		}
+	}
+	return analysis, nil
+}
+
+// readArchiveEntry rewinds the archive and calls fn with the named entry
+func readArchiveEntry(f *os.File, name string, fn func(io.Reader) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("reading image archive: %w", err)
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s missing from image archive", name)
+		}
+		if err != nil {
+			return fmt.Errorf("reading image archive: %w", err)
+		}
+		if path.Clean(hdr.Name) == path.Clean(name) {
+			if err := fn(tr); err != nil {
+				return fmt.Errorf("parsing %s: %w", name, err)
+			}
+			return nil
+		}
+	}
+}
+
+// readLayer lists the files, whiteouts, and opaque directories of a layer tar
+func readLayer(r io.Reader) (*layerContents, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	layer := &layerContents{files: map[string]int64{}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return layer, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			layer.opaques = append(layer.opaques, path.Clean(dir))
+		case strings.HasPrefix(base, ".wh."):
+			layer.whiteouts = append(layer.whiteouts, path.Join(dir, strings.TrimPrefix(base, ".wh.")))
+		case hdr.Typeflag == tar.TypeDir:
+		default:
+			layer.files[name] = hdr.Size
+		}
+	}
+}
+
+// analyzeContents walks the layers bottom-up and attributes hidden files to
+// the layer that added them
+func analyzeContents(contents []*layerContents) *LayerAnalysis {
+	type owner struct {
+		layer int
+		size  int64
+	}
+	live := map[string]owner{}
+	wasted := map[string]*WastedFile{}
+	analysis := &LayerAnalysis{Layers: make([]LayerInfo, len(contents))}
+
+	hide := func(p string, o owner) {
+		if o.size == 0 {
+			return
+		}
+		analysis.Layers[o.layer].Wasted += o.size
+		analysis.WastedSize += o.size
+		w, ok := wasted[p]
+		if !ok {
+			w = &WastedFile{Path: p}
+			wasted[p] = w
+		}
+		w.Size += o.size
+		w.Copies++
+	}
+
+	for i, layer := range contents {
+		// Deletions only apply to lower layers, so handle them before the
+		// files this layer adds
+		if len(layer.whiteouts) > 0 || len(layer.opaques) > 0 {
+			removed := map[string]bool{}
+			for _, p := range layer.whiteouts {
+				removed[p] = true
+			}
+			opaque := map[string]bool{}
+			for _, d := range layer.opaques {
+				opaque[d] = true
+			}
+			for p, o := range live {
+				if removed[p] || underAny(p, removed) || underAny(p, opaque) {
+					hide(p, o)
+					delete(live, p)
+				}
+			}
+		}
+
+		info := &analysis.Layers[i]
+		info.Index = i
+		for p, size := range layer.files {
+			if o, ok := live[p]; ok {
+				hide(p, o)
+			}
+			live[p] = owner{layer: i, size: size}
+			info.Size += size
+			info.Files++
+		}
+		analysis.TotalSize += info.Size
+	}
+
+	for _, w := range wasted {
+		analysis.WastedFiles = append(analysis.WastedFiles, *w)
+	}
+	sort.Slice(analysis.WastedFiles, func(i, j int) bool {
+		if analysis.WastedFiles[i].Size != analysis.WastedFiles[j].Size {
+			return analysis.WastedFiles[i].Size > analysis.WastedFiles[j].Size
+		}
+		return analysis.WastedFiles[i].Path < analysis.WastedFiles[j].Path
+	})
+	return analysis
+}
+
+// underAny reports whether a parent directory of p is in dirs
+func underAny(p string, dirs map[string]bool) bool {
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+		if dir == "/" {
+			return false
+		}
+	}
+}
+
+// cleanCreatedBy strips the shell wrapper from a history entry
+func cleanCreatedBy(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "/bin/sh -c ")
+	s = strings.TrimPrefix(s, "#(nop) ")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,167 @@
+package build
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iiroan/galena/internal/config"
+)
+
+// LicenseCount is the number of packages using a license expression
+type LicenseCount struct {
+	License   string `json:"license"`
+	Packages  int    `json:"packages"`
+	Violation string `json:"violation,omitempty"` // Why the license breaks the policy
+}
+
+// LicenseViolation is a package whose license breaks the license policy
+type LicenseViolation struct {
+	Package string `json:"package"`
+	Version string `json:"version"`
+	Type    string `json:"type"`
+	License string `json:"license"`
+	Reason  string `json:"reason"`
+}
+
+// LicenseReport summarizes the licenses of an SBOM
+type LicenseReport struct {
+	Source     string             `json:"source"`
+	Packages   int                `json:"packages"`
+	Licenses   []LicenseCount     `json:"licenses"`
+	Violations []LicenseViolation `json:"violations"`
+}
+
+// NewLicenseReport counts the licenses of the packages and checks them
+// against the policy. A package complies when one alternative of its
+// license expression uses only licenses that are allowed and not denied.
+func NewLicenseReport(source string, pkgs []SBOMPackage, policy config.LicensePolicy) *LicenseReport {
+	report := &LicenseReport{Source: source, Packages: len(pkgs)}
+
+	counts := map[string]int{}
+	for _, p := range pkgs {
+		counts[p.License]++
+		if reason := licenseViolation(p.License, policy); reason != "" {
+			report.Violations = append(report.Violations, LicenseViolation{
+				Package: p.Name,
+				Version: p.Version,
+				Type:    p.Type,
+				License: p.License,
+				Reason:  reason,
+			})
+		}
+	}
+	for license, n := range counts {
+		report.Licenses = append(report.Licenses, LicenseCount{License: license, Packages: n, Violation: licenseViolation(license, policy)})
+	}
+	sort.Slice(report.Licenses, func(i, j int) bool {
+		if report.Licenses[i].Packages != report.Licenses[j].Packages {
+			return report.Licenses[i].Packages > report.Licenses[j].Packages
+		}
+		return report.Licenses[i].License < report.Licenses[j].License
+	})
+	sort.SliceStable(report.Violations, func(i, j int) bool {
+		return report.Violations[i].Package < report.Violations[j].Package
+	})
+	return report
+}
+
+// licenseViolation returns why a license expression breaks the policy, or
+// an empty string when it complies
+func licenseViolation(expression string, policy config.LicensePolicy) string {
+	if len(policy.Allow) == 0 && len(policy.Deny) == 0 {
+		return ""
+	}
+
+	reason := ""
+	for _, alternative := range licenseAlternatives(expression) {
+		reason = ""
+		for _, id := range alternative {
+			if matchLicense(policy.Deny, id) {
+				reason = id + " is denied"
+				break
+			}
+			if len(policy.Allow) > 0 && !matchLicense(policy.Allow, id) {
+				reason = id + " is not allowed"
+				break
+			}
+		}
+		if reason == "" {
+			return ""
+		}
+	}
+	return reason
+}
+
+// licenseAlternatives splits an SPDX license expression into its OR
+// alternatives, each a list of license IDs that all apply. Exceptions
+// (WITH) and parentheses are dropped.
+func licenseAlternatives(expression string) [][]string {
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expression))
+
+	var alternatives [][]string
+	var current []string
+	for i := 0; i < len(fields); i++ {
+		switch strings.ToUpper(fields[i]) {
+		case "OR":
+			alternatives = append(alternatives, current)
+			current = nil
+		case "AND":
+		case "WITH":
+			i++
+		default:
+			current = append(current, fields[i])
+		}
+	}
+	return append(alternatives, current)
+}
+
+// matchLicense reports whether a license ID matches one of the patterns
+func matchLicense(patterns []string, id string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(id)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CSV renders the license counts as CSV rows
+func (r *LicenseReport) CSV() string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"license", "packages", "violation"})
+	for _, l := range r.Licenses {
+		_ = w.Write([]string{l.License, strconv.Itoa(l.Packages), l.Violation})
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// Markdown renders the license counts and violations as Markdown tables
+func (r *LicenseReport) Markdown() string {
+	var b strings.Builder
+	b.WriteString("## Licenses\n\n")
+	fmt.Fprintf(&b, "%d packages in `%s`.\n\n", r.Packages, r.Source)
+	b.WriteString("| License | Packages | Violation |\n")
+	b.WriteString("|---------|----------|-----------|\n")
+	for _, l := range r.Licenses {
+		fmt.Fprintf(&b, "| %s | %d | %s |\n", l.License, l.Packages, l.Violation)
+	}
+
+	b.WriteString("\n### Violations\n\n")
+	if len(r.Violations) == 0 {
+		b.WriteString("No license policy violations.\n")
+		return b.String()
+	}
+	b.WriteString("| Package | Version | License | Violation |\n")
+	b.WriteString("|---------|---------|---------|-----------|\n")
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", v.Package, v.Version, v.License, v.Reason)
+	}
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval is how often a waiting build checks the lock
+const lockPollInterval = 2 * time.Second
+
+// LockInfo describes the build holding the project lock
+type LockInfo struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+// LockedError is returned when another build holds the project lock
+type LockedError struct {
+	Path string
+	Info LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("another build is running in this project (%s, pid %d on %s since %s); wait for it with --wait",
+		e.Info.Command, e.Info.PID, e.Info.Host, e.Info.Started.Format(time.Kitchen))
+}
+
+// BuildLock is a held project build lock
+type BuildLock struct {
+	file *os.File
+}
+
+// BuildLockPath returns the lock file of a project, kept in its state
+// directory so holding it does not make the working tree dirty
+func BuildLockPath(rootDir string) string {
+	return filepath.Join(StateDir(rootDir), "build.lock")
+}
+
+// AcquireBuildLock takes the build lock of a project, so concurrent builds
+// do not overwrite each other's manifest and tags. The lock is a flock on a
+// file that is never removed, so the kernel releases it when a build
+// crashes and no stale lock is left behind. With wait, it blocks until the
+// lock is free or ctx is done; otherwise it returns a *LockedError.
+func AcquireBuildLock(ctx context.Context, rootDir, command string, wait bool, onWait func(LockInfo)) (*BuildLock, error) {
+	path := BuildLockPath(rootDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+
+	notified := false
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+
+		info := lockHolder(path)
+		if !wait {
+			f.Close()
+			return nil, &LockedError{Path: path, Info: info}
+		}
+		if !notified && onWait != nil {
+			onWait(info)
+			notified = true
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// The holder is recorded only for messages; the flock is the lock
+	host, _ := os.Hostname()
+	data, err := json.Marshal(LockInfo{PID: os.Getpid(), Host: host, Command: command, Started: time.Now()})
+	if err == nil {
+		if err = f.Truncate(0); err == nil {
+			_, err = f.WriteAt(data, 0)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing lock file: %w", err)
+	}
+	return &BuildLock{file: f}, nil
+}
+
+// Release gives up the lock. Only the build holding the lock has its file
+// open, so a release can never drop the lock of another build.
+func (l *BuildLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	_ = l.file.Truncate(0)
+	// Closing the file drops the flock
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return fmt.Errorf("releasing lock file: %w", err)
+	}
+	return nil
+}
+
+// CurrentBuildLock returns the holder of the build lock of a project, or
+// nil when no build holds it
+func CurrentBuildLock(rootDir string) *LockInfo {
+	path := BuildLockPath(rootDir)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return nil
+	}
+	info := lockHolder(path)
+	return &info
+}
+
+// lockHolder reads who holds a lock. A holder that has not written the file
+// yet is reported as unknown.
+func lockHolder(path string) LockInfo {
+	var info LockInfo
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &info) != nil {
+		return LockInfo{Command: "unknown", Host: "unknown"}
+	}
+	return info
+}
@@ -0,0 +1,210 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a git repository with one committed file
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := osexec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Containerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if out, err := gitCmd(dir, args...); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	return dir
+}
+
+func gitCmd(dir string, args ...string) (string, error) {
+	cmd := osexec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestBuildLockKeepsTreeClean(t *testing.T) {
+	dir := gitRepo(t)
+
+	lock, err := AcquireBuildLock(context.Background(), dir, "galena-build build", false, nil)
+	if err != nil {
+		t.Fatalf("AcquireBuildLock: %v", err)
+	}
+	defer lock.Release()
+
+	if !strings.HasPrefix(BuildLockPath(dir), filepath.Join(dir, ".git")+string(filepath.Separator)) {
+		t.Errorf("lock %s is not under the git directory", BuildLockPath(dir))
+	}
+	if _, err := os.Stat(BuildLockPath(dir)); err != nil {
+		t.Fatalf("lock file missing: %v", err)
+	}
+	out, err := gitCmd(dir, GitStatusArgs()...)
+	if err != nil {
+		t.Fatalf("git status: %v: %s", err, out)
+	}
+	if TreeDirty(out) {
+		t.Errorf("tree is dirty while the lock is held:\n%s", out)
+	}
+}
+
+func TestStateDirOutsideGit(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	got := StateDir(dir)
+	if strings.HasPrefix(got, dir) {
+		t.Errorf("StateDir(%s) = %s, inside the project", dir, got)
+	}
+	if got != StateDir(dir) {
+		t.Error("StateDir is not stable")
+	}
+}
+
+func TestGitStatusIgnoresGeneratedFiles(t *testing.T) {
+	dir := gitRepo(t)
+
+	for _, path := range []string{
+		"logs/session.log",
+		".galena/build-history.jsonl",
+		".cache/trivy/db",
+		"output/disk.qcow2",
+		"build-manifest.json",
+		"sbom-nvidia.spdx.json",
+		"provenance.json",
+	} {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := gitCmd(dir, GitStatusArgs()...)
+	if err != nil {
+		t.Fatalf("git status: %v: %s", err, out)
+	}
+	if TreeDirty(out) {
+		t.Fatalf("generated files dirty the tree:\n%s", out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "Containerfile"), []byte("FROM fedora\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = gitCmd(dir, GitStatusArgs()...)
+	if !TreeDirty(out) || !strings.Contains(out, "Containerfile") {
+		t.Fatalf("expected the Containerfile change to be reported, got %q", out)
+	}
+}
+
+func TestGitStatusReportsTrackedGeneratedFiles(t *testing.T) {
+	dir := gitRepo(t)
+
+	// A project may commit files under generated paths, e.g. a placeholder
+	// in output/ or a pinned build-manifest.json
+	for _, path := range []string{"output/.gitkeep", "build-manifest.json"} {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("{}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "generated"},
+	} {
+		if out, err := gitCmd(dir, args...); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "output", "disk.qcow2"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := gitCmd(dir, GitStatusArgs()...)
+	if TreeDirty(out) {
+		t.Fatalf("untracked output dirties the tree:\n%s", out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "build-manifest.json"), []byte(`{"edited":true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = gitCmd(dir, GitStatusArgs()...)
+	if !TreeDirty(out) {
+		t.Fatalf("expected the change to tracked build-manifest.json to be reported, got %q", out)
+	}
+}
+
+func TestBuildLockExcludesSecondBuild(t *testing.T) {
+	dir := gitRepo(t)
+	ctx := context.Background()
+
+	lock, err := AcquireBuildLock(ctx, dir, "galena-build build", false, nil)
+	if err != nil {
+		t.Fatalf("AcquireBuildLock: %v", err)
+	}
+	_, err = AcquireBuildLock(ctx, dir, "galena-build ci build", false, nil)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second AcquireBuildLock = %v, want *LockedError", err)
+	}
+	if locked.Info.PID != os.Getpid() || locked.Info.Command != "galena-build build" {
+		t.Errorf("holder = %+v, want this process running galena-build build", locked.Info)
+	}
+	if CurrentBuildLock(dir) == nil {
+		t.Error("CurrentBuildLock = nil while the lock is held")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if holder := CurrentBuildLock(dir); holder != nil {
+		t.Errorf("CurrentBuildLock = %+v after release", holder)
+	}
+	again, err := AcquireBuildLock(ctx, dir, "galena-build build", false, nil)
+	if err != nil {
+		t.Fatalf("AcquireBuildLock after release: %v", err)
+	}
+	defer again.Release()
+}
+
+func TestBuildLockIgnoresLeftoverFile(t *testing.T) {
+	dir := gitRepo(t)
+
+	// A lock file nobody holds, e.g. left by a crashed build, or one that
+	// was never written
+	for _, content := range []string{`{"pid":1,"host":"other","command":"galena-build build"}`, ""} {
+		if err := os.MkdirAll(filepath.Dir(BuildLockPath(dir)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(BuildLockPath(dir), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if holder := CurrentBuildLock(dir); holder != nil {
+			t.Errorf("CurrentBuildLock = %+v for a file nobody holds", holder)
+		}
+		lock, err := AcquireBuildLock(context.Background(), dir, "galena-build build", false, nil)
+		if err != nil {
+			t.Fatalf("AcquireBuildLock over %q: %v", content, err)
+		}
+		lock.Release()
+	}
+}
@@ -0,0 +1,199 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// DefaultMatrixJobs is the number of variants built concurrently by default
+const DefaultMatrixJobs = 2
+
+// Variant build statuses recorded in the aggregated manifest
+const (
+	VariantStatusSucceeded = "succeeded"
+	VariantStatusFailed    = "failed"
+)
+
+// MatrixOptions configures a multi-variant build
+type MatrixOptions struct {
+	Variants []string
+	Jobs     int
+	Build    BuildOptions
+}
+
+// VariantResult is the outcome of building one variant of a matrix
+type VariantResult struct {
+	Variant  string
+	Manifest *version.BuildManifest
+	Duration time.Duration
+	Err      error
+}
+
+// Status returns the variant status recorded in the manifest
+func (r VariantResult) Status() string {
+	if r.Err != nil {
+		return VariantStatusFailed
+	}
+	return VariantStatusSucceeded
+}
+
+// ParseVariants splits a comma-separated variant list, dropping blanks and duplicates
+func ParseVariants(value string) []string {
+	variants := []string{}
+	seen := map[string]bool{}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+// BuildMatrix builds several variants concurrently with a bounded worker pool.
+// Every variant is attempted; the aggregated manifest records the status of
+// each one and an error is returned if any variant failed.
+func (b *Builder) BuildMatrix(ctx context.Context, opts MatrixOptions) (*version.BuildManifest, []VariantResult, error) {
+	if len(opts.Variants) == 0 {
+		return nil, nil, fmt.Errorf("no variants to build")
+	}
+	for _, variant := range opts.Variants {
+		if _, err := b.cfg.GetVariant(variant); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = DefaultMatrixJobs
+	}
+	if jobs > len(opts.Variants) {
+		jobs = len(opts.Variants)
+	}
+
+	// Concurrent builds would fight over a single progress view
+	if jobs > 1 {
+		opts.Build.Progress = nil
+	}
+
+	// Switch dry-run mode on once for the whole matrix; a variant that
+	// finished first must not switch it off under the others
+	if opts.Build.DryRun && !exec.DryRun() {
+		exec.SetDryRun(true)
+		defer exec.SetDryRun(false)
+	}
+
+	b.logger.Info("starting build matrix", "variants", strings.Join(opts.Variants, ","), "jobs", jobs)
+
+	results := make([]VariantResult, len(opts.Variants))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = b.buildVariant(ctx, opts.Build, opts.Variants[i])
+			}
+		}()
+	}
+	for i := range opts.Variants {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	manifest := b.aggregateManifest(opts, results)
+
+	failed := []string{}
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Variant)
+		}
+	}
+	if len(failed) > 0 {
+		return manifest, results, fmt.Errorf("%d of %d variants failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+
+	b.logger.Info("build matrix completed", "variants", len(results))
+	return manifest, results, nil
+}
+
+// buildVariant runs a single variant build with a variant-scoped logger
+func (b *Builder) buildVariant(ctx context.Context, base BuildOptions, variant string) VariantResult {
+	opts := base
+	opts.Variant = variant
+
+	vb := &Builder{
+		cfg:     b.cfg,
+		rootDir: b.rootDir,
+		logger:  b.logger.With("variant", variant),
+		engine:  b.engine,
+	}
+
+	start := time.Now()
+	manifest, err := vb.Build(ctx, opts)
+	result := VariantResult{
+		Variant:  variant,
+		Manifest: manifest,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if err != nil {
+		vb.logger.Error("variant build failed", "error", err, "duration", result.Duration.Round(time.Second))
+	} else {
+		vb.logger.Info("variant build succeeded", "duration", result.Duration.Round(time.Second))
+	}
+	return result
+}
+
+// aggregateManifest merges per-variant manifests into one
+func (b *Builder) aggregateManifest(opts MatrixOptions, results []VariantResult) *version.BuildManifest {
+	var manifest *version.BuildManifest
+	for _, r := range results {
+		if r.Manifest != nil {
+			manifest = version.NewBuildManifest(b.cfg.Name, r.Manifest.Version)
+			break
+		}
+	}
+	if manifest == nil {
+		manifest = version.NewBuildManifest(b.cfg.Name, version.NewInfo(b.cfg.Build.FedoraVersion, opts.Build.BuildNumber))
+	}
+	// Image-specific fields describe a single variant and do not apply to the aggregate
+	manifest.Version.ImageRef = ""
+	manifest.Version.Variant = ""
+
+	for _, r := range results {
+		if r.Err != nil {
+			manifest.AddFailedImage(b.cfg.Name, opts.Build.Tag, r.Variant, r.Err)
+			continue
+		}
+		if len(r.Manifest.Images) == 0 {
+			// Dry runs produce no image entry; keep the variant status visible
+			manifest.Images = append(manifest.Images, version.Image{
+				Name:    b.cfg.Name,
+				Tag:     r.Manifest.Version.Tag,
+				Variant: r.Variant,
+				Status:  r.Status(),
+			})
+		}
+		for _, image := range r.Manifest.Images {
+			image.Status = r.Status()
+			manifest.Images = append(manifest.Images, image)
+		}
+		manifest.Artifacts = append(manifest.Artifacts, r.Manifest.Artifacts...)
+		manifest.Signatures = append(manifest.Signatures, r.Manifest.Signatures...)
+		if r.Manifest.SBOM != nil {
+			manifest.AddArtifact(r.Manifest.SBOM.Location)
+		}
+	}
+	return manifest
+}
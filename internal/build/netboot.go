@@ -0,0 +1,221 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Paths inside an installer ISO that hold netboot assets, in order of preference
+var (
+	netbootKernelPaths = []string{"images/pxeboot/vmlinuz", "isolinux/vmlinuz", "boot/vmlinuz"}
+	netbootInitrdPaths = []string{"images/pxeboot/initrd.img", "isolinux/initrd.img", "boot/initrd.img"}
+	netbootStage2Paths = []string{"images/install.img", "LiveOS/squashfs.img"}
+)
+
+// NetbootBuilder generates iPXE netboot assets from installer ISOs
+type NetbootBuilder struct {
+	cfg     *config.Config
+	rootDir string
+	logger  *log.Logger
+}
+
+// NetbootOptions configures netboot asset generation
+type NetbootOptions struct {
+	ISOPath    string
+	OutputDir  string   // Directory receiving extracted assets and the iPXE script
+	BaseURL    string   // URL under which OutputDir is reachable (e.g. http://host:8080/netboot)
+	Kickstart  string   // Optional kickstart URL for automated installs
+	KernelArgs []string // Extra kernel arguments
+}
+
+// NetbootResult describes generated netboot assets
+type NetbootResult struct {
+	Kernel     string
+	Initrd     string
+	Stage2     string
+	Script     string
+	Readme     string
+	KernelArgs []string
+}
+
+// NewNetbootBuilder creates a new netboot builder
+func NewNetbootBuilder(cfg *config.Config, rootDir string, logger *log.Logger) *NetbootBuilder {
+	return &NetbootBuilder{
+		cfg:     cfg,
+		rootDir: rootDir,
+		logger:  logger,
+	}
+}
+
+// Generate extracts kernel/initrd from the ISO and writes an iPXE script
+func (n *NetbootBuilder) Generate(ctx context.Context, opts NetbootOptions) (*NetbootResult, error) {
+	if opts.ISOPath == "" {
+		return nil, fmt.Errorf("ISO path is required")
+	}
+	if _, err := os.Stat(opts.ISOPath); err != nil {
+		return nil, fmt.Errorf("ISO not found: %s", opts.ISOPath)
+	}
+	if opts.BaseURL == "" {
+		return nil, fmt.Errorf("base URL is required")
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = filepath.Join(n.rootDir, "output", "netboot")
+	}
+	if err := os.MkdirAll(opts.OutputDir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	n.logger.Info("extracting netboot assets", "iso", opts.ISOPath, "output", opts.OutputDir)
+
+	result := &NetbootResult{}
+	var err error
+	if result.Kernel, err = n.extractFirst(ctx, opts.ISOPath, opts.OutputDir, netbootKernelPaths); err != nil {
+		return nil, fmt.Errorf("extracting kernel: %w", err)
+	}
+	if result.Initrd, err = n.extractFirst(ctx, opts.ISOPath, opts.OutputDir, netbootInitrdPaths); err != nil {
+		return nil, fmt.Errorf("extracting initrd: %w", err)
+	}
+	if result.Stage2, err = n.extractFirst(ctx, opts.ISOPath, opts.OutputDir, netbootStage2Paths); err != nil {
+		n.logger.Warn("no installer stage2 image found; inst.stage2 will not be set", "error", err)
+		result.Stage2 = ""
+	}
+
+	baseURL := strings.TrimRight(opts.BaseURL, "/")
+	result.KernelArgs = NetbootKernelArgs(baseURL, result.Stage2 != "", opts.Kickstart, opts.KernelArgs)
+
+	result.Script = filepath.Join(opts.OutputDir, "boot.ipxe")
+	script := renderIPXEScript(baseURL, result.Kernel, result.Initrd, result.KernelArgs)
+	if err := os.WriteFile(result.Script, []byte(script), 0o644); err != nil {
+		return nil, fmt.Errorf("writing iPXE script: %w", err)
+	}
+
+	result.Readme = filepath.Join(opts.OutputDir, "README.txt")
+	if err := os.WriteFile(result.Readme, []byte(renderNetbootReadme(baseURL, result)), 0o644); err != nil {
+		return nil, fmt.Errorf("writing netboot readme: %w", err)
+	}
+
+	n.logger.Info("netboot assets generated", "script", result.Script)
+	return result, nil
+}
+
+// extractFirst extracts the first candidate path present in the ISO, keeping its relative layout
+func (n *NetbootBuilder) extractFirst(ctx context.Context, isoPath, outputDir string, candidates []string) (string, error) {
+	for _, candidate := range candidates {
+		dest := filepath.Join(outputDir, filepath.FromSlash(candidate))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return "", err
+		}
+		if err := extractFromISO(ctx, isoPath, candidate, dest); err != nil {
+			n.logger.Debug("ISO path not extracted", "path", candidate, "error", err)
+			continue
+		}
+		if info, err := os.Stat(dest); err == nil && info.Size() > 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("none of %s found in ISO", strings.Join(candidates, ", "))
+}
+
+// extractFromISO extracts a single file from an ISO using the first available tool
+func extractFromISO(ctx context.Context, isoPath, member, dest string) error {
+	var result *exec.Result
+	switch {
+	case exec.CheckCommand("xorriso"):
+		result = exec.RunSimple(ctx, "xorriso", "-osirrox", "on", "-indev", isoPath, "-extract", "/"+member, dest)
+	case exec.CheckCommand("bsdtar"):
+		result = exec.RunInDir(ctx, filepath.Dir(dest), "sh", "-c", `bsdtar -xOf "$1" "$2" > "$3"`, "sh", isoPath, member, dest)
+	case exec.CheckCommand("7z"):
+		result = exec.RunSimple(ctx, "7z", "e", "-y", "-o"+filepath.Dir(dest), isoPath, member)
+	default:
+		return fmt.Errorf("no ISO extraction tool found (install xorriso, bsdtar, or 7z)")
+	}
+	if result.Err != nil {
+		_ = os.Remove(dest)
+		return fmt.Errorf("%w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return nil
+}
+
+// NetbootKernelArgs returns the kernel arguments used for network installs
+func NetbootKernelArgs(baseURL string, hasStage2 bool, kickstart string, extra []string) []string {
+	args := []string{"initrd=initrd.img", "ip=dhcp"}
+	if hasStage2 {
+		args = append(args, "inst.stage2="+baseURL)
+	}
+	if kickstart != "" {
+		args = append(args, "inst.ks="+kickstart)
+	}
+	return append(args, extra...)
+}
+
+func renderIPXEScript(baseURL, kernel, initrd string, kernelArgs []string) string {
+	var b strings.Builder
+	b.WriteString("#!ipxe\n")
+	b.WriteString("# Generated by galena-build generate netboot\n\n")
+	b.WriteString("dhcp\n")
+	fmt.Fprintf(&b, "kernel %s/%s %s\n", baseURL, kernel, strings.Join(kernelArgs, " "))
+	fmt.Fprintf(&b, "initrd %s/%s\n", baseURL, initrd)
+	b.WriteString("boot\n")
+	return b.String()
+}
+
+func renderNetbootReadme(baseURL string, result *NetbootResult) string {
+	var b strings.Builder
+	b.WriteString("Galena netboot assets\n")
+	b.WriteString("=====================\n\n")
+	b.WriteString("Serve the output directory (galena-build serve artifacts) and chainload:\n\n")
+	fmt.Fprintf(&b, "  chain %s/%s\n\n", baseURL, filepath.Base(result.Script))
+	b.WriteString("Files:\n")
+	fmt.Fprintf(&b, "  kernel: %s\n", result.Kernel)
+	fmt.Fprintf(&b, "  initrd: %s\n", result.Initrd)
+	if result.Stage2 != "" {
+		fmt.Fprintf(&b, "  stage2: %s\n", result.Stage2)
+	}
+	b.WriteString("\nKernel arguments:\n")
+	fmt.Fprintf(&b, "  %s\n\n", strings.Join(result.KernelArgs, " "))
+	b.WriteString("Useful arguments for automated installs:\n")
+	b.WriteString("  inst.ks=<url>        Kickstart file driving an unattended install\n")
+	b.WriteString("  inst.stage2=<url>    Location of the installer tree (images/install.img)\n")
+	b.WriteString("  ip=dhcp              Configure networking early in the initramfs\n")
+	b.WriteString("  inst.text            Use the text-mode installer\n")
+	b.WriteString("  console=ttyS0,115200 Send installer output to the serial console\n")
+	b.WriteString("  inst.sshd            Start sshd during installation for debugging\n")
+	return b.String()
+}
+
+// FindISO finds the most recent ISO in the output directory
+func (n *NetbootBuilder) FindISO(outputDir string) (string, error) {
+	if outputDir == "" {
+		outputDir = filepath.Join(n.rootDir, "output")
+	}
+
+	var newest string
+	var newestTime int64
+
+	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if filepath.Ext(path) == ".iso" && info.ModTime().Unix() > newestTime {
+			newest = path
+			newestTime = info.ModTime().Unix()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walking output directory: %w", err)
+	}
+
+	if newest == "" {
+		return "", fmt.Errorf("no ISO found in %s", outputDir)
+	}
+
+	return newest, nil
+}
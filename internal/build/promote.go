@@ -0,0 +1,198 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/ref"
+)
+
+// PromoteOptions configures Promote
+type PromoteOptions struct {
+	Image           string  // Repository to promote within, e.g. ghcr.io/acme/galena
+	From            string  // Source channel tag
+	To              string  // Destination channel tag
+	Signer          *Signer // Signs the promoted digest again, annotated with the channel; nil skips signing
+	AllowDirty      bool    // Promote images built from a dirty working tree
+	ChannelManifest string  // Channel manifest to update; none when empty
+	DryRun          bool
+}
+
+// Promotion is the result of promoting an image between channels
+type Promotion struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Digest      string    `json:"digest"`
+	Signed      bool      `json:"signed"`
+	PromotedAt  time.Time `json:"promoted_at"`
+}
+
+// ChannelEntry is the image a channel currently points to
+type ChannelEntry struct {
+	Image      string    `json:"image"`
+	Digest     string    `json:"digest"`
+	From       string    `json:"from,omitempty"` // Channel the digest was promoted from
+	PromotedAt time.Time `json:"promoted_at"`
+}
+
+// ChannelManifest maps channel tags to the digests they point to
+type ChannelManifest struct {
+	Channels map[string]ChannelEntry `json:"channels"`
+}
+
+// Promote points a channel tag at the digest another channel tag points to.
+// The digest is copied within the registry with skopeo, so the promoted image
+// is byte-for-byte the one that was tested instead of a rebuild.
+func Promote(ctx context.Context, opts PromoteOptions) (*Promotion, error) {
+	if opts.From == "" || opts.To == "" {
+		return nil, fmt.Errorf("both --from and --to channels are required")
+	}
+	if opts.From == opts.To {
+		return nil, fmt.Errorf("cannot promote %s to itself", opts.From)
+	}
+	if err := exec.RequireCommands("skopeo"); err != nil {
+		return nil, err
+	}
+
+	r, err := ref.Parse(opts.Image)
+	if err != nil {
+		return nil, err
+	}
+	r = r.Normalized()
+	if !r.IsQualified() || r.Registry == "localhost" {
+		return nil, fmt.Errorf("%s is not a registry image; push it before promoting", r.Name())
+	}
+	source := r.WithTag(opts.From)
+	dest := r.WithTag(opts.To)
+	if err := dest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid channel %q: %w", opts.To, err)
+	}
+
+	digest, err := ResolveDigest(ctx, source.String())
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", source, err)
+	}
+	// Copy by digest so a push to the source channel during promotion is not picked up
+	pinned := r.WithTag("")
+	pinned.Digest = digest
+
+	labels, err := remoteLabels(ctx, pinned.String())
+	if err != nil {
+		return nil, fmt.Errorf("inspecting %s: %w", source, err)
+	}
+	if labels["io.galena.git.dirty"] == "true" && !opts.AllowDirty {
+		return nil, fmt.Errorf("%s was built from a dirty working tree; rebuild from a clean commit or pass --allow-dirty", source)
+	}
+
+	promotion := &Promotion{
+		Source:      source.String(),
+		Destination: dest.String(),
+		Digest:      digest,
+		PromotedAt:  time.Now().UTC(),
+	}
+	if opts.DryRun {
+		return promotion, nil
+	}
+
+	authFile, cleanup, err := storeAuthFile(ctx, pinned.String())
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args := []string{"copy", "--all", "--preserve-digests"}
+	args = append(args, registryFlags("src-", authFile, nil)...)
+	args = append(args, registryFlags("dest-", authFile, nil)...)
+	result := exec.Skopeo(ctx, append(args, "docker://"+pinned.String(), "docker://"+dest.String())...)
+	if result.Err != nil {
+		return nil, fmt.Errorf("copying %s to %s: %w: %s", source, dest, result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+
+	promoted, err := ResolveDigest(ctx, dest.String())
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", dest, err)
+	}
+	if promoted != digest {
+		return nil, fmt.Errorf("%s points to %s after promotion, expected %s", dest, promoted, digest)
+	}
+
+	if opts.Signer != nil {
+		if err := opts.Signer.Sign(ctx, pinned.String(), map[string]string{"io.galena.channel": opts.To}); err != nil {
+			return promotion, fmt.Errorf("signing %s: %w", dest, err)
+		}
+		promotion.Signed = true
+	}
+
+	if opts.ChannelManifest != "" {
+		if err := updateChannelManifest(opts.ChannelManifest, r.Name(), opts.From, opts.To, promotion); err != nil {
+			return promotion, err
+		}
+	}
+
+	return promotion, nil
+}
+
+// remoteLabels returns the labels of a registry image
+func remoteLabels(ctx context.Context, imageRef string) (map[string]string, error) {
+	authFile, cleanup, err := storeAuthFile(ctx, imageRef)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args := append([]string{"inspect", "--format", "{{json .Labels}}"}, registryFlags("", authFile, nil)...)
+	result := exec.Skopeo(ctx, append(args, "docker://"+imageRef)...)
+	if result.Err != nil {
+		return nil, fmt.Errorf("%w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	labels := map[string]string{}
+	if out := strings.TrimSpace(result.Stdout); out != "" && out != "null" {
+		if err := json.Unmarshal([]byte(out), &labels); err != nil {
+			return nil, fmt.Errorf("parsing labels: %w", err)
+		}
+	}
+	return labels, nil
+}
+
+// loadChannelManifest reads a channel manifest; a missing file is empty
+func loadChannelManifest(path string) (*ChannelManifest, error) {
+	m := &ChannelManifest{Channels: map[string]ChannelEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading channel manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing channel manifest: %w", err)
+	}
+	if m.Channels == nil {
+		m.Channels = map[string]ChannelEntry{}
+	}
+	return m, nil
+}
+
+func updateChannelManifest(path, image, from, to string, p *Promotion) error {
+	m, err := loadChannelManifest(path)
+	if err != nil {
+		return err
+	}
+	m.Channels[to] = ChannelEntry{
+		Image:      image,
+		Digest:     p.Digest,
+		From:       from,
+		PromotedAt: p.PromotedAt,
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling channel manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing channel manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/ci"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// SLSA provenance identifiers
+const (
+	ProvenancePredicateType = "https://slsa.dev/provenance/v1"
+	ProvenanceBuildType     = "https://github.com/iiroan/galena/build/v1"
+	provenanceCosignType    = "slsaprovenance1"
+	localBuilderID          = "https://github.com/iiroan/galena/local"
+)
+
+// Provenance is an SLSA v1 provenance predicate
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of a build
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]any       `json:"externalParameters"`
+	InternalParameters   map[string]any       `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies"`
+}
+
+// ResourceDescriptor identifies a build material by URI and digest
+type ResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+	Name   string            `json:"name,omitempty"`
+}
+
+// RunDetails describes the builder that ran a build
+type RunDetails struct {
+	Builder  ProvenanceBuilder  `json:"builder"`
+	Metadata ProvenanceMetadata `json:"metadata"`
+}
+
+// ProvenanceBuilder identifies the build platform
+type ProvenanceBuilder struct {
+	ID string `json:"id"`
+}
+
+// ProvenanceMetadata holds invocation details
+type ProvenanceMetadata struct {
+	InvocationID string    `json:"invocationId,omitempty"`
+	StartedOn    time.Time `json:"startedOn"`
+	FinishedOn   time.Time `json:"finishedOn"`
+}
+
+// ProvenanceInput is the build information recorded in provenance
+type ProvenanceInput struct {
+	Image      string
+	Variant    string
+	Tag        string
+	Ref        string
+	BuildArgs  map[string]string
+	Platforms  []string
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+// NewProvenance builds the SLSA provenance of a build. The builder and
+// invocation come from the CI environment; local builds use a generic
+// builder ID so consumers can tell them apart.
+func (b *Builder) NewProvenance(ctx context.Context, in ProvenanceInput) *Provenance {
+	env := ci.Detect()
+
+	source := b.sourceURI(ctx, env)
+	ref := in.Ref
+	if env.Ref != "" {
+		ref = env.Ref
+	}
+	external := map[string]any{
+		"source":  source,
+		"ref":     ref,
+		"variant": in.Variant,
+		"tag":     in.Tag,
+		"image":   in.Image,
+	}
+	if len(in.Platforms) > 0 {
+		external["platforms"] = in.Platforms
+	}
+	internal := map[string]any{}
+	if len(in.BuildArgs) > 0 {
+		internal["buildArgs"] = in.BuildArgs
+	}
+
+	deps := []ResourceDescriptor{}
+	if commit := b.sourceCommit(ctx, env); source != "" && commit != "" {
+		deps = append(deps, ResourceDescriptor{URI: source, Digest: map[string]string{"gitCommit": commit}})
+	}
+	if d := imageDescriptor("base_image", b.cfg.Build.BaseImage, b.cfg.Build.BaseImageDigest); d != nil {
+		deps = append(deps, *d)
+	}
+	for _, name := range sortedKeys(b.cfg.Dependencies) {
+		dep := b.cfg.Dependencies[name]
+		if d := imageDescriptor(name, dep.Image, dep.Digest); d != nil {
+			deps = append(deps, *d)
+		}
+	}
+
+	builderID := localBuilderID
+	invocation := ""
+	if env.Provider != "" {
+		if env.WorkflowRef != "" {
+			builderID = env.ServerURL + "/" + env.WorkflowRef
+		}
+		invocation = env.RunURL()
+	}
+
+	return &Provenance{
+		BuildDefinition: BuildDefinition{
+			BuildType:            ProvenanceBuildType,
+			ExternalParameters:   external,
+			InternalParameters:   internal,
+			ResolvedDependencies: deps,
+		},
+		RunDetails: RunDetails{
+			Builder: ProvenanceBuilder{ID: builderID},
+			Metadata: ProvenanceMetadata{
+				InvocationID: invocation,
+				StartedOn:    in.StartedOn.UTC(),
+				FinishedOn:   in.FinishedOn.UTC(),
+			},
+		},
+	}
+}
+
+// sourceURI returns the git+ URI of the source repository
+func (b *Builder) sourceURI(ctx context.Context, env *ci.Environment) string {
+	if env.Provider != "" && env.Repository != "" {
+		return "git+" + env.ServerURL + "/" + env.Repository
+	}
+	result := exec.Git(ctx, b.rootDir, "remote", "get-url", "origin")
+	if result.Err != nil {
+		return ""
+	}
+	url := strings.TrimSpace(result.Stdout)
+	// Rewrite scp-style remotes (git@host:owner/repo) to https
+	if rest, ok := strings.CutPrefix(url, "git@"); ok {
+		url = "https://" + strings.Replace(rest, ":", "/", 1)
+	}
+	return "git+" + strings.TrimSuffix(url, ".git")
+}
+
+// sourceCommit returns the full commit hash the build ran from
+func (b *Builder) sourceCommit(ctx context.Context, env *ci.Environment) string {
+	if env.SHA != "" {
+		return env.SHA
+	}
+	result := exec.Git(ctx, b.rootDir, "rev-parse", "HEAD")
+	if result.Err != nil {
+		return ""
+	}
+	return strings.TrimSpace(result.Stdout)
+}
+
+// imageDescriptor describes a digest-pinned image; unpinned images are skipped
+func imageDescriptor(name, image, digest string) *ResourceDescriptor {
+	if at := strings.Index(image, "@"); at >= 0 {
+		image, digest = image[:at], image[at+1:]
+	}
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if image == "" || !ok {
+		return nil
+	}
+	return &ResourceDescriptor{
+		URI:    "pkg:docker/" + image,
+		Digest: map[string]string{algorithm: hex},
+		Name:   name,
+	}
+}
+
+// Save writes the provenance predicate as JSON
+func (p *Provenance) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling provenance: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing provenance: %w", err)
+	}
+	return nil
+}
+
+// ProvenancePath returns where the provenance of a variant is written
+func (b *Builder) ProvenancePath(variant string) string {
+	name := "provenance.json"
+	if variant != "" && variant != "main" {
+		name = "provenance-" + variant + ".json"
+	}
+	return filepath.Join(b.rootDir, name)
+}
+
+// AttestProvenance writes the provenance of a pushed image and attaches it
+// as a signed in-toto attestation
+func (b *Builder) AttestProvenance(ctx context.Context, imageRef, path string, p *Provenance) error {
+	if err := p.Save(path); err != nil {
+		return err
+	}
+	b.logger.Info("attesting provenance", "image", imageRef, "predicate", ProvenancePredicateType)
+	return NewSigner(b.rootDir, b.cfg.Signing).Attest(ctx, imageRef, path, provenanceCosignType)
+}
+
+// buildArgMap extracts the --build-arg values of an engine command line
+func buildArgMap(args []string) map[string]string {
+	values := map[string]string{}
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--build-arg" {
+			if k, v, ok := strings.Cut(args[i+1], "="); ok {
+				values[k] = v
+			}
+			i++
+		}
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// RetentionPolicy selects which local image tags to keep for each variant
+type RetentionPolicy struct {
+	KeepLast int           // Newest tags kept per variant (0: no count limit)
+	MaxAge   time.Duration // Tags older than this are removed (0: no age limit)
+}
+
+// NewRetentionPolicy converts a configured clean policy
+func NewRetentionPolicy(p config.CleanPolicy) (RetentionPolicy, error) {
+	policy := RetentionPolicy{KeepLast: p.KeepLast}
+	if p.MaxAge != "" {
+		maxAge, err := time.ParseDuration(p.MaxAge)
+		if err != nil {
+			return policy, fmt.Errorf("parsing max age: %w", err)
+		}
+		policy.MaxAge = maxAge
+	}
+	return policy, nil
+}
+
+// Enabled reports whether the policy limits anything
+func (p RetentionPolicy) Enabled() bool {
+	return p.KeepLast > 0 || p.MaxAge > 0
+}
+
+// PrunableImages lists the local image tags the policy would remove. Tags are
+// grouped per variant repository and the newest tag of each variant is kept.
+func (b *Builder) PrunableImages(ctx context.Context, policy RetentionPolicy) ([]exec.LocalImage, error) {
+	images, err := b.engine.ListImagesCreated(ctx, fmt.Sprintf("*%s*", b.cfg.Name))
+	if err != nil {
+		return nil, err
+	}
+	return selectPrunable(images, policy, time.Now()), nil
+}
+
+func selectPrunable(images []exec.LocalImage, policy RetentionPolicy, now time.Time) []exec.LocalImage {
+	byRepo := map[string][]exec.LocalImage{}
+	for _, img := range images {
+		repo := img.Name
+		if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+			repo = repo[:i]
+		}
+		byRepo[repo] = append(byRepo[repo], img)
+	}
+
+	prunable := []exec.LocalImage{}
+	for _, repo := range sortedKeys(byRepo) {
+		tags := byRepo[repo]
+		sort.SliceStable(tags, func(i, j int) bool {
+			return tags[i].Created.After(tags[j].Created)
+		})
+		for i, img := range tags {
+			if i == 0 {
+				continue
+			}
+			overCount := policy.KeepLast > 0 && i >= policy.KeepLast
+			overAge := policy.MaxAge > 0 && now.Sub(img.Created) > policy.MaxAge
+			if overCount || overAge {
+				prunable = append(prunable, img)
+			}
+		}
+	}
+	return prunable
+}
+
+// PruneDangling removes untagged images and their layers
+func (b *Builder) PruneDangling(ctx context.Context) error {
+	result := b.engine.PruneDangling(ctx)
+	if result.Err != nil {
+		return fmt.Errorf("pruning dangling images: %s", exec.LastNLines(result.Stderr, 5))
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/secrets"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// Push statuses recorded in the build manifest
+const (
+	PushStatusPushed = "pushed"
+	PushStatusFailed = "failed"
+)
+
+// defaultPushRetries is the number of retries of a mirror copy
+const defaultPushRetries = 3
+
+// PushAll pushes an image to its registry and copies it to every mirror,
+// each destination with its own retries. Mirrors are copied from local
+// storage in parallel, so a failing registry does not hold up the others.
+// It returns one result per destination and an error if any of them failed.
+func (b *Builder) PushAll(ctx context.Context, imageRef string, multiArch bool, mirrors []config.RegistryConfig) ([]version.Push, error) {
+	if len(mirrors) > 0 && !multiArch {
+		if err := exec.RequireCommands("skopeo"); err != nil {
+			return nil, err
+		}
+	}
+
+	pushes := make([]version.Push, len(mirrors)+1)
+	var wg sync.WaitGroup
+	wg.Add(len(pushes))
+	go func() {
+		defer wg.Done()
+		pushes[0] = b.pushPrimary(ctx, imageRef, multiArch)
+	}()
+	for i, mirror := range mirrors {
+		go func() {
+			defer wg.Done()
+			pushes[i+1] = b.pushMirror(ctx, imageRef, multiArch, mirror)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, p := range pushes {
+		if p.Status == PushStatusFailed {
+			failed = append(failed, p.Registry)
+		}
+	}
+	if len(failed) > 0 {
+		return pushes, fmt.Errorf("push to %s failed", strings.Join(failed, ", "))
+	}
+	return pushes, nil
+}
+
+// pushPrimary pushes an image to the registry in its reference
+func (b *Builder) pushPrimary(ctx context.Context, imageRef string, multiArch bool) version.Push {
+	registry, _, _ := strings.Cut(imageRef, "/")
+	// The engine push retries transient failures under the retry policy
+	return b.retryPush(ctx, registry, imageRef, 0, func() (string, error) {
+		if multiArch {
+			return "", b.pushManifestList(ctx, imageRef)
+		}
+		return "", b.push(ctx, imageRef)
+	})
+}
+
+// pushMirror copies an image from local storage to a mirror registry
+func (b *Builder) pushMirror(ctx context.Context, imageRef string, multiArch bool, mirror config.RegistryConfig) version.Push {
+	dest := MirrorRef(mirror.Repository, imageRef)
+	retries := mirror.Retries
+	if retries == 0 {
+		retries = defaultPushRetries
+	}
+
+	creds, authFile, err := b.registryAuth(ctx, mirror)
+	if err != nil {
+		return version.Push{Registry: mirror.Name, Image: dest, Status: PushStatusFailed, Error: err.Error()}
+	}
+	if creds != "" {
+		path, cleanup, err := exec.AuthFile(map[string]string{secrets.RegistryOf(dest): creds})
+		if err != nil {
+			return version.Push{Registry: mirror.Name, Image: dest, Status: PushStatusFailed, Error: err.Error()}
+		}
+		defer cleanup()
+		authFile = path
+	}
+
+	return b.retryPush(ctx, mirror.Name, dest, retries, func() (string, error) {
+		digestFile, err := os.CreateTemp("", "galena-digest-")
+		if err != nil {
+			return "", fmt.Errorf("creating digest file: %w", err)
+		}
+		digestFile.Close()
+		defer os.Remove(digestFile.Name())
+
+		var result *exec.Result
+		if multiArch {
+			args := []string{"manifest", "push", "--all", "--digestfile", digestFile.Name()}
+			args = append(args, registryFlags("", authFile, mirror.TLSVerify)...)
+			result = exec.Podman(ctx, append(args, imageRef, "docker://"+dest)...)
+		} else {
+			args := []string{"copy", "--digestfile", digestFile.Name()}
+			args = append(args, registryFlags("dest-", authFile, mirror.TLSVerify)...)
+			result = exec.RunSimple(ctx, "skopeo", append(args, b.localImage(imageRef), "docker://"+dest)...)
+		}
+		if result.Err != nil {
+			return "", fmt.Errorf("%w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+		}
+
+		digest, _ := os.ReadFile(digestFile.Name())
+		return strings.TrimSpace(string(digest)), nil
+	})
+}
+
+// retryPush runs push until it succeeds or the retries are used up, backing
+// off like the retry policy between attempts
+func (b *Builder) retryPush(ctx context.Context, registry, dest string, retries int, push func() (string, error)) version.Push {
+	result := version.Push{Registry: registry, Image: dest}
+	policy := exec.CurrentRetryPolicy()
+	for {
+		result.Attempts++
+		digest, err := push()
+		if err == nil {
+			result.Status = PushStatusPushed
+			result.Digest = digest
+			b.logger.Info("image pushed", "registry", registry, "image", dest)
+			return result
+		}
+		if result.Attempts > retries || ctx.Err() != nil {
+			result.Status = PushStatusFailed
+			result.Error = err.Error()
+			b.logger.Error("push failed", "registry", registry, "image", dest, "attempts", result.Attempts, "error", err)
+			return result
+		}
+
+		delay := policy.Backoff(result.Attempts)
+		b.logger.Warn("push failed, retrying", "registry", registry, "attempt", result.Attempts, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
+
+// registryAuth resolves the credentials of a mirror: its own environment
+// variables or auth file, or else the credentials of its registry host
+func (b *Builder) registryAuth(ctx context.Context, mirror config.RegistryConfig) (creds, authFile string, err error) {
+	if mirror.UsernameEnv != "" {
+		user, pass := os.Getenv(mirror.UsernameEnv), os.Getenv(mirror.PasswordEnv)
+		if user == "" || pass == "" {
+			return "", "", fmt.Errorf("credentials for %s not set: export %s and %s", mirror.Name, mirror.UsernameEnv, mirror.PasswordEnv)
+		}
+		exec.RegisterSecret(pass)
+		creds = user + ":" + pass
+	}
+	if mirror.AuthFile != "" {
+		authFile = mirror.AuthFile
+		if !filepath.IsAbs(authFile) {
+			authFile = filepath.Join(b.rootDir, authFile)
+		}
+	}
+	if creds == "" && authFile == "" {
+		cred, ok, err := secrets.LookupImage(ctx, mirror.Repository)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			creds = cred.Creds()
+		}
+	}
+	return creds, authFile, nil
+}
+
+// storeAuthFile writes the configured credentials of the registries of
+// images to a temporary auth file. It returns an empty path when none of
+// them has credentials; the returned function removes the file.
+func storeAuthFile(ctx context.Context, images ...string) (string, func(), error) {
+	auths := map[string]string{}
+	for _, image := range images {
+		cred, ok, err := secrets.LookupImage(ctx, image)
+		if err != nil {
+			return "", nil, err
+		}
+		if ok {
+			auths[secrets.RegistryOf(image)] = cred.Creds()
+		}
+	}
+	if len(auths) == 0 {
+		return "", func() {}, nil
+	}
+	return exec.AuthFile(auths)
+}
+
+// engineCreds returns the configured credentials of the registry of an
+// image for the engine push, which hands them over in an auth file. docker
+// has no such flag and keeps using docker login.
+func (b *Builder) engineCreds(ctx context.Context, imageRef string) (string, error) {
+	cred, ok, err := secrets.LookupImage(ctx, imageRef)
+	if err != nil || !ok {
+		return "", err
+	}
+	if b.engine.Name() == exec.EngineDocker {
+		b.logger.Warn("docker pushes with its own login; credentials from galena.yaml are not used", "registry", cred.Registry)
+		return "", nil
+	}
+	return cred.Creds(), nil
+}
+
+// registryFlags returns the auth file and TLS flags of podman or skopeo.
+// skopeo prefixes the destination flags with "dest-".
+func registryFlags(prefix, authFile string, tlsVerify *bool) []string {
+	var flags []string
+	if authFile != "" {
+		flags = append(flags, "--"+prefix+"authfile", authFile)
+	}
+	if tlsVerify != nil && !*tlsVerify {
+		flags = append(flags, "--"+prefix+"tls-verify=false")
+	}
+	return flags
+}
+
+// localImage returns the skopeo reference of an image in the engine's local storage
+func (b *Builder) localImage(imageRef string) string {
+	if b.engine.Name() == exec.EngineDocker {
+		return "docker-daemon:" + imageRef
+	}
+	return "containers-storage:" + imageRef
+}
+
+// MirrorRef returns the reference of an image in a mirror repository, keeping
+// its name and tag
+func MirrorRef(repository, imageRef string) string {
+	name := imageRef[strings.LastIndex(imageRef, "/")+1:]
+	return strings.TrimSuffix(repository, "/") + "/" + name
+}
@@ -0,0 +1,95 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// DefaultRechunkMaxLayers matches the layer budget used by the bootc base images
+const DefaultRechunkMaxLayers = 67
+
+// RechunkOptions configures the OSTree rechunk stage
+type RechunkOptions struct {
+	// ToolImage provides bootc-base-imagectl; defaults to the Fedora bootc base
+	ToolImage string
+	MaxLayers int
+}
+
+// Rechunk rewrites a local image into an OSTree-optimized layer layout so
+// that updates only download the packages that changed. The image is
+// rechunked in place under the same reference and the new digest is returned.
+func (b *Builder) Rechunk(ctx context.Context, imageRef string, opts RechunkOptions) (string, error) {
+	if opts.ToolImage == "" {
+		opts.ToolImage = fmt.Sprintf("quay.io/fedora/fedora-bootc:%s", b.cfg.Build.FedoraVersion)
+	}
+	if opts.MaxLayers <= 0 {
+		opts.MaxLayers = DefaultRechunkMaxLayers
+	}
+
+	storage, err := b.containerStorageRoot(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Build references always carry a tag, so the suffix yields a sibling tag
+	tmpRef := imageRef + "-rechunk"
+
+	b.logger.Info("rechunking image",
+		"image", imageRef,
+		"tool", opts.ToolImage,
+		"max_layers", opts.MaxLayers,
+	)
+
+	runOpts := exec.DefaultOptions()
+	runOpts.StreamStdio = true
+	result := exec.Run(ctx, "podman", []string{
+		"run", "--rm", "--privileged",
+		"--security-opt", "label=disable",
+		"-v", storage + ":/var/lib/containers/storage",
+		opts.ToolImage,
+		"/usr/libexec/bootc-base-imagectl", "rechunk",
+		"--max-layers", strconv.Itoa(opts.MaxLayers),
+		imageRef, tmpRef,
+	}, runOpts)
+	if result.Err != nil {
+		b.logger.Error("rechunk failed",
+			"exit_code", result.ExitCode,
+			"stderr", exec.LastNLines(result.Stderr, 20),
+		)
+		return "", fmt.Errorf("rechunking %s: %w", imageRef, result.Err)
+	}
+
+	// Move the original reference onto the rechunked image
+	if tag := exec.Podman(ctx, "tag", tmpRef, imageRef); tag.Err != nil {
+		return "", fmt.Errorf("tagging rechunked image: %w: %s", tag.Err, exec.LastNLines(tag.Stderr, 5))
+	}
+	if rm := exec.Podman(ctx, "rmi", tmpRef); rm.Err != nil {
+		b.logger.Warn("could not remove temporary rechunk tag", "image", tmpRef, "error", rm.Err)
+	}
+
+	digest, err := b.getImageDigest(ctx, imageRef)
+	if err != nil {
+		return "", fmt.Errorf("reading rechunked digest: %w", err)
+	}
+
+	b.logger.Info("rechunk complete", "image", imageRef, "digest", digest)
+	return digest, nil
+}
+
+// containerStorageRoot returns the graph root of the active podman storage so
+// the rechunk container operates on the same images as the host
+func (b *Builder) containerStorageRoot(ctx context.Context) (string, error) {
+	result := exec.Podman(ctx, "info", "--format", "{{.Store.GraphRoot}}")
+	if result.Err != nil {
+		return "", fmt.Errorf("reading podman storage root: %w", result.Err)
+	}
+	root := strings.TrimSpace(result.Stdout)
+	if root == "" {
+		return "", fmt.Errorf("podman reported an empty storage root")
+	}
+	return root, nil
+}
@@ -0,0 +1,108 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/secrets"
+)
+
+// SBOMReferrer is an SBOM attached to an image as an OCI 1.1 referrer
+type SBOMReferrer struct {
+	Image        string `json:"image"`
+	SBOM         string `json:"sbom"`
+	ArtifactType string `json:"artifact_type"`
+	Digest       string `json:"digest,omitempty"` // Digest of the referrer manifest, when reported
+	Tool         string `json:"tool"`
+}
+
+// SBOMMediaType returns the media type of an SBOM format
+func SBOMMediaType(format string) string {
+	if format == SBOMFormatCycloneDX {
+		return "application/vnd.cyclonedx+json"
+	}
+	return "application/spdx+json"
+}
+
+// DetectSBOMFormat returns the format of an SPDX or CycloneDX JSON SBOM
+func DetectSBOMFormat(data []byte) (string, error) {
+	var doc sbomDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("parsing SBOM: %w", err)
+	}
+	switch {
+	case doc.SPDXVersion != "":
+		return SBOMFormatSPDX, nil
+	case doc.BOMFormat == "CycloneDX":
+		return SBOMFormatCycloneDX, nil
+	}
+	return "", fmt.Errorf("unsupported SBOM: expected SPDX or CycloneDX JSON")
+}
+
+// AttachSBOMReferrer attaches an SBOM to an image as an OCI 1.1 referrer,
+// so registries that list referrers show it next to the image. oras is
+// used when installed, otherwise cosign's experimental referrers mode.
+func AttachSBOMReferrer(ctx context.Context, imageRef, path string) (*SBOMReferrer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading SBOM: %w", err)
+	}
+	format, err := DetectSBOMFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	referrer := &SBOMReferrer{Image: imageRef, SBOM: path, ArtifactType: SBOMMediaType(format)}
+
+	if exec.CheckCommand("oras") {
+		referrer.Tool = "oras"
+		// oras rejects absolute paths, so run next to the file
+		opts := exec.DefaultOptions()
+		opts.Dir = filepath.Dir(path)
+		args := []string{"attach", "--artifact-type", referrer.ArtifactType}
+		cred, ok, err := secrets.LookupImage(ctx, imageRef)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			args = append(args, "--username", cred.Username, "--password-stdin")
+			opts.Stdin = strings.NewReader(cred.Password)
+		}
+		args = append(args, imageRef, filepath.Base(path)+":"+referrer.ArtifactType)
+		result := exec.Run(ctx, "oras", args, opts)
+		if result.Err != nil {
+			return nil, fmt.Errorf("oras attach: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+		}
+		for _, line := range strings.Split(result.Stdout, "\n") {
+			if digest, ok := strings.CutPrefix(strings.TrimSpace(line), "Digest:"); ok {
+				referrer.Digest = strings.TrimSpace(digest)
+			}
+		}
+		return referrer, nil
+	}
+
+	if err := exec.RequireCommands("cosign"); err != nil {
+		return nil, fmt.Errorf("oras or cosign is required to attach referrers: %w", err)
+	}
+	referrer.Tool = "cosign"
+	sbomType := "spdx"
+	if format == SBOMFormatCycloneDX {
+		sbomType = "cyclonedx"
+	}
+	env, cleanup, err := cosignRegistryEnv(ctx, imageRef)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	opts := exec.DefaultOptions()
+	opts.Env = append([]string{"COSIGN_EXPERIMENTAL=1"}, env...)
+	args := []string{"attach", "sbom", "--sbom", path, "--type", sbomType, "--registry-referrers-mode", "oci-1-1", imageRef}
+	if result := exec.RunRetry(ctx, "cosign", args, opts); result.Err != nil {
+		return nil, fmt.Errorf("cosign attach sbom: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return referrer, nil
+}
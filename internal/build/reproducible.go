@@ -0,0 +1,120 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// ReproducibilityResult holds the outcome of building the same source twice
+type ReproducibilityResult struct {
+	SourceDateEpoch int64
+	ImageRefs       [2]string
+	Digests         [2]string
+}
+
+// Reproducible reports whether both builds produced the same digest
+func (r *ReproducibilityResult) Reproducible() bool {
+	return r.Digests[0] != "" && r.Digests[0] == r.Digests[1]
+}
+
+// SourceDateEpoch returns SOURCE_DATE_EPOCH from the environment,
+// falling back to the commit time of HEAD
+func (b *Builder) SourceDateEpoch(ctx context.Context) (int64, error) {
+	if env := os.Getenv("SOURCE_DATE_EPOCH"); env != "" {
+		epoch, err := strconv.ParseInt(env, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", env, err)
+		}
+		return epoch, nil
+	}
+
+	result := exec.Git(ctx, b.rootDir, "log", "-1", "--format=%ct")
+	if result.Err != nil {
+		return 0, fmt.Errorf("reading commit time for SOURCE_DATE_EPOCH: %w", result.Err)
+	}
+	epoch, err := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing commit time: %w", err)
+	}
+	return epoch, nil
+}
+
+// VerifyReproducible builds the image twice without cache and compares the
+// resulting digests. Both runs build under the same <tag>-repro tag so they
+// carry identical labels; each result is then moved to <tag>-repro-1 or
+// <tag>-repro-2 before the next run. The images are removed afterwards
+// unless keep is set.
+func (b *Builder) VerifyReproducible(ctx context.Context, opts BuildOptions, keep bool) (*ReproducibilityResult, error) {
+	epoch, err := b.SourceDateEpoch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = reproducibleOptions(opts)
+	result := &ReproducibilityResult{SourceDateEpoch: epoch}
+	for i := range result.Digests {
+		b.logger.Info("reproducibility build", "run", i+1, "tag", opts.Tag)
+
+		manifest, err := b.Build(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("build %d: %w", i+1, err)
+		}
+		if len(manifest.Images) == 0 || manifest.Images[0].Digest == "" {
+			return nil, fmt.Errorf("build %d: no digest recorded", i+1)
+		}
+
+		// Move the image aside so the next run cannot reuse or overwrite it
+		imageRef := manifest.Version.ImageRef
+		runRef := fmt.Sprintf("%s-%d", imageRef, i+1)
+		if tagged := b.engine.Command(ctx, "tag", imageRef, runRef); tagged.Err != nil {
+			return nil, fmt.Errorf("tagging build %d: %w", i+1, tagged.Err)
+		}
+		if untagged := b.engine.Command(ctx, "rmi", imageRef); untagged.Err != nil {
+			return nil, fmt.Errorf("untagging build %d: %w", i+1, untagged.Err)
+		}
+		result.ImageRefs[i] = runRef
+		result.Digests[i] = manifest.Images[0].Digest
+	}
+
+	if !keep {
+		for _, imageRef := range result.ImageRefs {
+			_ = b.Clean(ctx, imageRef)
+		}
+	}
+
+	return result, nil
+}
+
+// reproducibleOptions returns the options both runs of VerifyReproducible
+// build with: a local, uncached build of one platform under a shared tag
+func reproducibleOptions(opts BuildOptions) BuildOptions {
+	opts.Tag += "-repro"
+	opts.Reproducible = true
+	opts.NoCache = true
+	opts.Resume = false
+	opts.Push = false
+	opts.Sign = false
+	opts.SBOM = false
+	opts.Provenance = false
+	opts.Rechunk = false
+	opts.Healthcheck = false
+	opts.Test = false
+	opts.Arch = nil
+	return opts
+}
+
+// sortedKeys returns the keys of m in lexical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,45 @@
+package build
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/version"
+)
+
+func TestReproducibleRunsShareBuildArgs(t *testing.T) {
+	cfg := config.DefaultConfig()
+	builder := NewBuilder(cfg, t.TempDir(), log.New(nil))
+
+	opts := DefaultBuildOptions()
+	opts.Tag = "stable"
+	opts.ExtraBuildArgs = map[string]string{"FOO": "bar"}
+	opts = reproducibleOptions(opts)
+
+	// Each run computes its version info afresh, as Build does
+	runArgs := func() []string {
+		ver := version.NewInfo(cfg.Build.FedoraVersion, opts.BuildNumber).
+			WithGit("0123456789abcdef", "main", false).
+			WithSourceDate(1700000000)
+		ver = ver.WithImage(cfg.ImageRef(opts.Variant, opts.Tag), opts.Variant, opts.Tag)
+		return builder.prepareBuildArgs(opts, ver)
+	}
+
+	first := runArgs()
+	time.Sleep(time.Second)
+	second := runArgs()
+
+	if !slices.Equal(first, second) {
+		t.Fatalf("build args differ between runs:\n%q\n%q", first, second)
+	}
+	if !slices.Contains(first, "io.galena.tag=stable-repro") {
+		t.Errorf("expected shared tag label, got %q", first)
+	}
+	if !slices.Contains(first, "--no-cache") {
+		t.Errorf("expected --no-cache, got %q", first)
+	}
+}
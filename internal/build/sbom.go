@@ -0,0 +1,255 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// SBOM tools
+const (
+	SBOMToolAuto  = "auto"
+	SBOMToolTrivy = "trivy"
+	SBOMToolSyft  = "syft"
+)
+
+// SBOM formats
+const (
+	SBOMFormatSPDX      = "spdx-json"
+	SBOMFormatCycloneDX = "cyclonedx"
+	SBOMFormatTrivy     = "json" // Trivy's native report, only produced by trivy
+)
+
+// TrivyContainerImage runs trivy when it is not installed
+const TrivyContainerImage = "ghcr.io/aquasecurity/trivy:0.69.3"
+
+const defaultTrivyTimeout = "30m"
+
+// SBOMRequest describes an SBOM to generate
+type SBOMRequest struct {
+	Image   string // Image reference
+	Archive string // docker-archive of the image, scanned instead of Image when set
+	Format  string // Normalized SBOM format
+	Output  string // File the SBOM is written to
+}
+
+// SBOMProvider generates SBOMs with one tool
+type SBOMProvider interface {
+	// Name returns the tool name
+	Name() string
+	// Generate writes the SBOM of an image
+	Generate(ctx context.Context, req SBOMRequest) error
+}
+
+// NewSBOMProvider returns the provider of an SBOM tool. With "auto" (or an
+// empty tool) an installed trivy is preferred, then syft, then trivy in a
+// podman container.
+func NewSBOMProvider(tool, rootDir string) (SBOMProvider, error) {
+	switch tool {
+	case "", SBOMToolAuto:
+		switch {
+		case exec.CheckCommand("trivy"):
+			return &trivySBOM{rootDir: rootDir}, nil
+		case exec.CheckCommand("syft"):
+			return &syftSBOM{}, nil
+		case exec.CheckCommand("podman"):
+			return &trivySBOM{rootDir: rootDir, container: true}, nil
+		}
+		return nil, fmt.Errorf("no SBOM tool found: install trivy or syft, or podman to run trivy in a container")
+	case SBOMToolTrivy:
+		if exec.CheckCommand("trivy") {
+			return &trivySBOM{rootDir: rootDir}, nil
+		}
+		if exec.CheckCommand("podman") {
+			return &trivySBOM{rootDir: rootDir, container: true}, nil
+		}
+		return nil, fmt.Errorf("trivy not found and podman unavailable; cannot generate SBOM")
+	case SBOMToolSyft:
+		if err := exec.RequireCommands("syft"); err != nil {
+			return nil, err
+		}
+		return &syftSBOM{}, nil
+	}
+	return nil, fmt.Errorf("unknown SBOM tool %q (use auto, trivy, or syft)", tool)
+}
+
+// NormalizeSBOMFormat maps format aliases to the SBOM format constants
+func NormalizeSBOMFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", "spdx", SBOMFormatSPDX:
+		return SBOMFormatSPDX, nil
+	case SBOMFormatCycloneDX, "cyclonedx-json":
+		return SBOMFormatCycloneDX, nil
+	case SBOMFormatTrivy:
+		return SBOMFormatTrivy, nil
+	}
+	return "", fmt.Errorf("unknown SBOM format %q (use spdx-json, cyclonedx, or json)", format)
+}
+
+// SBOMFileName returns the file name of an SBOM. Variants get their own file
+// so matrix builds do not overwrite each other.
+func SBOMFileName(format, variant string) string {
+	ext := "spdx.json"
+	switch format {
+	case SBOMFormatCycloneDX:
+		ext = "cyclonedx.json"
+	case SBOMFormatTrivy:
+		ext = "trivy.json"
+	}
+	if variant != "" && variant != "main" {
+		return "sbom-" + variant + "." + ext
+	}
+	return "sbom." + ext
+}
+
+// SBOMPredicateType returns the cosign attestation type of an SBOM format
+func SBOMPredicateType(format string) string {
+	if format == SBOMFormatCycloneDX {
+		return "cyclonedx"
+	}
+	return "spdxjson"
+}
+
+// TrivyEnv returns the environment trivy runs with, keeping its database
+// in the user cache directory
+func TrivyEnv(rootDir string) []string {
+	trivyCache := ToolCacheDir(rootDir, "trivy")
+	_ = os.MkdirAll(trivyCache, 0o755)
+
+	env := []string{}
+	if os.Getenv("TRIVY_CACHE_DIR") == "" {
+		env = append(env, "TRIVY_CACHE_DIR="+trivyCache)
+	}
+	if os.Getenv("TRIVY_SKIP_DB_UPDATE") == "" {
+		env = append(env, "TRIVY_SKIP_DB_UPDATE=false")
+	}
+	if os.Getenv("TRIVY_SKIP_JAVA_DB_UPDATE") == "" {
+		env = append(env, "TRIVY_SKIP_JAVA_DB_UPDATE=false")
+	}
+	return env
+}
+
+// TrivyTimeout returns the trivy timeout from GALENA_TRIVY_TIMEOUT or
+// TRIVY_TIMEOUT
+func TrivyTimeout() string {
+	if timeout := strings.TrimSpace(os.Getenv("GALENA_TRIVY_TIMEOUT")); timeout != "" {
+		return timeout
+	}
+	if timeout := strings.TrimSpace(os.Getenv("TRIVY_TIMEOUT")); timeout != "" {
+		return timeout
+	}
+	return defaultTrivyTimeout
+}
+
+// RunTrivy runs trivy with args, from PATH or in a container with the
+// directories mounted at the same paths
+func RunTrivy(ctx context.Context, rootDir string, container bool, mounts []string, args ...string) *exec.Result {
+	if !container {
+		opts := exec.DefaultOptions()
+		opts.Env = TrivyEnv(rootDir)
+		return exec.Run(ctx, "trivy", args, opts)
+	}
+
+	run := []string{"run", "--rm"}
+	seen := map[string]bool{}
+	for _, dir := range append([]string{rootDir}, mounts...) {
+		if dir != "" && !seen[dir] {
+			seen[dir] = true
+			run = append(run, "-v", fmt.Sprintf("%s:%s:Z", dir, dir))
+		}
+	}
+	run = append(run, "-w", rootDir, TrivyContainerImage)
+	return exec.Podman(ctx, append(run, args...)...)
+}
+
+// ImageArchivePath returns a free path for a temporary image archive and a
+// function removing it. Archives of bootc images are large, so directories
+// on big volumes are preferred: GALENA_SBOM_ARCHIVE_DIR, the podman storage
+// volume CI mounts, the user cache directory, then the temp directory.
+func ImageArchivePath(rootDir string) (string, func(), error) {
+	candidates := []string{}
+	if v := strings.TrimSpace(os.Getenv("GALENA_SBOM_ARCHIVE_DIR")); v != "" {
+		candidates = append(candidates, v)
+	}
+	candidates = append(candidates,
+		"/var/lib/containers",
+		ToolCacheDir(rootDir, "sbom"),
+		os.TempDir(),
+	)
+
+	for _, dir := range candidates {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			continue
+		}
+		f, err := os.CreateTemp(dir, "galena-sbom-*.tar")
+		if err != nil {
+			continue
+		}
+		path := f.Name()
+		_ = f.Close()
+		_ = os.Remove(path)
+		return path, func() { _ = os.Remove(path) }, nil
+	}
+	return "", nil, fmt.Errorf("no writable directory found for image archive")
+}
+
+// trivySBOM generates SBOMs with trivy
+type trivySBOM struct {
+	rootDir   string
+	container bool
+}
+
+func (t *trivySBOM) Name() string {
+	if t.container {
+		return SBOMToolTrivy + " (container)"
+	}
+	return SBOMToolTrivy
+}
+
+func (t *trivySBOM) Generate(ctx context.Context, req SBOMRequest) error {
+	args := []string{"image", "--timeout", TrivyTimeout(), "--format", req.Format, "--output", req.Output}
+	mounts := []string{filepath.Dir(req.Output)}
+	if req.Archive != "" {
+		args = append(args, "--input", req.Archive)
+		mounts = append(mounts, filepath.Dir(req.Archive))
+	} else {
+		args = append(args, req.Image)
+	}
+
+	result := RunTrivy(ctx, t.rootDir, t.container, mounts, args...)
+	if result.Err != nil {
+		return fmt.Errorf("trivy: %w: %s", result.Err, exec.LastNLines(result.Stderr, 20))
+	}
+	return nil
+}
+
+// syftSBOM generates SBOMs with syft
+type syftSBOM struct{}
+
+func (s *syftSBOM) Name() string {
+	return SBOMToolSyft
+}
+
+func (s *syftSBOM) Generate(ctx context.Context, req SBOMRequest) error {
+	format := req.Format
+	switch format {
+	case SBOMFormatCycloneDX:
+		format = "cyclonedx-json"
+	case SBOMFormatTrivy:
+		return fmt.Errorf("syft cannot write the trivy json format; use spdx-json or cyclonedx")
+	}
+
+	source := req.Image
+	if req.Archive != "" {
+		source = "docker-archive:" + req.Archive
+	}
+	result := exec.Syft(ctx, "scan", source, "--output", format+"="+req.Output)
+	if result.Err != nil {
+		return fmt.Errorf("syft: %w: %s", result.Err, exec.LastNLines(result.Stderr, 20))
+	}
+	return nil
+}
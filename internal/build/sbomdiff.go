@@ -0,0 +1,278 @@
+package build
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// In-toto predicate types of attached SBOMs
+const (
+	spdxPredicateType      = "https://spdx.dev/Document"
+	cyclonedxPredicateType = "https://cyclonedx.org/bom"
+)
+
+// noAssertion is the SPDX value for unknown licenses
+const noAssertion = "NOASSERTION"
+
+// SBOMPackage is a package listed in an SBOM
+type SBOMPackage struct {
+	Name    string
+	Version string
+	Type    string // purl type, e.g. rpm or pypi
+	License string // SPDX license expression, NOASSERTION when unknown
+}
+
+// PackageChange is a package added, removed, or updated between two SBOMs
+type PackageChange struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	OldVersion string `json:"old_version,omitempty"`
+	NewVersion string `json:"new_version,omitempty"`
+}
+
+// SBOMDiff lists the package changes between two SBOMs
+type SBOMDiff struct {
+	Old     string          `json:"old"`
+	New     string          `json:"new"`
+	Added   []PackageChange `json:"added"`
+	Removed []PackageChange `json:"removed"`
+	Updated []PackageChange `json:"updated"`
+}
+
+// sbomDocument holds the fields of SPDX and CycloneDX JSON documents used
+// to list packages
+type sbomDocument struct {
+	SPDXVersion string `json:"spdxVersion"`
+	Packages    []struct {
+		Name             string `json:"name"`
+		VersionInfo      string `json:"versionInfo"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+		ExternalRefs     []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+	BOMFormat  string `json:"bomFormat"`
+	Components []struct {
+		Name     string `json:"name"`
+		Version  string `json:"version"`
+		Type     string `json:"type"`
+		PURL     string `json:"purl"`
+		Licenses []struct {
+			License struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"license"`
+			Expression string `json:"expression"`
+		} `json:"licenses"`
+	} `json:"components"`
+}
+
+// ParseSBOMPackages lists the packages of an SPDX or CycloneDX JSON SBOM.
+// Entries without a version, like the image itself, are skipped.
+func ParseSBOMPackages(data []byte) ([]SBOMPackage, error) {
+	var doc sbomDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing SBOM: %w", err)
+	}
+
+	var pkgs []SBOMPackage
+	switch {
+	case doc.SPDXVersion != "":
+		for _, p := range doc.Packages {
+			purl := ""
+			for _, ref := range p.ExternalRefs {
+				if ref.ReferenceType == "purl" {
+					purl = ref.ReferenceLocator
+				}
+			}
+			license := p.LicenseConcluded
+			if license == "" || license == noAssertion {
+				license = p.LicenseDeclared
+			}
+			if p.VersionInfo != "" {
+				pkgs = append(pkgs, SBOMPackage{Name: p.Name, Version: p.VersionInfo, Type: purlType(purl), License: licenseOrUnknown(license)})
+			}
+		}
+	case doc.BOMFormat == "CycloneDX":
+		for _, c := range doc.Components {
+			// Several license entries all apply to the component
+			var licenses []string
+			for _, l := range c.Licenses {
+				switch {
+				case l.Expression != "":
+					licenses = append(licenses, l.Expression)
+				case l.License.ID != "":
+					licenses = append(licenses, l.License.ID)
+				case l.License.Name != "":
+					licenses = append(licenses, l.License.Name)
+				}
+			}
+			if c.Version != "" {
+				pkgs = append(pkgs, SBOMPackage{Name: c.Name, Version: c.Version, Type: purlType(c.PURL), License: licenseOrUnknown(strings.Join(licenses, " AND "))})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SBOM: expected SPDX or CycloneDX JSON")
+	}
+	return pkgs, nil
+}
+
+// licenseOrUnknown maps a missing license to NOASSERTION
+func licenseOrUnknown(license string) string {
+	if strings.TrimSpace(license) == "" {
+		return noAssertion
+	}
+	return license
+}
+
+// purlType returns the type of a package URL (pkg:<type>/...)
+func purlType(purl string) string {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return "other"
+	}
+	typ, _, _ := strings.Cut(rest, "/")
+	return typ
+}
+
+// DiffSBOMs compares the packages of two SBOMs by type and name. Packages
+// installed in several versions are compared as a version set.
+func DiffSBOMs(oldRef string, oldPkgs []SBOMPackage, newRef string, newPkgs []SBOMPackage) *SBOMDiff {
+	index := func(pkgs []SBOMPackage) map[[2]string]string {
+		versions := map[[2]string][]string{}
+		for _, p := range pkgs {
+			key := [2]string{p.Type, p.Name}
+			if !containsString(versions[key], p.Version) {
+				versions[key] = append(versions[key], p.Version)
+			}
+		}
+		joined := map[[2]string]string{}
+		for key, v := range versions {
+			sort.Strings(v)
+			joined[key] = strings.Join(v, ", ")
+		}
+		return joined
+	}
+	before, after := index(oldPkgs), index(newPkgs)
+
+	diff := &SBOMDiff{Old: oldRef, New: newRef}
+	for key, v := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, PackageChange{Type: key[0], Name: key[1], NewVersion: v})
+		case old != v:
+			diff.Updated = append(diff.Updated, PackageChange{Type: key[0], Name: key[1], OldVersion: old, NewVersion: v})
+		}
+	}
+	for key, v := range before {
+		if _, ok := after[key]; !ok {
+			diff.Removed = append(diff.Removed, PackageChange{Type: key[0], Name: key[1], OldVersion: v})
+		}
+	}
+	for _, changes := range [][]PackageChange{diff.Added, diff.Removed, diff.Updated} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Type != changes[j].Type {
+				return changes[i].Type < changes[j].Type
+			}
+			return changes[i].Name < changes[j].Name
+		})
+	}
+	return diff
+}
+
+// Empty reports whether no package changed
+func (d *SBOMDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Updated) == 0
+}
+
+// Types returns the package types with changes, sorted
+func (d *SBOMDiff) Types() []string {
+	seen := map[string]bool{}
+	for _, changes := range [][]PackageChange{d.Added, d.Removed, d.Updated} {
+		for _, c := range changes {
+			seen[c.Type] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// Markdown renders the diff as a "Package Changes" release notes section
+func (d *SBOMDiff) Markdown() string {
+	var b strings.Builder
+	b.WriteString("## Package Changes\n\n")
+	fmt.Fprintf(&b, "Compared `%s` to `%s`.\n", d.Old, d.New)
+	if d.Empty() {
+		b.WriteString("\nNo package changes.\n")
+		return b.String()
+	}
+
+	for _, typ := range d.Types() {
+		fmt.Fprintf(&b, "\n### %s\n\n", typ)
+		b.WriteString("| Change | Package | Old | New |\n")
+		b.WriteString("|--------|---------|-----|-----|\n")
+		for _, section := range []struct {
+			label   string
+			changes []PackageChange
+		}{{"Added", d.Added}, {"Updated", d.Updated}, {"Removed", d.Removed}} {
+			for _, c := range section.changes {
+				if c.Type == typ {
+					fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", section.label, c.Name, c.OldVersion, c.NewVersion)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// DownloadSBOM returns the SBOM attested to an image, preferring SPDX. It
+// fails when no SBOM attestation is attached. The attestation signature is
+// not verified; use VerifyImage for that.
+func DownloadSBOM(ctx context.Context, imageRef string) ([]byte, error) {
+	if err := exec.RequireCommands("cosign"); err != nil {
+		return nil, err
+	}
+	result := exec.Cosign(ctx, "download", "attestation", imageRef)
+	if result.Err != nil {
+		return nil, fmt.Errorf("downloading attestations: %s", exec.LastNLines(result.Stderr, 5))
+	}
+
+	var cyclonedx []byte
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		if json.Unmarshal([]byte(line), &envelope) != nil || envelope.Payload == "" {
+			continue
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			continue
+		}
+		var statement struct {
+			PredicateType string          `json:"predicateType"`
+			Predicate     json.RawMessage `json:"predicate"`
+		}
+		if json.Unmarshal(payload, &statement) != nil {
+			continue
+		}
+		switch statement.PredicateType {
+		case spdxPredicateType:
+			return statement.Predicate, nil
+		case cyclonedxPredicateType:
+			cyclonedx = statement.Predicate
+		}
+	}
+	if cyclonedx != nil {
+		return cyclonedx, nil
+	}
+	return nil, fmt.Errorf("no SBOM attestation attached to %s", imageRef)
+}
@@ -0,0 +1,111 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+)
+
+// Dependency-Track defaults
+const (
+	DependencyTrackURLEnv    = "DEPENDENCY_TRACK_URL"
+	DependencyTrackAPIKeyEnv = "DEPENDENCY_TRACK_API_KEY"
+)
+
+// SBOMPublication is an SBOM uploaded to Dependency-Track
+type SBOMPublication struct {
+	Server  string `json:"server"`
+	Project string `json:"project"`
+	Version string `json:"version"`
+	Token   string `json:"token"` // Processing token returned by the server
+}
+
+// PublishSBOM uploads a CycloneDX SBOM to Dependency-Track as the given
+// project version, creating the project when it does not exist
+func PublishSBOM(ctx context.Context, c config.DependencyTrackConfig, path, project, version string) (*SBOMPublication, error) {
+	server := strings.TrimSuffix(c.URL, "/")
+	if server == "" {
+		server = strings.TrimSuffix(os.Getenv(DependencyTrackURLEnv), "/")
+	}
+	if server == "" {
+		return nil, fmt.Errorf("no Dependency-Track server: set sbom.dependency_track.url in galena.yaml or %s", DependencyTrackURLEnv)
+	}
+	keyEnv := c.APIKeyEnv
+	if keyEnv == "" {
+		keyEnv = DependencyTrackAPIKeyEnv
+	}
+	apiKey := os.Getenv(keyEnv)
+	if apiKey == "" {
+		return nil, fmt.Errorf("no Dependency-Track API key: set %s", keyEnv)
+	}
+	if project == "" || version == "" {
+		return nil, fmt.Errorf("publishing an SBOM needs a project name and version")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading SBOM: %w", err)
+	}
+	var doc struct {
+		BOMFormat string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.BOMFormat != "CycloneDX" {
+		return nil, fmt.Errorf("%s is not a CycloneDX JSON SBOM; Dependency-Track only accepts CycloneDX", path)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, field := range [][2]string{{"autoCreate", "true"}, {"projectName", project}, {"projectVersion", version}} {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return nil, err
+		}
+	}
+	part, err := form.CreateFormFile("bom", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server+"/api/v1/bom", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Api-Key", apiKey)
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("uploading SBOM: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Dependency-Track returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parsing Dependency-Track response: %w", err)
+	}
+	return &SBOMPublication{Server: server, Project: project, Version: version, Token: result.Token}, nil
+}
@@ -0,0 +1,243 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/iiroan/galena/internal/config"
+)
+
+// Vulnerability is one finding of a vulnerability scan
+type Vulnerability struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+	Target           string `json:"target"`
+}
+
+// Vulnerability scanners
+const (
+	ScannerTrivy = "trivy"
+	ScannerGrype = "grype"
+)
+
+// ScanReport summarizes a trivy or grype vulnerability report
+type ScanReport struct {
+	Image           string          `json:"image"`
+	Report          string          `json:"report"`
+	Counts          map[string]int  `json:"counts"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// trivyReport is the part of the trivy JSON report used in the summary
+type trivyReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// grypeReport is the part of the grype JSON report used in the summary
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID          string `json:"id"`
+			Severity    string `json:"severity"`
+			Description string `json:"description"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Type    string `json:"type"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+// ParseScanReport reads a trivy JSON report, ordering findings from the
+// most to the least severe
+func ParseScanReport(image, path string) (*ScanReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scan report: %w", err)
+	}
+	var raw trivyReport
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing scan report: %w", err)
+	}
+
+	report := &ScanReport{Image: image, Report: path}
+	for _, r := range raw.Results {
+		for _, v := range r.Vulnerabilities {
+			report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         v.Severity,
+				Title:            v.Title,
+				Target:           r.Target,
+			})
+		}
+	}
+	report.summarize()
+	return report, nil
+}
+
+// ParseGrypeReport reads a grype JSON report. Negligible findings count as LOW.
+func ParseGrypeReport(image, path string) (*ScanReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scan report: %w", err)
+	}
+	var raw grypeReport
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing scan report: %w", err)
+	}
+
+	report := &ScanReport{Image: image, Report: path}
+	for _, m := range raw.Matches {
+		severity := m.Vulnerability.Severity
+		if strings.EqualFold(severity, "negligible") {
+			severity = "LOW"
+		}
+		report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{
+			ID:               m.Vulnerability.ID,
+			Package:          m.Artifact.Name,
+			InstalledVersion: m.Artifact.Version,
+			FixedVersion:     strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Severity:         severity,
+			Title:            m.Vulnerability.Description,
+			Target:           m.Artifact.Type,
+		})
+	}
+	report.summarize()
+	return report, nil
+}
+
+// Filter drops findings outside the policy severities, without a fix when
+// unfixed findings are ignored, or whose ID is ignored. It applies the
+// policy to reports of tools that cannot filter themselves.
+func (r *ScanReport) Filter(c config.ScanConfig, ignored []string) {
+	kept := r.Vulnerabilities[:0]
+	for _, v := range r.Vulnerabilities {
+		if len(c.Severity) > 0 && !containsFold(c.Severity, v.Severity) {
+			continue
+		}
+		if (c.IgnoreUnfixed && v.FixedVersion == "") || containsString(ignored, v.ID) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	r.Vulnerabilities = kept
+	r.summarize()
+}
+
+// summarize normalizes severities, counts findings per severity, and orders
+// them from the most to the least severe
+func (r *ScanReport) summarize() {
+	r.Counts = map[string]int{}
+	for i, v := range r.Vulnerabilities {
+		severity := strings.ToUpper(v.Severity)
+		if config.SeverityRank(severity) < 0 {
+			severity = "UNKNOWN"
+		}
+		r.Vulnerabilities[i].Severity = severity
+		r.Counts[severity]++
+	}
+	sort.SliceStable(r.Vulnerabilities, func(i, j int) bool {
+		a, b := r.Vulnerabilities[i], r.Vulnerabilities[j]
+		if ra, rb := config.SeverityRank(a.Severity), config.SeverityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		return a.ID < b.ID
+	})
+}
+
+// ReadIgnoreFile returns the vulnerability IDs of a .trivyignore file,
+// skipping comments and blank lines
+func ReadIgnoreFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line, _, _ = strings.Cut(line, "#"); strings.TrimSpace(line) != "" {
+			ids = append(ids, strings.TrimSpace(line))
+		}
+	}
+	return ids, nil
+}
+
+// containsFold reports whether items contains s, ignoring case
+func containsFold(items []string, s string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AtOrAbove returns the findings of at least the given severity
+func (r *ScanReport) AtOrAbove(severity string) []Vulnerability {
+	threshold := config.SeverityRank(severity)
+	var found []Vulnerability
+	for _, v := range r.Vulnerabilities {
+		if config.SeverityRank(v.Severity) >= threshold {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// Check applies the fail-on policy: it fails when a finding is at least as
+// severe as failOn. An empty failOn never fails.
+func (r *ScanReport) Check(failOn string) error {
+	if failOn == "" {
+		return nil
+	}
+	if config.SeverityRank(failOn) < 0 {
+		return fmt.Errorf("unknown severity %q (use one of %s)", failOn, strings.Join(config.Severities(), ", "))
+	}
+	if found := r.AtOrAbove(failOn); len(found) > 0 {
+		return fmt.Errorf("%d vulnerabilities at or above %s in %s", len(found), strings.ToUpper(failOn), r.Image)
+	}
+	return nil
+}
+
+// TrivyScanFlags returns the trivy flags for a scan policy. ignoreFile is
+// the resolved ignore file, or empty for none.
+func TrivyScanFlags(c config.ScanConfig, ignoreFile string) []string {
+	flags := []string{"--scanners", "vuln", "--format", "json"}
+	if len(c.Severity) > 0 {
+		severities := make([]string, len(c.Severity))
+		for i, s := range c.Severity {
+			severities[i] = strings.ToUpper(s)
+		}
+		flags = append(flags, "--severity", strings.Join(severities, ","))
+	}
+	if ignoreFile != "" {
+		flags = append(flags, "--ignorefile", ignoreFile)
+	}
+	if c.IgnoreUnfixed {
+		flags = append(flags, "--ignore-unfixed")
+	}
+	return flags
+}
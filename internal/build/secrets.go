@@ -0,0 +1,108 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/config"
+)
+
+// Secret is a build secret exposed to RUN --mount=type=secret without
+// entering image layers or history
+type Secret struct {
+	ID  string
+	Src string
+	Env string
+}
+
+// ParseSecret parses a --secret spec of the form id=NAME,src=FILE or id=NAME,env=VAR
+func ParseSecret(spec string) (Secret, error) {
+	secret := Secret{}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return Secret{}, fmt.Errorf("invalid secret %q: expected key=value fields", spec)
+		}
+		switch key {
+		case "id":
+			secret.ID = value
+		case "src", "source":
+			secret.Src = value
+		case "env":
+			secret.Env = value
+		default:
+			return Secret{}, fmt.Errorf("invalid secret %q: unknown field %q", spec, key)
+		}
+	}
+	if err := secret.validate(); err != nil {
+		return Secret{}, fmt.Errorf("invalid secret %q: %w", spec, err)
+	}
+	return secret, nil
+}
+
+func (s Secret) validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if (s.Src == "") == (s.Env == "") {
+		return fmt.Errorf("exactly one of src or env is required")
+	}
+	return nil
+}
+
+// Arg returns the --secret value passed to the container engine
+func (s Secret) Arg() string {
+	if s.Env != "" {
+		return fmt.Sprintf("id=%s,env=%s", s.ID, s.Env)
+	}
+	return fmt.Sprintf("id=%s,src=%s", s.ID, s.Src)
+}
+
+// SecretArgs resolves configured and requested secrets into engine flags.
+// Relative sources are resolved against rootDir, and a secret given on the
+// command line replaces a configured secret with the same id.
+func SecretArgs(rootDir string, configured []config.SecretConfig, specs []string) ([]string, error) {
+	secrets := []Secret{}
+	index := map[string]int{}
+	add := func(s Secret) {
+		if i, ok := index[s.ID]; ok {
+			secrets[i] = s
+			return
+		}
+		index[s.ID] = len(secrets)
+		secrets = append(secrets, s)
+	}
+
+	for _, c := range configured {
+		s := Secret{ID: c.ID, Src: c.Src, Env: c.Env}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("build.secrets %q: %w", c.ID, err)
+		}
+		add(s)
+	}
+	for _, spec := range specs {
+		s, err := ParseSecret(spec)
+		if err != nil {
+			return nil, err
+		}
+		add(s)
+	}
+
+	args := []string{}
+	for _, s := range secrets {
+		if s.Src != "" {
+			if !filepath.IsAbs(s.Src) {
+				s.Src = filepath.Join(rootDir, s.Src)
+			}
+			if _, err := os.Stat(s.Src); err != nil {
+				return nil, fmt.Errorf("secret %q: %w", s.ID, err)
+			}
+		} else if _, ok := os.LookupEnv(s.Env); !ok {
+			return nil, fmt.Errorf("secret %q: environment variable %s is not set", s.ID, s.Env)
+		}
+		args = append(args, "--secret", s.Arg())
+	}
+	return args, nil
+}
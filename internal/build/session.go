@@ -0,0 +1,232 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionKeep is how many session logs are kept by default
+const DefaultSessionKeep = 20
+
+const sessionTimeFormat = "20060102-150405"
+
+// Session logs every command a galena invocation runs, with its output, to
+// logs/sessions/<kind>-<timestamp>.log. It is an io.Writer safe for
+// concurrent use, meant for exec.Options.SessionLog.
+type Session struct {
+	Name    string
+	Path    string
+	started time.Time
+	mu      sync.Mutex
+	file    *os.File
+}
+
+// SessionInfo describes a session log on disk
+type SessionInfo struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Kind    string    `json:"kind"` // build, disk, ci-build, ...
+	Started time.Time `json:"started"`
+	Size    int64     `json:"size"`
+	Status  string    `json:"status"` // succeeded, failed, or incomplete while running or after a crash
+}
+
+// SessionsDir returns the directory session logs are written to
+func SessionsDir(rootDir string) string {
+	return filepath.Join(rootDir, "logs", "sessions")
+}
+
+// StartSession opens a new session log for a command of the given kind and
+// removes the oldest logs beyond keep (DefaultSessionKeep when keep is 0)
+func StartSession(rootDir, kind, command string, keep int) (*Session, error) {
+	dir := SessionsDir(rootDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating session log directory: %w", err)
+	}
+	started := time.Now()
+	base := fmt.Sprintf("%s-%s", kind, started.Format(sessionTimeFormat))
+
+	var file *os.File
+	name := base
+	for i := 2; ; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, name+".log"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			file = f
+			break
+		}
+		if !errors.Is(err, os.ErrExist) || i > 100 {
+			return nil, fmt.Errorf("creating session log: %w", err)
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	s := &Session{Name: name, Path: file.Name(), started: started, file: file}
+	fmt.Fprintf(s, "=== %s\n=== started %s\n", command, started.Format(time.RFC3339))
+
+	if keep <= 0 {
+		keep = DefaultSessionKeep
+	}
+	if err := pruneSessions(rootDir, keep); err != nil {
+		return s, fmt.Errorf("rotating session logs: %w", err)
+	}
+	return s, nil
+}
+
+// Write appends p to the session log
+func (s *Session) Write(p []byte) (int, error) {
+	if s == nil {
+		return len(p), nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Write(p)
+}
+
+// Phase marks the start of a step of the session, e.g. a variant build
+func (s *Session) Phase(name string) {
+	fmt.Fprintf(s, "\n=== [%s] %s\n", time.Now().Format(time.TimeOnly), name)
+}
+
+// SessionPhase returns the name of the phase a session log line starts, if
+// it is a marker written by Phase
+func SessionPhase(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "=== [")
+	if !ok {
+		return "", false
+	}
+	stamp, name, ok := strings.Cut(rest, "] ")
+	if !ok {
+		return "", false
+	}
+	if _, err := time.Parse(time.TimeOnly, stamp); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// Close records the outcome of the session and closes the log
+func (s *Session) Close(err error) error {
+	if s == nil {
+		return nil
+	}
+	elapsed := time.Since(s.started).Round(time.Second)
+	if err != nil {
+		fmt.Fprintf(s, "\n=== session failed after %s: %v\n", elapsed, err)
+	} else {
+		fmt.Fprintf(s, "\n=== session succeeded after %s\n", elapsed)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// ListSessions returns the session logs of a project, newest first
+func ListSessions(rootDir string) ([]SessionInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(SessionsDir(rootDir), "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]SessionInfo, 0, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".log")
+		info := SessionInfo{Name: name, Path: path, Kind: name, Started: fi.ModTime(), Size: fi.Size()}
+		// <kind>-<date>-<time>[-<n>]
+		parts := strings.Split(name, "-")
+		for i := len(parts) - 2; i >= 1; i-- {
+			if t, err := time.ParseInLocation(sessionTimeFormat, parts[i]+"-"+parts[i+1], time.Local); err == nil {
+				info.Kind = strings.Join(parts[:i], "-")
+				info.Started = t
+				break
+			}
+		}
+		info.Status = sessionStatus(path)
+		sessions = append(sessions, info)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].Started.Equal(sessions[j].Started) {
+			return sessions[i].Name > sessions[j].Name
+		}
+		return sessions[i].Started.After(sessions[j].Started)
+	})
+	return sessions, nil
+}
+
+// FindSession returns a session log by name or path, or the newest one
+// when name is empty
+func FindSession(rootDir, name string) (SessionInfo, error) {
+	sessions, err := ListSessions(rootDir)
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	if name == "" {
+		if len(sessions) == 0 {
+			return SessionInfo{}, fmt.Errorf("no session logs in %s (build, disk, and ci build write them)", SessionsDir(rootDir))
+		}
+		return sessions[0], nil
+	}
+	want := strings.TrimSuffix(filepath.Base(name), ".log")
+	for _, s := range sessions {
+		if s.Name == want {
+			return s, nil
+		}
+	}
+	// The newest session of a kind, e.g. "disk"
+	for _, s := range sessions {
+		if s.Kind == want {
+			return s, nil
+		}
+	}
+	return SessionInfo{}, fmt.Errorf("no session log %q in %s", name, SessionsDir(rootDir))
+}
+
+// sessionStatus reads the outcome from the end of a session log
+func sessionStatus(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.Size() > 512 {
+		if _, err := f.Seek(-512, io.SeekEnd); err != nil {
+			return "unknown"
+		}
+	}
+	tail, err := io.ReadAll(f)
+	if err != nil {
+		return "unknown"
+	}
+	switch {
+	case strings.Contains(string(tail), "=== session succeeded"):
+		return "succeeded"
+	case strings.Contains(string(tail), "=== session failed"):
+		return "failed"
+	default:
+		return "incomplete"
+	}
+}
+
+// pruneSessions removes all but the newest keep session logs
+func pruneSessions(rootDir string, keep int) error {
+	sessions, err := ListSessions(rootDir)
+	if err != nil || len(sessions) <= keep {
+		return err
+	}
+	var errs []error
+	for _, s := range sessions[keep:] {
+		if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
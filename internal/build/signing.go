@@ -0,0 +1,157 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/secrets"
+)
+
+// keyEnv carries a private key read from a secret reference to cosign,
+// which loads it with --key env://
+const keyEnv = "GALENA_COSIGN_KEY"
+
+// Signer signs and attests images with cosign
+type Signer struct {
+	Key          string // Key reference passed to cosign; keyless when empty
+	KeyFrom      string // Secret reference to the private key, replacing Key
+	PasswordEnv  string // Environment variable holding the key password
+	PasswordFrom string // Secret reference to the key password
+}
+
+// NewSigner returns the signer of a signing configuration. Key files are
+// relative to the project root.
+func NewSigner(rootDir string, c config.SigningConfig) Signer {
+	key := c.Key
+	if key != "" && !strings.Contains(key, "://") && !filepath.IsAbs(key) {
+		key = filepath.Join(rootDir, key)
+	}
+	return Signer{Key: key, KeyFrom: c.KeyFrom, PasswordEnv: c.PasswordEnv, PasswordFrom: c.PasswordFrom}
+}
+
+// Keyless reports whether the signer uses keyless OIDC signing
+func (s Signer) Keyless() bool {
+	return s.Key == "" && s.KeyFrom == ""
+}
+
+// Sign signs an image, adding the annotations to the signature payload
+func (s Signer) Sign(ctx context.Context, imageRef string, annotations map[string]string) error {
+	args := []string{"sign", "--yes"}
+	for _, k := range sortedKeys(annotations) {
+		args = append(args, "-a", k+"="+annotations[k])
+	}
+	return s.run(ctx, imageRef, append(args, imageRef)...)
+}
+
+// Attest attaches a signed in-toto attestation with the given predicate to an image
+func (s Signer) Attest(ctx context.Context, imageRef, predicatePath, predicateType string) error {
+	return s.run(ctx, imageRef, "attest", "--yes", "--predicate", predicatePath, "--type", predicateType, imageRef)
+}
+
+// SignBlob signs a file, writing the signature and certificate bundle that
+// cosign verify-blob --bundle checks
+func (s Signer) SignBlob(ctx context.Context, path, bundle string) error {
+	return s.run(ctx, "", "sign-blob", "--yes", "--bundle", bundle, path)
+}
+
+// run runs a cosign subcommand. Secrets from references reach cosign
+// through its environment, and registry credentials of image, when
+// configured, through a temporary docker config.
+func (s Signer) run(ctx context.Context, image string, args ...string) error {
+	if err := exec.RequireCommands("cosign"); err != nil {
+		return err
+	}
+	opts := exec.DefaultOptions()
+	flags := []string{}
+	switch {
+	case s.KeyFrom != "":
+		key, err := secrets.ResolveRef(ctx, s.KeyFrom)
+		if err != nil {
+			return fmt.Errorf("signing key: %w", err)
+		}
+		opts.Env = append(opts.Env, keyEnv+"="+key)
+		flags = append(flags, "--key", "env://"+keyEnv)
+	case s.Key != "":
+		if !strings.Contains(s.Key, "://") {
+			if _, err := os.Stat(s.Key); err != nil {
+				return fmt.Errorf("signing key: %w", err)
+			}
+		}
+		flags = append(flags, "--key", s.Key)
+	}
+
+	switch {
+	case s.PasswordFrom != "":
+		password, err := secrets.ResolveRef(ctx, s.PasswordFrom)
+		if err != nil {
+			return fmt.Errorf("signing key password: %w", err)
+		}
+		opts.Env = append(opts.Env, "COSIGN_PASSWORD="+password)
+	case s.PasswordEnv != "":
+		opts.Env = append(opts.Env, "COSIGN_PASSWORD="+os.Getenv(s.PasswordEnv))
+	}
+
+	if image != "" {
+		env, cleanup, err := cosignRegistryEnv(ctx, image)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		opts.Env = append(opts.Env, env...)
+	}
+	args = append(append([]string{args[0]}, flags...), args[1:]...)
+
+	result := exec.RunRetry(ctx, "cosign", args, opts)
+	if result.Err != nil {
+		return fmt.Errorf("cosign %s: %w: %s", args[0], result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return nil
+}
+
+// cosignRegistryEnv returns the environment pointing cosign at a docker
+// config with the configured credentials of the registry of image, if any,
+// and a function removing it
+func cosignRegistryEnv(ctx context.Context, image string) ([]string, func(), error) {
+	authFile, cleanup, err := storeAuthFile(ctx, image)
+	if err != nil {
+		return nil, nil, err
+	}
+	if authFile == "" {
+		return nil, cleanup, nil
+	}
+	return []string{"DOCKER_CONFIG=" + filepath.Dir(authFile)}, cleanup, nil
+}
+
+// GenerateKeyPair creates a cosign key pair. With a KMS URI the private key
+// is created in the KMS; otherwise it is written to <prefix>.key in dir. The
+// public key is always written to <prefix>.pub in dir. cosign prompts for
+// the key password unless COSIGN_PASSWORD is set.
+func GenerateKeyPair(ctx context.Context, dir, prefix, kms string) (privateKey, publicKey string, err error) {
+	if err := exec.RequireCommands("cosign"); err != nil {
+		return "", "", err
+	}
+
+	privateKey = filepath.Join(dir, prefix+".key")
+	publicKey = filepath.Join(dir, prefix+".pub")
+	args := []string{"generate-key-pair", "--output-key-prefix", prefix}
+	if kms != "" {
+		args = append(args, "--kms", kms)
+		privateKey = kms
+	} else if _, err := os.Stat(privateKey); err == nil {
+		return "", "", fmt.Errorf("%s already exists", privateKey)
+	}
+
+	opts := exec.DefaultOptions()
+	opts.Dir = dir
+	opts.Stdin = os.Stdin
+	opts.StreamStdio = true
+	if result := exec.RunRetry(ctx, "cosign", args, opts); result.Err != nil {
+		return "", "", fmt.Errorf("generating key pair: %w", result.Err)
+	}
+	return privateKey, publicKey, nil
+}
@@ -0,0 +1,95 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// TestResult is the outcome of one smoke test
+type TestResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Output   string        `json:"output,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// TestName returns the configured name of a check, or a name derived from it
+func TestName(t config.SmokeTest) string {
+	switch {
+	case t.Name != "":
+		return t.Name
+	case t.Command != "":
+		return t.Command
+	case t.Script != "":
+		return t.Script
+	case len(t.Packages) > 0:
+		return "rpm -q " + strings.Join(t.Packages, " ")
+	default:
+		return "systemctl is-enabled " + strings.Join(t.Units, " ")
+	}
+}
+
+// testCommand returns the command a check runs inside the image
+func (b *Builder) testCommand(t config.SmokeTest) ([]string, error) {
+	switch {
+	case t.Command != "":
+		return []string{"/bin/sh", "-c", t.Command}, nil
+	case t.Script != "":
+		script, err := os.ReadFile(filepath.Join(b.rootDir, t.Script))
+		if err != nil {
+			return nil, fmt.Errorf("reading test script: %w", err)
+		}
+		return []string{"/bin/sh", "-c", string(script)}, nil
+	case len(t.Packages) > 0:
+		return append([]string{"rpm", "-q"}, t.Packages...), nil
+	default:
+		return append([]string{"systemctl", "is-enabled"}, t.Units...), nil
+	}
+}
+
+// SmokeTest runs every check in a throwaway container of the image and
+// returns a result per check. It fails if any check fails.
+func (b *Builder) SmokeTest(ctx context.Context, imageRef string, checks []config.SmokeTest) ([]TestResult, error) {
+	b.logger.Info("running smoke tests", "image", imageRef, "checks", len(checks))
+
+	results := make([]TestResult, 0, len(checks))
+	failed := []string{}
+	for _, check := range checks {
+		name := TestName(check)
+		command, err := b.testCommand(check)
+		if err != nil {
+			results = append(results, TestResult{Name: name, Output: err.Error()})
+			failed = append(failed, name)
+			b.logger.Error("smoke test failed", "test", name, "error", err)
+			continue
+		}
+
+		result := b.engine.RunImage(ctx, imageRef, command...)
+		tr := TestResult{
+			Name:     name,
+			Passed:   result.Err == nil,
+			Output:   strings.TrimSpace(exec.LastNLines(result.Stdout+result.Stderr, 20)),
+			Duration: result.Duration,
+		}
+		results = append(results, tr)
+
+		if tr.Passed {
+			b.logger.Info("smoke test passed", "test", name, "duration", tr.Duration.Round(time.Millisecond))
+		} else {
+			failed = append(failed, name)
+			b.logger.Error("smoke test failed", "test", name, "exit_code", result.ExitCode, "output", tr.Output)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("%d of %d smoke tests failed: %s", len(failed), len(checks), strings.Join(failed, ", "))
+	}
+	return results, nil
+}
@@ -0,0 +1,100 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StateDir returns the directory galena keeps the build state of a project
+// in: the lock, checkpoints, history, and rendered templates. It lives under
+// the git directory so it never shows up as a change in the working tree,
+// or under $XDG_STATE_HOME/galena for a project outside git.
+func StateDir(rootDir string) string {
+	abs, err := filepath.Abs(rootDir)
+	if err != nil {
+		abs = rootDir
+	}
+	if gitDir, top, ok := findGitDir(abs); ok {
+		rel, err := filepath.Rel(top, abs)
+		if err != nil || rel == "." {
+			return filepath.Join(gitDir, "galena")
+		}
+		// Workspace projects share the git directory of the monorepo
+		return filepath.Join(gitDir, "galena", "projects", rel)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(stateHome(), "galena", "projects", filepath.Base(abs)+"-"+hex.EncodeToString(sum[:6]))
+}
+
+// ToolCacheDir returns where galena keeps the cache of a tool, such as the
+// trivy database, outside the project so it never dirties the working tree:
+// $XDG_CACHE_HOME/galena/<name>, shared by all projects. Without a user
+// cache directory it falls back to .cache in the project.
+func ToolCacheDir(rootDir, name string) string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "galena", name)
+	}
+	return filepath.Join(rootDir, ".cache", name)
+}
+
+// migrateState moves a state file that earlier releases kept in the
+// project's .galena directory into the state directory
+func migrateState(rootDir, name string) {
+	path := filepath.Join(StateDir(rootDir), name)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	legacy := filepath.Join(rootDir, ".galena", name)
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		_ = os.Rename(legacy, path)
+	}
+}
+
+// findGitDir returns the git directory of the repository holding dir and
+// the top of its working tree. A .git file, as in worktrees and submodules,
+// points to the git directory.
+func findGitDir(dir string) (gitDir, top string, ok bool) {
+	for {
+		path := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(path); err == nil {
+			if fi.IsDir() {
+				return path, dir, true
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", "", false
+			}
+			target, found := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !found {
+				return "", "", false
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(dir, target)
+			}
+			return target, dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
+
+// stateHome returns $XDG_STATE_HOME, defaulting to ~/.local/state
+func stateHome() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return os.TempDir()
+	}
+	return filepath.Join(home, ".local", "state")
+}
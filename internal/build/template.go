@@ -0,0 +1,187 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/iiroan/galena/internal/config"
+)
+
+// ContainerfileTemplate is rendered per variant when present in the project root
+const ContainerfileTemplate = "Containerfile.tmpl"
+
+// renderedDir holds rendered Containerfiles, relative to the project's
+// state directory
+const renderedDir = "rendered"
+
+// TemplateData is the data available to Containerfile.tmpl
+type TemplateData struct {
+	Name          string
+	Variant       string
+	Flavor        string
+	Description   string
+	Tag           string
+	BaseImage     string
+	BaseImageRef  string // base_image@base_image_digest when pinned
+	FedoraVersion string
+	Packages      []string
+	Scripts       []string
+	Dependencies  map[string]TemplateDependency
+}
+
+// TemplateDependency is a pinned dependency as seen by Containerfile.tmpl
+type TemplateDependency struct {
+	Image  string
+	Tag    string
+	Digest string
+	Ref    string // image@digest when pinned, else image:tag
+}
+
+// NewTemplateData collects the template data of a variant from the configuration
+func NewTemplateData(cfg *config.Config, variant, tag string) (TemplateData, error) {
+	data := TemplateData{
+		Name:          cfg.Name,
+		Variant:       variant,
+		Tag:           tag,
+		BaseImage:     cfg.Build.BaseImage,
+		BaseImageRef:  cfg.BaseImageRef(),
+		FedoraVersion: cfg.Build.FedoraVersion,
+		Packages:      []string{},
+		Scripts:       []string{},
+		Dependencies:  map[string]TemplateDependency{},
+	}
+
+	if v, err := cfg.GetVariant(variant); err == nil {
+		data.Flavor = v.Flavor
+		data.Description = v.Description
+		data.Packages = append(data.Packages, v.Packages...)
+		data.Scripts = append(data.Scripts, v.Scripts...)
+	} else if len(cfg.Variants) > 0 {
+		return TemplateData{}, err
+	}
+
+	for name, dep := range cfg.Dependencies {
+		depRef, err := cfg.GetDependencyRef(name)
+		if err != nil {
+			return TemplateData{}, err
+		}
+		data.Dependencies[name] = TemplateDependency{
+			Image:  dep.Image,
+			Tag:    dep.Tag,
+			Digest: dep.Digest,
+			Ref:    depRef,
+		}
+	}
+
+	return data, nil
+}
+
+// templateFuncs are the helpers available to Containerfile.tmpl
+func templateFuncs(data TemplateData) template.FuncMap {
+	return template.FuncMap{
+		"join": func(sep string, items []string) string {
+			return strings.Join(items, sep)
+		},
+		"dep": func(name string) (string, error) {
+			dep, ok := data.Dependencies[name]
+			if !ok {
+				names := make([]string, 0, len(data.Dependencies))
+				for n := range data.Dependencies {
+					names = append(names, n)
+				}
+				sort.Strings(names)
+				return "", fmt.Errorf("dependency %q not found (available: %s)", name, strings.Join(names, ", "))
+			}
+			return dep.Ref, nil
+		},
+	}
+}
+
+// ContainerfileSource returns the Containerfile or template a variant is
+// built from, relative to the project root
+func ContainerfileSource(rootDir string, cfg *config.Config, variant string) string {
+	if v, err := cfg.GetVariant(variant); err == nil && v.Containerfile != "" {
+		return v.Containerfile
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, ContainerfileTemplate)); err == nil {
+		return ContainerfileTemplate
+	}
+	return "Containerfile"
+}
+
+// isTemplate reports whether a Containerfile source needs rendering
+func isTemplate(source string) bool {
+	return strings.HasSuffix(source, ".tmpl")
+}
+
+// RenderContainerfile renders the Containerfile template of a variant: its
+// containerfile override when that is a template, else Containerfile.tmpl
+func RenderContainerfile(rootDir string, cfg *config.Config, variant, tag string) ([]byte, error) {
+	source := ContainerfileSource(rootDir, cfg, variant)
+	if !isTemplate(source) {
+		source = ContainerfileTemplate
+	}
+	text, err := os.ReadFile(filepath.Join(rootDir, source))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", source, err)
+	}
+
+	data, err := NewTemplateData(cfg, variant, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(filepath.Base(source)).
+		Option("missingkey=error").
+		Funcs(templateFuncs(data)).
+		Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", source, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("rendering %s for variant %s: %w", source, variant, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Containerfile returns the Containerfile to build a variant from. The
+// variant's containerfile override comes first, then Containerfile.tmpl,
+// then Containerfile; templates are rendered into the state directory.
+func (b *Builder) Containerfile(variant, tag string) (string, error) {
+	source := ContainerfileSource(b.rootDir, b.cfg, variant)
+	if !isTemplate(source) {
+		path := filepath.Join(b.rootDir, source)
+		if source != "Containerfile" {
+			if _, err := os.Stat(path); err != nil {
+				return "", fmt.Errorf("containerfile of variant %s: %w", variant, err)
+			}
+		}
+		return path, nil
+	}
+
+	rendered, err := RenderContainerfile(b.rootDir, b.cfg, variant, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if variant == "" {
+		variant = "main"
+	}
+	path := filepath.Join(StateDir(b.rootDir), renderedDir, "Containerfile."+variant)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("creating rendered Containerfile directory: %w", err)
+	}
+	if err := os.WriteFile(path, rendered, 0o644); err != nil {
+		return "", fmt.Errorf("writing rendered Containerfile: %w", err)
+	}
+
+	b.logger.Info("rendered Containerfile from template", "variant", variant, "path", path)
+	return path, nil
+}
@@ -0,0 +1,271 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// CloudImage is a disk image imported into a cloud
+type CloudImage struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Region   string `json:"region,omitempty"`
+	Source   string `json:"source"` // Staged object the image was imported from
+}
+
+// CloudUploadOptions configures a disk image upload
+type CloudUploadOptions struct {
+	Provider string // aws, gcp, or azure
+	Artifact string // Disk image: raw or vhd for AWS, a GCE tarball for GCP, a fixed VHD for Azure
+	Name     string // Image name
+	Arch     string // x86_64 or aarch64
+}
+
+// CloudUploader imports disk images into clouds through the provider CLIs
+type CloudUploader struct {
+	cfg    config.CloudConfig
+	logger *log.Logger
+}
+
+// uploadTimeout bounds each staging upload; disk images are several GB
+const uploadTimeout = 2 * time.Hour
+
+// gceImageName matches the image names GCE accepts
+var gceImageName = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// NewCloudUploader creates a new cloud uploader
+func NewCloudUploader(c config.CloudConfig, logger *log.Logger) *CloudUploader {
+	return &CloudUploader{cfg: c, logger: logger}
+}
+
+// Upload stages a disk image in the provider's object storage and imports it
+// as an image: an AMI through an EC2 snapshot import, a GCE image, or an
+// Azure managed image.
+func (u *CloudUploader) Upload(ctx context.Context, opts CloudUploadOptions) (*CloudImage, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("image name is required")
+	}
+	if opts.Arch == "" {
+		opts.Arch = "x86_64"
+	}
+	if opts.Arch != "x86_64" && opts.Arch != "aarch64" {
+		return nil, fmt.Errorf("unsupported architecture %q (use x86_64 or aarch64)", opts.Arch)
+	}
+
+	switch opts.Provider {
+	case "aws":
+		return u.uploadAWS(ctx, opts)
+	case "gcp":
+		return u.uploadGCP(ctx, opts)
+	case "azure":
+		return u.uploadAzure(ctx, opts)
+	}
+	return nil, fmt.Errorf("unknown provider %q (use %s)", opts.Provider, strings.Join(config.CloudProviders(), ", "))
+}
+
+// DiskImageFormat returns the format of a disk image from its file name:
+// raw, vhd, vmdk, qcow2, or gce for a GCE tarball
+func DiskImageFormat(path string) string {
+	if strings.HasSuffix(path, ".tar.gz") {
+		return "gce"
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".raw", ".img":
+		return "raw"
+	case ".vhd":
+		return "vhd"
+	case ".vmdk":
+		return "vmdk"
+	case ".qcow2":
+		return "qcow2"
+	}
+	return ""
+}
+
+func (u *CloudUploader) uploadAWS(ctx context.Context, opts CloudUploadOptions) (*CloudImage, error) {
+	c := u.cfg.AWS
+	if err := exec.RequireCommands("aws"); err != nil {
+		return nil, err
+	}
+	if c.Bucket == "" {
+		return nil, fmt.Errorf("cloud.aws.bucket is required to stage the image in S3")
+	}
+	format := DiskImageFormat(opts.Artifact)
+	if format != "raw" && format != "vhd" && format != "vmdk" {
+		return nil, fmt.Errorf("AWS imports raw, vhd, or vmdk images, not %s (build one with galena-build disk raw)", filepath.Base(opts.Artifact))
+	}
+	awsArgs := func(args ...string) []string {
+		if c.Region != "" {
+			args = append(args, "--region", c.Region)
+		}
+		return args
+	}
+
+	key := opts.Name + filepath.Ext(opts.Artifact)
+	source := "s3://" + c.Bucket + "/" + key
+	u.logger.Info("staging disk image in S3", "source", source)
+	if _, err := u.run(ctx, uploadTimeout, "aws", awsArgs("s3", "cp", opts.Artifact, source)...); err != nil {
+		return nil, err
+	}
+
+	container := fmt.Sprintf("Format=%s,UserBucket={S3Bucket=%s,S3Key=%s}", strings.ToUpper(format), c.Bucket, key)
+	taskID, err := u.run(ctx, 0, "aws", awsArgs("ec2", "import-snapshot", "--description", opts.Name,
+		"--disk-container", container, "--query", "ImportTaskId", "--output", "text")...)
+	if err != nil {
+		return nil, err
+	}
+
+	u.logger.Info("importing snapshot", "task", taskID)
+	var snapshotID string
+	for snapshotID == "" {
+		out, err := u.run(ctx, 0, "aws", awsArgs("ec2", "describe-import-snapshot-tasks", "--import-task-ids", taskID,
+			"--query", "ImportSnapshotTasks[0].SnapshotTaskDetail.[Status,SnapshotId,Progress,StatusMessage]", "--output", "text")...)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Split(out, "\t")
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		switch fields[0] {
+		case "completed":
+			snapshotID = fields[1]
+			continue
+		case "deleting", "deleted":
+			return nil, fmt.Errorf("snapshot import %s failed: %s", taskID, fields[3])
+		}
+		u.logger.Debug("snapshot import in progress", "task", taskID, "status", fields[0], "progress", fields[2])
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(15 * time.Second):
+		}
+	}
+
+	arch := "x86_64"
+	if opts.Arch == "aarch64" {
+		arch = "arm64"
+	}
+	mapping := fmt.Sprintf("DeviceName=/dev/xvda,Ebs={SnapshotId=%s,DeleteOnTermination=true,VolumeType=gp3}", snapshotID)
+	imageID, err := u.run(ctx, 0, "aws", awsArgs("ec2", "register-image", "--name", opts.Name,
+		"--architecture", arch, "--virtualization-type", "hvm", "--ena-support", "--boot-mode", "uefi-preferred",
+		"--root-device-name", "/dev/xvda", "--block-device-mappings", mapping, "--query", "ImageId", "--output", "text")...)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudImage{Provider: "aws", ID: imageID, Name: opts.Name, Region: c.Region, Source: source}, nil
+}
+
+func (u *CloudUploader) uploadGCP(ctx context.Context, opts CloudUploadOptions) (*CloudImage, error) {
+	c := u.cfg.GCP
+	if err := exec.RequireCommands("gcloud"); err != nil {
+		return nil, err
+	}
+	if c.Bucket == "" {
+		return nil, fmt.Errorf("cloud.gcp.bucket is required to stage the image in Cloud Storage")
+	}
+	if DiskImageFormat(opts.Artifact) != "gce" {
+		return nil, fmt.Errorf("GCP imports image.tar.gz tarballs, not %s (build one with galena-build disk gce)", filepath.Base(opts.Artifact))
+	}
+	if !gceImageName.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid GCE image name %q: use lowercase letters, digits, and '-'", opts.Name)
+	}
+	gcloudArgs := func(args ...string) []string {
+		if c.Project != "" {
+			args = append(args, "--project", c.Project)
+		}
+		return args
+	}
+
+	source := "gs://" + c.Bucket + "/" + opts.Name + ".tar.gz"
+	u.logger.Info("staging disk image in Cloud Storage", "source", source)
+	if _, err := u.run(ctx, uploadTimeout, "gcloud", gcloudArgs("storage", "cp", opts.Artifact, source)...); err != nil {
+		return nil, err
+	}
+
+	arch := "X86_64"
+	if opts.Arch == "aarch64" {
+		arch = "ARM64"
+	}
+	args := []string{"compute", "images", "create", opts.Name, "--source-uri", source,
+		"--architecture", arch, "--guest-os-features", "UEFI_COMPATIBLE,GVNIC", "--format", "value(id)"}
+	if c.Family != "" {
+		args = append(args, "--family", c.Family)
+	}
+	u.logger.Info("creating GCE image", "name", opts.Name)
+	imageID, err := u.run(ctx, 0, "gcloud", gcloudArgs(args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudImage{Provider: "gcp", ID: imageID, Name: opts.Name, Source: source}, nil
+}
+
+func (u *CloudUploader) uploadAzure(ctx context.Context, opts CloudUploadOptions) (*CloudImage, error) {
+	c := u.cfg.Azure
+	if err := exec.RequireCommands("az"); err != nil {
+		return nil, err
+	}
+	if c.ResourceGroup == "" || c.StorageAccount == "" {
+		return nil, fmt.Errorf("cloud.azure.resource_group and cloud.azure.storage_account are required")
+	}
+	if DiskImageFormat(opts.Artifact) != "vhd" {
+		return nil, fmt.Errorf("Azure imports fixed VHDs, not %s (build one with galena-build disk azure)", filepath.Base(opts.Artifact))
+	}
+	container := c.Container
+	if container == "" {
+		container = "images"
+	}
+
+	blob := opts.Name + ".vhd"
+	if _, err := u.run(ctx, 0, "az", "storage", "container", "create", "--account-name", c.StorageAccount,
+		"--name", container, "--auth-mode", "login", "--output", "none"); err != nil {
+		return nil, err
+	}
+	source := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", c.StorageAccount, container, blob)
+	u.logger.Info("staging disk image in blob storage", "source", source)
+	if _, err := u.run(ctx, uploadTimeout, "az", "storage", "blob", "upload", "--account-name", c.StorageAccount,
+		"--container-name", container, "--name", blob, "--file", opts.Artifact, "--type", "page",
+		"--overwrite", "--auth-mode", "login", "--output", "none"); err != nil {
+		return nil, err
+	}
+
+	arch := "x64"
+	if opts.Arch == "aarch64" {
+		arch = "Arm64"
+	}
+	args := []string{"image", "create", "--resource-group", c.ResourceGroup, "--name", opts.Name,
+		"--os-type", "Linux", "--hyper-v-generation", "V2", "--architecture", arch, "--source", source,
+		"--query", "id", "--output", "tsv"}
+	if c.Location != "" {
+		args = append(args, "--location", c.Location)
+	}
+	u.logger.Info("creating managed image", "name", opts.Name)
+	imageID, err := u.run(ctx, 0, "az", args...)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudImage{Provider: "azure", ID: imageID, Name: opts.Name, Region: c.Location, Source: source}, nil
+}
+
+// run runs a provider CLI command and returns its trimmed output. A zero
+// timeout uses the default.
+func (u *CloudUploader) run(ctx context.Context, timeout time.Duration, name string, args ...string) (string, error) {
+	opts := exec.DefaultOptions()
+	if timeout > 0 {
+		opts.Timeout = timeout
+	}
+	result := exec.Run(ctx, name, args, opts)
+	if result.Err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args[:min(2, len(args))], " "), result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
@@ -0,0 +1,159 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// knownAttestations are probed by VerifyImage in addition to the required ones
+var knownAttestations = []string{"slsaprovenance1", "spdxjson", "cyclonedx"}
+
+// SignatureInfo summarizes one verified signature
+type SignatureInfo struct {
+	Digest         string    `json:"digest"`
+	Identity       string    `json:"identity,omitempty"` // Certificate subject; empty for key-based signatures
+	Issuer         string    `json:"issuer,omitempty"`
+	RekorLogIndex  int64     `json:"rekor_log_index,omitempty"`
+	RekorTimestamp time.Time `json:"rekor_timestamp,omitzero"`
+}
+
+// AttestationStatus reports whether an attestation type is attached and verified
+type AttestationStatus struct {
+	Type     string `json:"type"`
+	Present  bool   `json:"present"`
+	Required bool   `json:"required"`
+}
+
+// Verification is the result of verifying an image
+type Verification struct {
+	Image        string              `json:"image"`
+	Verified     bool                `json:"verified"`
+	Signatures   []SignatureInfo     `json:"signatures"`
+	Attestations []AttestationStatus `json:"attestations"`
+}
+
+// VerifyImage verifies the signatures of an image against the configured
+// constraints and checks which attestations are attached. It fails when no
+// signature matches or a required attestation is missing.
+func VerifyImage(ctx context.Context, imageRef string, constraints config.VerifyConfig) (*Verification, error) {
+	if err := exec.RequireCommands("cosign"); err != nil {
+		return nil, err
+	}
+	flags, err := verifyFlags(constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &Verification{Image: imageRef}
+	args := append([]string{"verify", "--output", "json"}, flags...)
+	result := exec.Cosign(ctx, append(args, imageRef)...)
+	if result.Err != nil {
+		return verification, fmt.Errorf("signature verification failed: %s", exec.LastNLines(result.Stderr, 5))
+	}
+	if verification.Signatures, err = parseCosignVerify(result.Stdout); err != nil {
+		return verification, err
+	}
+	verification.Verified = true
+
+	required := map[string]bool{}
+	for _, t := range constraints.Attestations {
+		required[t] = true
+	}
+	types := append([]string{}, constraints.Attestations...)
+	for _, t := range knownAttestations {
+		if !required[t] {
+			types = append(types, t)
+		}
+	}
+
+	var missing []string
+	for _, t := range types {
+		args := append([]string{"verify-attestation", "--type", t}, flags...)
+		present := exec.Cosign(ctx, append(args, imageRef)...).Err == nil
+		verification.Attestations = append(verification.Attestations, AttestationStatus{Type: t, Present: present, Required: required[t]})
+		if !present && required[t] {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		verification.Verified = false
+		return verification, fmt.Errorf("required attestations missing or unverified: %s", strings.Join(missing, ", "))
+	}
+	return verification, nil
+}
+
+// verifyFlags turns the constraints into cosign flags
+func verifyFlags(c config.VerifyConfig) ([]string, error) {
+	if c.Key != "" {
+		return []string{"--key", c.Key}, nil
+	}
+
+	var flags []string
+	switch {
+	case c.Identity != "":
+		flags = append(flags, "--certificate-identity", c.Identity)
+	case c.IdentityRegexp != "":
+		flags = append(flags, "--certificate-identity-regexp", c.IdentityRegexp)
+	default:
+		return nil, fmt.Errorf("keyless verification needs a certificate identity: set verify.identity in galena.yaml or pass --certificate-identity")
+	}
+	switch {
+	case c.Issuer != "":
+		flags = append(flags, "--certificate-oidc-issuer", c.Issuer)
+	case c.IssuerRegexp != "":
+		flags = append(flags, "--certificate-oidc-issuer-regexp", c.IssuerRegexp)
+	default:
+		return nil, fmt.Errorf("keyless verification needs an OIDC issuer: set verify.issuer in galena.yaml or pass --certificate-oidc-issuer")
+	}
+	return flags, nil
+}
+
+// cosignSignature is the part of a cosign verify JSON entry used in the summary
+type cosignSignature struct {
+	Critical struct {
+		Image struct {
+			Digest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+	Optional struct {
+		Subject string `json:"Subject"`
+		Issuer  string `json:"Issuer"`
+		Bundle  *struct {
+			Payload struct {
+				IntegratedTime int64 `json:"integratedTime"`
+				LogIndex       int64 `json:"logIndex"`
+			} `json:"Payload"`
+		} `json:"Bundle"`
+	} `json:"optional"`
+}
+
+// parseCosignVerify parses the JSON printed by cosign verify
+func parseCosignVerify(out string) ([]SignatureInfo, error) {
+	var entries []cosignSignature
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &entries); err != nil {
+		return nil, fmt.Errorf("parsing cosign output: %w", err)
+	}
+
+	signatures := make([]SignatureInfo, 0, len(entries))
+	for _, e := range entries {
+		sig := SignatureInfo{
+			Digest:   e.Critical.Image.Digest,
+			Identity: e.Optional.Subject,
+			Issuer:   e.Optional.Issuer,
+		}
+		if b := e.Optional.Bundle; b != nil {
+			sig.RekorLogIndex = b.Payload.LogIndex
+			if b.Payload.IntegratedTime > 0 {
+				sig.RekorTimestamp = time.Unix(b.Payload.IntegratedTime, 0).UTC()
+			}
+		}
+		signatures = append(signatures, sig)
+	}
+	return signatures, nil
+}
@@ -3,12 +3,17 @@ package build
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/iiroan/galena/internal/config"
 	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/platform"
 )
 
 // VMRunner runs virtual machines for testing
@@ -20,22 +25,34 @@ type VMRunner struct {
 
 // VMOptions configures VM execution
 type VMOptions struct {
-	ImagePath string
-	Memory    string // e.g., "4G"
-	CPUs      int
-	Display   string // gtk, sdl, vnc, none
-	SSH       bool
-	SSHPort   int
-	KVM       bool
-	UEFI      bool
+	ImagePath  string
+	Memory     string // e.g., "4G"
+	CPUs       int
+	Display    string // gtk, sdl, cocoa, vnc, none
+	SSH        bool
+	SSHPort    int
+	KVM        bool // Hardware acceleration: KVM on Linux, HVF on macOS
+	UEFI       bool
+	Provision  *VMProvision  // Optional first-boot user and SSH key
+	Headless   bool          // No display: the serial console is attached to the terminal and teed to SerialLog
+	SerialLog  string        // Serial console log; without Headless QEMU writes it directly
+	Snapshot   bool          // Discard writes to the disk image
+	Publish    []PortForward // Guest ports published on the host, besides SSH
+	Volumes    []VMVolume    // Host directories shared with the guest
+	TPM        bool          // Attach a swtpm TPM 2.0 emulator
+	SecureBoot bool          // Boot OVMF with Secure Boot and the Microsoft keys enrolled
 }
 
 // DefaultVMOptions returns default VM options
 func DefaultVMOptions() VMOptions {
+	display := "gtk"
+	if runtime.GOOS == "darwin" {
+		display = "cocoa"
+	}
 	return VMOptions{
 		Memory:  "4G",
 		CPUs:    2,
-		Display: "gtk",
+		Display: display,
 		SSH:     true,
 		SSHPort: 2222,
 		KVM:     true,
@@ -64,23 +81,48 @@ func (v *VMRunner) Run(ctx context.Context, opts VMOptions) error {
 	}
 
 	// Determine which QEMU to use
-	qemuBinary := "qemu-system-x86_64"
+	qemuBinary := qemuSystem()
 	if err := exec.RequireCommands(qemuBinary); err != nil {
 		return err
 	}
 
+	res, cleanup, err := v.prepare(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	v.logger.Info("starting VM",
 		"image", opts.ImagePath,
 		"memory", opts.Memory,
 		"cpus", opts.CPUs,
 	)
 
-	args := v.buildQEMUArgs(opts)
+	args := v.buildQEMUArgs(opts, res)
 
 	v.logger.Debug("running qemu", "args", args)
 
+	// A VM runs until it is shut down
 	execOpts := exec.DefaultOptions()
 	execOpts.StreamStdio = true
+	execOpts.Timeout = 0
+
+	// Tee the console on stdio into the serial log
+	if opts.Headless {
+		execOpts.Stdin = os.Stdin
+		if opts.SerialLog != "" {
+			if err := os.MkdirAll(filepath.Dir(opts.SerialLog), 0o755); err != nil {
+				return fmt.Errorf("creating log directory: %w", err)
+			}
+			logFile, err := os.OpenFile(opts.SerialLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				return fmt.Errorf("opening serial log: %w", err)
+			}
+			defer logFile.Close()
+			ctx = exec.WithBuildOutput(ctx, io.MultiWriter(os.Stdout, logFile))
+			v.logger.Info("logging serial console", "path", opts.SerialLog)
+		}
+	}
 
 	result := exec.Run(ctx, qemuBinary, args, execOpts)
 	if result.Err != nil {
@@ -91,27 +133,131 @@ func (v *VMRunner) Run(ctx context.Context, opts VMOptions) error {
 	return nil
 }
 
-// buildQEMUArgs constructs QEMU arguments
-func (v *VMRunner) buildQEMUArgs(opts VMOptions) []string {
+// SerialLogPath returns a new timestamped serial console log in the logs directory
+func (v *VMRunner) SerialLogPath() string {
+	return filepath.Join(v.rootDir, "logs", fmt.Sprintf("vm-%s.log", time.Now().Format("20060102-150405")))
+}
+
+// FindSerialLog returns the most recent VM serial console log
+func (v *VMRunner) FindSerialLog() (string, error) {
+	logs, err := filepath.Glob(filepath.Join(v.rootDir, "logs", "vm-*.log"))
+	if err != nil {
+		return "", err
+	}
+	newest := ""
+	var newestTime time.Time
+	for _, path := range logs {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = path, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no VM log found in %s (start one with vm run --headless)", filepath.Join(v.rootDir, "logs"))
+	}
+	return newest, nil
+}
+
+// provision prepares the first-boot SSH login of opts and returns the
+// cloud-init seed to attach, if any, and a function removing it
+func (v *VMRunner) provision(ctx context.Context, opts VMOptions) (string, func(), error) {
+	if opts.Provision == nil {
+		return "", func() {}, nil
+	}
+	if err := opts.Provision.Validate(); err != nil {
+		return "", nil, err
+	}
+	v.logger.Info("provisioning VM", "method", opts.Provision.Method, "user", opts.Provision.LoginUser())
+	if opts.Provision.Method != ProvisionCloudInit {
+		return "", func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "galena-vm-")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating seed directory: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	seed, err := v.cloudInitSeed(ctx, dir, *opts.Provision)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return seed, cleanup, nil
+}
+
+// qemuSystem returns the QEMU emulator matching the host architecture, so
+// the guest runs accelerated: aarch64 on Apple silicon and ARM servers,
+// x86_64 elsewhere
+func qemuSystem() string {
+	if runtime.GOARCH == "arm64" {
+		return "qemu-system-aarch64"
+	}
+	return "qemu-system-x86_64"
+}
+
+// uefiFirmware lists common UEFI firmware paths per emulator, as shipped by
+// Fedora, Debian/Ubuntu and Homebrew
+var uefiFirmware = map[string][]string{
+	"qemu-system-x86_64": {
+		"/usr/share/edk2/ovmf/OVMF_CODE.fd",
+		"/usr/share/OVMF/OVMF_CODE.fd",
+		"/usr/share/qemu/OVMF.fd",
+		"/opt/homebrew/share/qemu/edk2-x86_64-code.fd",
+		"/usr/local/share/qemu/edk2-x86_64-code.fd",
+	},
+	"qemu-system-aarch64": {
+		"/usr/share/edk2/aarch64/QEMU_EFI.fd",
+		"/usr/share/AAVMF/AAVMF_CODE.fd",
+		"/usr/share/qemu-efi-aarch64/QEMU_EFI.fd",
+		"/opt/homebrew/share/qemu/edk2-aarch64-code.fd",
+		"/usr/local/share/qemu/edk2-aarch64-code.fd",
+	},
+}
+
+// buildQEMUArgs constructs QEMU arguments, attaching the prepared resources
+func (v *VMRunner) buildQEMUArgs(opts VMOptions, res vmResources) []string {
+	qemuBinary := qemuSystem()
+	arm := qemuBinary == "qemu-system-aarch64"
+
 	args := []string{
 		"-m", opts.Memory,
 		"-smp", fmt.Sprintf("%d", opts.CPUs),
 	}
 
-	// KVM acceleration
+	// ARM has no default machine
+	if arm {
+		args = append(args, "-machine", "virt")
+	}
+
+	// Hardware acceleration
+	accel := ""
 	if opts.KVM {
+		accel = platform.Accelerator()
+	}
+	switch {
+	case accel == "kvm":
 		args = append(args, "-enable-kvm", "-cpu", "host")
+	case accel == "hvf":
+		args = append(args, "-accel", "hvf", "-cpu", "host")
+	case arm:
+		args = append(args, "-cpu", "max")
 	}
 
 	// UEFI firmware
-	if opts.UEFI {
-		// Try common OVMF paths
-		ovmfPaths := []string{
-			"/usr/share/edk2/ovmf/OVMF_CODE.fd",
-			"/usr/share/OVMF/OVMF_CODE.fd",
-			"/usr/share/qemu/OVMF.fd",
-		}
-		for _, path := range ovmfPaths {
+	if opts.SecureBoot {
+		// Secure Boot firmware must be flash, protected by SMM on q35
+		args = append(args,
+			"-machine", "q35,smm=on",
+			"-global", "driver=cfi.pflash01,property=secure,value=on",
+			"-drive", fmt.Sprintf("if=pflash,format=raw,unit=0,readonly=on,file=%s", res.FirmwareCode),
+			"-drive", fmt.Sprintf("if=pflash,format=raw,unit=1,file=%s", res.FirmwareVars),
+		)
+	} else if opts.UEFI || arm {
+		// ARM guests only boot with UEFI
+		for _, path := range uefiFirmware[qemuBinary] {
 			if _, err := os.Stat(path); err == nil {
 				args = append(args, "-bios", path)
 				break
@@ -120,14 +266,29 @@ func (v *VMRunner) buildQEMUArgs(opts VMOptions) []string {
 	}
 
 	// Display
-	switch opts.Display {
-	case "none":
+	switch {
+	case opts.Headless:
 		args = append(args, "-nographic")
-	case "vnc":
+	case opts.Display == "none":
+		if opts.SerialLog != "" {
+			args = append(args, "-display", "none")
+		} else {
+			args = append(args, "-nographic")
+		}
+	case opts.Display == "vnc":
 		args = append(args, "-vnc", ":0")
 	default:
 		args = append(args, "-display", opts.Display)
 	}
+	// The ARM virt machine has no VGA or PS/2 devices
+	if arm && !opts.Headless && opts.Display != "none" {
+		args = append(args,
+			"-device", "virtio-gpu-pci",
+			"-device", "qemu-xhci",
+			"-device", "usb-kbd",
+			"-device", "usb-tablet",
+		)
+	}
 
 	// Disk image
 	ext := filepath.Ext(opts.ImagePath)
@@ -136,15 +297,52 @@ func (v *VMRunner) buildQEMUArgs(opts VMOptions) []string {
 		format = "qcow2"
 	}
 	args = append(args, "-drive", fmt.Sprintf("file=%s,format=%s,if=virtio", opts.ImagePath, format))
+	if opts.Snapshot {
+		args = append(args, "-snapshot")
+	}
+	if opts.SerialLog != "" && !opts.Headless {
+		args = append(args, "-serial", "file:"+opts.SerialLog)
+	}
+
+	// TPM 2.0 emulator
+	if res.TPMSocket != "" {
+		tpmDevice := "tpm-tis"
+		if arm {
+			tpmDevice = "tpm-tis-device"
+		}
+		args = append(args,
+			"-chardev", "socket,id=chrtpm,path="+res.TPMSocket,
+			"-tpmdev", "emulator,id=tpm0,chardev=chrtpm",
+			"-device", tpmDevice+",tpmdev=tpm0",
+		)
+	}
+
+	// First-boot provisioning
+	if res.Seed != "" {
+		args = append(args, "-drive", fmt.Sprintf("file=%s,format=raw,if=virtio,readonly=on", res.Seed))
+	}
+	if opts.Provision != nil && opts.Provision.Method == ProvisionSMBIOS {
+		args = append(args, opts.Provision.SMBIOSArgs()...)
+	}
 
-	// Network with SSH forwarding
-	if opts.SSH {
-		args = append(args, "-netdev", fmt.Sprintf("user,id=net0,hostfwd=tcp::%d-:22", opts.SSHPort))
+	// Network with SSH and published port forwarding
+	if opts.SSH || len(opts.Publish) > 0 {
+		netdev := "user,id=net0"
+		if opts.SSH {
+			netdev += fmt.Sprintf(",hostfwd=tcp::%d-:22", opts.SSHPort)
+		}
+		for _, p := range opts.Publish {
+			netdev += "," + p.hostfwd()
+		}
+		args = append(args, "-netdev", netdev)
 		args = append(args, "-device", "virtio-net-pci,netdev=net0")
 	} else {
 		args = append(args, "-net", "none")
 	}
 
+	// Shared folders
+	args = append(args, volumeArgs(opts.Volumes)...)
+
 	return args
 }
 
@@ -203,6 +401,16 @@ func (v *VMRunner) SSH(ctx context.Context, port int, user string) error {
 
 // FindDiskImage finds the most recent disk image in the output directory
 func (v *VMRunner) FindDiskImage(outputDir string) (string, error) {
+	images, err := v.FindDiskImages(outputDir)
+	if err != nil {
+		return "", err
+	}
+	return images[0], nil
+}
+
+// FindDiskImages lists the bootable disk images in the output directory,
+// newest first
+func (v *VMRunner) FindDiskImages(outputDir string) ([]string, error) {
 	if outputDir == "" {
 		outputDir = filepath.Join(v.rootDir, "output")
 	}
@@ -210,8 +418,8 @@ func (v *VMRunner) FindDiskImage(outputDir string) (string, error) {
 	// Look for common disk image extensions
 	extensions := []string{".qcow2", ".raw", ".img"}
 
-	var newest string
-	var newestTime int64
+	var images []string
+	modTimes := map[string]int64{}
 
 	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() {
@@ -221,10 +429,8 @@ func (v *VMRunner) FindDiskImage(outputDir string) (string, error) {
 		ext := filepath.Ext(path)
 		for _, e := range extensions {
 			if ext == e {
-				if info.ModTime().Unix() > newestTime {
-					newest = path
-					newestTime = info.ModTime().Unix()
-				}
+				images = append(images, path)
+				modTimes[path] = info.ModTime().UnixNano()
 				break
 			}
 		}
@@ -232,12 +438,15 @@ func (v *VMRunner) FindDiskImage(outputDir string) (string, error) {
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("walking output directory: %w", err)
+		return nil, fmt.Errorf("walking output directory: %w", err)
 	}
 
-	if newest == "" {
-		return "", fmt.Errorf("no disk image found in %s", outputDir)
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no disk image found in %s", outputDir)
 	}
 
-	return newest, nil
+	sort.SliceStable(images, func(i, j int) bool {
+		return modTimes[images[i]] > modTimes[images[j]]
+	})
+	return images, nil
 }
@@ -0,0 +1,164 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// vmResources are the files a VM run needs besides the disk image
+type vmResources struct {
+	Seed         string // cloud-init seed ISO
+	TPMSocket    string // swtpm control socket
+	FirmwareCode string // Secure Boot OVMF code
+	FirmwareVars string // Per-image copy of the OVMF variables with enrolled keys
+}
+
+// secureBootFirmware lists OVMF code and variable templates with the
+// Microsoft keys enrolled, as shipped by Fedora and Debian/Ubuntu
+var secureBootFirmware = [][2]string{
+	{"/usr/share/edk2/ovmf/OVMF_CODE.secboot.fd", "/usr/share/edk2/ovmf/OVMF_VARS.secboot.fd"},
+	{"/usr/share/OVMF/OVMF_CODE_4M.secboot.fd", "/usr/share/OVMF/OVMF_VARS_4M.ms.fd"},
+	{"/usr/share/OVMF/OVMF_CODE.secboot.fd", "/usr/share/OVMF/OVMF_VARS.ms.fd"},
+}
+
+// prepare sets up everything opts needs besides the disk image and returns
+// a function releasing it
+func (v *VMRunner) prepare(ctx context.Context, opts VMOptions) (vmResources, func(), error) {
+	var res vmResources
+	if opts.SecureBoot && !opts.UEFI {
+		return res, nil, fmt.Errorf("secure boot needs UEFI, drop --no-uefi")
+	}
+	if opts.SecureBoot && qemuSystem() != "qemu-system-x86_64" {
+		return res, nil, fmt.Errorf("secure boot emulation is supported for x86_64 hosts only")
+	}
+
+	cleanups := []func(){}
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	seed, removeSeed, err := v.provision(ctx, opts)
+	if err != nil {
+		return res, nil, err
+	}
+	res.Seed = seed
+	cleanups = append(cleanups, removeSeed)
+
+	if opts.TPM || opts.SecureBoot {
+		stateDir, err := v.vmStateDir(opts.ImagePath)
+		if err != nil {
+			cleanup()
+			return res, nil, err
+		}
+		if opts.SecureBoot {
+			if res.FirmwareCode, res.FirmwareVars, err = secureBootVars(stateDir); err != nil {
+				cleanup()
+				return res, nil, err
+			}
+			v.logger.Info("secure boot enabled", "firmware", res.FirmwareCode)
+		}
+		if opts.TPM {
+			socket, stopTPM, err := v.startTPM(ctx, stateDir)
+			if err != nil {
+				cleanup()
+				return res, nil, err
+			}
+			res.TPMSocket = socket
+			cleanups = append(cleanups, stopTPM)
+		}
+	}
+	return res, cleanup, nil
+}
+
+// vmStateDir returns the directory that keeps the TPM state and UEFI
+// variables of a disk image across runs, so enrolled keys and sealed
+// secrets survive a reboot of the VM
+func (v *VMRunner) vmStateDir(image string) (string, error) {
+	abs, err := filepath.Abs(image)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs)) + "-" + hex.EncodeToString(sum[:4])
+	dir := filepath.Join(v.rootDir, "output", ".galena-vm", name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating VM state directory: %w", err)
+	}
+	return dir, nil
+}
+
+// secureBootVars returns the Secure Boot OVMF code and the image's copy of
+// the enrolled variables, creating it from the template on first use
+func secureBootVars(stateDir string) (string, string, error) {
+	for _, fw := range secureBootFirmware {
+		if _, err := os.Stat(fw[0]); err != nil {
+			continue
+		}
+		template, err := os.ReadFile(fw[1])
+		if err != nil {
+			continue
+		}
+		vars := filepath.Join(stateDir, "OVMF_VARS.fd")
+		if _, err := os.Stat(vars); os.IsNotExist(err) {
+			if err := os.WriteFile(vars, template, 0o600); err != nil {
+				return "", "", fmt.Errorf("copying UEFI variables: %w", err)
+			}
+		}
+		return fw[0], vars, nil
+	}
+	return "", "", fmt.Errorf("no Secure Boot OVMF firmware found, install edk2-ovmf (Fedora) or ovmf (Debian/Ubuntu)")
+}
+
+// startTPM starts a swtpm TPM 2.0 emulator keeping its state in stateDir
+// and returns its socket and a function stopping it. swtpm also exits when
+// QEMU disconnects.
+func (v *VMRunner) startTPM(ctx context.Context, stateDir string) (string, func(), error) {
+	if err := exec.RequireCommands("swtpm"); err != nil {
+		return "", nil, err
+	}
+	tpmDir := filepath.Join(stateDir, "tpm")
+	if err := os.MkdirAll(tpmDir, 0o700); err != nil {
+		return "", nil, fmt.Errorf("creating TPM state directory: %w", err)
+	}
+	// Unix socket paths are limited to 108 bytes, so the socket lives in /tmp
+	runDir, err := os.MkdirTemp("", "galena-swtpm-")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating TPM socket directory: %w", err)
+	}
+	socket := filepath.Join(runDir, "swtpm.sock")
+	pidFile := filepath.Join(runDir, "swtpm.pid")
+	stop := func() {
+		if data, err := os.ReadFile(pidFile); err == nil {
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				if p, err := os.FindProcess(pid); err == nil {
+					_ = p.Signal(syscall.SIGTERM)
+				}
+			}
+		}
+		_ = os.RemoveAll(runDir)
+	}
+
+	args := []string{"socket", "--tpm2",
+		"--tpmstate", "dir=" + tpmDir,
+		"--ctrl", "type=unixio,path=" + socket,
+		"--pid", "file=" + pidFile,
+		"--daemon", "--terminate"}
+	result := exec.Run(ctx, "swtpm", args, exec.DefaultOptions())
+	if result.Err != nil {
+		stop()
+		return "", nil, fmt.Errorf("starting swtpm: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	v.logger.Info("TPM emulator started", "state", tpmDir)
+	return socket, stop, nil
+}
@@ -0,0 +1,156 @@
+package build
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// VM provisioning methods
+const (
+	ProvisionCloudInit = "cloud-init" // NoCloud seed ISO attached as a CD-ROM
+	ProvisionSMBIOS    = "smbios"     // systemd credentials passed as SMBIOS strings
+)
+
+// ProvisionMethods returns the supported VM provisioning methods
+func ProvisionMethods() []string {
+	return []string{ProvisionCloudInit, ProvisionSMBIOS}
+}
+
+// VMProvision makes a test VM reachable over SSH on its first boot
+type VMProvision struct {
+	Method   string // cloud-init or smbios
+	User     string // User created by cloud-init; smbios authorizes root
+	SSHKey   string // SSH public key
+	Hostname string
+}
+
+// hostnamePattern matches a single DNS label
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([-a-zA-Z0-9]{0,61}[a-zA-Z0-9])?$`)
+
+// Validate checks the method, user, key, and hostname
+func (p VMProvision) Validate() error {
+	if !containsString(ProvisionMethods(), p.Method) {
+		return fmt.Errorf("unknown provisioning method %q (use %s)", p.Method, strings.Join(ProvisionMethods(), " or "))
+	}
+	if p.Method == ProvisionCloudInit {
+		if err := ValidateDiskUserName(p.User); err != nil {
+			return err
+		}
+	}
+	if p.SSHKey == "" {
+		return fmt.Errorf("an SSH public key is required to provision the VM")
+	}
+	if err := ValidateSSHKey(p.SSHKey); err != nil {
+		return err
+	}
+	if p.Hostname != "" && !hostnamePattern.MatchString(p.Hostname) {
+		return fmt.Errorf("invalid hostname %q", p.Hostname)
+	}
+	return nil
+}
+
+// LoginUser returns the user to connect as once the VM is provisioned
+func (p VMProvision) LoginUser() string {
+	if p.Method == ProvisionSMBIOS {
+		return "root"
+	}
+	return p.User
+}
+
+// cloudConfig is the subset of cloud-config user-data galena writes
+type cloudConfig struct {
+	Hostname string      `yaml:"hostname,omitempty"`
+	Users    []cloudUser `yaml:"users"`
+}
+
+type cloudUser struct {
+	Name              string   `yaml:"name"`
+	Groups            string   `yaml:"groups"`
+	Sudo              string   `yaml:"sudo"`
+	LockPasswd        bool     `yaml:"lock_passwd"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+}
+
+// UserData returns the cloud-config user-data that creates the user
+func (p VMProvision) UserData() (string, error) {
+	data, err := yaml.Marshal(cloudConfig{
+		Hostname: p.Hostname,
+		Users: []cloudUser{{
+			Name:              p.User,
+			Groups:            "wheel",
+			Sudo:              "ALL=(ALL) NOPASSWD:ALL",
+			LockPasswd:        true,
+			SSHAuthorizedKeys: []string{p.SSHKey},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	return "#cloud-config\n" + string(data), nil
+}
+
+// SMBIOSArgs returns the QEMU arguments that pass the SSH key and hostname
+// as systemd credentials. systemd installs ssh.authorized_keys.root for root
+// on boot, so no agent is needed in the image.
+func (p VMProvision) SMBIOSArgs() []string {
+	key := base64.StdEncoding.EncodeToString([]byte(p.SSHKey + "\n"))
+	args := []string{"-smbios", "type=11,value=io.systemd.credential.binary:ssh.authorized_keys.root=" + key}
+	if p.Hostname != "" {
+		args = append(args, "-smbios", "type=11,value=io.systemd.credential:system.hostname="+p.Hostname)
+	}
+	return args
+}
+
+// cloudInitSeed writes a NoCloud seed ISO with the user-data and meta-data
+// to dir and returns its path
+func (v *VMRunner) cloudInitSeed(ctx context.Context, dir string, p VMProvision) (string, error) {
+	var tool []string
+	switch {
+	case exec.CheckCommand("genisoimage"):
+		tool = []string{"genisoimage"}
+	case exec.CheckCommand("mkisofs"):
+		tool = []string{"mkisofs"}
+	case exec.CheckCommand("xorriso"):
+		tool = []string{"xorriso", "-as", "mkisofs"}
+	default:
+		return "", fmt.Errorf("creating a cloud-init seed needs genisoimage, mkisofs, or xorriso")
+	}
+
+	userData, err := p.UserData()
+	if err != nil {
+		return "", fmt.Errorf("rendering user-data: %w", err)
+	}
+	hostname := p.Hostname
+	if hostname == "" {
+		hostname = "galena"
+	}
+	metaData := fmt.Sprintf("instance-id: galena-%d\nlocal-hostname: %s\n", time.Now().Unix(), hostname)
+
+	files := map[string]string{"user-data": userData, "meta-data": metaData}
+	for _, name := range sortedKeys(files) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(files[name]), 0o644); err != nil {
+			return "", fmt.Errorf("writing %s: %w", name, err)
+		}
+	}
+
+	seed := filepath.Join(dir, "seed.iso")
+	args := append(tool[1:], "-output", seed, "-volid", "cidata", "-joliet", "-rock", "user-data", "meta-data")
+	opts := exec.DefaultOptions()
+	opts.Dir = dir
+	result := exec.Run(ctx, tool[0], args, opts)
+	if result.Err != nil {
+		return "", fmt.Errorf("creating cloud-init seed: %w: %s", result.Err, exec.LastNLines(result.Stderr, 5))
+	}
+	v.logger.Debug("created cloud-init seed", "path", seed)
+	return seed, nil
+}
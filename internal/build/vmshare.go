@@ -0,0 +1,124 @@
+package build
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PortForward publishes a guest port on the host
+type PortForward struct {
+	HostIP    string // Host address to bind (default: all)
+	HostPort  int
+	GuestPort int
+	Protocol  string // tcp or udp
+}
+
+// VMVolume shares a host directory with the guest over 9p
+type VMVolume struct {
+	HostPath  string
+	GuestPath string
+	ReadOnly  bool
+}
+
+// ParsePortForward parses a [ip:]host:guest[/tcp|/udp] publish spec, like
+// podman's --publish
+func ParsePortForward(spec string) (PortForward, error) {
+	p := PortForward{Protocol: "tcp"}
+	ports := spec
+	if base, proto, ok := strings.Cut(spec, "/"); ok {
+		if proto != "tcp" && proto != "udp" {
+			return p, fmt.Errorf("invalid publish %q: protocol must be tcp or udp", spec)
+		}
+		ports, p.Protocol = base, proto
+	}
+
+	parts := strings.Split(ports, ":")
+	switch len(parts) {
+	case 2:
+	case 3:
+		p.HostIP = parts[0]
+		parts = parts[1:]
+	default:
+		return p, fmt.Errorf("invalid publish %q: use [ip:]host:guest[/protocol]", spec)
+	}
+	var err error
+	if p.HostPort, err = parsePort(parts[0]); err != nil {
+		return p, fmt.Errorf("invalid publish %q: %w", spec, err)
+	}
+	if p.GuestPort, err = parsePort(parts[1]); err != nil {
+		return p, fmt.Errorf("invalid publish %q: %w", spec, err)
+	}
+	return p, nil
+}
+
+// parsePort parses a TCP or UDP port number
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%q is not a port number", s)
+	}
+	return port, nil
+}
+
+// hostfwd returns the QEMU user networking rule of the forward
+func (p PortForward) hostfwd() string {
+	return fmt.Sprintf("hostfwd=%s:%s:%d-:%d", p.Protocol, p.HostIP, p.HostPort, p.GuestPort)
+}
+
+// ParseVolume parses a host:guest[:ro] volume spec, like podman's --volume.
+// The host directory must exist.
+func ParseVolume(spec string) (VMVolume, error) {
+	var v VMVolume
+	parts := strings.Split(spec, ":")
+	switch {
+	case len(parts) == 3 && (parts[2] == "ro" || parts[2] == "rw"):
+		v.ReadOnly = parts[2] == "ro"
+	case len(parts) != 2:
+		return v, fmt.Errorf("invalid volume %q: use host:guest[:ro]", spec)
+	}
+
+	host, err := filepath.Abs(parts[0])
+	if err != nil {
+		return v, err
+	}
+	if info, err := os.Stat(host); err != nil {
+		return v, fmt.Errorf("volume %q: %w", spec, err)
+	} else if !info.IsDir() {
+		return v, fmt.Errorf("volume %q: %s is not a directory", spec, host)
+	}
+	if !filepath.IsAbs(parts[1]) || strings.ContainsAny(parts[1], " \t,") {
+		return v, fmt.Errorf("volume %q: the guest path must be absolute without spaces or commas", spec)
+	}
+	v.HostPath = host
+	v.GuestPath = filepath.Clean(parts[1])
+	return v, nil
+}
+
+// volumeArgs returns the QEMU arguments that export the volumes over 9p.
+// The mounts are passed as a systemd fstab.extra credential, so systemd
+// 254+ guests mount them on boot without further setup.
+func volumeArgs(volumes []VMVolume) []string {
+	if len(volumes) == 0 {
+		return nil
+	}
+	var args []string
+	var fstab strings.Builder
+	for i, v := range volumes {
+		tag := fmt.Sprintf("galena%d", i)
+		virtfs := fmt.Sprintf("local,path=%s,mount_tag=%s,security_model=none,id=%s",
+			strings.ReplaceAll(v.HostPath, ",", ",,"), tag, tag)
+		options := "trans=virtio,version=9p2000.L,msize=1048576,nofail"
+		if v.ReadOnly {
+			virtfs += ",readonly=on"
+			options += ",ro"
+		}
+		args = append(args, "-virtfs", virtfs)
+		fmt.Fprintf(&fstab, "%s %s 9p %s 0 0\n", tag, v.GuestPath, options)
+	}
+	credential := base64.StdEncoding.EncodeToString([]byte(fstab.String()))
+	return append(args, "-smbios", "type=11,value=io.systemd.credential.binary:fstab.extra="+credential)
+}
@@ -0,0 +1,123 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// VMSnapshot is an internal snapshot of a qcow2 disk image
+type VMSnapshot struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// snapshotName matches the snapshot names galena creates and reverts to
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// qemuImgInfo is the part of qemu-img info --output=json galena reads
+type qemuImgInfo struct {
+	Format    string `json:"format"`
+	Snapshots []struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		DateSec int64  `json:"date-sec"`
+	} `json:"snapshots"`
+}
+
+// ListSnapshots returns the internal snapshots of a qcow2 image, oldest first
+func (v *VMRunner) ListSnapshots(ctx context.Context, image string) ([]VMSnapshot, error) {
+	// -U reads the image even while a VM holds its lock
+	out, err := v.qemuImg(ctx, "info", "-U", "--output=json", image)
+	if err != nil {
+		return nil, err
+	}
+	var info qemuImgInfo
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return nil, fmt.Errorf("parsing qemu-img info: %w", err)
+	}
+	if info.Format != "qcow2" {
+		return nil, fmt.Errorf("%s is a %s image; snapshots need qcow2 (build one with galena-build disk qcow2)", image, info.Format)
+	}
+
+	snapshots := make([]VMSnapshot, 0, len(info.Snapshots))
+	for _, s := range info.Snapshots {
+		snapshots = append(snapshots, VMSnapshot{ID: s.ID, Name: s.Name, Created: time.Unix(s.DateSec, 0)})
+	}
+	return snapshots, nil
+}
+
+// CreateSnapshot records the current state of a qcow2 image under name.
+// The VM using the image must be shut down.
+func (v *VMRunner) CreateSnapshot(ctx context.Context, image, name string) error {
+	if !snapshotName.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	snapshots, err := v.ListSnapshots(ctx, image)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if s.Name == name {
+			return fmt.Errorf("snapshot %q already exists in %s", name, image)
+		}
+	}
+
+	v.logger.Info("creating snapshot", "image", image, "name", name)
+	_, err = v.qemuImg(ctx, "snapshot", "-c", name, image)
+	return err
+}
+
+// RevertSnapshot rolls a qcow2 image back to a snapshot, discarding every
+// change made since. An empty name reverts to the newest snapshot. The VM
+// using the image must be shut down. It returns the snapshot reverted to.
+func (v *VMRunner) RevertSnapshot(ctx context.Context, image, name string) (*VMSnapshot, error) {
+	snapshots, err := v.ListSnapshots(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("%s has no snapshots", image)
+	}
+
+	target := &snapshots[len(snapshots)-1]
+	if name != "" {
+		target = nil
+		for i := range snapshots {
+			if snapshots[i].Name == name || snapshots[i].ID == name {
+				target = &snapshots[i]
+			}
+		}
+		if target == nil {
+			return nil, fmt.Errorf("snapshot %q not found in %s", name, image)
+		}
+	}
+
+	v.logger.Info("reverting to snapshot", "image", image, "name", target.Name)
+	if _, err := v.qemuImg(ctx, "snapshot", "-a", target.Name, image); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// qemuImg runs qemu-img and returns its output
+func (v *VMRunner) qemuImg(ctx context.Context, args ...string) (string, error) {
+	if err := exec.RequireCommands("qemu-img"); err != nil {
+		return "", err
+	}
+	result := exec.Run(ctx, "qemu-img", args, exec.DefaultOptions())
+	if result.Err != nil {
+		stderr := exec.LastNLines(result.Stderr, 5)
+		if strings.Contains(stderr, "lock") {
+			return "", fmt.Errorf("qemu-img %s: the image is in use, shut the VM down first: %s", args[0], stderr)
+		}
+		return "", fmt.Errorf("qemu-img %s: %w: %s", args[0], result.Err, stderr)
+	}
+	return result.Stdout, nil
+}
@@ -0,0 +1,235 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// VMTestOptions configures a VM smoke test
+type VMTestOptions struct {
+	VM          VMOptions          // Provision is required; the VM runs without a display
+	BootTimeout time.Duration      // Time to wait for SSH
+	Builtin     []string           // Built-in checks, see config.VMTestBuiltins
+	Checks      []config.SmokeTest // Extra checks, run as root in the VM
+	Identity    string             // SSH private key (default: ssh's own)
+}
+
+// VMTestReport is the outcome of a VM smoke test
+type VMTestReport struct {
+	Image     string        `json:"image"`
+	SerialLog string        `json:"serial_log"`
+	BootTime  time.Duration `json:"boot_time"`
+	Tests     []TestResult  `json:"tests"`
+}
+
+// vmBuiltinChecks are the shell scripts of the built-in checks
+var vmBuiltinChecks = map[string]string{
+	"bootc-status": `bootc status`,
+	"failed-units": `timeout 120 systemctl is-system-running --wait >/dev/null 2>&1
+failed=$(systemctl list-units --failed --plain --no-legend)
+if [ -n "$failed" ]; then echo "$failed"; exit 1; fi`,
+	"flatpaks": `missing=""
+for id in $(sed -n 's/^\[Flatpak Preinstall \(.*\)\]$/\1/p' /etc/flatpak/preinstall.d/*.preinstall /usr/share/flatpak/preinstall.d/*.preinstall 2>/dev/null); do
+    flatpak info "$id" >/dev/null 2>&1 || missing="$missing $id"
+done
+if [ -n "$missing" ]; then echo "missing flatpaks:$missing"; exit 1; fi`,
+}
+
+// vmCheckTimeout bounds each check run in the VM
+const vmCheckTimeout = 5 * time.Minute
+
+// Test boots a disk image headless with writes discarded, waits for SSH,
+// and runs the built-in and configured checks in it. The serial console is
+// written to opts.VM.SerialLog. It fails if the VM does not come up or any
+// check fails.
+func (v *VMRunner) Test(ctx context.Context, opts VMTestOptions) (*VMTestReport, error) {
+	vm := opts.VM
+	if vm.ImagePath == "" {
+		return nil, fmt.Errorf("image path is required")
+	}
+	if _, err := os.Stat(vm.ImagePath); err != nil {
+		return nil, fmt.Errorf("image not found: %s", vm.ImagePath)
+	}
+	if vm.Provision == nil {
+		return nil, fmt.Errorf("vm test needs SSH provisioning (cloud-init or smbios)")
+	}
+	qemuBinary := qemuSystem()
+	if err := exec.RequireCommands(qemuBinary, "ssh"); err != nil {
+		return nil, err
+	}
+	if opts.BootTimeout <= 0 {
+		opts.BootTimeout = 10 * time.Minute
+	}
+
+	vm.Display = "none"
+	vm.SSH = true
+	vm.Snapshot = true
+	if vm.SerialLog == "" {
+		vm.SerialLog = filepath.Join(v.rootDir, "logs", fmt.Sprintf("vm-test-%s.log", time.Now().Format("20060102-150405")))
+	}
+	if err := os.MkdirAll(filepath.Dir(vm.SerialLog), 0o755); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+	report := &VMTestReport{Image: vm.ImagePath, SerialLog: vm.SerialLog, Tests: []TestResult{}}
+
+	res, cleanup, err := v.prepare(ctx, vm)
+	if err != nil {
+		return report, err
+	}
+	defer cleanup()
+
+	// The VM runs until the checks finish
+	qemuCtx, stopVM := context.WithCancel(ctx)
+	var qemu *exec.Result
+	exited := make(chan struct{})
+	args := v.buildQEMUArgs(vm, res)
+	v.logger.Info("booting VM", "image", vm.ImagePath, "serial_log", vm.SerialLog)
+	v.logger.Debug("running qemu", "args", args)
+	go func() {
+		qemu = exec.Run(qemuCtx, qemuBinary, args, exec.Options{})
+		close(exited)
+	}()
+	defer func() {
+		stopVM()
+		<-exited
+	}()
+
+	ssh := vmSSH{port: vm.SSHPort, user: vm.Provision.LoginUser(), identity: opts.Identity}
+	start := time.Now()
+	if err := ssh.wait(ctx, opts.BootTimeout, exited); err != nil {
+		select {
+		case <-exited:
+			err = fmt.Errorf("VM exited before SSH came up: %v: %s", qemu.Err, exec.LastNLines(qemu.Stderr, 5))
+		default:
+		}
+		return report, fmt.Errorf("%w (serial console: %s)", err, vm.SerialLog)
+	}
+	report.BootTime = time.Since(start)
+	v.logger.Info("VM is reachable over SSH", "boot_time", report.BootTime.Round(time.Second))
+
+	type check struct{ name, script string }
+	checks := []check{}
+	for _, name := range opts.Builtin {
+		checks = append(checks, check{name, vmBuiltinChecks[name]})
+	}
+	failed := []string{}
+	for _, t := range opts.Checks {
+		script, err := v.vmTestScript(t)
+		if err != nil {
+			report.Tests = append(report.Tests, TestResult{Name: TestName(t), Output: err.Error()})
+			failed = append(failed, TestName(t))
+			continue
+		}
+		checks = append(checks, check{TestName(t), script})
+	}
+
+	for _, c := range checks {
+		result := ssh.run(ctx, c.script)
+		tr := TestResult{
+			Name:     c.name,
+			Passed:   result.Err == nil,
+			Output:   strings.TrimSpace(exec.LastNLines(result.Stdout+result.Stderr, 20)),
+			Duration: result.Duration,
+		}
+		report.Tests = append(report.Tests, tr)
+		if tr.Passed {
+			v.logger.Info("VM check passed", "test", c.name, "duration", tr.Duration.Round(time.Millisecond))
+		} else {
+			failed = append(failed, c.name)
+			v.logger.Error("VM check failed", "test", c.name, "exit_code", result.ExitCode, "output", tr.Output)
+		}
+	}
+
+	if len(failed) > 0 {
+		return report, fmt.Errorf("%d of %d VM checks failed: %s", len(failed), len(report.Tests), strings.Join(failed, ", "))
+	}
+	return report, nil
+}
+
+// vmTestScript returns the shell script a configured check runs in the VM
+func (v *VMRunner) vmTestScript(t config.SmokeTest) (string, error) {
+	quote := func(words []string) string {
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = shellQuote(w)
+		}
+		return strings.Join(quoted, " ")
+	}
+	switch {
+	case t.Command != "":
+		return t.Command, nil
+	case t.Script != "":
+		script, err := os.ReadFile(filepath.Join(v.rootDir, t.Script))
+		if err != nil {
+			return "", fmt.Errorf("reading test script: %w", err)
+		}
+		return string(script), nil
+	case len(t.Packages) > 0:
+		return "rpm -q " + quote(t.Packages), nil
+	default:
+		return "systemctl is-enabled " + quote(t.Units), nil
+	}
+}
+
+// vmSSH runs commands in a test VM through the forwarded SSH port
+type vmSSH struct {
+	port     int
+	user     string
+	identity string
+}
+
+// command returns the ssh arguments that run remote in the VM
+func (s vmSSH) command(remote ...string) []string {
+	args := []string{
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout=5",
+		"-o", "LogLevel=ERROR",
+		"-p", fmt.Sprintf("%d", s.port),
+	}
+	if s.identity != "" {
+		args = append(args, "-i", s.identity, "-o", "IdentitiesOnly=yes")
+	}
+	return append(append(args, s.user+"@localhost"), remote...)
+}
+
+// wait polls SSH until it answers, the timeout passes, or the VM exits
+func (s vmSSH) wait(ctx context.Context, timeout time.Duration, exited <-chan struct{}) error {
+	deadline := time.After(timeout)
+	for {
+		opts := exec.DefaultOptions()
+		opts.Timeout = 15 * time.Second
+		if exec.Run(ctx, "ssh", s.command("true"), opts).Err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return fmt.Errorf("VM exited before SSH came up")
+		case <-deadline:
+			return fmt.Errorf("VM did not answer SSH on port %d within %s", s.port, timeout)
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// run runs a shell script in the VM as root
+func (s vmSSH) run(ctx context.Context, script string) *exec.Result {
+	remote := []string{"sh", "-s"}
+	if s.user != "root" {
+		remote = append([]string{"sudo", "-n"}, remote...)
+	}
+	opts := exec.DefaultOptions()
+	opts.Timeout = vmCheckTimeout
+	opts.Stdin = strings.NewReader(script)
+	return exec.Run(ctx, "ssh", s.command(remote...), opts)
+}
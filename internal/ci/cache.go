@@ -0,0 +1,354 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrCacheExists is returned when saving a key that is already stored;
+// cache entries are immutable
+var ErrCacheExists = errors.New("cache entry already exists")
+
+// CacheStore saves and restores cache archives by key. The version
+// identifies what an archive holds, so entries of different paths or
+// compression never match.
+type CacheStore interface {
+	// Name describes the store in logs
+	Name() string
+	// Restore downloads the archive of key, else of the newest entry whose
+	// key starts with one of restoreKeys, to path. It returns the matched
+	// key, or "" on a miss.
+	Restore(ctx context.Context, key string, restoreKeys []string, version, path string) (string, error)
+	// Save stores the archive at path under key
+	Save(ctx context.Context, key, version, path string) error
+}
+
+// NewCacheStore returns a filesystem store in dir, or the GitHub Actions
+// cache service when dir is empty. The cache service is only reachable when
+// the workflow exposes ACTIONS_RESULTS_URL and ACTIONS_RUNTIME_TOKEN to run
+// steps, e.g. with crazy-max/ghaction-github-runtime.
+func NewCacheStore(dir string) (CacheStore, error) {
+	if dir != "" {
+		return &dirCache{dir: dir}, nil
+	}
+	base, token := os.Getenv("ACTIONS_RESULTS_URL"), os.Getenv("ACTIONS_RUNTIME_TOKEN")
+	if base != "" && token != "" {
+		return &actionsCache{
+			base:   strings.TrimRight(base, "/") + "/twirp/github.actions.results.api.v1.CacheService/",
+			token:  token,
+			client: &http.Client{Timeout: 60 * time.Minute},
+		}, nil
+	}
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		return nil, fmt.Errorf("the Actions cache service is not exposed to run steps; add a crazy-max/ghaction-github-runtime step or pass --path")
+	}
+	return nil, fmt.Errorf("no cache store: pass --path or set GALENA_CACHE_PATH")
+}
+
+// dirCache stores archives in a directory, for self-hosted runners with
+// persistent or shared storage. Entries are <dir>/<key>/<version>.tar.
+type dirCache struct {
+	dir string
+}
+
+func (c *dirCache) Name() string { return c.dir }
+
+// entryDir maps a key to a directory name
+func (c *dirCache) entryDir(key string) string {
+	return filepath.Join(c.dir, strings.ReplaceAll(key, string(filepath.Separator), "_"))
+}
+
+func (c *dirCache) Restore(ctx context.Context, key string, restoreKeys []string, version, path string) (string, error) {
+	matched := ""
+	if _, err := os.Stat(filepath.Join(c.entryDir(key), version+".tar")); err == nil {
+		matched = key
+	} else {
+		matched = c.newestMatch(restoreKeys, version)
+	}
+	if matched == "" {
+		return "", nil
+	}
+
+	src, err := os.Open(filepath.Join(c.entryDir(matched), version+".tar"))
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("copying cache entry %s: %w", matched, err)
+	}
+	return matched, dst.Close()
+}
+
+// newestMatch returns the newest key of the first restore key prefix that
+// has an entry of version
+func (c *dirCache) newestMatch(prefixes []string, version string) string {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return ""
+	}
+	for _, prefix := range prefixes {
+		prefix = filepath.Base(c.entryDir(prefix))
+		type candidate struct {
+			key     string
+			modTime time.Time
+		}
+		var candidates []candidate
+		for _, e := range entries {
+			if !e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(c.dir, e.Name(), version+".tar"))
+			if err != nil {
+				continue
+			}
+			candidates = append(candidates, candidate{e.Name(), info.ModTime()})
+		}
+		if len(candidates) > 0 {
+			sort.Slice(candidates, func(i, j int) bool {
+				return candidates[i].modTime.After(candidates[j].modTime)
+			})
+			return candidates[0].key
+		}
+	}
+	return ""
+}
+
+func (c *dirCache) Save(ctx context.Context, key, version, path string) error {
+	dir := c.entryDir(key)
+	target := filepath.Join(dir, version+".tar")
+	if _, err := os.Stat(target); err == nil {
+		return ErrCacheExists
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// Write next to the target and rename, so concurrent jobs never restore
+	// a partial archive
+	tmp, err := os.CreateTemp(dir, ".partial-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing cache entry %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// actionsCache is the GitHub Actions cache service (v2). Metadata goes
+// through a Twirp API and archives are stored in Azure blob storage through
+// signed URLs.
+type actionsCache struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (c *actionsCache) Name() string { return "GitHub Actions cache" }
+
+// blockSize is the size of the blocks archives are uploaded in
+const blockSize = 64 << 20
+
+// call invokes a cache service method. Responses are protobuf JSON, whose
+// field names may be snake_case or lowerCamelCase.
+func (c *actionsCache) call(ctx context.Context, method string, request any) (map[string]any, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+method, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cache service %s: %w", method, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusConflict {
+		return nil, ErrCacheExists
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("cache service %s returned %s: %s", method, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("parsing cache service response: %w", err)
+	}
+	return out, nil
+}
+
+// field returns a string or boolean field of a protobuf JSON response
+func field(m map[string]any, snake, camel string) any {
+	if v, ok := m[snake]; ok {
+		return v
+	}
+	return m[camel]
+}
+
+func (c *actionsCache) Restore(ctx context.Context, key string, restoreKeys []string, version, path string) (string, error) {
+	resp, err := c.call(ctx, "GetCacheEntryDownloadURL", map[string]any{
+		"key":          key,
+		"restore_keys": restoreKeys,
+		"version":      version,
+	})
+	if err != nil {
+		return "", err
+	}
+	signedURL, _ := field(resp, "signed_download_url", "signedDownloadUrl").(string)
+	if ok, _ := resp["ok"].(bool); !ok || signedURL == "" {
+		return "", nil
+	}
+	matched, _ := field(resp, "matched_key", "matchedKey").(string)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, signedURL, nil)
+	if err != nil {
+		return "", err
+	}
+	dl, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("downloading cache entry %s: %w", matched, err)
+	}
+	defer func() {
+		_ = dl.Body.Close()
+	}()
+	if dl.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading cache entry %s: %s", matched, dl.Status)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, dl.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("downloading cache entry %s: %w", matched, err)
+	}
+	if matched == "" {
+		matched = key
+	}
+	return matched, f.Close()
+}
+
+func (c *actionsCache) Save(ctx context.Context, key, version, path string) error {
+	resp, err := c.call(ctx, "CreateCacheEntry", map[string]any{"key": key, "version": version})
+	if err != nil {
+		return err
+	}
+	uploadURL, _ := field(resp, "signed_upload_url", "signedUploadUrl").(string)
+	if ok, _ := resp["ok"].(bool); !ok || uploadURL == "" {
+		// The service refuses keys that exist or are being saved by
+		// another job
+		return ErrCacheExists
+	}
+
+	size, err := c.upload(ctx, uploadURL, path)
+	if err != nil {
+		return err
+	}
+	resp, err = c.call(ctx, "FinalizeCacheEntryUpload", map[string]any{
+		"key":        key,
+		"version":    version,
+		"size_bytes": size,
+	})
+	if err != nil {
+		return err
+	}
+	if ok, _ := resp["ok"].(bool); !ok {
+		return fmt.Errorf("cache service did not accept entry %s", key)
+	}
+	return nil
+}
+
+// upload puts a file to a signed blob URL in blocks and commits them
+func (c *actionsCache) upload(ctx context.Context, signedURL, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var ids []string
+	var size int64
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(ids))))
+			if err := c.putBlob(ctx, signedURL+"&comp=block&blockid="+url.QueryEscape(id), buf[:n]); err != nil {
+				return 0, err
+			}
+			ids = append(ids, id)
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var list strings.Builder
+	list.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range ids {
+		list.WriteString("<Latest>" + id + "</Latest>")
+	}
+	list.WriteString("</BlockList>")
+	if err := c.putBlob(ctx, signedURL+"&comp=blocklist", []byte(list.String())); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (c *actionsCache) putBlob(ctx context.Context, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading cache archive: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("uploading cache archive: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
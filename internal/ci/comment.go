@@ -0,0 +1,70 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IssueComment is a comment on an issue or pull request
+type IssueComment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// UpsertComment posts body on a pull request, or edits the earlier comment
+// that contains marker so repeated runs keep a single comment up to date.
+// The marker should be an HTML comment, which GitHub does not render.
+func (c *GitHubClient) UpsertComment(ctx context.Context, number, marker, body string) (*IssueComment, error) {
+	if !strings.Contains(body, marker) {
+		body = marker + "\n" + body
+	}
+	existing, err := c.findComment(ctx, number, marker)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return nil, err
+	}
+	var comment IssueComment
+	if existing != nil {
+		err = c.do(ctx, http.MethodPatch, fmt.Sprintf("%s/repos/%s/issues/comments/%d", c.api, c.repo, existing.ID), "application/json", bytes.NewReader(data), &comment)
+	} else {
+		err = c.do(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/issues/%s/comments", c.api, c.repo, number), "application/json", bytes.NewReader(data), &comment)
+	}
+	if err == errNotFound {
+		return nil, fmt.Errorf("pull request #%s not found or the token cannot comment on it", number)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("commenting on #%s: %w", number, err)
+	}
+	return &comment, nil
+}
+
+// findComment returns the first comment on an issue containing marker
+func (c *GitHubClient) findComment(ctx context.Context, number, marker string) (*IssueComment, error) {
+	for page := 1; ; page++ {
+		var comments []IssueComment
+		err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/issues/%s/comments?per_page=100&page=%d", c.api, c.repo, number, page), "", nil, &comments)
+		if err == errNotFound {
+			return nil, fmt.Errorf("pull request #%s not found", number)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing comments of #%s: %w", number, err)
+		}
+		for i := range comments {
+			if strings.Contains(comments[i].Body, marker) {
+				return &comments[i], nil
+			}
+		}
+		if len(comments) < 100 {
+			return nil, nil
+		}
+	}
+}
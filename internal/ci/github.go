@@ -3,18 +3,27 @@ package ci
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
+// Supported CI providers
+const (
+	ProviderGitHub  = "github"  // GitHub Actions
+	ProviderGitLab  = "gitlab"  // GitLab CI
+	ProviderForgejo = "forgejo" // Forgejo and Gitea Actions
+)
+
 // Environment represents the CI environment
 type Environment struct {
 	IsCI            bool
 	IsGitHubActions bool
+	Provider        string // One of the Provider constants, empty outside a known CI
 
-	// GitHub Actions specific
+	// Repository and run details, read from the variables of the provider
 	Repository      string
 	RepositoryOwner string
 	RepositoryName  string
@@ -27,10 +36,14 @@ type Environment struct {
 	DefaultBranch   string
 	Actor           string
 	Workflow        string
+	WorkflowRef     string // owner/repo/.github/workflows/file.yml@ref
+	RunAttempt      string
+	ServerURL       string
 
 	// Computed
-	IsDefaultBranch bool
-	IsPullRequest   bool
+	IsDefaultBranch   bool
+	IsPullRequest     bool
+	PullRequestNumber string // Pull or merge request number, when IsPullRequest
 }
 
 // Detect detects the current CI environment
@@ -39,162 +52,90 @@ func Detect() *Environment {
 
 	// Check for CI
 	env.IsCI = os.Getenv("CI") == "true"
-	env.IsGitHubActions = os.Getenv("GITHUB_ACTIONS") == "true"
-
-	if env.IsGitHubActions {
-		env.Repository = os.Getenv("GITHUB_REPOSITORY")
-		env.RepositoryOwner = os.Getenv("GITHUB_REPOSITORY_OWNER")
-		env.Ref = os.Getenv("GITHUB_REF")
-		env.RefName = os.Getenv("GITHUB_REF_NAME")
-		env.SHA = os.Getenv("GITHUB_SHA")
-		env.RunID = os.Getenv("GITHUB_RUN_ID")
-		env.EventName = os.Getenv("GITHUB_EVENT_NAME")
-		env.DefaultBranch = os.Getenv("GITHUB_DEFAULT_BRANCH")
-		env.Actor = os.Getenv("GITHUB_ACTOR")
-		env.Workflow = os.Getenv("GITHUB_WORKFLOW")
-
-		// Parse repository name
-		if parts := strings.Split(env.Repository, "/"); len(parts) == 2 {
-			env.RepositoryName = parts[1]
-		}
+	env.IsGitHubActions = os.Getenv("GITHUB_ACTIONS") == "true" && !isForgejo()
 
-		// Parse run number
-		if rn := os.Getenv("GITHUB_RUN_NUMBER"); rn != "" {
-			if _, err := fmt.Sscanf(rn, "%d", &env.RunNumber); err != nil {
-				env.RunNumber = 0
-			}
-		}
-
-		// Computed values
-		env.IsDefaultBranch = env.RefName == env.DefaultBranch
-		env.IsPullRequest = env.EventName == "pull_request"
+	switch {
+	case os.Getenv("GITLAB_CI") == "true":
+		detectGitLab(env)
+	case isForgejo():
+		env.Provider = ProviderForgejo
+		detectActions(env)
+	case env.IsGitHubActions:
+		env.Provider = ProviderGitHub
+		detectActions(env)
 	}
 
 	return env
 }
 
-// SetOutput sets a GitHub Actions output variable
-func SetOutput(name, value string) error {
-	outputFile := os.Getenv("GITHUB_OUTPUT")
-	if outputFile == "" {
-		// Not in GitHub Actions, just print
-		fmt.Printf("::set-output name=%s::%s\n", name, value)
-		return nil
-	}
-
-	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("opening GITHUB_OUTPUT: %w", err)
-	}
-	defer func() {
-		_ = f.Close()
-	}()
-
-	// Handle multiline values
-	if strings.Contains(value, "\n") {
-		delimiter := fmt.Sprintf("EOF%d", time.Now().UnixNano())
-		_, err = fmt.Fprintf(f, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
-	} else {
-		_, err = fmt.Fprintf(f, "%s=%s\n", name, value)
-	}
-
-	return err
+// isForgejo reports whether this is a Forgejo or Gitea Actions runner. Their
+// runners also set GITHUB_ACTIONS and the GITHUB_* variables.
+func isForgejo() bool {
+	return os.Getenv("FORGEJO_ACTIONS") == "true" || os.Getenv("GITEA_ACTIONS") == "true"
 }
 
-// SetEnv sets a GitHub Actions environment variable for subsequent steps
-func SetEnv(name, value string) error {
-	envFile := os.Getenv("GITHUB_ENV")
-	if envFile == "" {
-		return nil
-	}
-
-	f, err := os.OpenFile(envFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("opening GITHUB_ENV: %w", err)
-	}
-	defer func() {
-		_ = f.Close()
-	}()
-
-	_, err = fmt.Fprintf(f, "%s=%s\n", name, value)
-	return err
-}
-
-// AddPath adds a directory to the PATH for subsequent steps
-func AddPath(dir string) error {
-	pathFile := os.Getenv("GITHUB_PATH")
-	if pathFile == "" {
-		return nil
-	}
-
-	f, err := os.OpenFile(pathFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("opening GITHUB_PATH: %w", err)
-	}
-	defer func() {
-		_ = f.Close()
-	}()
-
-	_, err = fmt.Fprintf(f, "%s\n", dir)
-	return err
-}
-
-// StartGroup starts a log group in GitHub Actions
-func StartGroup(name string) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		fmt.Printf("::group::%s\n", name)
-	}
-}
-
-// EndGroup ends a log group in GitHub Actions
-func EndGroup() {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		fmt.Println("::endgroup::")
-	}
-}
-
-// LogError logs an error annotation
-func LogError(message string, file string, line int) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		if file != "" && line > 0 {
-			fmt.Printf("::error file=%s,line=%d::%s\n", file, line, message)
-		} else {
-			fmt.Printf("::error::%s\n", message)
+// detectActions reads the GITHUB_* variables set by GitHub, Forgejo, and
+// Gitea Actions
+func detectActions(env *Environment) {
+	env.Repository = os.Getenv("GITHUB_REPOSITORY")
+	env.RepositoryOwner = os.Getenv("GITHUB_REPOSITORY_OWNER")
+	env.Ref = os.Getenv("GITHUB_REF")
+	env.RefName = os.Getenv("GITHUB_REF_NAME")
+	env.SHA = os.Getenv("GITHUB_SHA")
+	env.RunID = os.Getenv("GITHUB_RUN_ID")
+	env.EventName = os.Getenv("GITHUB_EVENT_NAME")
+	env.DefaultBranch = os.Getenv("GITHUB_DEFAULT_BRANCH")
+	env.Actor = os.Getenv("GITHUB_ACTOR")
+	env.Workflow = os.Getenv("GITHUB_WORKFLOW")
+	env.WorkflowRef = os.Getenv("GITHUB_WORKFLOW_REF")
+	env.RunAttempt = os.Getenv("GITHUB_RUN_ATTEMPT")
+	env.ServerURL = strings.TrimRight(os.Getenv("GITHUB_SERVER_URL"), "/")
+	if env.ServerURL == "" {
+		env.ServerURL = "https://github.com"
+	}
+
+	// Parse repository name
+	if parts := strings.Split(env.Repository, "/"); len(parts) == 2 {
+		env.RepositoryName = parts[1]
+	}
+
+	// Parse run number
+	if rn := os.Getenv("GITHUB_RUN_NUMBER"); rn != "" {
+		if _, err := fmt.Sscanf(rn, "%d", &env.RunNumber); err != nil {
+			env.RunNumber = 0
 		}
 	}
-}
-
-// LogWarning logs a warning annotation
-func LogWarning(message string) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		fmt.Printf("::warning::%s\n", message)
-	}
-}
 
-// LogNotice logs a notice annotation
-func LogNotice(message string) {
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		fmt.Printf("::notice::%s\n", message)
+	// Computed values
+	env.IsDefaultBranch = env.RefName == env.DefaultBranch
+	env.IsPullRequest = env.EventName == "pull_request" || env.EventName == "pull_request_target"
+	if env.IsPullRequest {
+		// refs/pull/123/merge (GitHub) or refs/pull/123/head (Forgejo) -> 123
+		if parts := strings.Split(env.Ref, "/"); len(parts) >= 3 && parts[1] == "pull" {
+			env.PullRequestNumber = parts[2]
+		}
 	}
 }
 
-// AddSummary adds content to the job summary
-func AddSummary(markdown string) error {
-	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
-	if summaryFile == "" {
-		return nil
-	}
-
-	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("opening GITHUB_STEP_SUMMARY: %w", err)
+// RunURL returns the web page of the current CI run
+func (e *Environment) RunURL() string {
+	if e.ServerURL == "" || e.Repository == "" || e.RunID == "" {
+		return ""
 	}
-	defer func() {
-		_ = f.Close()
-	}()
-
-	_, err = fmt.Fprintf(f, "%s\n", markdown)
-	return err
+	switch e.Provider {
+	case ProviderGitHub:
+		run := fmt.Sprintf("%s/%s/actions/runs/%s", e.ServerURL, e.Repository, e.RunID)
+		if e.RunAttempt != "" {
+			run += "/attempts/" + e.RunAttempt
+		}
+		return run
+	case ProviderForgejo:
+		// Forgejo and Gitea address runs by their number in the repository
+		return fmt.Sprintf("%s/%s/actions/runs/%d", e.ServerURL, e.Repository, e.RunNumber)
+	case ProviderGitLab:
+		return fmt.Sprintf("%s/%s/-/pipelines/%s", e.ServerURL, e.Repository, e.RunID)
+	}
+	return ""
 }
 
 // GenerateTags generates image tags based on CI environment
@@ -222,17 +163,13 @@ func (e *Environment) GenerateTags(defaultTag string) []string {
 	dateTag := now.Format("20060102")
 
 	if e.IsPullRequest {
-		// PR tags: pr-<number> and sha-<short>
-		// Extract PR number from ref (refs/pull/123/merge -> 123)
-		prNum := ""
-		if strings.HasPrefix(e.Ref, "refs/pull/") {
-			parts := strings.Split(e.Ref, "/")
-			if len(parts) >= 3 {
-				prNum = parts[2]
+		// PR tags: pr-<number> (mr-<number> on GitLab) and sha-<short>
+		if e.PullRequestNumber != "" {
+			prefix := "pr"
+			if e.Provider == ProviderGitLab {
+				prefix = "mr"
 			}
-		}
-		if prNum != "" {
-			tags = append(tags, fmt.Sprintf("pr-%s", prNum))
+			tags = append(tags, fmt.Sprintf("%s-%s", prefix, e.PullRequestNumber))
 		}
 		if e.SHA != "" && len(e.SHA) >= 7 {
 			tags = append(tags, fmt.Sprintf("sha-%s", e.SHA[:7]))
@@ -316,10 +253,11 @@ func (e *Environment) GenerateLabels(imageName string, cfg LabelConfig) map[stri
 			ref = "main"
 		}
 
-		labels["org.opencontainers.image.source"] = fmt.Sprintf("https://github.com/%s/blob/%s/Containerfile", e.Repository, ref)
-		labels["org.opencontainers.image.url"] = fmt.Sprintf("https://github.com/%s/tree/%s", e.Repository, ref)
-		labels["org.opencontainers.image.documentation"] = fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/README.md", e.Repository, ref)
-		labels["io.artifacthub.package.readme-url"] = fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/README.md", e.Repository, ref)
+		source, tree, readme := e.sourceURLs(ref)
+		labels["org.opencontainers.image.source"] = source
+		labels["org.opencontainers.image.url"] = tree
+		labels["org.opencontainers.image.documentation"] = readme
+		labels["io.artifacthub.package.readme-url"] = readme
 	}
 
 	if e.SHA != "" {
@@ -329,15 +267,51 @@ func (e *Environment) GenerateLabels(imageName string, cfg LabelConfig) map[stri
 	return labels
 }
 
-// ImageRegistry returns the image registry from environment or default
+// sourceURLs returns the links to the Containerfile, the source tree, and
+// the raw README at ref in the web interface of the provider
+func (e *Environment) sourceURLs(ref string) (source, tree, readme string) {
+	base := e.ServerURL
+	if base == "" {
+		base = "https://github.com"
+	}
+	base += "/" + e.Repository
+	switch e.Provider {
+	case ProviderGitLab:
+		return base + "/-/blob/" + ref + "/Containerfile", base + "/-/tree/" + ref, base + "/-/raw/" + ref + "/README.md"
+	case ProviderForgejo:
+		kind := "branch"
+		if e.IsPullRequest {
+			kind = "commit"
+		} else if strings.HasPrefix(e.Ref, "refs/tags/") {
+			kind = "tag"
+		}
+		return base + "/src/" + kind + "/" + ref + "/Containerfile", base + "/src/" + kind + "/" + ref, base + "/raw/" + kind + "/" + ref + "/README.md"
+	}
+	return base + "/blob/" + ref + "/Containerfile", base + "/tree/" + ref, fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/README.md", e.Repository, ref)
+}
+
+// ImageRegistry returns the image registry from environment or default:
+// GHCR on GitHub, the project registry on GitLab, and the package registry
+// of the instance on Forgejo
 func (e *Environment) ImageRegistry() string {
 	if registry := os.Getenv("IMAGE_REGISTRY"); registry != "" {
 		return strings.ToLower(registry)
 	}
+	host := "ghcr.io"
+	switch e.Provider {
+	case ProviderGitLab:
+		if registry := os.Getenv("CI_REGISTRY"); registry != "" {
+			host = registry
+		}
+	case ProviderForgejo:
+		if u, err := url.Parse(e.ServerURL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+	}
 	if e.RepositoryOwner != "" {
-		return fmt.Sprintf("ghcr.io/%s", strings.ToLower(e.RepositoryOwner))
+		return strings.ToLower(fmt.Sprintf("%s/%s", host, e.RepositoryOwner))
 	}
-	return "ghcr.io"
+	return host
 }
 
 // ImageName returns the image name from environment or repository name
@@ -381,8 +355,12 @@ func sanitizeTag(s string) string {
 	return s
 }
 
-// CacheDir returns the cache directory for CI
+// CacheDir returns the cache directory for CI. GitLab only caches paths
+// inside the project directory.
 func CacheDir() string {
+	if dir := os.Getenv("CI_PROJECT_DIR"); dir != "" && os.Getenv("GITLAB_CI") == "true" {
+		return filepath.Join(dir, ".cache", "galena")
+	}
 	if dir := os.Getenv("RUNNER_TOOL_CACHE"); dir != "" {
 		return filepath.Join(dir, "galena")
 	}
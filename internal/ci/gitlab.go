@@ -0,0 +1,172 @@
+package ci
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDotenvFile is the dotenv report galena writes step outputs to on
+// GitLab CI. Declare it under artifacts:reports:dotenv so later jobs get the
+// outputs as GALENA_<NAME> variables; GALENA_DOTENV overrides the path.
+const DefaultDotenvFile = "galena.env"
+
+// DefaultSummaryFile collects the job summary on GitLab CI, which has no
+// summary page; keep it as an artifact to read it
+const DefaultSummaryFile = "galena-summary.md"
+
+// detectGitLab reads the CI_* variables of GitLab CI
+func detectGitLab(env *Environment) {
+	env.Provider = ProviderGitLab
+	env.Repository = os.Getenv("CI_PROJECT_PATH")
+	env.RepositoryOwner = os.Getenv("CI_PROJECT_NAMESPACE")
+	env.RepositoryName = os.Getenv("CI_PROJECT_NAME")
+	env.RefName = os.Getenv("CI_COMMIT_REF_NAME")
+	env.SHA = os.Getenv("CI_COMMIT_SHA")
+	env.RunID = os.Getenv("CI_PIPELINE_ID")
+	env.EventName = os.Getenv("CI_PIPELINE_SOURCE")
+	env.DefaultBranch = os.Getenv("CI_DEFAULT_BRANCH")
+	env.Actor = os.Getenv("GITLAB_USER_LOGIN")
+	env.Workflow = os.Getenv("CI_JOB_NAME")
+	env.ServerURL = strings.TrimRight(os.Getenv("CI_SERVER_URL"), "/")
+	if env.ServerURL == "" {
+		env.ServerURL = "https://gitlab.com"
+	}
+
+	// Pipeline numbers are per project like GitHub run numbers
+	if rn := os.Getenv("CI_PIPELINE_IID"); rn != "" {
+		if _, err := fmt.Sscanf(rn, "%d", &env.RunNumber); err != nil {
+			env.RunNumber = 0
+		}
+	}
+
+	tag := os.Getenv("CI_COMMIT_TAG")
+	env.PullRequestNumber = os.Getenv("CI_MERGE_REQUEST_IID")
+	env.IsPullRequest = env.EventName == "merge_request_event" || env.PullRequestNumber != ""
+	switch {
+	case env.IsPullRequest:
+		env.Ref = "refs/merge-requests/" + env.PullRequestNumber + "/head"
+	case tag != "":
+		env.Ref = "refs/tags/" + tag
+	case env.RefName != "":
+		env.Ref = "refs/heads/" + env.RefName
+	}
+	env.IsDefaultBranch = !env.IsPullRequest && tag == "" && env.RefName == env.DefaultBranch
+
+	config := os.Getenv("CI_CONFIG_PATH")
+	if config == "" {
+		config = ".gitlab-ci.yml"
+	}
+	if env.Repository != "" {
+		env.WorkflowRef = env.Repository + "/" + config + "@" + env.Ref
+	}
+}
+
+// gitlabAdapter writes outputs to a dotenv report and log groups as
+// collapsible sections
+type gitlabAdapter struct {
+	mu       sync.Mutex
+	sections []string // Open sections, innermost last
+}
+
+var gitlab = &gitlabAdapter{}
+
+// sectionNameRe matches the characters GitLab does not allow in section names
+var sectionNameRe = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// projectFile resolves a file name against the project directory
+func projectFile(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(os.Getenv("CI_PROJECT_DIR"), name)
+}
+
+// dotenvKey turns an output name into a GALENA_ prefixed variable name
+func dotenvKey(name string) string {
+	return "GALENA_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// setDotenv sets a variable in the dotenv report, replacing an earlier value
+// so outputs set twice keep the last one
+func (g *gitlabAdapter) setDotenv(key, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("dotenv reports cannot hold multiline values (%s)", key)
+	}
+	path := os.Getenv("GALENA_DOTENV")
+	if path == "" {
+		path = DefaultDotenvFile
+	}
+	path = projectFile(path)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var lines []string
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if line != "" && !strings.HasPrefix(line, key+"=") {
+				lines = append(lines, line)
+			}
+		}
+	}
+	lines = append(lines, key+"="+value)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing dotenv report: %w", err)
+	}
+	return nil
+}
+
+func (g *gitlabAdapter) setOutput(name, value string) error {
+	return g.setDotenv(dotenvKey(name), value)
+}
+
+// setEnv passes the variable to later jobs; the job's own shell cannot be
+// changed from a child process
+func (g *gitlabAdapter) setEnv(name, value string) error {
+	return g.setDotenv(name, value)
+}
+
+func (g *gitlabAdapter) addPath(dir string) error {
+	return nil
+}
+
+func (g *gitlabAdapter) startGroup(name string) {
+	section := strings.Trim(sectionNameRe.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if section == "" {
+		section = "galena"
+	}
+	g.mu.Lock()
+	g.sections = append(g.sections, section)
+	g.mu.Unlock()
+	fmt.Printf("\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s\n", time.Now().Unix(), section, name)
+}
+
+func (g *gitlabAdapter) endGroup() {
+	g.mu.Lock()
+	if len(g.sections) == 0 {
+		g.mu.Unlock()
+		return
+	}
+	section := g.sections[len(g.sections)-1]
+	g.sections = g.sections[:len(g.sections)-1]
+	g.mu.Unlock()
+	fmt.Printf("\x1b[0Ksection_end:%d:%s\r\x1b[0K\n", time.Now().Unix(), section)
+}
+
+// annotate prints a colored line; GitLab has no log annotations
+func (g *gitlabAdapter) annotate(level, message, file string, line int) {
+	color := map[string]string{"error": "31", "warning": "33", "notice": "36"}[level]
+	if file != "" && line > 0 {
+		message = fmt.Sprintf("%s:%d: %s", file, line, message)
+	}
+	fmt.Printf("\x1b[%s;1m%s:\x1b[0m %s\n", color, strings.ToUpper(level), message)
+}
+
+func (g *gitlabAdapter) addSummary(markdown string) error {
+	return appendFile("summary", projectFile(DefaultSummaryFile), markdown+"\n")
+}
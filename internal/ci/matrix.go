@@ -0,0 +1,73 @@
+package ci
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Matrix is a build matrix in the shape of a GitHub Actions
+// strategy.matrix, for use with fromJSON
+type Matrix struct {
+	Include []MatrixEntry `json:"include"`
+}
+
+// MatrixEntry is one job of a build matrix
+type MatrixEntry struct {
+	Variant  string `json:"variant"`
+	Tag      string `json:"tag"`
+	Arch     string `json:"arch"`
+	Platform string `json:"platform"` // linux/<arch>, for --platform
+	Image    string `json:"image"`    // Registry and name of the variant image
+	Runner   string `json:"runner"`   // GitHub-hosted runner of the architecture
+}
+
+// githubRunners maps architectures to GitHub-hosted runners
+var githubRunners = map[string]string{
+	"amd64": "ubuntu-24.04",
+	"arm64": "ubuntu-24.04-arm",
+}
+
+// normalizeArch maps uname architecture names to OCI ones
+func normalizeArch(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	}
+	return arch
+}
+
+// NewMatrix returns the jobs for every combination of variant, tag, and
+// architecture. Variants other than main are published as <image>-<variant>
+// like local builds.
+func (e *Environment) NewMatrix(variants, tags, arches []string) (*Matrix, error) {
+	if len(variants) == 0 || len(tags) == 0 || len(arches) == 0 {
+		return nil, fmt.Errorf("a matrix needs at least one variant, tag, and architecture")
+	}
+	m := &Matrix{Include: []MatrixEntry{}}
+	for _, variant := range variants {
+		image := e.ImageRegistry() + "/" + e.ImageName()
+		if variant != "main" {
+			image += "-" + variant
+		}
+		for _, tag := range tags {
+			for _, arch := range arches {
+				arch = normalizeArch(strings.TrimPrefix(arch, "linux/"))
+				runner, ok := githubRunners[arch]
+				if !ok {
+					return nil, fmt.Errorf("unsupported architecture %q (use amd64 or arm64)", arch)
+				}
+				m.Include = append(m.Include, MatrixEntry{
+					Variant:  variant,
+					Tag:      sanitizeTag(tag),
+					Arch:     arch,
+					Platform: "linux/" + arch,
+					Image:    image,
+					Runner:   runner,
+				})
+			}
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,160 @@
+package ci
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// adapter writes step outputs, log groups, and annotations in the format of
+// a CI provider
+type adapter interface {
+	setOutput(name, value string) error
+	setEnv(name, value string) error
+	addPath(dir string) error
+	startGroup(name string)
+	endGroup()
+	annotate(level, message, file string, line int)
+	addSummary(markdown string) error
+}
+
+// current returns the adapter of the running provider. Forgejo and Gitea
+// runners understand the GitHub Actions workflow commands.
+func current() adapter {
+	if os.Getenv("GITLAB_CI") == "true" {
+		return gitlab
+	}
+	return actions{}
+}
+
+// SetOutput sets a step output variable for later steps and jobs
+func SetOutput(name, value string) error {
+	return current().setOutput(name, value)
+}
+
+// SetEnv sets an environment variable for subsequent steps
+func SetEnv(name, value string) error {
+	return current().setEnv(name, value)
+}
+
+// AddPath adds a directory to the PATH for subsequent steps
+func AddPath(dir string) error {
+	return current().addPath(dir)
+}
+
+// StartGroup starts a collapsible log group
+func StartGroup(name string) {
+	current().startGroup(name)
+}
+
+// EndGroup ends the innermost log group
+func EndGroup() {
+	current().endGroup()
+}
+
+// LogError logs an error annotation
+func LogError(message string, file string, line int) {
+	current().annotate("error", message, file, line)
+}
+
+// LogWarning logs a warning annotation
+func LogWarning(message string) {
+	current().annotate("warning", message, "", 0)
+}
+
+// LogNotice logs a notice annotation
+func LogNotice(message string) {
+	current().annotate("notice", message, "", 0)
+}
+
+// AddSummary adds content to the job summary
+func AddSummary(markdown string) error {
+	return current().addSummary(markdown)
+}
+
+// appendFile appends text to the file named by a runner variable
+func appendFile(variable, path, text string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", variable, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	_, err = f.WriteString(text)
+	return err
+}
+
+// actions implements the workflow commands and files of GitHub, Forgejo,
+// and Gitea Actions
+type actions struct{}
+
+func (actions) running() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true" || isForgejo()
+}
+
+func (actions) setOutput(name, value string) error {
+	outputFile := os.Getenv("GITHUB_OUTPUT")
+	if outputFile == "" {
+		// Not in GitHub Actions, just print
+		fmt.Printf("::set-output name=%s::%s\n", name, value)
+		return nil
+	}
+
+	// Handle multiline values
+	if strings.Contains(value, "\n") {
+		delimiter := fmt.Sprintf("EOF%d", time.Now().UnixNano())
+		return appendFile("GITHUB_OUTPUT", outputFile, fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter))
+	}
+	return appendFile("GITHUB_OUTPUT", outputFile, fmt.Sprintf("%s=%s\n", name, value))
+}
+
+func (actions) setEnv(name, value string) error {
+	envFile := os.Getenv("GITHUB_ENV")
+	if envFile == "" {
+		return nil
+	}
+	return appendFile("GITHUB_ENV", envFile, fmt.Sprintf("%s=%s\n", name, value))
+}
+
+func (actions) addPath(dir string) error {
+	pathFile := os.Getenv("GITHUB_PATH")
+	if pathFile == "" {
+		return nil
+	}
+	return appendFile("GITHUB_PATH", pathFile, dir+"\n")
+}
+
+func (a actions) startGroup(name string) {
+	if a.running() {
+		fmt.Printf("::group::%s\n", name)
+	}
+}
+
+func (a actions) endGroup() {
+	if a.running() {
+		fmt.Println("::endgroup::")
+	}
+}
+
+func (a actions) annotate(level, message, file string, line int) {
+	if !a.running() {
+		return
+	}
+	if file != "" && line > 0 {
+		fmt.Printf("::%s file=%s,line=%d::%s\n", level, file, line, message)
+	} else {
+		fmt.Printf("::%s::%s\n", level, message)
+	}
+}
+
+func (actions) addSummary(markdown string) error {
+	// Gitea and older Forgejo runners do not set GITHUB_STEP_SUMMARY
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+	return appendFile("GITHUB_STEP_SUMMARY", summaryFile, markdown+"\n")
+}
@@ -0,0 +1,219 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Release is a GitHub release
+type Release struct {
+	ID        int64          `json:"id"`
+	TagName   string         `json:"tag_name"`
+	Name      string         `json:"name"`
+	HTMLURL   string         `json:"html_url"`
+	UploadURL string         `json:"upload_url"`
+	Assets    []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file attached to a release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // API URL; downloads with Accept: application/octet-stream
+	Size int64  `json:"size"`
+}
+
+// Asset returns the asset with the given name
+func (r *Release) Asset(name string) (ReleaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return ReleaseAsset{}, false
+}
+
+// NewRelease describes a release to create
+type NewRelease struct {
+	TagName    string `json:"tag_name"`
+	Target     string `json:"target_commitish,omitempty"`
+	Name       string `json:"name"`
+	Body       string `json:"body"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// GitHubClient talks to the releases API of one repository
+type GitHubClient struct {
+	api    string
+	repo   string
+	token  string
+	client *http.Client
+}
+
+// NewGitHubClient returns a client for owner/repo authenticated with
+// GITHUB_TOKEN or GH_TOKEN. GITHUB_API_URL points it at GitHub Enterprise.
+func NewGitHubClient(repo string) (*GitHubClient, error) {
+	if strings.Count(repo, "/") != 1 {
+		return nil, fmt.Errorf("invalid repository %q (use owner/repo)", repo)
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no GitHub token: set GITHUB_TOKEN or GH_TOKEN")
+	}
+	api := strings.TrimRight(os.Getenv("GITHUB_API_URL"), "/")
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	return &GitHubClient{api: api, repo: repo, token: token, client: &http.Client{Timeout: 30 * time.Minute}}, nil
+}
+
+// do sends an API request and decodes the JSON response into out. A 404
+// returns errNotFound.
+func (c *GitHubClient) do(ctx context.Context, method, endpoint, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GitHub returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("parsing GitHub response: %w", err)
+	}
+	return nil
+}
+
+var errNotFound = fmt.Errorf("not found")
+
+// LatestRelease returns the latest published release, or nil when the
+// repository has none
+func (c *GitHubClient) LatestRelease(ctx context.Context) (*Release, error) {
+	var r Release
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/releases/latest", c.api, c.repo), "", nil, &r)
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ReleaseByTag returns the release of a tag, or nil when there is none
+func (c *GitHubClient) ReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	var r Release
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/releases/tags/%s", c.api, c.repo, url.PathEscape(tag)), "", nil, &r)
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateRelease creates a release and its tag
+func (c *GitHubClient) CreateRelease(ctx context.Context, release NewRelease) (*Release, error) {
+	data, err := json.Marshal(release)
+	if err != nil {
+		return nil, err
+	}
+	var r Release
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/releases", c.api, c.repo), "application/json", bytes.NewReader(data), &r); err != nil {
+		return nil, fmt.Errorf("creating release %s: %w", release.TagName, err)
+	}
+	return &r, nil
+}
+
+// UploadAsset attaches a file to a release under its base name
+func (c *GitHubClient) UploadAsset(ctx context.Context, r *Release, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// upload_url is a URI template: .../assets{?name,label}
+	endpoint, _, _ := strings.Cut(r.UploadURL, "{")
+	endpoint += "?name=" + url.QueryEscape(filepath.Base(path))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", filepath.Base(path), err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("uploading %s: GitHub returned %s: %s", filepath.Base(path), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// DownloadAsset returns the content of a release asset
+func (c *GitHubClient) DownloadAsset(ctx context.Context, asset ReleaseAsset) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/octet-stream")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", asset.Name, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: GitHub returned %s", asset.Name, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,303 @@
+package ci
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowOptions configures the workflow written by ci init
+type WorkflowOptions struct {
+	Variants   []string // Variants built by the job matrix
+	Branch     string   // Branch pushes are built and pushed from (GitHub)
+	DefaultTag string   // Tag of default branch builds
+	DiskTypes  []string // Disk images built from default branch images; none when empty
+	Version    string   // galena-build version installed with go install
+}
+
+// WorkflowProviders lists the providers ci init writes workflows for
+func WorkflowProviders() []string {
+	return []string{ProviderGitHub, ProviderGitLab}
+}
+
+// WorkflowPath returns where the workflow of a provider lives in the project
+func WorkflowPath(provider string) (string, error) {
+	switch provider {
+	case ProviderGitHub:
+		return ".github/workflows/galena.yml", nil
+	case ProviderGitLab:
+		return ".gitlab-ci.yml", nil
+	}
+	return "", fmt.Errorf("unknown CI provider %q (use %s)", provider, strings.Join(WorkflowProviders(), ", "))
+}
+
+// RenderWorkflow returns a build, push, and sign workflow for the provider
+func RenderWorkflow(provider string, opts WorkflowOptions) (string, error) {
+	if len(opts.Variants) == 0 {
+		return "", fmt.Errorf("no variants to build")
+	}
+	if opts.Branch == "" {
+		opts.Branch = "main"
+	}
+	if opts.DefaultTag == "" {
+		opts.DefaultTag = "stable"
+	}
+	if opts.Version == "" {
+		opts.Version = "latest"
+	}
+	switch provider {
+	case ProviderGitHub:
+		return githubWorkflow(opts), nil
+	case ProviderGitLab:
+		return gitlabWorkflow(opts), nil
+	}
+	return "", fmt.Errorf("unknown CI provider %q (use %s)", provider, strings.Join(WorkflowProviders(), ", "))
+}
+
+// WorkflowVariants reads the variant matrix of a workflow written by ci init
+func WorkflowVariants(provider string, data []byte) ([]string, error) {
+	var doc struct {
+		// GitHub: jobs.build.strategy.matrix.variant
+		Jobs map[string]struct {
+			Strategy struct {
+				Matrix struct {
+					Variant []string `yaml:"variant"`
+				} `yaml:"matrix"`
+			} `yaml:"strategy"`
+		} `yaml:"jobs"`
+		// GitLab: build.parallel.matrix[].VARIANT
+		Build struct {
+			Parallel struct {
+				Matrix []struct {
+					Variant []string `yaml:"VARIANT"`
+				} `yaml:"matrix"`
+			} `yaml:"parallel"`
+		} `yaml:"build"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing workflow: %w", err)
+	}
+
+	var variants []string
+	switch provider {
+	case ProviderGitHub:
+		variants = doc.Jobs["build"].Strategy.Matrix.Variant
+	case ProviderGitLab:
+		for _, m := range doc.Build.Parallel.Matrix {
+			variants = append(variants, m.Variant...)
+		}
+	default:
+		return nil, fmt.Errorf("unknown CI provider %q (use %s)", provider, strings.Join(WorkflowProviders(), ", "))
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no variant matrix found in the build job")
+	}
+	return variants, nil
+}
+
+// VariantDrift compares the variants of a workflow with the configured
+// ones and returns the variants it misses and the ones it should drop
+func VariantDrift(workflow, configured []string) (missing, extra []string) {
+	for _, v := range configured {
+		if !slices.Contains(workflow, v) {
+			missing = append(missing, v)
+		}
+	}
+	for _, v := range workflow {
+		if !slices.Contains(configured, v) {
+			extra = append(extra, v)
+		}
+	}
+	return missing, extra
+}
+
+// yamlList renders a flow sequence such as [main, nvidia]
+func yamlList(values []string) string {
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+const workflowHeader = `# Generated by galena-build ci init. Edit freely; after changing variants in
+# galena.yaml, run galena-build ci init --check to find a stale matrix.
+`
+
+func githubWorkflow(opts WorkflowOptions) string {
+	var b strings.Builder
+	b.WriteString(workflowHeader)
+	fmt.Fprintf(&b, `name: Build image
+on:
+  pull_request:
+    branches: [%[1]s]
+  push:
+    branches: [%[1]s]
+    paths-ignore:
+      - '**/README.md'
+  schedule:
+    - cron: '05 10 * * *'
+  workflow_dispatch:
+
+env:
+  DEFAULT_TAG: %[2]q
+
+concurrency:
+  group: ${{ github.workflow }}-${{ github.ref }}
+  cancel-in-progress: true
+
+jobs:
+  build:
+    name: Build ${{ matrix.variant }}
+    runs-on: ubuntu-24.04
+    permissions:
+      contents: read
+      packages: write
+      pull-requests: write # build summary comment
+      id-token: write # cosign keyless signing
+    strategy:
+      fail-fast: false
+      matrix:
+        variant: %[3]s
+    steps:
+      - name: Checkout
+        uses: actions/checkout@v4
+
+      - name: Maximize build space
+        uses: ublue-os/remove-unwanted-software@v7
+        with:
+          remove-codeql: true
+
+      - name: Setup Go
+        uses: actions/setup-go@v5
+        with:
+          go-version: stable
+          cache: false
+
+      - name: Install galena-build
+        run: |
+          go install github.com/iiroan/galena/cmd/galena-build@%[4]s
+          galena-build ci setup
+
+      - name: Login to GitHub Container Registry
+        if: github.event_name != 'pull_request'
+        uses: docker/login-action@v3
+        with:
+          registry: ghcr.io
+          username: ${{ github.actor }}
+          password: ${{ secrets.GITHUB_TOKEN }}
+
+      - name: Install Cosign
+        if: github.event_name != 'pull_request'
+        uses: sigstore/cosign-installer@v3
+
+      - name: Install Trivy
+        uses: aquasecurity/setup-trivy@v0.2.6
+        with:
+          cache: false
+
+      # Pushes and signs on the default branch only
+      - name: Build image
+        id: build
+        env:
+          GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}
+        run: |
+          galena-build ci build \
+            --variant "${{ matrix.variant }}" \
+            --default-tag "${DEFAULT_TAG}" \
+            --sign \
+            --sbom \
+            --pr-comment
+
+      - name: Upload SBOM and manifest
+        if: always()
+        uses: actions/upload-artifact@v4
+        with:
+          name: build-${{ matrix.variant }}
+          path: |
+            sbom.spdx.json
+            build-manifest.json
+          if-no-files-found: ignore
+`, opts.Branch, opts.DefaultTag, yamlList(opts.Variants), opts.Version)
+
+	if len(opts.DiskTypes) > 0 {
+		fmt.Fprintf(&b, `
+      # bootc-image-builder needs rootful podman
+      - name: Build disk images
+        if: github.event_name != 'pull_request'
+        run: |
+          for type in %s; do
+            sudo "$(go env GOPATH)/bin/galena-build" disk "$type" \
+              --image "${{ steps.build.outputs.image }}" \
+              --output ./output
+          done
+          sudo chown -R "$USER:$USER" output/
+
+      - name: Upload disk images
+        if: github.event_name != 'pull_request'
+        uses: actions/upload-artifact@v4
+        with:
+          name: disk-${{ matrix.variant }}
+          path: output/
+          compression-level: 0
+          retention-days: 7
+`, strings.Join(opts.DiskTypes, " "))
+	}
+	return b.String()
+}
+
+func gitlabWorkflow(opts WorkflowOptions) string {
+	var b strings.Builder
+	b.WriteString(workflowHeader)
+	fmt.Fprintf(&b, `workflow:
+  rules:
+    - if: $CI_PIPELINE_SOURCE == "merge_request_event"
+    - if: $CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH
+    - if: $CI_PIPELINE_SOURCE == "schedule" || $CI_PIPELINE_SOURCE == "web"
+
+variables:
+  DEFAULT_TAG: %[1]q
+  GALENA_VERSION: %[2]q
+
+# Image builds need a privileged runner
+build:
+  image: quay.io/podman/stable
+  parallel:
+    matrix:
+      - VARIANT: %[3]s
+  id_tokens:
+    SIGSTORE_ID_TOKEN: # cosign keyless signing
+      aud: sigstore
+  before_script:
+    - dnf install -y --setopt=install_weak_deps=False golang git cosign
+    - go install "github.com/iiroan/galena/cmd/galena-build@${GALENA_VERSION}"
+    - export PATH="$PATH:$(go env GOPATH)/bin"
+    - galena-build ci setup
+    - |
+      if [ "$CI_COMMIT_BRANCH" = "$CI_DEFAULT_BRANCH" ]; then
+        podman login -u "$CI_REGISTRY_USER" -p "$CI_REGISTRY_PASSWORD" "$CI_REGISTRY"
+      fi
+  # Pushes and signs on the default branch only
+  script:
+    - galena-build ci build --variant "$VARIANT" --default-tag "$DEFAULT_TAG" --sign --sbom
+`, opts.DefaultTag, opts.Version, yamlList(opts.Variants))
+
+	paths := []string{"sbom.spdx.json", "build-manifest.json", DefaultSummaryFile}
+	if len(opts.DiskTypes) > 0 {
+		fmt.Fprintf(&b, `    - |
+      if [ "$CI_COMMIT_BRANCH" = "$CI_DEFAULT_BRANCH" ]; then
+        set -a; . ./%s; set +a
+        for type in %s; do
+          galena-build disk "$type" --image "$GALENA_IMAGE" --output ./output
+        done
+      fi
+`, DefaultDotenvFile, strings.Join(opts.DiskTypes, " "))
+		paths = append(paths, "output/")
+	}
+	fmt.Fprintf(&b, `  artifacts:
+    when: always
+    expire_in: 7 days
+    paths: %s
+    reports:
+      dotenv: %s
+`, yamlList(paths), DefaultDotenvFile)
+	return b.String()
+}
@@ -2,47 +2,430 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/iiroan/galena/internal/exec"
 )
 
 // Config represents the main configuration for galena
 type Config struct {
+	// Configs this one builds on, as paths relative to this file or https
+	// URLs. The extended config and then each include are deep-merged below
+	// this file.
+	Extends string   `yaml:"extends,omitempty"`
+	Include []string `yaml:"include,omitempty"`
+
 	// Project metadata
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
 	Registry    string `yaml:"registry"`
 	Repository  string `yaml:"repository"`
 
+	// The template galena-build init created the project from
+	Template TemplateConfig `yaml:"template"`
+
+	// Mirror registries the image is copied to after pushing to the registry above
+	Registries []RegistryConfig `yaml:"registries"`
+
+	// Where registry credentials come from; set with galena-build login
+	Credentials []CredentialConfig `yaml:"credentials"`
+
+	// Retries of registry operations (push, pull, cosign, skopeo)
+	Retry RetryConfig `yaml:"retry"`
+
 	// Build configuration
 	Build BuildConfig `yaml:"build"`
 
+	// Local image retention
+	Clean CleanConfig `yaml:"clean"`
+
+	// Image signing
+	Signing SigningConfig `yaml:"signing"`
+
+	// Signature verification constraints
+	Verify VerifyConfig `yaml:"verify"`
+
+	// Vulnerability scan policy
+	Scan ScanConfig `yaml:"scan"`
+
+	// SBOM policy
+	SBOM SBOMConfig `yaml:"sbom"`
+
+	// Cloud accounts disk images are uploaded to
+	Cloud CloudConfig `yaml:"cloud"`
+
+	// Test VM checks
+	VM VMConfig `yaml:"vm"`
+
 	// Version configuration
 	Version VersionConfig `yaml:"version"`
 
 	// Image variants
 	Variants []Variant `yaml:"variants"`
 
+	// Release channels devices can follow
+	Channels []Channel `yaml:"channels"`
+
+	// Staged rollouts across many devices
+	Fleet FleetConfig `yaml:"fleet"`
+
 	// Dependencies (digest-pinned images)
 	Dependencies map[string]Dependency `yaml:"dependencies"`
 
 	// UI configuration
 	UI UIConfig `yaml:"ui"`
+
+	// Build lifecycle hooks
+	Hooks HooksConfig `yaml:"hooks"`
+
+	// Audit log of executed commands
+	Audit AuditConfig `yaml:"audit"`
+
+	// Session logs of build, disk, and ci build
+	Logs LogsConfig `yaml:"logs"`
+
+	// Where build, push, and disk results are announced
+	Notifications []NotificationConfig `yaml:"notifications"`
+
+	// Fields set from GALENA_* variables, which Save leaves out
+	env []EnvOverride
+
+	// The defaults merged with the configs of extends and include, nil when
+	// there are none. Save only writes what differs from it.
+	base *Config
+}
+
+// NotificationConfig sends build results to a chat webhook, an HTTP
+// endpoint, or the desktop. Webhook URLs and tokens are secrets, so they are
+// best read from the environment with url_env and token_env.
+type NotificationConfig struct {
+	Type     string            `yaml:"type"`      // slack, discord, matrix, webhook, or desktop
+	URL      string            `yaml:"url"`       // Webhook URL, or the Matrix homeserver
+	URLEnv   string            `yaml:"url_env"`   // Environment variable holding the URL
+	Room     string            `yaml:"room"`      // Matrix room ID, e.g. !abc:example.org
+	TokenEnv string            `yaml:"token_env"` // Environment variable holding the Matrix access token
+	Headers  map[string]string `yaml:"headers"`   // Extra headers of generic webhooks; $VARS are expanded
+	Events   []string          `yaml:"events"`    // Events to send (default: all)
+}
+
+// NotificationTypes returns the supported notification targets
+func NotificationTypes() []string {
+	return []string{"slack", "discord", "matrix", "webhook", "desktop"}
+}
+
+// NotificationEvents returns the events notifications can subscribe to
+func NotificationEvents() []string {
+	return []string{"build_succeeded", "build_failed", "push", "disk_succeeded", "disk_failed"}
+}
+
+// LogsConfig controls the session logs in logs/sessions, which hold every
+// command of a build, disk, or ci build run together with its output.
+type LogsConfig struct {
+	Keep int `yaml:"keep"` // Session logs kept, oldest removed first (default 20)
+}
+
+// AuditConfig records every external command galena runs (arguments,
+// working directory, duration, exit code, and the end of its output) as
+// JSON lines, for reviewing what a build did after the fact.
+type AuditConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Path      string `yaml:"path"`       // Log file relative to the project root (default logs/audit.jsonl)
+	MaxOutput int    `yaml:"max_output"` // Bytes of stdout and stderr kept per command (default 4096)
+}
+
+// HooksConfig lists shell commands run at points of the build lifecycle.
+// Each command runs with sh -c from the project root.
+type HooksConfig struct {
+	PreBuild  []string `yaml:"pre_build"`
+	PostBuild []string `yaml:"post_build"`
+	PostPush  []string `yaml:"post_push"`
 }
 
 // BuildConfig holds build-related settings
 type BuildConfig struct {
-	BaseImage     string            `yaml:"base_image"`
-	FedoraVersion string            `yaml:"fedora_version"`
-	BuildArgs     map[string]string `yaml:"build_args"`
-	CacheMounts   []string          `yaml:"cache_mounts"`
-	Timeout       string            `yaml:"timeout"`
-	Defaults      BuildDefaults     `yaml:"defaults"`
+	BaseImage       string            `yaml:"base_image"`
+	BaseImageDigest string            `yaml:"base_image_digest"`
+	FedoraVersion   string            `yaml:"fedora_version"`
+	BuildArgs       map[string]string `yaml:"build_args"`
+	CacheMounts     []string          `yaml:"cache_mounts"`
+	Cache           CacheConfig       `yaml:"cache"`
+	Secrets         []SecretConfig    `yaml:"secrets"`
+	Timeout         string            `yaml:"timeout"`
+	DirtyPolicy     string            `yaml:"dirty_policy"` // warn, block-push, suffix
+	Engine          string            `yaml:"engine"`       // podman, buildah, docker
+	Healthcheck     HealthcheckConfig `yaml:"healthcheck"`
+	Tests           TestsConfig       `yaml:"tests"`
+	Defaults        BuildDefaults     `yaml:"defaults"`
+}
+
+// RegistryConfig is an additional push destination. Credentials are read
+// from the environment or an auth file so they stay out of galena.yaml.
+type RegistryConfig struct {
+	Name        string `yaml:"name"`
+	Repository  string `yaml:"repository"`   // e.g. harbor.internal/galena
+	UsernameEnv string `yaml:"username_env"` // Environment variable holding the username
+	PasswordEnv string `yaml:"password_env"` // Environment variable holding the password or token
+	AuthFile    string `yaml:"auth_file"`    // containers-auth.json(5) file, relative to the project root
+	TLSVerify   *bool  `yaml:"tls_verify"`   // Defaults to true
+	Retries     int    `yaml:"retries"`      // Attempts after the first failure (default 3)
+}
+
+// CredentialConfig says where the credentials of a registry come from. The
+// password is a secret reference (see SecretSchemes) resolved when an image
+// is pushed or signed, so galena.yaml never holds the secret itself.
+type CredentialConfig struct {
+	Registry string `yaml:"registry"` // Registry host, e.g. ghcr.io
+	Username string `yaml:"username"` // Username, or a secret reference to it
+	Password string `yaml:"password"` // Secret reference to the password or token
+}
+
+// SecretSchemes returns the prefixes of secret references: an environment
+// variable, a file, pass, gopass, 1Password, or the output of a command
+func SecretSchemes() []string {
+	return []string{"env:", "file:", "pass:", "gopass:", "op://", "cmd:"}
+}
+
+// IsSecretRef reports whether s is a secret reference rather than a value
+func IsSecretRef(s string) bool {
+	for _, scheme := range SecretSchemes() {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryConfig tunes how registry operations are retried. A failure is
+// retried when its exit code is listed or its stderr matches a pattern;
+// patterns add to the built-in list of network and registry errors.
+type RetryConfig struct {
+	Attempts  int      `yaml:"attempts"`   // Total attempts (default 3); 1 disables retries
+	Delay     string   `yaml:"delay"`      // Wait before the first retry, doubled after each (default 5s)
+	MaxDelay  string   `yaml:"max_delay"`  // Upper bound of the wait (default 1m)
+	ExitCodes []int    `yaml:"exit_codes"` // Exit codes that are always retried
+	Patterns  []string `yaml:"patterns"`   // Extra stderr substrings of transient failures
+}
+
+// TemplateConfig records where a project came from, so it can be compared
+// with later versions of its template
+type TemplateConfig struct {
+	Source string `yaml:"source"` // Built-in template name, or gh:owner/repo[//subdir]
+	Ref    string `yaml:"ref"`    // Branch, tag, or commit that was asked for
+	Commit string `yaml:"commit"` // Commit of a repository template the project was created from
+}
+
+// SigningConfig selects the cosign key images are signed with. Without a
+// key, cosign signs keyless with the OIDC identity of the environment.
+type SigningConfig struct {
+	Key          string `yaml:"key"`           // Key file relative to the project root, env://VAR, or a KMS URI
+	PasswordEnv  string `yaml:"password_env"`  // Environment variable holding the key password (default COSIGN_PASSWORD)
+	KeyFrom      string `yaml:"key_from"`      // Secret reference to the private key, e.g. op://ci/cosign/key
+	PasswordFrom string `yaml:"password_from"` // Secret reference to the key password, e.g. pass:cosign
+	Checksums    string `yaml:"checksums"`     // Sign disk image SHA256SUMS with gpg or cosign (empty: unsigned)
+	GPGKey       string `yaml:"gpg_key"`       // GPG key ID for checksum signatures (default: gpg's default key)
+}
+
+// ChecksumSigners returns the tools disk image checksums can be signed with
+func ChecksumSigners() []string {
+	return []string{"gpg", "cosign"}
+}
+
+// KeySchemes returns the key reference schemes cosign accepts besides file paths
+func KeySchemes() []string {
+	return []string{"env://", "awskms://", "gcpkms://", "azurekms://", "hashivault://", "k8s://"}
+}
+
+// VerifyConfig holds the constraints image signatures must satisfy. Keyless
+// signatures need an identity and an issuer; a key replaces both.
+type VerifyConfig struct {
+	Key            string   `yaml:"key"`             // Public key file or KMS URI
+	Identity       string   `yaml:"identity"`        // Exact certificate identity, e.g. a workflow URL
+	IdentityRegexp string   `yaml:"identity_regexp"` // Certificate identity pattern
+	Issuer         string   `yaml:"issuer"`          // Exact OIDC issuer
+	IssuerRegexp   string   `yaml:"issuer_regexp"`   // OIDC issuer pattern
+	Attestations   []string `yaml:"attestations"`    // Attestation types that must be attached, e.g. spdxjson
+}
+
+// ScanConfig holds the vulnerability scan policy
+type ScanConfig struct {
+	Severity      []string `yaml:"severity"`       // Severities to report (default: all)
+	FailOn        string   `yaml:"fail_on"`        // Lowest severity that fails the scan; never fails when empty
+	IgnoreFile    string   `yaml:"ignore_file"`    // Trivy ignore file relative to the project root (default .trivyignore)
+	IgnoreUnfixed bool     `yaml:"ignore_unfixed"` // Skip vulnerabilities without a fixed version
+}
+
+// Severities returns the vulnerability severities from lowest to highest
+func Severities() []string {
+	return []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+}
+
+// SeverityRank returns the position of a severity in Severities, or -1
+func SeverityRank(severity string) int {
+	for i, s := range Severities() {
+		if strings.EqualFold(severity, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SBOMConfig holds the policies checked against image SBOMs and where
+// SBOMs are published
+type SBOMConfig struct {
+	Licenses        LicensePolicy         `yaml:"licenses"`
+	DependencyTrack DependencyTrackConfig `yaml:"dependency_track"`
+}
+
+// DependencyTrackConfig points at the Dependency-Track server SBOMs are
+// uploaded to
+type DependencyTrackConfig struct {
+	URL       string `yaml:"url"`         // Server URL (default: $DEPENDENCY_TRACK_URL)
+	APIKeyEnv string `yaml:"api_key_env"` // Environment variable holding the API key (default DEPENDENCY_TRACK_API_KEY)
+	Project   string `yaml:"project"`     // Project name (default: the project name)
+}
+
+// CloudConfig holds the cloud accounts disk upload imports images into.
+// Provider CLIs (aws, gcloud, az) supply the credentials.
+type CloudConfig struct {
+	AWS   AWSConfig   `yaml:"aws"`
+	GCP   GCPConfig   `yaml:"gcp"`
+	Azure AzureConfig `yaml:"azure"`
+}
+
+// AWSConfig selects where disk images are imported as AMIs
+type AWSConfig struct {
+	Region string `yaml:"region"` // Region (default: the aws CLI region)
+	Bucket string `yaml:"bucket"` // S3 bucket disk images are staged in for import
+}
+
+// GCPConfig selects where disk images are created as GCE images
+type GCPConfig struct {
+	Project string `yaml:"project"` // Project (default: the gcloud project)
+	Bucket  string `yaml:"bucket"`  // Cloud Storage bucket disk images are staged in
+	Family  string `yaml:"family"`  // Image family, optional
+}
+
+// AzureConfig selects where disk images are created as managed images
+type AzureConfig struct {
+	ResourceGroup  string `yaml:"resource_group"`
+	Location       string `yaml:"location"`        // Region (default: the resource group location)
+	StorageAccount string `yaml:"storage_account"` // Storage account VHDs are staged in
+	Container      string `yaml:"container"`       // Blob container (default: images)
+}
+
+// CloudProviders returns the clouds disk images can be uploaded to
+func CloudProviders() []string {
+	return []string{"aws", "gcp", "azure"}
+}
+
+// VMConfig holds the test VM settings
+type VMConfig struct {
+	Tests VMTestsConfig `yaml:"tests"`
+}
+
+// VMTestsConfig holds the checks vm test runs over SSH in a booted disk image
+type VMTestsConfig struct {
+	BootTimeout string      `yaml:"boot_timeout"` // Time to wait for SSH after boot
+	Builtin     []string    `yaml:"builtin"`      // Built-in checks to run, see VMTestBuiltins
+	Checks      []SmokeTest `yaml:"checks"`       // Extra checks, run as root in the VM
+}
+
+// VMTestBuiltins returns the built-in vm test checks
+func VMTestBuiltins() []string {
+	return []string{"bootc-status", "failed-units", "flatpaks"}
+}
+
+// LicensePolicy lists the licenses packages may or may not use. Entries are
+// SPDX license IDs or glob patterns like GPL-*; packages without license
+// information are reported as NOASSERTION.
+type LicensePolicy struct {
+	Allow []string `yaml:"allow"` // When set, every package needs an allowed license
+	Deny  []string `yaml:"deny"`
+}
+
+// CacheConfig holds registry-backed layer cache settings
+type CacheConfig struct {
+	From []string `yaml:"from"` // Repositories to pull cached layers from
+	To   string   `yaml:"to"`   // Repository to push cached layers to
+}
+
+// SecretConfig is a build secret available to RUN --mount=type=secret
+type SecretConfig struct {
+	ID  string `yaml:"id"`
+	Src string `yaml:"src,omitempty"` // File path, relative to the project root
+	Env string `yaml:"env,omitempty"` // Environment variable holding the secret
+}
+
+// CleanConfig holds local image cleanup settings
+type CleanConfig struct {
+	Policy CleanPolicy `yaml:"policy"`
+}
+
+// CleanPolicy prunes locally built image tags per variant
+type CleanPolicy struct {
+	KeepLast      int    `yaml:"keep_last"`      // Newest tags kept per variant (0: no count limit)
+	MaxAge        string `yaml:"max_age"`        // Remove tags older than this (e.g. 168h)
+	PruneDangling bool   `yaml:"prune_dangling"` // Also remove untagged images and layers
+}
+
+// HealthcheckConfig holds the post-build systemd service validation settings
+type HealthcheckConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Units   []string `yaml:"units"`   // Units that must be active and enabled
+	Timeout string   `yaml:"timeout"` // Time to wait for default.target
+}
+
+// TestsConfig holds the smoke tests run inside the built image
+type TestsConfig struct {
+	Enabled bool        `yaml:"enabled"`
+	Checks  []SmokeTest `yaml:"checks"`
+}
+
+// SmokeTest is a single check run in a throwaway container of the image.
+// Exactly one of Command, Script, Packages, or Units is set.
+type SmokeTest struct {
+	Name     string   `yaml:"name"`
+	Command  string   `yaml:"command"`  // Shell command run with /bin/sh -c
+	Script   string   `yaml:"script"`   // Shell script relative to the project root
+	Packages []string `yaml:"packages"` // RPMs that must be installed
+	Units    []string `yaml:"units"`    // systemd units that must be enabled
+}
+
+// valid reports whether exactly one kind of check is set
+func (t SmokeTest) valid() bool {
+	kinds := 0
+	for _, set := range []bool{t.Command != "", t.Script != "", len(t.Packages) > 0, len(t.Units) > 0} {
+		if set {
+			kinds++
+		}
+	}
+	return kinds == 1
+}
+
+// Dirty working tree policies
+const (
+	DirtyPolicyWarn      = "warn"
+	DirtyPolicyBlockPush = "block-push"
+	DirtyPolicySuffix    = "suffix"
+)
+
+// DirtyPolicies returns the supported dirty working tree policies
+func DirtyPolicies() []string {
+	return []string{DirtyPolicyWarn, DirtyPolicyBlockPush, DirtyPolicySuffix}
+}
+
+// ContainerEngines returns the supported container engines
+func ContainerEngines() []string {
+	return exec.Engines()
 }
 
 // BuildDefaults holds default build flags for the CLI.
@@ -67,11 +450,49 @@ type VersionConfig struct {
 
 // Variant represents an image variant (e.g., main, nvidia, dx)
 type Variant struct {
-	Name        string   `yaml:"name"`
-	Description string   `yaml:"description"`
-	Flavor      string   `yaml:"flavor"`
-	Scripts     []string `yaml:"scripts"`
-	Packages    []string `yaml:"packages"`
+	Name          string            `yaml:"name"`
+	Description   string            `yaml:"description"`
+	Flavor        string            `yaml:"flavor"`
+	Scripts       []string          `yaml:"scripts"`
+	Packages      []string          `yaml:"packages"`
+	BuildArgs     map[string]string `yaml:"build_args"`    // Override build.build_args for this variant
+	Labels        map[string]string `yaml:"labels"`        // Extra image labels for this variant
+	Containerfile string            `yaml:"containerfile"` // Containerfile or template relative to the project root
+	Registry      string            `yaml:"registry"`      // Registry of this variant (default: registry)
+	Repository    string            `yaml:"repository"`    // Repository of this variant (default: repository)
+	Image         string            `yaml:"image"`         // Image name (default: <name>-<variant>, or <name> for main)
+}
+
+// Channel is a release channel devices can follow with galena system channel
+type Channel struct {
+	Name        string `yaml:"name"`
+	Tag         string `yaml:"tag"` // Image tag the channel points to; the name when empty
+	Description string `yaml:"description"`
+}
+
+// ImageTag returns the tag of the channel
+func (ch Channel) ImageTag() string {
+	if ch.Tag != "" {
+		return ch.Tag
+	}
+	return ch.Name
+}
+
+// FleetConfig describes how galena-build fleet rolls a new digest out to
+// many devices: in waves, each reaching a percentage of the fleet after a
+// delay, with reboots optionally coordinated by a FleetLock server
+type FleetConfig struct {
+	Waves        []RolloutWave `yaml:"waves"`
+	FleetLockURL string        `yaml:"fleetlock_url"` // FleetLock server (e.g. Airlock) that serializes reboots
+	Group        string        `yaml:"group"`         // FleetLock group of the devices
+	Slots        int           `yaml:"slots"`         // Devices that may reboot at once
+}
+
+// RolloutWave is a step of a staged rollout
+type RolloutWave struct {
+	Name    string `yaml:"name"`
+	Percent int    `yaml:"percent"` // Share of the fleet updated once the wave starts, cumulative
+	Delay   string `yaml:"delay"`   // Time after the rollout starts, e.g. 24h
 }
 
 // Dependency represents a pinned external dependency
@@ -83,7 +504,7 @@ type Dependency struct {
 
 // UIConfig holds user interface preferences.
 type UIConfig struct {
-	Theme      string `yaml:"theme"`
+	Theme      string `yaml:"theme"` // auto, space, daylight, or a theme in ~/.config/galena/themes
 	ShowBanner bool   `yaml:"show_banner"`
 	Dense      bool   `yaml:"dense"`
 	NoColor    bool   `yaml:"no_color"`
@@ -105,7 +526,20 @@ func DefaultConfig() *Config {
 				"/var/cache/rpm-ostree",
 				"/var/cache/libdnf5",
 			},
-			Timeout: "30m",
+			Timeout:     "30m",
+			DirtyPolicy: DirtyPolicyWarn,
+			Engine:      "podman",
+			Healthcheck: HealthcheckConfig{
+				Enabled: false,
+				Units:   []string{},
+				Timeout: "3m",
+			},
+			Tests: TestsConfig{
+				Enabled: false,
+				Checks: []SmokeTest{
+					{Name: "bootc-lint", Command: "bootc container lint"},
+				},
+			},
 			Defaults: BuildDefaults{
 				Variant:     "main",
 				Tag:         "latest",
@@ -119,6 +553,12 @@ func DefaultConfig() *Config {
 				UseJust:     false,
 			},
 		},
+		VM: VMConfig{
+			Tests: VMTestsConfig{
+				BootTimeout: "10m",
+				Builtin:     VMTestBuiltins(),
+			},
+		},
 		Version: VersionConfig{
 			Scheme: "fedora.date.build",
 		},
@@ -130,9 +570,23 @@ func DefaultConfig() *Config {
 				Scripts:     []string{"10-build.sh"},
 			},
 		},
+		Channels: []Channel{
+			{Name: "stable", Description: "Promoted builds that passed testing"},
+			{Name: "latest", Description: "Every build of the default branch"},
+			{Name: "beta", Description: "Release candidates before promotion to stable"},
+		},
+		Fleet: FleetConfig{
+			Waves: []RolloutWave{
+				{Name: "canary", Percent: 5, Delay: "0h"},
+				{Name: "early", Percent: 25, Delay: "24h"},
+				{Name: "broad", Percent: 100, Delay: "72h"},
+			},
+			Group: "default",
+			Slots: 1,
+		},
 		Dependencies: make(map[string]Dependency),
 		UI: UIConfig{
-			Theme:      "space",
+			Theme:      "auto",
 			ShowBanner: false,
 			Dense:      false,
 			NoColor:    false,
@@ -141,27 +595,34 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load loads configuration from a file
+// Load loads configuration from a file. Values are layered: defaults, then
+// the configs the file extends and includes, then the file, then GALENA_*
+// environment variables (see EnvFields); command line flags are applied on
+// top by the commands.
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	cfg, err := loadFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return DefaultConfig(), nil
-		}
-		return nil, fmt.Errorf("reading config: %w", err)
+		return nil, err
 	}
-
-	cfg := DefaultConfig()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("parsing config: %w", err)
+	if err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
 	}
-
 	return cfg, nil
 }
 
-// Save saves configuration to a file
+// Save saves configuration to a file. Values from the environment are
+// not written, and a config that extends others only keeps the settings
+// that differ from them.
 func (c *Config) Save(path string) error {
-	data, err := yaml.Marshal(c)
+	var out any = c.withoutEnv()
+	if c.base != nil {
+		node, err := c.withoutEnv().overridesOf(c.base)
+		if err != nil {
+			return fmt.Errorf("marshaling config: %w", err)
+		}
+		out = node
+	}
+	data, err := yaml.Marshal(out)
 	if err != nil {
 		return fmt.Errorf("marshaling config: %w", err)
 	}
@@ -188,25 +649,246 @@ func (c *Config) Validate() error {
 	if c.Build.FedoraVersion == "" {
 		return fmt.Errorf("build.fedora_version is required")
 	}
+	switch c.Build.DirtyPolicy {
+	case "", DirtyPolicyWarn, DirtyPolicyBlockPush, DirtyPolicySuffix:
+	default:
+		return fmt.Errorf("build.dirty_policy must be one of %s", strings.Join(DirtyPolicies(), ", "))
+	}
+	if c.Clean.Policy.KeepLast < 0 {
+		return fmt.Errorf("clean.policy.keep_last must not be negative")
+	}
+	if c.Clean.Policy.MaxAge != "" {
+		if _, err := time.ParseDuration(c.Clean.Policy.MaxAge); err != nil {
+			return fmt.Errorf("clean.policy.max_age: %w", err)
+		}
+	}
+	switch c.Build.Engine {
+	case "", "podman", "buildah", "docker":
+	default:
+		return fmt.Errorf("build.engine must be one of %s", strings.Join(ContainerEngines(), ", "))
+	}
+	for i, t := range c.Build.Tests.Checks {
+		if !t.valid() {
+			return fmt.Errorf("build.tests.checks[%d] must set exactly one of command, script, packages, or units", i)
+		}
+	}
+	for i, t := range c.VM.Tests.Checks {
+		if !t.valid() {
+			return fmt.Errorf("vm.tests.checks[%d] must set exactly one of command, script, packages, or units", i)
+		}
+	}
+	for _, name := range c.VM.Tests.Builtin {
+		known := false
+		for _, b := range VMTestBuiltins() {
+			if name == b {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("vm.tests.builtin %q is not one of %s", name, strings.Join(VMTestBuiltins(), ", "))
+		}
+	}
+	if c.VM.Tests.BootTimeout != "" {
+		if _, err := time.ParseDuration(c.VM.Tests.BootTimeout); err != nil {
+			return fmt.Errorf("vm.tests.boot_timeout: %w", err)
+		}
+	}
+	if scheme, _, ok := strings.Cut(c.Signing.Key, "://"); ok {
+		known := false
+		for _, k := range KeySchemes() {
+			if scheme+"://" == k {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("signing.key scheme %s:// is not supported (use a file or one of %s)", scheme, strings.Join(KeySchemes(), ", "))
+		}
+	}
+	if c.Signing.KeyFrom != "" && c.Signing.Key != "" {
+		return fmt.Errorf("signing.key and signing.key_from are mutually exclusive")
+	}
+	if c.Signing.PasswordFrom != "" && c.Signing.PasswordEnv != "" {
+		return fmt.Errorf("signing.password_env and signing.password_from are mutually exclusive")
+	}
+	for _, ref := range [][2]string{{"signing.key_from", c.Signing.KeyFrom}, {"signing.password_from", c.Signing.PasswordFrom}} {
+		if ref[1] != "" && !IsSecretRef(ref[1]) {
+			return fmt.Errorf("%s must be a secret reference starting with one of %s", ref[0], strings.Join(SecretSchemes(), ", "))
+		}
+	}
+	switch c.Signing.Checksums {
+	case "", "gpg", "cosign":
+	default:
+		return fmt.Errorf("signing.checksums must be one of %s", strings.Join(ChecksumSigners(), ", "))
+	}
+	if c.Verify.Identity != "" && c.Verify.IdentityRegexp != "" {
+		return fmt.Errorf("verify.identity and verify.identity_regexp are mutually exclusive")
+	}
+	if c.Verify.Issuer != "" && c.Verify.IssuerRegexp != "" {
+		return fmt.Errorf("verify.issuer and verify.issuer_regexp are mutually exclusive")
+	}
+	for _, pattern := range append(append([]string{}, c.SBOM.Licenses.Allow...), c.SBOM.Licenses.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("sbom.licenses pattern %q: %w", pattern, err)
+		}
+	}
+	for _, sev := range append(append([]string{}, c.Scan.Severity...), c.Scan.FailOn) {
+		if sev != "" && SeverityRank(sev) < 0 {
+			return fmt.Errorf("scan severity %q is not one of %s", sev, strings.Join(Severities(), ", "))
+		}
+	}
+	names := map[string]bool{}
+	for i, r := range c.Registries {
+		if r.Name == "" || r.Repository == "" {
+			return fmt.Errorf("registries[%d] requires name and repository", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("registries.%s is defined more than once", r.Name)
+		}
+		names[r.Name] = true
+		if (r.UsernameEnv == "") != (r.PasswordEnv == "") {
+			return fmt.Errorf("registries.%s must set both username_env and password_env", r.Name)
+		}
+		if r.Retries < 0 {
+			return fmt.Errorf("registries.%s.retries must not be negative", r.Name)
+		}
+	}
+	if (c.Template.Ref != "" || c.Template.Commit != "") && !strings.HasPrefix(c.Template.Source, "gh:") {
+		return fmt.Errorf("template.ref and template.commit need a gh:owner/repo template.source")
+	}
+	hosts := map[string]bool{}
+	for i, cred := range c.Credentials {
+		if cred.Registry == "" || cred.Username == "" || cred.Password == "" {
+			return fmt.Errorf("credentials[%d] requires registry, username, and password", i)
+		}
+		if strings.Contains(cred.Registry, "/") {
+			return fmt.Errorf("credentials.%s: registry must be a host such as ghcr.io", cred.Registry)
+		}
+		if hosts[cred.Registry] {
+			return fmt.Errorf("credentials.%s is defined more than once", cred.Registry)
+		}
+		hosts[cred.Registry] = true
+		if !IsSecretRef(cred.Password) {
+			return fmt.Errorf("credentials.%s.password must be a secret reference starting with one of %s, not the password itself", cred.Registry, strings.Join(SecretSchemes(), ", "))
+		}
+	}
+	for i, n := range c.Notifications {
+		if !slices.Contains(NotificationTypes(), n.Type) {
+			return fmt.Errorf("notifications[%d].type must be one of %s", i, strings.Join(NotificationTypes(), ", "))
+		}
+		if n.Type != "desktop" && n.URL == "" && n.URLEnv == "" {
+			return fmt.Errorf("notifications[%d] (%s) requires url or url_env", i, n.Type)
+		}
+		if n.Type == "matrix" && (n.Room == "" || n.TokenEnv == "") {
+			return fmt.Errorf("notifications[%d] (matrix) requires room and token_env", i)
+		}
+		for _, event := range n.Events {
+			if !slices.Contains(NotificationEvents(), event) {
+				return fmt.Errorf("notifications[%d]: unknown event %q (expected %s)", i, event, strings.Join(NotificationEvents(), ", "))
+			}
+		}
+	}
+	if c.Logs.Keep < 0 {
+		return fmt.Errorf("logs.keep must not be negative")
+	}
+	if c.Audit.MaxOutput < 0 {
+		return fmt.Errorf("audit.max_output must not be negative")
+	}
+	if c.Retry.Attempts < 0 {
+		return fmt.Errorf("retry.attempts must not be negative")
+	}
+	for field, value := range map[string]string{"delay": c.Retry.Delay, "max_delay": c.Retry.MaxDelay} {
+		if _, err := time.ParseDuration(value); value != "" && err != nil {
+			return fmt.Errorf("retry.%s: %w", field, err)
+		}
+	}
+	channels := map[string]bool{}
+	for _, ch := range c.Channels {
+		if ch.Name == "" {
+			return fmt.Errorf("channels: every channel needs a name")
+		}
+		if channels[ch.Name] {
+			return fmt.Errorf("channels.%s is defined twice", ch.Name)
+		}
+		channels[ch.Name] = true
+	}
+	lastPercent := 0
+	for _, w := range c.Fleet.Waves {
+		if w.Percent <= lastPercent || w.Percent > 100 {
+			return fmt.Errorf("fleet.waves.%s.percent must increase from wave to wave and be at most 100", w.Name)
+		}
+		lastPercent = w.Percent
+		if _, err := time.ParseDuration(w.Delay); w.Delay != "" && err != nil {
+			return fmt.Errorf("fleet.waves.%s.delay: %w", w.Name, err)
+		}
+	}
+	if c.Fleet.Slots < 0 {
+		return fmt.Errorf("fleet.slots must not be negative")
+	}
+	for _, v := range c.Variants {
+		if filepath.IsAbs(v.Containerfile) {
+			return fmt.Errorf("variants.%s.containerfile must be relative to the project root", v.Name)
+		}
+		if strings.Contains(v.Registry, "/") {
+			return fmt.Errorf("variants.%s.registry must be a host such as quay.io; put the path in repository", v.Name)
+		}
+		if strings.ContainsAny(v.Image, ":@/") {
+			return fmt.Errorf("variants.%s.image must be a plain image name without registry, tag, or digest", v.Name)
+		}
+	}
+	if c.Version.Scheme != "" && !slices.Contains(VersionSchemes(), c.Version.Scheme) {
+		return fmt.Errorf("version.scheme must be one of %s", strings.Join(VersionSchemes(), ", "))
+	}
+	for field, value := range map[string]string{"build.timeout": c.Build.Timeout, "build.healthcheck.timeout": c.Build.Healthcheck.Timeout} {
+		if _, err := time.ParseDuration(value); value != "" && err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	if c.Build.BaseImageDigest != "" && !ValidDigest(c.Build.BaseImageDigest) {
+		return fmt.Errorf("build.base_image_digest %q is not a digest (expected sha256:<hex>)", c.Build.BaseImageDigest)
+	}
+	for name, dep := range c.Dependencies {
+		if dep.Digest != "" && !ValidDigest(dep.Digest) {
+			return fmt.Errorf("dependencies.%s.digest %q is not a digest (expected sha256:<hex>)", name, dep.Digest)
+		}
+	}
 	return nil
 }
 
 // ImageRef returns the full image reference for a variant and tag
 func (c *Config) ImageRef(variant, tag string) string {
-	name := c.Name
-	if variant != "" && variant != "main" {
-		name = name + "-" + variant
-	}
+	registry, repository, name := c.ImageLocation(variant)
 
 	// For pushes and remote references, registry and repository must be set
-	if c.Registry != "" && c.Repository != "" {
-		return fmt.Sprintf("%s/%s/%s:%s", c.Registry, c.Repository, name, tag)
+	if registry != "" && repository != "" {
+		return fmt.Sprintf("%s/%s/%s:%s", registry, repository, name, tag)
 	}
 
 	// For local-only builds without registry/repository set, default to localhost/
 	return fmt.Sprintf("localhost/%s:%s", name, tag)
 }
 
+// ImageLocation returns the registry, repository, and image name of a
+// variant, taking its overrides into account
+func (c *Config) ImageLocation(variant string) (registry, repository, name string) {
+	registry, repository, name = c.Registry, c.Repository, c.Name
+	if variant != "" && variant != "main" {
+		name = name + "-" + variant
+	}
+	if v, err := c.GetVariant(variant); err == nil {
+		registry = cmp.Or(v.Registry, registry)
+		repository = cmp.Or(v.Repository, repository)
+		name = cmp.Or(v.Image, name)
+	}
+	return registry, repository, name
+}
+
+// HasRegistry reports whether images of a variant have a registry and
+// repository to be pushed to
+func (c *Config) HasRegistry(variant string) bool {
+	registry, repository, _ := c.ImageLocation(variant)
+	return registry != "" && repository != ""
+}
+
 // ComputeVersion computes the version string based on the scheme
 func (c *Config) ComputeVersion(buildNum int) string {
 	now := time.Now()
@@ -226,7 +908,7 @@ func (c *Config) ComputeVersion(buildNum int) string {
 	}
 }
 
-// FindProjectRoot finds the project root by looking for Containerfile
+// FindProjectRoot finds the project root by looking for Containerfile, Containerfile.tmpl, or Dockerfile
 func FindProjectRoot() (string, error) {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -237,6 +919,9 @@ func FindProjectRoot() (string, error) {
 		if _, err := os.Stat(filepath.Join(dir, "Containerfile")); err == nil {
 			return dir, nil
 		}
+		if _, err := os.Stat(filepath.Join(dir, "Containerfile.tmpl")); err == nil {
+			return dir, nil
+		}
 		if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err == nil {
 			return dir, nil
 		}
@@ -281,6 +966,16 @@ func (c *Config) GetVariant(name string) (*Variant, error) {
 	return nil, fmt.Errorf("variant %q not found", name)
 }
 
+// GetChannel returns a channel by name
+func (c *Config) GetChannel(name string) (*Channel, error) {
+	for i := range c.Channels {
+		if c.Channels[i].Name == name {
+			return &c.Channels[i], nil
+		}
+	}
+	return nil, fmt.Errorf("channel %q not found", name)
+}
+
 // ListVariantNames returns a list of variant names
 func (c *Config) ListVariantNames() []string {
 	names := make([]string, len(c.Variants))
@@ -290,6 +985,18 @@ func (c *Config) ListVariantNames() []string {
 	return names
 }
 
+// BaseImageRef returns the base image pinned to its digest when one is recorded
+func (c *Config) BaseImageRef() string {
+	if c.Build.BaseImageDigest == "" {
+		return c.Build.BaseImage
+	}
+	image := c.Build.BaseImage
+	if at := strings.Index(image, "@"); at >= 0 {
+		image = image[:at]
+	}
+	return image + "@" + c.Build.BaseImageDigest
+}
+
 // GetDependencyRef returns the full reference for a dependency (with digest if available)
 func (c *Config) GetDependencyRef(name string) (string, error) {
 	dep, ok := c.Dependencies[name]
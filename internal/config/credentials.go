@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetCredential records where the credentials of a registry come from in a
+// config file, replacing the entry of the same registry. Comments and
+// layout are kept, as with SetFileValue.
+func SetCredential(path string, c CredentialConfig) error {
+	var entry yaml.Node
+	if err := entry.Encode(c); err != nil {
+		return err
+	}
+	return editFile(path, "credentials", func(parent *yaml.Node, segment string) error {
+		list, err := listValue(parent, segment)
+		if err != nil {
+			return err
+		}
+		if i := credentialIndex(list, c.Registry); i >= 0 {
+			entry.HeadComment = list.Content[i].HeadComment
+			list.Content[i] = &entry
+			return nil
+		}
+		list.Content = append(list.Content, &entry)
+		return nil
+	})
+}
+
+// RemoveCredential removes the credentials of a registry from a config file
+func RemoveCredential(path, registry string) error {
+	return editFile(path, "credentials", func(parent *yaml.Node, segment string) error {
+		j := mappingIndex(parent, segment)
+		if j < 0 || credentialIndex(parent.Content[j+1], registry) < 0 {
+			return fmt.Errorf("no credentials for %s in %s", registry, filepath.Base(path))
+		}
+		list := parent.Content[j+1]
+		i := credentialIndex(list, registry)
+		list.Content = append(list.Content[:i], list.Content[i+1:]...)
+		return nil
+	})
+}
+
+// credentialIndex finds the entry of a registry in a credentials sequence
+func credentialIndex(list *yaml.Node, registry string) int {
+	if list.Kind != yaml.SequenceNode {
+		return -1
+	}
+	for i, item := range list.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if j := mappingIndex(item, "registry"); j >= 0 && item.Content[j+1].Value == registry {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// deviceSettings is the part of galena.yaml a device reads: where the
+// images of each variant live, the release channels, and how signatures are
+// verified
+type deviceSettings struct {
+	Name       string          `yaml:"name"`
+	Registry   string          `yaml:"registry,omitempty"`
+	Repository string          `yaml:"repository,omitempty"`
+	Variants   []deviceVariant `yaml:"variants,omitempty"`
+	Channels   []Channel       `yaml:"channels,omitempty"`
+	Verify     *yaml.Node      `yaml:"verify,omitempty"`
+}
+
+type deviceVariant struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Registry    string `yaml:"registry,omitempty"`
+	Repository  string `yaml:"repository,omitempty"`
+	Image       string `yaml:"image,omitempty"`
+}
+
+// DeviceYAML renders the settings galena system channel reads on a device,
+// for shipping in an image. Build settings, hooks, notifications, and
+// credentials are left out.
+func (c *Config) DeviceYAML() ([]byte, error) {
+	out := deviceSettings{
+		Name:       c.Name,
+		Registry:   c.Registry,
+		Repository: c.Repository,
+		Channels:   c.Channels,
+	}
+	for _, v := range c.Variants {
+		out.Variants = append(out.Variants, deviceVariant{
+			Name:        v.Name,
+			Description: v.Description,
+			Registry:    v.Registry,
+			Repository:  v.Repository,
+			Image:       v.Image,
+		})
+	}
+	var verify yaml.Node
+	if err := verify.Encode(c.Verify); err != nil {
+		return nil, fmt.Errorf("marshaling device config: %w", err)
+	}
+	pruneEmpty(&verify)
+	if len(verify.Content) > 0 {
+		out.Verify = &verify
+	}
+
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling device config: %w", err)
+	}
+	return data, nil
+}
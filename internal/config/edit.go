@@ -0,0 +1,392 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// splitKey splits a dotted key such as variants[0].packages or
+// build.build_args.VENDOR into its segments
+func splitKey(key string) ([]string, error) {
+	key = strings.NewReplacer("[", ".", "]", "").Replace(key)
+	segments := strings.Split(key, ".")
+	for _, s := range segments {
+		if s == "" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return segments, nil
+}
+
+// Get returns the value at a dotted key, e.g. build.defaults.tag. List
+// items are addressed by index (variants[0]) or, for lists of named
+// entries, by name (variants.nvidia).
+func (c *Config) Get(key string) (any, error) {
+	segments, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(c).Elem()
+	for i, segment := range segments {
+		at := strings.Join(segments[:i+1], ".")
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := yamlFields(v.Type())[segment]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown key", at)
+			}
+			v = v.FieldByIndex(field.Index)
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(segment))
+			if !v.IsValid() {
+				return nil, fmt.Errorf("%s: not set", at)
+			}
+		case reflect.Slice:
+			index := listIndex(v, segment)
+			if index < 0 {
+				return nil, fmt.Errorf("%s: no such list item", at)
+			}
+			v = v.Index(index)
+		default:
+			return nil, fmt.Errorf("%s: %s is not a mapping or list", at, strings.Join(segments[:i], "."))
+		}
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+	}
+	return v.Interface(), nil
+}
+
+// listIndex finds a list item by index or by its name field
+func listIndex(list reflect.Value, segment string) int {
+	if n, err := strconv.Atoi(segment); err == nil {
+		if n >= 0 && n < list.Len() {
+			return n
+		}
+		return -1
+	}
+	for i := range list.Len() {
+		item := list.Index(i)
+		if item.Kind() == reflect.Struct {
+			if name := item.FieldByName("Name"); name.IsValid() && name.String() == segment {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// keyType returns the type of the value at a key
+func keyType(segments []string) (reflect.Type, error) {
+	t := reflect.TypeFor[Config]()
+	for i, segment := range segments {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := yamlFields(t)[segment]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown key%s", strings.Join(segments[:i+1], "."), suggestKey(segment, yamlFields(t)))
+			}
+			t = field.Type
+		case reflect.Map, reflect.Slice:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("%s is a %s, not a mapping or list", strings.Join(segments[:i], "."), t.Kind())
+		}
+	}
+	return t, nil
+}
+
+// ParseValue converts a command line value to the type of the field at
+// key. Strings are taken literally; numbers and booleans are parsed; lists
+// of strings or numbers accept comma-separated items; other types take a
+// YAML value, e.g. {name: dx, flavor: dx} for a variant.
+func ParseValue(key, value string) (any, error) {
+	segments, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	t, err := keyType(segments)
+	if err != nil {
+		return nil, err
+	}
+
+	if envType(t) != "" && envType(t) != "map" && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		parsed, err := parseEnvValue(value, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is %v", key, value, err)
+		}
+		return parsed.Interface(), nil
+	}
+	ptr := reflect.New(t)
+	if err := yaml.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("%s: expected a YAML %s: %w", key, t.Kind(), err)
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// SetFileValue sets a key in a config file to a value from the command
+// line, see ParseValue. The file is edited in place, keeping its comments
+// and layout, and only written when the result validates.
+func SetFileValue(path, key, value string) error {
+	parsed, err := ParseValue(key, value)
+	if err != nil {
+		return err
+	}
+	var valueNode yaml.Node
+	if err := valueNode.Encode(parsed); err != nil {
+		return err
+	}
+	// Mappings and lists of objects are written as given rather than with
+	// every zero field of their type
+	if valueNode.Kind == yaml.MappingNode || (valueNode.Kind == yaml.SequenceNode && strings.HasPrefix(strings.TrimSpace(value), "[")) {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err == nil && len(doc.Content) > 0 {
+			valueNode = *doc.Content[0]
+			blockStyle(&valueNode)
+		}
+	}
+	return editFile(path, key, func(parent *yaml.Node, segment string) error {
+		if parent.Kind == yaml.SequenceNode {
+			index, err := strconv.Atoi(segment)
+			switch {
+			case err == nil && index == len(parent.Content):
+				parent.Content = append(parent.Content, &valueNode)
+			case err == nil && index >= 0 && index < len(parent.Content):
+				parent.Content[index] = &valueNode
+			default:
+				i := nodeListIndex(parent, segment)
+				if i < 0 {
+					return fmt.Errorf("%s: no such list item", key)
+				}
+				parent.Content[i] = &valueNode
+			}
+			return nil
+		}
+		if i := mappingIndex(parent, segment); i >= 0 {
+			valueNode.HeadComment = parent.Content[i+1].HeadComment
+			valueNode.LineComment = parent.Content[i+1].LineComment
+			parent.Content[i+1] = &valueNode
+			return nil
+		}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: segment}, &valueNode)
+		return nil
+	})
+}
+
+// UnsetFileValue removes a key or list item from a config file, so it
+// falls back to the inherited or default value
+func UnsetFileValue(path, key string) error {
+	return editFile(path, key, func(parent *yaml.Node, segment string) error {
+		if parent.Kind == yaml.SequenceNode {
+			i := nodeListIndex(parent, segment)
+			if i < 0 {
+				return fmt.Errorf("%s is not set in %s", key, filepath.Base(path))
+			}
+			parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+			return nil
+		}
+		i := mappingIndex(parent, segment)
+		if i < 0 {
+			return fmt.Errorf("%s is not set in %s", key, filepath.Base(path))
+		}
+		parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+		return nil
+	})
+}
+
+// editFile finds the node holding the last segment of key in a config
+// file, creating missing mappings on the way, applies edit to it, and
+// writes the file back if the result validates
+func editFile(path, key string, edit func(parent *yaml.Node, segment string) error) error {
+	segments, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	if _, err := keyType(segments); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	node := doc.Content[0]
+	for i, segment := range segments[:len(segments)-1] {
+		at := strings.Join(segments[:i+1], ".")
+		var child *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			if j := mappingIndex(node, segment); j >= 0 {
+				child = node.Content[j+1]
+			} else {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: segment}, child)
+			}
+		case yaml.SequenceNode:
+			j := nodeListIndex(node, segment)
+			if j < 0 {
+				return fmt.Errorf("%s: no such list item in %s", at, filepath.Base(path))
+			}
+			child = node.Content[j]
+		default:
+			return fmt.Errorf("%s: not a mapping or list in %s", at, filepath.Base(path))
+		}
+		// An empty value such as "dependencies:" becomes a mapping
+		if child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+			*child = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: child.HeadComment, LineComment: child.LineComment}
+		}
+		node = child
+	}
+	// Flow style such as {} would keep new entries on one line
+	node.Style &^= yaml.FlowStyle
+
+	if err := edit(node, segments[len(segments)-1]); err != nil {
+		return err
+	}
+
+	data, err = encodeNode(&doc)
+	if err != nil {
+		return err
+	}
+	return writeValidated(path, data)
+}
+
+// encodeNode marshals a document with the two-space indent of galena.yaml
+func encodeNode(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("marshaling config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeValidated replaces a config file with data if it passes
+// ValidateFile, and leaves the file untouched otherwise
+func writeValidated(path string, data []byte) error {
+	// Validate next to the original so extends paths resolve the same way
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".galena-*.yaml")
+	if err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	if err := ValidateFile(tmp.Name()); err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			validationErr.File = filepath.Base(path)
+		}
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	return nil
+}
+
+// nodeListIndex finds a sequence item by index or by its name key
+func nodeListIndex(list *yaml.Node, segment string) int {
+	if n, err := strconv.Atoi(segment); err == nil {
+		if n >= 0 && n < len(list.Content) {
+			return n
+		}
+		return -1
+	}
+	for i, item := range list.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if j := mappingIndex(item, "name"); j >= 0 && item.Content[j+1].Value == segment {
+			return i
+		}
+	}
+	return -1
+}
+
+// listValue returns a sequence of the top-level mapping by key,
+// creating it or turning an empty value into a block sequence
+func listValue(parent *yaml.Node, key string) (*yaml.Node, error) {
+	i := mappingIndex(parent, key)
+	if i < 0 {
+		list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, list)
+		return list, nil
+	}
+	list := parent.Content[i+1]
+	switch {
+	case list.Kind == yaml.ScalarNode && list.Tag == "!!null":
+		*list = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", HeadComment: list.HeadComment, LineComment: list.LineComment}
+	case list.Kind != yaml.SequenceNode:
+		return nil, fmt.Errorf("%s is not a list", key)
+	}
+	list.Style &^= yaml.FlowStyle
+	return list, nil
+}
+
+// Keys lists the dotted keys of galena.yaml, down to lists and maps
+func Keys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		fields := yamlFields(t)
+		names := slices.Sorted(maps.Keys(fields))
+		for _, name := range names {
+			key := joinPath(prefix, name)
+			keys = append(keys, key)
+			if ft := fields[name].Type; ft.Kind() == reflect.Struct {
+				walk(ft, key)
+			}
+		}
+	}
+	walk(reflect.TypeFor[Config](), "")
+	return keys
+}
+
+// blockStyle turns flow style such as {a: 1} into block style
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
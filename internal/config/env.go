@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables that override galena.yaml
+const EnvPrefix = "GALENA_"
+
+// EnvOverride is a config field set from an environment variable
+type EnvOverride struct {
+	Var  string // e.g. GALENA_BUILD_FEDORA_VERSION
+	Path string // e.g. build.fedora_version
+
+	index    []int
+	mapKey   string        // Key set in a map field such as build.build_args
+	original reflect.Value // Value before the override
+	applied  reflect.Value
+	existed  bool // Whether mapKey was set before the override
+}
+
+// EnvField is a config field that can be overridden from the environment
+type EnvField struct {
+	Var  string // Variable name, or its prefix for map fields
+	Path string
+	Type string // string, int, bool, list (comma-separated), or map
+}
+
+// EnvFields lists the overridable fields of galena.yaml. Every field of a
+// scalar, string list, or string map type has a variable: the GALENA_
+// prefix and its dotted path in upper case with underscores, e.g.
+// build.fedora_version is GALENA_BUILD_FEDORA_VERSION. Entries of string
+// maps take the key as a suffix, e.g. GALENA_BUILD_BUILD_ARGS_IMAGE_NAME.
+// Fields inside lists of objects, such as variants, have no variable.
+func EnvFields() []EnvField {
+	var fields []EnvField
+	walkEnvFields(reflect.TypeFor[Config](), "", nil, func(path string, _ []int, t reflect.Type) {
+		field := EnvField{Var: envVar(path), Path: path, Type: envType(t)}
+		if field.Type == "map" {
+			field.Var += "_"
+		}
+		fields = append(fields, field)
+	})
+	return fields
+}
+
+// EnvOverrides returns the fields set from the environment when the config
+// was loaded
+func (c *Config) EnvOverrides() []EnvOverride {
+	return c.env
+}
+
+// ErrEnvOverride reports a GALENA_* variable whose value does not parse as
+// the field it names
+var ErrEnvOverride = errors.New("environment overrides")
+
+// ApplyEnv overrides fields with the GALENA_* variables of environ (in
+// os.Environ form). Variables that do not name a field are ignored, as
+// other settings share the prefix.
+func (c *Config) ApplyEnv(environ []string) error {
+	vars := map[string]string{}
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(name, EnvPrefix) {
+			vars[name] = value
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	root := reflect.ValueOf(c).Elem()
+	var errs []string
+	walkEnvFields(root.Type(), "", nil, func(path string, index []int, t reflect.Type) {
+		field := root.FieldByIndex(index)
+		name := envVar(path)
+
+		if t.Kind() == reflect.Map {
+			keys := []string{}
+			for v := range vars {
+				if key, ok := strings.CutPrefix(v, name+"_"); ok && key != "" {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				m := map[string]string{}
+				if !field.IsNil() {
+					m = maps.Clone(field.Interface().(map[string]string))
+				}
+				old, existed := m[key]
+				m[key] = vars[name+"_"+key]
+				o := EnvOverride{Var: name + "_" + key, Path: path + "." + key, index: index, mapKey: key, existed: existed}
+				o.original = reflect.ValueOf(old)
+				o.applied = reflect.ValueOf(m[key])
+				field.Set(reflect.ValueOf(m))
+				c.env = append(c.env, o)
+			}
+			return
+		}
+
+		raw, ok := vars[name]
+		if !ok {
+			return
+		}
+		value, err := parseEnvValue(raw, t)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s=%q: %v", name, raw, err))
+			return
+		}
+		c.env = append(c.env, EnvOverride{Var: name, Path: path, index: index, original: copyValue(field), applied: value})
+		field.Set(value)
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrEnvOverride, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// withoutEnv returns the config with the values the environment replaced
+// restored, so saving does not write overrides into galena.yaml. Fields
+// changed again after loading keep their new value.
+func (c *Config) withoutEnv() *Config {
+	if len(c.env) == 0 {
+		return c
+	}
+	restored := *c
+	root := reflect.ValueOf(&restored).Elem()
+	for _, o := range c.env {
+		field := root.FieldByIndex(o.index)
+		if o.mapKey == "" {
+			if reflect.DeepEqual(field.Interface(), o.applied.Interface()) {
+				field.Set(o.original)
+			}
+			continue
+		}
+		m, _ := field.Interface().(map[string]string)
+		if value, ok := m[o.mapKey]; !ok || value != o.applied.String() {
+			continue
+		}
+		m = maps.Clone(m)
+		if o.existed {
+			m[o.mapKey] = o.original.String()
+		} else {
+			delete(m, o.mapKey)
+		}
+		field.Set(reflect.ValueOf(m))
+	}
+	restored.env = nil
+	return &restored
+}
+
+// walkEnvFields calls fn for every overridable field below t
+func walkEnvFields(t reflect.Type, path string, index []int, fn func(path string, index []int, t reflect.Type)) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		// Bases are resolved before the environment is applied
+		if path == "" && (name == "extends" || name == "include") {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+		fieldIndex := append(slices.Clone(index), i)
+		if f.Type.Kind() == reflect.Struct {
+			walkEnvFields(f.Type, fieldPath, fieldIndex, fn)
+			continue
+		}
+		if envType(f.Type) != "" {
+			fn(fieldPath, fieldIndex, f.Type)
+		}
+	}
+}
+
+// envType names the overridable kind of t, or returns "" when fields of
+// type t cannot be set from a single variable
+func envType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int:
+		return "int"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Bool {
+			return "bool"
+		}
+	case reflect.Slice:
+		if k := t.Elem().Kind(); k == reflect.String || k == reflect.Int {
+			return "list"
+		}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String {
+			return "map"
+		}
+	}
+	return ""
+}
+
+func envVar(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// parseEnvValue converts a variable to a value of type t. Lists are
+// comma-separated; an empty variable clears a list.
+func parseEnvValue(raw string, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(raw).Convert(t), nil
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("not an integer")
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("not a boolean")
+		}
+		return reflect.ValueOf(b), nil
+	case reflect.Pointer:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("not a boolean")
+		}
+		return reflect.ValueOf(&b), nil
+	case reflect.Slice:
+		list := reflect.MakeSlice(t, 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			value, err := parseEnvValue(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			list = reflect.Append(list, value)
+		}
+		return list, nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+}
+
+// copyValue returns a copy of v that later changes to v do not affect
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   []string
+		check func(t *testing.T, c *Config)
+	}{
+		{
+			name: "string",
+			env:  []string{"GALENA_BUILD_FEDORA_VERSION=43"},
+			check: func(t *testing.T, c *Config) {
+				if c.Build.FedoraVersion != "43" {
+					t.Errorf("build.fedora_version = %q, want 43", c.Build.FedoraVersion)
+				}
+			},
+		},
+		{
+			name: "int and bool",
+			env:  []string{"GALENA_RETRY_ATTEMPTS= 5", "GALENA_BUILD_DEFAULTS_PUSH=true"},
+			check: func(t *testing.T, c *Config) {
+				if c.Retry.Attempts != 5 || !c.Build.Defaults.Push {
+					t.Errorf("retry.attempts = %d, build.defaults.push = %v", c.Retry.Attempts, c.Build.Defaults.Push)
+				}
+			},
+		},
+		{
+			name: "lists are comma-separated",
+			env:  []string{"GALENA_SCAN_SEVERITY=HIGH, CRITICAL,", "GALENA_RETRY_EXIT_CODES=125,126"},
+			check: func(t *testing.T, c *Config) {
+				if !slices.Equal(c.Scan.Severity, []string{"HIGH", "CRITICAL"}) || !slices.Equal(c.Retry.ExitCodes, []int{125, 126}) {
+					t.Errorf("scan.severity = %q, retry.exit_codes = %v", c.Scan.Severity, c.Retry.ExitCodes)
+				}
+			},
+		},
+		{
+			name: "map entries take the key as a suffix",
+			env:  []string{"GALENA_BUILD_BUILD_ARGS_IMAGE_VENDOR=acme"},
+			check: func(t *testing.T, c *Config) {
+				if c.Build.BuildArgs["IMAGE_VENDOR"] != "acme" {
+					t.Errorf("build.build_args = %v", c.Build.BuildArgs)
+				}
+			},
+		},
+		{
+			name: "unrelated variables are ignored",
+			env:  []string{"GALENA_TOKEN=x", "HOME=/root", "REGISTRY=quay.io"},
+			check: func(t *testing.T, c *Config) {
+				if len(c.EnvOverrides()) != 0 || c.Registry != DefaultConfig().Registry {
+					t.Errorf("overrides = %+v, registry = %q", c.EnvOverrides(), c.Registry)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			if err := c.ApplyEnv(tt.env); err != nil {
+				t.Fatalf("ApplyEnv: %v", err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestApplyEnvRejectsMalformedValues(t *testing.T) {
+	for _, kv := range []string{"GALENA_RETRY_ATTEMPTS=three", "GALENA_BUILD_DEFAULTS_PUSH=yes please", "GALENA_RETRY_EXIT_CODES=1,x"} {
+		t.Run(kv, func(t *testing.T) {
+			err := DefaultConfig().ApplyEnv([]string{kv})
+			if !errors.Is(err, ErrEnvOverride) {
+				t.Errorf("ApplyEnv(%s) = %v, want ErrEnvOverride", kv, err)
+			}
+		})
+	}
+}
+
+func TestSaveLeavesOutEnvOverrides(t *testing.T) {
+	c := DefaultConfig()
+	c.Build.BuildArgs = map[string]string{"KEEP": "1"}
+	if err := c.ApplyEnv([]string{"GALENA_REGISTRY=registry.internal", "GALENA_BUILD_BUILD_ARGS_TOKEN=s3cr3t-from-env"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "galena.yaml")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"registry.internal", "s3cr3t-from-env"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("saved config contains the override %q", leaked)
+		}
+	}
+	if !strings.Contains(string(data), "KEEP") {
+		t.Error("saved config lost build.build_args.KEEP")
+	}
+	if c.Registry != "registry.internal" {
+		t.Errorf("Save changed the loaded registry to %q", c.Registry)
+	}
+}
+
+func TestEnvFields(t *testing.T) {
+	vars := map[string]string{}
+	for _, f := range EnvFields() {
+		vars[f.Var] = f.Type
+	}
+	for name, want := range map[string]string{
+		"GALENA_REGISTRY":             "string",
+		"GALENA_BUILD_FEDORA_VERSION": "string",
+		"GALENA_RETRY_ATTEMPTS":       "int",
+		"GALENA_BUILD_DEFAULTS_PUSH":  "bool",
+		"GALENA_SCAN_SEVERITY":        "list",
+		"GALENA_BUILD_BUILD_ARGS_":    "map",
+	} {
+		if got := vars[name]; got != want {
+			t.Errorf("%s has type %q, want %q", name, got, want)
+		}
+	}
+	for name := range vars {
+		if strings.HasPrefix(name, "GALENA_VARIANTS") || name == "GALENA_EXTENDS" || name == "GALENA_INCLUDE" {
+			t.Errorf("%s should not be overridable", name)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fetchTimeout bounds downloading a base config from a URL
+const fetchTimeout = 30 * time.Second
+
+// baseRefs are the keys of a config that name the configs it builds on
+type baseRefs struct {
+	Extends string   `yaml:"extends"`
+	Include []string `yaml:"include"`
+}
+
+// loadFile reads a config file and the configs it extends and includes,
+// layered over the defaults. The environment is not applied.
+func loadFile(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	node, err := parseConfigNode(data)
+	if err != nil || node == nil {
+		return cfg, err
+	}
+
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := resolveBases(node, source, []string{source})
+	if err != nil {
+		return nil, err
+	}
+	if bases != nil {
+		base := DefaultConfig()
+		if err := bases.Decode(base); err != nil {
+			return nil, fmt.Errorf("parsing base config: %w", err)
+		}
+		cfg.base = base
+		node = mergeNodes(bases, node)
+	}
+
+	if err := node.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	return cfg, nil
+}
+
+// parseConfigNode returns the top-level mapping of a config document, or
+// nil for an empty document
+func parseConfigNode(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parsing config: expected a mapping at the top level")
+	}
+	return node, nil
+}
+
+// resolveBases merges the configs node extends and includes, in that
+// order, each with its own bases resolved first. It returns nil when node
+// builds on nothing. chain holds the sources being resolved, to detect
+// cycles.
+func resolveBases(node *yaml.Node, source string, chain []string) (*yaml.Node, error) {
+	var refs baseRefs
+	if err := node.Decode(&refs); err != nil {
+		return nil, fmt.Errorf("%s: extends/include: %w", source, err)
+	}
+	var targets []string
+	if refs.Extends != "" {
+		targets = append(targets, refs.Extends)
+	}
+	targets = append(targets, refs.Include...)
+
+	var merged *yaml.Node
+	for _, target := range targets {
+		location, err := resolveLocation(source, target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if slices.Contains(chain, location) {
+			return nil, fmt.Errorf("config inheritance cycle: %s -> %s", strings.Join(chain, " -> "), location)
+		}
+		data, err := fetchConfig(location)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		parent, err := parseConfigNode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		if parent == nil {
+			continue
+		}
+		grandparents, err := resolveBases(parent, location, append(slices.Clone(chain), location))
+		if err != nil {
+			return nil, err
+		}
+		parent = withoutBaseRefs(parent)
+		if grandparents != nil {
+			parent = mergeNodes(grandparents, parent)
+		}
+		merged = mergeNodes(merged, parent)
+	}
+	return merged, nil
+}
+
+// resolveLocation resolves target against the config that names it: URLs
+// are used as they are, paths are relative to the directory of source
+func resolveLocation(source, target string) (string, error) {
+	if strings.HasPrefix(target, "http://") {
+		return "", fmt.Errorf("%s: base configs must be fetched over https", target)
+	}
+	if strings.HasPrefix(target, "https://") {
+		return target, nil
+	}
+	if strings.HasPrefix(source, "https://") {
+		base, err := url.Parse(source)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(target)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+	if filepath.IsAbs(target) {
+		return filepath.Clean(target), nil
+	}
+	return filepath.Join(filepath.Dir(source), target), nil
+}
+
+// fetchConfig reads a base config from a path or an https URL. Downloads
+// are cached, and the cached copy is used when the URL cannot be reached.
+func fetchConfig(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "https://") {
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("reading base config: %w", err)
+		}
+		return data, nil
+	}
+
+	cachePath := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		sum := sha256.Sum256([]byte(location))
+		cachePath = filepath.Join(dir, "galena", "configs", hex.EncodeToString(sum[:8])+".yaml")
+	}
+
+	data, err := download(location)
+	if err != nil {
+		if cached, cacheErr := os.ReadFile(cachePath); cachePath != "" && cacheErr == nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err == nil {
+			_ = os.WriteFile(cachePath, data, 0o644)
+		}
+	}
+	return data, nil
+}
+
+func download(location string) ([]byte, error) {
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, fmt.Errorf("fetching base config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching base config %s: %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// mergeNodes deep-merges override into base and returns the result without
+// modifying either. Mappings are merged key by key; lists and scalars in
+// override replace those in base.
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	if base == nil {
+		return cloneNode(override)
+	}
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return cloneNode(override)
+	}
+	merged := cloneNode(base)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		if j := mappingIndex(merged, key.Value); j >= 0 {
+			merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+			continue
+		}
+		merged.Content = append(merged.Content, cloneNode(key), cloneNode(value))
+	}
+	return merged
+}
+
+// mappingIndex returns the index of key in a mapping node, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func cloneNode(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yaml.AliasNode {
+		return cloneNode(n.Alias)
+	}
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = cloneNode(child)
+	}
+	return &c
+}
+
+// withoutBaseRefs drops extends and include from a base config, which only
+// apply to the file that names them
+func withoutBaseRefs(node *yaml.Node) *yaml.Node {
+	c := cloneNode(node)
+	c.Content = c.Content[:0]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i].Value; key == "extends" || key == "include" {
+			continue
+		}
+		c.Content = append(c.Content, cloneNode(node.Content[i]), cloneNode(node.Content[i+1]))
+	}
+	return c
+}
+
+// overridesOf returns the parts of c that differ from its bases, so saving
+// a config that extends another keeps only its own settings
+func (c *Config) overridesOf(base *Config) (*yaml.Node, error) {
+	var own, inherited yaml.Node
+	if err := own.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := inherited.Encode(base); err != nil {
+		return nil, err
+	}
+	return diffNodes(&own, &inherited), nil
+}
+
+// diffNodes returns the entries of a mapping node that are missing from or
+// different in base
+func diffNodes(node, base *yaml.Node) *yaml.Node {
+	diff := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		j := mappingIndex(base, key.Value)
+		if j < 0 {
+			diff.Content = append(diff.Content, key, value)
+			continue
+		}
+		baseValue := base.Content[j+1]
+		if value.Kind == yaml.MappingNode && baseValue.Kind == yaml.MappingNode {
+			if sub := diffNodes(value, baseValue); len(sub.Content) > 0 {
+				diff.Content = append(diff.Content, key, sub)
+			}
+			continue
+		}
+		if !nodesEqual(value, baseValue) {
+			diff.Content = append(diff.Content, key, value)
+		}
+	}
+	return diff
+}
+
+func nodesEqual(a, b *yaml.Node) bool {
+	da, errA := yaml.Marshal(a)
+	db, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
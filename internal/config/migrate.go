@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LegacyFile is the config file of finctl, whose format galena.yaml grew
+// out of
+const LegacyFile = "finctl.yaml"
+
+// legacyDefaults maps finctl default values to their galena counterparts
+var legacyDefaults = map[string][2]string{
+	"name": {"finctl", "galena"},
+}
+
+// Migration is the result of converting a finctl.yaml
+type Migration struct {
+	Data    []byte   // The galena.yaml
+	Renamed []string // Defaults replaced, e.g. name: finctl -> galena
+	Dropped []string // Keys galena does not know, with their positions
+}
+
+// MigrateLegacy converts a finctl.yaml to galena.yaml: finctl defaults
+// are renamed and keys galena does not know are dropped. Comments and the
+// order of keys are kept.
+func MigrateLegacy(path string) (*Migration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+
+	m := &Migration{}
+	root := doc.Content[0]
+	for key, rename := range legacyDefaults {
+		if i := mappingIndex(root, key); i >= 0 && root.Content[i+1].Value == rename[0] {
+			root.Content[i+1].Value = rename[1]
+			m.Renamed = append(m.Renamed, fmt.Sprintf("%s: %s -> %s", key, rename[0], rename[1]))
+		}
+	}
+	m.Dropped = pruneUnknown(root, reflect.TypeFor[Config](), "")
+
+	if m.Data, err = encodeNode(&doc); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteMigration writes a converted config to path after validating it
+func WriteMigration(path string, m *Migration) error {
+	return writeValidated(path, m.Data)
+}
+
+// pruneUnknown removes the keys of mappings that t has no field for and
+// returns them as "line:column: path"
+func pruneUnknown(n *yaml.Node, t reflect.Type, path string) []string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var dropped []string
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		kept := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				dropped = append(dropped, fmt.Sprintf("%d:%d: %s", key.Line, key.Column, joinPath(path, key.Value)))
+				continue
+			}
+			dropped = append(dropped, pruneUnknown(value, field.Type, joinPath(path, key.Value))...)
+			kept = append(kept, key, value)
+		}
+		n.Content = kept
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			dropped = append(dropped, pruneUnknown(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			dropped = append(dropped, pruneUnknown(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value))...)
+		}
+	}
+	return dropped
+}
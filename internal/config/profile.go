@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsProfile is a shareable bundle of UI preferences, build defaults,
+// and release channels
+type SettingsProfile struct {
+	Name       string          `yaml:"name,omitempty"`
+	ExportedAt string          `yaml:"exported_at,omitempty"`
+	UI         UIConfig        `yaml:"ui"`
+	Build      ProfileSettings `yaml:"build"`
+	Channels   []Channel       `yaml:"channels,omitempty"`
+
+	// data is the profile file as loaded, so applying it sets only the
+	// settings it names
+	data []byte
+}
+
+// ProfileSettings holds the build settings carried by a profile
+type ProfileSettings struct {
+	BuildArgs   map[string]string `yaml:"build_args"`
+	Timeout     string            `yaml:"timeout"`
+	DirtyPolicy string            `yaml:"dirty_policy"`
+	Defaults    BuildDefaults     `yaml:"defaults"`
+}
+
+// ProfileChange describes a single setting changed by importing a profile
+type ProfileChange struct {
+	Key  string
+	From string
+	To   string
+}
+
+// ExportProfile captures the shareable settings of the configuration
+func (c *Config) ExportProfile(name string) *SettingsProfile {
+	buildArgs := make(map[string]string, len(c.Build.BuildArgs))
+	for k, v := range c.Build.BuildArgs {
+		buildArgs[k] = v
+	}
+	return &SettingsProfile{
+		Name:       name,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		UI:         c.UI,
+		Build: ProfileSettings{
+			BuildArgs:   buildArgs,
+			Timeout:     c.Build.Timeout,
+			DirtyPolicy: c.Build.DirtyPolicy,
+			Defaults:    c.Build.Defaults,
+		},
+		Channels: slices.Clone(c.Channels),
+	}
+}
+
+// ApplyProfile merges the profile into the configuration. Only the settings
+// the profile sets change, build args are merged by name, and channels
+// replace the channel of the same name or are added.
+func (c *Config) ApplyProfile(p *SettingsProfile) error {
+	merged, err := c.mergeProfile(p)
+	if err != nil {
+		return err
+	}
+	c.UI = merged.UI
+	c.Build.BuildArgs = merged.Build.BuildArgs
+	c.Build.Timeout = merged.Build.Timeout
+	c.Build.DirtyPolicy = merged.Build.DirtyPolicy
+	c.Build.Defaults = merged.Build.Defaults
+	c.Channels = merged.Channels
+	return nil
+}
+
+// PreviewProfile lists the settings that ApplyProfile would change
+func (c *Config) PreviewProfile(p *SettingsProfile) ([]ProfileChange, error) {
+	current, err := flattenSettings(c.ExportProfile(""))
+	if err != nil {
+		return nil, err
+	}
+	merged, err := c.mergeProfile(p)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err := flattenSettings(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]struct{}{}
+	for k := range current {
+		keys[k] = struct{}{}
+	}
+	for k := range incoming {
+		keys[k] = struct{}{}
+	}
+
+	changes := []ProfileChange{}
+	for k := range keys {
+		if current[k] != incoming[k] {
+			changes = append(changes, ProfileChange{Key: k, From: current[k], To: incoming[k]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes, nil
+}
+
+// mergeProfile lays the settings a profile sets over the shareable
+// settings of the configuration. Decoding the profile onto the current
+// settings leaves every key the profile omits untouched.
+func (c *Config) mergeProfile(p *SettingsProfile) (*SettingsProfile, error) {
+	data := p.data
+	if data == nil {
+		var err error
+		if data, err = yaml.Marshal(p); err != nil {
+			return nil, fmt.Errorf("marshaling profile: %w", err)
+		}
+	}
+
+	merged := c.ExportProfile(p.Name)
+	channels := merged.Channels
+	if err := yaml.Unmarshal(data, merged); err != nil {
+		return nil, fmt.Errorf("parsing profile: %w", err)
+	}
+
+	merged.Channels = channels
+	for _, ch := range p.Channels {
+		if i := slices.IndexFunc(merged.Channels, func(existing Channel) bool { return existing.Name == ch.Name }); i >= 0 {
+			merged.Channels[i] = ch
+		} else {
+			merged.Channels = append(merged.Channels, ch)
+		}
+	}
+	return merged, nil
+}
+
+// flattenSettings turns the settings of a profile into dotted key/value pairs
+func flattenSettings(p *SettingsProfile) (map[string]string, error) {
+	// Channels are keyed by name so a changed channel shows as one setting
+	channels := make(map[string]Channel, len(p.Channels))
+	for _, ch := range p.Channels {
+		channels[ch.Name] = ch
+	}
+	data, err := yaml.Marshal(struct {
+		UI       UIConfig           `yaml:"ui"`
+		Build    ProfileSettings    `yaml:"build"`
+		Channels map[string]Channel `yaml:"channels,omitempty"`
+	}{p.UI, p.Build, channels})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling profile: %w", err)
+	}
+
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("parsing profile: %w", err)
+	}
+
+	flat := map[string]string{}
+	flattenInto(flat, "", tree)
+	return flat, nil
+}
+
+func flattenInto(flat map[string]string, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenInto(flat, key, child)
+		}
+	case nil:
+		flat[prefix] = ""
+	default:
+		flat[prefix] = fmt.Sprintf("%v", v)
+	}
+}
+
+// LoadProfile loads a settings profile from a file
+func LoadProfile(path string) (*SettingsProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %w", err)
+	}
+
+	p := &SettingsProfile{data: data}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parsing profile: %w", err)
+	}
+	for _, ch := range p.Channels {
+		if ch.Name == "" {
+			return nil, fmt.Errorf("parsing profile: every channel needs a name")
+		}
+	}
+
+	return p, nil
+}
+
+// Save saves the profile to a file
+func (p *SettingsProfile) Save(path string) error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("marshaling profile: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating profile directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing profile: %w", err)
+	}
+
+	return nil
+}
+
+// SaveWithComment saves the configuration with a leading comment block
+func (c *Config) SaveWithComment(path string, comment string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("marshaling config: %w", err)
+	}
+
+	var header strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(comment), "\n") {
+		header.WriteString("# " + line + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, append([]byte(header.String()), data...), 0o644); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,401 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaID is the $id of the galena.yaml JSON Schema
+const SchemaID = "https://github.com/iiroan/galena/galena.schema.json"
+
+// digestPattern matches OCI content digests such as sha256:<hex>
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+
+// durationPattern matches Go durations such as 90s or 1h30m, for editors
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// ValidDigest reports whether s is an OCI content digest
+func ValidDigest(s string) bool {
+	return digestPattern.MatchString(s)
+}
+
+// VersionSchemes returns the supported version.scheme values
+func VersionSchemes() []string {
+	return []string{"fedora.date.build", "date.build", "semver"}
+}
+
+// Value formats of string fields
+const (
+	formatDuration = "duration"
+	formatDigest   = "digest"
+)
+
+// fieldRule constrains the value of a field beyond its type. Rules are
+// keyed by path, with [] for list items and * for map values.
+type fieldRule struct {
+	enum     []string
+	foldCase bool // enum matches case-insensitively
+	format   string
+	min, max *int
+}
+
+func bound(n int) *int {
+	return &n
+}
+
+var fieldRules = map[string]fieldRule{
+	"retry.attempts":              {min: bound(0)},
+	"retry.delay":                 {format: formatDuration},
+	"retry.max_delay":             {format: formatDuration},
+	"registries[].retries":        {min: bound(0)},
+	"build.base_image_digest":     {format: formatDigest},
+	"build.timeout":               {format: formatDuration},
+	"build.dirty_policy":          {enum: DirtyPolicies()},
+	"build.engine":                {enum: ContainerEngines()},
+	"build.healthcheck.timeout":   {format: formatDuration},
+	"build.defaults.build_number": {min: bound(0)},
+	"clean.policy.keep_last":      {min: bound(0)},
+	"clean.policy.max_age":        {format: formatDuration},
+	"signing.checksums":           {enum: ChecksumSigners()},
+	"scan.severity[]":             {enum: Severities(), foldCase: true},
+	"scan.fail_on":                {enum: Severities(), foldCase: true},
+	"vm.tests.boot_timeout":       {format: formatDuration},
+	"vm.tests.builtin[]":          {enum: VMTestBuiltins()},
+	"version.scheme":              {enum: VersionSchemes()},
+	"fleet.slots":                 {min: bound(0)},
+	"fleet.waves[].percent":       {min: bound(1), max: bound(100)},
+	"fleet.waves[].delay":         {format: formatDuration},
+	"dependencies.*.digest":       {format: formatDigest},
+	"audit.max_output":            {min: bound(0)},
+	"logs.keep":                   {min: bound(0)},
+	"notifications[].type":        {enum: NotificationTypes()},
+	"notifications[].events[]":    {enum: NotificationEvents()},
+}
+
+// FieldError is a problem at a position of a config file
+type FieldError struct {
+	Path    string // Dotted path, e.g. registries[0].retries; empty for cross-field rules
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// ValidationError lists every problem found in a config file
+type ValidationError struct {
+	File   string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		lines[i] = e.File + ": " + fe.Error()
+		if fe.Line > 0 {
+			lines[i] = e.File + ":" + fe.Error()
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateFile checks a config file against the galena.yaml schema and the
+// rules of Validate. Every problem is reported, with the line and column of
+// the offending key or value where the schema can place it. Cross-field
+// rules see the config with its bases merged in.
+func ValidateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	v := &schemaValidator{}
+	if len(doc.Content) > 0 {
+		v.walk(doc.Content[0], reflect.TypeFor[Config](), "", "")
+	}
+
+	// Cross-field rules only run on a config that decodes cleanly
+	if len(v.errors) == 0 {
+		cfg, err := loadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			v.errors = append(v.errors, FieldError{Message: err.Error()})
+		}
+	}
+
+	if len(v.errors) > 0 {
+		return &ValidationError{File: path, Errors: v.errors}
+	}
+	return nil
+}
+
+type schemaValidator struct {
+	errors []FieldError
+}
+
+func (v *schemaValidator) add(n *yaml.Node, path, format string, args ...any) {
+	if path == "" {
+		path = "(root)"
+	}
+	v.errors = append(v.errors, FieldError{Path: path, Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// walk checks node against type t. path is the dotted path shown to the
+// user, rule the path the field rules are keyed by.
+func (v *schemaValidator) walk(n *yaml.Node, t reflect.Type, path, rule string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			v.add(n, path, "must be a mapping, got %s", nodeKind(n))
+			return
+		}
+		fields := yamlFields(t)
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+			keyPath := joinPath(path, key.Value)
+			if seen[key.Value] {
+				v.add(key, keyPath, "duplicate key")
+			}
+			seen[key.Value] = true
+			field, ok := fields[key.Value]
+			if !ok {
+				v.add(key, keyPath, "unknown key%s", suggestKey(key.Value, fields))
+				continue
+			}
+			v.walk(value, field.Type, keyPath, joinPath(rule, key.Value))
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			v.add(n, path, "must be a list, got %s", nodeKind(n))
+			return
+		}
+		for i, item := range n.Content {
+			v.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), rule+"[]")
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			v.add(n, path, "must be a mapping, got %s", nodeKind(n))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.walk(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value), joinPath(rule, "*"))
+		}
+	case reflect.String:
+		if n.Kind != yaml.ScalarNode {
+			v.add(n, path, "must be a string, got %s", nodeKind(n))
+			return
+		}
+		v.checkString(n, path, fieldRules[rule])
+	case reflect.Int:
+		value, err := strconv.Atoi(n.Value)
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!int" || err != nil {
+			v.add(n, path, "must be an integer, got %s", nodeKind(n))
+			return
+		}
+		r := fieldRules[rule]
+		if r.min != nil && value < *r.min {
+			v.add(n, path, "must be at least %d", *r.min)
+		}
+		if r.max != nil && value > *r.max {
+			v.add(n, path, "must be at most %d", *r.max)
+		}
+	case reflect.Bool:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" {
+			v.add(n, path, "must be true or false, got %s", nodeKind(n))
+		}
+	}
+}
+
+func (v *schemaValidator) checkString(n *yaml.Node, path string, r fieldRule) {
+	if n.Value == "" {
+		return
+	}
+	if len(r.enum) > 0 {
+		match := slices.Contains(r.enum, n.Value)
+		if r.foldCase {
+			match = slices.ContainsFunc(r.enum, func(e string) bool { return strings.EqualFold(e, n.Value) })
+		}
+		if !match {
+			v.add(n, path, "%q is not one of %s", n.Value, strings.Join(r.enum, ", "))
+		}
+	}
+	switch r.format {
+	case formatDuration:
+		if _, err := time.ParseDuration(n.Value); err != nil {
+			v.add(n, path, "%q is not a duration (e.g. 90s, 30m, 1h30m)", n.Value)
+		}
+	case formatDigest:
+		if !ValidDigest(n.Value) {
+			v.add(n, path, "%q is not a digest (expected sha256:<hex>)", n.Value)
+		}
+	}
+}
+
+// yamlFields maps the yaml keys of a struct to its fields
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// suggestKey names a known key the unknown key is probably a typo of
+func suggestKey(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDistance || (d == bestDistance && best != "" && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func nodeKind(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return fmt.Sprintf("%q", n.Value)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// JSONSchema describes galena.yaml as a JSON Schema (draft 2020-12) for
+// editors such as VS Code with the YAML extension
+func JSONSchema() map[string]any {
+	schema := typeSchema(reflect.TypeFor[Config](), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = SchemaID
+	schema["title"] = "galena.yaml"
+	schema["description"] = "Project configuration of galena-build"
+	schema["required"] = []string{"name"}
+	return schema
+}
+
+func typeSchema(t reflect.Type, rule string) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	r := fieldRules[rule]
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]any{}
+		for name, field := range yamlFields(t) {
+			properties[name] = typeSchema(field.Type, joinPath(rule, name))
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Slice:
+		return map[string]any{"type": []string{"array", "null"}, "items": typeSchema(t.Elem(), rule+"[]")}
+	case reflect.Map:
+		return map[string]any{"type": []string{"object", "null"}, "additionalProperties": typeSchema(t.Elem(), joinPath(rule, "*"))}
+	case reflect.Int:
+		s := map[string]any{"type": "integer"}
+		if r.min != nil {
+			s["minimum"] = *r.min
+		}
+		if r.max != nil {
+			s["maximum"] = *r.max
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	}
+
+	s := map[string]any{"type": "string"}
+	if len(r.enum) > 0 {
+		values := append([]string{""}, r.enum...)
+		if r.foldCase {
+			for _, e := range r.enum {
+				values = append(values, strings.ToLower(e))
+			}
+		}
+		s["enum"] = values
+	}
+	switch r.format {
+	case formatDuration:
+		s["pattern"] = `^$|` + durationPattern
+	case formatDigest:
+		s["pattern"] = `^$|` + digestPattern.String()
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AddVariant appends a variant to a config file. Only the fields that are
+// set are written, so the file stays as short as a hand-written one.
+func AddVariant(path string, v Variant) error {
+	var entry yaml.Node
+	if err := entry.Encode(v); err != nil {
+		return err
+	}
+	pruneEmpty(&entry)
+	return editFile(path, "variants", func(parent *yaml.Node, segment string) error {
+		list, err := listValue(parent, segment)
+		if err != nil {
+			return err
+		}
+		if nodeListIndex(list, v.Name) >= 0 {
+			return fmt.Errorf("variant %s already exists in %s", v.Name, filepath.Base(path))
+		}
+		list.Content = append(list.Content, &entry)
+		return nil
+	})
+}
+
+// RemoveVariant removes a variant from a config file
+func RemoveVariant(path, name string) error {
+	return editFile(path, "variants", func(parent *yaml.Node, segment string) error {
+		j := mappingIndex(parent, segment)
+		if j < 0 || parent.Content[j+1].Kind != yaml.SequenceNode {
+			return fmt.Errorf("no variant %s in %s", name, filepath.Base(path))
+		}
+		list := parent.Content[j+1]
+		i := nodeListIndex(list, name)
+		if i < 0 {
+			return fmt.Errorf("no variant %s in %s", name, filepath.Base(path))
+		}
+		list.Content = append(list.Content[:i], list.Content[i+1:]...)
+		return nil
+	})
+}
+
+// pruneEmpty drops the keys of a mapping whose values are empty strings,
+// lists, or mappings
+func pruneEmpty(n *yaml.Node) {
+	content := n.Content[:0]
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		value := n.Content[i+1]
+		switch {
+		case value.Kind == yaml.ScalarNode && (value.Value == "" || value.Tag == "!!null"):
+			continue
+		case (value.Kind == yaml.SequenceNode || value.Kind == yaml.MappingNode) && len(value.Content) == 0:
+			continue
+		}
+		content = append(content, n.Content[i], value)
+	}
+	n.Content = content
+}
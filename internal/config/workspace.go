@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkspaceFile is the monorepo manifest listing independent image projects
+const WorkspaceFile = "galena-workspace.yaml"
+
+// Workspace maps subdirectories of a monorepo to independent image projects
+type Workspace struct {
+	Projects []WorkspaceProject `yaml:"projects"`
+
+	root string
+}
+
+// WorkspaceProject is one image project inside a workspace
+type WorkspaceProject struct {
+	Name   string `yaml:"name"`
+	Path   string `yaml:"path"`   // Relative to the workspace root
+	Config string `yaml:"config"` // Relative to Path (default: galena.yaml)
+}
+
+// FindWorkspace walks up from dir looking for galena-workspace.yaml.
+// It returns nil without an error when no workspace is found.
+func FindWorkspace(dir string) (*Workspace, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		path := filepath.Join(dir, WorkspaceFile)
+		if _, err := os.Stat(path); err == nil {
+			return LoadWorkspace(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadWorkspace loads and validates a workspace file
+func LoadWorkspace(path string) (*Workspace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading workspace: %w", err)
+	}
+
+	ws := &Workspace{}
+	if err := yaml.Unmarshal(data, ws); err != nil {
+		return nil, fmt.Errorf("parsing workspace: %w", err)
+	}
+	ws.root = filepath.Dir(path)
+
+	if err := ws.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid workspace %s: %w", path, err)
+	}
+	return ws, nil
+}
+
+// Validate checks that project names are unique and paths stay inside the workspace
+func (w *Workspace) Validate() error {
+	seen := map[string]bool{}
+	for _, p := range w.Projects {
+		if p.Name == "" {
+			return fmt.Errorf("project with path %q has no name", p.Path)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate project name %q", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Path == "" || filepath.IsAbs(p.Path) || strings.HasPrefix(filepath.Clean(p.Path), "..") {
+			return fmt.Errorf("project %q: path must be relative to the workspace root", p.Name)
+		}
+	}
+	return nil
+}
+
+// Root returns the workspace root directory
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// ProjectNames lists the configured project names
+func (w *Workspace) ProjectNames() []string {
+	names := make([]string, len(w.Projects))
+	for i, p := range w.Projects {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Project returns a project by name
+func (w *Workspace) Project(name string) (*WorkspaceProject, error) {
+	for i := range w.Projects {
+		if w.Projects[i].Name == name {
+			return &w.Projects[i], nil
+		}
+	}
+	return nil, fmt.Errorf("project %q not found in %s (available: %s)",
+		name, filepath.Join(w.root, WorkspaceFile), strings.Join(w.ProjectNames(), ", "))
+}
+
+// ProjectForDir returns the project containing dir, preferring the most
+// specific path when projects are nested, or nil if dir is in none of them
+func (w *Workspace) ProjectForDir(dir string) *WorkspaceProject {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+
+	var best *WorkspaceProject
+	bestLen := -1
+	for i := range w.Projects {
+		projectDir := w.ProjectDir(&w.Projects[i])
+		rel, err := filepath.Rel(projectDir, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(projectDir) > bestLen {
+			best = &w.Projects[i]
+			bestLen = len(projectDir)
+		}
+	}
+	return best
+}
+
+// ProjectDir returns the absolute directory of a project
+func (w *Workspace) ProjectDir(p *WorkspaceProject) string {
+	return filepath.Join(w.root, p.Path)
+}
+
+// ConfigPath returns the absolute config file path of a project
+func (w *Workspace) ConfigPath(p *WorkspaceProject) string {
+	name := p.Config
+	if name == "" {
+		name = "galena.yaml"
+	}
+	return filepath.Join(w.ProjectDir(p), name)
+}
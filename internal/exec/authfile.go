@@ -0,0 +1,53 @@
+package exec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iiroan/galena/internal/ref"
+)
+
+// AuthFile writes registry credentials, keyed by registry host and given as
+// user:password, to a temporary auth file only the current user can read.
+// Tools get the file with --authfile (or DOCKER_CONFIG, its directory)
+// instead of the credentials on their command line, where any local user
+// could read them. The file is named config.json so it also serves as a
+// docker config; the returned function removes it.
+func AuthFile(auths map[string]string) (string, func(), error) {
+	entries := map[string]map[string]string{}
+	for registry, creds := range auths {
+		if _, password, ok := strings.Cut(creds, ":"); ok {
+			RegisterSecret(password)
+		}
+		entries[registry] = map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte(creds))}
+	}
+	data, err := json.Marshal(map[string]any{"auths": entries})
+	if err != nil {
+		return "", nil, fmt.Errorf("marshaling auth file: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "galena-auth-")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating auth file: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("writing auth file: %w", err)
+	}
+	return path, cleanup, nil
+}
+
+// registryHost returns the registry an image reference points to
+func registryHost(image string) string {
+	r, err := ref.Parse(image)
+	if err != nil || r.Registry == "" {
+		return "docker.io"
+	}
+	return r.Registry
+}
@@ -0,0 +1,147 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	dryRun    atomic.Bool
+	dryRunOut io.Writer = os.Stderr
+)
+
+// SetDryRun switches dry-run mode: commands that change state are printed
+// instead of run and succeed with empty output, while read-only queries
+// (git rev-parse, podman inspect, skopeo inspect, ...) still run so the
+// printed commands match what a real run would execute
+func SetDryRun(on bool) {
+	dryRun.Store(on)
+}
+
+// DryRun reports whether dry-run mode is on
+func DryRun() bool {
+	return dryRun.Load()
+}
+
+// PrintDryRun prints a command skipped in dry-run mode
+func PrintDryRun(name string, args []string) {
+	fmt.Fprintf(dryRunOut, "[dry-run] %s\n", FormatCommand(name, args))
+}
+
+// PrintDryRunAction prints a file system change skipped in dry-run mode,
+// e.g. "remove output/"
+func PrintDryRunAction(format string, a ...any) {
+	fmt.Fprintf(dryRunOut, "[dry-run] "+format+"\n", a...)
+}
+
+// skipForDryRun prints and skips a command that would change state; it
+// returns nil when the command should run
+func skipForDryRun(name string, args []string) *Result {
+	if !dryRun.Load() || readOnlyCommand(name, args) {
+		return nil
+	}
+	PrintDryRun(name, args)
+	return &Result{Command: name, Args: args, Attempts: 1}
+}
+
+// readOnlySubcommands lists the subcommands of each tool that only query
+// state. A nil list marks tools that never change anything.
+var readOnlySubcommands = map[string][]string{
+	"git":           {"rev-parse", "status", "describe", "log", "diff", "show", "ls-files", "ls-remote", "remote get-url", "cat-file", "rev-list"},
+	"podman":        {"images", "image exists", "image inspect", "image ls", "image list", "image tree", "inspect", "info", "version", "ps", "container exists", "manifest exists", "manifest inspect", "history", "system df", "volume ls", "machine list", "machine inspect", "search"},
+	"docker":        {"images", "image inspect", "image ls", "inspect", "info", "version", "ps", "history", "manifest inspect", "system df", "buildx ls", "buildx inspect"},
+	"buildah":       {"images", "inspect", "info", "version", "containers"},
+	"skopeo":        {"inspect", "list-tags"},
+	"cosign":        {"verify", "verify-attestation", "verify-blob", "tree", "triangulate", "download", "version", "public-key"},
+	"rpm-ostree":    {"status", "db"},
+	"bootc":         {"status"},
+	"flatpak":       {"list", "info", "remotes", "search", "remote-ls"},
+	"brew":          {"list", "info", "search", "outdated", "--prefix", "--version"},
+	"systemctl":     {"is-active", "is-enabled", "is-failed", "status", "show", "list-units", "list-unit-files", "cat"},
+	"just":          {"--list", "--summary", "--show", "--dump", "--evaluate"},
+	"gh":            {"auth status"},
+	"rpm":           {"-q", "-qa", "-qf", "-qi", "-ql", "--query", "-V", "--verify", "--eval"},
+	"which":         nil,
+	"uname":         nil,
+	"id":            nil,
+	"df":            nil,
+	"du":            nil,
+	"lsblk":         nil,
+	"findmnt":       nil,
+	"sha256sum":     nil,
+	"sha512sum":     nil,
+	"hostname":      nil,
+	"nproc":         nil,
+	"hadolint":      nil,
+	"shellcheck":    nil,
+	"yamllint":      nil,
+	"golangci-lint": {"run", "version"},
+}
+
+// privilegeTools run the command after them as another user
+var privilegeTools = []string{"sudo", "pkexec", "run0", "doas"}
+
+// readOnlyCommand reports whether a command only queries state and is safe
+// to run in dry-run mode
+func readOnlyCommand(name string, args []string) bool {
+	name = filepath.Base(name)
+	if slices.Contains(privilegeTools, name) {
+		// sudo -v only refreshes credentials; sudo CMD runs CMD
+		for i, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				return readOnlyCommand(arg, args[i+1:])
+			}
+		}
+		return false
+	}
+
+	subcommands, known := readOnlySubcommands[name]
+	if !known {
+		return false
+	}
+	if subcommands == nil {
+		return true
+	}
+	// Skip global flags such as podman --remote or git -C dir
+	words := make([]string, 0, 2)
+	for i := 0; i < len(args) && len(words) < 2; i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") && len(words) == 0 {
+			if slices.Contains(subcommands, arg) {
+				return true
+			}
+			if (name == "git" && (arg == "-C" || arg == "-c")) || (name != "git" && !strings.Contains(arg, "=") && i+1 < len(args) && takesValue(arg)) {
+				i++
+			}
+			continue
+		}
+		words = append(words, arg)
+	}
+	if name == "podman" && len(words) > 0 && words[0] == "unshare" {
+		unshareArgs := args[slices.Index(args, "unshare")+1:]
+		if len(unshareArgs) == 0 {
+			return false
+		}
+		return readOnlyCommand(unshareArgs[0], unshareArgs[1:])
+	}
+	for n := len(words); n > 0; n-- {
+		if slices.Contains(subcommands, strings.Join(words[:n], " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// takesValue reports whether a global engine flag is followed by a value
+func takesValue(flag string) bool {
+	switch flag {
+	case "--connection", "-c", "--url", "--root", "--runroot", "--storage-driver", "--log-level", "--host", "-H", "--context":
+		return true
+	}
+	return false
+}
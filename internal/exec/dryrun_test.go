@@ -0,0 +1,81 @@
+package exec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{name: "git", args: []string{"status", "--porcelain"}, want: true},
+		{name: "git", args: []string{"-C", "/src", "rev-parse", "HEAD"}, want: true},
+		{name: "git", args: []string{"-c", "core.pager=cat", "log", "-1"}, want: true},
+		{name: "git", args: []string{"remote", "get-url", "origin"}, want: true},
+		{name: "git", args: []string{"remote", "add", "origin", "x"}, want: false},
+		{name: "git", args: []string{"push", "origin"}, want: false},
+		{name: "/usr/bin/podman", args: []string{"image", "inspect", "galena"}, want: true},
+		{name: "podman", args: []string{"--connection", "build-host", "images"}, want: true},
+		{name: "podman", args: []string{"--log-level=debug", "push", "galena"}, want: false},
+		{name: "podman", args: []string{"image", "rm", "galena"}, want: false},
+		{name: "podman", args: []string{"unshare", "cat", "/etc/subuid"}, want: false},
+		{name: "podman", args: []string{"unshare", "skopeo", "inspect", "docker://x"}, want: true},
+		{name: "podman", args: []string{"unshare"}, want: false},
+		{name: "skopeo", args: []string{"copy", "docker://a", "docker://b"}, want: false},
+		{name: "cosign", args: []string{"verify", "--key", "cosign.pub", "img"}, want: true},
+		{name: "cosign", args: []string{"sign", "img"}, want: false},
+		{name: "brew", args: []string{"--prefix"}, want: true},
+		{name: "rpm", args: []string{"-qa"}, want: true},
+		{name: "rpm", args: []string{"-i", "pkg.rpm"}, want: false},
+		{name: "systemctl", args: []string{"is-active", "bootc-fetch-apply-updates.timer"}, want: true},
+		{name: "systemctl", args: []string{"enable", "--now", "x.timer"}, want: false},
+		{name: "uname", args: []string{"-m"}, want: true},
+		{name: "rm", args: []string{"-rf", "output"}, want: false},
+		{name: "sudo", args: []string{"-n", "bootc", "status"}, want: true},
+		{name: "sudo", args: []string{"bootc", "upgrade"}, want: false},
+		{name: "sudo", args: []string{"-v"}, want: false},
+		{name: "pkexec", args: []string{"flatpak", "list"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(FormatCommand(tt.name, tt.args), func(t *testing.T) {
+			if got := readOnlyCommand(tt.name, tt.args); got != tt.want {
+				t.Errorf("readOnlyCommand(%s) = %v, want %v", FormatCommand(tt.name, tt.args), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipForDryRun(t *testing.T) {
+	var out bytes.Buffer
+	previous := dryRunOut
+	dryRunOut = &out
+	SetDryRun(true)
+	t.Cleanup(func() {
+		SetDryRun(false)
+		dryRunOut = previous
+	})
+
+	if skipped := skipForDryRun("git", []string{"status"}); skipped != nil {
+		t.Errorf("read-only git status was skipped")
+	}
+	skipped := skipForDryRun("podman", []string{"push", "ghcr.io/iiroan/galena:stable"})
+	if skipped == nil || skipped.Err != nil || skipped.Attempts != 1 {
+		t.Fatalf("podman push was not skipped as a success: %+v", skipped)
+	}
+	if want := "[dry-run] podman push ghcr.io/iiroan/galena:stable\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	SetDryRun(false)
+	if skipped := skipForDryRun("podman", []string{"push", "x"}); skipped != nil {
+		t.Error("command skipped outside dry-run mode")
+	}
+	if strings.Count(out.String(), "[dry-run]") != 1 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
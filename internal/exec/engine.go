@@ -0,0 +1,442 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Engine is a container engine CLI used to build, inspect, run, and push images
+type Engine interface {
+	// Name returns the engine binary name
+	Name() string
+	// Command runs an arbitrary engine subcommand
+	Command(ctx context.Context, args ...string) *Result
+	// Build builds an image with streaming output
+	Build(ctx context.Context, dir string, args []string) *Result
+	// Push pushes an image to its registry. creds is user:password, or
+	// empty to use the engine's own login; docker always uses docker login.
+	Push(ctx context.Context, image, creds string) *Result
+	// RunImage runs a command in a throwaway container of image
+	RunImage(ctx context.Context, image string, command ...string) *Result
+	// ImageDigest returns the digest of a local image
+	ImageDigest(ctx context.Context, image string) (string, error)
+	// ImageLabels returns the labels of a local image
+	ImageLabels(ctx context.Context, image string) (map[string]string, error)
+	// ImageSize returns the size of a local image in bytes
+	ImageSize(ctx context.Context, image string) (int64, error)
+	// RemoveImage removes a local image
+	RemoveImage(ctx context.Context, image string) *Result
+	// ListImages lists local images as repository:tag matching a reference filter
+	ListImages(ctx context.Context, reference string) ([]string, error)
+	// ListImagesCreated lists local images matching a reference filter with their creation time
+	ListImagesCreated(ctx context.Context, reference string) ([]LocalImage, error)
+	// PruneDangling removes untagged images and their layers
+	PruneDangling(ctx context.Context) *Result
+	// SaveImage writes a local image to an archive (docker-archive or oci-archive)
+	SaveImage(ctx context.Context, image, path, format string) *Result
+	// LoadImage loads an image archive into local storage
+	LoadImage(ctx context.Context, path, format string) *Result
+	// ListBuildContainers lists the IDs of the working containers of image
+	// builds, leaving out containers started with run or create
+	ListBuildContainers(ctx context.Context) ([]string, error)
+	// RemoveContainers stops and removes containers
+	RemoveContainers(ctx context.Context, ids ...string) *Result
+	// SupportsManifestLists reports whether multi-arch manifest list builds are available
+	SupportsManifestLists() bool
+}
+
+// Engine names
+const (
+	EnginePodman  = "podman"
+	EngineBuildah = "buildah"
+	EngineDocker  = "docker"
+)
+
+// Engines returns the supported container engines
+func Engines() []string {
+	return []string{EnginePodman, EngineBuildah, EngineDocker}
+}
+
+// NewEngine returns the engine with the given name. An empty name selects podman.
+func NewEngine(name string) (Engine, error) {
+	switch name {
+	case "", EnginePodman:
+		return podmanEngine{}, nil
+	case EngineBuildah:
+		return buildahEngine{}, nil
+	case EngineDocker:
+		return dockerEngine{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported container engine %q (expected %s)", name, strings.Join(Engines(), ", "))
+	}
+}
+
+// Image archive formats accepted by SaveImage
+const (
+	ArchiveDocker = "docker-archive"
+	ArchiveOCI    = "oci-archive"
+)
+
+// LocalImage is a tagged image in local storage
+type LocalImage struct {
+	Name    string // repository:tag
+	Created time.Time
+}
+
+// createdLayout matches the creation times printed by podman, buildah, and docker
+const createdLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func parseImagesCreated(result *Result) ([]LocalImage, error) {
+	lines, err := parseLines(result)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]LocalImage, 0, len(lines))
+	for _, line := range lines {
+		name, created, ok := strings.Cut(line, "\t")
+		if !ok || strings.HasSuffix(name, ":<none>") {
+			continue
+		}
+		t, err := time.Parse(createdLayout, strings.TrimSpace(created))
+		if err != nil {
+			return nil, fmt.Errorf("parsing creation time of %s: %w", name, err)
+		}
+		images = append(images, LocalImage{Name: name, Created: t})
+	}
+	return images, nil
+}
+
+func parseLabels(result *Result) (map[string]string, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	labels := map[string]string{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(result.Stdout)), &labels); err != nil {
+		return nil, fmt.Errorf("parsing image labels: %w", err)
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return labels, nil
+}
+
+func buildOptions(dir string) Options {
+	opts := DefaultOptions()
+	opts.Dir = dir
+	opts.StreamStdio = true
+	opts.Timeout = 60 * time.Minute
+	return opts
+}
+
+func streamingOptions() Options {
+	opts := DefaultOptions()
+	opts.StreamStdio = true
+	return opts
+}
+
+func parseSize(result *Result) (int64, error) {
+	if result.Err != nil {
+		return 0, result.Err
+	}
+	return strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+}
+
+func parseLines(result *Result) ([]string, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	images := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		if line != "" {
+			images = append(images, line)
+		}
+	}
+	return images, nil
+}
+
+type podmanEngine struct{}
+
+func (podmanEngine) Name() string { return EnginePodman }
+
+func (podmanEngine) Command(ctx context.Context, args ...string) *Result {
+	return Podman(ctx, args...)
+}
+
+func (podmanEngine) Build(ctx context.Context, dir string, args []string) *Result {
+	return PodmanBuild(ctx, dir, args)
+}
+
+func (podmanEngine) Push(ctx context.Context, image, creds string) *Result {
+	return PodmanPush(ctx, image, creds)
+}
+
+func (podmanEngine) RunImage(ctx context.Context, image string, command ...string) *Result {
+	return Podman(ctx, append([]string{"run", "--rm", image}, command...)...)
+}
+
+func (podmanEngine) ImageDigest(ctx context.Context, image string) (string, error) {
+	result := Podman(ctx, "inspect", "--format", "{{.Digest}}", image)
+	if result.Err != nil {
+		return "", result.Err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+func (podmanEngine) ImageLabels(ctx context.Context, image string) (map[string]string, error) {
+	return parseLabels(Podman(ctx, "image", "inspect", "--format", "{{json .Labels}}", image))
+}
+
+func (podmanEngine) ImageSize(ctx context.Context, image string) (int64, error) {
+	return parseSize(Podman(ctx, "image", "inspect", "--format", "{{.Size}}", image))
+}
+
+func (podmanEngine) RemoveImage(ctx context.Context, image string) *Result {
+	return Podman(ctx, "rmi", "-f", image)
+}
+
+func (podmanEngine) ListImages(ctx context.Context, reference string) ([]string, error) {
+	return parseLines(Podman(ctx, "images", "--filter", "reference="+reference, "--format", "{{.Repository}}:{{.Tag}}"))
+}
+
+func (podmanEngine) ListImagesCreated(ctx context.Context, reference string) ([]LocalImage, error) {
+	return parseImagesCreated(Podman(ctx, "images", "--filter", "reference="+reference, "--format", "{{.Repository}}:{{.Tag}}\t{{.CreatedAt}}"))
+}
+
+func (podmanEngine) PruneDangling(ctx context.Context) *Result {
+	return Podman(ctx, "image", "prune", "-f")
+}
+
+func (podmanEngine) SaveImage(ctx context.Context, image, path, format string) *Result {
+	return Podman(ctx, "save", "--format", format, "-o", path, image)
+}
+
+func (podmanEngine) LoadImage(ctx context.Context, path, format string) *Result {
+	return Podman(ctx, "load", "-i", path)
+}
+
+// ListBuildContainers returns the external containers in storage, which are
+// the buildah working containers of podman build
+func (podmanEngine) ListBuildContainers(ctx context.Context) ([]string, error) {
+	all, err := parseLines(Podman(ctx, "ps", "--all", "--external", "--quiet", "--no-trunc"))
+	if err != nil {
+		return nil, err
+	}
+	managed, err := parseLines(Podman(ctx, "ps", "--all", "--quiet", "--no-trunc"))
+	if err != nil {
+		return nil, err
+	}
+	skip := map[string]bool{}
+	for _, id := range managed {
+		skip[id] = true
+	}
+	ids := []string{}
+	for _, id := range all {
+		if !skip[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (podmanEngine) RemoveContainers(ctx context.Context, ids ...string) *Result {
+	return Podman(ctx, append([]string{"rm", "--force"}, ids...)...)
+}
+
+func (podmanEngine) SupportsManifestLists() bool { return true }
+
+type buildahEngine struct{}
+
+func (buildahEngine) Name() string { return EngineBuildah }
+
+func (buildahEngine) Command(ctx context.Context, args ...string) *Result {
+	return RunSimple(ctx, "buildah", args...)
+}
+
+func (buildahEngine) Build(ctx context.Context, dir string, args []string) *Result {
+	return Run(ctx, "buildah", append([]string{"build"}, args...), buildOptions(dir))
+}
+
+func (buildahEngine) Push(ctx context.Context, image, creds string) *Result {
+	auth, cleanup, err := credsArgs(image, creds)
+	if err != nil {
+		return &Result{Command: "buildah", Err: err}
+	}
+	defer cleanup()
+	return RunRetry(ctx, "buildah", append(append([]string{"push"}, auth...), image), streamingOptions())
+}
+
+// RunImage uses a working container because buildah has no one-shot run
+func (e buildahEngine) RunImage(ctx context.Context, image string, command ...string) *Result {
+	from := e.Command(ctx, "from", "--pull-never", image)
+	if from.Err != nil {
+		return from
+	}
+	container := strings.TrimSpace(from.Stdout)
+	defer e.Command(context.Background(), "rm", container)
+
+	return e.Command(ctx, append([]string{"run", container, "--"}, command...)...)
+}
+
+func (e buildahEngine) ImageDigest(ctx context.Context, image string) (string, error) {
+	result := e.Command(ctx, "inspect", "--type", "image", "--format", "{{.FromImageDigest}}", image)
+	if result.Err != nil {
+		return "", result.Err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+func (e buildahEngine) ImageLabels(ctx context.Context, image string) (map[string]string, error) {
+	return parseLabels(e.Command(ctx, "inspect", "--type", "image", "--format", "{{json .OCIv1.Config.Labels}}", image))
+}
+
+// ImageSize adds up the config and layer sizes in the image manifest, since
+// buildah inspect reports no total. Layers of images built locally are
+// uncompressed, as podman counts them.
+func (e buildahEngine) ImageSize(ctx context.Context, image string) (int64, error) {
+	result := e.Command(ctx, "inspect", "--type", "image", "--format", "{{.Manifest}}", image)
+	if result.Err != nil {
+		return 0, result.Err
+	}
+	var manifest struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &manifest); err != nil {
+		return 0, fmt.Errorf("parsing manifest of %s: %w", image, err)
+	}
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return size, nil
+}
+
+func (e buildahEngine) RemoveImage(ctx context.Context, image string) *Result {
+	return e.Command(ctx, "rmi", "-f", image)
+}
+
+func (e buildahEngine) ListImages(ctx context.Context, reference string) ([]string, error) {
+	return parseLines(e.Command(ctx, "images", "--filter", "reference="+reference, "--format", "{{.Name}}:{{.Tag}}"))
+}
+
+func (e buildahEngine) ListImagesCreated(ctx context.Context, reference string) ([]LocalImage, error) {
+	return parseImagesCreated(e.Command(ctx, "images", "--filter", "reference="+reference, "--format", "{{.Name}}:{{.Tag}}\t{{.CreatedAtRaw}}"))
+}
+
+func (e buildahEngine) PruneDangling(ctx context.Context) *Result {
+	return e.Command(ctx, "rmi", "--prune")
+}
+
+func (e buildahEngine) SaveImage(ctx context.Context, image, path, format string) *Result {
+	return e.Command(ctx, "push", image, format+":"+path)
+}
+
+func (e buildahEngine) LoadImage(ctx context.Context, path, format string) *Result {
+	return e.Command(ctx, "pull", format+":"+path)
+}
+
+func (e buildahEngine) ListBuildContainers(ctx context.Context) ([]string, error) {
+	return parseLines(e.Command(ctx, "containers", "--quiet", "--notruncate"))
+}
+
+func (e buildahEngine) RemoveContainers(ctx context.Context, ids ...string) *Result {
+	return e.Command(ctx, append([]string{"rm"}, ids...)...)
+}
+
+func (buildahEngine) SupportsManifestLists() bool { return false }
+
+type dockerEngine struct{}
+
+func (dockerEngine) Name() string { return EngineDocker }
+
+func (dockerEngine) Command(ctx context.Context, args ...string) *Result {
+	return RunSimple(ctx, "docker", args...)
+}
+
+func (dockerEngine) Build(ctx context.Context, dir string, args []string) *Result {
+	return Run(ctx, "docker", append([]string{"build"}, args...), buildOptions(dir))
+}
+
+func (dockerEngine) Push(ctx context.Context, image, _ string) *Result {
+	return RunRetry(ctx, "docker", []string{"push", image}, streamingOptions())
+}
+
+func (e dockerEngine) RunImage(ctx context.Context, image string, command ...string) *Result {
+	return e.Command(ctx, append([]string{"run", "--rm", image}, command...)...)
+}
+
+// ImageDigest prefers the registry digest and falls back to the image ID,
+// since docker only records a digest once an image has been pushed or pulled
+func (e dockerEngine) ImageDigest(ctx context.Context, image string) (string, error) {
+	result := e.Command(ctx, "image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", image)
+	if result.Err != nil {
+		return "", result.Err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		if _, digest, ok := strings.Cut(line, "@"); ok {
+			return digest, nil
+		}
+	}
+
+	result = e.Command(ctx, "image", "inspect", "--format", "{{.Id}}", image)
+	if result.Err != nil {
+		return "", result.Err
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+func (e dockerEngine) ImageLabels(ctx context.Context, image string) (map[string]string, error) {
+	return parseLabels(e.Command(ctx, "image", "inspect", "--format", "{{json .Config.Labels}}", image))
+}
+
+func (e dockerEngine) ImageSize(ctx context.Context, image string) (int64, error) {
+	return parseSize(e.Command(ctx, "image", "inspect", "--format", "{{.Size}}", image))
+}
+
+func (e dockerEngine) RemoveImage(ctx context.Context, image string) *Result {
+	return e.Command(ctx, "rmi", "-f", image)
+}
+
+func (e dockerEngine) ListImages(ctx context.Context, reference string) ([]string, error) {
+	return parseLines(e.Command(ctx, "images", "--filter", "reference="+reference, "--format", "{{.Repository}}:{{.Tag}}"))
+}
+
+func (e dockerEngine) ListImagesCreated(ctx context.Context, reference string) ([]LocalImage, error) {
+	return parseImagesCreated(e.Command(ctx, "images", "--filter", "reference="+reference, "--format", "{{.Repository}}:{{.Tag}}\t{{.CreatedAt}}"))
+}
+
+func (e dockerEngine) PruneDangling(ctx context.Context) *Result {
+	return e.Command(ctx, "image", "prune", "-f")
+}
+
+// SaveImage only writes docker archives; docker has no format selection
+func (e dockerEngine) SaveImage(ctx context.Context, image, path, format string) *Result {
+	if format != ArchiveDocker {
+		return &Result{Command: "docker", Err: fmt.Errorf("docker cannot save %s archives", format)}
+	}
+	return e.Command(ctx, "save", "-o", path, image)
+}
+
+func (e dockerEngine) LoadImage(ctx context.Context, path, format string) *Result {
+	return e.Command(ctx, "load", "-i", path)
+}
+
+// ListBuildContainers returns nothing: BuildKit runs no containers the
+// engine lists, and the classic builder removes its own
+func (dockerEngine) ListBuildContainers(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (e dockerEngine) RemoveContainers(ctx context.Context, ids ...string) *Result {
+	return e.Command(ctx, append([]string{"rm", "--force"}, ids...)...)
+}
+
+func (dockerEngine) SupportsManifestLists() bool { return false }
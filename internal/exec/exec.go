@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -22,6 +23,7 @@ type Result struct {
 	Stdout   string
 	Stderr   string
 	Duration time.Duration
+	Attempts int // Runs of a command retried under the RetryPolicy
 	Err      error
 }
 
@@ -31,15 +33,39 @@ type Options struct {
 	Env         []string
 	Timeout     time.Duration
 	Stdin       io.Reader
-	StreamStdio bool // Stream stdout/stderr to terminal in real-time
+	StreamStdio bool      // Stream stdout/stderr to terminal in real-time
+	SessionLog  io.Writer // Also receives the command line and its output; must be safe for concurrent writes
+	Escalate    string    // Reason to re-run the command as root when it fails for lack of privileges
 	Logger      *log.Logger
 }
 
+// terminateGracePeriod is how long a cancelled command may take to exit
+// after SIGTERM before it is killed
+const terminateGracePeriod = 15 * time.Second
+
+// streamStdout receives the stdout of streaming commands
+var streamStdout io.Writer = os.Stdout
+
+// SetStreamStdout redirects the stdout of streaming commands, keeping
+// stdout free for machine-readable output
+func SetStreamStdout(w io.Writer) {
+	streamStdout = w
+}
+
+// sessionLog is the session log of the running galena command
+var sessionLog io.Writer
+
+// SetSessionLog makes DefaultOptions log commands to w; nil stops logging
+func SetSessionLog(w io.Writer) {
+	sessionLog = w
+}
+
 // DefaultOptions returns default execution options
 func DefaultOptions() Options {
 	return Options{
 		Timeout:     30 * time.Minute,
 		StreamStdio: false,
+		SessionLog:  sessionLog,
 	}
 }
 
@@ -47,6 +73,10 @@ func DefaultOptions() Options {
 func Run(ctx context.Context, name string, args []string, opts Options) *Result {
 	start := time.Now()
 
+	if skipped := skipForDryRun(name, args); skipped != nil {
+		return skipped
+	}
+
 	result := &Result{
 		Command: name,
 		Args:    args,
@@ -61,6 +91,12 @@ func Run(ctx context.Context, name string, args []string, opts Options) *Result
 
 	cmd := exec.CommandContext(ctx, name, args...)
 
+	// Let the tool clean up its own state before it is killed
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = terminateGracePeriod
+
 	// Set working directory
 	if opts.Dir != "" {
 		cmd.Dir = opts.Dir
@@ -78,39 +114,30 @@ func Run(ctx context.Context, name string, args []string, opts Options) *Result
 
 	var stdout, stderr bytes.Buffer
 
-	// Global session logging if enabled
 	var stdoutW, stderrW io.Writer
 	if opts.StreamStdio {
-		stdoutW = io.MultiWriter(os.Stdout, &stdout)
+		stdoutW = io.MultiWriter(streamStdout, &stdout)
 		stderrW = io.MultiWriter(os.Stderr, &stderr)
+		if out, ok := buildOutput(ctx); ok {
+			stdoutW = io.MultiWriter(out, &stdout)
+			stderrW = io.MultiWriter(out, &stderr)
+		}
 	} else {
 		stdoutW = &stdout
 		stderrW = &stderr
 	}
 
-	// Capture to global log if phase is set
-	phase, _ := ctx.Value("build-phase").(string)
-	logPath, _ := ctx.Value("log-file").(string)
-	if phase != "" && logPath != "" {
-		if f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-			defer func() {
-				if closeErr := f.Close(); closeErr != nil && opts.Logger != nil {
-					opts.Logger.Warn("failed to close command log file", "error", closeErr)
-				}
-			}()
-			stdoutW = io.MultiWriter(stdoutW, f)
-			stderrW = io.MultiWriter(stderrW, f)
-			if _, writeErr := fmt.Fprintf(f, "\n--- [%s] Executing: %s %s ---\n", phase, name, strings.Join(args, " ")); writeErr != nil && opts.Logger != nil {
-				opts.Logger.Warn("failed to write command header to log file", "error", writeErr)
-			}
-		}
+	if opts.SessionLog != nil {
+		fmt.Fprintf(opts.SessionLog, "\n--- %s $ %s ---\n", start.Format(time.TimeOnly), FormatCommand(name, args))
+		stdoutW = io.MultiWriter(stdoutW, opts.SessionLog)
+		stderrW = io.MultiWriter(stderrW, opts.SessionLog)
 	}
 
 	cmd.Stdout = stdoutW
 	cmd.Stderr = stderrW
 
 	if opts.Logger != nil {
-		opts.Logger.Debug("executing command", "cmd", name, "args", args)
+		opts.Logger.Debug("executing command", "cmd", name, "args", redactArgs(args))
 	}
 
 	err := cmd.Run()
@@ -141,7 +168,14 @@ func Run(ctx context.Context, name string, args []string, opts Options) *Result
 			)
 		}
 	}
+	if opts.SessionLog != nil {
+		fmt.Fprintf(opts.SessionLog, "--- exit %d after %s ---\n", result.ExitCode, result.Duration.Round(time.Millisecond))
+	}
+	record(ctx, result, opts.Dir, start, opts)
 
+	if result.Err != nil && opts.Escalate != "" && ctx.Err() == nil {
+		return escalate(ctx, name, args, opts, result)
+	}
 	return result
 }
 
@@ -187,11 +221,50 @@ func PodmanBuild(ctx context.Context, dir string, args []string) *Result {
 	return Run(ctx, "podman", allArgs, opts)
 }
 
-// PodmanPush pushes an image to a registry
-func PodmanPush(ctx context.Context, image string) *Result {
+// PodmanPush pushes an image to a registry, retrying transient failures.
+// creds is user:password, or empty to use podman's own login.
+func PodmanPush(ctx context.Context, image, creds string) *Result {
+	opts := DefaultOptions()
+	opts.StreamStdio = true
+	auth, cleanup, err := credsArgs(image, creds)
+	if err != nil {
+		return &Result{Command: "podman", Err: err}
+	}
+	defer cleanup()
+	return RunRetry(ctx, "podman", append(append([]string{"push"}, auth...), image), opts)
+}
+
+// PodmanManifestPush pushes a manifest list and all of its images to a
+// registry, retrying transient failures
+func PodmanManifestPush(ctx context.Context, list, destination, creds string) *Result {
 	opts := DefaultOptions()
 	opts.StreamStdio = true
-	return Run(ctx, "podman", []string{"push", image}, opts)
+	auth, cleanup, err := credsArgs(destination, creds)
+	if err != nil {
+		return &Result{Command: "podman", Err: err}
+	}
+	defer cleanup()
+	args := append(append([]string{"manifest", "push", "--all"}, auth...), list, "docker://"+destination)
+	return RunRetry(ctx, "podman", args, opts)
+}
+
+// credsArgs returns the --authfile flag of podman and buildah carrying
+// user:password credentials for the registry of image, and a function
+// removing the file once the command is done
+func credsArgs(image, creds string) ([]string, func(), error) {
+	if creds == "" {
+		return nil, func() {}, nil
+	}
+	path, cleanup, err := AuthFile(map[string]string{registryHost(image): creds})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{"--authfile", path}, cleanup, nil
+}
+
+// Pull pulls an image with an engine, retrying transient failures
+func Pull(ctx context.Context, engine string, args ...string) *Result {
+	return RunRetry(ctx, engine, append([]string{"pull"}, args...), DefaultOptions())
 }
 
 // Git runs a git command
@@ -201,9 +274,14 @@ func Git(ctx context.Context, dir string, args ...string) *Result {
 	return Run(ctx, "git", args, opts)
 }
 
-// Cosign runs a cosign command
+// Cosign runs a cosign command, retrying transient failures
 func Cosign(ctx context.Context, args ...string) *Result {
-	return RunSimple(ctx, "cosign", args...)
+	return RunRetry(ctx, "cosign", args, DefaultOptions())
+}
+
+// Skopeo runs a skopeo command, retrying transient failures
+func Skopeo(ctx context.Context, args ...string) *Result {
+	return RunRetry(ctx, "skopeo", args, DefaultOptions())
 }
 
 // Syft runs a syft command
@@ -211,6 +289,11 @@ func Syft(ctx context.Context, args ...string) *Result {
 	return RunSimple(ctx, "syft", args...)
 }
 
+// Grype runs a grype command
+func Grype(ctx context.Context, args ...string) *Result {
+	return RunSimple(ctx, "grype", args...)
+}
+
 // Trivy runs a trivy command
 func Trivy(ctx context.Context, args ...string) *Result {
 	return RunSimple(ctx, "trivy", args...)
@@ -251,6 +334,10 @@ func RunPipe(ctx context.Context, name1 string, args1 []string, name2 string, ar
 	result := &Result{
 		Command: fmt.Sprintf("%s | %s", name1, name2),
 	}
+	if dryRun.Load() && !(readOnlyCommand(name1, args1) && readOnlyCommand(name2, args2)) {
+		PrintDryRunAction("%s | %s", FormatCommand(name1, args1), FormatCommand(name2, args2))
+		return result
+	}
 
 	if opts.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -280,7 +367,7 @@ func RunPipe(ctx context.Context, name1 string, args1 []string, name2 string, ar
 	var stdout, stderr bytes.Buffer
 	var stdoutW, stderrW io.Writer
 	if opts.StreamStdio {
-		stdoutW = io.MultiWriter(os.Stdout, &stdout)
+		stdoutW = io.MultiWriter(streamStdout, &stdout)
 		stderrW = io.MultiWriter(os.Stderr, &stderr)
 	} else {
 		stdoutW = &stdout
@@ -293,8 +380,8 @@ func RunPipe(ctx context.Context, name1 string, args1 []string, name2 string, ar
 
 	if opts.Logger != nil {
 		opts.Logger.Debug("executing piped commands",
-			"cmd1", name1, "args1", args1,
-			"cmd2", name2, "args2", args2,
+			"cmd1", name1, "args1", redactArgs(args1),
+			"cmd2", name2, "args2", redactArgs(args2),
 		)
 	}
 
@@ -350,12 +437,27 @@ func RequireCommands(commands ...string) error {
 	return nil
 }
 
-// FormatCommand formats a command for display
+// FormatCommand formats a command for display, quoting arguments the
+// shell would split or expand so the line can be pasted into a terminal.
+// Registered secrets are masked.
 func FormatCommand(name string, args []string) string {
-	parts := append([]string{name}, args...)
+	parts := make([]string, 0, len(args)+1)
+	for _, part := range append([]string{name}, args...) {
+		parts = append(parts, shellQuote(Redact(part)))
+	}
 	return strings.Join(parts, " ")
 }
 
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(s, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // LastNLines returns the last n lines of a string
 func LastNLines(s string, n int) string {
 	lines := strings.Split(strings.TrimSpace(s), "\n")
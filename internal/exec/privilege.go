@@ -0,0 +1,130 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PrivilegeBroker turns a command into one that runs as root, asking the
+// user for consent. privilege.Escalator implements it.
+type PrivilegeBroker interface {
+	Command(ctx context.Context, reason string, name string, args ...string) (string, []string, error)
+}
+
+var broker PrivilegeBroker
+
+// SetPrivilegeBroker sets the broker that re-runs commands with
+// Options.Escalate as root after they fail for lack of privileges
+func SetPrivilegeBroker(b PrivilegeBroker) {
+	broker = b
+}
+
+// permissionPatterns are the stderr messages of commands refused to
+// unprivileged users: EACCES and EPERM as libc prints them, and the root
+// checks of tools and polkit. Broader phrases such as "access denied" also
+// come from registries and remote services, where root does not help.
+var permissionPatterns = []string{
+	"permission denied",
+	"operation not permitted",
+	"must be run as root",
+	"must be root",
+	"requires root",
+	"are you root",
+	"need to be root",
+	"root privileges",
+	"insufficient privileges",
+	"interactive authentication required",
+	"not allowed for user",
+	"eacces",
+	"eperm",
+}
+
+// PermissionDenied reports whether a failed command was refused for lack of
+// privileges
+func PermissionDenied(r *Result) bool {
+	if r == nil || r.Err == nil {
+		return false
+	}
+	if errors.Is(r.Err, os.ErrPermission) {
+		return true
+	}
+	stderr := strings.ToLower(r.Stderr)
+	for _, pattern := range permissionPatterns {
+		if strings.Contains(stderr, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrivilegeError is returned for a command that needs root when escalation
+// is unavailable, declined, or disabled with --no-sudo
+type PrivilegeError struct {
+	Command string
+	Reason  string
+	Err     error // Why the command could not be elevated
+	Cause   error // The original failure
+}
+
+func (e *PrivilegeError) Error() string {
+	msg := fmt.Sprintf("%s needs root to %s: %v; run galena as root or allow sudo/pkexec", e.Command, e.Reason, e.Err)
+	if e.Cause != nil {
+		msg += fmt.Sprintf(" (%v)", e.Cause)
+	}
+	return msg
+}
+
+func (e *PrivilegeError) Unwrap() []error {
+	return []error{e.Err, e.Cause}
+}
+
+// Elevate returns the command line that runs name as root through the
+// broker, for commands known to need root. Consent is asked as for a command
+// re-run after a permission failure.
+func Elevate(ctx context.Context, reason, name string, args ...string) (string, []string, error) {
+	if os.Geteuid() == 0 {
+		return name, args, nil
+	}
+	if broker == nil {
+		return "", nil, &PrivilegeError{Command: name, Reason: reason, Err: errors.New("no privilege broker")}
+	}
+	return broker.Command(ctx, reason, name, args...)
+}
+
+// escalate re-runs a command that failed for lack of privileges through the
+// broker. It returns the original result when the failure has another cause
+// or the command cannot be run again.
+func escalate(ctx context.Context, name string, args []string, opts Options, result *Result) *Result {
+	if os.Geteuid() == 0 || !PermissionDenied(result) {
+		return result
+	}
+	// Input already consumed by the first run has to be replayed
+	if opts.Stdin != nil {
+		seeker, ok := opts.Stdin.(io.Seeker)
+		if !ok {
+			return result
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return result
+		}
+	}
+
+	elevatedName, elevatedArgs, err := Elevate(ctx, opts.Escalate, name, args...)
+	if err != nil {
+		var privErr *PrivilegeError
+		if errors.As(err, &privErr) {
+			err = privErr.Err
+		}
+		result.Err = &PrivilegeError{Command: name, Reason: opts.Escalate, Err: err, Cause: result.Err}
+		return result
+	}
+	if opts.Logger != nil {
+		opts.Logger.Info("permission denied, retrying as root", "cmd", name, "reason", opts.Escalate)
+	}
+	opts.Escalate = ""
+	return Run(ctx, elevatedName, elevatedArgs, opts)
+}
@@ -0,0 +1,158 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BuildProgress is the state of an image build parsed from podman or buildah output
+type BuildProgress struct {
+	Stage       int    // Current stage, 1-based (0 before the first step)
+	Stages      int    // Number of stages (1 for single-stage builds)
+	Step        int    // Current step within the stage
+	Steps       int    // Number of steps in the stage
+	Instruction string // Containerfile instruction of the current step
+	Committing  bool   // Final image is being committed
+	Layers      []LayerStatus
+}
+
+// LayerStatus records whether a build step was served from the layer cache
+type LayerStatus struct {
+	Stage       int
+	Step        int
+	Instruction string
+	Cached      bool
+}
+
+// CacheHits returns the number of steps served from the layer cache
+func (p BuildProgress) CacheHits() int {
+	hits := 0
+	for _, l := range p.Layers {
+		if l.Cached {
+			hits++
+		}
+	}
+	return hits
+}
+
+// CacheMisses returns the number of steps that produced a new layer
+func (p BuildProgress) CacheMisses() int {
+	return len(p.Layers) - p.CacheHits()
+}
+
+var (
+	// [1/2] STEP 3/10: RUN dnf install -y foo
+	stepPattern = regexp.MustCompile(`^(?:\[(\d+)/(\d+)\]\s+)?STEP\s+(\d+)/(\d+):\s*(.*)$`)
+	// --> Using cache 3f2a... / --> 3f2a...
+	layerPattern = regexp.MustCompile(`^-->\s+(Using cache\s+)?([0-9a-f]{6,})`)
+	// [2/2] COMMIT localhost/galena:latest
+	commitPattern = regexp.MustCompile(`^(?:\[\d+/\d+\]\s+)?COMMIT\b`)
+)
+
+// ProgressParser tracks build progress line by line
+type ProgressParser struct {
+	progress BuildProgress
+	pending  bool // current step has not reported its layer yet
+}
+
+// NewProgressParser creates a parser for podman and buildah build output
+func NewProgressParser() *ProgressParser {
+	return &ProgressParser{}
+}
+
+// Feed parses one line of output and reports whether the progress changed
+func (p *ProgressParser) Feed(line string) bool {
+	line = strings.TrimSpace(line)
+
+	if m := stepPattern.FindStringSubmatch(line); m != nil {
+		p.progress.Stage, p.progress.Stages = 1, 1
+		if m[1] != "" {
+			p.progress.Stage, _ = strconv.Atoi(m[1])
+			p.progress.Stages, _ = strconv.Atoi(m[2])
+		}
+		p.progress.Step, _ = strconv.Atoi(m[3])
+		p.progress.Steps, _ = strconv.Atoi(m[4])
+		p.progress.Instruction = m[5]
+		p.pending = true
+		return true
+	}
+
+	if m := layerPattern.FindStringSubmatch(line); m != nil && p.pending {
+		p.progress.Layers = append(p.progress.Layers, LayerStatus{
+			Stage:       p.progress.Stage,
+			Step:        p.progress.Step,
+			Instruction: p.progress.Instruction,
+			Cached:      m[1] != "",
+		})
+		p.pending = false
+		return true
+	}
+
+	if commitPattern.MatchString(line) && p.progress.Stage == p.progress.Stages {
+		p.progress.Committing = true
+		return true
+	}
+
+	return false
+}
+
+// Progress returns a snapshot of the current progress
+func (p *ProgressParser) Progress() BuildProgress {
+	snapshot := p.progress
+	snapshot.Layers = append([]LayerStatus(nil), p.progress.Layers...)
+	return snapshot
+}
+
+// ProgressWriter is an io.Writer that parses build output and reports each
+// line together with the progress after it
+type ProgressWriter struct {
+	mu       sync.Mutex
+	parser   *ProgressParser
+	buf      bytes.Buffer
+	onUpdate func(progress BuildProgress, line string)
+}
+
+// NewProgressWriter creates a writer calling onUpdate for every complete line
+func NewProgressWriter(onUpdate func(progress BuildProgress, line string)) *ProgressWriter {
+	return &ProgressWriter{parser: NewProgressParser(), onUpdate: onUpdate}
+}
+
+// Write implements io.Writer. Stdout and stderr may share a writer, so
+// writes are serialized.
+func (w *ProgressWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(data)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf.Next(i+1)), "\r\n")
+		w.parser.Feed(line)
+		w.onUpdate(w.parser.Progress(), line)
+	}
+	return len(data), nil
+}
+
+type buildOutputKey struct{}
+
+// WithBuildOutput makes streaming commands run with ctx write their stdout
+// and stderr to w instead of the terminal. A nil writer keeps the default.
+func WithBuildOutput(ctx context.Context, w io.Writer) context.Context {
+	if w == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, buildOutputKey{}, w)
+}
+
+func buildOutput(ctx context.Context) (io.Writer, bool) {
+	w, ok := ctx.Value(buildOutputKey{}).(io.Writer)
+	return w, ok
+}
@@ -0,0 +1,145 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/creack/pty"
+	"github.com/muesli/cancelreader"
+)
+
+// ptyDrainTimeout is how long output still buffered in the pseudo-terminal
+// is copied after the command exited
+const ptyDrainTimeout = time.Second
+
+// RunAttached runs an interactive command such as a shell, ujust, or an
+// editor. When stdin is a terminal the command gets a pseudo-terminal of its
+// own that follows the size of the user's terminal, so shells and TUIs work
+// even when galena's stdout or stderr is redirected. Otherwise it inherits
+// galena's stdio. Output is not captured in the result.
+func RunAttached(ctx context.Context, name string, args []string, opts Options) *Result {
+	start := time.Now()
+
+	if skipped := skipForDryRun(name, args); skipped != nil {
+		return skipped
+	}
+
+	result := &Result{
+		Command: name,
+		Args:    args,
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = terminateGracePeriod
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+
+	if opts.SessionLog != nil {
+		fmt.Fprintf(opts.SessionLog, "\n--- %s $ %s ---\n", start.Format(time.TimeOnly), FormatCommand(name, args))
+	}
+	if opts.Logger != nil {
+		opts.Logger.Debug("executing attached command", "cmd", name, "args", redactArgs(args))
+	}
+
+	var err error
+	if term.IsTerminal(os.Stdin.Fd()) {
+		err = runPTY(cmd, opts.SessionLog)
+	} else {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	}
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
+		} else {
+			result.ExitCode = -1
+		}
+		result.Err = err
+	}
+
+	if opts.SessionLog != nil {
+		fmt.Fprintf(opts.SessionLog, "\n--- exit %d after %s ---\n", result.ExitCode, result.Duration.Round(time.Millisecond))
+	}
+	record(ctx, result, opts.Dir, start, opts)
+	return result
+}
+
+// runPTY runs cmd on a new pseudo-terminal, with the user's terminal in raw
+// mode so every key, including Ctrl+C, reaches the command
+func runPTY(cmd *exec.Cmd, sessionLog io.Writer) error {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return fmt.Errorf("allocating a pseudo-terminal: %w", err)
+	}
+	defer ptmx.Close()
+
+	// Follow the size of the user's terminal
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	defer func() {
+		signal.Stop(resize)
+		close(resize)
+	}()
+	go func() {
+		for range resize {
+			_ = pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	resize <- syscall.SIGWINCH
+
+	if state, err := term.MakeRaw(os.Stdin.Fd()); err == nil {
+		defer func() { _ = term.Restore(os.Stdin.Fd(), state) }()
+	}
+
+	// A cancelable reader keeps the input copy from swallowing keys typed
+	// after the command exited
+	stdin, err := cancelreader.NewReader(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("reading terminal input: %w", err)
+	}
+	defer stdin.Close()
+	defer stdin.Cancel()
+	go func() {
+		_, _ = io.Copy(ptmx, stdin)
+	}()
+
+	var out io.Writer = os.Stdout
+	if sessionLog != nil {
+		out = io.MultiWriter(os.Stdout, sessionLog)
+	}
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(out, ptmx)
+		close(copied)
+	}()
+
+	err = cmd.Wait()
+	// Background processes of the command may hold the terminal open
+	select {
+	case <-copied:
+	case <-time.After(ptyDrainTimeout):
+	}
+	return err
+}
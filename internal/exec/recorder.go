@@ -0,0 +1,137 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ExecRecord describes one finished external command
+type ExecRecord struct {
+	Time     time.Time     `json:"time"`
+	Command  string        `json:"command"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	ExitCode int           `json:"exit_code"`
+	Stdout   string        `json:"stdout,omitempty"`
+	Stderr   string        `json:"stderr,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// ExecRecorder receives every command run through Run. Recorders must be
+// safe for concurrent use; a failing recorder never fails the command.
+type ExecRecorder interface {
+	Record(rec ExecRecord) error
+}
+
+var recorder ExecRecorder
+
+// SetRecorder records every command of the process to r; nil stops
+// recording
+func SetRecorder(r ExecRecorder) {
+	recorder = r
+}
+
+type recorderKey struct{}
+
+// WithRecorder records the commands run with ctx to r, in addition to the
+// recorder set with SetRecorder
+func WithRecorder(ctx context.Context, r ExecRecorder) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// record hands a finished command to the process and context recorders
+func record(ctx context.Context, result *Result, dir string, start time.Time, opts Options) {
+	recorders := []ExecRecorder{recorder}
+	if r, ok := ctx.Value(recorderKey{}).(ExecRecorder); ok {
+		recorders = append(recorders, r)
+	}
+	rec := ExecRecord{
+		Time:     start,
+		Command:  result.Command,
+		Args:     redactArgs(result.Args),
+		Dir:      dir,
+		Duration: result.Duration,
+		ExitCode: result.ExitCode,
+		Stdout:   Redact(result.Stdout),
+		Stderr:   Redact(result.Stderr),
+	}
+	if result.Err != nil {
+		rec.Error = Redact(result.Err.Error())
+	}
+	for _, r := range recorders {
+		if r == nil {
+			continue
+		}
+		if err := r.Record(rec); err != nil && opts.Logger != nil {
+			opts.Logger.Warn("failed to record command", "cmd", result.Command, "error", err)
+		}
+	}
+}
+
+// DefaultAuditOutput is how many bytes of stdout and stderr each audit
+// entry keeps
+const DefaultAuditOutput = 4096
+
+// JSONLRecorder appends one JSON object per command to an audit log
+type JSONLRecorder struct {
+	path       string
+	maxOutput  int
+	invocation string
+	mu         sync.Mutex
+}
+
+// NewJSONLRecorder writes to path, keeping the last maxOutput bytes of each
+// output stream. invocation names the galena command that ran the commands.
+func NewJSONLRecorder(path string, maxOutput int, invocation string) (*JSONLRecorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating audit log directory: %w", err)
+	}
+	if maxOutput <= 0 {
+		maxOutput = DefaultAuditOutput
+	}
+	return &JSONLRecorder{path: path, maxOutput: maxOutput, invocation: invocation}, nil
+}
+
+// Record appends rec to the audit log
+func (r *JSONLRecorder) Record(rec ExecRecord) error {
+	entry := struct {
+		ExecRecord
+		Invocation string `json:"invocation,omitempty"`
+		PID        int    `json:"pid"`
+	}{rec, r.invocation, os.Getpid()}
+	entry.Stdout = truncateOutput(rec.Stdout, r.maxOutput)
+	entry.Stderr = truncateOutput(rec.Stderr, r.maxOutput)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// truncateOutput keeps the end of s, where errors usually are
+func truncateOutput(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return fmt.Sprintf("[%d bytes truncated]\n%s", len(s)-limit, s[len(s)-limit:])
+}
@@ -0,0 +1,50 @@
+package exec
+
+import (
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secrets in everything exec reports
+const redactedValue = "***"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// RegisterSecret masks value wherever a command is reported from now on:
+// dry-run output, session logs, audit records, debug logs, and errors.
+// Credentials passed on a command line must be registered first.
+func RegisterSecret(value string) {
+	if value == "" {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+}
+
+// Redact returns s with every registered secret masked
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
+
+// redactArgs returns args with every registered secret masked
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = Redact(arg)
+	}
+	return redacted
+}
@@ -0,0 +1,140 @@
+package exec
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// RetryPolicy decides which failed commands are run again and how long to
+// wait in between. A failure is retried when its exit code is listed in
+// ExitCodes or its stderr contains one of Patterns.
+type RetryPolicy struct {
+	Attempts  int           // Total attempts; 1 disables retries
+	Delay     time.Duration // Wait before the first retry, doubled for every further one
+	MaxDelay  time.Duration // Upper bound of the wait
+	ExitCodes []int         // Exit codes that are always retried
+	Patterns  []string      // Case-insensitive stderr substrings of transient failures
+}
+
+// DefaultRetryPatterns are the stderr messages of registry and network
+// flakes that are worth another attempt
+var DefaultRetryPatterns = []string{
+	"connection reset by peer",
+	"connection refused",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"server misbehaving",
+	"temporary failure in name resolution",
+	"too many requests",
+	"toomanyrequests",
+	// A bare 429 also matches digests, sizes, and line numbers
+	"http status: 429",
+	"status code 429",
+	"status code: 429",
+	"statuscode: 429",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"blob upload unknown",
+	"use of closed network connection",
+	"context deadline exceeded (client.timeout",
+}
+
+// DefaultRetryPolicy returns three attempts with 5s, then 10s of backoff
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts: 3,
+		Delay:    5 * time.Second,
+		MaxDelay: time.Minute,
+		Patterns: DefaultRetryPatterns,
+	}
+}
+
+var (
+	retryPolicy = DefaultRetryPolicy()
+	retryLogger *log.Logger
+)
+
+// SetRetryPolicy replaces the policy of registry operations. Retries are
+// logged as warnings to logger when it is not nil.
+func SetRetryPolicy(p RetryPolicy, logger *log.Logger) {
+	retryPolicy = p
+	retryLogger = logger
+}
+
+// CurrentRetryPolicy returns the policy of registry operations
+func CurrentRetryPolicy() RetryPolicy {
+	return retryPolicy
+}
+
+// Retryable reports whether a failed result looks transient
+func (p RetryPolicy) Retryable(r *Result) bool {
+	if r == nil || r.Err == nil {
+		return false
+	}
+	if slices.Contains(p.ExitCodes, r.ExitCode) {
+		return true
+	}
+	stderr := strings.ToLower(r.Stderr)
+	for _, pattern := range p.Patterns {
+		if pattern != "" && strings.Contains(stderr, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the wait after the given failed attempt, starting at 1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// Retry runs fn until it succeeds, fails permanently, or the attempts of the
+// policy are used up, and returns the last result
+func (p RetryPolicy) Retry(ctx context.Context, fn func() *Result) *Result {
+	for attempt := 1; ; attempt++ {
+		result := fn()
+		result.Attempts = attempt
+		if attempt >= p.Attempts || !p.Retryable(result) || ctx.Err() != nil {
+			return result
+		}
+
+		delay := p.Backoff(attempt)
+		if retryLogger != nil {
+			retryLogger.Warn("transient failure, retrying",
+				"cmd", result.Command,
+				"attempt", attempt,
+				"delay", delay,
+				"error", LastNLines(result.Stderr, 1),
+			)
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(delay):
+		}
+	}
+}
+
+// RunRetry runs a command under the registry retry policy
+func RunRetry(ctx context.Context, name string, args []string, opts Options) *Result {
+	return retryPolicy.Retry(ctx, func() *Result {
+		return Run(ctx, name, args, opts)
+	})
+}
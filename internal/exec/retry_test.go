@@ -0,0 +1,87 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	failed := errors.New("exit status 125")
+	policy := DefaultRetryPolicy()
+	policy.ExitCodes = []int{75}
+
+	tests := []struct {
+		name   string
+		result *Result
+		want   bool
+	}{
+		{name: "success", result: &Result{}, want: false},
+		{name: "nil", result: nil, want: false},
+		{name: "connection reset", result: &Result{Err: failed, Stderr: "read tcp: Connection Reset By Peer"}, want: true},
+		{name: "rate limited", result: &Result{Err: failed, Stderr: "Error: received unexpected HTTP status: 429 Too Many Requests"}, want: true},
+		{name: "rate limited by status code", result: &Result{Err: failed, Stderr: "pinging container registry: StatusCode: 429"}, want: true},
+		{name: "docker rate limit", result: &Result{Err: failed, Stderr: "toomanyrequests: You have reached your pull rate limit"}, want: true},
+		{name: "bad gateway", result: &Result{Err: failed, Stderr: "502 Bad Gateway"}, want: true},
+		{name: "429 in a digest", result: &Result{Err: failed, Stderr: "manifest unknown: sha256:429 abc"}, want: false},
+		{name: "429 in a size", result: &Result{Err: failed, Stderr: "blob size mismatch: got 8429 bytes"}, want: false},
+		{name: "unauthorized", result: &Result{Err: failed, Stderr: "unauthorized: authentication required"}, want: false},
+		{name: "retried exit code", result: &Result{Err: failed, ExitCode: 75}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Retryable(tt.result); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{Delay: 5 * time.Second, MaxDelay: 30 * time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1: 5 * time.Second,
+		2: 10 * time.Second,
+		3: 20 * time.Second,
+		4: 30 * time.Second,
+		9: 30 * time.Second,
+	} {
+		if got := policy.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Patterns: []string{"i/o timeout"}}
+	transient := &Result{Err: errors.New("exit status 1"), Stderr: "dial tcp: i/o timeout"}
+
+	tests := []struct {
+		name         string
+		results      []*Result
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds after transient failures", results: []*Result{transient, transient, {}}, wantAttempts: 3},
+		{name: "gives up after the attempts", results: []*Result{transient, transient, transient, {}}, wantAttempts: 3, wantErr: true},
+		{name: "permanent failure is not retried", results: []*Result{{Err: errors.New("exit status 1"), Stderr: "denied"}, {}}, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			result := policy.Retry(context.Background(), func() *Result {
+				r := *tt.results[calls]
+				calls++
+				return &r
+			})
+			if calls != tt.wantAttempts || result.Attempts != tt.wantAttempts {
+				t.Errorf("ran %d times, Attempts = %d, want %d", calls, result.Attempts, tt.wantAttempts)
+			}
+			if (result.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, want error %v", result.Err, tt.wantErr)
+			}
+		})
+	}
+}
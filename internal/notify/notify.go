@@ -0,0 +1,231 @@
+// Package notify announces build, push, and disk results to chat webhooks,
+// HTTP endpoints, and the desktop
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Events, as named in notifications[].events
+const (
+	EventBuildSucceeded = "build_succeeded"
+	EventBuildFailed    = "build_failed"
+	EventPush           = "push"
+	EventDiskSucceeded  = "disk_succeeded"
+	EventDiskFailed     = "disk_failed"
+)
+
+// sendTimeout bounds each notification so an unreachable endpoint cannot
+// hold up a build
+const sendTimeout = 15 * time.Second
+
+// Event is a build result. Generic webhooks receive it as JSON.
+type Event struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Project   string    `json:"project"`
+	ImageRef  string    `json:"image_ref,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Variant   string    `json:"variant,omitempty"`
+	Tag       string    `json:"tag,omitempty"`
+	Digest    string    `json:"digest,omitempty"`
+	DiskType  string    `json:"disk_type,omitempty"`
+	Duration  float64   `json:"duration_seconds"`
+	Artifacts []string  `json:"artifacts,omitempty"` // Pushed references or disk image paths
+	Error     string    `json:"error,omitempty"`
+}
+
+// Failed reports whether the event announces a failure
+func (e Event) Failed() bool {
+	return e.Event == EventBuildFailed || e.Event == EventDiskFailed
+}
+
+// Title returns a one-line summary, e.g. "galena: build failed"
+func (e Event) Title() string {
+	switch e.Event {
+	case EventBuildSucceeded:
+		return e.Project + ": build succeeded"
+	case EventBuildFailed:
+		return e.Project + ": build failed"
+	case EventPush:
+		return e.Project + ": image pushed"
+	case EventDiskSucceeded:
+		return e.Project + ": disk image built"
+	case EventDiskFailed:
+		return e.Project + ": disk image failed"
+	}
+	return e.Project + ": " + e.Event
+}
+
+// Body returns the details of the event as plain text lines
+func (e Event) Body() string {
+	var lines []string
+	add := func(label, value string) {
+		if value != "" {
+			lines = append(lines, label+": "+value)
+		}
+	}
+	add("Image", e.ImageRef)
+	add("Version", e.Version)
+	add("Digest", e.Digest)
+	add("Disk type", e.DiskType)
+	if e.Duration > 0 {
+		add("Duration", time.Duration(e.Duration*float64(time.Second)).Round(time.Second).String())
+	}
+	for _, artifact := range e.Artifacts {
+		add("Artifact", artifact)
+	}
+	add("Error", e.Error)
+	return strings.Join(lines, "\n")
+}
+
+// Notifier sends events to the configured notification targets
+type Notifier struct {
+	targets []config.NotificationConfig
+	logger  *log.Logger
+	client  *http.Client
+}
+
+// New creates a notifier for the notifications block of a config
+func New(targets []config.NotificationConfig, logger *log.Logger) *Notifier {
+	return &Notifier{
+		targets: targets,
+		logger:  logger,
+		client:  &http.Client{Timeout: sendTimeout},
+	}
+}
+
+// Send delivers an event to every target subscribed to it. Failures are
+// logged as warnings and never fail the command that sent the event.
+func (n *Notifier) Send(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	// An interrupted build is still announced
+	ctx = context.WithoutCancel(ctx)
+
+	for _, target := range n.targets {
+		if len(target.Events) > 0 && !slices.Contains(target.Events, event.Event) {
+			continue
+		}
+		if exec.DryRun() && target.Type != "desktop" {
+			exec.PrintDryRunAction("notify %s: %s", target.Type, event.Title())
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := n.send(sendCtx, target, event)
+		cancel()
+		if err != nil {
+			n.logger.Warn("notification failed", "type", target.Type, "event", event.Event, "error", err)
+			continue
+		}
+		n.logger.Debug("notification sent", "type", target.Type, "event", event.Event)
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, target config.NotificationConfig, event Event) error {
+	text := event.Title()
+	if body := event.Body(); body != "" {
+		text += "\n" + body
+	}
+
+	switch target.Type {
+	case "slack":
+		return n.post(ctx, http.MethodPost, targetURL(target), map[string]string{"text": text}, nil)
+	case "discord":
+		return n.post(ctx, http.MethodPost, targetURL(target), map[string]string{"content": text}, nil)
+	case "matrix":
+		return n.sendMatrix(ctx, target, text)
+	case "webhook":
+		return n.post(ctx, http.MethodPost, targetURL(target), event, target.Headers)
+	case "desktop":
+		return sendDesktop(ctx, event)
+	}
+	return fmt.Errorf("unsupported notification type %q", target.Type)
+}
+
+// sendMatrix posts a message to a Matrix room through the client-server API
+func (n *Notifier) sendMatrix(ctx context.Context, target config.NotificationConfig, text string) error {
+	token := os.Getenv(target.TokenEnv)
+	if token == "" {
+		return fmt.Errorf("$%s is empty", target.TokenEnv)
+	}
+	txnID := fmt.Sprintf("galena-%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(targetURL(target), "/"), url.PathEscape(target.Room), txnID)
+	message := map[string]string{"msgtype": "m.text", "body": text}
+	return n.post(ctx, http.MethodPut, endpoint, message, map[string]string{"Authorization": "Bearer " + token})
+}
+
+// post sends payload as JSON
+func (n *Notifier) post(ctx context.Context, method, endpoint string, payload any, headers map[string]string) error {
+	if endpoint == "" {
+		return fmt.Errorf("no URL configured")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "galena")
+	for key, value := range headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL may carry a secret token, so only the host is reported
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("sending to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// sendDesktop shows the event with notify-send
+func sendDesktop(ctx context.Context, event Event) error {
+	if !exec.CheckCommand("notify-send") {
+		return fmt.Errorf("notify-send is not installed")
+	}
+	urgency := "normal"
+	if event.Failed() {
+		urgency = "critical"
+	}
+	result := exec.RunSimple(ctx, "notify-send", "--app-name=galena", "--urgency="+urgency, event.Title(), event.Body())
+	return result.Err
+}
+
+// targetURL returns the configured URL, preferring url_env
+func targetURL(target config.NotificationConfig) string {
+	if target.URLEnv != "" {
+		if value := os.Getenv(target.URLEnv); value != "" {
+			return value
+		}
+	}
+	return target.URL
+}
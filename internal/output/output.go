@@ -0,0 +1,119 @@
+// Package output selects between styled terminal output and machine-readable
+// JSON for commands that orchestration tools consume
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	mu             sync.Mutex
+	format         = FormatText
+	summaryEmitted bool
+)
+
+var writer io.Writer = os.Stdout
+
+// Formats returns the supported output formats
+func Formats() []string {
+	return []string{FormatText, FormatJSON}
+}
+
+// SetFormat selects the output format
+func SetFormat(f string) error {
+	switch f {
+	case "", FormatText:
+		format = FormatText
+	case FormatJSON:
+		format = FormatJSON
+	default:
+		return fmt.Errorf("unsupported output format %q (expected %s)", f, strings.Join(Formats(), ", "))
+	}
+	return nil
+}
+
+// IsJSON reports whether machine-readable output is selected
+func IsJSON() bool {
+	return format == FormatJSON
+}
+
+// Writer returns the stream that events and summaries are written to
+func Writer() io.Writer {
+	return writer
+}
+
+// Summary is the final JSON document a command emits
+type Summary struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	Result  any       `json:"result,omitempty"`
+}
+
+// EmitSummary writes the final summary of a command in JSON mode and returns
+// err unchanged, so it can wrap a command's return value. Only the first
+// summary is written.
+func EmitSummary(command string, result any, err error) error {
+	if !IsJSON() {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if summaryEmitted {
+		return err
+	}
+	summaryEmitted = true
+
+	summary := Summary{
+		Type:    "summary",
+		Time:    time.Now().UTC(),
+		Command: command,
+		Success: err == nil,
+		Result:  result,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	data, marshalErr := json.Marshal(summary)
+	if marshalErr != nil {
+		data = []byte(fmt.Sprintf(`{"type":"summary","command":%q,"success":false,"error":%q}`, command, marshalErr.Error()))
+	}
+	_, _ = fmt.Fprintln(writer, string(data))
+	return err
+}
+
+// Render emits result as the JSON summary of command, or calls text to print
+// it for people. A non-nil err is returned without calling text.
+func Render(command string, result any, err error, text func()) error {
+	if IsJSON() {
+		return EmitSummary(command, result, err)
+	}
+	if err != nil {
+		return err
+	}
+	text()
+	return nil
+}
+
+// SummaryEmitted reports whether a summary has already been written
+func SummaryEmitted() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return summaryEmitted
+}
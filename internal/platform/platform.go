@@ -3,8 +3,70 @@ package platform
 import (
 	"fmt"
 	"runtime"
+	"strings"
 )
 
+// Capability is a host feature that commands depend on
+type Capability string
+
+// Host capabilities
+const (
+	ImageBuilds    Capability = "image builds"     // Containerfile builds with rootful mounts and SELinux labels
+	DiskBuilds     Capability = "disk builds"      // bootc-image-builder in a privileged container
+	ContainerTools Capability = "container tools"  // podman (or podman machine), skopeo, cosign, syft, and grype
+	VMs            Capability = "virtual machines" // QEMU with KVM on Linux or HVF on macOS
+)
+
+// support is the capability matrix: the operating systems each capability
+// works on
+var support = map[Capability][]string{
+	ImageBuilds:    {"linux"},
+	DiskBuilds:     {"linux"},
+	ContainerTools: {"linux", "darwin"},
+	VMs:            {"linux", "darwin"},
+}
+
+// Supports reports whether the current OS has a capability.
+func Supports(c Capability) bool {
+	for _, goos := range support[c] {
+		if goos == runtime.GOOS {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns an error naming the supported operating systems if the
+// current OS lacks a capability.
+func Require(c Capability, feature string) error {
+	if Supports(c) {
+		return nil
+	}
+	if feature == "" {
+		feature = "galena"
+	}
+	systems := make([]string, 0, len(support[c]))
+	for _, goos := range support[c] {
+		systems = append(systems, osNames[goos])
+	}
+	return fmt.Errorf("%s is supported on %s only (current: %s)", feature, strings.Join(systems, " and "), runtime.GOOS)
+}
+
+// osNames maps GOOS values to the names used in messages
+var osNames = map[string]string{"linux": "Linux", "darwin": "macOS"}
+
+// Accelerator returns the QEMU hardware accelerator of the current OS: kvm
+// on Linux, hvf on macOS, or empty when there is none.
+func Accelerator() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "kvm"
+	case "darwin":
+		return "hvf"
+	}
+	return ""
+}
+
 // RequireLinux returns an error if the current OS is not Linux.
 func RequireLinux(feature string) error {
 	if runtime.GOOS != "linux" {
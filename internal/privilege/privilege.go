@@ -0,0 +1,174 @@
+// Package privilege centralizes privilege escalation for operations that need root
+package privilege
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+var (
+	// ErrRefused is returned when the user declined elevation for this session
+	ErrRefused = errors.New("privilege escalation refused")
+	// ErrUnavailable is returned when neither sudo nor pkexec is installed
+	ErrUnavailable = errors.New("no privilege escalation tool available (install sudo or pkexec)")
+	// ErrDisabled is returned when escalation was turned off with --no-sudo
+	ErrDisabled = errors.New("privilege escalation disabled by --no-sudo")
+)
+
+// ConfirmFunc asks the user whether elevation may be used for the given reason
+type ConfirmFunc func(reason string, commands []string) bool
+
+// Escalator runs commands as root, asking for consent at most once per session
+type Escalator struct {
+	logger  *log.Logger
+	confirm ConfirmFunc
+
+	mu       sync.Mutex
+	decided  bool
+	approved bool
+	disabled bool
+}
+
+// NewEscalator creates a new escalator. A nil confirm approves every request
+// after logging what will run, which suits non-interactive sessions.
+func NewEscalator(logger *log.Logger, confirm ConfirmFunc) *Escalator {
+	return &Escalator{
+		logger:  logger,
+		confirm: confirm,
+	}
+}
+
+// Disable refuses every later escalation with ErrDisabled, so commands
+// needing root fail and user-scope fallbacks are used instead
+func (e *Escalator) Disable() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.disabled = true
+}
+
+// IsRoot reports whether the current process already runs as root
+func IsRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// Tool returns the escalation tool to use, or an empty string if none is installed
+func Tool() string {
+	if exec.CheckCommand("sudo") {
+		return "sudo"
+	}
+	if exec.CheckCommand("pkexec") {
+		return "pkexec"
+	}
+	return ""
+}
+
+// Authorize asks for consent to run the given commands as root. The decision
+// is remembered, so later calls return immediately without prompting again.
+func (e *Escalator) Authorize(ctx context.Context, reason string, commands ...string) error {
+	// A dry run prints the elevated commands without running them
+	if IsRoot() || exec.DryRun() {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.disabled {
+		return ErrDisabled
+	}
+	if e.decided {
+		if e.approved {
+			return nil
+		}
+		return ErrRefused
+	}
+
+	tool := Tool()
+	if tool == "" {
+		return ErrUnavailable
+	}
+
+	e.decided = true
+	if e.confirm != nil {
+		e.approved = e.confirm(reason, commands)
+	} else {
+		e.logger.Info("elevating privileges", "reason", reason, "commands", strings.Join(commands, "; "))
+		e.approved = true
+	}
+	if !e.approved {
+		e.logger.Warn("privilege escalation declined", "reason", reason)
+		return ErrRefused
+	}
+
+	// Prime the sudo credential cache so the password is asked once, up front
+	if tool == "sudo" {
+		opts := exec.DefaultOptions()
+		opts.Stdin = os.Stdin
+		opts.StreamStdio = true
+		if result := exec.Run(ctx, "sudo", []string{"-v"}, opts); result.Err != nil {
+			e.approved = false
+			return fmt.Errorf("%w: %v", ErrRefused, result.Err)
+		}
+	}
+
+	return nil
+}
+
+// Command returns the command line that runs name with root privileges
+func (e *Escalator) Command(ctx context.Context, reason string, name string, args ...string) (string, []string, error) {
+	if IsRoot() {
+		return name, args, nil
+	}
+	if err := e.Authorize(ctx, reason, exec.FormatCommand(name, args)); err != nil {
+		return "", nil, &exec.PrivilegeError{Command: name, Reason: reason, Err: err}
+	}
+	return Tool(), append([]string{name}, args...), nil
+}
+
+// Run runs a command as root
+func (e *Escalator) Run(ctx context.Context, reason string, name string, args []string, opts exec.Options) *exec.Result {
+	cmdName, cmdArgs, err := e.Command(ctx, reason, name, args...)
+	if err != nil {
+		return &exec.Result{Command: name, Args: args, ExitCode: -1, Err: err}
+	}
+	return exec.Run(ctx, cmdName, cmdArgs, opts)
+}
+
+// WriteFile writes data to path, elevating only when the path is not
+// writable. It needs the escalator set as the exec privilege broker.
+func (e *Escalator) WriteFile(ctx context.Context, reason string, path string, data []byte) error {
+	if exec.DryRun() {
+		exec.PrintDryRunAction("write %d bytes to %s", len(data), path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		if err := os.WriteFile(path, data, 0o644); err == nil {
+			return nil
+		}
+	}
+
+	// Both re-run through the privilege broker once refused
+	opts := exec.DefaultOptions()
+	opts.Escalate = reason
+	opts.Logger = e.logger
+	mkdir := exec.Run(ctx, "mkdir", []string{"-p", filepath.Dir(path)}, opts)
+	if mkdir.Err != nil {
+		return mkdir.Err
+	}
+
+	opts.Stdin = bytes.NewReader(data)
+	write := exec.Run(ctx, "tee", []string{path}, opts)
+	if write.Err != nil {
+		return fmt.Errorf("writing %s: %w", path, write.Err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package ref parses, normalizes, and validates OCI image references
+package ref
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultTag is used when a reference has neither a tag nor a digest
+const DefaultTag = "latest"
+
+var (
+	componentPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagPattern       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestPattern    = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+	registryPattern  = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?$`)
+)
+
+// transports are stripped by Parse so a reference a tool printed, like
+// docker://ghcr.io/x/y, can still be inspected; Normalize rejects them
+var transports = []string{"docker://", "containers-storage:", "oci://"}
+
+// Reference is a parsed image reference: registry/repository:tag@digest
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Parse splits an image reference into its components without applying defaults
+func Parse(s string) (Reference, error) {
+	raw := strings.TrimSpace(s)
+	for _, transport := range transports {
+		raw = strings.TrimPrefix(raw, transport)
+	}
+	if raw == "" {
+		return Reference{}, fmt.Errorf("empty image reference")
+	}
+
+	var r Reference
+	if at := strings.Index(raw, "@"); at >= 0 {
+		r.Digest = raw[at+1:]
+		raw = raw[:at]
+	}
+
+	// A tag separator is a colon after the last slash; earlier colons are registry ports
+	if colon := strings.LastIndex(raw, ":"); colon > strings.LastIndex(raw, "/") {
+		r.Tag = raw[colon+1:]
+		raw = raw[:colon]
+	}
+
+	if slash := strings.Index(raw, "/"); slash >= 0 && isRegistry(raw[:slash]) {
+		r.Registry = raw[:slash]
+		raw = raw[slash+1:]
+	}
+	r.Repository = raw
+
+	return r, nil
+}
+
+// isRegistry reports whether the first path component names a registry host
+func isRegistry(component string) bool {
+	return component == "localhost" || strings.ContainsAny(component, ".:")
+}
+
+// Validate checks every component of the reference
+func (r Reference) Validate() error {
+	if r.Registry != "" && !registryPattern.MatchString(r.Registry) {
+		return fmt.Errorf("invalid registry %q", r.Registry)
+	}
+	if r.Repository == "" {
+		return fmt.Errorf("missing repository name")
+	}
+	for _, component := range strings.Split(r.Repository, "/") {
+		if !componentPattern.MatchString(component) {
+			return fmt.Errorf("invalid repository component %q in %q (lowercase letters, digits, and separators only)", component, r.Repository)
+		}
+	}
+	if r.Tag != "" && !tagPattern.MatchString(r.Tag) {
+		return fmt.Errorf("invalid tag %q", r.Tag)
+	}
+	if r.Digest != "" && !digestPattern.MatchString(r.Digest) {
+		return fmt.Errorf("invalid digest %q", r.Digest)
+	}
+	return nil
+}
+
+// Normalized returns a copy with a lowercase registry and repository and the
+// default tag applied when neither a tag nor a digest is present
+func (r Reference) Normalized() Reference {
+	r.Registry = strings.ToLower(r.Registry)
+	r.Repository = strings.ToLower(r.Repository)
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = DefaultTag
+	}
+	return r
+}
+
+// Name returns registry/repository without tag or digest
+func (r Reference) Name() string {
+	if r.Registry == "" {
+		return r.Repository
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// Base returns the last path component of the repository
+func (r Reference) Base() string {
+	if slash := strings.LastIndex(r.Repository, "/"); slash >= 0 {
+		return r.Repository[slash+1:]
+	}
+	return r.Repository
+}
+
+// IsQualified reports whether the reference names a registry
+func (r Reference) IsQualified() bool {
+	return r.Registry != ""
+}
+
+// WithTag returns a copy with the tag replaced and the digest cleared
+func (r Reference) WithTag(tag string) Reference {
+	r.Tag = tag
+	r.Digest = ""
+	return r
+}
+
+// String formats the reference
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Normalize parses and validates a reference string and applies the default
+// tag. A transport prefix or an uppercase repository is an error rather than
+// being rewritten, so galena never acts on a different image than was named.
+func Normalize(s string) (string, error) {
+	for _, transport := range transports {
+		if strings.HasPrefix(strings.TrimSpace(s), transport) {
+			return "", fmt.Errorf("invalid image reference %q: remove the %s transport prefix", s, transport)
+		}
+	}
+	r, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if lower := strings.ToLower(r.Repository); r.Repository != lower {
+		return "", fmt.Errorf("invalid image reference %q: repository names must be lowercase (%s)", s, lower)
+	}
+	r = r.Normalized()
+	if err := r.Validate(); err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", s, err)
+	}
+	return r.String(), nil
+}
+
+// Validate reports whether a reference string is well formed
+func Validate(s string) error {
+	_, err := Normalize(s)
+	return err
+}
+
+// Expansion holds the namespaces a short reference can be expanded into
+type Expansion struct {
+	Registry   string
+	Repository string
+	// Owner and Repo describe the git remote, e.g. a GitHub owner/repo pair
+	Owner string
+	Repo  string
+}
+
+// Candidates expands a reference into the fully qualified references it may
+// refer to. Qualified references and references with a namespace are
+// returned unchanged; bare names are tried in the configured repository and
+// under the git remote owner.
+func Candidates(s string, exp Expansion) []string {
+	r, err := Parse(s)
+	if err != nil {
+		return []string{strings.TrimSpace(s)}
+	}
+	r = r.Normalized()
+
+	candidates := []string{r.String()}
+	if r.IsQualified() || strings.Contains(r.Repository, "/") {
+		return candidates
+	}
+
+	registry := exp.Registry
+	if registry == "" {
+		registry = "ghcr.io"
+	}
+	qualify := func(namespace, name string) string {
+		return Reference{
+			Registry:   registry,
+			Repository: strings.ToLower(namespace + "/" + name),
+			Tag:        r.Tag,
+			Digest:     r.Digest,
+		}.String()
+	}
+
+	if exp.Repository != "" {
+		candidates = append(candidates, qualify(exp.Repository, r.Repository))
+	}
+	if exp.Owner != "" {
+		candidates = append(candidates, qualify(exp.Owner, r.Repository))
+		if exp.Repo != "" {
+			candidates = append(candidates, qualify(exp.Owner, exp.Repo))
+		}
+	}
+
+	return unique(candidates)
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		out = append(out, value)
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package ref
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Reference
+	}{
+		{
+			name: "bare name",
+			in:   "galena",
+			want: Reference{Repository: "galena"},
+		},
+		{
+			name: "namespace without registry",
+			in:   "iiroan/galena:stable",
+			want: Reference{Repository: "iiroan/galena", Tag: "stable"},
+		},
+		{
+			name: "registry",
+			in:   "ghcr.io/iiroan/galena:latest",
+			want: Reference{Registry: "ghcr.io", Repository: "iiroan/galena", Tag: "latest"},
+		},
+		{
+			name: "registry port is not a tag",
+			in:   "localhost:5000/galena",
+			want: Reference{Registry: "localhost:5000", Repository: "galena"},
+		},
+		{
+			name: "localhost",
+			in:   "localhost/galena:dev",
+			want: Reference{Registry: "localhost", Repository: "galena", Tag: "dev"},
+		},
+		{
+			name: "tag and digest",
+			in:   "ghcr.io/iiroan/galena:stable@" + testDigest,
+			want: Reference{Registry: "ghcr.io", Repository: "iiroan/galena", Tag: "stable", Digest: testDigest},
+		},
+		{
+			name: "transport is stripped",
+			in:   " docker://ghcr.io/iiroan/galena ",
+			want: Reference{Registry: "ghcr.io", Repository: "iiroan/galena"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse("  "); err == nil {
+		t.Error("Parse of an empty reference succeeded")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{name: "default tag", in: "ghcr.io/iiroan/galena", want: "ghcr.io/iiroan/galena:latest"},
+		{name: "tag kept", in: "ghcr.io/iiroan/galena:stable", want: "ghcr.io/iiroan/galena:stable"},
+		{name: "digest without tag", in: "ghcr.io/iiroan/galena@" + testDigest, want: "ghcr.io/iiroan/galena@" + testDigest},
+		{name: "registry lowercased", in: "GHCR.io/iiroan/galena:stable", want: "ghcr.io/iiroan/galena:stable"},
+		{name: "uppercase repository", in: "ghcr.io/IIRoan/galena", wantErr: "must be lowercase (iiroan/galena)"},
+		{name: "docker transport", in: "docker://ghcr.io/iiroan/galena", wantErr: "remove the docker:// transport prefix"},
+		{name: "containers-storage transport", in: "containers-storage:localhost/galena", wantErr: "remove the containers-storage: transport prefix"},
+		{name: "invalid tag", in: "ghcr.io/iiroan/galena:-bad", wantErr: "invalid tag"},
+		{name: "invalid digest", in: "ghcr.io/iiroan/galena@sha256:abc", wantErr: "invalid digest"},
+		{name: "invalid component", in: "ghcr.io/iiroan/gal__-ena", wantErr: "invalid repository component"},
+		{name: "empty", in: "", wantErr: "empty image reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Normalize(%q) error = %v, want it to mention %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package remote manages Galena hosts over SSH
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/iiroan/galena/internal/bootc"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// Host is a Galena machine reachable over SSH
+type Host struct {
+	Name     string `yaml:"name" json:"name"`
+	Address  string `yaml:"address" json:"address"` // Hostname or IP address
+	User     string `yaml:"user,omitempty" json:"user,omitempty"`
+	Port     int    `yaml:"port,omitempty" json:"port,omitempty"`
+	Identity string `yaml:"identity,omitempty" json:"identity,omitempty"` // SSH private key
+}
+
+// ParseTarget parses an [user@]host[:port] SSH target
+func ParseTarget(target string) (Host, error) {
+	var h Host
+	original := target
+	if user, rest, ok := strings.Cut(target, "@"); ok {
+		h.User, target = user, rest
+	}
+	if host, port, ok := strings.Cut(target, ":"); ok {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return h, fmt.Errorf("invalid port %q", port)
+		}
+		h.Port, target = p, host
+	}
+	if target == "" {
+		return h, fmt.Errorf("missing host in %q", original)
+	}
+	// ssh would read a leading dash as an option
+	if strings.HasPrefix(h.User, "-") || strings.HasPrefix(target, "-") {
+		return h, fmt.Errorf("invalid target %q: must not start with -", original)
+	}
+	h.Address = target
+	return h, nil
+}
+
+// Target returns the user@host destination passed to ssh
+func (h Host) Target() string {
+	if h.User != "" {
+		return h.User + "@" + h.Address
+	}
+	return h.Address
+}
+
+// sshArgs returns the ssh arguments that run command on the host. BatchMode
+// fails instead of prompting, which parallel runs cannot answer.
+func (h Host) sshArgs(command string) []string {
+	args := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if h.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(h.Port))
+	}
+	if h.Identity != "" {
+		args = append(args, "-i", h.Identity)
+	}
+	return append(args, "--", h.Target(), command)
+}
+
+// Run runs a shell command on the host. Commands that need root are run
+// with sudo -n unless the login user is root, so a missing NOPASSWD rule
+// fails fast.
+func (h Host) Run(ctx context.Context, command string, asRoot bool) *exec.Result {
+	if asRoot && h.User != "root" {
+		command = "sudo -n " + command
+	}
+	return exec.Run(ctx, "ssh", h.sshArgs(command), exec.DefaultOptions())
+}
+
+// Status reads bootc status --json from the host
+func (h Host) Status(ctx context.Context) (*bootc.Host, error) {
+	result := h.Run(ctx, "bootc status --json", true)
+	if result.Err != nil {
+		return nil, fmt.Errorf("bootc status on %s: %s", h.Name, exec.LastNLines(result.Stderr, 2))
+	}
+	return bootc.ParseStatus([]byte(result.Stdout))
+}
+
+// Upgrade stages the latest image on the host with bootc upgrade, and
+// reboots into it with apply. Staging and rebooting are separate steps so a
+// host that cannot be reached fails instead of passing for a reboot.
+func (h Host) Upgrade(ctx context.Context, apply bool) error {
+	result := h.Run(ctx, "bootc upgrade --quiet", true)
+	if result.Err != nil {
+		return fmt.Errorf("bootc upgrade on %s: %s", h.Name, exec.LastNLines(result.Stderr, 2))
+	}
+	if !apply {
+		return nil
+	}
+
+	// Like bootc upgrade --apply, only reboot when an update was staged
+	status, err := h.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Status.Staged == nil {
+		return nil
+	}
+	result = h.Run(ctx, "systemctl reboot", true)
+	if result.Err != nil {
+		// The connection drops when the host reboots; it was just reached to
+		// stage the update, so ssh failing here is the reboot
+		if result.ExitCode == 255 {
+			return nil
+		}
+		return fmt.Errorf("reboot on %s: %s", h.Name, exec.LastNLines(result.Stderr, 2))
+	}
+	return nil
+}
+
+// Store is the list of known hosts, kept in remotes.yaml in the user
+// configuration directory
+type Store struct {
+	Hosts []Host `yaml:"hosts"`
+	path  string
+}
+
+// DefaultStorePath returns ~/.config/galena/remotes.yaml
+func DefaultStorePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding config directory: %w", err)
+	}
+	return filepath.Join(dir, "galena", "remotes.yaml"), nil
+}
+
+// LoadStore reads the host list; a missing file is empty
+func LoadStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the host list
+func (s *Store) Save() error {
+	sort.Slice(s.Hosts, func(i, j int) bool { return s.Hosts[i].Name < s.Hosts[j].Name })
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshaling hosts: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+// Add adds or replaces a host
+func (s *Store) Add(h Host) {
+	for i := range s.Hosts {
+		if s.Hosts[i].Name == h.Name {
+			s.Hosts[i] = h
+			return
+		}
+	}
+	s.Hosts = append(s.Hosts, h)
+}
+
+// Remove removes a host by name
+func (s *Store) Remove(name string) error {
+	for i := range s.Hosts {
+		if s.Hosts[i].Name == name {
+			s.Hosts = append(s.Hosts[:i], s.Hosts[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q not found", name)
+}
+
+// Select returns the named hosts, or every host when no names are given
+func (s *Store) Select(names []string) ([]Host, error) {
+	if len(names) == 0 {
+		if len(s.Hosts) == 0 {
+			return nil, fmt.Errorf("no hosts added; add one with galena remote add")
+		}
+		return s.Hosts, nil
+	}
+	var hosts []Host
+	for _, name := range names {
+		found := false
+		for _, h := range s.Hosts {
+			if h.Name == name {
+				hosts = append(hosts, h)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("host %q not found", name)
+		}
+	}
+	return hosts, nil
+}
+
+// ForEach runs fn for every host with at most parallel hosts at once and
+// returns the results in host order
+func ForEach[T any](hosts []Host, parallel int, fn func(Host) T) []T {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]T, len(hosts))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, h Host) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = fn(h)
+		}(i, h)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,190 @@
+package scaffold
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// remotePrefix marks a template in a GitHub repository
+const remotePrefix = "gh:"
+
+// repoPartPattern matches a GitHub owner or repository name
+var repoPartPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Remote is a project template in a GitHub repository, written
+// gh:owner/repo[//subdir][@ref]
+type Remote struct {
+	Owner  string
+	Repo   string
+	Subdir string // Directory of the template within the repository
+	Ref    string // Branch, tag, or commit; the default branch when empty
+}
+
+// IsRemote reports whether a template name refers to a repository
+func IsRemote(name string) bool {
+	return strings.HasPrefix(name, remotePrefix)
+}
+
+// ParseRemote parses a gh:owner/repo[//subdir][@ref] template
+func ParseRemote(s string) (Remote, error) {
+	spec, ok := strings.CutPrefix(s, remotePrefix)
+	if !ok {
+		return Remote{}, fmt.Errorf("%q is not a repository template (expected %sowner/repo[//subdir][@ref])", s, remotePrefix)
+	}
+	var r Remote
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		spec, r.Ref = spec[:i], spec[i+1:]
+		if r.Ref == "" {
+			return Remote{}, fmt.Errorf("%s: empty ref after @", s)
+		}
+	}
+	spec, r.Subdir, _ = strings.Cut(spec, "//")
+	r.Subdir = strings.Trim(r.Subdir, "/")
+	if r.Subdir != "" && !filepath.IsLocal(r.Subdir) {
+		return Remote{}, fmt.Errorf("%s: subdirectory %q leaves the repository", s, r.Subdir)
+	}
+	r.Owner, r.Repo, _ = strings.Cut(strings.TrimSuffix(spec, ".git"), "/")
+	if !repoPartPattern.MatchString(r.Owner) || !repoPartPattern.MatchString(r.Repo) {
+		return Remote{}, fmt.Errorf("%s: expected %sowner/repo[//subdir][@ref]", s, remotePrefix)
+	}
+	return r, nil
+}
+
+// Source returns the template without its ref, as recorded in galena.yaml
+func (r Remote) Source() string {
+	source := remotePrefix + r.Owner + "/" + r.Repo
+	if r.Subdir != "" {
+		source += "//" + r.Subdir
+	}
+	return source
+}
+
+// String returns the template as written on the command line
+func (r Remote) String() string {
+	if r.Ref == "" {
+		return r.Source()
+	}
+	return r.Source() + "@" + r.Ref
+}
+
+// URL returns the clone URL of the repository
+func (r Remote) URL() string {
+	return "https://github.com/" + r.Owner + "/" + r.Repo + ".git"
+}
+
+// Fetch downloads the ref of the repository, without history, into dir
+// and returns the commit it resolved to
+func (r Remote) Fetch(ctx context.Context, dir string) (string, error) {
+	ref := r.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Fetching a single ref works for branches, tags, and commits alike
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", r.URL()},
+		{"fetch", "--quiet", "--depth", "1", "origin", ref},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	}
+	opts := exec.DefaultOptions()
+	opts.Dir = dir
+	// Fail instead of asking for credentials of a missing or private repository
+	opts.Env = []string{"GIT_TERMINAL_PROMPT=0"}
+	for _, args := range steps {
+		if result := exec.RunRetry(ctx, "git", args, opts); result.Err != nil {
+			return "", fmt.Errorf("fetching %s: %s", r, strings.TrimSpace(cmp.Or(result.Stderr, result.Err.Error())))
+		}
+	}
+	result := exec.Git(ctx, dir, "rev-parse", "HEAD")
+	if result.Err != nil {
+		return "", fmt.Errorf("reading commit of %s: %w", r, result.Err)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// Placeholders returns the strings a repository template can use in file
+// contents and paths, and the project values they are replaced with
+func Placeholders(opts Options) map[string]string {
+	return map[string]string{
+		"__GALENA_NAME__":           opts.Name,
+		"__GALENA_DESCRIPTION__":    opts.Description,
+		"__GALENA_REGISTRY__":       opts.Registry,
+		"__GALENA_REPOSITORY__":     opts.Repository,
+		"__GALENA_FEDORA_VERSION__": opts.FedoraVersion,
+	}
+}
+
+// RenderDir returns the files of a new project from a template checked out
+// at root, with placeholders substituted in text files and paths. Git
+// metadata, symlinks, and other special files are left out.
+func RenderDir(root string, opts Options) ([]File, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("project name is required")
+	}
+	if opts.FedoraVersion == "" {
+		opts.FedoraVersion = "42"
+	}
+	var pairs []string
+	for placeholder, value := range Placeholders(opts) {
+		pairs = append(pairs, placeholder, value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	var files []File
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if isText(data) {
+			data = []byte(replacer.Replace(string(data)))
+		}
+		mode := os.FileMode(0o644)
+		if info.Mode()&0o111 != 0 {
+			mode = 0o755
+		}
+		files = append(files, File{Path: replacer.Replace(filepath.ToSlash(rel)), Data: data, Mode: mode})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("template has no files")
+	}
+	return files, nil
+}
+
+// isText reports whether data looks like text rather than a binary file
+func isText(data []byte) bool {
+	return utf8.Valid(data) && !strings.ContainsRune(string(data), 0)
+}
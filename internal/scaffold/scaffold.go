@@ -0,0 +1,227 @@
+// Package scaffold writes the file tree of a new galena project: galena.yaml,
+// a .gitignore, a Containerfile, build scripts, Homebrew and Flatpak catalogs,
+// disk image settings, a devcontainer profile, and a CI workflow
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/iiroan/galena/internal/ci"
+)
+
+//go:embed all:templates
+var templateFS embed.FS
+
+// templateSuffix ends every embedded file, so linters of the repository
+// skip the skeletons
+const templateSuffix = ".tmpl"
+
+// Template is a starting point for a new project
+type Template struct {
+	Name        string
+	Title       string
+	Description string
+	BaseImage   string   // Without a tag; the Fedora version is the tag
+	Packages    []string // dnf packages installed by build/10-build.sh
+	Flatpaks    []string // Applications preinstalled on first boot
+}
+
+// Templates returns the project templates, the default first
+func Templates() []Template {
+	return []Template{
+		{
+			Name:        "gnome",
+			Title:       "GNOME",
+			Description: "Fedora Silverblue with the GNOME desktop, from Universal Blue",
+			BaseImage:   "ghcr.io/ublue-os/silverblue-main",
+			Packages:    []string{"gnome-tweaks"},
+			Flatpaks: []string{
+				"org.mozilla.firefox",
+				"org.gnome.Calculator",
+				"org.gnome.TextEditor",
+				"org.gnome.Loupe",
+				"com.mattjakeman.ExtensionManager",
+				"com.github.tchx84.Flatseal",
+			},
+		},
+		{
+			Name:        "kde",
+			Title:       "KDE Plasma",
+			Description: "Fedora Kinoite with the KDE Plasma desktop, from Universal Blue",
+			BaseImage:   "ghcr.io/ublue-os/kinoite-main",
+			Flatpaks: []string{
+				"org.mozilla.firefox",
+				"org.kde.kcalc",
+				"org.kde.kwrite",
+				"org.kde.gwenview",
+				"org.kde.okular",
+				"com.github.tchx84.Flatseal",
+			},
+		},
+		{
+			Name:        "minimal",
+			Title:       "Minimal",
+			Description: "Fedora bootc without a desktop, for servers and appliances",
+			BaseImage:   "quay.io/fedora/fedora-bootc",
+		},
+	}
+}
+
+// TemplateNames returns the names of the project templates
+func TemplateNames() []string {
+	var names []string
+	for _, t := range Templates() {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// LookupTemplate returns the template with the given name
+func LookupTemplate(name string) (Template, error) {
+	for _, t := range Templates() {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return Template{}, fmt.Errorf("unknown template %q (use %s)", name, strings.Join(TemplateNames(), ", "))
+}
+
+// Options describe a new project
+type Options struct {
+	Template      Template
+	Name          string
+	Description   string
+	Registry      string
+	Repository    string // Namespace images are pushed to, e.g. the GitHub owner
+	FedoraVersion string
+	Workflow      bool // Add a GitHub Actions workflow
+}
+
+// BaseImage returns the base image of the project, tagged with its Fedora
+// version
+func (o Options) BaseImage() string {
+	return o.Template.BaseImage + ":" + o.FedoraVersion
+}
+
+// File is one file of a new project
+type File struct {
+	Path string // Slash-separated, relative to the project root
+	Data []byte
+	Mode os.FileMode
+}
+
+// Render returns the files of a new project
+func Render(opts Options) ([]File, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("project name is required")
+	}
+	if opts.Description == "" {
+		opts.Description = opts.Template.Description
+	}
+	if opts.FedoraVersion == "" {
+		opts.FedoraVersion = "42"
+	}
+
+	var files []File
+	err := fs.WalkDir(templateFS, "templates", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		src, err := templateFS.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimSuffix(strings.TrimPrefix(name, "templates/"), templateSuffix)
+		tmpl, err := template.New(rel).Parse(string(src))
+		if err != nil {
+			return fmt.Errorf("parsing template %s: %w", rel, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, opts); err != nil {
+			return fmt.Errorf("rendering %s: %w", rel, err)
+		}
+		mode := os.FileMode(0o644)
+		if path.Ext(rel) == ".sh" {
+			mode = 0o755
+		}
+		files = append(files, File{Path: rel, Data: buf.Bytes(), Mode: mode})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Workflow {
+		workflowPath, err := ci.WorkflowPath(ci.ProviderGitHub)
+		if err != nil {
+			return nil, err
+		}
+		workflow, err := ci.RenderWorkflow(ci.ProviderGitHub, ci.WorkflowOptions{
+			Variants:  []string{"main"},
+			DiskTypes: []string{"anaconda-iso"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: workflowPath, Data: []byte(workflow), Mode: 0o644})
+	}
+	return files, nil
+}
+
+// Write writes files below dir. Existing files are kept unless force is
+// set; the paths written and kept are returned.
+func Write(dir string, files []File, force bool) (written, kept []string, err error) {
+	written, kept = []string{}, []string{}
+	for _, f := range files {
+		if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+			return written, kept, fmt.Errorf("%s: path leaves the project directory", f.Path)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if _, err := os.Stat(target); err == nil && !force {
+			kept = append(kept, f.Path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return written, kept, err
+		}
+		if err := os.WriteFile(target, f.Data, f.Mode); err != nil {
+			return written, kept, err
+		}
+		// WriteFile leaves the mode of an existing file alone
+		if err := os.Chmod(target, f.Mode); err != nil {
+			return written, kept, err
+		}
+		written = append(written, f.Path)
+	}
+	return written, kept, nil
+}
+
+//go:embed variant.sh.tmpl
+var variantScript string
+
+// VariantScript returns a build script that only runs for one variant,
+// installing packages
+func VariantScript(variant, script string, packages []string) (File, error) {
+	tmpl, err := template.New(script).Parse(variantScript)
+	if err != nil {
+		return File{}, err
+	}
+	var buf bytes.Buffer
+	data := struct {
+		Variant  string
+		Script   string
+		Packages []string
+	}{variant, script, packages}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return File{}, fmt.Errorf("rendering %s: %w", script, err)
+	}
+	return File{Path: "build/" + script, Data: buf.Bytes(), Mode: 0o755}, nil
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verifyTimeout bounds each request of a login check
+const verifyTimeout = 30 * time.Second
+
+// Verify checks a credential against the registry API, following a bearer
+// token challenge the way container tools do. Nothing is stored: unlike
+// podman login, no auth file is written.
+func Verify(ctx context.Context, cred Credential) error {
+	host := normalizeRegistry(cred.Registry)
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	client := &http.Client{Timeout: verifyTimeout}
+
+	resp, err := get(ctx, client, "https://"+host+"/v2/", cred)
+	if err != nil {
+		return err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode != http.StatusUnauthorized:
+		return fmt.Errorf("%s returned %s", cred.Registry, resp.Status)
+	case !strings.HasPrefix(challenge, "Bearer "):
+		return fmt.Errorf("%s rejected the username or password", cred.Registry)
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("%s sent a token challenge without a realm", cred.Registry)
+	}
+	query := url.Values{"account": {cred.Username}}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	resp, err = get(ctx, client, params["realm"]+"?"+query.Encode(), cred)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%s rejected the username or password", cred.Registry)
+	}
+	return fmt.Errorf("%s token endpoint returned %s", cred.Registry, resp.Status)
+}
+
+func get(ctx context.Context, client *http.Client, target string, cred Credential) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(cred.Username, cred.Password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting %s: %w", cred.Registry, err)
+	}
+	_ = resp.Body.Close()
+	return resp, nil
+}
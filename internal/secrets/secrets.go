@@ -0,0 +1,102 @@
+// Package secrets resolves registry credentials and signing keys from the
+// environment, files, or password managers. Secrets are kept in memory and
+// handed to podman, skopeo, and cosign per invocation, and never written to
+// galena.yaml. Registry credentials reach those tools through a temporary
+// auth file (exec.AuthFile) readable only by the current user, which is
+// removed once the command finishes.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// commandTimeout bounds a password manager, which may wait for an unlock
+// prompt
+const commandTimeout = 2 * time.Minute
+
+// Resolve reads the secret a reference points to:
+//
+//	env:VAR                an environment variable
+//	file:PATH              a file, relative to dir
+//	pass:NAME              the first line of pass show NAME
+//	gopass:NAME            gopass show --password NAME
+//	op://VAULT/ITEM/FIELD  a 1Password field, via op read
+//	cmd:COMMAND            the output of a shell command
+//
+// The value is registered with exec so it is masked in logs and audit
+// records.
+func Resolve(ctx context.Context, dir, ref string) (string, error) {
+	value, err := resolve(ctx, dir, ref)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s: secret is empty", ref)
+	}
+	exec.RegisterSecret(value)
+	return value, nil
+}
+
+func resolve(ctx context.Context, dir, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%s: %s is not set", ref, name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "file:"):
+		path := strings.TrimPrefix(ref, "file:")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", ref, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(ref, "pass:"):
+		out, err := run(ctx, ref, "pass", "show", strings.TrimPrefix(ref, "pass:"))
+		first, _, _ := strings.Cut(out, "\n")
+		return first, err
+	case strings.HasPrefix(ref, "gopass:"):
+		return run(ctx, ref, "gopass", "show", "--password", strings.TrimPrefix(ref, "gopass:"))
+	case strings.HasPrefix(ref, "op://"):
+		return run(ctx, ref, "op", "read", "--no-newline", ref)
+	case strings.HasPrefix(ref, "cmd:"):
+		return run(ctx, ref, "sh", "-c", strings.TrimPrefix(ref, "cmd:"))
+	}
+	return "", fmt.Errorf("%q is not a secret reference (expected one of %s)", ref, strings.Join(config.SecretSchemes(), ", "))
+}
+
+// run runs a password manager and returns its output without the trailing
+// newline. It bypasses exec.Run on purpose: the session and audit logs
+// would capture the secret. Prompts go to the terminal.
+func run(ctx context.Context, ref, name string, args ...string) (string, error) {
+	if _, err := osexec.LookPath(name); err != nil {
+		return "", fmt.Errorf("%s: %s is not installed", ref, name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := osexec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s failed: %w: %s", ref, name, err, exec.LastNLines(stderr.String(), 3))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/iiroan/galena/internal/config"
+	"github.com/iiroan/galena/internal/ref"
+)
+
+// Credential is a username and password or token for a registry
+type Credential struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// Creds returns the user:password form that exec.AuthFile takes
+func (c Credential) Creds() string {
+	return c.Username + ":" + c.Password
+}
+
+// Store resolves the credentials of galena.yaml on first use and keeps
+// them in memory, so a password manager is asked at most once per run
+type Store struct {
+	dir         string
+	credentials []config.CredentialConfig
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewStore returns a store of configured credentials. File references are
+// relative to dir.
+func NewStore(dir string, credentials []config.CredentialConfig) *Store {
+	return &Store{dir: dir, credentials: credentials, cache: map[string]string{}}
+}
+
+var defaultStore = NewStore("", nil)
+
+// Configure replaces the credentials that Lookup and LookupImage use
+func Configure(dir string, credentials []config.CredentialConfig) {
+	defaultStore = NewStore(dir, credentials)
+}
+
+// Lookup returns the configured credential of a registry host; ok is false
+// when there is none
+func Lookup(ctx context.Context, registry string) (cred Credential, ok bool, err error) {
+	return defaultStore.Lookup(ctx, registry)
+}
+
+// LookupImage returns the configured credential of the registry an image
+// reference points to
+func LookupImage(ctx context.Context, imageRef string) (Credential, bool, error) {
+	return defaultStore.Lookup(ctx, RegistryOf(imageRef))
+}
+
+// ResolveRef resolves a secret reference, relative to the configured
+// directory, through the cache of the default store
+func ResolveRef(ctx context.Context, ref string) (string, error) {
+	return defaultStore.Resolve(ctx, ref)
+}
+
+// Lookup returns the credential of a registry host, resolving its
+// references on first use; ok is false when none is configured
+func (s *Store) Lookup(ctx context.Context, registry string) (Credential, bool, error) {
+	registry = normalizeRegistry(registry)
+	for _, c := range s.credentials {
+		if normalizeRegistry(c.Registry) != registry {
+			continue
+		}
+		username := c.Username
+		if config.IsSecretRef(username) {
+			// Usernames are not masked: they appear in image references
+			value, err := resolve(ctx, s.dir, username)
+			if err != nil {
+				return Credential{}, true, fmt.Errorf("credentials for %s: %w", c.Registry, err)
+			}
+			username = value
+		}
+		password, err := s.Resolve(ctx, c.Password)
+		if err != nil {
+			return Credential{}, true, fmt.Errorf("credentials for %s: %w", c.Registry, err)
+		}
+		return Credential{Registry: c.Registry, Username: username, Password: password}, true, nil
+	}
+	return Credential{}, false, nil
+}
+
+// Resolve resolves a secret reference, asking each source only once
+func (s *Store) Resolve(ctx context.Context, ref string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.cache[ref]; ok {
+		return value, nil
+	}
+	value, err := Resolve(ctx, s.dir, ref)
+	if err != nil {
+		return "", err
+	}
+	s.cache[ref] = value
+	return value, nil
+}
+
+// RegistryOf returns the registry host of an image reference or repository,
+// docker.io when it names none
+func RegistryOf(image string) string {
+	r, err := ref.Parse(image)
+	if err != nil || r.Registry == "" {
+		return "docker.io"
+	}
+	return r.Registry
+}
+
+// normalizeRegistry maps the aliases of Docker Hub to docker.io
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(strings.TrimSuffix(registry, "/"))
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return registry
+}
@@ -0,0 +1,619 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/iiroan/galena/internal/exec"
+	"github.com/iiroan/galena/internal/version"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// maxQueuedJobs bounds the jobs waiting for the running one
+const maxQueuedJobs = 32
+
+// logPollInterval is how often a followed job log is checked for output
+const logPollInterval = 500 * time.Millisecond
+
+// APIOptions configures the build API server
+type APIOptions struct {
+	Addr       string
+	Token      string   // Bearer token required on every request; empty allows any local client
+	RootDir    string   // Project root; job logs go to logs/api
+	Executable string   // galena-build binary that runs the jobs
+	BaseArgs   []string // Global flags passed to every job, e.g. --project
+	DiskTypes  []string // Accepted disk output types
+
+	// Status returns the project status served at /v1/status
+	Status func(ctx context.Context) (map[string]any, error)
+}
+
+// DefaultAPIOptions returns default API server options
+func DefaultAPIOptions() APIOptions {
+	return APIOptions{
+		Addr: "127.0.0.1:7878",
+	}
+}
+
+// Job is a build or disk run started through the API
+type Job struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"kind"` // build or disk
+	Args     []string        `json:"args"`
+	Status   string          `json:"status"`
+	Created  time.Time       `json:"created"`
+	Started  time.Time       `json:"started,omitzero"`
+	Finished time.Time       `json:"finished,omitzero"`
+	ExitCode int             `json:"exit_code"`
+	Error    string          `json:"error,omitempty"`
+	Summary  json.RawMessage `json:"summary,omitempty"` // The JSON summary the command emitted
+	LogPath  string          `json:"log_path"`
+
+	cancel context.CancelFunc
+}
+
+// BuildRequest is the body of POST /v1/builds
+type BuildRequest struct {
+	Variant     string   `json:"variant"`
+	Tag         string   `json:"tag"`
+	BuildNumber int      `json:"build_number"`
+	NoCache     bool     `json:"no_cache"`
+	Push        bool     `json:"push"`
+	Sign        bool     `json:"sign"`
+	SBOM        bool     `json:"sbom"`
+	Arch        []string `json:"arch"`
+	BuildArgs   []string `json:"build_args"`
+}
+
+// args returns the galena-build arguments of the request. Values are joined
+// to their flags so they are never parsed as flags themselves.
+func (r BuildRequest) args() []string {
+	// Wait for builds started from the command line instead of failing
+	args := []string{"build", "--wait"}
+	if r.Variant != "" {
+		args = append(args, "--variant="+r.Variant)
+	}
+	if r.Tag != "" {
+		args = append(args, "--tag="+r.Tag)
+	}
+	if r.BuildNumber > 0 {
+		args = append(args, "--build-number="+strconv.Itoa(r.BuildNumber))
+	}
+	if r.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if r.Push {
+		args = append(args, "--push")
+	}
+	if r.Sign {
+		args = append(args, "--sign")
+	}
+	if r.SBOM {
+		args = append(args, "--sbom")
+	}
+	if len(r.Arch) > 0 {
+		args = append(args, "--arch="+strings.Join(r.Arch, ","))
+	}
+	for _, arg := range r.BuildArgs {
+		args = append(args, "--build-arg="+arg)
+	}
+	return args
+}
+
+// DiskRequest is the body of POST /v1/disks
+type DiskRequest struct {
+	Type       string `json:"type"`
+	Image      string `json:"image"`
+	RootFS     string `json:"rootfs"`
+	TargetArch string `json:"target_arch"`
+	Force      bool   `json:"force"`
+}
+
+func (r DiskRequest) args() []string {
+	args := []string{"disk"}
+	if r.Image != "" {
+		args = append(args, "--image="+r.Image)
+	}
+	if r.RootFS != "" {
+		args = append(args, "--rootfs="+r.RootFS)
+	}
+	if r.TargetArch != "" {
+		args = append(args, "--target-arch="+r.TargetArch)
+	}
+	if r.Force {
+		args = append(args, "--force")
+	}
+	return append(args, "--", r.Type)
+}
+
+// APIServer lets dashboards and bots start builds, follow their logs, and
+// read their results over HTTP+JSON. Jobs run one at a time as galena-build
+// processes with --output-format json.
+type APIServer struct {
+	opts   APIOptions
+	logger *log.Logger
+
+	mu    sync.Mutex
+	jobs  []*Job
+	queue chan *Job
+	seq   int
+}
+
+// NewAPIServer creates a new build API server
+func NewAPIServer(opts APIOptions, logger *log.Logger) *APIServer {
+	return &APIServer{
+		opts:   opts,
+		logger: logger,
+		queue:  make(chan *Job, maxQueuedJobs),
+	}
+}
+
+// LogDir returns the directory job logs are written to
+func (s *APIServer) LogDir() string {
+	return filepath.Join(s.opts.RootDir, "logs", "api")
+}
+
+// ListenAndServe serves the API until the context is canceled, then cancels
+// the running job
+func (s *APIServer) ListenAndServe(ctx context.Context) error {
+	if s.opts.Token == "" && !isLoopback(s.opts.Addr) {
+		return fmt.Errorf("a token is required to listen on %s; bind to 127.0.0.1 or set one", s.opts.Addr)
+	}
+	if err := os.MkdirAll(s.LogDir(), 0o755); err != nil {
+		return fmt.Errorf("creating job log directory: %w", err)
+	}
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.work(workerCtx)
+	}()
+	defer func() {
+		stopWorker()
+		wg.Wait()
+	}()
+
+	srv := &http.Server{
+		Addr:              s.opts.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// Handler returns the HTTP handler of the API
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.handleStatus)
+	mux.HandleFunc("GET /v1/manifest", s.handleManifest)
+	mux.HandleFunc("POST /v1/builds", s.handleBuild)
+	mux.HandleFunc("POST /v1/disks", s.handleDisk)
+	mux.HandleFunc("GET /v1/jobs", s.handleJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleJob)
+	mux.HandleFunc("DELETE /v1/jobs/{id}", s.handleCancel)
+	mux.HandleFunc("GET /v1/jobs/{id}/log", s.handleLog)
+
+	var handler http.Handler = mux
+	if s.opts.Token != "" {
+		handler = s.tokenAuth(handler)
+	} else {
+		handler = loopbackHost(handler)
+	}
+	return s.logRequests(handler)
+}
+
+func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := map[string]any{}
+	if s.opts.Status != nil {
+		var err error
+		if status, err = s.opts.Status(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	s.mu.Lock()
+	queued := 0
+	for _, job := range s.jobs {
+		switch job.Status {
+		case JobRunning:
+			status["running_job"] = job.ID
+		case JobQueued:
+			queued++
+		}
+	}
+	s.mu.Unlock()
+	status["queued_jobs"] = queued
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *APIServer) handleManifest(w http.ResponseWriter, _ *http.Request) {
+	manifest, err := version.LoadManifest(filepath.Join(s.opts.RootDir, "build-manifest.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, "no build manifest yet")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, manifest)
+}
+
+func (s *APIServer) handleBuild(w http.ResponseWriter, r *http.Request) {
+	var req BuildRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	for _, value := range append([]string{req.Variant, req.Tag}, req.Arch...) {
+		if strings.HasPrefix(value, "-") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid value %q", value))
+			return
+		}
+	}
+	s.submit(w, "build", req.args())
+}
+
+func (s *APIServer) handleDisk(w http.ResponseWriter, r *http.Request) {
+	var req DiskRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Type == "" {
+		writeError(w, http.StatusBadRequest, "type is required")
+		return
+	}
+	if len(s.opts.DiskTypes) > 0 && !slices.Contains(s.opts.DiskTypes, req.Type) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown disk type %q (expected %s)", req.Type, strings.Join(s.opts.DiskTypes, ", ")))
+		return
+	}
+	s.submit(w, "disk", req.args())
+}
+
+// submit queues a job and responds with it
+func (s *APIServer) submit(w http.ResponseWriter, kind string, args []string) {
+	s.mu.Lock()
+	s.seq++
+	id := fmt.Sprintf("%s-%s-%d", kind, time.Now().Format("20060102-150405"), s.seq)
+	job := &Job{
+		ID:      id,
+		Kind:    kind,
+		Args:    args,
+		Status:  JobQueued,
+		Created: time.Now().UTC(),
+		LogPath: filepath.Join(s.LogDir(), id+".log"),
+	}
+	select {
+	case s.queue <- job:
+		s.jobs = append(s.jobs, job)
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "too many queued jobs")
+		return
+	}
+	snapshot := *job
+	s.mu.Unlock()
+
+	s.logger.Info("job queued", "id", id, "args", strings.Join(args, " "))
+	w.Header().Set("Location", "/v1/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (s *APIServer) handleJobs(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *s.jobs[i])
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *APIServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *APIServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var job *Job
+	for _, j := range s.jobs {
+		if j.ID == r.PathValue("id") {
+			job = j
+		}
+	}
+	if job == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	switch job.Status {
+	case JobQueued:
+		job.Status = JobCanceled
+		job.Finished = time.Now().UTC()
+	case JobRunning:
+		// The job is marked canceled once its process exited
+		job.cancel()
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, "job already "+job.Status)
+		return
+	}
+	snapshot := *job
+	s.mu.Unlock()
+
+	s.logger.Info("job canceled", "id", snapshot.ID)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// handleLog writes the output of a job. With ?follow=true it keeps
+// streaming until the job finished or the client went away.
+func (s *APIServer) handleLog(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	job, ok := s.job(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc := http.NewResponseController(w)
+
+	var file *os.File
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	for {
+		if file == nil {
+			f, err := os.Open(job.LogPath)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			file = f
+		}
+		if file != nil {
+			if _, err := io.Copy(w, file); err != nil {
+				return
+			}
+			_ = rc.Flush()
+		}
+		if !follow || job.done() {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(logPollInterval):
+		}
+		job, _ = s.job(id)
+	}
+}
+
+// job returns a snapshot of a job
+func (s *APIServer) job(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+func (j Job) done() bool {
+	return j.Status != JobQueued && j.Status != JobRunning
+}
+
+// work runs queued jobs one at a time until ctx is canceled
+func (s *APIServer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.queue:
+			s.run(ctx, job)
+		}
+	}
+}
+
+// run runs a job as a galena-build process, logging its output to the job
+// log and keeping the JSON summary it emits
+func (s *APIServer) run(ctx context.Context, job *Job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	if job.Status != JobQueued {
+		s.mu.Unlock()
+		return
+	}
+	job.Status = JobRunning
+	job.Started = time.Now().UTC()
+	job.cancel = cancel
+	s.mu.Unlock()
+	s.logger.Info("job started", "id", job.ID)
+
+	args := append(append(slices.Clone(s.opts.BaseArgs), "--output-format", "json"), job.Args...)
+	opts := exec.DefaultOptions()
+	opts.Dir = s.opts.RootDir
+	opts.Timeout = 0
+	opts.Logger = s.logger
+
+	logFile, err := os.Create(job.LogPath)
+	var result *exec.Result
+	if err != nil {
+		result = &exec.Result{ExitCode: -1, Err: fmt.Errorf("creating job log: %w", err)}
+	} else {
+		opts.SessionLog = logFile
+		result = exec.Run(ctx, s.opts.Executable, args, opts)
+		_ = logFile.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Finished = time.Now().UTC()
+	job.ExitCode = result.ExitCode
+	job.Summary = lastSummary(result.Stdout)
+	switch {
+	case ctx.Err() != nil:
+		job.Status = JobCanceled
+	case result.Err != nil:
+		job.Status = JobFailed
+		job.Error = result.Err.Error()
+		var summary struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(job.Summary, &summary) == nil && summary.Error != "" {
+			job.Error = summary.Error
+		}
+	default:
+		job.Status = JobSucceeded
+	}
+	s.logger.Info("job finished", "id", job.ID, "status", job.Status)
+}
+
+// lastSummary returns the summary line of JSON output
+func lastSummary(stdout string) json.RawMessage {
+	var summary json.RawMessage
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var probe struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(line, &probe) == nil && probe.Type == "summary" {
+			summary = json.RawMessage(slices.Clone(line))
+		}
+	}
+	return summary
+}
+
+// decodeRequest decodes a JSON request body. Requiring the JSON content type
+// keeps browsers from sending the request cross-site without a preflight.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func (s *APIServer) tokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="galena"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost rejects requests whose Host header does not name the local
+// machine. Without a token the loopback listener is the only protection, and
+// a web page could otherwise reach it through DNS rebinding.
+func loopbackHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !isLoopback(net.JoinHostPort(host, "0")) {
+			writeError(w, http.StatusForbidden, "requests must address the API through a loopback host")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Debug("api request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopback reports whether addr only accepts local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,194 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestBuildRequestArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		req  BuildRequest
+		want []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"build", "--wait"},
+		},
+		{
+			name: "every field",
+			req: BuildRequest{
+				Variant:     "nvidia",
+				Tag:         "beta",
+				BuildNumber: 42,
+				NoCache:     true,
+				Push:        true,
+				Sign:        true,
+				SBOM:        true,
+				Arch:        []string{"amd64", "arm64"},
+				BuildArgs:   []string{"VENDOR=acme", "DEBUG=1"},
+			},
+			want: []string{
+				"build", "--wait", "--variant=nvidia", "--tag=beta", "--build-number=42",
+				"--no-cache", "--push", "--sign", "--sbom", "--arch=amd64,arm64",
+				"--build-arg=VENDOR=acme", "--build-arg=DEBUG=1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.args(); !slices.Equal(got, tt.want) {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskRequestArgs(t *testing.T) {
+	req := DiskRequest{Type: "iso", Image: "ghcr.io/iiroan/galena:stable", RootFS: "btrfs", TargetArch: "aarch64", Force: true}
+	want := []string{"disk", "--image=ghcr.io/iiroan/galena:stable", "--rootfs=btrfs", "--target-arch=aarch64", "--force", "--", "iso"}
+	if got := req.args(); !slices.Equal(got, want) {
+		t.Errorf("args() = %q, want %q", got, want)
+	}
+}
+
+// apiRequest sends a request to the handler of s and returns the response
+func apiRequest(t *testing.T, s *APIServer, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Host = "127.0.0.1:7878"
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIAccess(t *testing.T) {
+	tokenOpts := DefaultAPIOptions()
+	tokenOpts.Token = "s3cret"
+
+	tests := []struct {
+		name   string
+		opts   APIOptions
+		host   string
+		header map[string]string
+		want   int
+	}{
+		{name: "loopback without token", opts: DefaultAPIOptions(), want: http.StatusOK},
+		{name: "rebound host without token", opts: DefaultAPIOptions(), host: "evil.example:7878", want: http.StatusForbidden},
+		{name: "missing token", opts: tokenOpts, want: http.StatusUnauthorized},
+		{name: "wrong token", opts: tokenOpts, header: map[string]string{"Authorization": "Bearer guess"}, want: http.StatusUnauthorized},
+		{name: "valid token", opts: tokenOpts, host: "build.lan:7878", header: map[string]string{"Authorization": "Bearer s3cret"}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAPIServer(tt.opts, log.New(nil))
+			req := httptest.NewRequest(http.MethodGet, "/v1/status", nil)
+			req.Host = "127.0.0.1:7878"
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("GET /v1/status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIRejectsInvalidRequests(t *testing.T) {
+	opts := DefaultAPIOptions()
+	opts.DiskTypes = []string{"qcow2", "iso"}
+	s := NewAPIServer(opts, log.New(nil))
+	jsonHeader := map[string]string{"Content-Type": "application/json"}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{name: "form content type", target: "/v1/builds", body: `{}`, header: map[string]string{"Content-Type": "text/plain"}, want: http.StatusUnsupportedMediaType},
+		{name: "unknown field", target: "/v1/builds", body: `{"variant":"main","shell":"rm -rf /"}`, header: jsonHeader, want: http.StatusBadRequest},
+		{name: "flag as value", target: "/v1/builds", body: `{"tag":"--push"}`, header: jsonHeader, want: http.StatusBadRequest},
+		{name: "flag as arch", target: "/v1/builds", body: `{"arch":["-x"]}`, header: jsonHeader, want: http.StatusBadRequest},
+		{name: "disk without type", target: "/v1/disks", body: `{}`, header: jsonHeader, want: http.StatusBadRequest},
+		{name: "unknown disk type", target: "/v1/disks", body: `{"type":"vhd"}`, header: jsonHeader, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := apiRequest(t, s, http.MethodPost, tt.target, tt.body, tt.header)
+			if rec.Code != tt.want {
+				t.Errorf("POST %s = %d, want %d: %s", tt.target, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIQueuesAndCancelsJobs(t *testing.T) {
+	opts := DefaultAPIOptions()
+	opts.RootDir = t.TempDir()
+	// No worker runs, so submitted jobs stay queued
+	s := NewAPIServer(opts, log.New(nil))
+
+	rec := apiRequest(t, s, http.MethodPost, "/v1/builds", `{"variant":"main","tag":"beta"}`, map[string]string{"Content-Type": "application/json"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /v1/builds = %d: %s", rec.Code, rec.Body.String())
+	}
+	var job Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobQueued || rec.Header().Get("Location") != "/v1/jobs/"+job.ID {
+		t.Fatalf("job = %+v, Location %q", job, rec.Header().Get("Location"))
+	}
+
+	rec = apiRequest(t, s, http.MethodGet, "/v1/status", "", nil)
+	var status map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status["queued_jobs"] != float64(1) {
+		t.Errorf("queued_jobs = %v, want 1", status["queued_jobs"])
+	}
+
+	rec = apiRequest(t, s, http.MethodDelete, "/v1/jobs/"+job.ID, "", nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("DELETE /v1/jobs/%s = %d: %s", job.ID, rec.Code, rec.Body.String())
+	}
+	rec = apiRequest(t, s, http.MethodDelete, "/v1/jobs/"+job.ID, "", nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second DELETE = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := apiRequest(t, s, http.MethodGet, "/v1/jobs/unknown", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /v1/jobs/unknown = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestLastSummary(t *testing.T) {
+	stdout := `{"type":"summary","command":"build","ok":false}
+{"level":"info","msg":"pushing"}
+{"type":"summary","command":"build","ok":true}
+not json
+`
+	want := `{"type":"summary","command":"build","ok":true}`
+	if got := string(lastSummary(stdout)); got != want {
+		t.Errorf("lastSummary() = %s, want %s", got, want)
+	}
+	if got := lastSummary("plain output\n"); got != nil {
+		t.Errorf("lastSummary() of plain output = %s, want nil", got)
+	}
+}
@@ -0,0 +1,303 @@
+// Package serve exposes build artifacts over HTTP for LAN installs and netboot
+package serve
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ChecksumsFile is the virtual path serving sha256sum-compatible checksums
+const ChecksumsFile = "SHA256SUMS"
+
+// Options configures the artifacts server
+type Options struct {
+	Dir      string
+	Addr     string
+	Username string
+	Password string
+}
+
+// DefaultOptions returns default server options
+func DefaultOptions() Options {
+	return Options{
+		Addr: ":8080",
+	}
+}
+
+// Artifact describes a file exposed by the server
+type Artifact struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+	SHA256   string
+}
+
+// Server serves an artifacts directory over HTTP
+type Server struct {
+	opts   Options
+	logger *log.Logger
+
+	mu        sync.Mutex
+	checksums map[string]cachedChecksum
+}
+
+type cachedChecksum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// NewServer creates a new artifacts server
+func NewServer(opts Options, logger *log.Logger) *Server {
+	return &Server{
+		opts:      opts,
+		logger:    logger,
+		checksums: make(map[string]cachedChecksum),
+	}
+}
+
+// ListenAndServe serves artifacts until the context is canceled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	info, err := os.Stat(s.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("artifacts directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("artifacts path %s is not a directory", s.opts.Dir)
+	}
+
+	srv := &http.Server{
+		Addr:              s.opts.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// Handler returns the HTTP handler for the artifacts directory
+func (s *Server) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.opts.Dir))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/", "/index.html":
+			s.serveIndex(w, r)
+		case "/" + ChecksumsFile:
+			s.serveChecksums(w, r)
+		default:
+			files.ServeHTTP(w, r)
+		}
+	})
+
+	var handler http.Handler = mux
+	if s.opts.Username != "" {
+		handler = s.basicAuth(handler)
+	}
+	return s.logRequests(handler)
+}
+
+// Artifacts lists files in the artifacts directory with their checksums
+func (s *Server) Artifacts() ([]Artifact, error) {
+	artifacts := []Artifact{}
+	err := filepath.Walk(s.opts.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.opts.Dir, path)
+		if err != nil {
+			return nil
+		}
+		sum, err := s.checksum(path, info)
+		if err != nil {
+			s.logger.Warn("could not checksum artifact", "path", path, "error", err)
+		}
+		artifacts = append(artifacts, Artifact{
+			Name:     filepath.ToSlash(rel),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			SHA256:   sum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking artifacts directory: %w", err)
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+// checksum returns the sha256 of a file, reusing cached values for unchanged files
+func (s *Server) checksum(path string, info os.FileInfo) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.checksums[path]
+	s.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.checksums[path] = cachedChecksum{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	s.mu.Unlock()
+	return sum, nil
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Galena artifacts</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #060B17; color: #E8EEFF; }
+a { color: #6DE6FF; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.3em 1em; border-bottom: 1px solid #26385F; }
+code { font-size: 0.85em; color: #8A94B8; }
+</style>
+</head>
+<body>
+<h1>Galena artifacts</h1>
+<p><a href="/{{.Checksums}}">{{.Checksums}}</a></p>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th><th>SHA256</th></tr>
+{{range .Artifacts}}<tr><td><a href="/{{.Name}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.Modified.Format "2006-01-02 15:04"}}</td><td><code>{{.SHA256}}</code></td></tr>
+{{else}}<tr><td colspan="4">No artifacts found</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (s *Server) serveIndex(w http.ResponseWriter, _ *http.Request) {
+	artifacts, err := s.Artifacts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		Checksums string
+		Artifacts []Artifact
+	}{
+		Checksums: ChecksumsFile,
+		Artifacts: artifacts,
+	}
+	if err := indexTemplate.Execute(w, data); err != nil {
+		s.logger.Warn("could not render index", "error", err)
+	}
+}
+
+func (s *Server) serveChecksums(w http.ResponseWriter, _ *http.Request) {
+	artifacts, err := s.Artifacts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	var b strings.Builder
+	for _, a := range artifacts {
+		if a.SHA256 == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s  %s\n", a.SHA256, a.Name)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		s.logger.Warn("could not write checksums", "error", err)
+	}
+}
+
+func (s *Server) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.opts.Username)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(s.opts.Password)) == 1
+		if !ok || !userOK || !passOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="galena artifacts"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Debug("artifact request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LANURLs returns the URLs under which the server is reachable on local networks
+func LANURLs(addr string) []string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		return []string{fmt.Sprintf("http://%s/", net.JoinHostPort(host, port))}
+	}
+
+	urls := []string{}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return urls
+	}
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		urls = append(urls, fmt.Sprintf("http://%s/", net.JoinHostPort(ipNet.IP.String(), port)))
+	}
+	return urls
+}
@@ -0,0 +1,132 @@
+package serve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+// artifactsServer creates a server for a directory holding the given files
+func artifactsServer(t *testing.T, opts Options, files map[string]string) *Server {
+	t.Helper()
+	opts.Dir = t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(opts.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewServer(opts, log.New(nil))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestServerChecksums(t *testing.T) {
+	s := artifactsServer(t, DefaultOptions(), map[string]string{
+		"disk.qcow2":       "qcow2",
+		"iso/install.iso":  "iso",
+		"build-notes.json": "{}",
+	})
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+ChecksumsFile, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /%s = %d", ChecksumsFile, rec.Code)
+	}
+	want := sha256Hex("{}") + "  build-notes.json\n" +
+		sha256Hex("qcow2") + "  disk.qcow2\n" +
+		sha256Hex("iso") + "  iso/install.iso\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("checksums =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestServerServesFilesAndIndex(t *testing.T) {
+	s := artifactsServer(t, DefaultOptions(), map[string]string{"iso/install.iso": "iso"})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/iso/install.iso", want: "iso"},
+		{path: "/", want: `href="/iso/install.iso"`},
+		{path: "/index.html", want: sha256Hex("iso")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d", tt.path, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("GET %s body does not contain %q:\n%s", tt.path, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServerBasicAuth(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Username = "lab"
+	opts.Password = "secret"
+	s := artifactsServer(t, opts, map[string]string{"disk.raw": "raw"})
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		auth     bool
+		want     int
+	}{
+		{name: "no credentials", want: http.StatusUnauthorized},
+		{name: "wrong password", user: "lab", password: "guess", auth: true, want: http.StatusUnauthorized},
+		{name: "wrong user", user: "admin", password: "secret", auth: true, want: http.StatusUnauthorized},
+		{name: "valid", user: "lab", password: "secret", auth: true, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/disk.raw", nil)
+			if tt.auth {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("GET /disk.raw = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLANURLs(t *testing.T) {
+	tests := []struct {
+		addr string
+		want []string
+	}{
+		{addr: "192.168.1.20:8080", want: []string{"http://192.168.1.20:8080/"}},
+		{addr: "[fd00::1]:9000", want: []string{"http://[fd00::1]:9000/"}},
+		{addr: "no-port", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := LANURLs(tt.addr); !slices.Equal(got, tt.want) {
+				t.Errorf("LANURLs(%q) = %q, want %q", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
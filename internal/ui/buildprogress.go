@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"charm.land/bubbles/v2/spinner"
+	tea "charm.land/bubbletea/v2"
+	lipgloss "charm.land/lipgloss/v2"
+
+	"github.com/iiroan/galena/internal/exec"
+)
+
+// buildProgressTail is the number of raw output lines shown below the progress
+const buildProgressTail = 6
+
+// BuildProgressModel renders live image build progress
+type BuildProgressModel struct {
+	spinner     spinner.Model
+	title       string
+	started     time.Time
+	progress    exec.BuildProgress
+	tail        []string
+	quitting    bool
+	interrupted bool
+	cancel      context.CancelFunc
+	err         error
+}
+
+type buildProgressMsg struct {
+	progress exec.BuildProgress
+	line     string
+}
+
+// NewBuildProgress creates a build progress view; cancel is called when the
+// user interrupts the build with ctrl+c
+func NewBuildProgress(title string, cancel context.CancelFunc) BuildProgressModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(string(Primary)))
+	return BuildProgressModel{
+		spinner: s,
+		title:   title,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+}
+
+func (m BuildProgressModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m BuildProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		if msg.String() == "ctrl+c" && !m.interrupted {
+			m.interrupted = true
+			m.cancel()
+		}
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case buildProgressMsg:
+		m.progress = msg.progress
+		if line := strings.TrimSpace(msg.line); line != "" {
+			m.tail = append(m.tail, line)
+			if len(m.tail) > buildProgressTail {
+				m.tail = m.tail[len(m.tail)-buildProgressTail:]
+			}
+		}
+	case errMsg:
+		m.err = msg.err
+		m.quitting = true
+		return m, tea.Quit
+	case doneMsg:
+		m.quitting = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m BuildProgressModel) View() tea.View {
+	elapsed := time.Since(m.started).Round(time.Second)
+	cache := fmt.Sprintf("cache %d hit / %d miss", m.progress.CacheHits(), m.progress.CacheMisses())
+
+	if m.quitting {
+		summary := fmt.Sprintf("%s (%s, %s)", m.title, elapsed, cache)
+		if m.err != nil {
+			return tea.NewView(ErrorStyle.Render("✗ Building "+summary+" failed: "+m.err.Error()) + "\n")
+		}
+		return tea.NewView(SuccessStyle.Render("✓ Built "+summary) + "\n")
+	}
+
+	start := time.Now()
+	var b strings.Builder
+	status := "Building " + m.title
+	if m.interrupted {
+		status = "Cancelling build of " + m.title
+	}
+	b.WriteString(m.spinner.View() + " " + status + "  " + MutedStyle.Render(elapsed.String()) + "\n")
+
+	p := m.progress
+	switch {
+	case p.Committing:
+		b.WriteString("  Committing image\n")
+	case p.Step > 0:
+		stage := ""
+		if p.Stages > 1 {
+			stage = fmt.Sprintf("stage %d/%d  ", p.Stage, p.Stages)
+		}
+		b.WriteString("  " + stage + FormatStep(p.Step, p.Steps, truncate(p.Instruction, contentWidth()-16), "running") + "\n")
+	default:
+		b.WriteString("  Preparing build context\n")
+	}
+	b.WriteString("  " + MutedStyle.Render(cache) + "\n")
+
+	if len(m.tail) > 0 {
+		b.WriteString("\n")
+		for _, line := range m.tail {
+			b.WriteString("  " + MutedStyle.Render(truncate(line, contentWidth()-2)) + "\n")
+		}
+	}
+
+	view := b.String()
+	RecordRender("build-progress", lipgloss.Width(view), lipgloss.Height(view), time.Since(start))
+	return tea.NewView(view)
+}
+
+func truncate(s string, width int) string {
+	if width <= 1 || lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) > width-1 {
+		runes = runes[:width-1]
+	}
+	return string(runes) + "…"
+}
+
+// RunBuildProgress runs an image build behind a live progress view. The
+// build writes its output to out; outside an interactive terminal out is nil
+// and the output streams as plain text.
+func RunBuildProgress(ctx context.Context, title string, run func(ctx context.Context, out io.Writer) error) error {
+	if !IsInteractiveTerminal() {
+		return run(ctx, nil)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := tea.NewProgram(NewBuildProgress(title, cancel))
+	out := exec.NewProgressWriter(func(progress exec.BuildProgress, line string) {
+		p.Send(buildProgressMsg{progress: progress, line: line})
+	})
+
+	errChan := make(chan error, 1)
+	go func() {
+		err := run(ctx, out)
+		errChan <- err
+		if err != nil {
+			p.Send(errMsg{err})
+		} else {
+			p.Send(doneMsg{})
+		}
+	}()
+
+	if _, err := p.Run(); err != nil {
+		cancel()
+		<-errChan
+		return fmt.Errorf("build progress error: %w", err)
+	}
+
+	err := <-errChan
+	if err != nil && ctx.Err() != nil {
+		// Report the cancellation rather than the engine's exit status
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	return err
+}
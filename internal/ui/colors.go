@@ -22,16 +22,17 @@ type Palette struct {
 	Disabled   bool
 }
 
-const defaultThemeName = "space"
+const (
+	defaultThemeName = "space"
+	lightThemeName   = "daylight"
 
-// ThemeNames returns supported palette names.
-func ThemeNames() []string {
-	return []string{defaultThemeName}
-}
+	// AutoTheme picks space or daylight to match the terminal background.
+	AutoTheme = "auto"
+)
 
-// PaletteByName returns a palette by theme name.
-func PaletteByName(_ string) Palette {
-	return Palette{
+// builtinPalettes are the themes that ship with Galena.
+var builtinPalettes = map[string]Palette{
+	defaultThemeName: {
 		Name:       defaultThemeName,
 		Primary:    lipgloss.Color("#7C9BFF"),
 		Secondary:  lipgloss.Color("#93B2FF"),
@@ -45,10 +46,73 @@ func PaletteByName(_ string) Palette {
 		Foreground: lipgloss.Color("#E8EEFF"),
 		Border:     lipgloss.Color("#26385F"),
 		Highlight:  lipgloss.Color("#9BC7FF"),
+	},
+	lightThemeName: {
+		Name:       lightThemeName,
+		Primary:    lipgloss.Color("#3454D1"),
+		Secondary:  lipgloss.Color("#2B4AB8"),
+		Accent:     lipgloss.Color("#0B7FA6"),
+		Info:       lipgloss.Color("#2563EB"),
+		Success:    lipgloss.Color("#0F8A5F"),
+		Warning:    lipgloss.Color("#A86400"),
+		Error:      lipgloss.Color("#C2264B"),
+		Muted:      lipgloss.Color("#5F6B8A"),
+		Background: lipgloss.Color("#F7F9FF"),
+		Foreground: lipgloss.Color("#1B2238"),
+		Border:     lipgloss.Color("#C5D0EA"),
+		Highlight:  lipgloss.Color("#1D4ED8"),
+	},
+}
+
+// ThemeNames returns supported palette names: auto, the built-in themes,
+// and the user themes that load.
+func ThemeNames() []string {
+	names := []string{AutoTheme, defaultThemeName, lightThemeName}
+	user, _ := UserThemes()
+	for _, p := range user {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// PaletteByName returns a palette by theme name, falling back to the
+// default theme when the name is unknown or its file does not load.
+func PaletteByName(name string) Palette {
+	p, _ := LoadPalette(name)
+	return p
+}
+
+// LoadPalette returns a palette by theme name. Auto and an empty name
+// follow the terminal background. Unknown names and broken user themes
+// return the default palette with an error.
+func LoadPalette(name string) (Palette, error) {
+	switch name {
+	case "", AutoTheme:
+		if hasDarkBackground() {
+			return builtinPalettes[defaultThemeName], nil
+		}
+		return builtinPalettes[lightThemeName], nil
+	}
+	if p, ok := builtinPalettes[name]; ok {
+		return p, nil
 	}
+	p, err := loadUserTheme(name)
+	if err != nil {
+		return builtinPalettes[defaultThemeName], err
+	}
+	return p, nil
 }
 
 // DefaultPalette returns the default theme palette.
 func DefaultPalette() Palette {
-	return PaletteByName(defaultThemeName)
+	return builtinPalettes[defaultThemeName]
+}
+
+// hasDarkBackground reports whether the terminal background is dark. Only
+// an interactive terminal is asked; anything else is assumed dark.
+func hasDarkBackground() bool {
+	if !IsInteractiveTerminal() {
+		return true
+	}
+	return lipgloss.HasDarkBackground()
 }
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lipgloss "charm.land/lipgloss/v2"
+	"github.com/charmbracelet/x/term"
+)
+
+// DebugEnvVar enables the UI debug overlay when set to a truthy value.
+const DebugEnvVar = "GALENA_UI_DEBUG"
+
+// DebugLogEnvVar overrides where render timings are written in debug mode.
+const DebugLogEnvVar = "GALENA_UI_DEBUG_LOG"
+
+var debugLog struct {
+	sync.Mutex
+	file *os.File
+	err  error
+	once sync.Once
+}
+
+// DebugEnabled reports whether the UI debug overlay is active.
+func DebugEnabled() bool {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(DebugEnvVar)))
+	return err == nil && enabled
+}
+
+// TerminalInfo describes the terminal the UI is rendering into.
+type TerminalInfo struct {
+	Width        int
+	Height       int
+	Term         string
+	ColorTerm    string
+	ColorProfile string
+	Interactive  bool
+	NoColor      bool
+}
+
+// DetectTerminal reports terminal size and ANSI capabilities.
+func DetectTerminal() TerminalInfo {
+	info := TerminalInfo{
+		Term:        os.Getenv("TERM"),
+		ColorTerm:   os.Getenv("COLORTERM"),
+		Interactive: IsInteractiveTerminal(),
+		NoColor:     CurrentPreferences.NoColor || os.Getenv("NO_COLOR") != "",
+	}
+	if width, height, err := term.GetSize(os.Stdout.Fd()); err == nil {
+		info.Width = width
+		info.Height = height
+	}
+	info.ColorProfile = colorProfileName(info)
+	return info
+}
+
+func colorProfileName(info TerminalInfo) string {
+	switch {
+	case info.NoColor:
+		return "none"
+	case !info.Interactive:
+		return "ascii"
+	case info.ColorTerm == "truecolor" || info.ColorTerm == "24bit":
+		return "truecolor"
+	case strings.Contains(info.Term, "256color"):
+		return "ansi256"
+	case info.Term == "dumb" || info.Term == "":
+		return "ascii"
+	default:
+		return "ansi"
+	}
+}
+
+// String renders the terminal info as a single diagnostic line.
+func (t TerminalInfo) String() string {
+	size := "unknown"
+	if t.Width > 0 {
+		size = fmt.Sprintf("%dx%d", t.Width, t.Height)
+	}
+	return fmt.Sprintf("size=%s TERM=%s COLORTERM=%s profile=%s tty=%t",
+		size, firstNonEmpty(t.Term, "-"), firstNonEmpty(t.ColorTerm, "-"), t.ColorProfile, t.Interactive)
+}
+
+// DebugOutline draws a labelled boundary around a layout block in debug mode.
+// Outside debug mode the block is returned unchanged.
+func DebugOutline(label string, block string) string {
+	if !DebugEnabled() {
+		return block
+	}
+	w, h := lipgloss.Width(block), lipgloss.Height(block)
+	style := lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color(string(Warning)))
+	tag := lipgloss.NewStyle().Foreground(lipgloss.Color(string(Warning))).
+		Render(fmt.Sprintf("%s %dx%d", label, w, h))
+	return lipgloss.JoinVertical(lipgloss.Left, tag, style.Render(block))
+}
+
+// DebugStatus returns the overlay status line for a rendered component and
+// records its render time. It returns "" outside debug mode.
+func DebugStatus(component string, width int, height int, elapsed time.Duration) string {
+	if !DebugEnabled() {
+		return ""
+	}
+	RecordRender(component, width, height, elapsed)
+	line := fmt.Sprintf("debug %s · model %dx%d · render %s · %s",
+		component, width, height, elapsed.Round(time.Microsecond), DetectTerminal())
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(string(Warning))).Render(line)
+}
+
+// RecordRender appends a render timing entry to the debug log.
+func RecordRender(component string, width int, height int, elapsed time.Duration) {
+	if !DebugEnabled() {
+		return
+	}
+	debugLog.once.Do(func() {
+		path := DebugLogPath()
+		debugLog.file, debugLog.err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	})
+	if debugLog.err != nil {
+		return
+	}
+	debugLog.Lock()
+	defer debugLog.Unlock()
+	_, _ = fmt.Fprintf(debugLog.file, "%s component=%s size=%dx%d render=%s\n",
+		time.Now().Format(time.RFC3339Nano), component, width, height, elapsed)
+}
+
+// DebugLogPath returns the file render timings are written to.
+func DebugLogPath() string {
+	if path := os.Getenv(DebugLogEnvVar); path != "" {
+		return path
+	}
+	return filepath.Join(os.TempDir(), "galena-ui-debug.log")
+}
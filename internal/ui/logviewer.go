@@ -0,0 +1,444 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"charm.land/bubbles/v2/textinput"
+	"charm.land/bubbles/v2/viewport"
+	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// logFollowInterval is how often a followed log is read for new output
+const logFollowInterval = 500 * time.Millisecond
+
+// logStartPhase names the lines before the first phase marker
+const logStartPhase = "start"
+
+var (
+	logErrorPattern   = regexp.MustCompile(`(?i)\b(error|errors|fatal|failed|failure|panic)\b`)
+	logWarningPattern = regexp.MustCompile(`(?i)\b(warn|warning|warnings|deprecated)\b`)
+)
+
+// logSeverity is how a log line is highlighted; the problems filter keeps
+// warnings and errors
+type logSeverity int
+
+const (
+	logPlain logSeverity = iota
+	logCommand
+	logHeader
+	logWarning
+	logError
+)
+
+// classifyLogLine picks the highlight of a line: section headers (===),
+// command lines (---), and lines mentioning warnings or errors
+func classifyLogLine(line string) logSeverity {
+	switch {
+	case strings.HasPrefix(line, "=== session failed"):
+		return logError
+	case strings.HasPrefix(line, "=== "):
+		return logHeader
+	case strings.HasPrefix(line, "--- "):
+		return logCommand
+	case logErrorPattern.MatchString(line):
+		return logError
+	case logWarningPattern.MatchString(line):
+		return logWarning
+	default:
+		return logPlain
+	}
+}
+
+func logLineStyle(severity logSeverity) lipgloss.Style {
+	switch severity {
+	case logError:
+		return ErrorStyle
+	case logWarning:
+		return WarningStyle
+	case logHeader:
+		return PanelTitle
+	case logCommand:
+		return lipgloss.NewStyle().Foreground(Info)
+	default:
+		return lipgloss.NewStyle()
+	}
+}
+
+// logLine is one line of the log and the phase it belongs to
+type logLine struct {
+	text     string
+	phase    int
+	severity logSeverity
+}
+
+// LogViewerOptions configures RunLogViewer
+type LogViewerOptions struct {
+	Title  string // Shown below the header, e.g. the session name
+	Path   string
+	Follow bool // Read new output as it is written and keep to the end
+	// Phase reports whether a line starts a phase of the log and names it;
+	// the phase filter steps through them
+	Phase func(line string) (string, bool)
+}
+
+type logViewerTickMsg int
+
+// logViewerModel shows a log in a viewport, filtered by phase and severity,
+// with the matches of a search highlighted
+type logViewerModel struct {
+	opts     LogViewerOptions
+	file     *os.File
+	partial  string // Last line, until its newline is written
+	lines    []logLine
+	phases   []string
+	phase    int  // Index into phases, -1 for all
+	problems bool // Only warnings and errors
+
+	search    textinput.Model
+	searching bool
+	query     string
+	matches   []int // Viewport lines matching query
+	match     int
+
+	follow  bool
+	tickGen int // Ticks of an earlier follow are ignored
+	sized   bool
+
+	viewport viewport.Model
+	width    int
+	height   int
+	err      error
+}
+
+func newLogViewer(opts LogViewerOptions, file *os.File) (logViewerModel, error) {
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "search"
+
+	m := logViewerModel{
+		opts:     opts,
+		file:     file,
+		phases:   []string{logStartPhase},
+		phase:    -1,
+		search:   search,
+		follow:   opts.Follow,
+		viewport: viewport.New(),
+	}
+	if err := m.read(); err != nil {
+		return m, err
+	}
+	m.refresh()
+	return m, nil
+}
+
+// read appends the output written to the log since the last read
+func (m *logViewerModel) read() error {
+	data, err := io.ReadAll(m.file)
+	if err != nil {
+		return fmt.Errorf("reading log: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	parts := strings.Split(m.partial+string(data), "\n")
+	m.partial = parts[len(parts)-1]
+	for _, part := range parts[:len(parts)-1] {
+		m.lines = append(m.lines, m.parseLine(part))
+	}
+	return nil
+}
+
+// parseLine cleans a complete line and records the phase it starts
+func (m *logViewerModel) parseLine(text string) logLine {
+	text = cleanLogLine(text)
+	if m.opts.Phase != nil {
+		if name, ok := m.opts.Phase(text); ok {
+			m.phases = append(m.phases, name)
+		}
+	}
+	return logLine{text: text, phase: len(m.phases) - 1, severity: classifyLogLine(text)}
+}
+
+// cleanLogLine strips terminal escapes and progress redraws from a line
+func cleanLogLine(text string) string {
+	text = ansi.Strip(strings.TrimRight(text, "\r"))
+	if i := strings.LastIndex(text, "\r"); i >= 0 {
+		text = text[i+1:]
+	}
+	return text
+}
+
+// refresh renders the lines that pass the filters into the viewport and
+// finds the search matches among them
+func (m *logViewerModel) refresh() {
+	atBottom := m.viewport.AtBottom()
+	lines := m.lines
+	if m.partial != "" {
+		// Shown as it is until complete; it starts no phase yet
+		text := cleanLogLine(m.partial)
+		lines = append(slices.Clip(lines), logLine{text: text, phase: len(m.phases) - 1, severity: classifyLogLine(text)})
+	}
+
+	query := strings.ToLower(m.query)
+	rendered := make([]string, 0, len(lines))
+	m.matches = m.matches[:0]
+	for _, line := range lines {
+		if m.phase >= 0 && line.phase != m.phase {
+			continue
+		}
+		if m.problems && line.severity < logWarning {
+			continue
+		}
+		if query != "" && strings.Contains(strings.ToLower(line.text), query) {
+			m.matches = append(m.matches, len(rendered))
+		}
+		rendered = append(rendered, renderLogLine(line, query))
+	}
+	m.viewport.SetContentLines(rendered)
+	m.match = min(m.match, max(len(m.matches)-1, 0))
+	if m.follow && atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+// renderLogLine highlights a line by severity and the matches of query,
+// which is lowercase
+func renderLogLine(line logLine, query string) string {
+	style := logLineStyle(line.severity)
+	lower := strings.ToLower(line.text)
+	if query == "" || len(lower) != len(line.text) {
+		return style.Render(line.text)
+	}
+	matchStyle := lipgloss.NewStyle().Foreground(Background).Background(Highlight).Bold(true)
+	text := line.text
+	var b strings.Builder
+	for {
+		i := strings.Index(lower, query)
+		if i < 0 {
+			break
+		}
+		b.WriteString(style.Render(text[:i]))
+		b.WriteString(matchStyle.Render(text[i : i+len(query)]))
+		text, lower = text[i+len(query):], lower[i+len(query):]
+	}
+	b.WriteString(style.Render(text))
+	return b.String()
+}
+
+// showMatch scrolls the current search match to the middle of the view
+func (m *logViewerModel) showMatch() {
+	if len(m.matches) == 0 {
+		return
+	}
+	m.viewport.SetYOffset(max(m.matches[m.match]-m.viewport.Height()/2, 0))
+}
+
+func (m *logViewerModel) resize() {
+	// Header, title, status line, and footer
+	chrome := lipgloss.Height(Header("logs")) + lipgloss.Height(Tagline.Render(m.opts.Title)) + 2
+	m.viewport.SetWidth(m.width)
+	m.viewport.SetHeight(max(m.height-chrome, 3))
+	m.search.SetWidth(max(m.width-4, 10))
+}
+
+// logViewerTick reads a followed log again after logFollowInterval
+func logViewerTick(gen int) tea.Cmd {
+	return tea.Tick(logFollowInterval, func(time.Time) tea.Msg {
+		return logViewerTickMsg(gen)
+	})
+}
+
+func (m logViewerModel) Init() tea.Cmd {
+	if m.follow {
+		return logViewerTick(m.tickGen)
+	}
+	return nil
+}
+
+func (m logViewerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.resize()
+		if !m.sized {
+			// Session logs end with their outcome, so start at the end
+			m.sized = true
+			m.viewport.GotoBottom()
+		}
+		return m, nil
+
+	case logViewerTickMsg:
+		if !m.follow || int(msg) != m.tickGen {
+			return m, nil
+		}
+		lines, partial := len(m.lines), m.partial
+		if err := m.read(); err != nil {
+			m.err = err
+			m.follow = false
+			return m, nil
+		}
+		if len(m.lines) != lines || m.partial != partial {
+			m.refresh()
+		}
+		return m, logViewerTick(m.tickGen)
+
+	case tea.KeyPressMsg:
+		if m.searching {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "enter":
+				m.searching = false
+				m.search.Blur()
+				m.query = m.search.Value()
+				m.match = 0
+				m.refresh()
+				m.showMatch()
+				return m, nil
+			case "esc":
+				m.searching = false
+				m.search.Blur()
+				m.search.SetValue(m.query)
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.search, cmd = m.search.Update(msg)
+			return m, cmd
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		case "esc":
+			if m.query == "" {
+				return m, tea.Quit
+			}
+			m.query = ""
+			m.search.SetValue("")
+			m.refresh()
+			return m, nil
+		case "/":
+			m.searching = true
+			return m, m.search.Focus()
+		case "n", "N":
+			if len(m.matches) > 0 {
+				step := 1
+				if msg.String() == "N" {
+					step = len(m.matches) - 1
+				}
+				m.match = (m.match + step) % len(m.matches)
+				m.showMatch()
+			}
+			return m, nil
+		case "p", "P":
+			if len(m.phases) > 1 {
+				// Cycle through all (-1) and each phase
+				step := 1
+				if msg.String() == "P" {
+					step = len(m.phases)
+				}
+				m.phase = (m.phase+1+step)%(len(m.phases)+1) - 1
+				m.refresh()
+				m.viewport.GotoTop()
+			}
+			return m, nil
+		case "e":
+			m.problems = !m.problems
+			m.refresh()
+			return m, nil
+		case "f":
+			m.follow = !m.follow
+			if m.follow {
+				m.tickGen++
+				m.viewport.GotoBottom()
+				return m, logViewerTick(m.tickGen)
+			}
+			return m, nil
+		case "g", "home":
+			m.viewport.GotoTop()
+			return m, nil
+		case "G", "end":
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m logViewerModel) View() tea.View {
+	start := time.Now()
+
+	phase := "all phases"
+	if m.phase >= 0 {
+		phase = fmt.Sprintf("phase %d/%d: %s", m.phase+1, len(m.phases), m.phases[m.phase])
+	}
+	status := []string{phase}
+	if m.problems {
+		status = append(status, "warnings and errors")
+	}
+	if m.query != "" {
+		if len(m.matches) == 0 {
+			status = append(status, fmt.Sprintf("%q: no matches", m.query))
+		} else {
+			status = append(status, fmt.Sprintf("%q: %d/%d", m.query, m.match+1, len(m.matches)))
+		}
+	}
+	if m.follow {
+		status = append(status, "following")
+	}
+	status = append(status, fmt.Sprintf("%d lines · %.f%%", m.viewport.TotalLineCount(), m.viewport.ScrollPercent()*100))
+	statusLine := MutedStyle.Render(strings.Join(status, " · "))
+	if m.err != nil {
+		statusLine = ErrorStyle.Render(m.err.Error())
+	}
+
+	footer := HintStyle.Render("↑↓ scroll · / search · n/N match · p/P phase · e problems · f follow · g/G top/end · q quit")
+	if m.searching {
+		footer = m.search.View()
+	}
+
+	screen := lipgloss.JoinVertical(lipgloss.Left,
+		Header("logs"),
+		Tagline.Render(m.opts.Title),
+		m.viewport.View(),
+		statusLine,
+		footer,
+	)
+	if debug := DebugStatus("logs", m.width, m.height, time.Since(start)); debug != "" {
+		screen = lipgloss.JoinVertical(lipgloss.Left, screen, debug)
+	}
+	v := tea.NewView(screen)
+	v.AltScreen = true
+	v.WindowTitle = "Galena Logs · " + m.opts.Title
+	return v
+}
+
+// RunLogViewer shows a log full screen with phase and severity filters and
+// search, following new output when opts.Follow is set
+func RunLogViewer(opts LogViewerOptions) error {
+	file, err := os.Open(opts.Path)
+	if err != nil {
+		return fmt.Errorf("opening log: %w", err)
+	}
+	defer file.Close()
+
+	m, err := newLogViewer(opts, file)
+	if err != nil {
+		return err
+	}
+	_, err = tea.NewProgram(m).Run()
+	return err
+}
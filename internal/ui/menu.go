@@ -55,12 +55,15 @@ func WithInitialSelectionID(id string) MenuOption {
 type menuKeyMap struct {
 	Select  key.Binding
 	Back    key.Binding
+	Home    key.Binding
 	Quit    key.Binding
 	Filter  key.Binding
 	Jump    key.Binding
 	hasBack bool
 }
 
+// newMenuKeyMap builds the shared key semantics: esc/q go back one level
+// (or quit at the top level), ~ jumps home, and ctrl+c always quits.
 func newMenuKeyMap(allowBack bool, backLabel string) menuKeyMap {
 	selectKey := key.NewBinding(
 		key.WithKeys("enter"),
@@ -80,6 +83,7 @@ func newMenuKeyMap(allowBack bool, backLabel string) menuKeyMap {
 			Filter:  filterKey,
 			Jump:    jumpKey,
 			Back:    key.NewBinding(key.WithKeys("esc", "q"), key.WithHelp("esc/q", backLabel)),
+			Home:    key.NewBinding(key.WithKeys("~"), key.WithHelp("~", "home")),
 			Quit:    key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "quit")),
 			hasBack: true,
 		}
@@ -95,14 +99,14 @@ func newMenuKeyMap(allowBack bool, backLabel string) menuKeyMap {
 
 func (k menuKeyMap) ShortHelp() []key.Binding {
 	if k.hasBack {
-		return []key.Binding{k.Select, k.Jump, k.Filter, k.Back}
+		return []key.Binding{k.Select, k.Jump, k.Filter, k.Back, k.Home}
 	}
 	return []key.Binding{k.Select, k.Jump, k.Filter, k.Quit}
 }
 
 func (k menuKeyMap) FullHelp() [][]key.Binding {
 	if k.hasBack {
-		return [][]key.Binding{{k.Select, k.Jump, k.Filter}, {k.Back, k.Quit}}
+		return [][]key.Binding{{k.Select, k.Jump, k.Filter}, {k.Back, k.Home, k.Quit}}
 	}
 	return [][]key.Binding{{k.Select, k.Jump, k.Filter}, {k.Quit}}
 }
@@ -299,7 +303,16 @@ func (m menuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, tea.Quit
 				}
 			}
+		case "~":
+			if m.allowBack && m.list.FilterState() != list.Filtering {
+				m.quitting = true
+				m.choice = MenuActionHome
+				return m, tea.Quit
+			}
 		case "q", "esc":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
 			m.quitting = true
 			if m.allowBack {
 				m.choice = MenuActionBack
@@ -371,6 +384,7 @@ func (m menuModel) View() tea.View {
 	if m.quitting {
 		return tea.View{}
 	}
+	start := time.Now()
 
 	width := m.width
 	height := m.height
@@ -394,6 +408,9 @@ func (m menuModel) View() tea.View {
 		PaddingLeft(1).
 		Render(m.renderRightPanel(layout.rightWidth-1, layout.rightHeight))
 
+	leftPanel = DebugOutline("list", leftPanel)
+	rightPanel = DebugOutline("details", rightPanel)
+
 	var body string
 	if layout.stacked {
 		body = lipgloss.JoinVertical(lipgloss.Left, leftPanel, "", rightPanel)
@@ -401,6 +418,9 @@ func (m menuModel) View() tea.View {
 		body = lipgloss.JoinHorizontal(lipgloss.Top, leftPanel, rightPanel)
 	}
 	footer := m.help.View(m.keys)
+	if status := DebugStatus("menu", width, height, time.Since(start)); status != "" {
+		footer = lipgloss.JoinVertical(lipgloss.Left, footer, status)
+	}
 
 	v := tea.NewView(Frame(m.title, m.subtitle, body, footer))
 	v.AltScreen = true
@@ -628,18 +648,19 @@ func firstNonEmpty(values ...string) string {
 
 // RunMenu displays a TUI list and returns the selected item ID.
 func RunMenu(title string, subtitle string, items []MenuItem) (string, error) {
-	if !IsInteractiveTerminal() {
-		return "", fmt.Errorf("non-interactive terminal")
-	}
-	model := newMenuModel(title, subtitle, items, defaultMenuConfig())
-	return runMenuModel(model)
+	return RunMenuWithOptions(title, subtitle, items)
 }
 
+// RunMenuWithOptions displays a TUI list with options. Menus opened below the
+// top level of the navigation stack get back navigation automatically.
 func RunMenuWithOptions(title string, subtitle string, items []MenuItem, options ...MenuOption) (string, error) {
 	if !IsInteractiveTerminal() {
 		return "", fmt.Errorf("non-interactive terminal")
 	}
 	cfg := defaultMenuConfig()
+	if NavDepth() > 1 {
+		cfg.allowBack = true
+	}
 	for _, opt := range options {
 		opt(&cfg)
 	}
@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Mode is how commands interact with the user
+type Mode int
+
+const (
+	// ModeAuto shows menus, forms, and live views when stdout is a terminal
+	// outside CI
+	ModeAuto Mode = iota
+	// ModePlain never prompts or takes over the screen: selections come from
+	// flags, progress is printed line by line, and output is not colored
+	ModePlain
+)
+
+// ErrNonInteractive marks a command that needed a prompt in plain mode or
+// outside a terminal
+var ErrNonInteractive = errors.New("no interactive terminal")
+
+var currentMode = ModeAuto
+
+// SetMode selects how commands interact with the user
+func SetMode(m Mode) {
+	currentMode = m
+}
+
+// CurrentMode returns how commands interact with the user
+func CurrentMode() Mode {
+	return currentMode
+}
+
+// IsPlain reports whether plain mode was selected
+func IsPlain() bool {
+	return currentMode == ModePlain
+}
+
+// RequireInteractive returns nil when prompts can be shown, else an error
+// that names the flags to pass instead
+func RequireInteractive(what, flags string) error {
+	if IsInteractiveTerminal() {
+		return nil
+	}
+	if flags == "" {
+		return fmt.Errorf("%s: %w", what, ErrNonInteractive)
+	}
+	return fmt.Errorf("%s: %w; pass %s instead", what, ErrNonInteractive, flags)
+}
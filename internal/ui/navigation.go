@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+
+	lipgloss "charm.land/lipgloss/v2"
+)
+
+// MenuActionHome is returned by a menu when the user asks to jump back to the top level.
+const MenuActionHome = "__home__"
+
+var (
+	// ErrNavigateHome unwinds nested menus back to the top-level menu.
+	ErrNavigateHome = errors.New("navigate home")
+	// ErrQuit unwinds every menu and exits the program.
+	ErrQuit = errors.New("quit")
+)
+
+var navStack []string
+
+// PushScreen records a menu level for breadcrumbs and returns the matching pop.
+//
+//	defer ui.PushScreen("Applications")()
+func PushScreen(title string) func() {
+	navStack = append(navStack, title)
+	depth := len(navStack)
+	return func() {
+		if len(navStack) >= depth {
+			navStack = navStack[:depth-1]
+		}
+	}
+}
+
+// NavDepth returns the number of menu levels currently on the stack.
+func NavDepth() int {
+	return len(navStack)
+}
+
+// Breadcrumbs returns the titles of the menu levels from the top down.
+func Breadcrumbs() []string {
+	return append([]string(nil), navStack...)
+}
+
+// NavigationError maps a menu action to the error a nested menu should return.
+// Plain back navigation returns nil so the caller simply redraws its own menu.
+func NavigationError(choice string) error {
+	switch choice {
+	case MenuActionHome:
+		return ErrNavigateHome
+	case MenuActionQuit:
+		return ErrQuit
+	default:
+		return nil
+	}
+}
+
+// IsNavigation reports whether err is a navigation signal rather than a failure.
+func IsNavigation(err error) bool {
+	return errors.Is(err, ErrNavigateHome) || errors.Is(err, ErrQuit)
+}
+
+// renderBreadcrumbs renders the navigation stack when inside a nested menu.
+func renderBreadcrumbs() string {
+	if len(navStack) < 2 {
+		return ""
+	}
+	sep := lipgloss.NewStyle().Foreground(lipgloss.Color(string(Muted))).Render(" › ")
+	parts := make([]string, len(navStack))
+	for i, title := range navStack {
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color(string(Muted)))
+		if i == len(navStack)-1 {
+			style = lipgloss.NewStyle().Foreground(lipgloss.Color(string(Accent))).Bold(true)
+		}
+		parts[i] = style.Render(title)
+	}
+	return strings.Join(parts, sep)
+}
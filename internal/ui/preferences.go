@@ -18,17 +18,23 @@ var CurrentPreferences = Preferences{
 	Advanced:   false,
 }
 
-// ApplyPreferences updates UI preferences and active palette.
-func ApplyPreferences(p Preferences) {
-	p.Theme = defaultThemeName
+// ApplyPreferences updates UI preferences and active palette. A theme that
+// does not load is replaced by the default one, and its error returned.
+func ApplyPreferences(p Preferences) error {
 	p.ShowBanner = false
 	CurrentPreferences = p
-	ApplyTheme(defaultThemeName, p.NoColor)
+	return ApplyTheme(p.Theme, p.NoColor)
 }
 
-// ApplyTheme switches the color palette for the TUI.
-func ApplyTheme(theme string, noColor bool) {
-	palette := PaletteByName(theme)
+// ApplyTheme switches the color palette for the TUI, falling back to the
+// default palette when the theme does not load.
+func ApplyTheme(theme string, noColor bool) error {
+	if noColor {
+		// Colors are off, so the terminal need not be asked for its background
+		theme = defaultThemeName
+	}
+	palette, err := LoadPalette(theme)
 	palette.Disabled = noColor
 	ApplyPalette(palette)
+	return err
 }
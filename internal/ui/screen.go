@@ -11,6 +11,9 @@ import (
 func StartScreen(title string, subtitle string) {
 	ClearScreen()
 	fmt.Println(Header(title))
+	if crumbs := renderBreadcrumbs(); crumbs != "" {
+		fmt.Println(crumbs)
+	}
 	if subtitle != "" {
 		fmt.Println(Tagline.Render(subtitle))
 	}
@@ -26,7 +29,12 @@ func ClearScreen() {
 	fmt.Print("\033[2J\033[H")
 }
 
+// IsInteractiveTerminal reports whether menus, forms, and live views can be
+// shown: stdout is a terminal, outside CI, and plain mode is off
 func IsInteractiveTerminal() bool {
+	if IsPlain() {
+		return false
+	}
 	if os.Getenv("CI") != "" || os.Getenv("GITHUB_ACTIONS") != "" {
 		return false
 	}
@@ -38,8 +46,11 @@ func IsInteractiveTerminal() bool {
 
 // Frame renders a full-screen TUI layout.
 func Frame(title string, subtitle string, body string, footer string) string {
-	parts := make([]string, 0, 5)
+	parts := make([]string, 0, 6)
 	parts = append(parts, Header(title))
+	if crumbs := renderBreadcrumbs(); crumbs != "" {
+		parts = append(parts, crumbs)
+	}
 	if subtitle != "" {
 		parts = append(parts, Tagline.Render(subtitle))
 	}
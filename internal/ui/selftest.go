@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	lipgloss "charm.land/lipgloss/v2"
+)
+
+// SelfTestResult is the outcome of rendering a single UI component.
+type SelfTestResult struct {
+	Component string
+	Output    string
+	Width     int
+	Height    int
+	Duration  time.Duration
+	Overflow  bool
+}
+
+// SelfTest renders every UI component at the given size and reports which ones
+// exceed the available width.
+func SelfTest(width int, height int) []SelfTestResult {
+	menuItems := []MenuItem{
+		{ID: "first", TitleText: "First Item", Details: "Short description"},
+		{ID: "second", TitleText: "Second Item With A Considerably Longer Title", Details: strings.Repeat("long details ", 8)},
+		{ID: "third", TitleText: "Third Item", Details: ""},
+	}
+
+	components := []struct {
+		name   string
+		render func() string
+	}{
+		{"banner", Banner},
+		{"header", func() string { return Header("self test") }},
+		{"frame", func() string {
+			pop := PushScreen("Self Test")
+			defer pop()
+			popNested := PushScreen("Frame")
+			defer popNested()
+			return Frame("frame", "Subtitle text", "body", "footer")
+		}},
+		{"menu", func() string {
+			model := newMenuModel("SELF TEST", "Menu rendering", menuItems, defaultMenuConfig())
+			updated, _ := model.Update(tea.WindowSizeMsg{Width: width, Height: height})
+			return updated.(menuModel).View().Content
+		}},
+		{"spinner", func() string { return NewSpinner("Working").View().Content }},
+		{"info-box", func() string { return InfoBox.Render("Info box\n\nSecond line") }},
+		{"success-box", func() string { return SuccessBox.Render("Success box") }},
+		{"warning-box", func() string { return WarningBox.Render("Warning box") }},
+		{"error-box", func() string { return ErrorBox.Render("Error box") }},
+		{"panel", func() string { return Panel.Render(PanelTitle.Render("Panel") + "\nPanel body") }},
+		{"table", func() string {
+			return lipgloss.JoinVertical(lipgloss.Left,
+				TableHeader.Render("NAME")+TableHeader.Render("VALUE"),
+				TableCell.Render("key")+TableCell.Render("value"),
+			)
+		}},
+		{"steps", func() string {
+			return strings.Join([]string{
+				FormatStep(1, 4, "pending step", "pending"),
+				FormatStep(2, 4, "running step", "running"),
+				FormatStep(3, 4, "finished step", "success"),
+				FormatStep(4, 4, "failed step", "error"),
+			}, "\n")
+		}},
+		{"styles", func() string {
+			return strings.Join([]string{
+				Title.Render("Title"),
+				Subtitle.Render("Subtitle"),
+				Tagline.Render("Tagline"),
+				SuccessStyle.Render("Success"),
+				WarningStyle.Render("Warning"),
+				ErrorStyle.Render("Error"),
+				MutedStyle.Render("Muted"),
+				KeyStyle.Render("key") + " " + HintStyle.Render("hint"),
+			}, "\n")
+		}},
+	}
+
+	widthOverride = width
+	defer func() { widthOverride = 0 }()
+
+	results := make([]SelfTestResult, 0, len(components))
+	for _, c := range components {
+		start := time.Now()
+		out := c.render()
+		elapsed := time.Since(start)
+		w, h := lipgloss.Width(out), lipgloss.Height(out)
+		results = append(results, SelfTestResult{
+			Component: c.name,
+			Output:    out,
+			Width:     w,
+			Height:    h,
+			Duration:  elapsed,
+			Overflow:  w > width,
+		})
+		RecordRender("selftest/"+c.name, w, h, elapsed)
+	}
+	return results
+}
+
+// FormatSelfTestSummary renders a one-line-per-component summary of a self test.
+func FormatSelfTestSummary(results []SelfTestResult, width int) string {
+	var b strings.Builder
+	for _, r := range results {
+		status := SuccessStyle.Render("ok")
+		if r.Overflow {
+			status = ErrorStyle.Render(fmt.Sprintf("overflow (+%d)", r.Width-width))
+		}
+		fmt.Fprintf(&b, "%-12s %4dx%-3d %10s  %s\n", r.Component, r.Width, r.Height, r.Duration.Round(time.Microsecond), status)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -2,7 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"charm.land/bubbles/v2/spinner"
@@ -61,14 +60,17 @@ func (m SpinnerModel) View() tea.View {
 		}
 		return tea.NewView(SuccessStyle.Render("✓ " + m.message + "\n"))
 	}
-	return tea.NewView(m.spinner.View() + " " + m.message + "\n")
+	start := time.Now()
+	view := m.spinner.View() + " " + m.message + "\n"
+	RecordRender("spinner", lipgloss.Width(view), 1, time.Since(start))
+	return tea.NewView(view)
 }
 
 type errMsg struct{ err error }
 type doneMsg struct{}
 
 func RunWithSpinner(message string, fn func() error) error {
-	if os.Getenv("CI") != "" || os.Getenv("GITHUB_ACTIONS") != "" {
+	if !IsInteractiveTerminal() {
 		fmt.Printf("⏳ %s...\n", message)
 		start := time.Now()
 		err := fn()
@@ -43,6 +43,7 @@ var (
 	BannerStyle       lipgloss.Style
 	InfoBox           lipgloss.Style
 	SuccessBox        lipgloss.Style
+	WarningBox        lipgloss.Style
 	ErrorBox          lipgloss.Style
 	Panel             lipgloss.Style
 	PanelTitle        lipgloss.Style
@@ -167,6 +168,13 @@ func rebuildStyles() {
 		MarginTop(1).
 		MarginBottom(1)
 
+	WarningBox = lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(Warning).
+		Padding(0, 1).
+		MarginTop(1).
+		MarginBottom(1)
+
 	ErrorBox = lipgloss.NewStyle().
 		Border(lipgloss.NormalBorder()).
 		BorderForeground(Error).
@@ -280,7 +288,13 @@ func contentWidth() int {
 	return terminalWidth()
 }
 
+// widthOverride replaces the detected terminal width while non-zero (used by SelfTest).
+var widthOverride int
+
 func terminalWidth() int {
+	if widthOverride > 0 {
+		return widthOverride
+	}
 	width, _, err := term.GetSize(os.Stdout.Fd())
 	if err != nil || width == 0 {
 		return 80
@@ -0,0 +1,197 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+// themeNamePattern matches the name of a user theme, taken from its file name
+var themeNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// hexColorPattern matches #RGB and #RRGGBB colors
+var hexColorPattern = regexp.MustCompile(`^#(?:[0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+// themeFile is a user theme. Colors are hex (#RRGGBB) or ANSI numbers
+// (0-255); colors left out come from the base theme.
+type themeFile struct {
+	Base       string `yaml:"base"`
+	Primary    string `yaml:"primary"`
+	Secondary  string `yaml:"secondary"`
+	Accent     string `yaml:"accent"`
+	Info       string `yaml:"info"`
+	Success    string `yaml:"success"`
+	Warning    string `yaml:"warning"`
+	Error      string `yaml:"error"`
+	Muted      string `yaml:"muted"`
+	Background string `yaml:"background"`
+	Foreground string `yaml:"foreground"`
+	Border     string `yaml:"border"`
+	Highlight  string `yaml:"highlight"`
+}
+
+// ThemeDir returns the directory user themes are read from,
+// ~/.config/galena/themes.
+func ThemeDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding config directory: %w", err)
+	}
+	return filepath.Join(dir, "galena", "themes"), nil
+}
+
+// UserThemes returns the user themes sorted by name, skipping those that do
+// not load; their errors are joined in the returned error.
+func UserThemes() ([]Palette, error) {
+	dir, err := ThemeDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		palettes []Palette
+		errs     []error
+	)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, builtin := builtinPalettes[name]; builtin || name == AutoTheme {
+			errs = append(errs, fmt.Errorf("%s: %s is a built-in theme name", entry.Name(), name))
+			continue
+		}
+		p, err := loadUserTheme(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		palettes = append(palettes, p)
+	}
+	sort.Slice(palettes, func(i, j int) bool { return palettes[i].Name < palettes[j].Name })
+	return palettes, errors.Join(errs...)
+}
+
+// loadUserTheme reads the user theme name from the theme directory
+func loadUserTheme(name string) (Palette, error) {
+	if !themeNamePattern.MatchString(name) {
+		return Palette{}, fmt.Errorf("unknown theme %q", name)
+	}
+	dir, err := ThemeDir()
+	if err != nil {
+		return Palette{}, err
+	}
+	path := filepath.Join(dir, name+".yaml")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Palette{}, fmt.Errorf("unknown theme %q (not built in and no %s)", name, path)
+	}
+	if err != nil {
+		return Palette{}, err
+	}
+	return parseTheme(name, data)
+}
+
+// parseTheme builds the palette of a user theme from its file contents
+func parseTheme(name string, data []byte) (Palette, error) {
+	var file themeFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return Palette{}, fmt.Errorf("theme %s: %w", name, err)
+	}
+
+	base := file.Base
+	if base == "" {
+		base = defaultThemeName
+	}
+	p, ok := builtinPalettes[base]
+	if !ok {
+		return Palette{}, fmt.Errorf("theme %s: base must be a built-in theme (%s, %s), not %q", name, defaultThemeName, lightThemeName, base)
+	}
+	p.Name = name
+
+	colors := []struct {
+		key   string
+		value string
+		field *lipgloss.Color
+	}{
+		{"primary", file.Primary, &p.Primary},
+		{"secondary", file.Secondary, &p.Secondary},
+		{"accent", file.Accent, &p.Accent},
+		{"info", file.Info, &p.Info},
+		{"success", file.Success, &p.Success},
+		{"warning", file.Warning, &p.Warning},
+		{"error", file.Error, &p.Error},
+		{"muted", file.Muted, &p.Muted},
+		{"background", file.Background, &p.Background},
+		{"foreground", file.Foreground, &p.Foreground},
+		{"border", file.Border, &p.Border},
+		{"highlight", file.Highlight, &p.Highlight},
+	}
+	for _, c := range colors {
+		if c.value == "" {
+			continue
+		}
+		if !validColor(c.value) {
+			return Palette{}, fmt.Errorf("theme %s: %s: %q is not a #RRGGBB color or ANSI number (0-255)", name, c.key, c.value)
+		}
+		*c.field = lipgloss.Color(c.value)
+	}
+	return p, nil
+}
+
+// ThemePreview renders a header, status lines, and a button in the colors
+// of a theme, for picking one.
+func ThemePreview(name string) string {
+	p, err := LoadPalette(name)
+	if err != nil {
+		return err.Error()
+	}
+	title := p.Name
+	if name == "" || name == AutoTheme {
+		title = AutoTheme + " → " + p.Name
+	}
+
+	text := lipgloss.NewStyle().Foreground(p.Foreground)
+	lines := []string{
+		lipgloss.NewStyle().Foreground(p.Foreground).Background(p.Border).Bold(true).Padding(0, 1).Render("GALENA") +
+			lipgloss.NewStyle().Foreground(p.Background).Background(p.Primary).Bold(true).Padding(0, 1).Render(title),
+		lipgloss.NewStyle().Foreground(p.Secondary).Bold(true).Render("Project") + " " + lipgloss.NewStyle().Foreground(p.Muted).Italic(true).Render("muted details"),
+		lipgloss.NewStyle().Foreground(p.Success).Render("✓") + text.Render(" built") + "  " +
+			lipgloss.NewStyle().Foreground(p.Warning).Render("!") + text.Render(" stale") + "  " +
+			lipgloss.NewStyle().Foreground(p.Error).Render("✗") + text.Render(" failed"),
+		lipgloss.NewStyle().Foreground(p.Info).Render("info") + "  " +
+			lipgloss.NewStyle().Foreground(p.Accent).Render("accent") + "  " +
+			lipgloss.NewStyle().Foreground(p.Highlight).Bold(true).Render("highlight"),
+		lipgloss.NewStyle().Foreground(p.Background).Background(p.Primary).Bold(true).Padding(0, 1).Render("Deploy Now"),
+	}
+	return lipgloss.NewStyle().
+		Background(p.Background).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(p.Border).
+		Padding(0, 1).
+		Render(strings.Join(lines, "\n"))
+}
+
+// validColor reports whether s is a hex color or an ANSI color number
+func validColor(s string) bool {
+	if hexColorPattern.MatchString(s) {
+		return true
+	}
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 0 && n <= 255
+}
@@ -2,6 +2,7 @@ package validate
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,15 +20,17 @@ func Config(_ context.Context, rootDir, configPath string) Result {
 	}
 
 	if _, err := os.Stat(path); err == nil {
-		loadedCfg, err := config.Load(path)
-		if err != nil {
-			result.AddError(fmt.Sprintf("Config: %v", err))
-			result.AddItem(StatusError, filepath.Base(path), err.Error())
-			return result
-		}
-		if err := loadedCfg.Validate(); err != nil {
-			result.AddError(fmt.Sprintf("Config: %v", err))
-			result.AddItem(StatusError, filepath.Base(path), err.Error())
+		if err := config.ValidateFile(path); err != nil {
+			var validationErr *config.ValidationError
+			if !errors.As(err, &validationErr) {
+				result.AddError(fmt.Sprintf("Config: %v", err))
+				result.AddItem(StatusError, filepath.Base(path), err.Error())
+				return result
+			}
+			for _, fe := range validationErr.Errors {
+				result.AddError(fmt.Sprintf("Config: %s", fe.Error()))
+				result.AddItem(StatusError, filepath.Base(path), fe.Error())
+			}
 			return result
 		}
 		result.AddItem(StatusSuccess, filepath.Base(path), "")
@@ -10,9 +10,14 @@ import (
 
 // Containerfile validates Containerfile syntax by building the ctx stage.
 func Containerfile(ctx context.Context, rootDir string) Result {
+	return ContainerfileAt(ctx, rootDir, filepath.Join(rootDir, "Containerfile"))
+}
+
+// ContainerfileAt validates a Containerfile at an explicit path, such as one
+// rendered from Containerfile.tmpl, using rootDir as the build context.
+func ContainerfileAt(ctx context.Context, rootDir, containerfile string) Result {
 	result := Result{}
 
-	containerfile := filepath.Join(rootDir, "Containerfile")
 	if _, err := os.Stat(containerfile); err != nil {
 		result.AddError("Containerfile not found")
 		result.AddItem(StatusError, "Containerfile", "not found")
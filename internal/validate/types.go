@@ -10,19 +10,40 @@ const (
 	StatusError
 )
 
+// String returns the name of the status, as used in JSON output.
+func (s Status) String() string {
+	switch s {
+	case StatusSuccess:
+		return "success"
+	case StatusWarning:
+		return "warning"
+	case StatusPending:
+		return "pending"
+	case StatusError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the status by name.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 // Item represents a single validation result.
 type Item struct {
-	Name    string
-	Status  Status
-	Details string
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Details string `json:"details,omitempty"`
 }
 
 // Result captures outcomes for a validation check.
 type Result struct {
-	Items    []Item
-	Errors   []string
-	Warnings []string
-	Pending  []string
+	Items    []Item   `json:"items"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Pending  []string `json:"pending,omitempty"`
 }
 
 // AddItem appends an item with status and optional details.
@@ -21,6 +21,7 @@ type Info struct {
 	ImageRef      string    `json:"image_ref,omitempty"`
 	Variant       string    `json:"variant,omitempty"`
 	Tag           string    `json:"tag,omitempty"`
+	Reproducible  bool      `json:"reproducible,omitempty"`
 }
 
 // BuildManifest holds the complete build manifest
@@ -33,15 +34,40 @@ type BuildManifest struct {
 	Artifacts     []string  `json:"artifacts,omitempty"`
 	SBOM          *SBOM     `json:"sbom,omitempty"`
 	Signatures    []string  `json:"signatures,omitempty"`
+	Pushes        []Push    `json:"pushes,omitempty"`
+	Disks         []Disk    `json:"disks,omitempty"`
+}
+
+// Disk records a disk image built from the image and its checksums
+type Disk struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+}
+
+// Push records the outcome of pushing an image to one registry
+type Push struct {
+	Registry string `json:"registry"`
+	Image    string `json:"image"`
+	Digest   string `json:"digest,omitempty"`
+	Status   string `json:"status"` // pushed or failed
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
 }
 
 // Image represents a built image
 type Image struct {
-	Name    string `json:"name"`
-	Tag     string `json:"tag"`
-	Digest  string `json:"digest,omitempty"`
-	Size    int64  `json:"size,omitempty"`
-	Variant string `json:"variant"`
+	Name            string   `json:"name"`
+	Tag             string   `json:"tag"`
+	Digest          string   `json:"digest,omitempty"`
+	RechunkedDigest string   `json:"rechunked_digest,omitempty"`
+	Size            int64    `json:"size,omitempty"`
+	Variant         string   `json:"variant"`
+	Platforms       []string `json:"platforms,omitempty"`
+	Status          string   `json:"status,omitempty"`
+	Error           string   `json:"error,omitempty"`
 }
 
 // SBOM holds SBOM metadata
@@ -83,6 +109,14 @@ func (v Info) WithGit(commit, branch string, dirty bool) Info {
 	return v
 }
 
+// WithSourceDate pins the build date to a SOURCE_DATE_EPOCH for reproducible builds
+func (v Info) WithSourceDate(epoch int64) Info {
+	v.BuildDate = time.Unix(epoch, 0).UTC()
+	v.Version = ComputeWithDate(v.FedoraVersion, v.BuildDate, v.BuildNumber)
+	v.Reproducible = true
+	return v
+}
+
 // WithImage adds image information to the version info
 func (v Info) WithImage(imageRef, variant, tag string) Info {
 	v.ImageRef = imageRef
@@ -114,11 +148,44 @@ func (m *BuildManifest) AddImage(name, tag, digest, variant string, size int64)
 	})
 }
 
+// AddManifestList adds a multi-architecture manifest list to the manifest
+func (m *BuildManifest) AddManifestList(name, tag, digest, variant string, platforms []string) {
+	m.Images = append(m.Images, Image{
+		Name:      name,
+		Tag:       tag,
+		Digest:    digest,
+		Variant:   variant,
+		Platforms: append([]string(nil), platforms...),
+	})
+}
+
+// AddFailedImage records a variant that failed to build
+func (m *BuildManifest) AddFailedImage(name, tag, variant string, err error) {
+	m.Images = append(m.Images, Image{
+		Name:    name,
+		Tag:     tag,
+		Variant: variant,
+		Status:  "failed",
+		Error:   err.Error(),
+	})
+}
+
 // AddArtifact adds an artifact to the manifest
 func (m *BuildManifest) AddArtifact(path string) {
 	m.Artifacts = append(m.Artifacts, path)
 }
 
+// AddDisk records a disk image, replacing an earlier record of the same path
+func (m *BuildManifest) AddDisk(d Disk) {
+	for i := range m.Disks {
+		if m.Disks[i].Path == d.Path {
+			m.Disks[i] = d
+			return
+		}
+	}
+	m.Disks = append(m.Disks, d)
+}
+
 // SetSBOM sets the SBOM information
 func (m *BuildManifest) SetSBOM(format, location string) {
 	m.SBOM = &SBOM{
@@ -132,6 +199,18 @@ func (m *BuildManifest) AddSignature(ref string) {
 	m.Signatures = append(m.Signatures, ref)
 }
 
+// SetPush records the result of a push, replacing an earlier result for the
+// same destination
+func (m *BuildManifest) SetPush(p Push) {
+	for i := range m.Pushes {
+		if m.Pushes[i].Image == p.Image {
+			m.Pushes[i] = p
+			return
+		}
+	}
+	m.Pushes = append(m.Pushes, p)
+}
+
 // Save saves the manifest to a file
 func (m *BuildManifest) Save(path string) error {
 	data, err := json.MarshalIndent(m, "", "  ")
@@ -184,16 +263,23 @@ func (v Info) OSReleaseVars() map[string]string {
 func (v Info) Labels() map[string]string {
 	labels := map[string]string{
 		"org.opencontainers.image.version":  v.Version,
-		"org.opencontainers.image.created":  v.BuildDate.Format(time.RFC3339),
 		"org.opencontainers.image.revision": v.GitCommit,
 	}
 
+	// Reproducible builds carry no wall-clock timestamps
+	if !v.Reproducible {
+		labels["org.opencontainers.image.created"] = v.BuildDate.Format(time.RFC3339)
+	}
+
 	if v.Variant != "" {
 		labels["io.galena.variant"] = v.Variant
 	}
 	if v.Tag != "" {
 		labels["io.galena.tag"] = v.Tag
 	}
+	if v.GitDirty {
+		labels["io.galena.git.dirty"] = "true"
+	}
 
 	return labels
 }